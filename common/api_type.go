@@ -2,10 +2,24 @@ package common
 
 import "github.com/QuantumNous/new-api/constant"
 
+// pluginChannelAPITypes 第三方适配器服务的渠道类型，只在 init 阶段写入
+var pluginChannelAPITypes = map[int]int{}
+
+// pluginChannelEndpointTypes 第三方适配器声明支持的端点类型
+var pluginChannelEndpointTypes = map[int][]constant.EndpointType{}
+
+// RegisterPluginChannelAPIType binds a channel type to the api type of a third-party adaptor.
+func RegisterPluginChannelAPIType(channelType int, apiType int, endpointTypes []constant.EndpointType) {
+	pluginChannelAPITypes[channelType] = apiType
+	if len(endpointTypes) > 0 {
+		pluginChannelEndpointTypes[channelType] = endpointTypes
+	}
+}
+
 func ChannelType2APIType(channelType int) (int, bool) {
 	apiType := -1
 	switch channelType {
-	case constant.ChannelTypeOpenAI:
+	case constant.ChannelTypeOpenAI, constant.ChannelTypeGroq:
 		apiType = constant.APITypeOpenAI
 	case constant.ChannelTypeAnthropic:
 		apiType = constant.APITypeAnthropic
@@ -73,10 +87,19 @@ func ChannelType2APIType(channelType int) (int, bool) {
 		apiType = constant.APITypeMiniMax
 	case constant.ChannelTypeReplicate:
 		apiType = constant.APITypeReplicate
+	case constant.ChannelTypeStability:
+		apiType = constant.APITypeStability
 	case constant.ChannelTypeCodex:
 		apiType = constant.APITypeCodex
+	case constant.ChannelTypeMock:
+		apiType = constant.APITypeMock
+	case constant.ChannelTypeVLLM, constant.ChannelTypeTGI, constant.ChannelTypeLlamaCpp:
+		apiType = constant.APITypeSelfHosted
 	}
 	if apiType == -1 {
+		if pluginApiType, ok := pluginChannelAPITypes[channelType]; ok {
+			return pluginApiType, true
+		}
 		return constant.APITypeOpenAI, false
 	}
 	return apiType, true
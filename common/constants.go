@@ -78,6 +78,9 @@ var DetailedLogRetentionDays = 30
 var TLSInsecureSkipVerify bool
 var InsecureTLSConfig = &tls.Config{InsecureSkipVerify: true}
 
+// OfflineMode 离线部署模式，禁止渠道请求以外的外部调用，如模型元数据同步、词表下载和检查更新
+var OfflineMode bool
+
 var SMTPServer = ""
 var SMTPPort = 587
 var SMTPSSLEnabled = false
@@ -116,6 +119,9 @@ var RetryTimes = 0
 
 var IsMasterNode bool
 
+// NodeRegion is the region this instance is deployed in, used for region-aware channel routing
+var NodeRegion string
+
 var requestInterval int
 var RequestInterval time.Duration
 
@@ -126,6 +132,44 @@ var BatchUpdateInterval int
 
 var RelayTimeout int // unit is second
 
+// LogHashChainEnabled links consume logs into a per-user HMAC chain for tamper evidence
+var LogHashChainEnabled bool
+
+// ImpersonationMaxMinutes is the hard time limit of an admin impersonation session
+var ImpersonationMaxMinutes int
+
+// MetricsToken protects the Prometheus metrics endpoint, the endpoint is disabled when empty
+var MetricsToken string
+
+// MetricsUserLabelsEnabled exposes per user request and token counters on the metrics endpoint
+var MetricsUserLabelsEnabled bool
+
+// MetricsGroupLabelsEnabled and MetricsModelLabelsEnabled expose request and token counters per group and model
+var MetricsGroupLabelsEnabled bool
+var MetricsModelLabelsEnabled bool
+
+// MetricsLabelTopN keeps the N user, group and model label values with the most requests on the metrics endpoint
+// and folds the rest into "other", 0 keeps every value
+var MetricsLabelTopN int
+
+// AccountDeletionCooldownHours is how long a self-service account deletion waits before it is executed,
+// the user can cancel the request during this period. 0 deletes the account immediately
+var AccountDeletionCooldownHours int
+
+// MaxClientRequestTimeout caps the deadline clients can request with the X-Request-Timeout header (seconds),
+// 0 ignores the header
+var MaxClientRequestTimeout int
+
+// 模拟登录时会话中保存的管理员信息
+const (
+	SessionKeyImpersonatorId         = "impersonator_id"
+	SessionKeyImpersonatorUsername   = "impersonator_username"
+	SessionKeyImpersonationExpiresAt = "impersonation_expires_at"
+)
+
+// SessionKeyLoginAt 会话的登录时间，早于用户 SessionsRevokedAt 的会话视为已吊销
+const SessionKeyLoginAt = "login_at"
+
 var RelayMaxIdleConns int
 var RelayMaxIdleConnsPerHost int
 
@@ -176,6 +220,9 @@ var (
 
 	DownloadRateLimitNum            = 10
 	DownloadRateLimitDuration int64 = 60
+
+	NotifySandboxRateLimitNum            = 10
+	NotifySandboxRateLimitDuration int64 = 60
 )
 
 var RateLimitKeyExpirationDuration = 20 * time.Minute
@@ -0,0 +1,117 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxDecodedPayloadBytes 为日志解压载荷时的大小上限，避免压缩炸弹占用内存
+const maxDecodedPayloadBytes = 32 << 20
+
+var ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+
+// IsSupportedContentEncoding reports whether NewContentDecoder can decode the Content-Encoding.
+func IsSupportedContentEncoding(encoding string) bool {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip", "deflate", "br", "zstd":
+		return true
+	}
+	return false
+}
+
+// NewContentDecoder wraps body with a reader that decodes the Content-Encoding, closing the returned reader also
+// closes body. deflate accepts both the zlib format required by HTTP and the raw format some servers send.
+func NewContentDecoder(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	var reader io.Reader
+	closeFn := body.Close
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = gzipReader
+	case "deflate":
+		buffered := bufio.NewReader(body)
+		header, err := buffered.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+		// zlib 头的第一个字节低 4 位为 8（deflate），且前两个字节按大端是 31 的倍数
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			zlibReader, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, err
+			}
+			reader = zlibReader
+		} else {
+			reader = flate.NewReader(buffered)
+		}
+	case "br":
+		reader = brotli.NewReader(body)
+	case "zstd":
+		zstdReader, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = zstdReader
+		closeFn = func() error {
+			zstdReader.Close()
+			return body.Close()
+		}
+	default:
+		return nil, ErrUnsupportedContentEncoding
+	}
+	return &decodedBody{Reader: reader, closeFn: closeFn}, nil
+}
+
+type decodedBody struct {
+	io.Reader
+	closeFn func() error
+}
+
+func (b *decodedBody) Close() error {
+	return b.closeFn()
+}
+
+// DecodePayload decodes a complete compressed payload, the encoding is detected from the magic bytes of gzip, zstd
+// and zlib when it is empty. It returns false when the payload is not compressed or cannot be decoded.
+func DecodePayload(data []byte, encoding string) ([]byte, bool) {
+	if encoding == "" {
+		encoding = detectPayloadEncoding(data)
+	}
+	if encoding == "" || !IsSupportedContentEncoding(encoding) {
+		return nil, false
+	}
+	reader, err := NewContentDecoder(io.NopCloser(bytes.NewReader(data)), encoding)
+	if err != nil {
+		return nil, false
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(io.LimitReader(reader, maxDecodedPayloadBytes+1))
+	if err != nil || len(decoded) > maxDecodedPayloadBytes {
+		return nil, false
+	}
+	return decoded, true
+}
+
+func detectPayloadEncoding(data []byte) string {
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		return "gzip"
+	case len(data) >= 4 && data[0] == 0x28 && data[1] == 0xb5 && data[2] == 0x2f && data[3] == 0xfd:
+		return "zstd"
+	case len(data) >= 2 && data[0] == 0x78 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		return "deflate"
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compressForTest(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(&buf)
+	case "deflate":
+		writer = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		writer, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		writer = brotli.NewWriter(&buf)
+	case "zstd":
+		zstdWriter, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer = zstdWriter
+	}
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodePayload(t *testing.T) {
+	payload := []byte(`{"id":"chatcmpl-1","choices":[{"message":{"content":"hello"}}]}`)
+	cases := []struct {
+		compression string
+		header      string
+	}{
+		{"gzip", "gzip"},
+		{"gzip", ""},
+		{"deflate", "deflate"},
+		{"deflate", ""},
+		{"raw-deflate", "deflate"},
+		{"br", "br"},
+		{"zstd", "zstd"},
+		{"zstd", ""},
+	}
+	for _, tc := range cases {
+		decoded, ok := DecodePayload(compressForTest(t, tc.compression, payload), tc.header)
+		if !ok || !bytes.Equal(decoded, payload) {
+			t.Fatalf("%s with header %q: decoded %q, ok %v", tc.compression, tc.header, decoded, ok)
+		}
+	}
+
+	if _, ok := DecodePayload(payload, ""); ok {
+		t.Fatal("plain payload should not be decoded")
+	}
+	if _, ok := DecodePayload(payload, "compress"); ok {
+		t.Fatal("unsupported encoding should not be decoded")
+	}
+}
@@ -13,3 +13,13 @@ var UsingMySQL = false
 var UsingClickHouse = false
 
 var SQLitePath = "one-api.db?_busy_timeout=30000"
+
+// SQLite 调优参数，通过 _pragma 追加到连接串，连接池中的每个连接都会生效
+var SQLiteJournalMode = "WAL"
+var SQLiteSynchronous = "NORMAL"
+var SQLiteBusyTimeout = 30000 // 毫秒
+
+// SQLiteCheckpointInterval 定期 checkpoint 的间隔（秒），0 表示只依赖 SQLite 的自动 checkpoint。
+// 默认的 PASSIVE 模式不会等待读事务，不影响 litestream 等复制工具持有的读锁
+var SQLiteCheckpointInterval = 300
+var SQLiteCheckpointMode = "PASSIVE"
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
+	"mime"
 	"net/smtp"
 	"slices"
 	"strings"
@@ -19,7 +20,19 @@ func generateMessageID() (string, error) {
 	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), GetRandomString(12), domain), nil
 }
 
+// EmailAttachment 邮件附件
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
 func SendEmail(subject string, receiver string, content string) error {
+	return SendEmailWithAttachments(subject, receiver, content, nil)
+}
+
+// SendEmailWithAttachments sends an HTML email, with the attachments when there are any.
+func SendEmailWithAttachments(subject string, receiver string, content string, attachments []EmailAttachment) error {
 	if SMTPFrom == "" { // for compatibility
 		SMTPFrom = SMTPAccount
 	}
@@ -31,13 +44,18 @@ func SendEmail(subject string, receiver string, content string) error {
 		return fmt.Errorf("SMTP 服务器未配置")
 	}
 	encodedSubject := fmt.Sprintf("=?UTF-8?B?%s?=", base64.StdEncoding.EncodeToString([]byte(subject)))
-	mail := []byte(fmt.Sprintf("To: %s\r\n"+
+	header := fmt.Sprintf("To: %s\r\n"+
 		"From: %s <%s>\r\n"+
 		"Subject: %s\r\n"+
 		"Date: %s\r\n"+
-		"Message-ID: %s\r\n"+ // 添加 Message-ID 头
-		"Content-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n",
-		receiver, SystemName, SMTPFrom, encodedSubject, time.Now().Format(time.RFC1123Z), id, content))
+		"Message-ID: %s\r\n", // 添加 Message-ID 头
+		receiver, SystemName, SMTPFrom, encodedSubject, time.Now().Format(time.RFC1123Z), id)
+	var mail []byte
+	if len(attachments) == 0 {
+		mail = []byte(header + fmt.Sprintf("Content-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n", content))
+	} else {
+		mail = buildMultipartEmail(header, content, attachments)
+	}
 	auth := smtp.PlainAuth("", SMTPAccount, SMTPToken, SMTPServer)
 	addr := fmt.Sprintf("%s:%d", SMTPServer, SMTPPort)
 	to := strings.Split(receiver, ";")
@@ -91,3 +109,35 @@ func SendEmail(subject string, receiver string, content string) error {
 	}
 	return err
 }
+
+// buildMultipartEmail builds a multipart/mixed message with the HTML content followed by the attachments.
+func buildMultipartEmail(header string, content string, attachments []EmailAttachment) []byte {
+	boundary := "----=_Part_" + GetRandomString(24)
+	var sb strings.Builder
+	sb.WriteString(header)
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n\r\n", boundary))
+	sb.WriteString(fmt.Sprintf("--%s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n", boundary, content))
+	for _, attachment := range attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		filename := mime.QEncoding.Encode("UTF-8", attachment.Filename)
+		sb.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		sb.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", contentType, filename))
+		sb.WriteString("Content-Transfer-Encoding: base64\r\n")
+		sb.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n\r\n", filename))
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		// base64 正文每行不超过 76 个字符
+		for len(encoded) > 76 {
+			sb.WriteString(encoded[:76])
+			sb.WriteString("\r\n")
+			encoded = encoded[76:]
+		}
+		sb.WriteString(encoded)
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+	return []byte(sb.String())
+}
@@ -28,8 +28,13 @@ func GetEndpointTypesByChannelType(channelType int, modelName string) []constant
 		endpointTypes = []constant.EndpointType{constant.EndpointTypeOpenAI}
 	case constant.ChannelTypeSora:
 		endpointTypes = []constant.EndpointType{constant.EndpointTypeOpenAIVideo}
+	case constant.ChannelTypeStability: // Stability 只提供图片接口
+		endpointTypes = []constant.EndpointType{constant.EndpointTypeImageGeneration}
+		return endpointTypes
 	default:
-		if IsOpenAIResponseOnlyModel(modelName) {
+		if pluginEndpointTypes, ok := pluginChannelEndpointTypes[channelType]; ok {
+			endpointTypes = append([]constant.EndpointType(nil), pluginEndpointTypes...)
+		} else if IsOpenAIResponseOnlyModel(modelName) {
 			endpointTypes = []constant.EndpointType{constant.EndpointTypeOpenAIResponse}
 		} else {
 			endpointTypes = []constant.EndpointType{constant.EndpointTypeOpenAI}
@@ -60,6 +60,10 @@ func GetRequestBody(c *gin.Context) ([]byte, error) {
 	maxBytes := int64(maxMB) << 20
 
 	contentLength := c.Request.ContentLength
+	// 内存预算不足时在读取请求体之前拒绝
+	if err := CheckRequestMemory(c, max(contentLength, 0)); err != nil {
+		return nil, err
+	}
 
 	// 使用新的存储系统
 	storage, err := CreateBodyStorageFromReader(c.Request.Body, contentLength, maxBytes)
@@ -72,14 +76,20 @@ func GetRequestBody(c *gin.Context) ([]byte, error) {
 		return nil, err
 	}
 
-	// 缓存存储对象
-	c.Set(KeyBodyStorage, storage)
-
 	// 获取字节数据
 	body, err := storage.Bytes()
 	if err != nil {
+		_ = storage.Close()
 		return nil, err
 	}
+	// 磁盘存储读出的字节同样缓存在内存中，一并记账
+	if err := ReserveRequestMemory(c, int64(len(body))); err != nil {
+		_ = storage.Close()
+		return nil, err
+	}
+
+	// 缓存存储对象
+	c.Set(KeyBodyStorage, storage)
 
 	// 同时设置旧的缓存键以保持兼容性
 	c.Set(KeyRequestBody, body)
@@ -127,6 +137,7 @@ func CleanupBodyStorage(c *gin.Context) {
 		}
 		c.Set(KeyBodyStorage, nil)
 	}
+	ReleaseRequestMemory(c)
 }
 
 func UnmarshalBodyReusable(c *gin.Context, v any) error {
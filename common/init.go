@@ -64,6 +64,11 @@ func InitEnv() {
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
+	SQLiteJournalMode = strings.ToUpper(GetEnvOrDefaultString("SQLITE_JOURNAL_MODE", SQLiteJournalMode))
+	SQLiteSynchronous = strings.ToUpper(GetEnvOrDefaultString("SQLITE_SYNCHRONOUS", SQLiteSynchronous))
+	SQLiteBusyTimeout = GetEnvOrDefault("SQLITE_BUSY_TIMEOUT", SQLiteBusyTimeout)
+	SQLiteCheckpointInterval = GetEnvOrDefault("SQLITE_CHECKPOINT_INTERVAL", SQLiteCheckpointInterval)
+	SQLiteCheckpointMode = strings.ToUpper(GetEnvOrDefaultString("SQLITE_CHECKPOINT_MODE", SQLiteCheckpointMode))
 	if *LogDir != "" {
 		var err error
 		*LogDir, err = filepath.Abs(*LogDir)
@@ -80,8 +85,11 @@ func InitEnv() {
 
 	// Initialize variables from constants.go that were using environment variables
 	DebugEnabled = os.Getenv("DEBUG") == "true"
+	LogFormatJSON = strings.EqualFold(os.Getenv("LOG_FORMAT"), "json")
 	MemoryCacheEnabled = os.Getenv("MEMORY_CACHE_ENABLED") == "true"
 	IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
+	NodeRegion = strings.TrimSpace(os.Getenv("NODE_REGION"))
+	OfflineMode = GetEnvOrDefaultBool("OFFLINE_MODE", false)
 	TLSInsecureSkipVerify = GetEnvOrDefaultBool("TLS_INSECURE_SKIP_VERIFY", false)
 	if TLSInsecureSkipVerify {
 		if tr, ok := http.DefaultTransport.(*http.Transport); ok && tr != nil {
@@ -103,6 +111,15 @@ func InitEnv() {
 	RelayTimeout = GetEnvOrDefault("RELAY_TIMEOUT", 0)
 	RelayMaxIdleConns = GetEnvOrDefault("RELAY_MAX_IDLE_CONNS", 500)
 	RelayMaxIdleConnsPerHost = GetEnvOrDefault("RELAY_MAX_IDLE_CONNS_PER_HOST", 100)
+	ImpersonationMaxMinutes = GetEnvOrDefault("IMPERSONATION_MAX_MINUTES", 30)
+	LogHashChainEnabled = GetEnvOrDefaultBool("LOG_HASH_CHAIN_ENABLED", false)
+	MetricsToken = GetEnvOrDefaultString("METRICS_TOKEN", "")
+	MetricsUserLabelsEnabled = GetEnvOrDefaultBool("METRICS_USER_LABELS_ENABLED", false)
+	MetricsGroupLabelsEnabled = GetEnvOrDefaultBool("METRICS_GROUP_LABELS_ENABLED", false)
+	MetricsModelLabelsEnabled = GetEnvOrDefaultBool("METRICS_MODEL_LABELS_ENABLED", false)
+	MetricsLabelTopN = GetEnvOrDefault("METRICS_LABEL_TOP_N", 50)
+	AccountDeletionCooldownHours = GetEnvOrDefault("ACCOUNT_DELETION_COOLDOWN_HOURS", 72)
+	MaxClientRequestTimeout = GetEnvOrDefault("MAX_CLIENT_REQUEST_TIMEOUT", 600)
 
 	// Initialize string variables with GetEnvOrDefaultString
 	GeminiSafetySetting = GetEnvOrDefaultString("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
@@ -130,6 +147,10 @@ func initConstantEnv() {
 	constant.StreamScannerMaxBufferMB = GetEnvOrDefault("STREAM_SCANNER_MAX_BUFFER_MB", 64)
 	// MaxRequestBodyMB 请求体最大大小（解压后），用于防止超大请求/zip bomb导致内存暴涨
 	constant.MaxRequestBodyMB = GetEnvOrDefault("MAX_REQUEST_BODY_MB", 128)
+	// RequestMemoryLimitMB 单个请求缓冲的请求体和日志载荷的内存上限，0 表示不限制
+	constant.RequestMemoryLimitMB = GetEnvOrDefault("REQUEST_MEMORY_LIMIT_MB", 0)
+	// RequestMemoryBudgetMB 所有在途请求缓冲内存的总预算，超出后新请求返回 503，0 表示不限制
+	constant.RequestMemoryBudgetMB = GetEnvOrDefault("REQUEST_MEMORY_BUDGET_MB", 0)
 	// ForceStreamOption 覆盖请求参数，强制返回usage信息
 	constant.ForceStreamOption = GetEnvOrDefaultBool("FORCE_STREAM_OPTION", true)
 	constant.CountToken = GetEnvOrDefaultBool("CountToken", true)
@@ -13,9 +13,13 @@ import (
 //go:embed lua/rate_limit.lua
 var rateLimitScript string
 
+//go:embed lua/strict_rate_limit.lua
+var strictRateLimitScript string
+
 type RedisLimiter struct {
-	client         *redis.Client
-	limitScriptSHA string
+	client          redis.UniversalClient
+	limitScriptSHA  string
+	strictScriptSHA string
 }
 
 var (
@@ -23,16 +27,21 @@ var (
 	once     sync.Once
 )
 
-func New(ctx context.Context, r *redis.Client) *RedisLimiter {
+func New(ctx context.Context, r redis.UniversalClient) *RedisLimiter {
 	once.Do(func() {
 		// 预加载脚本
 		limitSHA, err := r.ScriptLoad(ctx, rateLimitScript).Result()
 		if err != nil {
 			common.SysLog(fmt.Sprintf("Failed to load rate limit script: %v", err))
 		}
+		strictSHA, err := r.ScriptLoad(ctx, strictRateLimitScript).Result()
+		if err != nil {
+			common.SysLog(fmt.Sprintf("Failed to load strict rate limit script: %v", err))
+		}
 		instance = &RedisLimiter{
-			client:         r,
-			limitScriptSHA: limitSHA,
+			client:          r,
+			limitScriptSHA:  limitSHA,
+			strictScriptSHA: strictSHA,
 		}
 	})
 
@@ -40,6 +49,13 @@ func New(ctx context.Context, r *redis.Client) *RedisLimiter {
 }
 
 func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (bool, error) {
+	allowed, _, err := rl.AllowWithWait(ctx, key, opts...)
+	return allowed, err
+}
+
+// AllowWithWait works like Allow and also returns the seconds until enough tokens are refilled
+// when the request is rejected.
+func (rl *RedisLimiter) AllowWithWait(ctx context.Context, key string, opts ...Option) (bool, int64, error) {
 	// 默认配置
 	config := &Config{
 		Capacity:  10,
@@ -60,12 +76,50 @@ func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (
 		config.Requested,
 		config.Rate,
 		config.Capacity,
-	).Int()
+	).Int64Slice()
 
 	if err != nil {
-		return false, fmt.Errorf("rate limit failed: %w", err)
+		return false, 0, fmt.Errorf("rate limit failed: %w", err)
 	}
-	return result == 1, nil
+	if len(result) < 2 {
+		return false, 0, fmt.Errorf("rate limit failed: unexpected result %v", result)
+	}
+	return result[0] == 1, result[1], nil
+}
+
+// StrictLimitTotal、StrictLimitSuccess 严格模式拒绝请求时触发的限制
+const (
+	StrictLimitTotal   = 1
+	StrictLimitSuccess = 2
+)
+
+// ReserveStrict atomically checks the sliding windows of the total and the successful requests and records the
+// request in both when it is admitted, so instances sharing the keys never admit more than the limits together.
+// The keys must share a hash tag to be used in one script on Redis Cluster. A request that fails afterwards should
+// be released from successKey. When the request is rejected it returns the seconds until a slot frees up and
+// which limit was reached.
+func (rl *RedisLimiter) ReserveStrict(ctx context.Context, totalKey string, successKey string, member string, window int64, totalMax int, successMax int) (bool, int64, int, error) {
+	result, err := rl.client.EvalSha(
+		ctx,
+		rl.strictScriptSHA,
+		[]string{totalKey, successKey},
+		window,
+		totalMax,
+		successMax,
+		member,
+	).Int64Slice()
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("strict rate limit failed: %w", err)
+	}
+	if len(result) < 3 {
+		return false, 0, 0, fmt.Errorf("strict rate limit failed: unexpected result %v", result)
+	}
+	return result[0] == 1, result[1], int(result[2]), nil
+}
+
+// ReleaseStrict removes the reservation of a request from the window of key.
+func (rl *RedisLimiter) ReleaseStrict(ctx context.Context, key string, member string) error {
+	return rl.client.ZRem(ctx, key, member).Err()
 }
 
 // Config 配置选项模式
@@ -30,15 +30,18 @@ else
     last_time = nowInSeconds
 end
 
--- 判断是否允许请求
+-- 判断是否允许请求，拒绝时计算令牌补足所需的秒数
 local allowed = false
+local wait = 0
 if tokens >= requested then
     tokens = tokens - requested
     allowed = true
+else
+    wait = math.ceil((requested - tokens) / rate)
 end
 
 ---- 更新桶状态并设置过期时间
 redis.call('HMSET', key, 'tokens', tokens, 'last_time', last_time)
 --redis.call('EXPIRE', key, math.ceil(capacity / rate) + 60) -- 适当延长过期时间
 
-return allowed and 1 or 0
\ No newline at end of file
+return {allowed and 1 or 0, wait}
\ No newline at end of file
@@ -0,0 +1,49 @@
+-- 严格模式的滑动窗口限流器，在一个脚本中原子地检查并记录总请求数和成功请求数，多实例共享同一份计数
+-- KEYS[1]: 总请求数的有序集合
+-- KEYS[2]: 成功请求数的有序集合，包含处理中的请求，请求失败后由调用方移除
+-- ARGV[1]: 窗口长度（秒）
+-- ARGV[2]: 窗口内最多请求数，0 表示不限制
+-- ARGV[3]: 窗口内最多成功请求数，0 表示不限制
+-- ARGV[4]: 本次请求的唯一标识
+
+local total_key = KEYS[1]
+local success_key = KEYS[2]
+local window = tonumber(ARGV[1]) * 1000
+local total_max = tonumber(ARGV[2])
+local success_max = tonumber(ARGV[3])
+local member = ARGV[4]
+
+-- 使用 Redis 服务器时间，避免各实例时钟不一致
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', total_key, '-inf', now_ms - window)
+redis.call('ZREMRANGEBYSCORE', success_key, '-inf', now_ms - window)
+
+-- 拒绝时返回窗口内最早的请求过期还需等待的秒数，以及触发限制的计数（1 总请求数，2 成功请求数）
+local function reject(key, which)
+    local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+    local wait = 1
+    if oldest[2] then
+        wait = math.max(1, math.ceil((tonumber(oldest[2]) + window - now_ms) / 1000))
+    end
+    return {0, wait, which}
+end
+
+if total_max > 0 and redis.call('ZCARD', total_key) >= total_max then
+    return reject(total_key, 1)
+end
+if success_max > 0 and redis.call('ZCARD', success_key) >= success_max then
+    return reject(success_key, 2)
+end
+
+if total_max > 0 then
+    redis.call('ZADD', total_key, now_ms, member)
+    redis.call('PEXPIRE', total_key, window)
+end
+if success_max > 0 then
+    redis.call('ZADD', success_key, now_ms, member)
+    redis.call('PEXPIRE', success_key, window)
+end
+
+return {1, 0, 0}
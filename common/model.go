@@ -1,6 +1,9 @@
 package common
 
-import "strings"
+import (
+	"strconv"
+	"strings"
+)
 
 var (
 	// OpenAIResponseOnlyModels is a list of models that are only available for OpenAI responses.
@@ -57,3 +60,45 @@ func IsOpenAITextModel(modelName string) bool {
 	}
 	return false
 }
+
+// StripModelSnapshot removes the dated snapshot suffix of a model name so pricing and capabilities can fall back to
+// the base model, e.g. gpt-4o-2024-11-20, claude-3-5-sonnet-20241022, claude-3-5-sonnet@20240620, gpt-4-0613 and
+// gemini-2.5-flash-preview-05-20. ok is false when the name has no such suffix.
+func StripModelSnapshot(modelName string) (string, bool) {
+	n := len(modelName)
+	switch {
+	// -YYYY-MM-DD
+	case n > 11 && modelName[n-11] == '-' && modelName[n-6] == '-' && modelName[n-3] == '-' &&
+		isDigits(modelName[n-10:n-6]) && isMonthDay(modelName[n-5:n-3], modelName[n-2:]):
+		return modelName[:n-11], true
+	// -YYYYMMDD 或 @YYYYMMDD
+	case n > 9 && (modelName[n-9] == '-' || modelName[n-9] == '@') &&
+		isDigits(modelName[n-8:n-4]) && isMonthDay(modelName[n-4:n-2], modelName[n-2:]):
+		return modelName[:n-9], true
+	// -MM-DD
+	case n > 6 && modelName[n-6] == '-' && modelName[n-3] == '-' && isMonthDay(modelName[n-5:n-3], modelName[n-2:]):
+		return modelName[:n-6], true
+	// -MMDD
+	case n > 5 && modelName[n-5] == '-' && isMonthDay(modelName[n-4:n-2], modelName[n-2:]):
+		return modelName[:n-5], true
+	}
+	return modelName, false
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isMonthDay(month string, day string) bool {
+	if !isDigits(month) || !isDigits(day) {
+		return false
+	}
+	m, _ := strconv.Atoi(month)
+	d, _ := strconv.Atoi(day)
+	return m >= 1 && m <= 12 && d >= 1 && d <= 31
+}
@@ -0,0 +1,25 @@
+package common
+
+import "testing"
+
+func TestStripModelSnapshot(t *testing.T) {
+	cases := map[string]string{
+		"gpt-4o-2024-11-20":              "gpt-4o",
+		"claude-3-5-sonnet-20241022":     "claude-3-5-sonnet",
+		"claude-3-5-sonnet@20240620":     "claude-3-5-sonnet",
+		"gpt-4-0613":                     "gpt-4",
+		"gpt-3.5-turbo-0125":             "gpt-3.5-turbo",
+		"gemini-2.5-flash-preview-05-20": "gemini-2.5-flash-preview",
+	}
+	for name, want := range cases {
+		got, ok := StripModelSnapshot(name)
+		if !ok || got != want {
+			t.Fatalf("StripModelSnapshot(%q) = %q, %v, want %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"gpt-4o", "gpt-3.5-turbo-16k", "deepseek-v3", "qwen-max-1399", "glm-4-9b", "-0613"} {
+		if got, ok := StripModelSnapshot(name); ok {
+			t.Fatalf("StripModelSnapshot(%q) = %q, want no snapshot", name, got)
+		}
+	}
+}
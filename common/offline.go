@@ -0,0 +1,12 @@
+package common
+
+import "fmt"
+
+// CheckOutboundAllowed returns an error when the deployment is offline, purpose names the outbound call
+// in the error message.
+func CheckOutboundAllowed(purpose string) error {
+	if OfflineMode {
+		return fmt.Errorf("%s is disabled in offline mode", purpose)
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package common
 
 import (
 	"fmt"
+	"math/rand/v2"
+	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -12,10 +15,97 @@ import (
 )
 
 const (
-	maxLogPayloadRunes = 2048
-	truncatedSuffixFmt = "… [truncated %d chars]"
+	defaultLogPayloadRunes = 2048
+	truncatedSuffixFmt     = "… [truncated %d chars]"
 )
 
+// LogPayloadMaxRunes 日志中保留的请求/响应内容的最大字符数（包括日志详情），0 表示不截断
+var LogPayloadMaxRunes = defaultLogPayloadRunes
+
+// LogPayloadStorageEnabled 日志详情的完整内容压缩后写入对象存储，数据库中只保留截断后的预览和对象键
+var LogPayloadStorageEnabled = false
+
+// LogPayloadSuccessSampleRate 成功请求保存日志详情的百分比（0-100）
+var LogPayloadSuccessSampleRate = 100
+
+// LogPayloadErrorSampleRate 失败请求保存日志详情的百分比（0-100）
+var LogPayloadErrorSampleRate = 100
+
+var (
+	// logPayloadRouteLimits 路由前缀 -> 最大字符数，优先于全局设置，最长前缀优先
+	logPayloadRouteLimits      = map[string]int{}
+	logPayloadRouteLimitsMutex sync.RWMutex
+)
+
+func LogPayloadRouteLimits2JSONString() string {
+	logPayloadRouteLimitsMutex.RLock()
+	defer logPayloadRouteLimitsMutex.RUnlock()
+	jsonBytes, err := Marshal(logPayloadRouteLimits)
+	if err != nil {
+		SysError("error marshalling log payload route limits: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateLogPayloadRouteLimitsByJSONString(jsonStr string) error {
+	tmp := make(map[string]int)
+	if jsonStr != "" {
+		if err := Unmarshal([]byte(jsonStr), &tmp); err != nil {
+			return err
+		}
+	}
+	for route, limit := range tmp {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("route %q must start with /", route)
+		}
+		if limit < 0 {
+			return fmt.Errorf("limit of route %s must not be negative", route)
+		}
+	}
+	logPayloadRouteLimitsMutex.Lock()
+	logPayloadRouteLimits = tmp
+	logPayloadRouteLimitsMutex.Unlock()
+	return nil
+}
+
+func routeLogPayloadLimit(path string) (int, bool) {
+	logPayloadRouteLimitsMutex.RLock()
+	defer logPayloadRouteLimitsMutex.RUnlock()
+	matched := ""
+	limit := 0
+	for route, routeLimit := range logPayloadRouteLimits {
+		if strings.HasPrefix(path, route) && len(route) > len(matched) {
+			matched = route
+			limit = routeLimit
+		}
+	}
+	return limit, matched != ""
+}
+
+// LogPayloadLimit returns the rune limit of logged payloads for the request,
+// the channel setting takes precedence over the route overrides and the global limit. 0 means no truncation.
+func LogPayloadLimit(c *gin.Context) int {
+	if c == nil {
+		return LogPayloadMaxRunes
+	}
+	if value, ok := c.Get(string(constant.ContextKeyChannelLogPayloadMaxRunes)); ok {
+		if limit, ok := value.(*int); ok && limit != nil {
+			return max(*limit, 0)
+		}
+	}
+	if c.Request != nil {
+		if limit, ok := routeLogPayloadLimit(c.Request.URL.Path); ok {
+			return limit
+		}
+	}
+	return LogPayloadMaxRunes
+}
+
+// ApplyLogPayloadLimit truncates value to the payload limit of the request.
+func ApplyLogPayloadLimit(c *gin.Context, value string) string {
+	return applyLogLimit(value, LogPayloadLimit(c))
+}
+
 func fullPayloadKeyFor(previewKey constant.ContextKey) (constant.ContextKey, bool) {
 	switch previewKey {
 	case constant.ContextKeyLoggedRequestBody:
@@ -39,6 +129,9 @@ func setFullPayload(c *gin.Context, previewKey constant.ContextKey, segments []s
 		c.Set(string(fullKey), []string{})
 		return
 	}
+	if !reservePayloadMemory(c, segments...) {
+		return
+	}
 	// Ensure we don't retain caller slices.
 	copySegments := append([]string(nil), segments...)
 	c.Set(string(fullKey), copySegments)
@@ -49,7 +142,7 @@ func appendFullPayloadSegment(c *gin.Context, previewKey constant.ContextKey, se
 		return
 	}
 	fullKey, ok := fullPayloadKeyFor(previewKey)
-	if !ok {
+	if !ok || !reservePayloadMemory(c, segment) {
 		return
 	}
 	if existing, exists := c.Get(string(fullKey)); exists {
@@ -66,6 +159,16 @@ func appendFullPayloadSegment(c *gin.Context, previewKey constant.ContextKey, se
 	c.Set(string(fullKey), []string{segment})
 }
 
+// reservePayloadMemory charges the captured segments to the request memory, the full payload is no longer
+// retained once the request runs out of memory, the truncated preview is still logged.
+func reservePayloadMemory(c *gin.Context, segments ...string) bool {
+	var size int64
+	for _, segment := range segments {
+		size += int64(len(segment))
+	}
+	return ReserveRequestMemory(c, size) == nil
+}
+
 // GetFullPayloadString joins the accumulated segments stored under the provided key.
 // It returns an empty string when no data has been captured.
 func GetFullPayloadString(c *gin.Context, key constant.ContextKey) string {
@@ -88,6 +191,27 @@ func GetFullPayloadString(c *gin.Context, key constant.ContextKey) string {
 	}
 }
 
+var (
+	inlineImageJSONPattern    = regexp.MustCompile(`("b64_json"\s*:\s*")([A-Za-z0-9+/=]{256,})"`)
+	inlineImageDataURIPattern = regexp.MustCompile(`(data:image/[a-zA-Z0-9.+-]+;base64,)([A-Za-z0-9+/=]{256,})`)
+)
+
+// omitInlineImages replaces base64 encoded images in JSON payloads, such as b64_json in image responses and
+// data URIs in requests, with their size so log details keep the text without the image content.
+func omitInlineImages(value string) string {
+	if !strings.Contains(value, "b64_json") && !strings.Contains(value, ";base64,") {
+		return value
+	}
+	value = inlineImageJSONPattern.ReplaceAllStringFunc(value, func(match string) string {
+		parts := inlineImageJSONPattern.FindStringSubmatch(match)
+		return fmt.Sprintf(`%s[image omitted: %d bytes]"`, parts[1], len(parts[2])*3/4)
+	})
+	return inlineImageDataURIPattern.ReplaceAllStringFunc(value, func(match string) string {
+		parts := inlineImageDataURIPattern.FindStringSubmatch(match)
+		return fmt.Sprintf("%s[image omitted: %d bytes]", parts[1], len(parts[2])*3/4)
+	})
+}
+
 func isBinaryPayload(data []byte) bool {
 	if len(data) == 0 {
 		return false
@@ -118,23 +242,25 @@ func truncatedSuffix(overflow int) string {
 	return fmt.Sprintf(truncatedSuffixFmt, overflow)
 }
 
-func applyLogLimit(value string) string {
+func applyLogLimit(value string, limit int) string {
+	if limit <= 0 || len(value) <= limit {
+		return value
+	}
 	runes := []rune(value)
-	if len(runes) <= maxLogPayloadRunes {
+	if len(runes) <= limit {
 		return value
 	}
-	trimmed := string(runes[:maxLogPayloadRunes])
-	return trimmed + truncatedSuffix(len(runes)-maxLogPayloadRunes)
+	trimmed := string(runes[:limit])
+	return trimmed + truncatedSuffix(len(runes)-limit)
 }
 
-func formatPayloadForLog(data []byte) string {
-	if len(data) == 0 {
-		return ""
-	}
-	if isBinaryPayload(data) {
-		return fmt.Sprintf("[binary payload omitted: %d bytes]", len(data))
+// redactPayloadForLog applies the redaction rules and marks the request so the log detail shows the payload was redacted.
+func redactPayloadForLog(c *gin.Context, value string) string {
+	value, redacted := RedactPayload(value)
+	if redacted && c != nil {
+		c.Set(string(constant.ContextKeyLoggedPayloadRedacted), true)
 	}
-	return applyLogLimit(string(data))
+	return value
 }
 
 func setPayloadIfEmpty(c *gin.Context, key constant.ContextKey, value string) {
@@ -147,24 +273,91 @@ func setPayloadIfEmpty(c *gin.Context, key constant.ContextKey, value string) {
 	c.Set(string(key), value)
 }
 
+// payloadSampleRoll returns the sampling value of the request in [0, 100), drawn once so the request and
+// response payloads are kept or dropped together.
+func payloadSampleRoll(c *gin.Context) int {
+	if c == nil {
+		return 0
+	}
+	if value, ok := c.Get(string(constant.ContextKeyLoggedPayloadSampleRoll)); ok {
+		if roll, ok := value.(int); ok {
+			return roll
+		}
+	}
+	roll := rand.IntN(100)
+	c.Set(string(constant.ContextKeyLoggedPayloadSampleRoll), roll)
+	return roll
+}
+
+// shouldCapturePayload reports whether the payloads of the request may be kept by either sample rate,
+// the outcome of the request is not known yet while capturing.
+func shouldCapturePayload(c *gin.Context) bool {
+	rate := max(LogPayloadSuccessSampleRate, LogPayloadErrorSampleRate)
+	if rate >= 100 {
+		return true
+	}
+	return payloadSampleRoll(c) < rate
+}
+
+// PayloadSampled reports whether the payloads of the request are kept in the log detail,
+// failed selects the error sample rate instead of the success one.
+func PayloadSampled(c *gin.Context, failed bool) bool {
+	rate := LogPayloadSuccessSampleRate
+	if failed {
+		rate = LogPayloadErrorSampleRate
+	}
+	if rate >= 100 {
+		return true
+	}
+	return payloadSampleRoll(c) < rate
+}
+
 // CapturePayloadForLog stores a truncated preview of the given byte slice under the provided context key.
 // It only sets the payload if one has not already been captured.
 func CapturePayloadForLog(c *gin.Context, key constant.ContextKey, data []byte) string {
-	preview := formatPayloadForLog(data)
-	setPayloadIfEmpty(c, key, preview)
-	if len(data) > 0 && !isBinaryPayload(data) {
-		setFullPayload(c, key, []string{string(data)})
+	if len(data) == 0 || !shouldCapturePayload(c) {
+		return ""
+	}
+	// 上游返回的压缩载荷解压后记录，便于在日志详情中查看
+	if isBinaryPayload(data) {
+		if decoded, ok := DecodePayload(data, ""); ok && !isBinaryPayload(decoded) {
+			data = decoded
+		}
+	}
+	if isBinaryPayload(data) {
+		preview := fmt.Sprintf("[binary payload omitted: %d bytes]", len(data))
+		setPayloadIfEmpty(c, key, preview)
+		return preview
 	}
+	value := redactPayloadForLog(c, omitInlineImages(string(data)))
+	preview := ApplyLogPayloadLimit(c, value)
+	setPayloadIfEmpty(c, key, preview)
+	setFullPayload(c, key, []string{value})
 	return preview
 }
 
+// CaptureEncodedPayloadForLog works like CapturePayloadForLog for a body sent with the given Content-Encoding,
+// the decoded body is logged so compressed responses remain readable.
+func CaptureEncodedPayloadForLog(c *gin.Context, key constant.ContextKey, data []byte, encoding string) string {
+	if len(data) == 0 || !shouldCapturePayload(c) {
+		return ""
+	}
+	if encoding != "" {
+		if decoded, ok := DecodePayload(data, encoding); ok {
+			data = decoded
+		}
+	}
+	return CapturePayloadForLog(c, key, data)
+}
+
 // CapturePayloadStringForLog stores a string payload after applying the global truncation rules.
 // It only writes when the key is not already populated.
 func CapturePayloadStringForLog(c *gin.Context, key constant.ContextKey, value string) string {
-	if value == "" {
+	if value == "" || !shouldCapturePayload(c) {
 		return ""
 	}
-	preview := applyLogLimit(value)
+	value = redactPayloadForLog(c, omitInlineImages(value))
+	preview := ApplyLogPayloadLimit(c, value)
 	setPayloadIfEmpty(c, key, preview)
 	setFullPayload(c, key, []string{value})
 	return preview
@@ -173,12 +366,14 @@ func CapturePayloadStringForLog(c *gin.Context, key constant.ContextKey, value s
 // AppendPayloadChunkForLog appends streaming chunks while respecting the global truncation limit.
 func AppendPayloadChunkForLog(c *gin.Context, key constant.ContextKey, chunk string) {
 	chunk = strings.TrimSpace(chunk)
-	if chunk == "" || chunk == "[DONE]" {
+	if chunk == "" || chunk == "[DONE]" || !shouldCapturePayload(c) {
 		return
 	}
+	chunk = redactPayloadForLog(c, omitInlineImages(chunk))
+	limit := LogPayloadLimit(c)
 	existing := c.GetString(string(key))
 	if existing == "" {
-		c.Set(string(key), applyLogLimit(chunk))
+		c.Set(string(key), applyLogLimit(chunk, limit))
 		appendFullPayloadSegment(c, key, chunk)
 		return
 	}
@@ -189,20 +384,20 @@ func AppendPayloadChunkForLog(c *gin.Context, key constant.ContextKey, chunk str
 	existingRunes := []rune(existing)
 	chunkRunes := []rune(chunk)
 	total := len(existingRunes) + len(chunkRunes)
-	if total <= maxLogPayloadRunes {
+	if limit <= 0 || total <= limit {
 		c.Set(string(key), existing+chunk)
 		appendFullPayloadSegment(c, key, chunk)
 		return
 	}
-	remaining := maxLogPayloadRunes - len(existingRunes)
+	remaining := limit - len(existingRunes)
 	if remaining <= 0 {
 		suffix := truncatedSuffix(len(chunkRunes))
-		c.Set(string(key), string(existingRunes[:maxLogPayloadRunes])+suffix)
+		c.Set(string(key), string(existingRunes[:limit])+suffix)
 		appendFullPayloadSegment(c, key, chunk)
 		return
 	}
 	trimmedChunk := string(chunkRunes[:remaining])
-	overflow := total - maxLogPayloadRunes
+	overflow := total - limit
 	c.Set(string(key), existing+trimmedChunk+truncatedSuffix(overflow))
 	appendFullPayloadSegment(c, key, chunk)
 }
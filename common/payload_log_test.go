@@ -0,0 +1,54 @@
+package common
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogPayloadLimitOverrides(t *testing.T) {
+	oldLimit := LogPayloadMaxRunes
+	defer func() {
+		LogPayloadMaxRunes = oldLimit
+		_ = UpdateLogPayloadRouteLimitsByJSONString("")
+	}()
+	LogPayloadMaxRunes = 10
+	require.NoError(t, UpdateLogPayloadRouteLimitsByJSONString(`{"/v1/": 5, "/v1/embeddings": 0}`))
+	require.Error(t, UpdateLogPayloadRouteLimitsByJSONString(`{"v1": 5}`))
+
+	newContext := func(path string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", path, nil)
+		return c
+	}
+
+	require.Equal(t, 10, LogPayloadLimit(newContext("/api/status")))
+	require.Equal(t, 5, LogPayloadLimit(newContext("/v1/chat/completions")))
+	require.Equal(t, 0, LogPayloadLimit(newContext("/v1/embeddings")))
+
+	c := newContext("/v1/chat/completions")
+	channelLimit := 3
+	c.Set(string(constant.ContextKeyChannelLogPayloadMaxRunes), &channelLimit)
+	require.Equal(t, 3, LogPayloadLimit(c))
+	require.Equal(t, "你好世… [truncated 2 chars]", ApplyLogPayloadLimit(c, "你好世界！"))
+
+	c.Set(string(constant.ContextKeyChannelLogPayloadMaxRunes), (*int)(nil))
+	require.Equal(t, 5, LogPayloadLimit(c))
+}
+
+func TestOmitInlineImages(t *testing.T) {
+	image := strings.Repeat("QUJD", 100)
+	response := `{"created":1,"data":[{"b64_json":"` + image + `","revised_prompt":"a cat"}]}`
+	require.Equal(t, `{"created":1,"data":[{"b64_json":"[image omitted: 300 bytes]","revised_prompt":"a cat"}]}`, omitInlineImages(response))
+
+	request := `{"image":"data:image/png;base64,` + image + `"}`
+	require.Equal(t, `{"image":"data:image/png;base64,[image omitted: 300 bytes]"}`, omitInlineImages(request))
+
+	short := `{"b64_json":"QUJD"}`
+	require.Equal(t, short, omitInlineImages(short))
+}
@@ -0,0 +1,231 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 日志内容脱敏：请求/响应内容写入上下文之前按规则替换敏感信息，截断后的预览和完整内容都只保存脱敏后的结果。
+
+const (
+	RedactionRuleRegex = "regex"
+	RedactionRuleKey   = "key"
+
+	redactedPlaceholder = "[REDACTED]"
+)
+
+type RedactionRule struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // regex 或 key
+	// Pattern regex 规则为正则表达式；key 规则为 JSON 键名（匹配任意层级）或以 . 分隔的路径，路径中的 * 匹配任意键或数组下标
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement,omitempty"` // 为空时替换为 [REDACTED]
+	Enabled     bool   `json:"enabled"`
+}
+
+type compiledRedactionRule struct {
+	replacement string
+	regex       *regexp.Regexp
+	path        []string
+}
+
+// LogRedactionEnabled 是否在记录日志内容前脱敏
+var LogRedactionEnabled = false
+
+var defaultRedactionRules = []RedactionRule{
+	{Name: "api_key", Type: RedactionRuleKey, Pattern: "api_key", Enabled: true},
+	{Name: "password", Type: RedactionRuleKey, Pattern: "password", Enabled: true},
+	{Name: "email", Type: RedactionRuleRegex, Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, Enabled: true},
+	{Name: "credit_card", Type: RedactionRuleRegex, Pattern: `\b(?:\d{4}[ -]){3}\d{4}\b`, Enabled: true},
+	{Name: "base64_image", Type: RedactionRuleRegex, Pattern: `data:image/[A-Za-z0-9.+-]+;base64,[A-Za-z0-9+/=]+`, Replacement: "data:image/*;base64," + redactedPlaceholder, Enabled: true},
+}
+
+var (
+	redactionRules         = defaultRedactionRules
+	compiledRedactionRules []compiledRedactionRule
+	redactionRulesMutex    sync.RWMutex
+)
+
+func init() {
+	compiled, err := compileRedactionRules(defaultRedactionRules)
+	if err != nil {
+		panic(err)
+	}
+	compiledRedactionRules = compiled
+}
+
+func compileRedactionRules(rules []RedactionRule) ([]compiledRedactionRule, error) {
+	compiled := make([]compiledRedactionRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("pattern of rule %q is empty", rule.Name)
+		}
+		item := compiledRedactionRule{replacement: rule.Replacement}
+		if item.replacement == "" {
+			item.replacement = redactedPlaceholder
+		}
+		switch rule.Type {
+		case RedactionRuleRegex:
+			regex, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern of rule %q: %w", rule.Name, err)
+			}
+			item.regex = regex
+		case RedactionRuleKey:
+			item.path = strings.Split(rule.Pattern, ".")
+		default:
+			return nil, fmt.Errorf("unknown type of rule %q: %s", rule.Name, rule.Type)
+		}
+		if rule.Enabled {
+			compiled = append(compiled, item)
+		}
+	}
+	return compiled, nil
+}
+
+func LogRedactionRules2JSONString() string {
+	redactionRulesMutex.RLock()
+	defer redactionRulesMutex.RUnlock()
+	jsonBytes, err := Marshal(redactionRules)
+	if err != nil {
+		SysError("error marshalling log redaction rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// GetLogRedactionRules returns a copy of the saved rules, including disabled ones.
+func GetLogRedactionRules() []RedactionRule {
+	redactionRulesMutex.RLock()
+	defer redactionRulesMutex.RUnlock()
+	return append([]RedactionRule(nil), redactionRules...)
+}
+
+func UpdateLogRedactionRulesByJSONString(jsonStr string) error {
+	rules := make([]RedactionRule, 0)
+	if jsonStr != "" {
+		if err := Unmarshal([]byte(jsonStr), &rules); err != nil {
+			return err
+		}
+	}
+	compiled, err := compileRedactionRules(rules)
+	if err != nil {
+		return err
+	}
+	redactionRulesMutex.Lock()
+	redactionRules = rules
+	compiledRedactionRules = compiled
+	redactionRulesMutex.Unlock()
+	return nil
+}
+
+// RedactPayload applies the enabled redaction rules to value and reports whether anything was replaced.
+func RedactPayload(value string) (string, bool) {
+	if !LogRedactionEnabled || value == "" {
+		return value, false
+	}
+	redactionRulesMutex.RLock()
+	rules := compiledRedactionRules
+	redactionRulesMutex.RUnlock()
+	return redactWithRules(value, rules)
+}
+
+// RedactPayloadWithRules applies the given rules regardless of the global switch, used to preview rules before saving them.
+func RedactPayloadWithRules(value string, rules []RedactionRule) (string, bool, error) {
+	compiled, err := compileRedactionRules(rules)
+	if err != nil {
+		return "", false, err
+	}
+	result, redacted := redactWithRules(value, compiled)
+	return result, redacted, nil
+}
+
+func redactWithRules(value string, rules []compiledRedactionRule) (string, bool) {
+	redacted := false
+	var keyRules []compiledRedactionRule
+	for _, rule := range rules {
+		if rule.path != nil {
+			keyRules = append(keyRules, rule)
+		}
+	}
+	if len(keyRules) > 0 && gjson.Valid(value) {
+		var matches []redactionMatch
+		collectRedactionMatches(gjson.Parse(value), nil, keyRules, &matches)
+		for _, match := range matches {
+			if result, err := sjson.Set(value, match.path, match.replacement); err == nil {
+				value = result
+				redacted = true
+			}
+		}
+	}
+	for _, rule := range rules {
+		if rule.regex == nil || !rule.regex.MatchString(value) {
+			continue
+		}
+		value = rule.regex.ReplaceAllLiteralString(value, rule.replacement)
+		redacted = true
+	}
+	return value, redacted
+}
+
+type redactionMatch struct {
+	path        string
+	replacement string
+}
+
+func collectRedactionMatches(node gjson.Result, path []string, rules []compiledRedactionRule, matches *[]redactionMatch) {
+	visit := func(segment string, child gjson.Result) {
+		childPath := append(path[:len(path):len(path)], segment)
+		for _, rule := range rules {
+			if matchRedactionPath(rule.path, childPath) {
+				*matches = append(*matches, redactionMatch{path: joinSJSONPath(childPath), replacement: rule.replacement})
+				return
+			}
+		}
+		collectRedactionMatches(child, childPath, rules, matches)
+	}
+	if node.IsObject() {
+		node.ForEach(func(key, child gjson.Result) bool {
+			visit(key.String(), child)
+			return true
+		})
+	} else if node.IsArray() {
+		index := 0
+		node.ForEach(func(_, child gjson.Result) bool {
+			visit(strconv.Itoa(index), child)
+			index++
+			return true
+		})
+	}
+}
+
+// matchRedactionPath 单个键名匹配任意层级的同名键，多段路径需要从根开始完整匹配
+func matchRedactionPath(rulePath []string, path []string) bool {
+	if len(rulePath) == 1 {
+		return strings.EqualFold(rulePath[0], path[len(path)-1])
+	}
+	if len(rulePath) != len(path) {
+		return false
+	}
+	for i, segment := range rulePath {
+		if segment != "*" && !strings.EqualFold(segment, path[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+var sjsonPathEscaper = strings.NewReplacer(`\`, `\\`, ".", `\.`, "*", `\*`, "?", `\?`, "|", `\|`, "#", `\#`, "@", `\@`, ":", `\:`)
+
+func joinSJSONPath(path []string) string {
+	escaped := make([]string, len(path))
+	for i, segment := range path {
+		escaped[i] = sjsonPathEscaper.Replace(segment)
+	}
+	return strings.Join(escaped, ".")
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactPayloadWithRules(t *testing.T) {
+	rules := []RedactionRule{
+		{Name: "api_key", Type: RedactionRuleKey, Pattern: "api_key", Enabled: true},
+		{Name: "content", Type: RedactionRuleKey, Pattern: "messages.*.content", Enabled: true},
+		{Name: "email", Type: RedactionRuleRegex, Pattern: `[a-z]+@example\.com`, Replacement: "<email>", Enabled: true},
+		{Name: "disabled", Type: RedactionRuleRegex, Pattern: "model", Enabled: false},
+	}
+
+	result, redacted, err := RedactPayloadWithRules(
+		`{"model":"gpt","api_key":"sk-1","extra":{"API_KEY":{"a":1}},"messages":[{"role":"user","content":"hi"}],"user":"bob@example.com"}`, rules)
+	require.NoError(t, err)
+	require.True(t, redacted)
+	require.Equal(t,
+		`{"model":"gpt","api_key":"[REDACTED]","extra":{"API_KEY":"[REDACTED]"},"messages":[{"role":"user","content":"[REDACTED]"}],"user":"<email>"}`, result)
+
+	result, redacted, err = RedactPayloadWithRules("plain text", rules)
+	require.NoError(t, err)
+	require.False(t, redacted)
+	require.Equal(t, "plain text", result)
+
+	_, _, err = RedactPayloadWithRules("", []RedactionRule{{Name: "bad", Type: RedactionRuleRegex, Pattern: "("}})
+	require.Error(t, err)
+}
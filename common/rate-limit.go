@@ -68,3 +68,18 @@ func (l *InMemoryRateLimiter) Request(key string, maxRequestNum int, duration in
 	}
 	return true
 }
+
+// RetryAfter returns the seconds until the key accepts a new request, 0 when it accepts one now.
+func (l *InMemoryRateLimiter) RetryAfter(key string, maxRequestNum int, duration int64) int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	queue, ok := l.store[key]
+	if !ok || len(*queue) < maxRequestNum || len(*queue) == 0 {
+		return 0
+	}
+	wait := (*queue)[0] + duration - time.Now().Unix()
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
@@ -7,13 +7,15 @@ import (
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
-var RDB *redis.Client
+// RDB 单节点、Cluster 或 Sentinel 模式下的 Redis 客户端
+var RDB redis.UniversalClient
 var RedisEnabled = true
 
 func RedisKeyCacheSeconds() int {
@@ -22,7 +24,7 @@ func RedisKeyCacheSeconds() int {
 
 // InitRedisClient This function is called after init()
 func InitRedisClient() (err error) {
-	if os.Getenv("REDIS_CONN_STRING") == "" {
+	if !redisConfigured() {
 		RedisEnabled = false
 		SysLog("REDIS_CONN_STRING not set, Redis is not enabled")
 		return nil
@@ -32,35 +34,36 @@ func InitRedisClient() (err error) {
 		SyncFrequency = 60
 	}
 	SysLog("Redis is enabled")
-	opt, err := redis.ParseURL(os.Getenv("REDIS_CONN_STRING"))
+	mode, opt, err := buildRedisOptions()
 	if err != nil {
-		FatalLog("failed to parse Redis connection string: " + err.Error())
+		FatalLog(err.Error())
 	}
-	opt.PoolSize = GetEnvOrDefault("REDIS_POOL_SIZE", 10)
-	RDB = redis.NewClient(opt)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	_, err = RDB.Ping(ctx).Result()
-	if err != nil {
-		FatalLog("Redis ping test failed: " + err.Error())
+	RDB = newRedisClient(mode, opt)
+
+	// 启动时 Redis 可能尚未就绪（例如主从切换中），按退避重试几次再退出
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = RDB.Ping(ctx).Result()
+		cancel()
+		if err == nil {
+			break
+		}
+		if attempt >= 5 {
+			FatalLog("Redis ping test failed: " + err.Error())
+		}
+		SysError(fmt.Sprintf("Redis ping test failed: %s, retrying in %s", err.Error(), backoff))
+		time.Sleep(backoff)
+		backoff *= 2
 	}
+	SysLog(fmt.Sprintf("Redis connected in %s mode", mode))
 	if DebugEnabled {
-		SysLog(fmt.Sprintf("Redis connected to %s", opt.Addr))
+		SysLog(fmt.Sprintf("Redis addresses: %s", strings.Join(opt.Addrs, ",")))
 		SysLog(fmt.Sprintf("Redis database: %d", opt.DB))
 	}
 	return err
 }
 
-func ParseRedisOption() *redis.Options {
-	opt, err := redis.ParseURL(os.Getenv("REDIS_CONN_STRING"))
-	if err != nil {
-		FatalLog("failed to parse Redis connection string: " + err.Error())
-	}
-	return opt
-}
-
 func RedisSet(key string, value string, expiration time.Duration) error {
 	if DebugEnabled {
 		SysLog(fmt.Sprintf("Redis SET: key=%s, value=%s, expiration=%v", key, value, expiration))
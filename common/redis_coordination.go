@@ -0,0 +1,125 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 多节点协调：各节点把渠道、选项等内存状态的变更发布到 Redis 频道，其他节点收到后刷新本地缓存，
+// 不必等待 SYNC_FREQUENCY 的定时同步。未启用 Redis 时只有一个节点，发布和订阅都不做任何事。
+
+const coordinationChannel = "new-api:coordination"
+
+const (
+	CoordinationEventOptionChanged  = "option_changed"
+	CoordinationEventChannelStatus  = "channel_status"
+	CoordinationEventChannelsChange = "channels_changed"
+	CoordinationEventChannelCooling = "channel_cooldown"
+)
+
+type coordinationMessage struct {
+	Node    string `json:"node"`
+	Event   string `json:"event"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+var (
+	// coordinationNodeId 用于忽略本节点发布的消息
+	coordinationNodeId  = GetUUID()
+	coordinationOnce    sync.Once
+	coordinationStarted atomic.Bool
+	coordinationLock    sync.RWMutex
+	coordinationHandler = make(map[string]func(payload []byte))
+)
+
+// RegisterCoordinationHandler registers the function applying the event published by another node, it must be
+// called before StartCoordinationSubscriber.
+func RegisterCoordinationHandler(event string, handler func(payload []byte)) {
+	coordinationLock.Lock()
+	defer coordinationLock.Unlock()
+	coordinationHandler[event] = handler
+}
+
+// PublishCoordinationEvent tells the other nodes about a change of the local state. The payload is marshaled to
+// JSON; errors are only logged since the periodic sync still converges the nodes.
+func PublishCoordinationEvent(event string, payload any) {
+	if !RedisEnabled || RDB == nil || !coordinationStarted.Load() {
+		return
+	}
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = Marshal(payload); err != nil {
+			SysError("failed to marshal coordination event " + event + ": " + err.Error())
+			return
+		}
+	}
+	message, err := Marshal(coordinationMessage{Node: coordinationNodeId, Event: event, Payload: data})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := RDB.Publish(ctx, coordinationChannel, message).Err(); err != nil {
+		SysError("failed to publish coordination event " + event + ": " + err.Error())
+	}
+}
+
+// StartCoordinationSubscriber subscribes to the events of the other nodes, resubscribing with an exponential
+// backoff after the connection to Redis is lost, e.g. during a failover.
+func StartCoordinationSubscriber() {
+	if !RedisEnabled || RDB == nil {
+		return
+	}
+	coordinationOnce.Do(func() {
+		coordinationStarted.Store(true)
+		go func() {
+			backoff := time.Second
+			for {
+				if subscribeCoordination() {
+					backoff = time.Second
+				}
+				time.Sleep(backoff)
+				backoff = min(backoff*2, 30*time.Second)
+			}
+		}()
+		SysLog("multi-node coordination via Redis started")
+	})
+}
+
+// subscribeCoordination handles the events until the subscription is closed, it returns false when the
+// subscription could not be established.
+func subscribeCoordination() bool {
+	ctx := context.Background()
+	pubsub := RDB.Subscribe(ctx, coordinationChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		SysError("failed to subscribe coordination channel: " + err.Error())
+		return false
+	}
+	for msg := range pubsub.Channel() {
+		var message coordinationMessage
+		if err := UnmarshalJsonStr(msg.Payload, &message); err != nil || message.Node == coordinationNodeId {
+			continue
+		}
+		coordinationLock.RLock()
+		handler := coordinationHandler[message.Event]
+		coordinationLock.RUnlock()
+		if handler != nil {
+			handleCoordinationEvent(message.Event, handler, message.Payload)
+		}
+	}
+	SysLog("coordination subscription closed, resubscribing")
+	return true
+}
+
+func handleCoordinationEvent(event string, handler func(payload []byte), payload []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			SysError("coordination event " + event + " handler panic: " + Interface2String(r))
+		}
+	}()
+	handler(payload)
+}
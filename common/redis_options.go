@@ -0,0 +1,120 @@
+package common
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeCluster    = "cluster"
+	RedisModeSentinel   = "sentinel"
+)
+
+// redisConfigured reports whether any Redis connection setting is present.
+func redisConfigured() bool {
+	return os.Getenv("REDIS_CONN_STRING") != "" || os.Getenv("REDIS_ADDRS") != ""
+}
+
+// buildRedisOptions builds the client options of the configured topology.
+//
+// REDIS_CONN_STRING configures a single node (redis:// or rediss:// for TLS). For Cluster and Sentinel set
+// REDIS_MODE and list the cluster nodes or the sentinels in REDIS_ADDRS, comma separated; Sentinel also needs
+// REDIS_MASTER_NAME. REDIS_USERNAME / REDIS_PASSWORD (ACL users), REDIS_DB and REDIS_TLS override the values
+// of the connection string.
+func buildRedisOptions() (string, *redis.UniversalOptions, error) {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("REDIS_MODE")))
+	opt := &redis.UniversalOptions{}
+	useTLS := false
+
+	if connString := os.Getenv("REDIS_CONN_STRING"); connString != "" {
+		parsed, err := redis.ParseURL(connString)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to parse Redis connection string: %w", err)
+		}
+		opt.Addrs = []string{parsed.Addr}
+		opt.Username = parsed.Username
+		opt.Password = parsed.Password
+		opt.DB = parsed.DB
+		useTLS = parsed.TLSConfig != nil
+	}
+	if addrs := splitRedisAddrs(os.Getenv("REDIS_ADDRS")); len(addrs) > 0 {
+		opt.Addrs = addrs
+	}
+	if len(opt.Addrs) == 0 {
+		return "", nil, fmt.Errorf("no Redis address configured")
+	}
+
+	switch mode {
+	case "":
+		mode = RedisModeStandalone
+		if os.Getenv("REDIS_MASTER_NAME") != "" {
+			mode = RedisModeSentinel
+		}
+	case RedisModeStandalone, RedisModeCluster, RedisModeSentinel:
+	default:
+		return "", nil, fmt.Errorf("invalid REDIS_MODE %q, expect standalone, cluster or sentinel", mode)
+	}
+	switch mode {
+	case RedisModeStandalone:
+		opt.Addrs = opt.Addrs[:1]
+	case RedisModeSentinel:
+		opt.MasterName = os.Getenv("REDIS_MASTER_NAME")
+		if opt.MasterName == "" {
+			return "", nil, fmt.Errorf("REDIS_MASTER_NAME is required in sentinel mode")
+		}
+		opt.SentinelUsername = os.Getenv("REDIS_SENTINEL_USERNAME")
+		opt.SentinelPassword = os.Getenv("REDIS_SENTINEL_PASSWORD")
+	}
+
+	if username := os.Getenv("REDIS_USERNAME"); username != "" {
+		opt.Username = username
+	}
+	if password := os.Getenv("REDIS_PASSWORD"); password != "" {
+		opt.Password = password
+	}
+	opt.DB = GetEnvOrDefault("REDIS_DB", opt.DB)
+	if mode == RedisModeCluster {
+		// Cluster 只有 0 号库
+		opt.DB = 0
+	}
+	if GetEnvOrDefaultBool("REDIS_TLS", useTLS) {
+		opt.TLSConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: GetEnvOrDefaultBool("REDIS_TLS_INSECURE_SKIP_VERIFY", false),
+		}
+	}
+
+	opt.PoolSize = GetEnvOrDefault("REDIS_POOL_SIZE", 10)
+	// 连接断开或主从切换时命令按退避重试，go-redis 会自动重新建立连接
+	opt.MaxRetries = GetEnvOrDefault("REDIS_MAX_RETRIES", 3)
+	opt.MinRetryBackoff = time.Duration(GetEnvOrDefault("REDIS_MIN_RETRY_BACKOFF_MS", 8)) * time.Millisecond
+	opt.MaxRetryBackoff = time.Duration(GetEnvOrDefault("REDIS_MAX_RETRY_BACKOFF_MS", 512)) * time.Millisecond
+	return mode, opt, nil
+}
+
+func newRedisClient(mode string, opt *redis.UniversalOptions) redis.UniversalClient {
+	switch mode {
+	case RedisModeCluster:
+		return redis.NewClusterClient(opt.Cluster())
+	case RedisModeSentinel:
+		return redis.NewFailoverClient(opt.Failover())
+	default:
+		return redis.NewClient(opt.Simple())
+	}
+}
+
+func splitRedisAddrs(s string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(s, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"crypto/rand"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 请求 ID 使用 ULID：48 位毫秒时间戳加 80 位随机数，按 Crockford Base32 编码为 26 个字符，
+// 同一毫秒内生成的 ID 在随机部分上递增，保证按生成顺序排序。
+
+const RequestIdHeader = "X-Request-Id"
+
+const ulidEncoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ulidMu       sync.Mutex
+	ulidLastTime uint64
+	ulidLastRand [10]byte
+)
+
+// inboundRequestIdPattern 客户端传入的请求 ID 只接受常见的字符，避免注入日志与响应头
+var inboundRequestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:\-]{8,64}$`)
+
+// GenerateRequestId returns a new ULID, ids generated in the same millisecond increase monotonically.
+func GenerateRequestId() string {
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+	now := uint64(time.Now().UnixMilli())
+	if now > ulidLastTime {
+		ulidLastTime = now
+		_, _ = rand.Read(ulidLastRand[:])
+	} else {
+		// 时钟未前进（或回拨）时沿用上一个时间戳，随机部分加一
+		for i := len(ulidLastRand) - 1; i >= 0; i-- {
+			ulidLastRand[i]++
+			if ulidLastRand[i] != 0 {
+				break
+			}
+		}
+	}
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ulidLastTime >> (40 - 8*i))
+	}
+	copy(id[6:], ulidLastRand[:])
+	return encodeULID(id)
+}
+
+func encodeULID(id [16]byte) string {
+	// 128 位按 5 位一组编码，首字符只有 3 位有效
+	out := make([]byte, 26)
+	out[0] = ulidEncoding[(id[0]&224)>>5]
+	out[1] = ulidEncoding[id[0]&31]
+	out[2] = ulidEncoding[(id[1]&248)>>3]
+	out[3] = ulidEncoding[((id[1]&7)<<2)|((id[2]&192)>>6)]
+	out[4] = ulidEncoding[(id[2]&62)>>1]
+	out[5] = ulidEncoding[((id[2]&1)<<4)|((id[3]&240)>>4)]
+	out[6] = ulidEncoding[((id[3]&15)<<1)|((id[4]&128)>>7)]
+	out[7] = ulidEncoding[(id[4]&124)>>2]
+	out[8] = ulidEncoding[((id[4]&3)<<3)|((id[5]&224)>>5)]
+	out[9] = ulidEncoding[id[5]&31]
+	out[10] = ulidEncoding[(id[6]&248)>>3]
+	out[11] = ulidEncoding[((id[6]&7)<<2)|((id[7]&192)>>6)]
+	out[12] = ulidEncoding[(id[7]&62)>>1]
+	out[13] = ulidEncoding[((id[7]&1)<<4)|((id[8]&240)>>4)]
+	out[14] = ulidEncoding[((id[8]&15)<<1)|((id[9]&128)>>7)]
+	out[15] = ulidEncoding[(id[9]&124)>>2]
+	out[16] = ulidEncoding[((id[9]&3)<<3)|((id[10]&224)>>5)]
+	out[17] = ulidEncoding[id[10]&31]
+	out[18] = ulidEncoding[(id[11]&248)>>3]
+	out[19] = ulidEncoding[((id[11]&7)<<2)|((id[12]&192)>>6)]
+	out[20] = ulidEncoding[(id[12]&62)>>1]
+	out[21] = ulidEncoding[((id[12]&1)<<4)|((id[13]&240)>>4)]
+	out[22] = ulidEncoding[((id[13]&15)<<1)|((id[14]&128)>>7)]
+	out[23] = ulidEncoding[(id[14]&124)>>2]
+	out[24] = ulidEncoding[((id[14]&3)<<3)|((id[15]&224)>>5)]
+	out[25] = ulidEncoding[id[15]&31]
+	return string(out)
+}
+
+// ValidInboundRequestId reports whether a request id sent by the client can be used as is.
+func ValidInboundRequestId(id string) bool {
+	return inboundRequestIdPattern.MatchString(id)
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestGenerateRequestIdIsSortable(t *testing.T) {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = GenerateRequestId()
+		if len(ids[i]) != 26 {
+			t.Fatalf("unexpected length %d: %s", len(ids[i]), ids[i])
+		}
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatal("request ids are not generated in order")
+	}
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			t.Fatalf("duplicate request id %s", id)
+		}
+		seen[id] = struct{}{}
+	}
+}
+
+func TestEncodeULIDTimestamp(t *testing.T) {
+	// 时间戳部分与毫秒数一一对应，可以直接从 ID 读出生成时间
+	before := GenerateRequestId()
+	time.Sleep(2 * time.Millisecond)
+	after := GenerateRequestId()
+	if before[:10] >= after[:10] {
+		t.Fatalf("timestamp part did not increase: %s %s", before, after)
+	}
+}
+
+func TestValidInboundRequestId(t *testing.T) {
+	cases := map[string]bool{
+		"01HZX3K5V8Q2M4N6P8R0S2T4V6":           true,
+		"3f2b8c1e-9d4a-4f6b-8e2c-1a5b7d9f0c3e": true,
+		"short":                                false,
+		"has space in it":                      false,
+		"line\nbreak-injected":                 false,
+	}
+	for id, want := range cases {
+		if got := ValidInboundRequestId(id); got != want {
+			t.Errorf("ValidInboundRequestId(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求级内存记账：缓冲在内存中的请求体和采集的日志载荷计入所属请求以及全局的在途预算，
+// 超过单请求上限或全局预算时拒绝继续缓冲，由调用方返回 503，避免异常流量把进程撑到 OOM。
+// 请求结束时 BodyStorageCleanup 中间件归还该请求记账的全部内存。
+
+const KeyRequestMemory = "key_request_memory"
+
+var (
+	ErrRequestMemoryLimitExceeded   = errors.New("request memory limit exceeded")
+	ErrRequestMemoryBudgetExhausted = errors.New("server memory budget exhausted, please retry later")
+)
+
+var (
+	requestMemoryInFlight atomic.Int64
+	requestMemoryRejected atomic.Int64
+)
+
+type requestMemory struct {
+	used atomic.Int64
+}
+
+// RequestMemoryStats 请求内存记账统计
+type RequestMemoryStats struct {
+	// 在途请求记账的内存（字节）
+	InFlightBytes int64 `json:"in_flight_bytes"`
+	// 全局预算（字节），0 表示不限制
+	BudgetBytes int64 `json:"budget_bytes"`
+	// 单请求上限（字节），0 表示不限制
+	LimitBytes int64 `json:"limit_bytes"`
+	// 因超出上限或预算被拒绝的次数
+	Rejected int64 `json:"rejected"`
+}
+
+func GetRequestMemoryStats() RequestMemoryStats {
+	return RequestMemoryStats{
+		InFlightBytes: requestMemoryInFlight.Load(),
+		BudgetBytes:   requestMemoryBudgetBytes(),
+		LimitBytes:    requestMemoryLimitBytes(),
+		Rejected:      requestMemoryRejected.Load(),
+	}
+}
+
+func requestMemoryLimitBytes() int64 {
+	if constant.RequestMemoryLimitMB <= 0 {
+		return 0
+	}
+	return int64(constant.RequestMemoryLimitMB) << 20
+}
+
+func requestMemoryBudgetBytes() int64 {
+	if constant.RequestMemoryBudgetMB <= 0 {
+		return 0
+	}
+	return int64(constant.RequestMemoryBudgetMB) << 20
+}
+
+func IsRequestMemoryError(err error) bool {
+	return errors.Is(err, ErrRequestMemoryLimitExceeded) || errors.Is(err, ErrRequestMemoryBudgetExhausted)
+}
+
+func getRequestMemory(c *gin.Context) *requestMemory {
+	if tracker, ok := c.Get(KeyRequestMemory); ok {
+		if rm, ok := tracker.(*requestMemory); ok {
+			return rm
+		}
+	}
+	rm := &requestMemory{}
+	c.Set(KeyRequestMemory, rm)
+	return rm
+}
+
+// CheckRequestMemory reports whether n more bytes could be buffered for the request without charging them, so a
+// request announcing a large Content-Length is shed before its body is read.
+func CheckRequestMemory(c *gin.Context, n int64) error {
+	if c == nil || n < 0 {
+		return nil
+	}
+	if limit := requestMemoryLimitBytes(); limit > 0 && getRequestMemory(c).used.Load()+n > limit {
+		requestMemoryRejected.Add(1)
+		return errors.Wrap(ErrRequestMemoryLimitExceeded, fmt.Sprintf("request buffers exceed %d MB", constant.RequestMemoryLimitMB))
+	}
+	if budget := requestMemoryBudgetBytes(); budget > 0 && requestMemoryInFlight.Load()+n > budget {
+		requestMemoryRejected.Add(1)
+		return ErrRequestMemoryBudgetExhausted
+	}
+	return nil
+}
+
+// ReserveRequestMemory charges n bytes buffered in memory to the request and to the global in-flight budget.
+// Nothing is charged when either the per-request limit or the budget would be exceeded.
+func ReserveRequestMemory(c *gin.Context, n int64) error {
+	if c == nil || n <= 0 {
+		return nil
+	}
+	rm := getRequestMemory(c)
+	if limit := requestMemoryLimitBytes(); limit > 0 && rm.used.Load()+n > limit {
+		requestMemoryRejected.Add(1)
+		return errors.Wrap(ErrRequestMemoryLimitExceeded, fmt.Sprintf("request buffers exceed %d MB", constant.RequestMemoryLimitMB))
+	}
+	if budget := requestMemoryBudgetBytes(); budget > 0 {
+		for {
+			current := requestMemoryInFlight.Load()
+			if current+n > budget {
+				requestMemoryRejected.Add(1)
+				return ErrRequestMemoryBudgetExhausted
+			}
+			if requestMemoryInFlight.CompareAndSwap(current, current+n) {
+				break
+			}
+		}
+	} else {
+		requestMemoryInFlight.Add(n)
+	}
+	rm.used.Add(n)
+	return nil
+}
+
+// ReleaseRequestMemory returns all the memory charged to the request to the global budget.
+func ReleaseRequestMemory(c *gin.Context) {
+	if c == nil {
+		return
+	}
+	tracker, ok := c.Get(KeyRequestMemory)
+	if !ok {
+		return
+	}
+	if rm, ok := tracker.(*requestMemory); ok {
+		requestMemoryInFlight.Add(-rm.used.Swap(0))
+	}
+}
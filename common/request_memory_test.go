@@ -0,0 +1,48 @@
+package common
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestMemoryLimitAndBudget(t *testing.T) {
+	defer func(limit, budget int) {
+		constant.RequestMemoryLimitMB, constant.RequestMemoryBudgetMB = limit, budget
+	}(constant.RequestMemoryLimitMB, constant.RequestMemoryBudgetMB)
+	constant.RequestMemoryLimitMB = 2
+	constant.RequestMemoryBudgetMB = 3
+
+	first, _ := gin.CreateTestContext(httptest.NewRecorder())
+	second, _ := gin.CreateTestContext(httptest.NewRecorder())
+	base := requestMemoryInFlight.Load()
+
+	if err := ReserveRequestMemory(first, 2<<20); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ReserveRequestMemory(first, 1); !errors.Is(err, ErrRequestMemoryLimitExceeded) {
+		t.Fatalf("expected the per-request limit to be exceeded, got %v", err)
+	}
+	if err := ReserveRequestMemory(second, 2<<20); !errors.Is(err, ErrRequestMemoryBudgetExhausted) {
+		t.Fatalf("expected the budget to be exhausted, got %v", err)
+	}
+	if err := CheckRequestMemory(second, 1<<20); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := requestMemoryInFlight.Load() - base; got != 2<<20 {
+		t.Fatalf("unexpected in-flight bytes %d", got)
+	}
+
+	ReleaseRequestMemory(first)
+	if got := requestMemoryInFlight.Load() - base; got != 0 {
+		t.Fatalf("memory not released, in-flight bytes %d", got)
+	}
+	if err := ReserveRequestMemory(second, 2<<20); err != nil {
+		t.Fatalf("unexpected error after release: %v", err)
+	}
+	ReleaseRequestMemory(second)
+}
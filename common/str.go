@@ -106,6 +106,16 @@ func GetJsonString(data any) string {
 	return string(b)
 }
 
+// IsValidBillingPreference reports whether pref is one of the supported billing preferences.
+func IsValidBillingPreference(pref string) bool {
+	switch pref {
+	case "subscription_first", "wallet_first", "subscription_only", "wallet_only":
+		return true
+	default:
+		return false
+	}
+}
+
 // NormalizeBillingPreference clamps the billing preference to valid values.
 func NormalizeBillingPreference(pref string) string {
 	switch strings.TrimSpace(pref) {
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LogFormatJSON 为 true 时系统日志、请求日志和访问日志每行输出一个 JSON 对象，由 LOG_FORMAT=json 开启
+var LogFormatJSON = false
+
+// logWriter 写入当前的 gin 日志输出，日志文件轮转后自动写入新的文件
+type logWriter struct {
+	stderr bool
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	if w.stderr {
+		return gin.DefaultErrorWriter.Write(p)
+	}
+	return gin.DefaultWriter.Write(p)
+}
+
+var (
+	jsonLogger      = newJSONLogger(logWriter{})
+	jsonErrorLogger = newJSONLogger(logWriter{stderr: true})
+)
+
+func newJSONLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// LogJSON writes a structured log line. Like the text logs, info goes to the standard output and the other levels
+// to the error output.
+func LogJSON(level slog.Level, msg string, attrs ...slog.Attr) {
+	logger := jsonErrorLogger
+	if level == slog.LevelInfo {
+		logger = jsonLogger
+	}
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSysLogJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	defaultWriter, defaultErrorWriter := gin.DefaultWriter, gin.DefaultErrorWriter
+	gin.DefaultWriter, gin.DefaultErrorWriter = &stdout, &stderr
+	LogFormatJSON = true
+	defer func() {
+		gin.DefaultWriter, gin.DefaultErrorWriter = defaultWriter, defaultErrorWriter
+		LogFormatJSON = false
+	}()
+
+	SysLog("server started")
+	SysError("database unavailable")
+
+	var entry map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &entry); err != nil {
+		t.Fatalf("info log is not JSON: %q", stdout.String())
+	}
+	if entry["level"] != "INFO" || entry["msg"] != "server started" || entry["source"] != "system" {
+		t.Fatalf("unexpected info log: %v", entry)
+	}
+	if err := json.Unmarshal(stderr.Bytes(), &entry); err != nil {
+		t.Fatalf("error log is not JSON: %q", stderr.String())
+	}
+	if entry["level"] != "ERROR" || entry["msg"] != "database unavailable" {
+		t.Fatalf("unexpected error log: %v", entry)
+	}
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"time"
 
@@ -9,16 +10,28 @@ import (
 )
 
 func SysLog(s string) {
+	if LogFormatJSON {
+		LogJSON(slog.LevelInfo, s, slog.String("source", "system"))
+		return
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
 }
 
 func SysError(s string) {
+	if LogFormatJSON {
+		LogJSON(slog.LevelError, s, slog.String("source", "system"))
+		return
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
 }
 
 func FatalLog(v ...any) {
+	if LogFormatJSON {
+		LogJSON(slog.LevelError, fmt.Sprint(v...), slog.String("source", "system"), slog.Bool("fatal", true))
+		os.Exit(1)
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[FATAL] %v | %v \n", t.Format("2006/01/02 - 15:04:05"), v)
 	os.Exit(1)
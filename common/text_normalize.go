@@ -0,0 +1,75 @@
+package common
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// cp1252Bytes maps the characters Windows-1252 assigns to 0x80-0x9F back to their byte,
+// the rest of 0x80-0xFF is identical to Latin-1.
+var cp1252Bytes = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+	'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+func mojibakeByte(r rune) (byte, bool) {
+	if r >= 0x80 && r <= 0xFF {
+		return byte(r), true
+	}
+	b, ok := cp1252Bytes[r]
+	return b, ok
+}
+
+// RepairMojibake restores UTF-8 text that was decoded as Windows-1252 / Latin-1 and encoded again,
+// e.g. "ä¸­æ–‡" back to "中文". A run of such characters is only replaced when its bytes form valid
+// UTF-8, which genuine Latin text almost never does.
+func RepairMojibake(data []byte) []byte {
+	var out []byte
+	var run []byte
+	runStart := -1
+	flush := func(end int) {
+		if runStart < 0 {
+			return
+		}
+		if len(run) >= 2 && utf8.Valid(run) {
+			out = append(out, run...)
+		} else {
+			out = append(out, data[runStart:end]...)
+		}
+		run = run[:0]
+		runStart = -1
+	}
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if b, ok := mojibakeByte(r); ok && size > 1 {
+			if runStart < 0 {
+				runStart = i
+			}
+			run = append(run, b)
+		} else {
+			flush(i)
+			out = append(out, data[i:i+size]...)
+		}
+		i += size
+	}
+	flush(len(data))
+	return out
+}
+
+// NormalizeText repairs mojibake and converts the text to Unicode NFC, pure ASCII is returned as is.
+func NormalizeText(data []byte) []byte {
+	ascii := true
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return data
+	}
+	return norm.NFC.Bytes(RepairMojibake(data))
+}
@@ -0,0 +1,27 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "ascii", input: `{"content":"hello"}`, want: `{"content":"hello"}`},
+		{name: "valid cjk", input: `{"content":"中文"}`, want: `{"content":"中文"}`},
+		{name: "cjk mojibake", input: "{\"content\":\"\u00e4\u00b8\u00ad\u00e6\u2013\u2021\"}", want: `{"content":"中文"}`},
+		{name: "latin1 mojibake", input: "caf\u00c3\u00a9", want: "café"},
+		{name: "genuine latin", input: "café déjà vu", want: "café déjà vu"},
+		{name: "decomposed to nfc", input: "cafe\u0301", want: "caf\u00e9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, string(NormalizeText([]byte(tt.input))))
+		})
+	}
+}
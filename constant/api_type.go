@@ -36,5 +36,11 @@ const (
 	APITypeMiniMax
 	APITypeReplicate
 	APITypeCodex
+	APITypeMock
+	APITypeSelfHosted
+	APITypeStability
 	APITypeDummy // this one is only for count, do not add any channel after this
 )
+
+// APITypePluginBase 第三方适配器使用的 API 类型从这里开始，避免与内置类型冲突
+const APITypePluginBase = 1000
@@ -55,6 +55,12 @@ const (
 	ChannelTypeSora           = 55
 	ChannelTypeReplicate      = 56
 	ChannelTypeCodex          = 57
+	ChannelTypeMock           = 58
+	ChannelTypeVLLM           = 59
+	ChannelTypeTGI            = 60
+	ChannelTypeLlamaCpp       = 61
+	ChannelTypeGroq           = 62
+	ChannelTypeStability      = 63
 	ChannelTypeDummy          // this one is only for count, do not add any channel after this
 
 )
@@ -118,6 +124,12 @@ var ChannelBaseURLs = []string{
 	"https://api.openai.com",                    //55
 	"https://api.replicate.com",                 //56
 	"https://chatgpt.com",                       //57
+	"",                                          //58
+	"http://localhost:8000",                     //59
+	"http://localhost:8080",                     //60
+	"http://localhost:8080",                     //61
+	"https://api.groq.com/openai",               //62
+	"https://api.stability.ai",                  //63
 }
 
 var ChannelTypeNames = map[int]string{
@@ -175,6 +187,32 @@ var ChannelTypeNames = map[int]string{
 	ChannelTypeSora:           "Sora",
 	ChannelTypeReplicate:      "Replicate",
 	ChannelTypeCodex:          "Codex",
+	ChannelTypeMock:           "Mock",
+	ChannelTypeVLLM:           "vLLM",
+	ChannelTypeTGI:            "TGI",
+	ChannelTypeLlamaCpp:       "llama.cpp",
+	ChannelTypeGroq:           "Groq",
+	ChannelTypeStability:      "Stability",
+}
+
+// ChannelTypePluginBase 第三方适配器使用的渠道类型从这里开始，避免与内置类型冲突
+const ChannelTypePluginBase = 1000
+
+var pluginChannelBaseURLs = map[int]string{}
+
+// RegisterPluginChannel records the name and default base url of a channel type served by a
+// third-party adaptor, it must be called during init.
+func RegisterPluginChannel(channelType int, name string, baseURL string) {
+	ChannelTypeNames[channelType] = name
+	pluginChannelBaseURLs[channelType] = baseURL
+}
+
+// GetChannelBaseURL returns the default base url of the channel type, including the plugin ones.
+func GetChannelBaseURL(channelType int) string {
+	if channelType >= 0 && channelType < len(ChannelBaseURLs) {
+		return ChannelBaseURLs[channelType]
+	}
+	return pluginChannelBaseURLs[channelType]
 }
 
 func GetChannelTypeName(channelType int) string {
@@ -18,7 +18,17 @@ const (
 	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenModelClasses      ContextKey = "token_model_classes"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenComplianceTags    ContextKey = "token_compliance_tags"
+	ContextKeyTokenBillingPreference ContextKey = "token_billing_preference"
+	ContextKeyTokenResponseCache     ContextKey = "token_response_cache"
+	ContextKeyTokenContentFallback   ContextKey = "token_content_filter_fallback"
+	ContextKeyTokenFetchUrlTool      ContextKey = "token_fetch_url_tool"
+	ContextKeyTokenNativePassthrough ContextKey = "token_native_passthrough"
+	ContextKeyDemoRequest            ContextKey = "demo_request"
+	ContextKeyReplayOf               ContextKey = "replay_of"
+	ContextKeyRequiredCapabilities   ContextKey = "required_capabilities"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -37,11 +47,29 @@ const (
 	ContextKeyChannelIsMultiKey        ContextKey = "channel_is_multi_key"
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
 	ContextKeyChannelKey               ContextKey = "channel_key"
+	ContextKeyChannelRegion            ContextKey = "channel_region"
+	ContextKeyChannelOwnerUserId       ContextKey = "channel_owner_user_id"
+	ContextKeyChannelTag               ContextKey = "channel_tag"
 
 	ContextKeyAutoGroup           ContextKey = "auto_group"
 	ContextKeyAutoGroupIndex      ContextKey = "auto_group_index"
 	ContextKeyAutoGroupRetryIndex ContextKey = "auto_group_retry_index"
 
+	// ContextKeyPreferredRegion is the region the router prefers for this request (node region or client hint).
+	ContextKeyPreferredRegion ContextKey = "preferred_region"
+
+	// ContextKeyRequestDeadline is the deadline the client asked for with the request timeout header.
+	ContextKeyRequestDeadline ContextKey = "request_deadline"
+
+	// ContextKeyTokenBudgetId is the token budget envelope the request draws from.
+	ContextKeyTokenBudgetId ContextKey = "token_budget_id"
+
+	// ContextKeyTPMCountedTokens is the number of tokens of the request counted against the TPM limits so far.
+	ContextKeyTPMCountedTokens ContextKey = "tpm_counted_tokens"
+
+	// ContextKeyRequestQueueWait is the total time the request waited in admission queues.
+	ContextKeyRequestQueueWait ContextKey = "request_queue_wait"
+
 	/* user related keys */
 	ContextKeyUserId      ContextKey = "id"
 	ContextKeyUserSetting ContextKey = "user_setting"
@@ -61,8 +89,66 @@ const (
 	ContextKeyLoggedResponseBody     ContextKey = "logged_response_body"
 	ContextKeyLoggedRequestBodyFull  ContextKey = "logged_request_body_full"
 	ContextKeyLoggedResponseBodyFull ContextKey = "logged_response_body_full"
+	ContextKeyLoggedPayloadRedacted  ContextKey = "logged_payload_redacted"
+	// ContextKeyLoggedPayloadSampleRoll 请求内容采样的随机值（0-99），每个请求只取一次
+	ContextKeyLoggedPayloadSampleRoll ContextKey = "logged_payload_sample_roll"
+	// ContextKeyChannelLogPayloadMaxRunes 渠道设置的日志内容长度上限（*int），nil 表示使用全局设置
+	ContextKeyChannelLogPayloadMaxRunes ContextKey = "channel_log_payload_max_runes"
+
+	/* request trace */
+	ContextKeyRequestTrace   ContextKey = "request_trace"
+	ContextKeyRecordedLogIds ContextKey = "recorded_log_ids"
+	// ContextKeyRelayAttempts 每次上游尝试的记录（[]model.RelayAttempt），写入日志详情
+	ContextKeyRelayAttempts ContextKey = "relay_attempts"
+	// ContextKeyModerationVerdict 转发前内容审核的结论（*model.ModerationVerdict），写入日志详情
+	ContextKeyModerationVerdict ContextKey = "moderation_verdict"
+	// ContextKeySessionId 客户端传递的会话 ID，写入消费日志用于按会话汇总
+	ContextKeySessionId ContextKey = "session_id"
+	// ContextKeyBatchId 批量任务执行的请求所属的批次，按批量折扣计费
+	ContextKeyBatchId ContextKey = "batch_id"
+	// ContextKeyBackgroundResponseId 后台执行的 Responses 请求对应的响应 ID
+	ContextKeyBackgroundResponseId ContextKey = "background_response_id"
+	// ContextKeyContentFilterFallback 内容过滤兜底的决策（*service.ContentFilterFallbackDecision），写入日志便于审计
+	ContextKeyContentFilterFallback ContextKey = "content_filter_fallback"
+	// ContextKeyStreamPendingFinishChunk 流式转换器 usage_in_final_chunk 暂存的结束块
+	ContextKeyStreamPendingFinishChunk ContextKey = "stream_pending_finish_chunk"
+	// ContextKeyStreamErrorCode 流式响应开始后上游返回错误时归一化的错误码，写入日志
+	ContextKeyStreamErrorCode ContextKey = "stream_error_code"
+	// ContextKeyModelAlias 客户端请求的模型名（被改写或作为别名解析为其他模型时），写入日志
+	ContextKeyModelAlias ContextKey = "model_alias"
+	// ContextKeyModelAliasTargetIndex 别名回退链中当前使用的目标下标，重试时切换到下一个目标
+	ContextKeyModelAliasTargetIndex ContextKey = "model_alias_target_index"
+	// ContextKeyTrafficSplitArm A/B 分流选中的一侧（baseline 或 candidate），写入日志
+	ContextKeyTrafficSplitArm ContextKey = "traffic_split_arm"
+	// ContextKeyTrafficMirrorChannelId 影子模式下请求成功后复制请求的渠道
+	ContextKeyTrafficMirrorChannelId ContextKey = "traffic_mirror_channel_id"
+	// ContextKeyMirrorOf 影子请求对应的原请求日志 ID，影子请求不扣费也不计入用量
+	ContextKeyMirrorOf ContextKey = "mirror_of"
+	// ContextKeyToolLoopStopReason 网关编排的工具循环超出上限停止的原因，写入日志
+	ContextKeyToolLoopStopReason ContextKey = "tool_loop_stop_reason"
+	// ContextKeyRequestDefaults 按分组补充到请求中的默认参数路径，写入日志
+	ContextKeyRequestDefaults ContextKey = "request_defaults"
+	// ContextKeyToolCallEmulation 上游模型不支持工具调用，由网关用提示词模拟
+	ContextKeyToolCallEmulation ContextKey = "tool_call_emulation"
+	// ContextKeyNativePassthrough 请求和响应未经转换原样转发
+	ContextKeyNativePassthrough ContextKey = "native_passthrough"
+	// ContextKeyUpstreamModelName 模型重定向后实际请求上游的模型，用于附加来源信息
+	ContextKeyUpstreamModelName ContextKey = "upstream_model_name"
+	// ContextKeyProvenanceSent 流式响应已经写出来源信息事件
+	ContextKeyProvenanceSent ContextKey = "provenance_sent"
+
+	/* opentelemetry */
+	ContextKeyOtelServerSpan     ContextKey = "otel_server_span"
+	ContextKeyOtelMiddlewareSpan ContextKey = "otel_middleware_span"
+	ContextKeyOtelStreamSpan     ContextKey = "otel_stream_span"
+
+	// ContextKeyLatencyBreakdown stores the timings returned to the client in the Server-Timing header
+	ContextKeyLatencyBreakdown ContextKey = "latency_breakdown"
 
 	// ContextKeyAdminRejectReason stores an admin-only reject/block reason extracted from upstream responses.
 	// It is not returned to end users, but can be persisted into consume/error logs for debugging.
 	ContextKeyAdminRejectReason ContextKey = "admin_reject_reason"
+
+	// ContextKeyAuditRecorded marks an admin request whose audit log has been recorded, so it is recorded once.
+	ContextKeyAuditRecorded ContextKey = "audit_recorded"
 )
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetUserAdminRoleRequest struct {
+	// AdminRole 为空时恢复全部管理权限
+	AdminRole string `json:"admin_role"`
+}
+
+// GetAdminRoles returns the admin roles and the resources permissions can be granted on.
+func GetAdminRoles(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"roles":     system_setting.GetAdminRBACSettings().Roles,
+		"resources": system_setting.AdminResources,
+		"actions":   []string{system_setting.AdminActionRead, system_setting.AdminActionWrite},
+	})
+}
+
+// UpdateAdminRoles replaces the admin roles, the built-in super_admin role is always kept.
+func UpdateAdminRoles(c *gin.Context) {
+	var roles []system_setting.AdminRole
+	if err := common.DecodeJson(c.Request.Body, &roles); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	rolesJson, err := common.Marshal(roles)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	value, err := system_setting.ValidateAdminRoles(string(rolesJson))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.UpdateOption("admin_rbac.roles", value); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.SysLog(fmt.Sprintf("admin roles updated by user %d", c.GetInt("id")))
+	GetAdminRoles(c)
+}
+
+// SetUserAdminRole assigns an admin role to an admin user.
+func SetUserAdminRole(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	var req SetUserAdminRoleRequest
+	if err = common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.AdminRole != "" {
+		if _, ok := system_setting.GetAdminRole(req.AdminRole); !ok {
+			common.ApiErrorMsg(c, fmt.Sprintf("管理角色 %s 不存在", req.AdminRole))
+			return
+		}
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.AdminRole != "" && user.Role != common.RoleAdminUser {
+		common.ApiErrorMsg(c, "只能为管理员分配管理角色")
+		return
+	}
+	if err = model.SetUserAdminRole(userId, req.AdminRole); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.SysLog(fmt.Sprintf("admin role of user %d set to %q by user %d", userId, req.AdminRole, c.GetInt("id")))
+	common.ApiSuccess(c, gin.H{
+		"id":         userId,
+		"admin_role": req.AdminRole,
+	})
+}
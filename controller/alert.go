@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNotificationDeliveries lists the alert deliveries, optionally filtered by the status and event query parameters.
+func GetNotificationDeliveries(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	deliveries, total, err := model.GetNotificationDeliveries(c.Query("status"), c.Query("event"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(deliveries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RetryNotificationDelivery sends a delivery again right away, failed ones included.
+func RetryNotificationDelivery(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	delivery, err := model.GetNotificationDeliveryById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if delivery.Status == model.NotificationDeliverySuccess {
+		common.ApiErrorMsg(c, "该投递已成功，无需重试")
+		return
+	}
+	// 手动重试重新计算尝试次数
+	delivery.Attempts = 0
+	if err = service.AttemptNotificationDelivery(delivery); err != nil {
+		common.ApiErrorMsg(c, "重试失败："+err.Error())
+		return
+	}
+	common.ApiSuccess(c, delivery)
+}
+
+type testAlertRequest struct {
+	// Webhook 只测试该 webhook，为空时发送给全部接收端
+	Webhook string `json:"webhook"`
+}
+
+// FireTestAlert sends a test alert to check the alert receivers.
+func FireTestAlert(c *gin.Context) {
+	var req testAlertRequest
+	if c.Request.ContentLength > 0 {
+		if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	deliveries, err := service.FireTestAlert(req.Webhook)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, deliveries)
+}
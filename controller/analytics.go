@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// analyticsMaxHourlyRange 按小时查询的最大时间跨度
+const analyticsMaxHourlyRange = 31 * 24 * 3600
+
+// GetUsageAnalytics returns the usage rollups of the time range grouped by time, user, channel and/or model.
+func GetUsageAnalytics(c *gin.Context) {
+	query, ok := parseUsageAnalyticsQuery(c)
+	if !ok {
+		return
+	}
+	query.UserId, _ = strconv.Atoi(c.Query("user_id"))
+	query.ChannelId, _ = strconv.Atoi(c.Query("channel_id"))
+	respondUsageAnalytics(c, query)
+}
+
+// GetSelfUsageAnalytics 普通用户只能查询自己的用量，不能按渠道分组
+func GetSelfUsageAnalytics(c *gin.Context) {
+	query, ok := parseUsageAnalyticsQuery(c)
+	if !ok {
+		return
+	}
+	for _, dimension := range query.GroupBy {
+		if dimension == "channel" {
+			common.ApiErrorMsg(c, "不支持按渠道分组")
+			return
+		}
+	}
+	query.UserId = c.GetInt("id")
+	respondUsageAnalytics(c, query)
+}
+
+func parseUsageAnalyticsQuery(c *gin.Context) (model.UsageRollupQuery, bool) {
+	query := model.UsageRollupQuery{
+		Granularity: c.DefaultQuery("granularity", model.UsageRollupHour),
+		ModelName:   c.Query("model_name"),
+		GroupBy:     []string{"time"},
+	}
+	query.StartTime, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	query.EndTime, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if query.EndTime == 0 {
+		query.EndTime = time.Now().Unix()
+	}
+	if query.StartTime == 0 {
+		query.StartTime = query.EndTime - 24*3600
+	}
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		query.GroupBy = strings.Split(groupBy, ",")
+	}
+	if query.Granularity != model.UsageRollupHour && query.Granularity != model.UsageRollupDay {
+		common.ApiErrorMsg(c, "granularity 只能是 hour 或 day")
+		return query, false
+	}
+	if query.EndTime <= query.StartTime {
+		common.ApiErrorMsg(c, "结束时间必须晚于开始时间")
+		return query, false
+	}
+	if query.Granularity == model.UsageRollupHour && query.EndTime-query.StartTime > analyticsMaxHourlyRange {
+		common.ApiErrorMsg(c, "按小时查询的时间跨度不能超过 31 天，请按天查询")
+		return query, false
+	}
+	return query, true
+}
+
+func respondUsageAnalytics(c *gin.Context, query model.UsageRollupQuery) {
+	rows, err := model.QueryUsageRollups(query)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"granularity": query.Granularity,
+		"group_by":    query.GroupBy,
+		"items":       rows,
+	})
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/service"
+	"github.com/gin-gonic/gin"
+)
+
+// GetModelDemand returns the queue depth and tokens in flight per model as seen by this node,
+// intended to drive autoscalers of self-hosted backends.
+func GetModelDemand(c *gin.Context) {
+	demands := service.GetModelDemands()
+	modelName := strings.TrimSpace(c.Query("model"))
+	if modelName != "" {
+		filtered := make([]service.ModelDemand, 0, 1)
+		for _, demand := range demands {
+			if demand.Model == modelName {
+				filtered = append(filtered, demand)
+			}
+		}
+		demands = filtered
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    demands,
+	})
+}
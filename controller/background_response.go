@@ -0,0 +1,391 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"gorm.io/gorm"
+)
+
+// Responses 接口的后台模式：带 background: true 的请求在 Distribute 选定渠道后立即返回 queued 状态的响应，
+// 请求在本节点上以与批量任务相同的方式进程内执行，固定使用选定的渠道，按普通请求在执行结束时结算。
+// 上游始终以流式请求，取消时中断上游请求并按已输出的内容结算，与客户端断开流式连接时一致。
+
+const (
+	backgroundResponseHeartbeat = 10 * time.Second
+	// backgroundResponseStaleAfter 超过该时间没有心跳的请求视为已中断
+	backgroundResponseStaleAfter = 2 * time.Minute
+)
+
+// backgroundResponseJob 一个后台请求执行时的令牌信息
+type backgroundResponseJob struct {
+	response  *model.BackgroundResponse
+	token     *model.Token
+	userCache *model.UserBase
+	group     string
+}
+
+type backgroundResponseJobContextKey struct{}
+
+// acceptBackgroundResponse queues the Responses request when it asks for background mode and answers with the
+// queued response, it returns false when the request should be relayed as usual.
+func acceptBackgroundResponse(c *gin.Context) bool {
+	setting := operation_setting.GetBackgroundResponseSetting()
+	if !setting.Enabled || common.GetContextKeyString(c, constant.ContextKeyBackgroundResponseId) != "" {
+		return false
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil || !gjson.GetBytes(body, "background").Bool() {
+		// 读取请求体的错误由 Relay 返回
+		return false
+	}
+	if gjson.GetBytes(body, "stream").Bool() {
+		openAIErrorResponse(c, http.StatusBadRequest, "stream is not supported for background responses")
+		return true
+	}
+	userId := c.GetInt("id")
+	if setting.MaxActivePerUser > 0 {
+		count, err := model.CountActiveBackgroundResponses(userId)
+		if err != nil {
+			openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return true
+		}
+		if count >= int64(setting.MaxActivePerUser) {
+			openAIErrorResponse(c, http.StatusTooManyRequests,
+				fmt.Sprintf("too many background responses in progress, the limit is %d", setting.MaxActivePerUser))
+			return true
+		}
+	}
+	request, err := sjson.DeleteBytes(body, "background")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid request: "+err.Error())
+		return true
+	}
+
+	response := &model.BackgroundResponse{
+		ResponseId: model.BackgroundResponseIdPrefix + common.GetUUID(),
+		UserId:     userId,
+		TokenId:    c.GetInt("token_id"),
+		ChannelId:  common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		ModelName:  common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		Status:     model.BackgroundResponseQueued,
+		RequestId:  c.GetString(common.RequestIdKey),
+		Request:    string(request),
+		CreatedAt:  common.GetTimestamp(),
+	}
+	if err = response.Insert(); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return true
+	}
+	gopool.Go(func() {
+		runBackgroundResponse(response)
+	})
+	c.JSON(http.StatusOK, toOpenAIBackgroundResponse(response))
+	return true
+}
+
+// toOpenAIBackgroundResponse returns the stored upstream response once finished, or a response object carrying
+// the status and the error.
+func toOpenAIBackgroundResponse(response *model.BackgroundResponse) any {
+	if response.Response != "" {
+		return json.RawMessage(response.Response)
+	}
+	result := map[string]any{
+		"id":         response.ResponseId,
+		"object":     "response",
+		"created_at": response.CreatedAt,
+		"status":     response.Status,
+		"background": true,
+		"model":      response.ModelName,
+		"output":     []any{},
+		"error":      nil,
+		"usage":      nil,
+	}
+	if response.Error != "" {
+		result["error"] = json.RawMessage(response.Error)
+	}
+	return result
+}
+
+func backgroundResponseError(code string, message string) string {
+	data, _ := common.Marshal(map[string]string{"code": code, "message": message})
+	return string(data)
+}
+
+// setupBackgroundResponseRequest replaces TokenAuth for the background requests and pins the channel selected
+// when the request was accepted.
+func setupBackgroundResponseRequest(c *gin.Context) {
+	job, ok := c.Request.Context().Value(backgroundResponseJobContextKey{}).(*backgroundResponseJob)
+	if !ok {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	c.Set(common.RequestIdKey, job.response.RequestId)
+	job.userCache.WriteContext(c)
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, job.group)
+	_ = middleware.SetupContextForToken(c, job.token)
+	if job.response.ChannelId != 0 {
+		c.Set("specific_channel_id", strconv.Itoa(job.response.ChannelId))
+	}
+	common.SetContextKey(c, constant.ContextKeyBackgroundResponseId, job.response.ResponseId)
+	c.Next()
+}
+
+var (
+	backgroundResponseEngineOnce sync.Once
+	backgroundResponseEngineGin  *gin.Engine
+)
+
+// backgroundResponseEngine 不能像批量任务一样用 sync.OnceValue 初始化，Relay 会调用 acceptBackgroundResponse，形成初始化循环
+func backgroundResponseEngine() *gin.Engine {
+	backgroundResponseEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(middleware.RelayPanicRecover(), setupBackgroundResponseRequest, middleware.Distribute())
+		engine.POST("/v1/responses", func(c *gin.Context) {
+			Relay(c, types.RelayFormatOpenAIResponses)
+		})
+		backgroundResponseEngineGin = engine
+	})
+	return backgroundResponseEngineGin
+}
+
+// runBackgroundResponse executes the request and stores the outcome, a cancellation seen in the heartbeat aborts
+// the upstream request.
+func runBackgroundResponse(response *model.BackgroundResponse) {
+	started, err := model.StartBackgroundResponse(response)
+	if err != nil {
+		common.SysError(fmt.Sprintf("background response %s: start failed: %s", response.ResponseId, err.Error()))
+		return
+	}
+	if !started {
+		return
+	}
+	token, userCache, group, err := loadRelayToken(response.TokenId)
+	if err != nil {
+		response.Status = model.BackgroundResponseFailed
+		response.Error = backgroundResponseError("token_unavailable", err.Error())
+		saveBackgroundResponse(response)
+		return
+	}
+
+	timeout := time.Duration(max(operation_setting.GetBackgroundResponseSetting().TimeoutMinutes, 1)) * time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	job := &backgroundResponseJob{response: response, token: token, userCache: userCache, group: group}
+	ctx = context.WithValue(ctx, backgroundResponseJobContextKey{}, job)
+
+	var cancelled atomic.Bool
+	done := make(chan struct{})
+	defer close(done)
+	gopool.Go(func() {
+		ticker := time.NewTicker(backgroundResponseHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				status, err := model.HeartbeatBackgroundResponse(response.Id)
+				if err == nil && status != model.BackgroundResponseInProgress {
+					cancelled.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	})
+
+	requestBody, err := sjson.SetBytes([]byte(response.Request), "stream", true)
+	if err != nil {
+		response.Status = model.BackgroundResponseFailed
+		response.Error = backgroundResponseError("invalid_request", err.Error())
+		saveBackgroundResponse(response)
+		return
+	}
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/v1/responses", bytes.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	backgroundResponseEngine().ServeHTTP(w, req)
+	if cancelled.Load() {
+		// 已取消，Relay 已按中断前输出的内容结算
+		return
+	}
+
+	body := w.Body.Bytes()
+	var streamErr string
+	if w.Code == http.StatusOK {
+		body, streamErr = parseBackgroundResponseStream(body)
+	}
+	switch {
+	case w.Code == http.StatusOK && body != nil:
+		response.UpstreamResponseId = gjson.GetBytes(body, "id").String()
+		switch status := gjson.GetBytes(body, "status").String(); status {
+		case model.BackgroundResponseIncomplete, model.BackgroundResponseFailed:
+			response.Status = status
+		default:
+			response.Status = model.BackgroundResponseCompleted
+		}
+		body, _ = sjson.SetBytes(body, "id", response.ResponseId)
+		body, _ = sjson.SetBytes(body, "background", true)
+		response.Response = string(body)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		response.Status = model.BackgroundResponseFailed
+		response.Error = backgroundResponseError("timeout", fmt.Sprintf("the response did not finish within %s", timeout))
+	case w.Code == http.StatusOK:
+		response.Status = model.BackgroundResponseFailed
+		response.Error = streamErr
+		if response.Error == "" {
+			response.Error = backgroundResponseError("server_error", "the stream ended without a final response")
+		}
+	default:
+		response.Status = model.BackgroundResponseFailed
+		if upstreamErr := gjson.GetBytes(body, "error"); upstreamErr.IsObject() {
+			response.Error = upstreamErr.Raw
+		} else {
+			response.Error = backgroundResponseError("server_error", fmt.Sprintf("status code %d: %s", w.Code, string(body)))
+		}
+	}
+	saveBackgroundResponse(response)
+}
+
+// parseBackgroundResponseStream returns the response object of the last response.completed, response.incomplete
+// or response.failed event of the stream, or the error sent in the stream when there is none.
+func parseBackgroundResponseStream(stream []byte) ([]byte, string) {
+	var final []byte
+	streamErr := ""
+	for _, line := range bytes.Split(stream, []byte("\n")) {
+		data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if !gjson.ValidBytes(data) {
+			continue
+		}
+		event := gjson.ParseBytes(data)
+		switch event.Get("type").String() {
+		case "response.completed", "response.incomplete", "response.failed":
+			if result := event.Get("response"); result.IsObject() {
+				final = []byte(result.Raw)
+			}
+		case "error":
+			streamErr = backgroundResponseError(event.Get("code").String(), event.Get("message").String())
+		default:
+			if upstreamErr := event.Get("error"); upstreamErr.IsObject() {
+				streamErr = upstreamErr.Raw
+			}
+		}
+	}
+	return final, streamErr
+}
+
+func saveBackgroundResponse(response *model.BackgroundResponse) {
+	if _, err := model.FinishBackgroundResponse(response); err != nil {
+		common.SysError(fmt.Sprintf("background response %s: save failed: %s", response.ResponseId, err.Error()))
+	}
+}
+
+// isStaleBackgroundResponse reports whether the active response lost its runner.
+func isStaleBackgroundResponse(response *model.BackgroundResponse) bool {
+	before := time.Now().Add(-backgroundResponseStaleAfter).Unix()
+	switch response.Status {
+	case model.BackgroundResponseQueued:
+		return response.CreatedAt < before
+	case model.BackgroundResponseInProgress:
+		return response.HeartbeatAt < before
+	}
+	return false
+}
+
+func getUserBackgroundResponseOrAbort(c *gin.Context) *model.BackgroundResponse {
+	response, err := model.GetUserBackgroundResponse(c.GetInt("id"), c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		openAIErrorResponse(c, http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		return nil
+	}
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	if isStaleBackgroundResponse(response) {
+		response.Status = model.BackgroundResponseFailed
+		response.Error = backgroundResponseError("server_error", "the response was interrupted")
+		saveBackgroundResponse(response)
+	}
+	return response
+}
+
+// RetrieveBackgroundResponse GET /v1/responses/{id}，只能查询后台模式创建的响应
+func RetrieveBackgroundResponse(c *gin.Context) {
+	response := getUserBackgroundResponseOrAbort(c)
+	if response == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBackgroundResponse(response))
+}
+
+// CancelBackgroundResponse POST /v1/responses/{id}/cancel，重复取消返回已取消的响应
+func CancelBackgroundResponse(c *gin.Context) {
+	response := getUserBackgroundResponseOrAbort(c)
+	if response == nil {
+		return
+	}
+	ok, err := model.CancelBackgroundResponse(response)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok && response.Status != model.BackgroundResponseCancelled {
+		openAIErrorResponse(c, http.StatusConflict, fmt.Sprintf("cannot cancel a response with status %s", response.Status))
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBackgroundResponse(response))
+}
+
+var backgroundResponseTaskOnce sync.Once
+
+// StartBackgroundResponseTask fails the background responses interrupted by a node restart and deletes the
+// finished ones after the retention period, on the master node.
+func StartBackgroundResponseTask() {
+	backgroundResponseTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				time.Sleep(time.Minute)
+				before := time.Now().Add(-backgroundResponseStaleAfter).Unix()
+				if _, err := model.FailStaleBackgroundResponses(before, backgroundResponseError("server_error", "the response was interrupted")); err != nil {
+					common.SysError("fail stale background responses failed: " + err.Error())
+				}
+				retention := time.Duration(operation_setting.GetBackgroundResponseSetting().RetentionHours) * time.Hour
+				if retention <= 0 {
+					continue
+				}
+				if _, err := model.DeleteFinishedBackgroundResponses(time.Now().Add(-retention).Unix()); err != nil {
+					common.SysError("delete background responses failed: " + err.Error())
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBackgroundResponseStream(t *testing.T) {
+	stream := "event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\",\"status\":\"in_progress\"}}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"status\":\"completed\",\"usage\":{\"total_tokens\":3}}}\n\n"
+	final, streamErr := parseBackgroundResponseStream([]byte(stream))
+	if streamErr != "" || !strings.Contains(string(final), `"status":"completed"`) || !strings.Contains(string(final), `"total_tokens":3`) {
+		t.Fatalf("unexpected final response %s, error %s", final, streamErr)
+	}
+
+	final, streamErr = parseBackgroundResponseStream([]byte("data: {\"type\":\"response.created\",\"response\":{}}\n\ndata: {\"error\":{\"message\":\"overloaded\",\"type\":\"upstream_error\"}}\n\n"))
+	if final != nil || !strings.Contains(streamErr, "overloaded") {
+		t.Fatalf("expected the stream error, got %s %s", final, streamErr)
+	}
+
+	final, streamErr = parseBackgroundResponseStream([]byte("data: {\"type\":\"error\",\"code\":\"server_error\",\"message\":\"boom\"}\n\n"))
+	if final != nil || !strings.Contains(streamErr, `"code":"server_error"`) {
+		t.Fatalf("expected the error event, got %s %s", final, streamErr)
+	}
+}
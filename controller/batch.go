@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 兼容 OpenAI 的批量接口，创建时校验请求文件，请求由主节点的后台任务异步执行（见 batch_worker.go）
+
+const batchCompletionWindow = "24h"
+
+func optionalTimestamp(timestamp int64) *int64 {
+	if timestamp == 0 {
+		return nil
+	}
+	return &timestamp
+}
+
+func optionalFileId(fileId string) *string {
+	if fileId == "" {
+		return nil
+	}
+	return &fileId
+}
+
+func toOpenAIBatch(batch *model.Batch) dto.OpenAIBatch {
+	result := dto.OpenAIBatch{
+		Id:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalFileId(batch.OutputFileId),
+		ErrorFileId:      optionalFileId(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalTimestamp(batch.InProgressAt),
+		ExpiresAt:        optionalTimestamp(batch.ExpiresAt),
+		FinalizingAt:     optionalTimestamp(batch.FinalizingAt),
+		CompletedAt:      optionalTimestamp(batch.CompletedAt),
+		FailedAt:         optionalTimestamp(batch.FailedAt),
+		ExpiredAt:        optionalTimestamp(batch.ExpiredAt),
+		CancellingAt:     optionalTimestamp(batch.CancellingAt),
+		CancelledAt:      optionalTimestamp(batch.CancelledAt),
+		RequestCounts: dto.BatchRequestCounts{
+			Total:     batch.TotalRequests,
+			Completed: batch.CompletedRequests,
+			Failed:    batch.FailedRequests,
+		},
+	}
+	if batch.Error != "" {
+		var batchErrors []*dto.BatchError
+		if err := common.UnmarshalJsonStr(batch.Error, &batchErrors); err != nil {
+			batchErrors = []*dto.BatchError{{Code: "batch_failed", Message: batch.Error}}
+		}
+		result.Errors = &dto.BatchErrors{Object: "list", Data: batchErrors}
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &result.Metadata)
+	}
+	return result
+}
+
+func getUserBatchOrAbort(c *gin.Context) *model.Batch {
+	batch, err := model.GetUserBatch(c.GetInt("id"), c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		openAIErrorResponse(c, http.StatusNotFound, fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		return nil
+	}
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	return batch
+}
+
+func CreateBatch(c *gin.Context) {
+	setting := operation_setting.GetBatchSetting()
+	if !setting.Enabled {
+		openAIErrorResponse(c, http.StatusNotImplemented, "batch api is not enabled")
+		return
+	}
+	var req dto.CreateBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if _, ok := batchEndpointFormats[req.Endpoint]; !ok {
+		openAIErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("unsupported endpoint: %s", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		openAIErrorResponse(c, http.StatusBadRequest, "completion_window must be "+batchCompletionWindow)
+		return
+	}
+	userId := c.GetInt("id")
+	file, err := model.GetUserFile(userId, req.InputFileId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("No such File object: %s", req.InputFileId))
+		return
+	}
+	if file.Purpose != model.FilePurposeBatch {
+		openAIErrorResponse(c, http.StatusBadRequest, "input file must be uploaded with purpose batch")
+		return
+	}
+	data, err := service.ReadFile(c.Request.Context(), file)
+	if err != nil {
+		logger.LogError(c, "read batch input file failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "read input file failed")
+		return
+	}
+	lines, err := parseBatchLines(data, req.Endpoint)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if setting.MaxRequests > 0 && len(lines) > setting.MaxRequests {
+		openAIErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("input file has %d requests, exceeding the limit of %d", len(lines), setting.MaxRequests))
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          "batch_" + common.GetUUID(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         req.Endpoint,
+		InputFileId:      req.InputFileId,
+		CompletionWindow: req.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		TotalRequests:    len(lines),
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+	}
+	if len(req.Metadata) > 0 {
+		metadata, err := common.Marshal(req.Metadata)
+		if err != nil {
+			openAIErrorResponse(c, http.StatusBadRequest, "invalid metadata")
+			return
+		}
+		batch.Metadata = string(metadata)
+	}
+	if err = batch.Insert(); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	response := dto.OpenAIListResponse[dto.OpenAIBatch]{
+		Object:  "list",
+		Data:    make([]dto.OpenAIBatch, 0, len(batches)),
+		HasMore: hasMore,
+	}
+	for _, batch := range batches {
+		response.Data = append(response.Data, toOpenAIBatch(batch))
+	}
+	if len(batches) > 0 {
+		response.FirstId = batches[0].BatchId
+		response.LastId = batches[len(batches)-1].BatchId
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	ok, err := model.CancelBatch(batch)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok && batch.Status != model.BatchStatusCancelling && batch.Status != model.BatchStatusCancelled {
+		openAIErrorResponse(c, http.StatusConflict, fmt.Sprintf("cannot cancel a batch with status %s", batch.Status))
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
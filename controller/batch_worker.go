@@ -0,0 +1,512 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 批量任务的执行：主节点定时取出未完成的批次，每个批次按分片执行请求，
+// 请求经过与普通请求相同的渠道分发与计费流程，只是在进程内执行，并按批量折扣计费。
+// 每个分片的结果写入对象存储后才推进进度，重启后从未完成的分片继续执行。
+
+var batchEndpointFormats = map[string]types.RelayFormat{
+	"/v1/chat/completions": types.RelayFormatOpenAI,
+	"/v1/completions":      types.RelayFormatOpenAI,
+	"/v1/embeddings":       types.RelayFormatEmbedding,
+	"/v1/responses":        types.RelayFormatOpenAIResponses,
+	"/v1/moderations":      types.RelayFormatOpenAI,
+}
+
+const (
+	batchPollInterval   = 10 * time.Second
+	batchChunkSize      = 100
+	batchRetryBaseDelay = 5 * time.Second
+	batchRetryMaxDelay  = 5 * time.Minute
+)
+
+// parseBatchLines parses the input file of a batch, every line must be a POST request to the batch endpoint.
+func parseBatchLines(data []byte, endpoint string) ([]dto.BatchRequestLine, error) {
+	lines := make([]dto.BatchRequestLine, 0)
+	customIds := make(map[string]struct{})
+	for i, raw := range bytes.Split(data, []byte("\n")) {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+		lineNo := i + 1
+		var line dto.BatchRequestLine
+		if err := common.Unmarshal(raw, &line); err != nil {
+			return nil, fmt.Errorf("line %d: invalid json: %s", lineNo, err.Error())
+		}
+		if line.CustomId == "" {
+			return nil, fmt.Errorf("line %d: custom_id is required", lineNo)
+		}
+		if _, exists := customIds[line.CustomId]; exists {
+			return nil, fmt.Errorf("line %d: duplicate custom_id %s", lineNo, line.CustomId)
+		}
+		customIds[line.CustomId] = struct{}{}
+		if !strings.EqualFold(line.Method, http.MethodPost) {
+			return nil, fmt.Errorf("line %d: method must be POST", lineNo)
+		}
+		if line.Url != endpoint {
+			return nil, fmt.Errorf("line %d: url %s does not match the batch endpoint %s", lineNo, line.Url, endpoint)
+		}
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := common.Unmarshal(line.Body, &body); err != nil {
+			return nil, fmt.Errorf("line %d: body must be a json object", lineNo)
+		}
+		if body.Model == "" {
+			return nil, fmt.Errorf("line %d: body.model is required", lineNo)
+		}
+		if body.Stream {
+			return nil, fmt.Errorf("line %d: streaming is not supported in batches", lineNo)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("input file has no requests")
+	}
+	return lines, nil
+}
+
+// batchJob 一个批次执行时共享的令牌信息与限流暂停状态
+type batchJob struct {
+	batch     *model.Batch
+	token     *model.Token
+	userCache *model.UserBase
+	group     string
+
+	pauseMu    sync.Mutex
+	pauseUntil time.Time
+}
+
+type batchJobContextKey struct{}
+
+// newBatchJob checks the token that created the batch, it is reloaded for every chunk so a disabled or exhausted
+// token stops the batch.
+func newBatchJob(batch *model.Batch) (*batchJob, error) {
+	token, userCache, group, err := loadRelayToken(batch.TokenId)
+	if err != nil {
+		return nil, err
+	}
+	return &batchJob{batch: batch, token: token, userCache: userCache, group: group}, nil
+}
+
+// loadRelayToken checks the token the same way TokenAuth does for requests executed in process, and returns it
+// with its user and the group the requests use.
+func loadRelayToken(tokenId int) (*model.Token, *model.UserBase, string, error) {
+	token, err := model.GetTokenById(tokenId)
+	if err != nil {
+		return nil, nil, "", errors.New("令牌不存在")
+	}
+	if token, err = model.ValidateUserToken(token.Key); err != nil {
+		return nil, nil, "", err
+	}
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if userCache.Status != common.UserStatusEnabled {
+		return nil, nil, "", errors.New("用户已被封禁")
+	}
+	group := userCache.Group
+	if token.Group != "" {
+		if _, ok := service.GetUserUsableGroups(userCache.Group)[token.Group]; !ok {
+			return nil, nil, "", fmt.Errorf("无权访问 %s 分组", token.Group)
+		}
+		if !ratio_setting.ContainsGroupRatio(token.Group) && token.Group != "auto" {
+			return nil, nil, "", fmt.Errorf("分组 %s 已被弃用", token.Group)
+		}
+		group = token.Group
+	}
+	return token, userCache, group, nil
+}
+
+// setupBatchRequest replaces TokenAuth for the requests of a batch, only requests created by the worker carry the job.
+func setupBatchRequest(c *gin.Context) {
+	job, ok := c.Request.Context().Value(batchJobContextKey{}).(*batchJob)
+	if !ok {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	requestId, _ := c.Request.Context().Value(common.RequestIdKey).(string)
+	c.Set(common.RequestIdKey, requestId)
+	job.userCache.WriteContext(c)
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, job.group)
+	_ = middleware.SetupContextForToken(c, job.token)
+	common.SetContextKey(c, constant.ContextKeyBatchId, job.batch.BatchId)
+	c.Next()
+}
+
+var batchRelayEngine = sync.OnceValue(func() *gin.Engine {
+	engine := gin.New()
+	engine.Use(middleware.RelayPanicRecover(), setupBatchRequest, middleware.Distribute())
+	for endpoint, format := range batchEndpointFormats {
+		engine.POST(endpoint, func(c *gin.Context) {
+			Relay(c, format)
+		})
+	}
+	return engine
+})
+
+func (job *batchJob) waitPause() {
+	job.pauseMu.Lock()
+	wait := time.Until(job.pauseUntil)
+	job.pauseMu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// pause holds every request of the batch, an upstream rate limit usually applies to all of them.
+func (job *batchJob) pause(delay time.Duration) {
+	job.pauseMu.Lock()
+	defer job.pauseMu.Unlock()
+	if until := time.Now().Add(delay); until.After(job.pauseUntil) {
+		job.pauseUntil = until
+	}
+}
+
+func batchRetryDelay(header http.Header, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		return min(time.Duration(seconds)*time.Second, batchRetryMaxDelay)
+	}
+	if attempt >= 6 {
+		return batchRetryMaxDelay
+	}
+	return min(batchRetryBaseDelay<<attempt, batchRetryMaxDelay)
+}
+
+func (job *batchJob) do(line dto.BatchRequestLine) (*httptest.ResponseRecorder, string) {
+	requestId := common.GenerateRequestId()
+	ctx := context.WithValue(context.Background(), batchJobContextKey{}, job)
+	ctx = context.WithValue(ctx, common.RequestIdKey, requestId)
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, line.Url, bytes.NewReader(line.Body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	batchRelayEngine().ServeHTTP(w, req)
+	return w, requestId
+}
+
+// executeLine runs one request, retrying with the whole batch paused while it is rate limited.
+func (job *batchJob) executeLine(line dto.BatchRequestLine) *dto.BatchResultLine {
+	maxRetries := operation_setting.GetBatchSetting().MaxRetries
+	var w *httptest.ResponseRecorder
+	var requestId string
+	for attempt := 0; ; attempt++ {
+		job.waitPause()
+		w, requestId = job.do(line)
+		if w.Code != http.StatusTooManyRequests || attempt >= maxRetries {
+			break
+		}
+		job.pause(batchRetryDelay(w.Header(), attempt))
+	}
+	body := w.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = common.Marshal(string(body))
+	}
+	return &dto.BatchResultLine{
+		Id:       "batch_req_" + common.GetUUID(),
+		CustomId: line.CustomId,
+		Response: &dto.BatchResponse{
+			StatusCode: w.Code,
+			RequestId:  requestId,
+			Body:       body,
+		},
+	}
+}
+
+func (job *batchJob) execute(lines []dto.BatchRequestLine) []*dto.BatchResultLine {
+	results := make([]*dto.BatchResultLine, len(lines))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range max(operation_setting.GetBatchSetting().Concurrency, 1) {
+		wg.Add(1)
+		gopool.Go(func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = job.executeLine(lines[i])
+			}
+		})
+	}
+	for i := range lines {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+func marshalBatchResults(results []*dto.BatchResultLine) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, result := range results {
+		data, err := common.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// saveBatchResults stores the results of a chunk and advances the batch past it.
+func saveBatchResults(batch *model.Batch, results []*dto.BatchResultLine, processed int) error {
+	var outputs, failures []*dto.BatchResultLine
+	for _, result := range results {
+		if result.Response != nil && result.Response.StatusCode == http.StatusOK {
+			outputs = append(outputs, result)
+		} else {
+			failures = append(failures, result)
+		}
+	}
+	for kind, lines := range map[string][]*dto.BatchResultLine{"output": outputs, "error": failures} {
+		if len(lines) == 0 {
+			continue
+		}
+		data, err := marshalBatchResults(lines)
+		if err != nil {
+			return err
+		}
+		if err = service.SaveBatchPart(context.Background(), batch.BatchId, kind, batch.Parts, data); err != nil {
+			return err
+		}
+	}
+	batch.Parts++
+	batch.ProcessedRequests += processed
+	batch.CompletedRequests += len(outputs)
+	for _, result := range failures {
+		if result.Response != nil {
+			batch.FailedRequests++
+		}
+	}
+	return batch.UpdateProgress()
+}
+
+// skipBatchLines writes an error line for every request not executed, the requests are not counted as failed.
+func skipBatchLines(batch *model.Batch, lines []dto.BatchRequestLine, code string, message string) error {
+	if batch.ProcessedRequests >= len(lines) {
+		return nil
+	}
+	remaining := lines[batch.ProcessedRequests:]
+	results := make([]*dto.BatchResultLine, 0, len(remaining))
+	for _, line := range remaining {
+		results = append(results, &dto.BatchResultLine{
+			Id:       "batch_req_" + common.GetUUID(),
+			CustomId: line.CustomId,
+			Error:    &dto.BatchError{Code: code, Message: message},
+		})
+	}
+	return saveBatchResults(batch, results, len(remaining))
+}
+
+// finishBatch merges the stored results into the output and error files and moves the batch to its final status.
+func finishBatch(batch *model.Batch, status string, batchErr *dto.BatchError) {
+	ctx := context.Background()
+	now := common.GetTimestamp()
+	if batchErr != nil {
+		data, _ := common.Marshal([]*dto.BatchError{batchErr})
+		batch.Error = string(data)
+	}
+	if batch.Status != model.BatchStatusFinalizing {
+		batch.Status = model.BatchStatusFinalizing
+		batch.FinalizingAt = now
+		if err := batch.Update(); err != nil {
+			common.SysError(fmt.Sprintf("batch %s: update status failed: %s", batch.BatchId, err.Error()))
+		}
+	}
+	for kind, fileId := range map[string]*string{"output": &batch.OutputFileId, "error": &batch.ErrorFileId} {
+		if *fileId != "" {
+			continue
+		}
+		file, err := service.MergeBatchParts(ctx, batch, kind)
+		if err != nil {
+			// 保持 finalizing 状态，下次轮询时重试
+			common.SysError(fmt.Sprintf("batch %s: merge %s file failed: %s", batch.BatchId, kind, err.Error()))
+			return
+		}
+		if file != nil {
+			*fileId = file.FileId
+		}
+	}
+	batch.Status = status
+	switch status {
+	case model.BatchStatusCompleted:
+		batch.CompletedAt = now
+	case model.BatchStatusFailed:
+		batch.FailedAt = now
+	case model.BatchStatusExpired:
+		batch.ExpiredAt = now
+	case model.BatchStatusCancelled:
+		batch.CancelledAt = now
+	}
+	if err := batch.Update(); err != nil {
+		common.SysError(fmt.Sprintf("batch %s: update status failed: %s", batch.BatchId, err.Error()))
+	}
+}
+
+// stopBatch skips the requests not executed yet and finishes the batch with the given status.
+func stopBatch(batch *model.Batch, lines []dto.BatchRequestLine, status string, code string, message string) {
+	if err := skipBatchLines(batch, lines, code, message); err != nil {
+		common.SysError(fmt.Sprintf("batch %s: save skipped requests failed: %s", batch.BatchId, err.Error()))
+		return
+	}
+	var batchErr *dto.BatchError
+	if status == model.BatchStatusFailed {
+		batchErr = &dto.BatchError{Code: code, Message: message}
+	}
+	finishBatch(batch, status, batchErr)
+}
+
+func runBatch(batch *model.Batch) {
+	if batch.Status == model.BatchStatusFinalizing {
+		// 上次合并结果文件失败，只需重新合并
+		status := model.BatchStatusCompleted
+		switch {
+		case batch.CancellingAt != 0:
+			status = model.BatchStatusCancelled
+		case batch.Error != "":
+			status = model.BatchStatusFailed
+		case batch.FinalizingAt > batch.ExpiresAt:
+			status = model.BatchStatusExpired
+		}
+		finishBatch(batch, status, nil)
+		return
+	}
+
+	ctx := context.Background()
+	var lines []dto.BatchRequestLine
+	file, err := model.GetUserFile(batch.UserId, batch.InputFileId)
+	if err == nil {
+		var data []byte
+		if data, err = service.ReadFile(ctx, file); err == nil {
+			lines, err = parseBatchLines(data, batch.Endpoint)
+		}
+	}
+	if err != nil {
+		finishBatch(batch, model.BatchStatusFailed, &dto.BatchError{Code: "invalid_input_file", Message: err.Error()})
+		return
+	}
+
+	if batch.Status == model.BatchStatusValidating {
+		batch.Status = model.BatchStatusInProgress
+		batch.InProgressAt = common.GetTimestamp()
+		if err = batch.Update(); err != nil {
+			common.SysError(fmt.Sprintf("batch %s: update status failed: %s", batch.BatchId, err.Error()))
+			return
+		}
+	}
+
+	for batch.ProcessedRequests < len(lines) {
+		status, err := model.GetBatchStatus(batch.Id)
+		if err != nil {
+			common.SysError(fmt.Sprintf("batch %s: get status failed: %s", batch.BatchId, err.Error()))
+			return
+		}
+		if status == model.BatchStatusCancelling {
+			batch.CancellingAt = common.GetTimestamp()
+			stopBatch(batch, lines, model.BatchStatusCancelled, "batch_cancelled", "This request was not executed because the batch was cancelled.")
+			return
+		}
+		if common.GetTimestamp() > batch.ExpiresAt {
+			stopBatch(batch, lines, model.BatchStatusExpired, "batch_expired", "This request could not be executed before the completion window expired.")
+			return
+		}
+		if !operation_setting.GetBatchSetting().Enabled {
+			// 关闭批量接口后暂停执行，重新开启后继续
+			return
+		}
+		job, err := newBatchJob(batch)
+		if err != nil {
+			stopBatch(batch, lines, model.BatchStatusFailed, "token_unavailable", err.Error())
+			return
+		}
+		end := min(batch.ProcessedRequests+batchChunkSize, len(lines))
+		results := job.execute(lines[batch.ProcessedRequests:end])
+		if err = saveBatchResults(batch, results, len(results)); err != nil {
+			// 分片结果未保存，下次轮询时重新执行该分片
+			common.SysError(fmt.Sprintf("batch %s: save results failed: %s", batch.BatchId, err.Error()))
+			return
+		}
+	}
+	finishBatch(batch, model.BatchStatusCompleted, nil)
+}
+
+var (
+	batchWorkerOnce  sync.Once
+	runningBatchesMu sync.Mutex
+	runningBatches   = make(map[int]struct{})
+)
+
+func dispatchBatches() {
+	setting := operation_setting.GetBatchSetting()
+	if !setting.Enabled {
+		return
+	}
+	runningBatchesMu.Lock()
+	defer runningBatchesMu.Unlock()
+	free := setting.MaxRunningBatches - len(runningBatches)
+	if free <= 0 {
+		return
+	}
+	batches, err := model.GetUnfinishedBatches(free + len(runningBatches))
+	if err != nil {
+		common.SysError("get unfinished batches failed: " + err.Error())
+		return
+	}
+	for _, batch := range batches {
+		if _, running := runningBatches[batch.Id]; running || free <= 0 {
+			continue
+		}
+		free--
+		runningBatches[batch.Id] = struct{}{}
+		gopool.Go(func() {
+			defer func() {
+				runningBatchesMu.Lock()
+				delete(runningBatches, batch.Id)
+				runningBatchesMu.Unlock()
+			}()
+			runBatch(batch)
+		})
+	}
+}
+
+// StartBatchWorker executes the pending batches on the master node.
+func StartBatchWorker() {
+	batchWorkerOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				time.Sleep(batchPollInterval)
+				dispatchBatches()
+			}
+		})
+	})
+}
@@ -18,9 +18,11 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/relay/channel/selfhosted"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -39,9 +41,38 @@ type testResult struct {
 	context     *gin.Context
 	localErr    error
 	newAPIError *types.NewAPIError
+	// responseText 模型回复的文本，用于断言和展示
+	responseText string
 }
 
 func testChannel(channel *model.Channel, testModel string, endpointType string) testResult {
+	return testChannelWithPrompt(channel, testModel, endpointType, "")
+}
+
+// testChannelWithProbe sends the probe request to the channel and fails the test when the reply does not
+// satisfy the assertion of the probe.
+func testChannelWithProbe(channel *model.Channel, probe *dto.ChannelHealthProbe) testResult {
+	if probe == nil {
+		return testChannel(channel, "", "")
+	}
+	result := testChannelWithPrompt(channel, probe.Model, probe.EndpointType, probe.Prompt)
+	if result.localErr != nil || result.newAPIError != nil {
+		return result
+	}
+	if err := service.CheckProbeAssertion(probe.Assertion, result.responseText); err != nil {
+		result.localErr = err
+		result.newAPIError = types.NewError(err, types.ErrorCodeChannelProbeAssertionFailed)
+	}
+	return result
+}
+
+// channelProbe returns the default probe saved on the channel, nil when there is none.
+func channelProbe(channel *model.Channel) *dto.ChannelHealthProbe {
+	return channel.GetOtherSettings().HealthProbe
+}
+
+// testChannelWithPrompt works like testChannel, a non-empty prompt replaces the default test message.
+func testChannelWithPrompt(channel *model.Channel, testModel string, endpointType string, prompt string) testResult {
 	tik := time.Now()
 	var unsupportedTestChannelTypes = []int{
 		constant.ChannelTypeMidjourney,
@@ -201,6 +232,9 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 	}
 
 	request := buildTestRequest(testModel, endpointType, channel)
+	if prompt != "" {
+		applyTestPrompt(request, prompt)
+	}
 
 	info, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
 
@@ -250,7 +284,7 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 	//// 创建一个用于日志的 info 副本，移除 ApiKey
 	//logInfo := info
 	//logInfo.ApiKey = ""
-	common.SysLog(fmt.Sprintf("testing channel %d with model %s , info %+v ", channel.Id, testModel, info.ToString()))
+	logger.LogModuleInfo(c, logger.ModuleChannelTest, "testing channel %d with model %s , info %+v ", channel.Id, testModel, info.ToString())
 
 	priceData, err := helper.ModelPriceHelper(c, info, 0, request.GetTokenCountMeta())
 	if err != nil {
@@ -466,11 +500,24 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 		Other:               other,
 		ResponseBodyPreview: string(respBody),
 	})
-	common.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
+	logger.LogModuleDebug(c, logger.ModuleChannelTest, "testing channel #%d, response: \n%s", channel.Id, string(respBody))
 	return testResult{
-		context:     c,
-		localErr:    nil,
-		newAPIError: nil,
+		context:      c,
+		localErr:     nil,
+		newAPIError:  nil,
+		responseText: service.ProbeResponseText(respBody),
+	}
+}
+
+// applyTestPrompt replaces the user message of chat and responses test requests.
+func applyTestPrompt(request dto.Request, prompt string) {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		r.Messages = []dto.Message{{Role: "user", Content: prompt}}
+	case *dto.OpenAIResponsesRequest:
+		if input, err := common.Marshal([]map[string]string{{"role": "user", "content": prompt}}); err == nil {
+			r.Input = input
+		}
 	}
 }
 
@@ -598,6 +645,16 @@ func buildTestRequest(model string, endpointType string, channel *model.Channel)
 	return testRequest
 }
 
+// channelTestRequest 自定义测试请求，字段为空时依次使用渠道保存的默认测试请求和默认值
+type channelTestRequest struct {
+	Model        string                     `json:"model"`
+	EndpointType string                     `json:"endpoint_type"`
+	Prompt       string                     `json:"prompt"`
+	Assertion    *dto.ChannelProbeAssertion `json:"assertion"`
+	// SaveAsDefault 将本次的测试请求保存为渠道的默认测试请求，健康检查同样使用
+	SaveAsDefault bool `json:"save_as_default"`
+}
+
 func TestChannel(c *gin.Context) {
 	channelId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -617,15 +674,46 @@ func TestChannel(c *gin.Context) {
 	//		go func() { _ = channel.SaveChannelInfo() }()
 	//	}
 	//}()
-	testModel := c.Query("model")
-	endpointType := c.Query("endpoint_type")
+	request := channelTestRequest{
+		Model:        c.Query("model"),
+		EndpointType: c.Query("endpoint_type"),
+	}
+	if c.Request.Method == http.MethodPost {
+		if err = common.DecodeJson(c.Request.Body, &request); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if err = service.ValidateProbeAssertion(request.Assertion); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	probe := &dto.ChannelHealthProbe{}
+	if saved := channelProbe(channel); saved != nil {
+		*probe = *saved
+	}
+	// 本次请求中指定的字段覆盖渠道保存的默认值
+	probe.Model = common.GetStringIfEmpty(strings.TrimSpace(request.Model), probe.Model)
+	probe.EndpointType = common.GetStringIfEmpty(request.EndpointType, probe.EndpointType)
+	probe.Prompt = common.GetStringIfEmpty(request.Prompt, probe.Prompt)
+	if request.Assertion != nil {
+		probe.Assertion = request.Assertion
+	}
+	if request.SaveAsDefault {
+		if err = saveChannelProbe(channelId, probe); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+
 	tik := time.Now()
-	result := testChannel(channel, testModel, endpointType)
+	result := testChannelWithProbe(channel, probe)
 	if result.localErr != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": result.localErr.Error(),
 			"time":    0.0,
+			"content": result.responseText,
 		})
 		return
 	}
@@ -645,9 +733,26 @@ func TestChannel(c *gin.Context) {
 		"success": true,
 		"message": "",
 		"time":    consumedTime,
+		"content": result.responseText,
 	})
 }
 
+// saveChannelProbe stores the probe as the default test request of the channel.
+func saveChannelProbe(channelId int, probe *dto.ChannelHealthProbe) error {
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		return err
+	}
+	otherSettings := channel.GetOtherSettings()
+	otherSettings.HealthProbe = probe
+	channel.SetOtherSettings(otherSettings)
+	if err = channel.Update(); err != nil {
+		return err
+	}
+	model.InitChannelCache()
+	return nil
+}
+
 var testAllChannelsLock sync.Mutex
 var testAllChannelsRunning bool = false
 
@@ -679,7 +784,7 @@ func testAllChannels(notify bool) error {
 		for _, channel := range channels {
 			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
 			tik := time.Now()
-			result := testChannel(channel, "", "")
+			result := testChannelWithProbe(channel, channelProbe(channel))
 			tok := time.Now()
 			milliseconds := tok.Sub(tik).Milliseconds()
 
@@ -707,9 +812,16 @@ func testAllChannels(notify bool) error {
 			// enable channel
 			if !isChannelEnabled && service.ShouldEnableChannel(newAPIError, channel.Status) {
 				service.EnableChannel(channel.Id, common.GetContextKeyString(result.context, constant.ContextKeyChannelKey), channel.Name)
+				warmUpChannels(channel.Id)
 			}
 
 			channel.UpdateResponseTime(milliseconds)
+
+			if selfhosted.IsSelfHostedChannel(channel.Type) && channel.GetOtherSettings().AutoSyncServerInfo {
+				if _, err := syncChannelServerInfo(channel, false); err != nil {
+					common.SysError(fmt.Sprintf("failed to sync server info for channel #%d: %s", channel.Id, err.Error()))
+				}
+			}
 			time.Sleep(common.RequestInterval)
 		}
 
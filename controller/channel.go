@@ -13,8 +13,10 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
+	relaychannel "github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/gemini"
 	"github.com/QuantumNous/new-api/relay/channel/ollama"
+	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
@@ -65,6 +67,36 @@ func clearChannelInfo(channel *model.Channel) {
 		channel.ChannelInfo.MultiKeyDisabledReason = nil
 		channel.ChannelInfo.MultiKeyDisabledTime = nil
 	}
+	maskChannelSecrets(channel)
+}
+
+// maskChannelSecrets hides the TLS client key in the settings returned to the frontend, like the key of the channel.
+func maskChannelSecrets(channel *model.Channel) {
+	if channel.Setting == nil || *channel.Setting == "" {
+		return
+	}
+	var setting dto.ChannelSettings
+	if err := common.UnmarshalJsonStr(*channel.Setting, &setting); err != nil || setting.TLSClientKey == "" {
+		return
+	}
+	setting.TLSClientKey = dto.ChannelSecretMask
+	channel.SetSetting(setting)
+}
+
+// restoreChannelSecrets keeps the saved TLS client key when the client sends back the placeholder it received.
+func restoreChannelSecrets(channel *model.Channel, origin *model.Channel) {
+	if channel.Setting == nil || *channel.Setting == "" {
+		return
+	}
+	var setting dto.ChannelSettings
+	if err := common.UnmarshalJsonStr(*channel.Setting, &setting); err != nil || setting.TLSClientKey != dto.ChannelSecretMask {
+		return
+	}
+	setting.TLSClientKey = ""
+	if origin != nil {
+		setting.TLSClientKey = origin.GetSetting().TLSClientKey
+	}
+	channel.SetSetting(setting)
 }
 
 func GetAllChannels(c *gin.Context) {
@@ -141,8 +173,10 @@ func GetAllChannels(c *gin.Context) {
 		}
 	}
 
+	channelIds := make([]int, 0, len(channelData))
 	for _, datum := range channelData {
 		clearChannelInfo(datum)
+		channelIds = append(channelIds, datum.Id)
 	}
 
 	countQuery := model.DB.Model(&model.Channel{})
@@ -166,6 +200,8 @@ func GetAllChannels(c *gin.Context) {
 		"page":        pageInfo.GetPage(),
 		"page_size":   pageInfo.GetPageSize(),
 		"type_counts": typeCounts,
+		// 熔断器状态，只包含当前节点有统计的渠道
+		"circuit_breakers": service.GetChannelCircuitBreakers(channelIds),
 	})
 	return
 }
@@ -207,7 +243,7 @@ func FetchUpstreamModels(c *gin.Context) {
 		return
 	}
 
-	baseURL := constant.ChannelBaseURLs[channel.Type]
+	baseURL := constant.GetChannelBaseURL(channel.Type)
 	if channel.GetBaseURL() != "" {
 		baseURL = channel.GetBaseURL()
 	}
@@ -479,17 +515,20 @@ func SearchChannels(c *gin.Context) {
 
 	pagedData := channelData[startIdx:endIdx]
 
+	channelIds := make([]int, 0, len(pagedData))
 	for _, datum := range pagedData {
 		clearChannelInfo(datum)
+		channelIds = append(channelIds, datum.Id)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 		"data": gin.H{
-			"items":       pagedData,
-			"total":       total,
-			"type_counts": typeCounts,
+			"items":            pagedData,
+			"total":            total,
+			"type_counts":      typeCounts,
+			"circuit_breakers": service.GetChannelCircuitBreakers(channelIds),
 		},
 	})
 	return
@@ -575,6 +614,9 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 	if err := channel.ValidateSettings(); err != nil {
 		return fmt.Errorf("渠道额外设置[channel setting] 格式错误：%s", err.Error())
 	}
+	if err := service.ValidateChannelEgress(channel.GetSetting()); err != nil {
+		return fmt.Errorf("渠道出口设置错误：%s", err.Error())
+	}
 
 	// 如果是添加操作，检查 channel 和 key 是否为空
 	if isAdd {
@@ -590,6 +632,28 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 		}
 	}
 
+	// 第三方适配器按其声明的配置项校验
+	if channel.OtherSettings != "" {
+		var otherSettings dto.ChannelOtherSettings
+		if err := common.UnmarshalJsonStr(channel.OtherSettings, &otherSettings); err != nil {
+			return fmt.Errorf("渠道其他设置[settings] 格式错误：%s", err.Error())
+		}
+		if err := relaychannel.ValidateAdaptorConfig(channel.Type, otherSettings.AdaptorConfig); err != nil {
+			return fmt.Errorf("渠道适配器配置错误：%s", err.Error())
+		}
+		if err := helper.ValidateStreamTransformers(otherSettings.StreamTransformers); err != nil {
+			return err
+		}
+		if otherSettings.HealthProbe != nil {
+			if err := service.ValidateProbeAssertion(otherSettings.HealthProbe.Assertion); err != nil {
+				return fmt.Errorf("渠道测试断言错误：%s", err.Error())
+			}
+		}
+		if err := service.ValidateErrorRewriteRules(otherSettings.ErrorRewriteRules); err != nil {
+			return fmt.Errorf("错误消息改写规则错误：%s", err.Error())
+		}
+	}
+
 	// VertexAI 特殊校验
 	if channel.Type == constant.ChannelTypeVertexAi {
 		if channel.Other == "" {
@@ -791,7 +855,17 @@ func AddChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	for i := range channels {
+		service.RecordAudit(c, "channel.create", service.AuditTargetChannel, channels[i].Id, nil, &channels[i])
+	}
 	service.ResetProxyClientCache()
+	if addChannelRequest.Channel.GetOtherSettings().WarmUpEnabled {
+		channelIds := make([]int, 0, len(channels))
+		for _, channel := range channels {
+			channelIds = append(channelIds, channel.Id)
+		}
+		warmUpChannels(channelIds...)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -799,18 +873,58 @@ func AddChannel(c *gin.Context) {
 	return
 }
 
+// GetChannelDependencies 删除渠道前查看引用了该渠道的配置
+func GetChannelDependencies(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	deps, err := service.FindChannelDependencies(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, deps)
+}
+
+// DeleteChannel 存在依赖时默认拒绝删除并返回依赖列表，cascade=true 时移除配置中的引用后再删除
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	cascade, _ := strconv.ParseBool(c.Query("cascade"))
+	var deps []service.ChannelDependency
+	var err error
+	if cascade {
+		deps, err = service.RemoveChannelDependencies(id)
+	} else {
+		deps, err = service.FindChannelDependencies(id)
+		if err == nil && len(deps) > 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("渠道被 %d 项配置或任务引用，请确认后级联删除", len(deps)),
+				"data":    deps,
+			})
+			return
+		}
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	origin, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
-	err := channel.Delete()
+	err = channel.Delete()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, "channel.delete", service.AuditTargetChannel, id, origin, nil)
+	_ = model.DeleteChannelHealth(id)
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    deps,
 	})
 	return
 }
@@ -821,6 +935,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, "channel.delete_disabled", service.AuditTargetChannel, "", nil, gin.H{"deleted": rows})
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -881,6 +996,13 @@ func EnableTagChannels(c *gin.Context) {
 		return
 	}
 	model.InitChannelCache()
+	if channels, err := model.GetChannelsByTag(channelTag.Tag, false, false); err == nil {
+		channelIds := make([]int, 0, len(channels))
+		for _, channel := range channels {
+			channelIds = append(channelIds, channel.Id)
+		}
+		warmUpChannels(channelIds...)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -955,11 +1077,20 @@ func DeleteChannelBatch(c *gin.Context) {
 		})
 		return
 	}
+	origins := make([]*model.Channel, 0, len(channelBatch.Ids))
+	for _, id := range channelBatch.Ids {
+		if origin, err := model.GetChannelById(id, true); err == nil {
+			origins = append(origins, origin)
+		}
+	}
 	err = model.BatchDeleteChannels(channelBatch.Ids)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	for _, origin := range origins {
+		service.RecordAudit(c, "channel.delete", service.AuditTargetChannel, origin.Id, origin, nil)
+	}
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -983,17 +1114,19 @@ func UpdateChannel(c *gin.Context) {
 		return
 	}
 
-	// 使用统一的校验函数
-	if err := validateChannel(&channel.Channel, false); err != nil {
+	// Preserve existing ChannelInfo to ensure multi-key channels keep correct state even if the client does not send ChannelInfo in the request.
+	originChannel, err := model.GetChannelById(channel.Id, true)
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
 		})
 		return
 	}
-	// Preserve existing ChannelInfo to ensure multi-key channels keep correct state even if the client does not send ChannelInfo in the request.
-	originChannel, err := model.GetChannelById(channel.Id, true)
-	if err != nil {
+	restoreChannelSecrets(&channel.Channel, originChannel)
+
+	// 使用统一的校验函数
+	if err := validateChannel(&channel.Channel, false); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
@@ -1094,8 +1227,14 @@ func UpdateChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if updated, err := model.GetChannelById(channel.Id, true); err == nil {
+		service.RecordAudit(c, "channel.update", service.AuditTargetChannel, channel.Id, originChannel, updated)
+	}
 	model.InitChannelCache()
 	service.ResetProxyClientCache()
+	if originChannel.Status != common.ChannelStatusEnabled && channel.Status == common.ChannelStatusEnabled {
+		warmUpChannels(channel.Id)
+	}
 	channel.Key = ""
 	clearChannelInfo(&channel.Channel)
 	c.JSON(http.StatusOK, gin.H{
@@ -1123,7 +1262,7 @@ func FetchModels(c *gin.Context) {
 
 	baseURL := req.BaseURL
 	if baseURL == "" {
-		baseURL = constant.ChannelBaseURLs[req.Type]
+		baseURL = constant.GetChannelBaseURL(req.Type)
 	}
 
 	// remove line breaks and extra spaces.
@@ -1873,7 +2012,7 @@ func OllamaPullModel(c *gin.Context) {
 		return
 	}
 
-	baseURL := constant.ChannelBaseURLs[channel.Type]
+	baseURL := constant.GetChannelBaseURL(channel.Type)
 	if channel.GetBaseURL() != "" {
 		baseURL = channel.GetBaseURL()
 	}
@@ -1936,7 +2075,7 @@ func OllamaPullModelStream(c *gin.Context) {
 		return
 	}
 
-	baseURL := constant.ChannelBaseURLs[channel.Type]
+	baseURL := constant.GetChannelBaseURL(channel.Type)
 	if channel.GetBaseURL() != "" {
 		baseURL = channel.GetBaseURL()
 	}
@@ -2018,7 +2157,7 @@ func OllamaDeleteModel(c *gin.Context) {
 		return
 	}
 
-	baseURL := constant.ChannelBaseURLs[channel.Type]
+	baseURL := constant.GetChannelBaseURL(channel.Type)
 	if channel.GetBaseURL() != "" {
 		baseURL = channel.GetBaseURL()
 	}
@@ -2067,7 +2206,7 @@ func OllamaVersion(c *gin.Context) {
 		return
 	}
 
-	baseURL := constant.ChannelBaseURLs[channel.Type]
+	baseURL := constant.GetChannelBaseURL(channel.Type)
 	if channel.GetBaseURL() != "" {
 		baseURL = channel.GetBaseURL()
 	}
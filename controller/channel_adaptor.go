@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	relaychannel "github.com/QuantumNous/new-api/relay/channel"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelAdaptors lists the third-party adaptors compiled into this build, the channel form
+// uses them to offer the plugin channel types and render their config fields.
+func GetChannelAdaptors(c *gin.Context) {
+	adaptors := make([]relaychannel.AdaptorMeta, 0)
+	for _, meta := range relaychannel.RegisteredAdaptors() {
+		if !meta.Builtin {
+			adaptors = append(adaptors, meta)
+		}
+	}
+	common.ApiSuccess(c, adaptors)
+}
@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserChannelRequest 用户自有渠道（BYOK）可以设置的字段，其余字段使用默认值
+type UserChannelRequest struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	Type         int    `json:"type"`
+	Key          string `json:"key"`
+	BaseURL      string `json:"base_url"`
+	Models       string `json:"models"`
+	ModelMapping string `json:"model_mapping"`
+	Other        string `json:"other"`
+	Priority     *int64 `json:"priority"`
+	Status       int    `json:"status"`
+}
+
+func checkByokEnabled() error {
+	if !operation_setting.GetByokSetting().Enabled {
+		return errors.New("管理员未开启自有渠道功能")
+	}
+	return nil
+}
+
+// validateUserChannel checks the fields a user may set, isAdd requires the key and models.
+func validateUserChannel(req *UserChannelRequest, isAdd bool) error {
+	setting := operation_setting.GetByokSetting()
+	if isAdd || req.Type != 0 {
+		if !setting.IsChannelTypeAllowed(req.Type) {
+			return fmt.Errorf("不支持的渠道类型: %d", req.Type)
+		}
+	}
+	if isAdd {
+		if strings.TrimSpace(req.Key) == "" {
+			return errors.New("密钥不能为空")
+		}
+		if strings.TrimSpace(req.Models) == "" {
+			return errors.New("模型不能为空")
+		}
+	}
+	for _, m := range strings.Split(req.Models, ",") {
+		if len(m) > 255 {
+			return fmt.Errorf("模型名称过长: %s", m)
+		}
+	}
+	if req.ModelMapping != "" {
+		if _, err := common.StrToMap(req.ModelMapping); err != nil {
+			return errors.New("模型映射必须是合法的 JSON 格式")
+		}
+	}
+	if req.Status != 0 && req.Status != common.ChannelStatusEnabled && req.Status != common.ChannelStatusManuallyDisabled {
+		return errors.New("无效的渠道状态")
+	}
+	// 自定义的上游地址由服务端发起请求，需要经过 SSRF 防护
+	if req.BaseURL != "" {
+		fetchSetting := system_setting.GetFetchSetting()
+		if err := common.ValidateURLWithFetchSetting(req.BaseURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+			return fmt.Errorf("上游地址不可用: %v", err)
+		}
+	}
+	return nil
+}
+
+// verifyUserChannel sends a test request with the first model of the channel when validation on save is enabled.
+func verifyUserChannel(channel *model.Channel) error {
+	if !operation_setting.GetByokSetting().ValidateOnSave {
+		return nil
+	}
+	result := testChannel(channel, "", "")
+	if result.localErr != nil {
+		return fmt.Errorf("渠道测试失败: %s", result.localErr.Error())
+	}
+	if result.newAPIError != nil {
+		return fmt.Errorf("渠道测试失败: %s", result.newAPIError.Error())
+	}
+	return nil
+}
+
+// GetUserChannels 当前用户的自有渠道，不返回密钥
+func GetUserChannels(c *gin.Context) {
+	channels, err := model.GetUserChannels(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, channels)
+}
+
+func AddUserChannel(c *gin.Context) {
+	if err := checkByokEnabled(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req := UserChannelRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateUserChannel(&req, true); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	userId := c.GetInt("id")
+	if limit := operation_setting.GetByokSetting().MaxChannelsPerUser; limit > 0 {
+		count, err := model.CountUserChannels(userId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if count >= int64(limit) {
+			common.ApiErrorMsg(c, fmt.Sprintf("最多只能添加 %d 个自有渠道", limit))
+			return
+		}
+	}
+
+	channel := &model.Channel{
+		Name:        req.Name,
+		Type:        req.Type,
+		Key:         strings.TrimSpace(req.Key),
+		BaseURL:     &req.BaseURL,
+		Models:      req.Models,
+		Other:       req.Other,
+		Priority:    req.Priority,
+		Status:      common.ChannelStatusEnabled,
+		OwnerUserId: userId,
+		CreatedTime: common.GetTimestamp(),
+	}
+	if req.ModelMapping != "" {
+		channel.ModelMapping = &req.ModelMapping
+	}
+	if err := verifyUserChannel(channel); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := channel.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.InitChannelCache()
+	channel.Key = ""
+	common.ApiSuccess(c, channel)
+}
+
+func UpdateUserChannel(c *gin.Context) {
+	if err := checkByokEnabled(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req := UserChannelRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateUserChannel(&req, false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetUserChannelById(req.Id, c.GetInt("id"), true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	needVerify := false
+	if req.Name != "" {
+		channel.Name = req.Name
+	}
+	if req.Type != 0 && req.Type != channel.Type {
+		channel.Type = req.Type
+		needVerify = true
+	}
+	if key := strings.TrimSpace(req.Key); key != "" {
+		channel.Key = key
+		needVerify = true
+	}
+	if req.BaseURL != "" && req.BaseURL != channel.GetBaseURL() {
+		channel.BaseURL = &req.BaseURL
+		needVerify = true
+	}
+	if req.Models != "" && req.Models != channel.Models {
+		channel.Models = req.Models
+		needVerify = true
+	}
+	if req.ModelMapping != "" {
+		channel.ModelMapping = &req.ModelMapping
+	}
+	if req.Other != "" {
+		channel.Other = req.Other
+	}
+	if req.Priority != nil {
+		channel.Priority = req.Priority
+	}
+	if req.Status != 0 {
+		channel.Status = req.Status
+	}
+	if needVerify {
+		if err := verifyUserChannel(channel); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if err := channel.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.InitChannelCache()
+	channel.Key = ""
+	common.ApiSuccess(c, channel)
+}
+
+func DeleteUserChannel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetUserChannelById(id, c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := channel.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.InitChannelCache()
+	common.ApiSuccess(c, nil)
+}
+
+// TestUserChannel 用渠道的第一个模型或指定模型测试自有渠道
+func TestUserChannel(c *gin.Context) {
+	if err := checkByokEnabled(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetUserChannelById(id, c.GetInt("id"), true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	result := testChannel(channel, c.Query("model"), "")
+	if result.localErr != nil {
+		common.ApiError(c, result.localErr)
+		return
+	}
+	if result.newAPIError != nil {
+		common.ApiErrorMsg(c, result.newAPIError.Error())
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
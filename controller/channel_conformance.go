@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/conformance"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runConformanceCase sends the canonical request of the case through the adaptor of the channel type against
+// a server replaying the recorded upstream response, no request leaves the process and nothing is billed.
+func runConformanceCase(channelType int, apiType int, dialect string, tc conformance.Case) error {
+	fixture, err := conformance.LoadFixture(dialect, tc)
+	if err != nil {
+		return fmt.Errorf("fixture not found: %w", err)
+	}
+	server := conformance.NewReplayServer(fixture, tc.Stream)
+	defer server.Close()
+
+	modelName := conformance.DialectModel(dialect)
+	request, err := tc.Request(modelName)
+	if err != nil {
+		return err
+	}
+	requestBody, err := common.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(requestBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, modelName)
+	common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
+
+	baseURL := server.URL
+	channel := &model.Channel{
+		Type:    channelType,
+		Name:    "conformance",
+		Key:     "sk-conformance",
+		BaseURL: &baseURL,
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(c, channel, modelName); apiErr != nil {
+		return apiErr
+	}
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatOpenAI, request, nil)
+	if err != nil {
+		return err
+	}
+	info.IsChannelTest = true
+	info.InitChannelMeta(c)
+	if err = helper.ModelMappedHelper(c, info, request); err != nil {
+		return err
+	}
+
+	adaptor := relay.GetAdaptor(apiType)
+	if adaptor == nil {
+		return fmt.Errorf("invalid api type: %d, adaptor is nil", apiType)
+	}
+	adaptor.Init(info)
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
+	if err != nil {
+		return fmt.Errorf("convert request: %w", err)
+	}
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return err
+	}
+	resp, err := adaptor.DoRequest(c, info, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	httpResp, ok := resp.(*http.Response)
+	if !ok {
+		return errors.New("adaptor returned no http response")
+	}
+	if err = tc.CheckUpstream(dialect, server.Request()); err != nil {
+		return fmt.Errorf("upstream request: %w", err)
+	}
+	if _, apiErr := adaptor.DoResponse(c, httpResp, info); apiErr != nil {
+		return fmt.Errorf("do response: %w", apiErr)
+	}
+	if err = tc.CheckResponse(w.Body.Bytes()); err != nil {
+		return fmt.Errorf("response: %w", err)
+	}
+	return nil
+}
+
+func runConformanceMatrix(channelTypes []int) []conformance.MatrixRow {
+	rows := make([]conformance.MatrixRow, 0, len(channelTypes))
+	for _, channelType := range channelTypes {
+		row := conformance.MatrixRow{
+			ChannelType:     channelType,
+			ChannelTypeName: constant.GetChannelTypeName(channelType),
+			Results:         make([]conformance.CaseResult, 0, len(conformance.Cases)),
+		}
+		apiType, _ := common.ChannelType2APIType(channelType)
+		dialect, ok := conformance.DialectOf(apiType)
+		row.Dialect = dialect
+		for _, tc := range conformance.Cases {
+			result := conformance.CaseResult{Case: tc.Name, Status: conformance.StatusSkip}
+			if !ok {
+				result.Message = "no recorded fixtures for this channel type"
+				row.Results = append(row.Results, result)
+				continue
+			}
+			start := time.Now()
+			err := runConformanceCase(channelType, apiType, dialect, tc)
+			result.DurationMs = time.Since(start).Milliseconds()
+			if err != nil {
+				result.Status = conformance.StatusFail
+				result.Message = err.Error()
+			} else {
+				result.Status = conformance.StatusPass
+			}
+			row.Results = append(row.Results, result)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// GetChannelConformance runs the conformance cases for the configured channel types, or the types given in
+// the types query parameter, and returns the result matrix.
+func GetChannelConformance(c *gin.Context) {
+	var channelTypes []int
+	if value := c.Query("types"); value != "" {
+		for _, item := range strings.Split(value, ",") {
+			channelType, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				common.ApiErrorMsg(c, "invalid channel type: "+item)
+				return
+			}
+			channelTypes = append(channelTypes, channelType)
+		}
+	} else {
+		var err error
+		channelTypes, err = model.GetChannelTypes()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	rows := runConformanceMatrix(channelTypes)
+	failed := 0
+	for _, row := range rows {
+		for _, result := range row.Results {
+			if result.Status == conformance.StatusFail {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		common.SysLog(fmt.Sprintf("channel conformance: %d cases failed", failed))
+	}
+	common.ApiSuccess(c, gin.H{
+		"version": common.Version,
+		"cases":   conformance.CaseNames(),
+		"rows":    rows,
+		"failed":  failed,
+	})
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var channelHealthOnce sync.Once
+
+// StartChannelHealthProber periodically probes every channel not disabled by hand and records the results.
+func StartChannelHealthProber() {
+	// 只在Master节点检查渠道，结果通过数据库同步到其他节点
+	if !common.IsMasterNode {
+		return
+	}
+	channelHealthOnce.Do(func() {
+		go func() {
+			for {
+				setting := operation_setting.GetChannelHealthSetting()
+				if !setting.Enabled {
+					time.Sleep(1 * time.Minute)
+					continue
+				}
+				probeAllChannels()
+				time.Sleep(setting.Interval())
+			}
+		}()
+	})
+}
+
+func probeAllChannels() {
+	channels, err := model.GetAllChannels(0, 0, true, false)
+	if err != nil {
+		common.SysError("failed to get channels for health check: " + err.Error())
+		return
+	}
+	for _, channel := range channels {
+		if channel.Status == common.ChannelStatusManuallyDisabled {
+			continue
+		}
+		if _, err := probeChannelHealth(channel); err != nil {
+			common.SysError(fmt.Sprintf("failed to save health of channel #%d: %s", channel.Id, err.Error()))
+		}
+		time.Sleep(common.RequestInterval)
+	}
+}
+
+// probeChannelHealth sends the health check request to the channel, disabling it when it becomes unhealthy and
+// enabling it again after it recovers.
+func probeChannelHealth(channel *model.Channel) (*model.ChannelHealth, error) {
+	setting := operation_setting.GetChannelHealthSetting()
+	// 渠道保存了默认测试请求时优先使用，否则使用全局设置
+	probe := channelProbe(channel)
+	if probe == nil {
+		probe = &dto.ChannelHealthProbe{Model: setting.Model, Prompt: setting.Prompt}
+	}
+	tik := time.Now()
+	result := testChannelWithProbe(channel, probe)
+	milliseconds := time.Since(tik).Milliseconds()
+
+	var probeErr error
+	if result.newAPIError != nil {
+		probeErr = result.newAPIError
+	} else if result.localErr != nil {
+		probeErr = result.localErr
+	}
+	health, transition, err := service.RecordChannelProbe(channel.Id, milliseconds, probeErr)
+	if err != nil {
+		return nil, err
+	}
+	usingKey := common.GetContextKeyString(result.context, constant.ContextKeyChannelKey)
+	switch transition {
+	case service.ChannelHealthBecameUnhealthy:
+		common.SysLog(fmt.Sprintf("channel #%d failed %d health checks in a row, marked unhealthy", channel.Id, health.ConsecutiveFailures))
+		if setting.AutoDisable && channel.Status == common.ChannelStatusEnabled && channel.GetAutoBan() {
+			channelError := types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, usingKey, channel.GetAutoBan())
+			service.DisableChannel(*channelError, "健康检查连续失败："+health.LastError)
+		}
+	case service.ChannelHealthRecovered:
+		common.SysLog(fmt.Sprintf("channel #%d passed %d health checks in a row, marked healthy", channel.Id, health.ConsecutiveSuccesses))
+		if setting.AutoEnable && channel.Status == common.ChannelStatusAutoDisabled {
+			service.EnableChannel(channel.Id, usingKey, channel.Name)
+			warmUpChannels(channel.Id)
+		}
+	}
+	channel.UpdateResponseTime(milliseconds)
+	return health, nil
+}
+
+func GetAllChannelHealth(c *gin.Context) {
+	healths, err := model.GetAllChannelHealth()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"setting":  operation_setting.GetChannelHealthSetting(),
+		"channels": healths,
+	})
+}
+
+func GetChannelHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	health, err := model.GetChannelHealth(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, health)
+}
+
+// ProbeChannelHealth runs a health check on the channel right away.
+func ProbeChannelHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.CacheGetChannel(id)
+	if err != nil {
+		channel, err = model.GetChannelById(id, true)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	health, err := probeChannelHealth(channel)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, health)
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestDefaultsPrecedence 参数取值的优先级，从高到低，随预览结果返回
+var requestDefaultsPrecedence = []string{
+	"channel param override",
+	"client request",
+	"group request defaults",
+	"all groups (*) request defaults",
+}
+
+type channelPreviewRequest struct {
+	// Path 客户端请求的路径，默认 /v1/chat/completions
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+	// Group 按该分组的默认参数预览，默认为当前用户的分组
+	Group string `json:"group"`
+}
+
+// previewRelayFormat returns the relay format of the client request path, the paths whose requests are sent
+// as json bodies are supported.
+func previewRelayFormat(path string) (types.RelayFormat, bool) {
+	switch path {
+	case "/v1/chat/completions", "/v1/completions":
+		return types.RelayFormatOpenAI, true
+	case "/v1/messages":
+		return types.RelayFormatClaude, true
+	case "/v1/responses":
+		return types.RelayFormatOpenAIResponses, true
+	case "/v1/responses/compact":
+		return types.RelayFormatOpenAIResponsesCompaction, true
+	case "/v1/embeddings":
+		return types.RelayFormatEmbedding, true
+	case "/v1/images/generations":
+		return types.RelayFormatOpenAIImage, true
+	case "/v1/rerank":
+		return types.RelayFormatRerank, true
+	}
+	if strings.HasPrefix(path, "/v1beta/models/") || strings.HasPrefix(path, "/v1/models/") {
+		return types.RelayFormatGemini, true
+	}
+	return "", false
+}
+
+// previewModelName 模型名取自请求体，Gemini 格式的请求取自路径
+func previewModelName(path string, body []byte) string {
+	if _, rest, ok := strings.Cut(path, "/models/"); ok {
+		name, _, _ := strings.Cut(rest, ":")
+		return name
+	}
+	var request struct {
+		Model string `json:"model"`
+	}
+	_ = common.Unmarshal(body, &request)
+	return request.Model
+}
+
+// newChannelRelayContext builds the context of a relay of the client request through the channel, the relay
+// runs as the current user and its response is written to the returned recorder.
+func newChannelRelayContext(c *gin.Context, channel *model.Channel, relayFormat types.RelayFormat, path string, modelName string,
+	headers map[string]string, body []byte) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo, error) {
+	w := httptest.NewRecorder()
+	tc, _ := gin.CreateTestContext(w)
+	tc.Request = httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	for name, value := range headers {
+		tc.Request.Header.Set(name, value)
+	}
+	tc.Request.Header.Set("Content-Type", "application/json")
+	userCache, err := model.GetUserCache(c.GetInt("id"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	userCache.WriteContext(tc)
+	tc.Set("group", userCache.Group)
+	common.SetContextKey(tc, constant.ContextKeyOriginalModel, modelName)
+	common.SetContextKey(tc, constant.ContextKeyRequestStartTime, time.Now())
+	if apiErr := middleware.SetupContextForSelectedChannel(tc, channel, modelName); apiErr != nil {
+		return nil, nil, nil, apiErr
+	}
+	request, err := helper.GetAndValidateRequest(tc, relayFormat)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info, err := relaycommon.GenRelayInfo(tc, relayFormat, request, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tc, w, info, nil
+}
+
+// PreviewChannelRequest runs a sample client request through the relay of the channel up to the point where
+// the upstream request is sent, and returns the upstream requests the adaptor built instead of sending them.
+// Nothing is billed and the channel status is not affected; credentials in the url, headers and body are masked.
+func PreviewChannelRequest(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req channelPreviewRequest
+	if err = common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Path == "" {
+		req.Path = "/v1/chat/completions"
+	}
+	relayFormat, ok := previewRelayFormat(req.Path)
+	if !ok {
+		common.ApiErrorMsg(c, "不支持预览该路径的请求: "+req.Path)
+		return
+	}
+	modelName := previewModelName(req.Path, req.Body)
+	if modelName == "" {
+		common.ApiErrorMsg(c, "请求中缺少模型名称")
+		return
+	}
+
+	tc, _, info, err := newChannelRelayContext(c, channel, relayFormat, req.Path, modelName, req.Headers, req.Body)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 按渠道测试处理，不受熔断影响也不计入渠道统计
+	info.IsChannelTest = true
+	info.DryRun = relaycommon.NewDryRunRecorder()
+	info.UsingGroup = tc.GetString("group")
+	if req.Group != "" {
+		info.UsingGroup = req.Group
+	}
+	apiErr := relayByFormat(tc, relayFormat, info)
+
+	requests := info.DryRun.Requests()
+	if len(requests) == 0 {
+		if apiErr != nil {
+			common.ApiError(c, apiErr)
+		} else {
+			common.ApiError(c, errors.New("the relay finished without building an upstream request"))
+		}
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"channel_id":          channel.Id,
+		"model":               info.OriginModelName,
+		"upstream_model":      info.UpstreamModelName,
+		"request_conversions": info.RequestConversionChain,
+		"request_defaults": gin.H{
+			"group":      info.UsingGroup,
+			"applied":    info.AppliedRequestDefaults,
+			"precedence": requestDefaultsPrecedence,
+		},
+		"requests": requests,
+	})
+}
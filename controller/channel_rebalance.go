@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelRebalanceAdjustments lists the channel weight adjustments, optionally filtered by the status query parameter.
+func GetChannelRebalanceAdjustments(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	adjustments, total, err := model.GetChannelRebalanceAdjustments(c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(adjustments)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RunChannelRebalance runs the optimizer once right away, with the same approval mode as the scheduled runs.
+func RunChannelRebalance(c *gin.Context) {
+	adjustments, err := service.RunChannelRebalance()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, adjustments)
+}
+
+func ApproveChannelRebalanceAdjustment(c *gin.Context) {
+	decideChannelRebalanceAdjustment(c, true)
+}
+
+func RejectChannelRebalanceAdjustment(c *gin.Context) {
+	decideChannelRebalanceAdjustment(c, false)
+}
+
+func decideChannelRebalanceAdjustment(c *gin.Context, approve bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	adjustment, err := model.DecideChannelRebalanceAdjustment(id, approve, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if approve {
+		model.InitChannelCache()
+	}
+	common.ApiSuccess(c, adjustment)
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateChannelRoutingRequest struct {
+	Group string `json:"group"`
+	// Strategy 为空时分组恢复使用默认策略
+	Strategy string `json:"strategy"`
+}
+
+// GetChannelRouting returns the routing strategies with the load statistics of the channels.
+func GetChannelRouting(c *gin.Context) {
+	setting := operation_setting.GetRoutingSetting()
+	groupStrategies := make(map[string]string, len(setting.GroupStrategies))
+	for group, strategy := range setting.GroupStrategies {
+		if strategy != "" {
+			groupStrategies[group] = strategy
+		}
+	}
+	common.ApiSuccess(c, gin.H{
+		"strategy":             setting.Strategy,
+		"group_strategies":     groupStrategies,
+		"stats_window_minutes": setting.StatsWindowMinutes,
+		"channel_stats":        service.GetChannelLoadStats(),
+	})
+}
+
+// UpdateChannelRouting sets the routing strategy of a group, or the default strategy when the group is empty.
+func UpdateChannelRouting(c *gin.Context) {
+	var req UpdateChannelRoutingRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.Strategy != "" && !operation_setting.IsValidRoutingStrategy(req.Strategy) {
+		common.ApiErrorMsg(c, fmt.Sprintf("未知的渠道选择策略: %s", req.Strategy))
+		return
+	}
+	if req.Group == "" {
+		if req.Strategy == "" {
+			common.ApiErrorMsg(c, "默认策略不能为空")
+			return
+		}
+		if err := model.UpdateOption("routing_setting.strategy", req.Strategy); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	} else {
+		// 写入全部分组，空值会覆盖旧配置，否则配置合并时无法清除分组策略
+		strategies := make(map[string]string, len(operation_setting.GetRoutingSetting().GroupStrategies)+1)
+		for group, strategy := range operation_setting.GetRoutingSetting().GroupStrategies {
+			strategies[group] = strategy
+		}
+		strategies[req.Group] = req.Strategy
+		strategiesJson, err := common.Marshal(strategies)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if err = model.UpdateOption("routing_setting.group_strategies", string(strategiesJson)); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	common.SysLog(fmt.Sprintf("routing strategy of group %q set to %q by user %d", req.Group, req.Strategy, c.GetInt("id")))
+	GetChannelRouting(c)
+}
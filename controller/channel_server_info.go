@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel/selfhosted"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func fetchChannelServerInfo(channel *model.Channel) (*selfhosted.ServerInfo, error) {
+	if !selfhosted.IsSelfHostedChannel(channel.Type) {
+		return nil, errors.New("该操作仅支持 vLLM、TGI、llama.cpp 渠道")
+	}
+	baseURL := constant.GetChannelBaseURL(channel.Type)
+	if channel.GetBaseURL() != "" {
+		baseURL = channel.GetBaseURL()
+	}
+	key, _, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		return nil, fmt.Errorf("获取渠道密钥失败: %s", apiErr.Error())
+	}
+	client, err := service.NewProxyHttpClient(channel.GetSetting().Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return selfhosted.FetchServerInfo(client, channel.Type, baseURL, strings.TrimSpace(key))
+}
+
+// syncChannelServerInfo writes the models loaded by the server and its context length into the channel,
+// the loaded models are merged into the existing list unless replace is set.
+func syncChannelServerInfo(channel *model.Channel, replace bool) (*selfhosted.ServerInfo, error) {
+	info, err := fetchChannelServerInfo(channel)
+	if err != nil {
+		return info, err
+	}
+	if len(info.Models) == 0 {
+		return info, errors.New("服务未返回已加载的模型")
+	}
+
+	models := info.Models
+	if !replace {
+		models = channel.GetModels()
+		for _, modelName := range info.Models {
+			if !common.StringsContains(models, modelName) {
+				models = append(models, modelName)
+			}
+		}
+	}
+	channel.Models = strings.Join(models, ",")
+	otherSettings := channel.GetOtherSettings()
+	otherSettings.MaxContextLength = info.MaxContextLength
+	channel.SetOtherSettings(otherSettings)
+	if err = channel.Update(); err != nil {
+		return info, err
+	}
+	model.InitChannelCache()
+	return info, nil
+}
+
+// GetChannelServerInfo 查询自建推理服务的健康状态、已加载模型和运行指标
+func GetChannelServerInfo(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	info, err := fetchChannelServerInfo(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data":    info,
+		})
+		return
+	}
+	common.ApiSuccess(c, info)
+}
+
+// SyncChannelServerInfo 将自建推理服务已加载的模型和最大上下文长度同步到渠道配置
+func SyncChannelServerInfo(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	info, err := syncChannelServerInfo(channel, c.Query("replace") == "true")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data":    info,
+		})
+		return
+	}
+	common.ApiSuccess(c, info)
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelStatement 渠道对账单，format=csv 时以 CSV 文件导出，未指定时间范围时默认最近 30 天
+func GetChannelStatement(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channelId, _ := strconv.Atoi(c.Query("channel"))
+	if endTimestamp == 0 {
+		endTimestamp = time.Now().Unix()
+	}
+	if startTimestamp == 0 {
+		startTimestamp = endTimestamp - 30*24*3600
+	}
+	if startTimestamp > endTimestamp {
+		common.ApiErrorMsg(c, "开始时间不能晚于结束时间")
+		return
+	}
+	statement, err := service.GenerateChannelStatement(startTimestamp, endTimestamp, channelId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if c.Query("format") != "csv" {
+		common.ApiSuccess(c, statement)
+		return
+	}
+
+	filename := fmt.Sprintf("channel-statement-%s-%s.csv",
+		time.Unix(startTimestamp, 0).Format("20060102"), time.Unix(endTimestamp, 0).Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"channel_id", "channel_name", "model_name", "requests", "prompt_tokens", "completion_tokens",
+		"billed_quota", "cost_quota", "margin_quota", "billed_amount", "cost_amount", "margin_amount"})
+	rows := append(statement.Items, &statement.Total)
+	for i, item := range rows {
+		channel := strconv.Itoa(item.ChannelId)
+		if i == len(rows)-1 {
+			channel = "total"
+		}
+		_ = writer.Write([]string{
+			channel,
+			item.ChannelName,
+			item.ModelName,
+			strconv.FormatInt(item.Requests, 10),
+			strconv.FormatInt(item.PromptTokens, 10),
+			strconv.FormatInt(item.CompletionTokens, 10),
+			strconv.FormatInt(item.BilledQuota, 10),
+			strconv.FormatInt(item.CostQuota, 10),
+			strconv.FormatInt(item.MarginQuota, 10),
+			strconv.FormatFloat(item.BilledAmount, 'f', 6, 64),
+			strconv.FormatFloat(item.CostAmount, 'f', 6, 64),
+			strconv.FormatFloat(item.MarginAmount, 'f', 6, 64),
+		})
+	}
+	writer.Flush()
+}
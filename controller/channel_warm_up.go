@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// warmUpChannels 渠道（重新）启用或新建后，对开启预热的渠道发送预热请求，让上游（尤其是冷启动的自建推理服务）
+// 提前加载模型，避免首个用户请求承担加载延迟。预热结果记录在渠道 other_info 的 warm_up 中。
+func warmUpChannels(channelIds ...int) {
+	for _, channelId := range channelIds {
+		channel, err := model.GetChannelById(channelId, true)
+		if err != nil || channel.Status != common.ChannelStatusEnabled {
+			continue
+		}
+		settings := channel.GetOtherSettings()
+		if !settings.WarmUpEnabled {
+			continue
+		}
+		gopool.Go(func() {
+			warmUpChannel(channel, settings.WarmUpModels, settings.WarmUpPrompts)
+		})
+	}
+}
+
+func warmUpChannel(channel *model.Channel, models []string, prompts []string) {
+	if len(models) == 0 {
+		models = []string{""}
+	}
+	if len(prompts) == 0 {
+		prompts = []string{""}
+	}
+	results := make([]map[string]interface{}, 0, len(models)*len(prompts))
+	success := true
+	tik := time.Now()
+	for _, testModel := range models {
+		for _, prompt := range prompts {
+			start := time.Now()
+			result := testChannelWithPrompt(channel, testModel, "", prompt)
+			ok := result.localErr == nil && result.newAPIError == nil
+			item := map[string]interface{}{
+				"model":       testModel,
+				"success":     ok,
+				"duration_ms": time.Since(start).Milliseconds(),
+			}
+			if result.newAPIError != nil {
+				item["error"] = result.newAPIError.Error()
+			} else if result.localErr != nil {
+				item["error"] = result.localErr.Error()
+			}
+			success = success && ok
+			results = append(results, item)
+		}
+	}
+	logger.LogModuleInfo(context.Background(), logger.ModuleChannelTest, "warmed up channel #%d in %dms, success: %t", channel.Id, time.Since(tik).Milliseconds(), success)
+	err := model.UpdateChannelWarmUpInfo(channel.Id, map[string]interface{}{
+		"time":        common.GetTimestamp(),
+		"success":     success,
+		"duration_ms": time.Since(tik).Milliseconds(),
+		"results":     results,
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to record warm-up result: channel_id=%d, error=%v", channel.Id, err))
+	}
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDormancyReport returns the report of the latest stale token and dormant user cleanup.
+func GetDormancyReport(c *gin.Context) {
+	common.ApiSuccess(c, service.GetLastDormancyReport())
+}
+
+// RunDormancyCleanup runs the cleanup right away, as a dry run unless dry_run=false is given.
+func RunDormancyCleanup(c *gin.Context) {
+	dryRun := true
+	if value := c.Query("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			common.ApiErrorMsg(c, "dry_run 参数无效")
+			return
+		}
+		dryRun = parsed
+	}
+	report, err := service.RunDormancyCleanup(dryRun)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, report)
+}
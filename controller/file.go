@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 兼容 OpenAI 的文件接口，批量任务的请求文件与结果文件也通过它管理
+
+func openAIErrorResponse(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+		},
+	})
+}
+
+func toOpenAIFile(file *model.File) dto.OpenAIFile {
+	return dto.OpenAIFile{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+		ExpiresAt: optionalTimestamp(file.ExpiresAt),
+	}
+}
+
+// getUserFileOrAbort loads the file in the path, it writes the error response and returns nil when it is missing.
+func getUserFileOrAbort(c *gin.Context) *model.File {
+	file, err := model.GetUserFile(c.GetInt("id"), c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		openAIErrorResponse(c, http.StatusNotFound, fmt.Sprintf("No such File object: %s", c.Param("id")))
+		return nil
+	}
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	return file
+}
+
+const (
+	minFileTTLSeconds = 60 * 60
+	maxFileTTLSeconds = 30 * 24 * 60 * 60
+)
+
+// uploadContentType returns the content type the client declared for the upload, detected from the data when none
+// or only application/octet-stream is declared.
+func uploadContentType(header *multipart.FileHeader, data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	if err == nil && mediaType != "application/octet-stream" {
+		return mediaType
+	}
+	return http.DetectContentType(data)
+}
+
+// fileExpiresAt reads expires_after[anchor] and expires_after[seconds] of the upload, the default TTL applies
+// when they are missing.
+func fileExpiresAt(c *gin.Context, now int64) (int64, error) {
+	secondsValue := c.PostForm("expires_after[seconds]")
+	if secondsValue == "" {
+		if days := operation_setting.GetFileSetting().DefaultTTLDays; days > 0 {
+			return now + int64(days)*24*60*60, nil
+		}
+		return 0, nil
+	}
+	if anchor := c.PostForm("expires_after[anchor]"); anchor != "" && anchor != "created_at" {
+		return 0, fmt.Errorf("unsupported expires_after[anchor]: %s", anchor)
+	}
+	seconds, err := strconv.ParseInt(secondsValue, 10, 64)
+	if err != nil || seconds < minFileTTLSeconds || seconds > maxFileTTLSeconds {
+		return 0, fmt.Errorf("expires_after[seconds] must be between %d and %d", minFileTTLSeconds, maxFileTTLSeconds)
+	}
+	return now + seconds, nil
+}
+
+func UploadFile(c *gin.Context) {
+	setting := operation_setting.GetFileSetting()
+	if !setting.Enabled {
+		openAIErrorResponse(c, http.StatusNotImplemented, "files api is not enabled")
+		return
+	}
+	purpose := c.PostForm("purpose")
+	if !setting.IsPurposeAllowed(purpose) {
+		openAIErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("unsupported purpose: %s", purpose))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "file is required")
+		return
+	}
+	maxBytes := int64(setting.MaxFileSizeMB) << 20
+	if maxBytes > 0 && header.Size > maxBytes {
+		openAIErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds the limit of %d MB", setting.MaxFileSizeMB))
+		return
+	}
+	expiresAt, err := fileExpiresAt(c, common.GetTimestamp())
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	userId := c.GetInt("id")
+	if setting.UserQuotaMB > 0 {
+		used, err := model.GetUserFileBytes(userId)
+		if err != nil {
+			openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if used+header.Size > int64(setting.UserQuotaMB)<<20 {
+			openAIErrorResponse(c, http.StatusForbidden, fmt.Sprintf("file storage quota of %d MB exceeded, delete some files first", setting.UserQuotaMB))
+			return
+		}
+	}
+	reader, err := header.Open()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	file, err := service.SaveFile(c.Request.Context(), userId, purpose, header.Filename, uploadContentType(header, data), data, expiresAt)
+	if err != nil {
+		logger.LogError(c, "save file failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "save file failed")
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10000"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), c.Query("order") == "asc", limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	response := dto.OpenAIListResponse[dto.OpenAIFile]{
+		Object:  "list",
+		Data:    make([]dto.OpenAIFile, 0, len(files)),
+		HasMore: hasMore,
+	}
+	for _, file := range files {
+		response.Data = append(response.Data, toOpenAIFile(file))
+	}
+	if len(files) > 0 {
+		response.FirstId = files[0].FileId
+		response.LastId = files[len(files)-1].FileId
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	reader, err := service.OpenFile(c.Request.Context(), file)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "read file failed: "+err.Error())
+		return
+	}
+	defer reader.Close()
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}),
+	})
+}
+
+func DeleteFile(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	if err := service.DeleteFile(c.Request.Context(), file); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.FileId,
+		"object":  "file",
+		"deleted": true,
+	})
+}
@@ -0,0 +1,397 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/graphql"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GraphQL 管理接口
+//
+// 用户、令牌、渠道、日志与用量统计的只读 GraphQL 入口，字段名与 REST 接口的 JSON 字段一致。
+// 普通用户只能查询自己的数据，渠道、其他用户以及日志中的渠道和 IP 等字段需要管理员权限，并按管理角色检查对应资源的读权限，
+// 渠道地址需要 root 权限。
+// 令牌与渠道的密钥不通过 GraphQL 返回。
+
+type graphQLViewerKey struct{}
+
+type graphQLViewer struct {
+	userId int
+	role   int
+	// allows 检查管理角色对资源的权限，为空时没有任何管理权限
+	allows func(resource string, action string) bool
+}
+
+var errGraphQLForbidden = errors.New("无权访问该字段")
+
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// GraphQL executes a read only query over the management domain.
+func GraphQL(c *gin.Context) {
+	setting := operation_setting.GetGraphQLSetting()
+	if !setting.Enabled {
+		c.JSON(http.StatusNotFound, graphql.Result{Errors: []*graphql.Error{{Message: "GraphQL 接口未启用"}}})
+		return
+	}
+	var req graphQLRequest
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := common.UnmarshalJsonStr(variables, &req.Variables); err != nil {
+				c.JSON(http.StatusBadRequest, graphql.Result{Errors: []*graphql.Error{{Message: "无效的 variables: " + err.Error()}}})
+				return
+			}
+		}
+	} else if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: []*graphql.Error{{Message: "无效的请求: " + err.Error()}}})
+		return
+	}
+	viewer := newGraphQLViewer(c.GetInt("id"), c.GetInt("role"))
+	result := graphql.Execute(graphql.Params{
+		Context:       context.WithValue(c.Request.Context(), graphQLViewerKey{}, viewer),
+		Schema:        graphQLSchema,
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+		MaxDepth:      setting.MaxDepth,
+		MaxComplexity: setting.MaxComplexity,
+	})
+	status := http.StatusOK
+	if result.Data == nil {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, result)
+}
+
+func viewerOf(p graphql.ResolveParams) *graphQLViewer {
+	viewer, _ := p.Context.Value(graphQLViewerKey{}).(*graphQLViewer)
+	if viewer == nil {
+		return &graphQLViewer{}
+	}
+	return viewer
+}
+
+func newGraphQLViewer(userId int, role int) *graphQLViewer {
+	return &graphQLViewer{userId: userId, role: role, allows: func(resource string, action string) bool {
+		return service.AdminAllows(userId, role, resource, action)
+	}}
+}
+
+// canRead reports whether the viewer may read the admin resource, according to the admin role like AdminAuth routes.
+func (v *graphQLViewer) canRead(resource string) bool {
+	return v.allows != nil && v.allows(resource, system_setting.AdminActionRead)
+}
+
+// canViewUser reports whether the viewer may see the user, admins do not see users of the same or a higher role,
+// like GetUser.
+func (v *graphQLViewer) canViewUser(user *model.User) bool {
+	return user.Id == v.userId || v.role == common.RoleRootUser || v.role > user.Role
+}
+
+// graphQLUser returns the user when the viewer may see it.
+func graphQLUser(p graphql.ResolveParams, id int) (*model.User, error) {
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		return nil, err
+	}
+	if !viewerOf(p).canViewUser(user) {
+		return nil, errGraphQLForbidden
+	}
+	return user, nil
+}
+
+func requireAdmin(resource string) func(p graphql.ResolveParams) error {
+	return func(p graphql.ResolveParams) error {
+		if !viewerOf(p).canRead(resource) {
+			return errGraphQLForbidden
+		}
+		return nil
+	}
+}
+
+func requireRoot(p graphql.ResolveParams) error {
+	if viewerOf(p).role < common.RoleRootUser {
+		return errGraphQLForbidden
+	}
+	return nil
+}
+
+// requireSelfOrAdmin allows admins that may read the resource, and users on their own user object.
+func requireSelfOrAdmin(resource string) func(p graphql.ResolveParams) error {
+	return func(p graphql.ResolveParams) error {
+		viewer := viewerOf(p)
+		if user, ok := p.Source.(*model.User); ok && user.Id == viewer.userId {
+			return nil
+		}
+		return requireAdmin(resource)(p)
+	}
+}
+
+// graphQLPage returns the start index and size of the page and page_size arguments.
+func graphQLPage(p graphql.ResolveParams) (int, int) {
+	maxPageSize := max(operation_setting.GetGraphQLSetting().MaxPageSize, 1)
+	page := max(p.Int("page", 1), 1)
+	pageSize := min(max(p.Int("page_size", common.ItemsPerPage), 1), maxPageSize)
+	return (page - 1) * pageSize, pageSize
+}
+
+// scalar resolves a scalar field of a source of type T.
+func scalar[T any](get func(*T) any) *graphql.Field {
+	return &graphql.Field{Resolve: func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(*T)), nil
+	}}
+}
+
+func authorized(field *graphql.Field, authorize func(p graphql.ResolveParams) error) *graphql.Field {
+	field.Authorize = authorize
+	return field
+}
+
+var graphQLSchema = buildGraphQLSchema()
+
+func buildGraphQLSchema() *graphql.Object {
+	userType := &graphql.Object{Name: "User"}
+	tokenType := &graphql.Object{Name: "Token"}
+	channelType := &graphql.Object{Name: "Channel"}
+	channelHealthType := &graphql.Object{Name: "ChannelHealth"}
+	logType := &graphql.Object{Name: "Log"}
+	quotaDataType := &graphql.Object{Name: "QuotaData"}
+
+	userType.Fields = map[string]*graphql.Field{
+		"id":            scalar(func(u *model.User) any { return u.Id }),
+		"username":      scalar(func(u *model.User) any { return u.Username }),
+		"display_name":  scalar(func(u *model.User) any { return u.DisplayName }),
+		"role":          scalar(func(u *model.User) any { return u.Role }),
+		"status":        scalar(func(u *model.User) any { return u.Status }),
+		"group":         scalar(func(u *model.User) any { return u.Group }),
+		"email":         authorized(scalar(func(u *model.User) any { return u.Email }), requireSelfOrAdmin(system_setting.AdminResourceUser)),
+		"quota":         authorized(scalar(func(u *model.User) any { return u.Quota }), requireSelfOrAdmin(system_setting.AdminResourceBilling)),
+		"used_quota":    authorized(scalar(func(u *model.User) any { return u.UsedQuota }), requireSelfOrAdmin(system_setting.AdminResourceBilling)),
+		"request_count": authorized(scalar(func(u *model.User) any { return u.RequestCount }), requireSelfOrAdmin(system_setting.AdminResourceUser)),
+		"tokens": {
+			Type:      tokenType,
+			Args:      []string{"page", "page_size"},
+			Authorize: requireSelfOrAdmin(system_setting.AdminResourceUser),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				startIdx, num := graphQLPage(p)
+				return model.GetAllUserTokens(p.Source.(*model.User).Id, startIdx, num)
+			},
+		},
+		"logs": {
+			Type:      logType,
+			Args:      []string{"page", "page_size", "type", "start_timestamp", "end_timestamp", "model_name", "token_name"},
+			Authorize: requireSelfOrAdmin(system_setting.AdminResourceLog),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				startIdx, num := graphQLPage(p)
+				logs, _, err := model.GetUserLogs(p.Source.(*model.User).Id, p.Int("type", 0), int64(p.Int("start_timestamp", 0)),
+					int64(p.Int("end_timestamp", 0)), p.String("model_name"), p.String("token_name"), startIdx, num, "", "")
+				return logs, err
+			},
+		},
+		"analytics": {
+			Type:      quotaDataType,
+			Args:      []string{"start_timestamp", "end_timestamp"},
+			Authorize: requireSelfOrAdmin(system_setting.AdminResourceLog),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return model.GetQuotaDataByUserId(p.Source.(*model.User).Id, int64(p.Int("start_timestamp", 0)), int64(p.Int("end_timestamp", 0)))
+			},
+		},
+	}
+
+	tokenType.Fields = map[string]*graphql.Field{
+		"id":                   scalar(func(t *model.Token) any { return t.Id }),
+		"name":                 scalar(func(t *model.Token) any { return t.Name }),
+		"status":               scalar(func(t *model.Token) any { return t.Status }),
+		"created_time":         scalar(func(t *model.Token) any { return t.CreatedTime }),
+		"accessed_time":        scalar(func(t *model.Token) any { return t.AccessedTime }),
+		"expired_time":         scalar(func(t *model.Token) any { return t.ExpiredTime }),
+		"remain_quota":         scalar(func(t *model.Token) any { return t.RemainQuota }),
+		"used_quota":           scalar(func(t *model.Token) any { return t.UsedQuota }),
+		"unlimited_quota":      scalar(func(t *model.Token) any { return t.UnlimitedQuota }),
+		"model_limits_enabled": scalar(func(t *model.Token) any { return t.ModelLimitsEnabled }),
+		"model_limits":         scalar(func(t *model.Token) any { return t.ModelLimits }),
+		"group":                scalar(func(t *model.Token) any { return t.Group }),
+		"user": {
+			Type: userType,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return graphQLUser(p, p.Source.(*model.Token).UserId)
+			},
+		},
+	}
+
+	channelType.Fields = map[string]*graphql.Field{
+		"id":            scalar(func(ch *model.Channel) any { return ch.Id }),
+		"name":          scalar(func(ch *model.Channel) any { return ch.Name }),
+		"type":          scalar(func(ch *model.Channel) any { return ch.Type }),
+		"status":        scalar(func(ch *model.Channel) any { return ch.Status }),
+		"group":         scalar(func(ch *model.Channel) any { return ch.Group }),
+		"models":        scalar(func(ch *model.Channel) any { return ch.Models }),
+		"tag":           scalar(func(ch *model.Channel) any { return ch.GetTag() }),
+		"priority":      scalar(func(ch *model.Channel) any { return ch.GetPriority() }),
+		"weight":        scalar(func(ch *model.Channel) any { return ch.GetWeight() }),
+		"balance":       scalar(func(ch *model.Channel) any { return ch.Balance }),
+		"used_quota":    scalar(func(ch *model.Channel) any { return ch.UsedQuota }),
+		"response_time": scalar(func(ch *model.Channel) any { return ch.ResponseTime }),
+		"test_time":     scalar(func(ch *model.Channel) any { return ch.TestTime }),
+		"created_time":  scalar(func(ch *model.Channel) any { return ch.CreatedTime }),
+		"base_url":      authorized(scalar(func(ch *model.Channel) any { return ch.GetBaseURL() }), requireRoot),
+		"health": {
+			Type: channelHealthType,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return model.GetChannelHealth(p.Source.(*model.Channel).Id)
+			},
+		},
+	}
+
+	channelHealthType.Fields = map[string]*graphql.Field{
+		"unhealthy":            scalar(func(h *model.ChannelHealth) any { return h.Unhealthy }),
+		"consecutive_failures": scalar(func(h *model.ChannelHealth) any { return h.ConsecutiveFailures }),
+		"last_success":         scalar(func(h *model.ChannelHealth) any { return h.LastSuccess }),
+		"last_latency_ms":      scalar(func(h *model.ChannelHealth) any { return h.LastLatencyMs }),
+		"last_error":           scalar(func(h *model.ChannelHealth) any { return h.LastError }),
+		"last_checked_at":      scalar(func(h *model.ChannelHealth) any { return h.LastCheckedAt }),
+	}
+
+	logType.Fields = map[string]*graphql.Field{
+		"id":                scalar(func(l *model.Log) any { return l.Id }),
+		"created_at":        scalar(func(l *model.Log) any { return l.CreatedAt }),
+		"type":              scalar(func(l *model.Log) any { return l.Type }),
+		"content":           scalar(func(l *model.Log) any { return l.Content }),
+		"username":          scalar(func(l *model.Log) any { return l.Username }),
+		"token_name":        scalar(func(l *model.Log) any { return l.TokenName }),
+		"model_name":        scalar(func(l *model.Log) any { return l.ModelName }),
+		"quota":             scalar(func(l *model.Log) any { return l.Quota }),
+		"prompt_tokens":     scalar(func(l *model.Log) any { return l.PromptTokens }),
+		"completion_tokens": scalar(func(l *model.Log) any { return l.CompletionTokens }),
+		"use_time":          scalar(func(l *model.Log) any { return l.UseTime }),
+		"is_stream":         scalar(func(l *model.Log) any { return l.IsStream }),
+		"group":             scalar(func(l *model.Log) any { return l.Group }),
+		"request_id":        scalar(func(l *model.Log) any { return l.RequestId }),
+		"channel_id":        authorized(scalar(func(l *model.Log) any { return l.ChannelId }), requireAdmin(system_setting.AdminResourceLog)),
+		"channel_name":      authorized(scalar(func(l *model.Log) any { return l.ChannelName }), requireAdmin(system_setting.AdminResourceLog)),
+		"ip":                authorized(scalar(func(l *model.Log) any { return l.Ip }), requireAdmin(system_setting.AdminResourceLog)),
+	}
+
+	quotaDataType.Fields = map[string]*graphql.Field{
+		"model_name": scalar(func(d *model.QuotaData) any { return d.ModelName }),
+		"username":   scalar(func(d *model.QuotaData) any { return d.Username }),
+		"created_at": scalar(func(d *model.QuotaData) any { return d.CreatedAt }),
+		"token_used": scalar(func(d *model.QuotaData) any { return d.TokenUsed }),
+		"count":      scalar(func(d *model.QuotaData) any { return d.Count }),
+		"quota":      scalar(func(d *model.QuotaData) any { return d.Quota }),
+	}
+
+	return &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"me": {
+			Type: userType,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return model.GetUserById(viewerOf(p).userId, false)
+			},
+		},
+		"user": {
+			Type:      userType,
+			Args:      []string{"id"},
+			Authorize: requireAdmin(system_setting.AdminResourceUser),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return graphQLUser(p, p.Int("id", 0))
+			},
+		},
+		"users": {
+			Type:      userType,
+			Args:      []string{"page", "page_size", "keyword", "group"},
+			Authorize: requireAdmin(system_setting.AdminResourceUser),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				startIdx, num := graphQLPage(p)
+				maxRole := viewerOf(p).role
+				if maxRole == common.RoleRootUser {
+					maxRole = 0
+				}
+				users, _, err := model.SearchUsersBelowRole(p.String("keyword"), p.String("group"), maxRole, startIdx, num)
+				return users, err
+			},
+		},
+		"token": {
+			Type: tokenType,
+			Args: []string{"id"},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				if viewerOf(p).canRead(system_setting.AdminResourceUser) {
+					return model.GetTokenById(p.Int("id", 0))
+				}
+				return model.GetTokenByIds(p.Int("id", 0), viewerOf(p).userId)
+			},
+		},
+		"tokens": {
+			Type: tokenType,
+			Args: []string{"page", "page_size"},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				startIdx, num := graphQLPage(p)
+				return model.GetAllUserTokens(viewerOf(p).userId, startIdx, num)
+			},
+		},
+		"channel": {
+			Type:      channelType,
+			Args:      []string{"id"},
+			Authorize: requireAdmin(system_setting.AdminResourceChannel),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return model.GetChannelById(p.Int("id", 0), false)
+			},
+		},
+		"channels": {
+			Type:      channelType,
+			Args:      []string{"page", "page_size"},
+			Authorize: requireAdmin(system_setting.AdminResourceChannel),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				startIdx, num := graphQLPage(p)
+				return model.GetAllChannels(startIdx, num, false, false)
+			},
+		},
+		"logs": {
+			Type: logType,
+			Args: []string{"page", "page_size", "type", "start_timestamp", "end_timestamp", "model_name", "token_name", "username", "channel"},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				startIdx, num := graphQLPage(p)
+				viewer := viewerOf(p)
+				if !viewer.canRead(system_setting.AdminResourceLog) {
+					if p.String("username") != "" || p.Int("channel", 0) != 0 {
+						return nil, errGraphQLForbidden
+					}
+					logs, _, err := model.GetUserLogs(viewer.userId, p.Int("type", 0), int64(p.Int("start_timestamp", 0)),
+						int64(p.Int("end_timestamp", 0)), p.String("model_name"), p.String("token_name"), startIdx, num, "", "")
+					return logs, err
+				}
+				logs, _, err := model.GetAllLogs(p.Int("type", 0), int64(p.Int("start_timestamp", 0)), int64(p.Int("end_timestamp", 0)),
+					p.String("model_name"), p.String("username"), p.String("token_name"), startIdx, num, p.Int("channel", 0), "", "")
+				return logs, err
+			},
+		},
+		"analytics": {
+			Type: quotaDataType,
+			Args: []string{"start_timestamp", "end_timestamp", "username"},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				viewer := viewerOf(p)
+				start, end := int64(p.Int("start_timestamp", 0)), int64(p.Int("end_timestamp", 0))
+				if !viewer.canRead(system_setting.AdminResourceLog) {
+					if p.String("username") != "" {
+						return nil, errGraphQLForbidden
+					}
+					return model.GetQuotaDataByUserId(viewer.userId, start, end)
+				}
+				return model.GetAllQuotaDates(start, end, p.String("username"))
+			},
+		},
+	}}
+}
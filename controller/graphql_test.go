@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/graphql"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// testGraphQLViewer builds a viewer whose admin role grants read access to the given resources only.
+func testGraphQLViewer(userId int, role int, resources ...string) *graphQLViewer {
+	return &graphQLViewer{userId: userId, role: role, allows: func(resource string, action string) bool {
+		return action == system_setting.AdminActionRead && slices.Contains(resources, resource)
+	}}
+}
+
+var (
+	testCommonViewer    = testGraphQLViewer(10, common.RoleCommonUser)
+	testChannelViewer   = testGraphQLViewer(20, common.RoleAdminUser, system_setting.AdminResourceChannel, system_setting.AdminResourceModel)
+	testBillingViewer   = testGraphQLViewer(30, common.RoleAdminUser, system_setting.AdminResourceBilling, system_setting.AdminResourceUser)
+	testLogViewer       = testGraphQLViewer(40, common.RoleAdminUser, system_setting.AdminResourceLog)
+	testFullAdminViewer = testGraphQLViewer(50, common.RoleAdminUser, system_setting.AdminResources...)
+	testRootViewer      = testGraphQLViewer(1, common.RoleRootUser, system_setting.AdminResources...)
+)
+
+func graphQLParams(viewer *graphQLViewer, source any, args map[string]any) graphql.ResolveParams {
+	return graphql.ResolveParams{
+		Context: context.WithValue(context.Background(), graphQLViewerKey{}, viewer),
+		Source:  source,
+		Args:    args,
+	}
+}
+
+func TestGraphQLFieldAuthorization(t *testing.T) {
+	userType := graphQLSchema.Fields["me"].Type
+	channelType := graphQLSchema.Fields["channel"].Type
+	logType := graphQLSchema.Fields["logs"].Type
+	otherUser := &model.User{Id: 99, Role: common.RoleCommonUser}
+
+	cases := []struct {
+		name    string
+		field   *graphql.Field
+		source  any
+		allowed []*graphQLViewer
+	}{
+		{"Query.user", graphQLSchema.Fields["user"], nil, []*graphQLViewer{testBillingViewer, testFullAdminViewer, testRootViewer}},
+		{"Query.users", graphQLSchema.Fields["users"], nil, []*graphQLViewer{testBillingViewer, testFullAdminViewer, testRootViewer}},
+		{"Query.channel", graphQLSchema.Fields["channel"], nil, []*graphQLViewer{testChannelViewer, testFullAdminViewer, testRootViewer}},
+		{"Query.channels", graphQLSchema.Fields["channels"], nil, []*graphQLViewer{testChannelViewer, testFullAdminViewer, testRootViewer}},
+		{"User.email", userType.Fields["email"], otherUser, []*graphQLViewer{testBillingViewer, testFullAdminViewer, testRootViewer}},
+		{"User.request_count", userType.Fields["request_count"], otherUser, []*graphQLViewer{testBillingViewer, testFullAdminViewer, testRootViewer}},
+		{"User.tokens", userType.Fields["tokens"], otherUser, []*graphQLViewer{testBillingViewer, testFullAdminViewer, testRootViewer}},
+		{"User.quota", userType.Fields["quota"], otherUser, []*graphQLViewer{testBillingViewer, testFullAdminViewer, testRootViewer}},
+		{"User.used_quota", userType.Fields["used_quota"], otherUser, []*graphQLViewer{testBillingViewer, testFullAdminViewer, testRootViewer}},
+		{"User.logs", userType.Fields["logs"], otherUser, []*graphQLViewer{testLogViewer, testFullAdminViewer, testRootViewer}},
+		{"User.analytics", userType.Fields["analytics"], otherUser, []*graphQLViewer{testLogViewer, testFullAdminViewer, testRootViewer}},
+		{"Log.channel_id", logType.Fields["channel_id"], &model.Log{}, []*graphQLViewer{testLogViewer, testFullAdminViewer, testRootViewer}},
+		{"Log.channel_name", logType.Fields["channel_name"], &model.Log{}, []*graphQLViewer{testLogViewer, testFullAdminViewer, testRootViewer}},
+		{"Log.ip", logType.Fields["ip"], &model.Log{}, []*graphQLViewer{testLogViewer, testFullAdminViewer, testRootViewer}},
+		{"Channel.base_url", channelType.Fields["base_url"], &model.Channel{}, []*graphQLViewer{testRootViewer}},
+	}
+	viewers := []*graphQLViewer{testCommonViewer, testChannelViewer, testBillingViewer, testLogViewer, testFullAdminViewer, testRootViewer}
+	for _, tc := range cases {
+		if tc.field.Authorize == nil {
+			t.Errorf("%s: field is not authorized", tc.name)
+			continue
+		}
+		for _, viewer := range viewers {
+			err := tc.field.Authorize(graphQLParams(viewer, tc.source, nil))
+			if allowed := slices.Contains(tc.allowed, viewer); allowed != (err == nil) {
+				t.Errorf("%s: viewer #%d allowed = %v, got error %v", tc.name, viewer.userId, allowed, err)
+			}
+		}
+	}
+}
+
+func TestGraphQLOwnUserFields(t *testing.T) {
+	userType := graphQLSchema.Fields["me"].Type
+	self := &model.User{Id: testCommonViewer.userId, Role: common.RoleCommonUser}
+	for name, field := range userType.Fields {
+		if field.Authorize == nil {
+			continue
+		}
+		if err := field.Authorize(graphQLParams(testCommonViewer, self, nil)); err != nil {
+			t.Errorf("User.%s: users must see their own field, got %v", name, err)
+		}
+	}
+}
+
+func TestGraphQLCanViewUser(t *testing.T) {
+	root := &model.User{Id: 1, Role: common.RoleRootUser}
+	admin := &model.User{Id: 60, Role: common.RoleAdminUser}
+	user := &model.User{Id: 99, Role: common.RoleCommonUser}
+	cases := []struct {
+		viewer *graphQLViewer
+		user   *model.User
+		want   bool
+	}{
+		{testFullAdminViewer, user, true},
+		{testFullAdminViewer, admin, false},
+		{testFullAdminViewer, root, false},
+		{testFullAdminViewer, &model.User{Id: testFullAdminViewer.userId, Role: common.RoleAdminUser}, true},
+		{testRootViewer, admin, true},
+		{testRootViewer, root, true},
+		{testCommonViewer, user, false},
+	}
+	for _, tc := range cases {
+		if got := tc.viewer.canViewUser(tc.user); got != tc.want {
+			t.Errorf("viewer #%d on user #%d: got %v, want %v", tc.viewer.userId, tc.user.Id, got, tc.want)
+		}
+	}
+}
+
+func TestGraphQLFilterArgumentsNeedLogAccess(t *testing.T) {
+	cases := []struct {
+		field string
+		args  map[string]any
+	}{
+		{"logs", map[string]any{"username": "root"}},
+		{"logs", map[string]any{"channel": int64(1)}},
+		{"analytics", map[string]any{"username": "root"}},
+	}
+	for _, viewer := range []*graphQLViewer{testCommonViewer, testChannelViewer, testBillingViewer} {
+		for _, tc := range cases {
+			_, err := graphQLSchema.Fields[tc.field].Resolve(graphQLParams(viewer, nil, tc.args))
+			if !errors.Is(err, errGraphQLForbidden) {
+				t.Errorf("%s %v: viewer #%d expected forbidden, got %v", tc.field, tc.args, viewer.userId, err)
+			}
+		}
+	}
+}
+
+func TestGraphQLExecuteDeniesAdminQueries(t *testing.T) {
+	result := graphql.Execute(graphql.Params{
+		Context: context.WithValue(context.Background(), graphQLViewerKey{}, testChannelViewer),
+		Schema:  graphQLSchema,
+		Query:   `{ users { id quota } user(id: 1) { id } }`,
+	})
+	data, ok := result.Data.(*graphql.OrderedMap)
+	if !ok || len(result.Errors) != 2 {
+		t.Fatalf("expected two field errors, got %+v", result)
+	}
+	for _, key := range []string{"users", "user"} {
+		if value, _ := data.Get(key); value != nil {
+			t.Errorf("%s: expected null, got %v", key, value)
+		}
+	}
+	for _, err := range result.Errors {
+		if err.Message != errGraphQLForbidden.Error() {
+			t.Errorf("unexpected error %s", err.Message)
+		}
+	}
+}
+
+func TestGraphQLViewerWithoutAdminRole(t *testing.T) {
+	if (&graphQLViewer{userId: 1, role: common.RoleAdminUser}).canRead(system_setting.AdminResourceUser) {
+		t.Fatal("a viewer without a permission check must not read admin resources")
+	}
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/storage"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRehostedImage serves an image re-hosted by the gateway, the link is authorized by its signature.
+func GetRehostedImage(c *gin.Context) {
+	name := c.Param("name")
+	expiresAt, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err := service.VerifyRehostedImageLink(name, expiresAt, c.Query("signature")); err != nil {
+		c.String(http.StatusForbidden, err.Error())
+		return
+	}
+	reader, contentType, err := service.OpenRehostedImage(c.Request.Context(), name)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		common.SysError("failed to open rehosted image: " + err.Error())
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+	if maxAge := expiresAt - time.Now().Unix(); maxAge > 0 {
+		c.Header("Cache-Control", "public, max-age="+strconv.FormatInt(maxAge, 10))
+	}
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
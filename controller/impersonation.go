@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+type impersonationRequest struct {
+	Minutes int `json:"minutes"`
+}
+
+func impersonationUserData(user *model.User) map[string]any {
+	return map[string]any{
+		"id":           user.Id,
+		"username":     user.Username,
+		"display_name": user.DisplayName,
+		"role":         user.Role,
+		"status":       user.Status,
+		"group":        user.Group,
+	}
+}
+
+// StartImpersonation 超级管理员临时模拟登录指定用户，超过时限后自动恢复管理员身份
+func StartImpersonation(c *gin.Context) {
+	if c.GetBool("use_access_token") {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "模拟登录仅支持网页会话，不支持 access token",
+		})
+		return
+	}
+	targetId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req impersonationRequest
+	_ = c.ShouldBindJSON(&req)
+
+	adminId := c.GetInt("id")
+	if targetId == adminId {
+		common.ApiErrorMsg(c, "不能模拟登录自己")
+		return
+	}
+	admin, err := model.GetUserById(adminId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	target, err := model.GetUserById(targetId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if target.Role >= common.RoleRootUser {
+		common.ApiErrorMsg(c, "不能模拟登录超级管理员")
+		return
+	}
+	if target.Status != common.UserStatusEnabled {
+		common.ApiErrorMsg(c, "该用户已被禁用")
+		return
+	}
+
+	minutes := common.ImpersonationMaxMinutes
+	if req.Minutes > 0 && req.Minutes < minutes {
+		minutes = req.Minutes
+	}
+	expiresAt := time.Now().Add(time.Duration(minutes) * time.Minute).Unix()
+	if err = middleware.StartImpersonation(c, admin, target, expiresAt); err != nil {
+		common.ApiErrorMsg(c, "无法保存会话信息，请重试")
+		return
+	}
+	data := impersonationUserData(target)
+	data["impersonation_expires_at"] = expiresAt
+	common.ApiSuccess(c, data)
+}
+
+// StopImpersonation 结束模拟登录，恢复管理员身份
+func StopImpersonation(c *gin.Context) {
+	admin, err := middleware.EndImpersonation(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, impersonationUserData(admin))
+}
+
+// GetImpersonationStatus 获取当前会话的模拟登录状态
+func GetImpersonationStatus(c *gin.Context) {
+	session := sessions.Default(c)
+	impersonatorId, ok := session.Get(common.SessionKeyImpersonatorId).(int)
+	if !ok {
+		common.ApiSuccess(c, gin.H{"impersonating": false})
+		return
+	}
+	impersonatorUsername, _ := session.Get(common.SessionKeyImpersonatorUsername).(string)
+	expiresAt, _ := session.Get(common.SessionKeyImpersonationExpiresAt).(int64)
+	common.ApiSuccess(c, gin.H{
+		"impersonating":         true,
+		"impersonator_id":       impersonatorId,
+		"impersonator_username": impersonatorUsername,
+		"expires_at":            expiresAt,
+	})
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetInFlightRequests lists the relay requests in progress on this node, optionally filtered by
+// user_id, model and channel_id.
+func GetInFlightRequests(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	modelName := strings.TrimSpace(c.Query("model"))
+
+	requests := service.ListInFlightRequests()
+	result := make([]service.InFlightRequest, 0, len(requests))
+	for _, request := range requests {
+		if userId != 0 && request.UserId != userId {
+			continue
+		}
+		if channelId != 0 && request.ChannelId != channelId {
+			continue
+		}
+		if modelName != "" && request.Model != modelName {
+			continue
+		}
+		result = append(result, request)
+	}
+	common.ApiSuccess(c, result)
+}
+
+// CancelInFlightRequest aborts the upstream call of a request running on this node.
+func CancelInFlightRequest(c *gin.Context) {
+	requestId := c.Param("request_id")
+	request, ok := service.CancelInFlightRequest(requestId)
+	if !ok {
+		common.ApiErrorMsg(c, "请求不存在或已结束，多节点部署时请在处理该请求的节点上操作")
+		return
+	}
+	model.RecordLog(request.UserId, model.LogTypeManage, fmt.Sprintf("管理员 %s 强制取消了请求 %s（模型 %s，渠道 #%d，已运行 %d 秒）",
+		c.GetString("username"), request.RequestId, request.Model, request.ChannelId, request.ElapsedMs/1000))
+	common.ApiSuccess(c, request)
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
@@ -20,7 +21,8 @@ func GetAllLogs(c *gin.Context) {
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
 	group := c.Query("group")
-	logs, total, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), channel, group)
+	sessionId := c.Query("session_id")
+	logs, total, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), channel, group, sessionId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -40,7 +42,8 @@ func GetUserLogs(c *gin.Context) {
 	tokenName := c.Query("token_name")
 	modelName := c.Query("model_name")
 	group := c.Query("group")
-	logs, total, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group)
+	sessionId := c.Query("session_id")
+	logs, total, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group, sessionId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -51,6 +54,31 @@ func GetUserLogs(c *gin.Context) {
 	return
 }
 
+// VerifyLogChain 校验指定用户消费日志的哈希链
+func VerifyLogChain(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	result, err := model.VerifyLogChain(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, result)
+}
+
+// VerifySelfLogChain 校验当前用户消费日志的哈希链
+func VerifySelfLogChain(c *gin.Context) {
+	result, err := model.VerifyLogChain(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, result)
+}
+
 func SearchAllLogs(c *gin.Context) {
 	keyword := c.Query("keyword")
 	logs, err := model.SearchAllLogs(keyword)
@@ -160,6 +188,7 @@ func DeleteHistoryLogs(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.RecordRetentionCleanup("log", count)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -167,3 +196,168 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// PreviewLogRetention counts the logs the retention cleanup would remove, the days of each log type can be
+// overridden by query parameters to check a policy before saving it.
+func PreviewLogRetention(c *gin.Context) {
+	policy := model.GetLogRetentionPolicy()
+	overrides := map[string]*int{
+		"consume_log_days": &policy.ConsumeLogDays,
+		"error_log_days":   &policy.ErrorLogDays,
+		"detail_log_days":  &policy.DetailLogDays,
+		"audit_log_days":   &policy.AuditLogDays,
+	}
+	for name, days := range overrides {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			common.ApiErrorMsg(c, "invalid "+name)
+			return
+		}
+		*days = parsed
+	}
+	previews, err := model.PreviewLogRetention(policy)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, previews)
+}
+
+// RunLogRetention starts a retention cleanup pass now, its progress is read from GetLogRetentionStatus.
+func RunLogRetention(c *gin.Context) {
+	if !model.StartLogRetentionRun(model.LogRetentionTriggerManual) {
+		common.ApiErrorMsg(c, "日志清理任务正在运行")
+		return
+	}
+	common.ApiSuccess(c, model.GetLogRetentionProgress())
+}
+
+func GetLogRetentionStatus(c *gin.Context) {
+	common.ApiSuccess(c, model.GetLogRetentionProgress())
+}
+
+type RedactionPreviewRequest struct {
+	Text  string                 `json:"text"`
+	Rules []common.RedactionRule `json:"rules"` // 为空时使用当前保存的规则
+}
+
+// PreviewLogRedaction applies redaction rules to a sample payload so admins can check the rules before saving them.
+func PreviewLogRedaction(c *gin.Context) {
+	req := RedactionPreviewRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rules := req.Rules
+	if rules == nil {
+		rules = common.GetLogRedactionRules()
+	}
+	result, redacted, err := common.RedactPayloadWithRules(req.Text, rules)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"text":     result,
+		"redacted": redacted,
+	})
+}
+
+// GetLogDetail 单条日志的详情，内容保存在对象存储中时返回完整内容
+func GetLogDetail(c *gin.Context) {
+	getLogDetail(c, 0)
+}
+
+func GetSelfLogDetail(c *gin.Context) {
+	getLogDetail(c, c.GetInt("id"))
+}
+
+func getLogDetail(c *gin.Context, userId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	detail, err := model.GetLogDetail(c.Request.Context(), id, userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, detail)
+}
+
+// GetLogsByRequestId 按请求 ID 查询日志，请求 ID 见响应头 X-Request-Id 或错误信息
+func GetLogsByRequestId(c *gin.Context) {
+	getLogsByRequestId(c, 0)
+}
+
+func GetSelfLogsByRequestId(c *gin.Context) {
+	getLogsByRequestId(c, c.GetInt("id"))
+}
+
+func getLogsByRequestId(c *gin.Context, userId int) {
+	logs, err := model.GetLogsByRequestId(strings.TrimSpace(c.Param("request_id")), userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, logs)
+}
+
+// GetSessionSummaries 按会话汇总所有用户的消费
+func GetSessionSummaries(c *gin.Context) {
+	getSessionSummaries(c, model.SessionSummaryQuery{
+		Username: c.Query("username"),
+	})
+}
+
+// GetSelfSessionSummaries 按会话汇总当前用户的消费
+func GetSelfSessionSummaries(c *gin.Context) {
+	getSessionSummaries(c, model.SessionSummaryQuery{
+		UserId: c.GetInt("id"),
+	})
+}
+
+func getSessionSummaries(c *gin.Context, query model.SessionSummaryQuery) {
+	pageInfo := common.GetPageQuery(c)
+	query.TokenName = c.Query("token_name")
+	query.ModelName = c.Query("model_name")
+	query.SessionId = c.Query("session_id")
+	query.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	query.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	query.OrderBy = c.Query("order")
+	summaries, total, err := model.GetSessionSummaries(query, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(summaries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetAuditLogs(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	actorId, _ := strconv.Atoi(c.Query("actor_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	logs, total, err := model.GetAuditLogs(model.AuditLogQuery{
+		ActorId:        actorId,
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
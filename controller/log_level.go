@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LogLevelResponse struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"` // 各模块的生效级别
+	Config  map[string]string `json:"config"`  // 各模块单独配置的级别，空值表示沿用全局级别
+}
+
+type UpdateLogLevelRequest struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+}
+
+// GetLogLevel returns the global log level and the level of every module.
+func GetLogLevel(c *gin.Context) {
+	setting := operation_setting.GetLogLevelSetting()
+	response := LogLevelResponse{
+		Level:   logger.GetLevel(""),
+		Modules: make(map[string]string, len(logger.Modules)),
+		Config:  make(map[string]string, len(logger.Modules)),
+	}
+	for _, module := range logger.Modules {
+		response.Modules[module] = logger.GetLevel(module)
+		response.Config[module] = setting.Modules[module]
+	}
+	common.ApiSuccess(c, response)
+}
+
+// UpdateLogLevel changes the log levels at runtime, the change is stored as options and reaches other nodes
+// on the next option sync. Modules not present in the request keep their level, an empty level resets a
+// module to the global level.
+func UpdateLogLevel(c *gin.Context) {
+	var req UpdateLogLevelRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.Level != "" && !logger.IsValidLevel(req.Level) {
+		common.ApiErrorMsg(c, fmt.Sprintf("无效的日志级别: %s", req.Level))
+		return
+	}
+	setting := operation_setting.GetLogLevelSetting()
+	modules := make(map[string]string, len(logger.Modules))
+	for _, module := range logger.Modules {
+		modules[module] = setting.Modules[module]
+	}
+	for module, level := range req.Modules {
+		if !logger.IsValidModule(module) {
+			common.ApiErrorMsg(c, fmt.Sprintf("未知的日志模块: %s", module))
+			return
+		}
+		if level != "" && !logger.IsValidLevel(level) {
+			common.ApiErrorMsg(c, fmt.Sprintf("无效的日志级别: %s", level))
+			return
+		}
+		modules[module] = level
+	}
+
+	if req.Level != "" {
+		if err := model.UpdateOption("log_level_setting.level", req.Level); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	// 写入全部模块，空值会覆盖旧配置，否则配置合并时无法清除模块级别
+	modulesJson, err := common.Marshal(modules)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.UpdateOption("log_level_setting.modules", string(modulesJson)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.SysLog(fmt.Sprintf("log level updated by user %d: level=%s, modules=%s", c.GetInt("id"), logger.GetLevel(""), string(modulesJson)))
+	GetLogLevel(c)
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replayMaxDifferences 对比结果最多返回的差异条数
+const replayMaxDifferences = 200
+
+type logReplayRequest struct {
+	// ChannelId 重放使用的渠道，为 0 时使用原日志的渠道
+	ChannelId int `json:"channel_id"`
+	// Path 客户端请求的路径，为空时使用原日志记录的路径
+	Path string `json:"path"`
+}
+
+type replayDifference struct {
+	Path     string `json:"path"`
+	Original any    `json:"original"`
+	Replay   any    `json:"replay"`
+}
+
+// ReplayLog sends the request body captured in the detail of a log once more through the chosen channel. The
+// channel key is filled in on the server as for any relay, the replay runs as the current admin and is not
+// billed; its consume log is marked with replay_of. The response is compared with the captured one.
+func ReplayLog(c *gin.Context) {
+	logId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req logReplayRequest
+	if err = common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	original, err := model.GetLogById(logId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	detail, err := model.GetLogDetail(c.Request.Context(), logId, 0)
+	if err != nil {
+		common.ApiErrorMsg(c, "该日志没有保存请求内容，无法重放")
+		return
+	}
+	body := []byte(detail.RequestBody)
+	// 未开启对象存储时数据库中只保存截断后的预览，截断的请求体无法重放
+	if !json.Valid(body) {
+		common.ApiErrorMsg(c, "日志中的请求内容不完整，开启日志内容对象存储后才能重放较大的请求")
+		return
+	}
+
+	path := req.Path
+	if path == "" {
+		path = logRequestPath(original)
+	}
+	relayFormat, ok := previewRelayFormat(path)
+	if !ok {
+		common.ApiErrorMsg(c, "不支持重放该路径的请求: "+path)
+		return
+	}
+	modelName := previewModelName(path, body)
+	if modelName == "" {
+		modelName = original.ModelName
+	}
+	channelId := req.ChannelId
+	if channelId == 0 {
+		channelId = original.ChannelId
+	}
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	tc, w, info, err := newChannelRelayContext(c, channel, relayFormat, path, modelName, nil, body)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.SetContextKey(tc, constant.ContextKeyReplayOf, logId)
+	info.ReplayOf = logId
+	// 重放不受熔断影响，也不计入渠道统计
+	info.IsChannelTest = true
+	apiErr := relayByFormat(tc, relayFormat, info)
+
+	statusCode := w.Code
+	response := w.Body.String()
+	errMessage := ""
+	if apiErr != nil {
+		statusCode = apiErr.StatusCode
+		errMessage = apiErr.Error()
+		response = replayErrorBody(relayFormat, apiErr)
+	}
+	differences, equal := diffReplayResponses(string(detail.ResponseBody), response)
+	common.ApiSuccess(c, gin.H{
+		"log_id":            logId,
+		"channel_id":        channel.Id,
+		"model":             info.OriginModelName,
+		"upstream_model":    info.UpstreamModelName,
+		"status_code":       statusCode,
+		"error":             errMessage,
+		"response":          response,
+		"original_response": string(detail.ResponseBody),
+		"redacted":          detail.Redacted,
+		"equal":             equal,
+		"differences":       differences,
+	})
+}
+
+// logRequestPath 日志 other 字段中记录的请求路径，没有记录时按对话接口处理
+func logRequestPath(log *model.Log) string {
+	other, err := common.StrToMap(log.Other)
+	if err == nil && other != nil {
+		if path, ok := other["request_path"].(string); ok && path != "" {
+			return path
+		}
+	}
+	return "/v1/chat/completions"
+}
+
+// replayErrorBody 与正常转发时返回给客户端的错误格式一致，便于和原日志的响应对比
+func replayErrorBody(relayFormat types.RelayFormat, apiErr *types.NewAPIError) string {
+	if relayFormat == types.RelayFormatClaude {
+		return common.GetJsonString(gin.H{"type": "error", "error": apiErr.ToClaudeError()})
+	}
+	return common.GetJsonString(gin.H{"error": apiErr.ToOpenAIError()})
+}
+
+// diffReplayResponses compares the two responses field by field when both are json, otherwise as text.
+func diffReplayResponses(original string, replay string) ([]replayDifference, bool) {
+	if original == replay {
+		return []replayDifference{}, true
+	}
+	var originalValue, replayValue any
+	if common.Unmarshal([]byte(original), &originalValue) != nil || common.Unmarshal([]byte(replay), &replayValue) != nil {
+		return []replayDifference{{Path: "", Original: original, Replay: replay}}, false
+	}
+	originalFields := make(map[string]any)
+	replayFields := make(map[string]any)
+	flattenReplayJSON("", originalValue, originalFields)
+	flattenReplayJSON("", replayValue, replayFields)
+
+	paths := make([]string, 0, len(originalFields)+len(replayFields))
+	for path := range originalFields {
+		paths = append(paths, path)
+	}
+	for path := range replayFields {
+		if _, ok := originalFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	differences := make([]replayDifference, 0)
+	for _, path := range paths {
+		originalField, inOriginal := originalFields[path]
+		replayField, inReplay := replayFields[path]
+		if inOriginal && inReplay && originalField == replayField {
+			continue
+		}
+		differences = append(differences, replayDifference{Path: path, Original: originalField, Replay: replayField})
+		if len(differences) >= replayMaxDifferences {
+			break
+		}
+	}
+	return differences, len(differences) == 0
+}
+
+// flattenReplayJSON 将 JSON 展开为 路径 -> 标量值，空对象和空数组按字符串记录
+func flattenReplayJSON(prefix string, value any, out map[string]any) {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			out[prefix] = "{}"
+			return
+		}
+		for key, item := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenReplayJSON(path, item, out)
+		}
+	case []any:
+		if len(v) == 0 {
+			out[prefix] = "[]"
+			return
+		}
+		for i, item := range v {
+			flattenReplayJSON(fmt.Sprintf("%s[%d]", prefix, i), item, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+)
+
+// GetModelHistograms returns the per model distribution of prompt tokens, completion tokens and
+// request body size observed by this node.
+func GetModelHistograms(c *gin.Context) {
+	histograms := service.GetModelHistograms()
+	if modelName := strings.TrimSpace(c.Query("model")); modelName != "" {
+		filtered := make(map[string]map[string]service.HistogramSnapshot, 1)
+		if h, ok := histograms[modelName]; ok {
+			filtered[modelName] = h
+		}
+		histograms = filtered
+	}
+	common.ApiSuccess(c, histograms)
+}
+
+// GetPrometheusMetrics exposes the metrics in the Prometheus text format, authorized by METRICS_TOKEN.
+func GetPrometheusMetrics(c *gin.Context) {
+	if common.MetricsToken == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(common.MetricsToken)) != 1 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := service.WriteModelHistogramMetrics(c.Writer); err != nil {
+		common.SysLog("failed to write metrics: " + err.Error())
+		return
+	}
+	if err := service.WriteSLOMetrics(c.Writer); err != nil {
+		common.SysLog("failed to write slo metrics: " + err.Error())
+		return
+	}
+	if err := service.WriteRelayMetrics(c.Writer); err != nil {
+		common.SysLog("failed to write relay metrics: " + err.Error())
+		return
+	}
+	if err := service.WriteEmbeddingCacheMetrics(c.Writer); err != nil {
+		common.SysLog("failed to write embedding cache metrics: " + err.Error())
+		return
+	}
+	if err := service.WriteCompletionCacheMetrics(c.Writer); err != nil {
+		common.SysLog("failed to write completion cache metrics: " + err.Error())
+		return
+	}
+	if err := service.WriteRequestQueueMetrics(c.Writer); err != nil {
+		common.SysLog("failed to write request queue metrics: " + err.Error())
+	}
+}
+
+// GetSLOStatuses returns the error budget of every model with an SLO target observed by this node,
+// filtered by model when given.
+func GetSLOStatuses(c *gin.Context) {
+	statuses := service.GetSLOStatuses()
+	if modelName := strings.TrimSpace(c.Query("model")); modelName != "" {
+		filtered := make([]service.SLOStatus, 0, 1)
+		for _, status := range statuses {
+			if status.Model == modelName {
+				filtered = append(filtered, status)
+			}
+		}
+		statuses = filtered
+	}
+	common.ApiSuccess(c, statuses)
+}
+
+// PreviewUsageSharingReport returns the report that would be shared for the last interval, so operators
+// can check exactly what leaves the instance before enabling usage sharing.
+func PreviewUsageSharingReport(c *gin.Context) {
+	interval := operation_setting.GetUsageSharingSetting().IntervalMinutes
+	if interval <= 0 {
+		interval = 60
+	}
+	end := time.Now().Unix()
+	report, err := service.BuildUsageSharingReport(end-int64(interval)*60, end)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, report)
+}
+
+func buildReportDigest(c *gin.Context) (*service.ReportDigest, bool) {
+	frequency := c.DefaultQuery("frequency", operation_setting.GetReportDigestSetting().Frequency)
+	if frequency != operation_setting.ReportDigestDaily && frequency != operation_setting.ReportDigestWeekly {
+		common.ApiErrorMsg(c, "无效的报告频率")
+		return nil, false
+	}
+	digest, err := service.BuildReportDigest(frequency, time.Now())
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return digest, true
+}
+
+// PreviewReportDigest builds the admin report digest for the period ending now without sending it.
+func PreviewReportDigest(c *gin.Context) {
+	digest, ok := buildReportDigest(c)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"digest":  digest,
+		"title":   digest.Title(),
+		"content": digest.Render(),
+	})
+}
+
+// SendReportDigest sends the admin report digest for the period ending now, to check the notification setup.
+func SendReportDigest(c *gin.Context) {
+	digest, ok := buildReportDigest(c)
+	if !ok {
+		return
+	}
+	if err := service.SendReportDigest(digest); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -10,6 +11,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay"
+	relaychannel "github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/ai360"
 	"github.com/QuantumNous/new-api/relay/channel/lingyiwanwu"
 	"github.com/QuantumNous/new-api/relay/channel/minimax"
@@ -104,6 +106,33 @@ func init() {
 		adaptor.Init(meta)
 		channelId2Models[i] = adaptor.GetModelList()
 	}
+	// 第三方适配器的渠道类型不在内置范围内，单独加入
+	for _, adaptorMeta := range relaychannel.RegisteredAdaptors() {
+		if adaptorMeta.Builtin {
+			continue
+		}
+		for _, channelType := range adaptorMeta.ChannelTypes {
+			meta := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{
+				ChannelType: channelType,
+			}}
+			adaptor := relay.GetAdaptor(adaptorMeta.APIType)
+			adaptor.Init(meta)
+			modelNames := adaptor.GetModelList()
+			channelId2Models[channelType] = modelNames
+			for _, modelName := range modelNames {
+				aiModel := dto.OpenAIModels{
+					Id:      modelName,
+					Object:  "model",
+					Created: 1626777600,
+					OwnedBy: adaptorMeta.Name,
+				}
+				openAIModels = append(openAIModels, aiModel)
+				if _, ok := openAIModelsMap[modelName]; !ok {
+					openAIModelsMap[modelName] = aiModel
+				}
+			}
+		}
+	}
 	openAIModels = lo.UniqBy(openAIModels, func(m dto.OpenAIModels) string {
 		return m.Id
 	})
@@ -123,16 +152,32 @@ func ListModels(c *gin.Context, modelType int) {
 		}
 	}
 
+	aliasSetting := operation_setting.GetModelAliasSetting()
+	visibilityGroup := service.ModelVisibilityGroup(c, common.GetContextKeyString(c, constant.ContextKeyUsingGroup))
+
 	modelLimitEnable := common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled)
 	if modelLimitEnable {
 		s, ok := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
 		var tokenModelLimit map[string]bool
+		tokenModelLimit = map[string]bool{}
 		if ok {
-			tokenModelLimit = s.(map[string]bool)
-		} else {
-			tokenModelLimit = map[string]bool{}
+			for allowModel := range s.(map[string]bool) {
+				tokenModelLimit[allowModel] = true
+			}
+		}
+		// 令牌允许的模型类别中明确列出的模型，按前缀匹配的模型无法列出
+		classes, _ := common.GetContextKeyType[[]string](c, constant.ContextKeyTokenModelClasses)
+		for _, class := range classes {
+			for _, pattern := range operation_setting.GetModelClassSetting().Classes[class] {
+				if !strings.HasSuffix(pattern, "*") {
+					tokenModelLimit[pattern] = true
+				}
+			}
 		}
 		for allowModel, _ := range tokenModelLimit {
+			if !aliasSetting.IsModelVisible(visibilityGroup, allowModel) {
+				continue
+			}
 			if !acceptUnsetRatioModel {
 				_, _, exist := ratio_setting.GetModelRatioOrPrice(allowModel)
 				if !exist {
@@ -180,15 +225,21 @@ func ListModels(c *gin.Context, modelType int) {
 		} else {
 			models = model.GetGroupEnabledModels(group)
 		}
+		models = service.FilterVisibleModels(visibilityGroup, models)
 		for _, modelName := range models {
+			// 别名按目标模型计费，价格和支持的端点取第一个目标
+			priceModel := modelName
+			if alias := aliasSetting.GetAlias(modelName); aliasSetting.Enabled && alias != nil {
+				priceModel = alias.Targets[0].Model
+			}
 			if !acceptUnsetRatioModel {
-				_, _, exist := ratio_setting.GetModelRatioOrPrice(modelName)
+				_, _, exist := ratio_setting.GetModelRatioOrPrice(priceModel)
 				if !exist {
 					continue
 				}
 			}
 			if oaiModel, ok := openAIModelsMap[modelName]; ok {
-				oaiModel.SupportedEndpointTypes = model.GetModelSupportEndpointTypes(modelName)
+				oaiModel.SupportedEndpointTypes = model.GetModelSupportEndpointTypes(priceModel)
 				userOpenAiModels = append(userOpenAiModels, oaiModel)
 			} else {
 				userOpenAiModels = append(userOpenAiModels, dto.OpenAIModels{
@@ -196,7 +247,7 @@ func ListModels(c *gin.Context, modelType int) {
 					Object:                 "model",
 					Created:                1626777600,
 					OwnedBy:                "custom",
-					SupportedEndpointTypes: model.GetModelSupportEndpointTypes(modelName),
+					SupportedEndpointTypes: model.GetModelSupportEndpointTypes(priceModel),
 				})
 			}
 		}
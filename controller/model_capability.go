@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetModelCapabilities returns the built-in and admin configured capability tables, with ?model= it also
+// returns the capability the pre-check would apply to that model.
+func GetModelCapabilities(c *gin.Context) {
+	data := gin.H{
+		"enabled": model_setting.GetModelCapabilitySettings().Enabled,
+		"builtin": model_setting.GetBuiltinModelCapabilities(),
+		"custom":  model_setting.GetModelCapabilitySettings().Capabilities,
+	}
+	if modelName := strings.TrimSpace(c.Query("model")); modelName != "" {
+		if capability, ok := model_setting.GetModelCapability(modelName); ok {
+			data["matched"] = capability
+		}
+	}
+	common.ApiSuccess(c, data)
+}
@@ -131,6 +131,9 @@ func getHTTPClient() *http.Client {
 }
 
 func fetchJSON[T any](ctx context.Context, url string, out *upstreamEnvelope[T]) error {
+	if err := common.CheckOutboundAllowed("upstream model sync"); err != nil {
+		return err
+	}
 	var lastErr error
 	attempts := common.GetEnvOrDefault("SYNC_HTTP_RETRY", 3)
 	if attempts < 1 {
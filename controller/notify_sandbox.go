@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNotifySandboxEvents lists the notification and alert events the sandbox can trigger.
+func GetNotifySandboxEvents(c *gin.Context) {
+	common.ApiSuccess(c, service.NotifySandboxEvents())
+}
+
+// GetNotifySandboxAttempts lists the recent sandbox attempts handled by this node.
+func GetNotifySandboxAttempts(c *gin.Context) {
+	common.ApiSuccess(c, service.GetNotifySandboxAttempts())
+}
+
+// SendNotifySandbox sends an event with synthetic data and returns the payload, signature and response.
+func SendNotifySandbox(c *gin.Context) {
+	var req service.NotifySandboxRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	attempt, err := service.SendNotifySandbox(c.GetInt("id"), req)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, attempt)
+}
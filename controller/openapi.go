@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 管理接口的 OpenAPI 3 描述，由已注册的 /api 路由生成，不包含中转接口。
+// 请求体结构通过 openAPIRequestBodies 按处理函数名登记，新增管理接口时在此补充即可。
+
+var openAPIRequestBodies = map[string]any{
+	"Login":               LoginRequest{},
+	"Register":            model.User{},
+	"CreateUser":          model.User{},
+	"UpdateUser":          model.User{},
+	"ManageUser":          ManageRequest{},
+	"TopUp":               topUpRequest{},
+	"AddChannel":          AddChannelRequest{},
+	"UpdateChannel":       PatchChannel{},
+	"AddToken":            model.Token{},
+	"UpdateToken":         model.Token{},
+	"AddRedemption":       model.Redemption{},
+	"UpdateRedemption":    model.Redemption{},
+	"UpdateOption":        OptionUpdateRequest{},
+	"CreateModelMeta":     model.Model{},
+	"UpdateModelMeta":     model.Model{},
+	"CreateVendorMeta":    model.Vendor{},
+	"UpdateVendorMeta":    model.Vendor{},
+	"CreatePrefillGroup":  model.PrefillGroup{},
+	"UpdatePrefillGroup":  model.PrefillGroup{},
+	"StartImpersonation":  impersonationRequest{},
+	"UpsertChannelByName": model.Channel{},
+	"UpsertTokenByName":   model.Token{},
+	"UpsertGroup":         GroupUpsertRequest{},
+	"DeleteSelf":          DeleteSelfRequest{},
+}
+
+var (
+	openAPISpecOnce  sync.Once
+	openAPISpec      map[string]any
+	openAPIPathParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+)
+
+// GetOpenAPISpec serves the OpenAPI document of the management API registered on the engine.
+func GetOpenAPISpec(engine *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		openAPISpecOnce.Do(func() {
+			openAPISpec = buildOpenAPISpec(engine.Routes())
+		})
+		c.JSON(http.StatusOK, openAPISpec)
+	}
+}
+
+func buildOpenAPISpec(routes gin.RoutesInfo) map[string]any {
+	schemas := make(map[string]any)
+	paths := make(map[string]map[string]any)
+	operationIds := make(map[string]int)
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, "/api/") || route.Path == "/api/openapi.json" {
+			continue
+		}
+		handlerName := route.Handler[strings.LastIndex(route.Handler, ".")+1:]
+		if strings.HasPrefix(handlerName, "func") {
+			handlerName = ""
+		}
+		path := openAPIPathParam.ReplaceAllString(route.Path, "{$1}")
+
+		operation := map[string]any{
+			"tags":      []string{openAPITag(route.Path)},
+			"responses": openAPIResponses(),
+		}
+		if handlerName != "" {
+			operationId := handlerName
+			if n := operationIds[handlerName]; n > 0 {
+				operationId = handlerName + strings.ToUpper(route.Method[:1]) + strings.ToLower(route.Method[1:])
+			}
+			operationIds[handlerName]++
+			operation["operationId"] = operationId
+			operation["summary"] = openAPISummary(handlerName)
+		}
+		if params := openAPIPathParam.FindAllStringSubmatch(route.Path, -1); len(params) > 0 {
+			parameters := make([]map[string]any, 0, len(params))
+			for _, param := range params {
+				parameters = append(parameters, map[string]any{
+					"name":     param[1],
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]any{"type": "string"},
+				})
+			}
+			operation["parameters"] = parameters
+		}
+		if body, ok := openAPIRequestBodies[handlerName]; ok && route.Method != http.MethodGet {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": openAPISchema(reflect.TypeOf(body), schemas)},
+				},
+			}
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       common.SystemName + " Management API",
+			"version":     common.Version,
+			"description": "管理接口使用网页登录的 session cookie，或在 Authorization 头中携带系统访问令牌并同时提供 New-Api-User 头（用户 ID）。",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"session":     map[string]any{"type": "apiKey", "in": "cookie", "name": "session"},
+				"accessToken": map[string]any{"type": "http", "scheme": "bearer"},
+				"userId":      map[string]any{"type": "apiKey", "in": "header", "name": "New-Api-User"},
+			},
+		},
+		"security": []map[string][]string{
+			{"session": {}},
+			{"accessToken": {}, "userId": {}},
+		},
+	}
+}
+
+func openAPITag(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/api/"), "/")
+	if len(segments) == 0 || segments[0] == "" || strings.HasPrefix(segments[0], ":") {
+		return "misc"
+	}
+	return segments[0]
+}
+
+// openAPISummary turns a handler name like GetAllChannels into "Get all channels".
+func openAPISummary(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			prev := rune(name[i-1])
+			if prev < 'A' || prev > 'Z' {
+				sb.WriteByte(' ')
+			}
+		}
+		if i > 0 {
+			sb.WriteString(strings.ToLower(string(r)))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func openAPIResponses() map[string]any {
+	return map[string]any{
+		"200": map[string]any{
+			"description": "success 为 false 时 message 包含错误信息",
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"success": map[string]any{"type": "boolean"},
+							"message": map[string]any{"type": "string"},
+							"data":    map[string]any{},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+var openAPITimeType = reflect.TypeOf(time.Time{})
+
+// openAPISchema describes t following its json tags, named structs are put into components.
+func openAPISchema(t reflect.Type, schemas map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == openAPITimeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string"}
+		}
+		return map[string]any{"type": "array", "items": openAPISchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return openAPIStructSchema(t, schemas)
+		}
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = map[string]any{"type": "object"} // 占位，避免递归类型死循环
+			schemas[name] = openAPIStructSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+func openAPIStructSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := make(map[string]any)
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" {
+				embedded := field.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					collect(embedded)
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = openAPISchema(field.Type, schemas)
+		}
+	}
+	collect(t)
+	return map[string]any{"type": "object", "properties": properties}
+}
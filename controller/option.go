@@ -9,6 +9,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/console_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -18,6 +19,19 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// maskOptionSecrets hides the credentials nested in the JSON options, which are kept on save when left empty.
+func maskOptionSecrets(key string, value string) string {
+	switch key {
+	case "sso.providers":
+		return system_setting.MaskSSOProviderSecrets(value)
+	case "alert_setting.webhooks":
+		return operation_setting.MaskAlertWebhookSecrets(value)
+	case "otel_setting.headers":
+		return system_setting.MaskOtelHeaders(value)
+	}
+	return value
+}
+
 func GetOptions(c *gin.Context) {
 	var options []*model.Option
 	common.OptionMapRWMutex.Lock()
@@ -29,9 +43,10 @@ func GetOptions(c *gin.Context) {
 			strings.HasSuffix(k, "api_key") {
 			continue
 		}
+		value := maskOptionSecrets(k, common.Interface2String(v))
 		options = append(options, &model.Option{
 			Key:   k,
-			Value: common.Interface2String(v),
+			Value: value,
 		})
 	}
 	common.OptionMapRWMutex.Unlock()
@@ -153,6 +168,44 @@ func UpdateOption(c *gin.Context) {
 		}
 		days := int(parsedFloat)
 		option.Value = strconv.Itoa(days)
+	case "LogPayloadMaxRunes":
+		limit, parseErr := strconv.Atoi(fmt.Sprintf("%v", option.Value))
+		if parseErr != nil || limit < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "日志内容长度上限必须是非负整数，0 表示不截断",
+			})
+			return
+		}
+		option.Value = strconv.Itoa(limit)
+	case "LogPayloadSuccessSampleRate", "LogPayloadErrorSampleRate":
+		rate, parseErr := strconv.Atoi(fmt.Sprintf("%v", option.Value))
+		if parseErr != nil || rate < 0 || rate > 100 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "采样比例必须是 0 到 100 之间的整数",
+			})
+			return
+		}
+		option.Value = strconv.Itoa(rate)
+	case "LogPayloadRouteLimits":
+		err = common.UpdateLogPayloadRouteLimitsByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "路由日志内容长度上限设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "LogRedactionRules":
+		err = common.UpdateLogRedactionRulesByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "日志脱敏规则设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "GroupRatio":
 		err = ratio_setting.CheckGroupRatio(option.Value.(string))
 		if err != nil {
@@ -189,6 +242,42 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "AudioInputSecondPrice":
+		err = ratio_setting.UpdateAudioInputSecondPriceByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "音频输入按秒价格设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "AudioOutputTokenPrice":
+		err = ratio_setting.UpdateAudioOutputTokenPriceByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "音频输出价格设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "AudioCharacterPrice":
+		err = ratio_setting.UpdateAudioCharacterPriceByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "语音合成按字符价格设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "ImageGenerationPrice":
+		err = ratio_setting.UpdateImageGenerationPriceByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "图片按张价格设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "ModelRequestRateLimitGroup":
 		err = setting.CheckModelRequestRateLimitGroup(option.Value.(string))
 		if err != nil {
@@ -198,6 +287,15 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ModelRequestRateLimitStrictGroups":
+		err = setting.CheckModelRequestRateLimitStrictGroups(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "AutomaticDisableStatusCodes":
 		_, err = operation_setting.ParseHTTPStatusCodeRanges(option.Value.(string))
 		if err != nil {
@@ -243,6 +341,46 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "admin_rbac.roles":
+		value, err := system_setting.ValidateAdminRoles(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		option.Value = value
+	case "sso.providers":
+		merged, err := system_setting.MergeSSOProviders(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		option.Value = merged
+	case "alert_setting.webhooks":
+		merged, err := operation_setting.MergeAlertWebhooks(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		option.Value = merged
+	case "otel_setting.headers":
+		merged, err := system_setting.MergeOtelHeaders(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		option.Value = merged
 	case "console_setting.uptime_kuma_groups":
 		err = console_setting.ValidateConsoleSettings(option.Value.(string), "UptimeKumaGroups")
 		if err != nil {
@@ -253,11 +391,19 @@ func UpdateOption(c *gin.Context) {
 			return
 		}
 	}
+	common.OptionMapRWMutex.RLock()
+	previous, existed := common.OptionMap[option.Key]
+	common.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value.(string))
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	var before map[string]any
+	if existed {
+		before = map[string]any{option.Key: maskOptionSecrets(option.Key, common.Interface2String(previous))}
+	}
+	service.RecordAudit(c, "option.update", service.AuditTargetOption, option.Key, before, map[string]any{option.Key: maskOptionSecrets(option.Key, option.Value.(string))})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
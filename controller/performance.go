@@ -1,12 +1,17 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/gin-gonic/gin"
 )
 
@@ -36,6 +41,8 @@ type MemoryStats struct {
 	NumGC uint32 `json:"num_gc"`
 	// Goroutine 数量
 	NumGoroutine int `json:"num_goroutine"`
+	// 在途请求缓冲内存记账
+	RequestMemory common.RequestMemoryStats `json:"request_memory"`
 }
 
 // DiskCacheInfo 磁盘缓存目录信息
@@ -104,11 +111,12 @@ func GetPerformanceStats(c *gin.Context) {
 	stats := PerformanceStats{
 		CacheStats: cacheStats,
 		MemoryStats: MemoryStats{
-			Alloc:        memStats.Alloc,
-			TotalAlloc:   memStats.TotalAlloc,
-			Sys:          memStats.Sys,
-			NumGC:        memStats.NumGC,
-			NumGoroutine: runtime.NumGoroutine(),
+			Alloc:         memStats.Alloc,
+			TotalAlloc:    memStats.TotalAlloc,
+			Sys:           memStats.Sys,
+			NumGC:         memStats.NumGC,
+			NumGoroutine:  runtime.NumGoroutine(),
+			RequestMemory: common.GetRequestMemoryStats(),
 		},
 		DiskCacheInfo: diskCacheInfo,
 		DiskSpaceInfo: diskSpaceInfo,
@@ -199,3 +207,83 @@ func getDiskCacheInfo() DiskCacheInfo {
 
 	return info
 }
+
+// GetEmbeddingCacheStats 获取嵌入缓存配置和当前节点各模型的命中率
+func GetEmbeddingCacheStats(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"setting": operation_setting.GetEmbeddingCacheSetting(),
+		"models":  service.GetEmbeddingCacheStats(),
+	})
+}
+
+// ClearEmbeddingCache 清空嵌入缓存
+func ClearEmbeddingCache(c *gin.Context) {
+	if err := service.PurgeEmbeddingCache(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetCompletionCacheStats 获取对话响应缓存配置和当前节点各模型的命中率
+func GetCompletionCacheStats(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"setting": operation_setting.GetResponseCacheSetting(),
+		"models":  service.GetCompletionCacheStats(),
+	})
+}
+
+// GetRequestQueueStats 获取请求排队配置和当前节点的排队深度、等待统计
+func GetRequestQueueStats(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"setting": operation_setting.GetRequestQueueSetting(),
+		"stats":   service.GetRequestQueueStats(),
+	})
+}
+
+// ClearCompletionCache 清空对话响应缓存
+func ClearCompletionCache(c *gin.Context) {
+	if err := service.PurgeCompletionCache(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetSQLiteStatus 获取 SQLite 的日志模式、WAL 大小和最近一次 checkpoint
+func GetSQLiteStatus(c *gin.Context) {
+	status, err := model.GetSQLiteStatus()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, status)
+}
+
+// CheckpointSQLite 立即执行一次 checkpoint，默认使用配置的模式
+func CheckpointSQLite(c *gin.Context) {
+	mode := c.DefaultQuery("mode", common.SQLiteCheckpointMode)
+	result, err := model.CheckpointSQLite(mode)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, result)
+}
+
+// BackupSQLite 在线备份 SQLite 数据库并作为附件下载，备份期间服务不停止
+func BackupSQLite(c *gin.Context) {
+	dir, err := os.MkdirTemp("", "new-api-backup-")
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "backup.db")
+	if err := model.BackupSQLite(dst); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.SysLog(fmt.Sprintf("sqlite backup downloaded by user %d", c.GetInt("id")))
+	c.FileAttachment(dst, fmt.Sprintf("new-api-%s.db", time.Now().Format("20060102-150405")))
+}
@@ -1,17 +1,27 @@
 package controller
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
 )
 
+// playgroundPresetMaxBytes 单个预设内容的大小上限
+const playgroundPresetMaxBytes = 256 * 1024
+
 func Playground(c *gin.Context) {
 	var newAPIError *types.NewAPIError
 
@@ -45,12 +55,128 @@ func Playground(c *gin.Context) {
 	}
 	userCache.WriteContext(c)
 
-	tempToken := &model.Token{
-		UserId: userId,
-		Name:   fmt.Sprintf("playground-%s", relayInfo.UsingGroup),
-		Group:  relayInfo.UsingGroup,
+	// 未选择令牌时使用临时令牌，只扣除用户额度
+	if c.GetInt("token_id") == 0 {
+		tempToken := &model.Token{
+			UserId: userId,
+			Name:   fmt.Sprintf("playground-%s", relayInfo.UsingGroup),
+			Group:  relayInfo.UsingGroup,
+		}
+		_ = middleware.SetupContextForToken(c, tempToken)
 	}
-	_ = middleware.SetupContextForToken(c, tempToken)
 
 	Relay(c, types.RelayFormatOpenAI)
 }
+
+// GetPlaygroundModels lists the models the playground can use, for the selected token when token_id is given,
+// otherwise for the group chosen in the console.
+func GetPlaygroundModels(c *gin.Context) {
+	userId := c.GetInt("id")
+	user, err := model.GetUserCache(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	group := c.Query("group")
+	var token *model.Token
+	if tokenId, _ := strconv.Atoi(c.Query("token_id")); tokenId != 0 {
+		token, err = model.GetTokenByIds(tokenId, userId)
+		if err != nil {
+			common.ApiErrorMsg(c, "令牌不存在")
+			return
+		}
+		group = token.Group
+	}
+	if group == "" {
+		group = user.Group
+	}
+	if !service.GroupInUserUsableGroups(user.Group, group) {
+		common.ApiErrorMsg(c, fmt.Sprintf("无权访问 %s 分组", group))
+		return
+	}
+	groups := []string{group}
+	if group == "auto" {
+		groups = service.GetUserAutoGroup(user.Group)
+	}
+	models := make([]string, 0)
+	for _, g := range groups {
+		for _, m := range model.GetGroupEnabledModels(g) {
+			if token != nil && !token.AllowsModel(m) {
+				continue
+			}
+			if !common.StringsContains(models, m) {
+				models = append(models, m)
+			}
+		}
+	}
+	sort.Strings(models)
+	common.ApiSuccess(c, gin.H{
+		"group":  group,
+		"models": models,
+	})
+}
+
+// GetPlaygroundPresets lists the prompt presets of the user, without their content.
+func GetPlaygroundPresets(c *gin.Context) {
+	presets, err := model.GetPlaygroundPresets(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, presets)
+}
+
+func GetPlaygroundPreset(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的预设 ID")
+		return
+	}
+	preset, err := model.GetPlaygroundPreset(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, preset)
+}
+
+// SavePlaygroundPreset saves a prompt preset, a preset with the same name is overwritten.
+func SavePlaygroundPreset(c *gin.Context) {
+	var preset model.PlaygroundPreset
+	if err := common.DecodeJson(c.Request.Body, &preset); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	preset.Name = strings.TrimSpace(preset.Name)
+	if preset.Name == "" || utf8.RuneCountInString(preset.Name) > 64 {
+		common.ApiErrorMsg(c, "预设名称不能为空且不能超过 64 个字符")
+		return
+	}
+	if len(preset.Content) == 0 || !json.Valid(preset.Content) {
+		common.ApiErrorMsg(c, "预设内容必须是有效的 JSON")
+		return
+	}
+	if len(preset.Content) > playgroundPresetMaxBytes {
+		common.ApiErrorMsg(c, "预设内容过大")
+		return
+	}
+	preset.UserId = c.GetInt("id")
+	if err := model.SavePlaygroundPreset(&preset); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, preset)
+}
+
+func DeletePlaygroundPreset(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的预设 ID")
+		return
+	}
+	if err = model.DeletePlaygroundPreset(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -49,6 +50,37 @@ func GetPricing(c *gin.Context) {
 	})
 }
 
+// GetModelCatalog 模型广场：按关键词、供应商、标签、类别、分组、输入类型、端点筛选可用模型，价格按用户可用分组计算
+func GetModelCatalog(c *gin.Context) {
+	var group string
+	if userId := c.GetInt("id"); userId != 0 {
+		if user, err := model.GetUserCache(userId); err == nil {
+			group = user.Group
+		}
+	}
+	items, facets := service.GetModelCatalog(group, service.CatalogQuery{
+		Keyword:  c.Query("keyword"),
+		Vendor:   c.Query("vendor"),
+		Tag:      c.Query("tag"),
+		Category: c.Query("category"),
+		Group:    c.Query("group"),
+		Modality: c.Query("modality"),
+		Endpoint: c.Query("endpoint"),
+		ToolCall: c.Query("tool_call") == "true",
+	})
+	pageInfo := common.GetPageQuery(c)
+	pageInfo.SetTotal(len(items))
+	start := min(pageInfo.GetStartIdx(), len(items))
+	end := min(start+pageInfo.GetPageSize(), len(items))
+	pageInfo.SetItems(items[start:end])
+	c.JSON(200, gin.H{
+		"success": true,
+		"message": "",
+		"data":    pageInfo,
+		"facets":  facets,
+	})
+}
+
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := ratio_setting.DefaultModelRatio2JSONString()
 	err := model.UpdateOption("ModelRatio", defaultStr)
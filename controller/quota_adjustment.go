@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdjustUserQuotaRequest struct {
+	// Quota 大于 0 增加额度，小于 0 扣减额度
+	Quota    int    `json:"quota"`
+	Category string `json:"category"`
+	Reason   string `json:"reason"`
+}
+
+// AdjustUserQuota adds or deducts the quota of a user with a mandatory reason, recorded as an adjustment log.
+func AdjustUserQuota(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req AdjustUserQuotaRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		common.ApiErrorMsg(c, "调整原因不能为空")
+		return
+	}
+	if len([]rune(req.Reason)) > 500 {
+		common.ApiErrorMsg(c, "调整原因不能超过 500 个字符")
+		return
+	}
+	if req.Quota == 0 {
+		common.ApiErrorMsg(c, "调整额度不能为 0")
+		return
+	}
+	if !model.IsValidQuotaAdjustmentCategory(req.Category) {
+		common.ApiErrorMsg(c, fmt.Sprintf("未知的调整类型: %s", req.Category))
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		common.ApiErrorMsg(c, "无权调整同权限等级或更高权限等级用户的额度")
+		return
+	}
+	err = model.AdjustUserQuota(model.QuotaAdjustment{
+		UserId:        user.Id,
+		Delta:         req.Quota,
+		Category:      req.Category,
+		Reason:        req.Reason,
+		AdminId:       c.GetInt("id"),
+		AdminUsername: c.GetString("username"),
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.SysLog(fmt.Sprintf("quota of user %d adjusted by %d (%s) by user %d", user.Id, req.Quota, req.Category, c.GetInt("id")))
+	quota, err := model.GetUserQuota(user.Id, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, "user.quota_adjust", service.AuditTargetUser, user.Id, gin.H{"quota": user.Quota},
+		gin.H{"quota": quota, "delta": req.Quota, "category": req.Category, "reason": req.Reason})
+	common.ApiSuccess(c, gin.H{
+		"quota": quota,
+	})
+}
@@ -7,7 +7,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -15,6 +17,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/otel"
 	"github.com/QuantumNous/new-api/relay"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
@@ -65,15 +68,15 @@ func geminiRelayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewA
 
 func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
+	service.EndOtelMiddlewareSpan(c)
+	// 后台模式的 Responses 请求排队后立即返回
+	if relayFormat == types.RelayFormatOpenAIResponses && acceptBackgroundResponse(c) {
+		return
+	}
 	requestId := c.GetString(common.RequestIdKey)
 	// group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
 	// originalModel := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
 	
-	if relayFormat == types.RelayFormatOpenAIRealtime {
-		common.CapturePayloadStringForLog(c, constant.ContextKeyLoggedRequestBody, "[websocket stream request]")
-		common.CapturePayloadStringForLog(c, constant.ContextKeyLoggedResponseBody, "[websocket stream response]")
-	}
-
 	var (
 		newAPIError *types.NewAPIError
 		ws          *websocket.Conn
@@ -92,6 +95,14 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	defer func() {
 		if newAPIError != nil {
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
+			// 按渠道规则改写返回给客户端的错误消息，上面的日志和错误日志保留原始消息
+			service.RewriteChannelError(c, newAPIError)
+			// 上游限流时告知客户端额度重置前需要等待的时间
+			if newAPIError.StatusCode == http.StatusTooManyRequests && newAPIError.RetryAfter > 0 {
+				retryAfter := service.RetryAfterSeconds(newAPIError.RetryAfter)
+				c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+				newAPIError.SetMessage(fmt.Sprintf("%s (retry after %ds)", newAPIError.Error(), retryAfter))
+			}
 			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
 			switch relayFormat {
 			case types.RelayFormatOpenAIRealtime:
@@ -118,6 +129,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		// Map "request body too large" to 413 so clients can handle it correctly
 		if common.IsRequestBodyTooLargeError(err) || errors.Is(err, common.ErrRequestBodyTooLarge) {
 			newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+		} else if common.IsRequestMemoryError(err) {
+			c.Header("Retry-After", "1")
+			newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
 		} else {
 			newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest)
 		}
@@ -130,11 +144,18 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	service.RecordSessionId(c, request)
+	service.StartRequestTrace(c, relayInfo)
+	defer func() {
+		service.FinishRequestTrace(c, relayInfo, newAPIError)
+	}()
+
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
 	needCountToken := constant.CountToken
-	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
+	needModeration := operation_setting.GetModerationSetting().IsEnabledForGroup(relayInfo.UserGroup)
+	// Avoid building huge CombineText (strings.Join) when token counting, sensitive check and moderation are all disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needCountToken || needModeration {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
@@ -149,6 +170,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	if needModeration {
+		if newAPIError = service.ModerateRequest(c, relayInfo, meta); newAPIError != nil {
+			return
+		}
+	}
+
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
@@ -165,10 +192,36 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	// common.SetContextKey(c, constant.ContextKeyTokenCountMeta, meta)
 
+	// 记录模型需求，供自建后端的扩缩容使用
+	demandTokens := tokens
+	if meta != nil {
+		demandTokens += meta.MaxTokens
+	}
+	demand := service.TrackModelDemand(relayInfo.OriginModelName, demandTokens)
+	relayInfo.OnFirstResponse = demand.MarkResponding
+	defer demand.Done()
+
+	if newAPIError = service.CheckModelCapability(relayInfo, tokens, meta); newAPIError != nil {
+		return
+	}
+
+	if newAPIError = service.CheckModelClassQuota(c, relayInfo, tokens); newAPIError != nil {
+		return
+	}
+
+	if newAPIError = service.CheckTokenBudget(c, relayInfo, tokens); newAPIError != nil {
+		return
+	}
+
+	if newAPIError = service.CheckTPMLimit(c, relayInfo, tokens); newAPIError != nil {
+		return
+	}
+
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
 	} else {
-		newAPIError = service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo)
+		quotaToPreConsume := service.ReserveStreamQuota(c, relayInfo, priceData.QuotaToPreConsume, meta)
+		newAPIError = service.PreConsumeBilling(c, quotaToPreConsume, relayInfo)
 		if newAPIError != nil {
 			return
 		}
@@ -178,13 +231,20 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		// Only return quota if downstream failed and quota was actually pre-consumed
 		if newAPIError != nil {
 			newAPIError = service.NormalizeViolationFeeError(newAPIError)
-			if relayInfo.FinalPreConsumedQuota != 0 {
-				service.ReturnPreConsumedQuota(c, relayInfo)
+			if !relayInfo.UsageSettled {
+				if relayInfo.FinalPreConsumedQuota != 0 {
+					service.ReturnPreConsumedQuota(c, relayInfo)
+				}
+				service.ReleaseTPMUsage(c, relayInfo)
 			}
 			service.ChargeViolationFeeIfNeeded(c, relayInfo, newAPIError)
 		}
 	}()
 
+	defer func() {
+		service.RecordSLORequest(relayInfo, newAPIError)
+	}()
+
 	retryParam := &service.RetryParam{
 		Ctx:        c,
 		TokenGroup: relayInfo.TokenGroup,
@@ -193,19 +253,37 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 
 	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
+		selectSpan := service.StartOtelSpan(c, "channel selection", otel.SpanKindInternal)
+		selectStart := time.Now()
+		selectModel := relayInfo.OriginModelName
 		channel, channelErr := getChannel(c, relayInfo, retryParam)
+		service.AddLatencyRouting(c, time.Since(selectStart))
 		if channelErr != nil {
+			service.EndOtelSpan(selectSpan, channelErr)
 			logger.LogError(c, channelErr.Error())
 			newAPIError = channelErr
 			break
 		}
+		service.TraceOtelChannel(selectSpan, channel.Id, channel.Name, retryParam.GetRetry())
+		service.EndOtelSpan(selectSpan, nil)
 
+		service.TraceRouting(c, relayInfo, channel, retryParam.GetRetry())
 		addUsedChannel(c, channel.Id)
+		if retryParam.GetRetry() > 0 || relayInfo.OriginModelName != selectModel {
+			// 渠道可能覆盖模型价格，切换渠道或别名切换目标模型后重新计算价格
+			if _, err = helper.ModelPriceHelper(c, relayInfo, tokens, meta); err != nil {
+				newAPIError = types.NewError(err, types.ErrorCodeModelPriceError, types.ErrOptionWithSkipRetry())
+				break
+			}
+		}
 		requestBody, bodyErr := common.GetRequestBody(c)
 		if bodyErr != nil {
 			// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
 			if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
 				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+			} else if common.IsRequestMemoryError(bodyErr) {
+				c.Header("Retry-After", "1")
+				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
 			} else {
 				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
 			}
@@ -213,23 +291,64 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+		// 故障注入的错误直接返回给客户端，不影响渠道状态
+		if newAPIError = service.InjectFault(c, relayInfo, channel.Id); newAPIError != nil {
+			break
+		}
+
+		// 密钥仍在上游限流冷却中（没有其他可用渠道时才会选中），不发送请求
+		keyIndex := common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+		if until, cooling := model.GetChannelKeyCooldown(channel.Id, keyIndex); cooling {
+			newAPIError = service.NewChannelCooldownError(channel.Id, until)
+			if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
+				break
+			}
+			continue
+		}
+
+		deadlineExceeded := false
+		for sameChannelRetry := 0; ; sameChannelRetry++ {
+			if sameChannelRetry > 0 {
+				c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+			}
+			attemptStart := time.Now()
+			finishChannelAttempt := service.TrackChannelAttempt(channel.Id)
+			newAPIError = relayByFormat(c, relayFormat, relayInfo)
+			finishChannelAttempt(relayInfo, attemptStart, newAPIError)
+			service.TraceAttempt(c, relayInfo, channel.Id, attemptStart, newAPIError)
+			service.EndOtelStreamSpan(c, newAPIError)
+			service.RecordRelayAttemptMetrics(relayInfo, channel.Id, retryParam.GetRetry(), attemptStart, newAPIError)
+			service.RecordRelayAttempt(c, channel.Id, sameChannelRetry, attemptStart, newAPIError)
+			// 超过客户端指定的截止时间不是渠道的问题，直接返回超时错误
+			if newAPIError != nil && service.IsRequestDeadlineExceeded(c) {
+				deadlineExceeded = true
+				break
+			}
+			service.RecordSLOAttempt(relayInfo, channel.Id, attemptStart, newAPIError)
+
+			// 渠道配置了同渠道重试时，先按指数退避在本渠道重试，再切换到其他渠道
+			backoff, ok := service.GetSameChannelRetryBackoff(c, relayInfo, channel, newAPIError, sameChannelRetry)
+			if !ok {
+				break
+			}
+			logger.LogWarn(c, fmt.Sprintf("channel #%d failed with status code %d, retrying on the same channel in %s", channel.Id, newAPIError.StatusCode, backoff))
+			if !service.WaitRetryBackoff(c, backoff) {
+				break
+			}
+		}
+		if deadlineExceeded {
+			newAPIError = service.NewRequestTimeoutError(c)
+			break
 		}
 
 		if newAPIError == nil {
+			mirrorRequest(c, relayFormat, relayInfo, tokens, meta)
 			return
 		}
 
 		newAPIError = service.NormalizeViolationFeeError(newAPIError)
 
+		service.ApplyUpstreamRateLimitCooldown(c, channel, keyIndex, newAPIError)
 		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 
 		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
@@ -237,6 +356,13 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	// 上游因内容过滤拒绝时，令牌允许的话按兜底规则换渠道或模型重试一次
+	if service.IsContentFilterError(newAPIError) {
+		if fallbackErr, ok := relayContentFilterFallback(c, relayInfo, relayFormat, tokens, meta, retryParam, newAPIError); ok {
+			newAPIError = fallbackErr
+		}
+	}
+
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
 		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
@@ -244,6 +370,91 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 }
 
+func relayByFormat(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		return relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		return relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		return geminiRelayHandler(c, relayInfo)
+	default:
+		return relayHandler(c, relayInfo)
+	}
+}
+
+// relayContentFilterFallback sends the request refused by the upstream content filter once more to the fallback
+// channel or model of the matching rule, ok is false when no fallback applies and the refusal stands.
+func relayContentFilterFallback(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, tokens int,
+	meta *types.TokenCountMeta, retryParam *service.RetryParam, refusal *types.NewAPIError) (*types.NewAPIError, bool) {
+	rule := service.GetContentFilterFallback(c, relayInfo)
+	if rule == nil {
+		return nil, false
+	}
+	decision := &service.ContentFilterFallbackDecision{
+		Reason:      string(refusal.GetErrorCode()),
+		FromModel:   relayInfo.OriginModelName,
+		FromChannel: common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		ToModel:     relayInfo.OriginModelName,
+		ToChannel:   rule.ChannelId,
+	}
+	if rule.FallbackModel != "" {
+		decision.ToModel = rule.FallbackModel
+	}
+
+	var channel *model.Channel
+	if rule.ChannelId != 0 {
+		// 兜底渠道需要服务于用户的分组并满足合规要求，否则按正常流程选择渠道
+		channel, _ = service.GetPinnedChannel(c, relayInfo.TokenGroup, decision.ToModel, rule.ChannelId)
+		if channel == nil {
+			logger.LogWarn(c, fmt.Sprintf("content filter fallback channel #%d is not available", rule.ChannelId))
+			decision.ToChannel = 0
+		}
+	}
+	// 兜底目标与被拒绝的请求相同时没有意义
+	if (channel == nil || channel.Id == decision.FromChannel) && decision.ToModel == decision.FromModel {
+		return nil, false
+	}
+
+	// 先记录决策，兜底请求再次被过滤时不会继续兜底
+	common.SetContextKey(c, constant.ContextKeyContentFilterFallback, decision)
+	relayInfo.OriginModelName = decision.ToModel
+	if channel != nil {
+		if newAPIError := middleware.SetupContextForSelectedChannel(c, channel, decision.ToModel); newAPIError != nil {
+			return newAPIError, true
+		}
+	} else {
+		retryParam.ModelName = decision.ToModel
+		retryParam.SetRetry(0)
+		var newAPIError *types.NewAPIError
+		if channel, newAPIError = getChannel(c, relayInfo, retryParam); newAPIError != nil {
+			return newAPIError, true
+		}
+		decision.ToChannel = channel.Id
+	}
+	logger.LogWarn(c, fmt.Sprintf("upstream content filter refusal (%s) on channel #%d model %s, falling back to channel #%d model %s",
+		decision.Reason, decision.FromChannel, decision.FromModel, decision.ToChannel, decision.ToModel))
+	addUsedChannel(c, channel.Id)
+
+	if _, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta); err != nil {
+		return types.NewError(err, types.ErrorCodeModelPriceError, types.ErrOptionWithSkipRetry()), true
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry()), true
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+
+	attemptStart := time.Now()
+	newAPIError := relayByFormat(c, relayFormat, relayInfo)
+	service.RecordRelayAttempt(c, channel.Id, 0, attemptStart, newAPIError)
+	if newAPIError != nil {
+		newAPIError = service.NormalizeViolationFeeError(newAPIError)
+		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+	}
+	return newAPIError, true
+}
+
 var upgrader = websocket.Upgrader{
 	Subprotocols: []string{"realtime"}, // WS 握手支持的协议，如果有使用 Sec-WebSocket-Protocol，则必须在此声明对应的 Protocol TODO add other protocol
 	CheckOrigin: func(r *http.Request) bool {
@@ -298,7 +509,16 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 			AutoBan: &autoBanInt,
 		}, nil
 	}
-	channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(retryParam)
+	var channel *model.Channel
+	var selectGroup string
+	var err error
+	if alias := service.GetRequestModelAlias(c); alias != nil {
+		// 别名按回退链切换目标模型，后续按新的目标模型计费和转发
+		channel, selectGroup, err = service.SelectModelAliasChannel(retryParam, alias)
+		info.OriginModelName = retryParam.ModelName
+	} else {
+		channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(retryParam)
+	}
 
 	info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, info)
 
@@ -335,6 +555,10 @@ func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) b
 	if _, ok := c.Get("specific_channel_id"); ok {
 		return false
 	}
+	// 自有渠道失败时不切换到平台渠道
+	if common.GetContextKeyInt(c, constant.ContextKeyChannelOwnerUserId) != 0 {
+		return false
+	}
 	code := openaiErr.StatusCode
 	if code >= 200 && code < 300 {
 		return false
@@ -373,6 +597,7 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 		other["channel_id"] = channelId
 		other["channel_name"] = c.GetString("channel_name")
 		other["channel_type"] = c.GetInt("channel_type")
+		service.AppendRegionInfo(c, other)
 		adminInfo := make(map[string]interface{})
 		adminInfo["use_channel"] = c.GetStringSlice("use_channel")
 		isMultiKey := common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey)
@@ -420,13 +645,14 @@ func RelayMidjourney(c *gin.Context) {
 			mjErr.Result = "当前分组负载已饱和，请稍后再试，或升级账户以提升服务质量。"
 			statusCode = http.StatusTooManyRequests
 		}
+		description := fmt.Sprintf("%s %s", mjErr.Description, mjErr.Result)
 		c.JSON(statusCode, gin.H{
-			"description": fmt.Sprintf("%s %s", mjErr.Description, mjErr.Result),
+			"description": service.RewriteMidjourneyErrorMessage(c, statusCode, description),
 			"type":        "upstream_error",
 			"code":        mjErr.Code,
 		})
 		channelId := c.GetInt("channel_id")
-		logger.LogError(c, fmt.Sprintf("relay error (channel #%d, status code %d): %s", channelId, statusCode, fmt.Sprintf("%s %s", mjErr.Description, mjErr.Result)))
+		logger.LogError(c, fmt.Sprintf("relay error (channel #%d, status code %d): %s", channelId, statusCode, description))
 	}
 }
 
@@ -490,6 +716,8 @@ func RelayTask(c *gin.Context) {
 		if err != nil {
 			if common.IsRequestBodyTooLargeError(err) || errors.Is(err, common.ErrRequestBodyTooLarge) {
 				taskErr = service.TaskErrorWrapperLocal(err, "read_request_body_failed", http.StatusRequestEntityTooLarge)
+			} else if common.IsRequestMemoryError(err) {
+				taskErr = service.TaskErrorWrapperLocal(err, "read_request_body_failed", http.StatusServiceUnavailable)
 			} else {
 				taskErr = service.TaskErrorWrapperLocal(err, "read_request_body_failed", http.StatusBadRequest)
 			}
@@ -504,6 +732,7 @@ func RelayTask(c *gin.Context) {
 		logger.LogInfo(c, retryLogStr)
 	}
 	if taskErr != nil {
+		service.RewriteTaskError(c, taskErr)
 		if taskErr.StatusCode == http.StatusTooManyRequests {
 			taskErr.Message = "当前分组上游负载已饱和，请稍后再试"
 		}
@@ -535,6 +764,10 @@ func shouldRetryTaskRelay(c *gin.Context, channelId int, taskErr *dto.TaskError,
 	if _, ok := c.Get("specific_channel_id"); ok {
 		return false
 	}
+	// 自有渠道失败时不切换到平台渠道
+	if common.GetContextKeyInt(c, constant.ContextKeyChannelOwnerUserId) != 0 {
+		return false
+	}
 	if taskErr.StatusCode == http.StatusTooManyRequests {
 		return true
 	}
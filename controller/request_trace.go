@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRequestTrace returns the assembled timeline of a relay request: auth, routing decisions with the
+// candidate channels, every attempt with upstream timings, billing details and the captured payloads.
+func GetRequestTrace(c *gin.Context) {
+	view, err := service.GetRequestTraceView(c.Param("request_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, view)
+}
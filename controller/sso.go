@@ -0,0 +1,411 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// SSO 登录：每个提供商都是标准的 OpenID Connect 授权码流程，端点通过 issuer 自动发现，
+// IdP 的分组声明按提供商配置的规则映射为本站分组，首次登录时可自动创建用户。
+
+type ssoDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	fetchedAt             time.Time
+}
+
+type ssoTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+const ssoDiscoveryTTL = time.Hour
+
+var (
+	ssoDiscoveryCache sync.Map
+	ssoHTTPClient     = &http.Client{Timeout: 10 * time.Second}
+)
+
+func ssoRedirectURI(provider *system_setting.SSOProvider) string {
+	return fmt.Sprintf("%s/oauth/sso/%s", system_setting.ServerAddress, url.PathEscape(provider.Name))
+}
+
+func getSSODiscovery(provider *system_setting.SSOProvider) (*ssoDiscovery, error) {
+	issuer := provider.IssuerURL()
+	if issuer == "" {
+		return nil, errors.New("SSO 提供商未配置 issuer")
+	}
+	if cached, ok := ssoDiscoveryCache.Load(issuer); ok {
+		if discovery := cached.(*ssoDiscovery); time.Since(discovery.fetchedAt) < ssoDiscoveryTTL {
+			return discovery, nil
+		}
+	}
+	res, err := ssoHTTPClient.Get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		common.SysLog("failed to fetch SSO discovery document: " + err.Error())
+		return nil, errors.New("无法连接至 SSO 服务器，请稍后重试！")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取 SSO 服务器配置失败，状态码 %d", res.StatusCode)
+	}
+	var discovery ssoDiscovery
+	if err := common.DecodeJson(res.Body, &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" {
+		return nil, errors.New("SSO 服务器配置缺少授权或令牌端点")
+	}
+	if discovery.Issuer == "" {
+		discovery.Issuer = issuer
+	}
+	discovery.fetchedAt = time.Now()
+	ssoDiscoveryCache.Store(issuer, &discovery)
+	return &discovery, nil
+}
+
+// decodeIDTokenClaims reads the claims of the ID token without checking its signature, which is allowed since the
+// token is received directly from the token endpoint over TLS (OpenID Connect Core 3.1.3.7).
+func decodeIDTokenClaims(idToken string) (map[string]any, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid id token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]any)
+	if err := common.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// getSSOClaims exchanges the code, validates the ID token against the nonce of the login and merges its claims
+// with the userinfo response. It also reports whether the issuer accepts users of any Azure AD tenant.
+func getSSOClaims(provider *system_setting.SSOProvider, code string, nonce string) (map[string]any, bool, error) {
+	if code == "" {
+		return nil, false, errors.New("无效的参数")
+	}
+	discovery, err := getSSODiscovery(provider)
+	if err != nil {
+		return nil, false, err
+	}
+	claims, err := exchangeSSOCode(provider, discovery, code, nonce)
+	if err != nil {
+		return nil, false, err
+	}
+	return claims, system_setting.IsMultiTenantIssuer(discovery.Issuer), nil
+}
+
+func exchangeSSOCode(provider *system_setting.SSOProvider, discovery *ssoDiscovery, code string, nonce string) (map[string]any, error) {
+	values := url.Values{}
+	values.Set("client_id", provider.ClientId)
+	values.Set("client_secret", provider.ClientSecret)
+	values.Set("code", code)
+	values.Set("grant_type", "authorization_code")
+	values.Set("redirect_uri", ssoRedirectURI(provider))
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := ssoHTTPClient.Do(req)
+	if err != nil {
+		common.SysLog(err.Error())
+		return nil, errors.New("无法连接至 SSO 服务器，请稍后重试！")
+	}
+	defer res.Body.Close()
+	var tokenResponse ssoTokenResponse
+	if err := common.DecodeJson(res.Body, &tokenResponse); err != nil {
+		return nil, err
+	}
+	if tokenResponse.IDToken == "" {
+		common.SysLog(fmt.Sprintf("SSO provider %s token exchange failed: %s %s", provider.Name, tokenResponse.Error, tokenResponse.ErrorDesc))
+		return nil, errors.New("SSO 获取 Token 失败，请检查设置！")
+	}
+
+	claims, err := decodeIDTokenClaims(tokenResponse.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := provider.ValidateIDTokenClaims(claims, discovery.Issuer, nonce, time.Now()); err != nil {
+		common.SysLog(fmt.Sprintf("SSO provider %s returned an invalid ID token: %s", provider.Name, err.Error()))
+		return nil, errors.New("SSO 登录校验失败，请重新登录")
+	}
+	if discovery.UserInfoEndpoint != "" && tokenResponse.AccessToken != "" {
+		req, err = http.NewRequest(http.MethodGet, discovery.UserInfoEndpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+tokenResponse.AccessToken)
+		res2, err := ssoHTTPClient.Do(req)
+		if err == nil {
+			defer res2.Body.Close()
+			userInfo := make(map[string]any)
+			if res2.StatusCode == http.StatusOK && common.DecodeJson(res2.Body, &userInfo) == nil {
+				// userinfo 的 sub 必须与 ID Token 一致
+				if sub, ok := claims["sub"]; ok && userInfo["sub"] != nil && userInfo["sub"] != sub {
+					return nil, errors.New("SSO 用户信息与 ID Token 不一致")
+				}
+				for k, v := range userInfo {
+					// 已校验的声明以 ID Token 为准
+					switch k {
+					case "iss", "aud", "azp", "exp", "nonce", "tid":
+						continue
+					}
+					claims[k] = v
+				}
+			}
+		}
+	}
+	if ssoClaimString(claims, "sub") == "" {
+		return nil, errors.New("SSO 获取用户信息为空！请检查设置！")
+	}
+	return claims, nil
+}
+
+func ssoClaimString(claims map[string]any, key string) string {
+	value, _ := claims[key].(string)
+	return strings.TrimSpace(value)
+}
+
+func ssoUsername(claims map[string]any) string {
+	candidate := ssoClaimString(claims, "preferred_username")
+	if candidate == "" {
+		candidate = ssoClaimString(claims, "email")
+	}
+	if at := strings.Index(candidate, "@"); at >= 0 {
+		candidate = candidate[:at]
+	}
+	if candidate != "" && len(candidate) <= 20 {
+		if exist, err := model.CheckUserExistOrDeleted(candidate, ""); err == nil && !exist {
+			return candidate
+		}
+	}
+	return fmt.Sprintf("sso_%d", model.GetMaxUserId()+1)
+}
+
+// SSOLogin redirects to the authorization endpoint of the provider, the state must come from /api/oauth/state.
+func SSOLogin(c *gin.Context) {
+	provider, ok := system_setting.GetSSOProvider(c.Param("name"))
+	if !ok {
+		common.ApiErrorMsg(c, "管理员未开启该 SSO 登录方式")
+		return
+	}
+	session := sessions.Default(c)
+	state := c.Query("state")
+	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	discovery, err := getSSODiscovery(provider)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	query := authURL.Query()
+	query.Set("client_id", provider.ClientId)
+	query.Set("redirect_uri", ssoRedirectURI(provider))
+	query.Set("response_type", "code")
+	query.Set("scope", provider.GetScopes())
+	query.Set("state", state)
+	nonce, err := common.GenerateRandomCharsKey(32)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	session.Set("sso_nonce", nonce)
+	if err := session.Save(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	query.Set("nonce", nonce)
+	authURL.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, authURL.String())
+}
+
+// SSOAuth handles the callback of the provider: it logs in the user bound to the identity, provisions a new user
+// when allowed, or binds the identity to the user already logged in.
+func SSOAuth(c *gin.Context) {
+	session := sessions.Default(c)
+	state := c.Query("state")
+	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	provider, ok := system_setting.GetSSOProvider(c.Param("name"))
+	if !ok {
+		common.ApiErrorMsg(c, "管理员未开启该 SSO 登录方式")
+		return
+	}
+	// nonce 只能使用一次
+	nonce, _ := session.Get("sso_nonce").(string)
+	session.Delete("sso_nonce")
+	_ = session.Save()
+	claims, multiTenant, err := getSSOClaims(provider, c.Query("code"), nonce)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subject := ssoClaimString(claims, "sub")
+	email := provider.VerifiedEmail(claims, multiTenant)
+	if !provider.EmailAllowed(email) {
+		common.ApiErrorMsg(c, "该邮箱域名不允许通过 "+provider.DisplayName+" 登录")
+		return
+	}
+	if session.Get("username") != nil {
+		ssoBind(c, provider, subject, email)
+		return
+	}
+
+	rule, matched := provider.MatchGroupRule(provider.ClaimValues(claims))
+	if matched && !ratio_setting.ContainsGroupRatio(rule.Group) {
+		common.SysLog(fmt.Sprintf("SSO provider %s maps to unknown group %s, ignored", provider.Name, rule.Group))
+		rule, matched = nil, false
+	}
+	identity, err := model.GetUserIdentity(provider.Name, subject)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var user *model.User
+	if identity != nil {
+		user = &model.User{Id: identity.UserId}
+		if err := user.FillUserById(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		_ = model.TouchUserIdentity(identity.Id)
+		if matched && provider.SyncGroupOnLogin && user.Group != rule.Group {
+			if err := model.UpdateUserGroupBySSO(user.Id, rule.Group); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+			model.RecordLog(user.Id, model.LogTypeSystem, fmt.Sprintf("通过 %s 登录，分组由 %s 变更为 %s", provider.DisplayName, user.Group, rule.Group))
+			user.Group = rule.Group
+		}
+	} else {
+		if !provider.AutoProvision {
+			common.ApiErrorMsg(c, "该账户尚未绑定，请先使用其他方式登录后在个人设置中绑定")
+			return
+		}
+		if !common.RegisterEnabled {
+			common.ApiErrorMsg(c, "管理员关闭了新用户注册")
+			return
+		}
+		if user, err = provisionSSOUser(provider, claims, subject, email, rule); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	setupLogin(user, c)
+}
+
+// provisionSSOUser creates the user on the first login (JIT), with the group and extra quota of the matched rule.
+func provisionSSOUser(provider *system_setting.SSOProvider, claims map[string]any, subject string, email string, rule *system_setting.SSOGroupRule) (*model.User, error) {
+	user := &model.User{
+		Username:    ssoUsername(claims),
+		Email:       email,
+		DisplayName: ssoClaimString(claims, "name"),
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = provider.DisplayName + " User"
+	}
+	if rule != nil {
+		user.Group = rule.Group
+	}
+	if err := user.Insert(0); err != nil {
+		return nil, err
+	}
+	if err := model.CreateUserIdentity(&model.UserIdentity{UserId: user.Id, Provider: provider.Name, Subject: subject, Email: email}); err != nil {
+		return nil, err
+	}
+	if rule != nil && rule.Quota > 0 {
+		if err := model.GrantUserQuota(user.Id, rule.Quota, model.QuotaLedgerKindGrant, "SSO 分组赠送"); err == nil {
+			user.Quota += rule.Quota
+			model.RecordLog(user.Id, model.LogTypeSystem, fmt.Sprintf("通过 %s 注册赠送 %s", provider.DisplayName, logger.LogQuota(rule.Quota)))
+		}
+	}
+	common.SysLog(fmt.Sprintf("user %s provisioned via SSO provider %s", user.Username, provider.Name))
+	return user, nil
+}
+
+func ssoBind(c *gin.Context, provider *system_setting.SSOProvider, subject string, email string) {
+	identity, err := model.GetUserIdentity(provider.Name, subject)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if identity != nil {
+		common.ApiErrorMsg(c, "该 "+provider.DisplayName+" 账户已被绑定")
+		return
+	}
+	id, ok := sessions.Default(c).Get("id").(int)
+	if !ok {
+		common.ApiErrorMsg(c, "无效的会话，请重新登录")
+		return
+	}
+	if err := model.CreateUserIdentity(&model.UserIdentity{UserId: id, Provider: provider.Name, Subject: subject, Email: email}); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "bind",
+	})
+}
+
+// ssoProvidersForStatus lists the enabled providers for the login page, without any credential.
+func ssoProvidersForStatus() []gin.H {
+	providers := system_setting.EnabledSSOProviders()
+	list := make([]gin.H, 0, len(providers))
+	for _, provider := range providers {
+		list = append(list, gin.H{
+			"name":         provider.Name,
+			"display_name": provider.DisplayName,
+			"type":         provider.Type,
+		})
+	}
+	return list
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -64,6 +66,36 @@ func GetToken(c *gin.Context) {
 	return
 }
 
+type tokenDryRunRequest struct {
+	Model string `json:"model"`
+	Ip    string `json:"ip"`
+}
+
+// DryRunToken 检查令牌对指定模型的访问限制，不请求上游也不扣费
+func DryRunToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req tokenDryRunRequest
+	if err = c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	result, err := service.DryRunToken(token, strings.TrimSpace(req.Model), strings.TrimSpace(req.Ip))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, result)
+}
+
 func GetTokenStatus(c *gin.Context) {
 	tokenId := c.GetInt("token_id")
 	userId := c.GetInt("id")
@@ -136,6 +168,27 @@ func GetTokenUsage(c *gin.Context) {
 	})
 }
 
+// validateTokenRequest checks the name length and the quota range of a token sent by the client.
+func validateTokenRequest(token *model.Token) error {
+	if len(token.Name) > 50 {
+		return errors.New("令牌名称过长")
+	}
+	if token.BillingPreference != "" && !common.IsValidBillingPreference(token.BillingPreference) {
+		return errors.New("无效的扣费策略")
+	}
+	// 非无限额度时，检查额度值是否超出有效范围
+	if !token.UnlimitedQuota {
+		if token.RemainQuota < 0 {
+			return errors.New("额度值不能为负数")
+		}
+		maxQuotaValue := int((1000000000 * common.QuotaPerUnit))
+		if token.RemainQuota > maxQuotaValue {
+			return fmt.Errorf("额度值超出有效范围，最大值为 %d", maxQuotaValue)
+		}
+	}
+	return model.ValidateTokenScopes(token)
+}
+
 func AddToken(c *gin.Context) {
 	token := model.Token{}
 	err := c.ShouldBindJSON(&token)
@@ -143,31 +196,13 @@ func AddToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	if len(token.Name) > 50 {
+	if err := validateTokenRequest(&token); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "令牌名称过长",
+			"message": err.Error(),
 		})
 		return
 	}
-	// 非无限额度时，检查额度值是否超出有效范围
-	if !token.UnlimitedQuota {
-		if token.RemainQuota < 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": "额度值不能为负数",
-			})
-			return
-		}
-		maxQuotaValue := int((1000000000 * common.QuotaPerUnit))
-		if token.RemainQuota > maxQuotaValue {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("额度值超出有效范围，最大值为 %d", maxQuotaValue),
-			})
-			return
-		}
-	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -191,6 +226,16 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		ComplianceTags:     token.ComplianceTags,
+		BillingPreference:  token.BillingPreference,
+		ResponseCache:      token.ResponseCache,
+		ContentFallback:    token.ContentFallback,
+		FetchUrlTool:       token.FetchUrlTool,
+		NativePassthrough:  token.NativePassthrough,
+		ModelClasses:       token.ModelClasses,
+		AllowEndpoints:     token.AllowEndpoints,
+		ActiveFrom:         token.ActiveFrom,
+		AccessWindows:      token.AccessWindows,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -219,39 +264,41 @@ func DeleteToken(c *gin.Context) {
 	return
 }
 
+// tokenUpdateRequest ExpectedRemainQuota 为客户端编辑前读取到的剩余额度，修改剩余额度时必须提供
+type tokenUpdateRequest struct {
+	model.Token
+	ExpectedRemainQuota *int `json:"expected_remain_quota"`
+}
+
+// respondQuotaConflict answers 409 when the quota changed after the client read it.
+func respondQuotaConflict(c *gin.Context, err error) bool {
+	if !errors.Is(err, model.ErrQuotaConflict) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+	return true
+}
+
 func UpdateToken(c *gin.Context) {
 	userId := c.GetInt("id")
 	statusOnly := c.Query("status_only")
-	token := model.Token{}
-	err := c.ShouldBindJSON(&token)
+	request := tokenUpdateRequest{}
+	err := c.ShouldBindJSON(&request)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
-	if len(token.Name) > 50 {
+	token := request.Token
+	if err := validateTokenRequest(&token); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "令牌名称过长",
+			"message": err.Error(),
 		})
 		return
 	}
-	if !token.UnlimitedQuota {
-		if token.RemainQuota < 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": "额度值不能为负数",
-			})
-			return
-		}
-		maxQuotaValue := int((1000000000 * common.QuotaPerUnit))
-		if token.RemainQuota > maxQuotaValue {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("额度值超出有效范围，最大值为 %d", maxQuotaValue),
-			})
-			return
-		}
-	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -273,6 +320,7 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	expectedRemainQuota := cleanToken.RemainQuota
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
@@ -286,8 +334,27 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.ComplianceTags = token.ComplianceTags
+		cleanToken.BillingPreference = token.BillingPreference
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.ContentFallback = token.ContentFallback
+		cleanToken.FetchUrlTool = token.FetchUrlTool
+		cleanToken.NativePassthrough = token.NativePassthrough
+		cleanToken.ModelClasses = token.ModelClasses
+		cleanToken.AllowEndpoints = token.AllowEndpoints
+		cleanToken.ActiveFrom = token.ActiveFrom
+		cleanToken.AccessWindows = token.AccessWindows
+		if request.ExpectedRemainQuota != nil {
+			expectedRemainQuota = *request.ExpectedRemainQuota
+		} else if token.RemainQuota != expectedRemainQuota {
+			common.ApiErrorMsg(c, "修改剩余额度时需要提供 expected_remain_quota")
+			return
+		}
+	}
+	err = cleanToken.UpdateFrom(expectedRemainQuota)
+	if respondQuotaConflict(c, err) {
+		return
 	}
-	err = cleanToken.Update()
 	if err != nil {
 		common.ApiError(c, err)
 		return
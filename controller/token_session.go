@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTokenAnomalies 当前用户疑似泄露的令牌
+func GetTokenAnomalies(c *gin.Context) {
+	anomalies, err := service.DetectTokenAnomalies(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, anomalies)
+}
+
+// GetAllTokenAnomalies 所有用户疑似泄露的令牌，仅管理员可用
+func GetAllTokenAnomalies(c *gin.Context) {
+	anomalies, err := service.DetectTokenAnomalies(0)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, anomalies)
+}
+
+// GetTokenSessions 令牌按 IP 段、UA 类型和国家聚合的使用来源
+func GetTokenSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	sessions, err := service.GetTokenSessions(token.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, sessions)
+}
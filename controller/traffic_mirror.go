@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// mirrorRequest sends a copy of the succeeded request to the candidate channel of the shadow mode rule in the
+// background. The copy runs as the same user and with the same request id, its response is dropped and it is
+// not billed; its consume or error log is marked with mirror_of so the two results can be compared.
+func mirrorRequest(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, tokens int, meta *types.TokenCountMeta) {
+	channelId := common.GetContextKeyInt(c, constant.ContextKeyTrafficMirrorChannelId)
+	if channelId == 0 || channelId == relayInfo.ChannelId || relayFormat == types.RelayFormatOpenAIRealtime || meta == nil {
+		return
+	}
+	// 影子渠道同样需要服务于请求的分组并满足分组的合规要求，auto 分组使用实际选中的分组
+	group := relayInfo.UsingGroup
+	if autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup); autoGroup != "" {
+		group = autoGroup
+	}
+	channel, _ := service.GetPinnedChannel(c, group, relayInfo.OriginModelName, channelId)
+	if channel == nil {
+		logger.LogWarn(c, fmt.Sprintf("traffic mirror channel #%d is not available", channelId))
+		return
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return
+	}
+	mirrorOf := 0
+	if logIds, _ := common.GetContextKeyType[[]int](c, constant.ContextKeyRecordedLogIds); len(logIds) > 0 {
+		mirrorOf = logIds[len(logIds)-1]
+	}
+
+	tc, _, info, err := newChannelRelayContext(c, channel, relayFormat, c.Request.URL.Path, relayInfo.OriginModelName, nil, body)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to mirror request to channel #%d: %s", channelId, err.Error()))
+		return
+	}
+	tc.Set(common.RequestIdKey, c.GetString(common.RequestIdKey))
+	tc.Set("token_name", c.GetString("token_name"))
+	common.SetContextKey(tc, constant.ContextKeyMirrorOf, mirrorOf)
+	info.MirrorOf = mirrorOf
+	info.TokenId = relayInfo.TokenId
+	info.UsingGroup = relayInfo.UsingGroup
+	// 影子请求不受熔断影响，也不计入渠道统计
+	info.IsChannelTest = true
+	// 价格只用于在日志中记录本应扣除的额度
+	if _, err = helper.ModelPriceHelper(tc, info, tokens, meta); err != nil {
+		logger.LogWarn(c, "failed to price mirrored request: "+err.Error())
+	}
+
+	gopool.Go(func() {
+		apiErr := relayByFormat(tc, relayFormat, info)
+		if apiErr == nil {
+			return
+		}
+		logger.LogWarn(tc, fmt.Sprintf("mirrored request to channel #%d failed: %s", channel.Id, apiErr.Error()))
+		model.RecordErrorLog(tc, info.UserId, channel.Id, info.OriginModelName, tc.GetString("token_name"), apiErr.Error(),
+			info.TokenId, 0, info.IsStream, info.UsingGroup, map[string]interface{}{
+				"mirror_of":   mirrorOf,
+				"error_code":  apiErr.GetErrorCode(),
+				"status_code": apiErr.StatusCode,
+			})
+	})
+}
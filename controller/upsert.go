@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 声明式管理接口：以名称作为稳定标识，PUT 不存在则创建、存在则更新，
+// 重复提交同样的内容得到同样的结果，便于 Terraform provider 或脚本管理网关配置。
+// 同名资源存在多个时无法确定目标，直接返回错误，需要先在控制台处理重名。
+
+func upsertName(c *gin.Context) (string, bool) {
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		common.ApiErrorMsg(c, "名称不能为空")
+		return "", false
+	}
+	return name, true
+}
+
+// UpsertChannelByName creates or updates the channel with the name in the path.
+func UpsertChannelByName(c *gin.Context) {
+	name, ok := upsertName(c)
+	if !ok {
+		return
+	}
+	channel := model.Channel{}
+	if err := c.ShouldBindJSON(&channel); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel.Name = name
+
+	existing, err := model.GetChannelsByName(name)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(existing) > 1 {
+		common.ApiErrorMsg(c, fmt.Sprintf("存在 %d 个名为 %s 的渠道，无法确定更新目标", len(existing), name))
+		return
+	}
+	created := len(existing) == 0
+	var origin *model.Channel
+	if !created {
+		origin = existing[0]
+	}
+	restoreChannelSecrets(&channel, origin)
+	if err = validateChannel(&channel, created); err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+
+	if created {
+		channel.Id = 0
+		channel.CreatedTime = common.GetTimestamp()
+		channel.ChannelInfo = model.ChannelInfo{}
+		err = channel.Insert()
+	} else {
+		channel.Id = existing[0].Id
+		channel.CreatedTime = existing[0].CreatedTime
+		channel.ChannelInfo = existing[0].ChannelInfo
+		err = channel.Update()
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.InitChannelCache()
+	service.ResetProxyClientCache()
+
+	result, err := model.GetChannelById(channel.Id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	result.Key = ""
+	clearChannelInfo(result)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"created": created,
+		"data":    result,
+	})
+}
+
+// UpsertTokenByName creates or updates the current user's token with the name in the path.
+func UpsertTokenByName(c *gin.Context) {
+	name, ok := upsertName(c)
+	if !ok {
+		return
+	}
+	userId := c.GetInt("id")
+	token := model.Token{}
+	if err := c.ShouldBindJSON(&token); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	token.Name = name
+	if err := validateTokenRequest(&token); err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+
+	existing, err := model.GetUserTokensByName(userId, name)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(existing) > 1 {
+		common.ApiErrorMsg(c, fmt.Sprintf("存在 %d 个名为 %s 的令牌，无法确定更新目标", len(existing), name))
+		return
+	}
+	created := len(existing) == 0
+
+	var result *model.Token
+	if created {
+		key, err := common.GenerateKey()
+		if err != nil {
+			common.SysLog("failed to generate token key: " + err.Error())
+			common.ApiErrorMsg(c, "生成令牌失败")
+			return
+		}
+		result = &model.Token{
+			UserId:       userId,
+			Key:          key,
+			CreatedTime:  common.GetTimestamp(),
+			AccessedTime: common.GetTimestamp(),
+		}
+	} else {
+		result = existing[0]
+	}
+	// 声明式接口以当前值为基准设置剩余额度，期间发生扣费时返回 409
+	expectedRemainQuota := result.RemainQuota
+	// If you add more fields, please also update token.Update()
+	result.Name = token.Name
+	result.ExpiredTime = token.ExpiredTime
+	result.RemainQuota = token.RemainQuota
+	result.UnlimitedQuota = token.UnlimitedQuota
+	result.ModelLimitsEnabled = token.ModelLimitsEnabled
+	result.ModelLimits = token.ModelLimits
+	result.AllowIps = token.AllowIps
+	result.Group = token.Group
+	result.CrossGroupRetry = token.CrossGroupRetry
+	result.ComplianceTags = token.ComplianceTags
+	result.BillingPreference = token.BillingPreference
+	result.ModelClasses = token.ModelClasses
+	result.AllowEndpoints = token.AllowEndpoints
+	result.ActiveFrom = token.ActiveFrom
+	result.AccessWindows = token.AccessWindows
+	if token.Status != 0 {
+		result.Status = token.Status
+	}
+	if created {
+		err = result.Insert()
+	} else {
+		err = result.UpdateFrom(expectedRemainQuota)
+	}
+	if respondQuotaConflict(c, err) {
+		return
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"created": created,
+		"data":    result,
+	})
+}
+
+type GroupUpsertRequest struct {
+	Ratio *float64 `json:"ratio"`
+	// Usable 为 true 时普通用户可在令牌中选择该分组，Description 为展示的描述
+	Usable      bool   `json:"usable"`
+	Description string `json:"description"`
+}
+
+// UpsertGroup creates or updates a group's ratio and whether users may select it.
+func UpsertGroup(c *gin.Context) {
+	name, ok := upsertName(c)
+	if !ok {
+		return
+	}
+	var req GroupUpsertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	groupRatio := ratio_setting.GetGroupRatioCopy()
+	_, exists := groupRatio[name]
+	if req.Ratio == nil && !exists {
+		common.ApiErrorMsg(c, "新建分组必须指定倍率 ratio")
+		return
+	}
+	if req.Ratio != nil {
+		if *req.Ratio < 0 {
+			common.ApiErrorMsg(c, "分组倍率不能为负数")
+			return
+		}
+		groupRatio[name] = *req.Ratio
+	}
+	usableGroups := setting.GetUserUsableGroupsCopy()
+	if req.Usable {
+		usableGroups[name] = req.Description
+	} else {
+		delete(usableGroups, name)
+	}
+
+	groupRatioJSON, err := common.Marshal(groupRatio)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	usableGroupsJSON, err := common.Marshal(usableGroups)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = ratio_setting.CheckGroupRatio(string(groupRatioJSON)); err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	if err = model.UpdateOption("GroupRatio", string(groupRatioJSON)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.UpdateOption("UserUsableGroups", string(usableGroupsJSON)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"created": !exists,
+		"data": gin.H{
+			"name":        name,
+			"ratio":       groupRatio[name],
+			"usable":      req.Usable,
+			"description": req.Description,
+		},
+	})
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUsageReport 管理员导出用户、分组或全站的用量报告，scope 未指定时根据 user_id 和 group 推断
+func GetUsageReport(c *gin.Context) {
+	req := service.UsageReportRequest{Scope: c.Query("scope"), Group: c.Query("group")}
+	req.UserId, _ = strconv.Atoi(c.Query("user_id"))
+	req.TokenId, _ = strconv.Atoi(c.Query("token_id"))
+	if req.Scope == "" {
+		switch {
+		case req.UserId != 0:
+			req.Scope = service.UsageReportScopeUser
+		case req.Group != "":
+			req.Scope = service.UsageReportScopeGroup
+		default:
+			req.Scope = service.UsageReportScopeAll
+		}
+	}
+	respondUsageReport(c, req)
+}
+
+// GetSelfUsageReport 用户导出自己的用量报告，可以指定令牌
+func GetSelfUsageReport(c *gin.Context) {
+	req := service.UsageReportRequest{Scope: service.UsageReportScopeUser, UserId: c.GetInt("id")}
+	req.TokenId, _ = strconv.Atoi(c.Query("token_id"))
+	respondUsageReport(c, req)
+}
+
+// respondUsageReport 按天统计，开始时间对齐到当天零点；format 为 json、csv 或 pdf，未指定时间范围时默认最近 30 天
+func respondUsageReport(c *gin.Context, req service.UsageReportRequest) {
+	req.StartTime, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	req.EndTime, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if req.EndTime == 0 {
+		req.EndTime = time.Now().Unix()
+	}
+	if req.StartTime == 0 {
+		req.StartTime = req.EndTime - 30*24*3600
+	}
+	if req.StartTime > req.EndTime {
+		common.ApiErrorMsg(c, "开始时间不能晚于结束时间")
+		return
+	}
+	start := time.Unix(req.StartTime, 0)
+	req.StartTime = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location()).Unix()
+
+	report, err := service.BuildUsageReport(req)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	switch c.Query("format") {
+	case "csv":
+		data, err := report.CSV()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, report.Filename("csv")))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	case "pdf":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, report.Filename("pdf")))
+		c.Data(http.StatusOK, "application/pdf", report.PDF())
+	default:
+		common.ApiSuccess(c, report)
+	}
+}
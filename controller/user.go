@@ -102,6 +102,7 @@ func setupLogin(user *model.User, c *gin.Context) {
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
 	session.Set("group", user.Group)
+	session.Set(common.SessionKeyLoginAt, common.GetTimestamp())
 	err := session.Save()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -110,6 +111,9 @@ func setupLogin(user *model.User, c *gin.Context) {
 		})
 		return
 	}
+	if err = model.TouchUserActivity(user.Id, common.GetTimestamp()); err != nil {
+		common.SysError("failed to update user activity: " + err.Error())
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "",
 		"success": true,
@@ -187,6 +191,14 @@ func Register(c *gin.Context) {
 			})
 			return
 		}
+		// 验证码发出后策略可能已调整，注册时再检查一次
+		if err := service.CheckRegistrationEmailDomain(user.Email); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 	exist, err := model.CheckUserExistOrDeleted(user.Username, user.Email)
 	if err != nil {
@@ -280,6 +292,8 @@ func GetAllUsers(c *gin.Context) {
 		return
 	}
 
+	hideUserBalances(adminAllowsOf(c), users...)
+
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(users)
 
@@ -296,6 +310,7 @@ func SearchUsers(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	hideUserBalances(adminAllowsOf(c), users...)
 
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(users)
@@ -322,6 +337,7 @@ func GetUser(c *gin.Context) {
 		})
 		return
 	}
+	hideUserBalances(adminAllowsOf(c), user)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -597,9 +613,49 @@ func GetUserModels(c *gin.Context) {
 	return
 }
 
+// GetSelfModelClassQuota 获取当前用户各模型类别的 token 限额和本周期用量
+func GetSelfModelClassQuota(c *gin.Context) {
+	user, err := model.GetUserCache(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	quotas, err := service.GetUserModelClassQuotas(user.Id, user.Group)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, quotas)
+}
+
+// GetSelfTokenBudget 查询当前用户某个 token 预算信封的总量和已用量
+func GetSelfTokenBudget(c *gin.Context) {
+	budget, err := service.GetTokenBudget(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if budget == nil {
+		common.ApiErrorMsg(c, "预算不存在或已过期")
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"budget_id":        budget.BudgetId,
+		"total_tokens":     budget.TotalTokens,
+		"used_tokens":      budget.UsedTokens,
+		"remaining_tokens": budget.Remaining(),
+		"expires_at":       budget.ExpiresAt,
+	})
+}
+
 func UpdateUser(c *gin.Context) {
-	var updatedUser model.User
-	err := json.NewDecoder(c.Request.Body).Decode(&updatedUser)
+	// ExpectedQuota 为管理员编辑前读取到的额度，修改额度时必须提供
+	var request struct {
+		model.User
+		ExpectedQuota *int `json:"expected_quota"`
+	}
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	updatedUser := request.User
 	if err != nil || updatedUser.Id == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -641,12 +697,31 @@ func UpdateUser(c *gin.Context) {
 		updatedUser.Password = "" // rollback to what it should be
 	}
 	updatePassword := updatedUser.Password != ""
-	if err := updatedUser.Edit(updatePassword); err != nil {
+	expectedQuota := originUser.Quota
+	if request.ExpectedQuota != nil {
+		expectedQuota = *request.ExpectedQuota
+	} else if updatedUser.Quota != expectedQuota {
+		common.ApiErrorMsg(c, "修改额度时需要提供 expected_quota")
+		return
+	}
+	if err := checkUserQuotaEdit(adminAllowsOf(c), updatedUser.Quota, expectedQuota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	newQuota := updatedUser.Quota
+	err = updatedUser.Edit(updatePassword, expectedQuota)
+	if respondQuotaConflict(c, err) {
+		return
+	}
+	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
-	if originUser.Quota != updatedUser.Quota {
-		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
+	if newQuota != expectedQuota {
+		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(expectedQuota), logger.LogQuota(newQuota)))
+	}
+	if user, err := model.GetUserById(updatedUser.Id, false); err == nil {
+		service.RecordAudit(c, "user.update", service.AuditTargetUser, user.Id, originUser, user)
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -797,6 +872,9 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 	err = model.HardDeleteUserById(id)
+	if err == nil {
+		service.RecordAudit(c, "user.delete", service.AuditTargetUser, id, originUser, nil)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -806,9 +884,20 @@ func DeleteUser(c *gin.Context) {
 	}
 }
 
+type DeleteSelfRequest struct {
+	// Confirm 需要填写当前用户名以确认注销
+	Confirm string `json:"confirm"`
+}
+
+// DeleteSelf deletes the current user's account. With a cooldown configured the deletion is only scheduled,
+// and the account is deleted by the background task unless the user cancels it in time.
 func DeleteSelf(c *gin.Context) {
 	id := c.GetInt("id")
-	user, _ := model.GetUserById(id, false)
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 
 	if user.Role == common.RoleRootUser {
 		c.JSON(http.StatusOK, gin.H{
@@ -817,17 +906,83 @@ func DeleteSelf(c *gin.Context) {
 		})
 		return
 	}
+	var req DeleteSelfRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Confirm != user.Username {
+		common.ApiErrorMsg(c, "请输入用户名以确认注销账户")
+		return
+	}
 
-	err := model.DeleteUserById(id)
-	if err != nil {
-		common.ApiError(c, err)
+	if common.AccountDeletionCooldownHours <= 0 {
+		if err = service.DeleteUserAccount(user); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+		})
 		return
 	}
+
+	if user.DeletionRequestedAt == 0 {
+		user.DeletionRequestedAt = common.GetTimestamp()
+		if err = model.SetUserDeletionRequestedAt(id, user.DeletionRequestedAt); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		model.RecordLog(id, model.LogTypeManage, fmt.Sprintf("申请注销账户，将于 %d 小时后执行", common.AccountDeletionCooldownHours))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data": gin.H{
+			"deletion_requested_at": user.DeletionRequestedAt,
+			"delete_at":             user.DeletionRequestedAt + int64(common.AccountDeletionCooldownHours)*3600,
+		},
+	})
+}
+
+// CancelSelfDeletion withdraws a pending account deletion request of the current user.
+func CancelSelfDeletion(c *gin.Context) {
+	id := c.GetInt("id")
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.DeletionRequestedAt == 0 {
+		common.ApiErrorMsg(c, "当前没有待执行的注销申请")
+		return
+	}
+	if err = model.SetUserDeletionRequestedAt(id, 0); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(id, model.LogTypeManage, "撤销注销账户申请")
+	common.ApiSuccess(c, nil)
+}
+
+// RevokeSelfSessions logs the current user out everywhere: every login session and the system access token
+// become invalid, and all API tokens are disabled.
+func RevokeSelfSessions(c *gin.Context) {
+	id := c.GetInt("id")
+	count, err := model.RevokeUserTokens(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.RevokeUserSessions(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(id, model.LogTypeManage, fmt.Sprintf("注销所有登录会话并禁用 %d 个令牌", count))
+
+	session := sessions.Default(c)
+	session.Clear()
+	_ = session.Save()
+	common.ApiSuccess(c, gin.H{
+		"revoked_tokens": count,
 	})
-	return
 }
 
 func CreateUser(c *gin.Context) {
@@ -915,6 +1070,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	originUser := user
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -980,6 +1136,7 @@ func ManageUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, "user."+req.Action, service.AuditTargetUser, user.Id, &originUser, &user)
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
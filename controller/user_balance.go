@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用户余额属于 billing 资源，只有 user 权限的管理角色可以管理用户，但不能查看或修改余额。
+
+var errBillingWriteRequired = errors.New("无权进行此操作，管理角色缺少 " + system_setting.AdminResourceBilling + "." + system_setting.AdminActionWrite + " 权限")
+
+// adminAllowsOf returns the admin role check of the caller, the same check AdminAuth routes run.
+func adminAllowsOf(c *gin.Context) func(resource string, action string) bool {
+	userId, role := c.GetInt("id"), c.GetInt("role")
+	return func(resource string, action string) bool {
+		return service.AdminAllows(userId, role, resource, action)
+	}
+}
+
+// hideUserBalances zeroes the quota and used quota of the users unless the caller may read billing.
+func hideUserBalances(allows func(resource string, action string) bool, users ...*model.User) {
+	if allows(system_setting.AdminResourceBilling, system_setting.AdminActionRead) {
+		return
+	}
+	for _, user := range users {
+		user.Quota = 0
+		user.UsedQuota = 0
+	}
+}
+
+// checkUserQuotaEdit rejects a user edit that changes the quota when the caller may not write billing.
+func checkUserQuotaEdit(allows func(resource string, action string) bool, newQuota int, expectedQuota int) error {
+	if newQuota != expectedQuota && !allows(system_setting.AdminResourceBilling, system_setting.AdminActionWrite) {
+		return errBillingWriteRequired
+	}
+	return nil
+}
+
+// checkUserBulkPermission rejects bulk quota adjustments when the caller may not write billing.
+func checkUserBulkPermission(allows func(resource string, action string) bool, action string) error {
+	if action == UserBulkActionQuota && !allows(system_setting.AdminResourceBilling, system_setting.AdminActionWrite) {
+		return errBillingWriteRequired
+	}
+	return nil
+}
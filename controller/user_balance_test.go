@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// testAdminAllows grants read and write on the given resources only.
+func testAdminAllows(resources ...string) func(resource string, action string) bool {
+	return func(resource string, action string) bool {
+		return slices.Contains(resources, resource)
+	}
+}
+
+func TestUserBalances_UserOnlyRole(t *testing.T) {
+	userOnly := testAdminAllows(system_setting.AdminResourceUser)
+	billing := testAdminAllows(system_setting.AdminResourceUser, system_setting.AdminResourceBilling)
+
+	users := []*model.User{{Id: 1, Quota: 1000, UsedQuota: 200}, {Id: 2, Quota: 3000, UsedQuota: 400}}
+	hideUserBalances(userOnly, users...)
+	for _, user := range users {
+		if user.Quota != 0 || user.UsedQuota != 0 {
+			t.Fatalf("user-only role read the balance of user %d: %d/%d", user.Id, user.Quota, user.UsedQuota)
+		}
+	}
+	user := &model.User{Id: 3, Quota: 1000, UsedQuota: 200}
+	hideUserBalances(billing, user)
+	if user.Quota != 1000 || user.UsedQuota != 200 {
+		t.Fatalf("billing role should read the balance, got %d/%d", user.Quota, user.UsedQuota)
+	}
+
+	cases := []struct {
+		name          string
+		allows        func(resource string, action string) bool
+		newQuota      int
+		expectedQuota int
+		allowed       bool
+	}{
+		{"user-only role keeps quota", userOnly, 1000, 1000, true},
+		{"user-only role raises quota", userOnly, 5000, 1000, false},
+		{"user-only role clears quota", userOnly, 0, 1000, false},
+		{"billing role changes quota", billing, 5000, 1000, true},
+	}
+	for _, tc := range cases {
+		if err := checkUserQuotaEdit(tc.allows, tc.newQuota, tc.expectedQuota); (err == nil) != tc.allowed {
+			t.Fatalf("%s: got %v", tc.name, err)
+		}
+	}
+
+	if err := checkUserBulkPermission(userOnly, UserBulkActionQuota); err == nil {
+		t.Fatal("user-only role adjusted quota in bulk")
+	}
+	for _, action := range []string{UserBulkActionGroup, UserBulkActionDisable, UserBulkActionNotify} {
+		if err := checkUserBulkPermission(userOnly, action); err != nil {
+			t.Fatalf("user-only role should run bulk %s: %v", action, err)
+		}
+	}
+	if err := checkUserBulkPermission(billing, UserBulkActionQuota); err != nil {
+		t.Fatalf("billing role should adjust quota in bulk: %v", err)
+	}
+}
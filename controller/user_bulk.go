@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 批量用户操作分两步：预览返回匹配的用户和校验值，提交时重新筛选，用户范围与预览不一致时拒绝执行。
+
+const (
+	UserBulkActionQuota   = "quota"
+	UserBulkActionGroup   = "group"
+	UserBulkActionDisable = "disable"
+	UserBulkActionNotify  = "notify"
+
+	userBulkPreviewLimit = 100
+)
+
+type UserBulkRequest struct {
+	Filter model.UserBulkFilter `json:"filter"`
+	Action string               `json:"action"`
+	// QuotaDelta 额度调整量，负数表示扣减，扣减后不低于 0
+	QuotaDelta int    `json:"quota_delta,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Content    string `json:"content,omitempty"`
+	// Checksum 预览返回的校验值，提交时必填
+	Checksum string `json:"checksum,omitempty"`
+}
+
+type UserBulkPreviewUser struct {
+	Id          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Group       string `json:"group"`
+	Quota       int    `json:"quota"`
+	Status      int    `json:"status"`
+}
+
+func validateUserBulkRequest(req *UserBulkRequest) error {
+	switch req.Action {
+	case UserBulkActionQuota:
+		if req.QuotaDelta == 0 {
+			return errors.New("额度调整量不能为 0")
+		}
+	case UserBulkActionGroup:
+		if req.Group == "" {
+			return errors.New("分组不能为空")
+		}
+		if !ratio_setting.ContainsGroupRatio(req.Group) {
+			return fmt.Errorf("分组 %s 不存在", req.Group)
+		}
+	case UserBulkActionDisable:
+	case UserBulkActionNotify:
+		if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Content) == "" {
+			return errors.New("通知标题和内容不能为空")
+		}
+	default:
+		return errors.New("不支持的操作")
+	}
+	if len(req.Filter.Ids) == 0 && req.Filter.Group == "" && req.Filter.Status == 0 && req.Filter.DormantDays <= 0 {
+		return errors.New("请至少指定一个筛选条件")
+	}
+	return nil
+}
+
+// findUserBulkTargets returns the users the request applies to and the checksum of the user set and action.
+func findUserBulkTargets(c *gin.Context, req *UserBulkRequest) ([]*model.User, string, error) {
+	// 只能操作权限低于自己的用户
+	users, err := model.FindUsersForBulk(req.Filter, c.GetInt("role"))
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%d|%s|%s|%s|", req.Action, req.QuotaDelta, req.Group, req.Title, req.Content)
+	for _, user := range users {
+		hash.Write([]byte(strconv.Itoa(user.Id) + ","))
+	}
+	return users, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func PreviewUserBulk(c *gin.Context) {
+	req := UserBulkRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateUserBulkRequest(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := checkUserBulkPermission(adminAllowsOf(c), req.Action); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	users, checksum, err := findUserBulkTargets(c, &req)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	hideUserBalances(adminAllowsOf(c), users...)
+	preview := make([]UserBulkPreviewUser, 0, min(len(users), userBulkPreviewLimit))
+	for _, user := range users[:min(len(users), userBulkPreviewLimit)] {
+		preview = append(preview, UserBulkPreviewUser{
+			Id:          user.Id,
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+			Group:       user.Group,
+			Quota:       user.Quota,
+			Status:      user.Status,
+		})
+	}
+	common.ApiSuccess(c, gin.H{
+		"count":    len(users),
+		"users":    preview,
+		"checksum": checksum,
+	})
+}
+
+func CommitUserBulk(c *gin.Context) {
+	req := UserBulkRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateUserBulkRequest(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := checkUserBulkPermission(adminAllowsOf(c), req.Action); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Checksum == "" {
+		common.ApiErrorMsg(c, "请先预览再提交")
+		return
+	}
+	users, checksum, err := findUserBulkTargets(c, &req)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if checksum != req.Checksum {
+		common.ApiErrorMsg(c, "匹配的用户与预览时不一致，请重新预览")
+		return
+	}
+	if len(users) == 0 {
+		common.ApiSuccess(c, gin.H{"count": 0})
+		return
+	}
+	ids := make([]int, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+
+	admin := c.GetString("username")
+	var message string
+	switch req.Action {
+	case UserBulkActionQuota:
+		err = model.BulkAdjustUserQuota(ids, req.QuotaDelta)
+		if req.QuotaDelta > 0 {
+			message = fmt.Sprintf("管理员 %s 批量增加额度 %s", admin, logger.LogQuota(req.QuotaDelta))
+		} else {
+			message = fmt.Sprintf("管理员 %s 批量扣减额度 %s", admin, logger.LogQuota(-req.QuotaDelta))
+		}
+	case UserBulkActionGroup:
+		err = model.BulkUpdateUserGroup(ids, req.Group)
+		message = fmt.Sprintf("管理员 %s 批量将用户分组修改为 %s", admin, req.Group)
+	case UserBulkActionDisable:
+		err = model.BulkUpdateUserStatus(ids, common.UserStatusDisabled)
+		message = fmt.Sprintf("管理员 %s 批量禁用用户", admin)
+	case UserBulkActionNotify:
+		sendUserBulkNotify(users, req.Title, req.Content)
+		message = fmt.Sprintf("管理员 %s 批量发送通知：%s", admin, req.Title)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, id := range ids {
+		model.RecordLog(id, model.LogTypeManage, message)
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("%s，共 %d 个用户", message, len(ids)))
+	common.ApiSuccess(c, gin.H{"count": len(ids)})
+}
+
+func sendUserBulkNotify(users []*model.User, title string, content string) {
+	gopool.Go(func() {
+		for _, user := range users {
+			data := dto.NewNotify(dto.NotifyTypeAdminMessage, title, content, nil)
+			if err := service.NotifyUser(user.Id, user.Email, user.ToBaseUser().GetSetting(), data); err != nil {
+				common.SysLog(fmt.Sprintf("failed to notify user %d: %s", user.Id, err.Error()))
+			}
+		}
+	})
+}
@@ -21,7 +21,7 @@ func getGeminiVideoURL(channel *model.Channel, task *model.Task, apiKey string)
 		return ensureAPIKey(url, apiKey), nil
 	}
 
-	baseURL := constant.ChannelBaseURLs[channel.Type]
+	baseURL := constant.GetChannelBaseURL(channel.Type)
 	if channel.GetBaseURL() != "" {
 		baseURL = channel.GetBaseURL()
 	}
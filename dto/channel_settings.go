@@ -1,13 +1,39 @@
 package dto
 
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
 type ChannelSettings struct {
 	ForceFormat              bool   `json:"force_format,omitempty"`
 	ThinkingToContent        bool   `json:"thinking_to_content,omitempty"`
+	NormalizeResponseText    bool   `json:"normalize_response_text,omitempty"` // 修复乱码并将响应文本规范化为 NFC
+	RequestBodyGzip          bool   `json:"request_body_gzip,omitempty"`       // 上游支持时使用 gzip 压缩较大的请求体
 	Proxy                    string `json:"proxy"`
 	PassThroughHeaderEnabled bool   `json:"pass_through_header_enabled,omitempty"`
 	PassThroughBodyEnabled   bool   `json:"pass_through_body_enabled,omitempty"`
 	SystemPrompt             string `json:"system_prompt,omitempty"`
 	SystemPromptOverride     bool   `json:"system_prompt_override,omitempty"`
+
+	// 上游出口设置，与 Proxy 一起用于创建请求上游的 HTTP 客户端
+	DNSServer             string `json:"dns_server,omitempty"`              // 解析上游域名的 DNS 服务器，例如 10.0.0.2:53，使用 SOCKS5 代理时由代理解析
+	TLSCACert             string `json:"tls_ca_cert,omitempty"`             // PEM 格式的 CA 证书，在系统根证书之外用于校验上游证书
+	TLSClientCert         string `json:"tls_client_cert,omitempty"`         // PEM 格式的客户端证书，用于 mTLS
+	TLSClientKey          string `json:"tls_client_key,omitempty"`          // PEM 格式的客户端私钥
+	ConnectTimeoutSeconds int    `json:"connect_timeout_seconds,omitempty"` // 建立连接的超时，0 表示使用系统默认值
+	ReadTimeoutSeconds    int    `json:"read_timeout_seconds,omitempty"`    // 发送请求后等待上游响应头的超时，不限制流式响应的总时长，0 表示不限制
+	// 请求上游时的 Accept-Encoding，例如 "zstd, br, gzip"，响应在转发和记录日志前解压，为空时由 HTTP 客户端协商 gzip
+	AcceptEncoding string `json:"accept_encoding,omitempty"`
+}
+
+// ChannelSecretMask 返回给前端的渠道设置中代替密钥的占位符，保存时提交占位符表示保留原值
+const ChannelSecretMask = "******"
+
+// HasEgressOptions reports whether the channel needs its own HTTP client for the DNS, TLS or timeout settings.
+func (s ChannelSettings) HasEgressOptions() bool {
+	return s.DNSServer != "" || s.TLSCACert != "" || s.TLSClientCert != "" || s.TLSClientKey != "" || s.ConnectTimeoutSeconds > 0 || s.ReadTimeoutSeconds > 0
 }
 
 type VertexKeyType string
@@ -32,6 +58,127 @@ type ChannelOtherSettings struct {
 	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
 	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
 	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	MockResponseTemplate  string        `json:"mock_response_template,omitempty"` // Mock 渠道回复模板，支持 {{model}} {{last_user_message}} {{message_count}} {{request_id}}
+	MockTokensPerSecond   int           `json:"mock_tokens_per_second,omitempty"` // Mock 渠道流式输出速度，0 表示不限速
+	CostRatio             float64       `json:"cost_ratio,omitempty"`             // 渠道成本倍率，用于最低价优先路由，0 视为 1
+	MaxContextLength      int           `json:"max_context_length,omitempty"`     // 自建推理服务上报的最大上下文长度
+	AutoSyncServerInfo    bool          `json:"auto_sync_server_info,omitempty"`  // 定时测试渠道时同步自建推理服务的模型列表和上下文长度
+	// 渠道级模型价格覆盖，优先于全局设置，同时用于计费和最低价优先路由
+	ModelPriceOverrides map[string]float64 `json:"model_price_overrides,omitempty"` // 按次计费价格
+	ModelRatioOverrides map[string]float64 `json:"model_ratio_overrides,omitempty"` // 按量计费模型倍率
+	// 渠道能力声明，例如 {"tools": false, "vision": true}，未声明的能力参考模型能力表
+	Capabilities map[string]bool `json:"capabilities,omitempty"`
+	// 渠道（重新）启用后发送预热请求，让模型提前加载，避免首个用户请求承担加载延迟
+	WarmUpEnabled bool     `json:"warm_up_enabled,omitempty"`
+	WarmUpModels  []string `json:"warm_up_models,omitempty"`  // 预热的模型，为空时使用渠道测试模型
+	WarmUpPrompts []string `json:"warm_up_prompts,omitempty"` // 预热提示词，为空时使用默认测试请求
+	// 日志中保留的请求/响应内容的最大字符数，优先于全局和路由设置，0 表示不截断
+	LogPayloadMaxRunes *int `json:"log_payload_max_runes,omitempty"`
+	// 上游返回可重试的状态码或超时时，先在本渠道按指数退避重试，用尽后再切换到其他渠道
+	SameChannelRetryTimes int   `json:"same_channel_retry_times,omitempty"` // 本渠道的重试次数，0 表示直接切换渠道
+	RetryBackoffMs        int   `json:"retry_backoff_ms,omitempty"`         // 首次重试前等待的毫秒数，之后每次翻倍，0 视为 500
+	RetryMaxBackoffMs     int   `json:"retry_max_backoff_ms,omitempty"`     // 单次等待的上限毫秒数，0 视为 10000
+	RetryStatusCodes      []int `json:"retry_status_codes,omitempty"`       // 可在本渠道重试的状态码，为空时为 429 和 5xx
+	// 上游不支持 n>1 时，将 n>1（以及 completions 的 best_of）的请求拆分为多个并发的单次生成请求后合并返回
+	FanOutN bool `json:"fan_out_n,omitempty"`
+	// 第三方适配器的渠道配置，按适配器声明的 config_schema 校验
+	AdaptorConfig map[string]any `json:"adaptor_config,omitempty"`
+	// 写出流式响应前按顺序应用的转换器，例如 ["strip_provider_fields", "model_alias"]
+	StreamTransformers []string `json:"stream_transformers,omitempty"`
+	// 测试渠道与健康检查默认使用的请求与断言，优先于全局健康检查设置
+	HealthProbe *ChannelHealthProbe `json:"health_probe,omitempty"`
+	// 返回给客户端前按顺序改写错误消息的规则，例如隐藏上游地址或追加联系方式，日志中保留原始错误
+	ErrorRewriteRules []ChannelErrorRewriteRule `json:"error_rewrite_rules,omitempty"`
+}
+
+const (
+	ErrorRewriteReplace  = "replace"  // 将匹配的部分替换为 Value，正则匹配时可用 $1 引用分组
+	ErrorRewriteOverride = "override" // 整条消息替换为 Value
+	ErrorRewriteAppend   = "append"   // 在消息末尾追加 Value
+	ErrorRewritePrepend  = "prepend"  // 在消息开头插入 Value
+)
+
+// ChannelErrorRewriteRule 错误消息改写规则，Match 为空时匹配所有错误消息
+type ChannelErrorRewriteRule struct {
+	StatusCodes []int  `json:"status_codes,omitempty"` // 只改写这些状态码的错误，为空时不限
+	Match       string `json:"match,omitempty"`        // 错误消息包含的文本
+	Regex       bool   `json:"regex,omitempty"`        // Match 是正则表达式
+	Action      string `json:"action"`
+	Value       string `json:"value"`
+}
+
+const (
+	ProbeAssertionSubstring  = "substring"   // 回复内容包含 Value
+	ProbeAssertionRegex      = "regex"       // 回复内容匹配正则 Value
+	ProbeAssertionJSONSchema = "json_schema" // 回复内容是符合 JSON Schema Value 的 JSON
+)
+
+// ChannelHealthProbe 渠道测试请求，字段为空时使用默认值
+type ChannelHealthProbe struct {
+	Model        string                 `json:"model,omitempty"`
+	EndpointType string                 `json:"endpoint_type,omitempty"`
+	Prompt       string                 `json:"prompt,omitempty"`
+	Assertion    *ChannelProbeAssertion `json:"assertion,omitempty"`
+}
+
+// ChannelProbeAssertion 对测试回复内容的断言，不满足时测试失败
+type ChannelProbeAssertion struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// SameChannelRetryBackoff returns the wait before the same-channel retry numbered attempt (from 0).
+func (s *ChannelOtherSettings) SameChannelRetryBackoff(attempt int) time.Duration {
+	backoff := time.Duration(s.RetryBackoffMs) * time.Millisecond
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	maxBackoff := s.RetryMaxBackoff()
+	for i := 0; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// RetryMaxBackoff is the longest wait before retrying on the same channel.
+func (s *ChannelOtherSettings) RetryMaxBackoff() time.Duration {
+	if s.RetryMaxBackoffMs <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(s.RetryMaxBackoffMs) * time.Millisecond
+}
+
+// IsSameChannelRetryStatus reports whether an upstream error with the status code may be retried on the channel.
+// Status code 0 means the request failed or timed out before a response arrived.
+func (s *ChannelOtherSettings) IsSameChannelRetryStatus(statusCode int) bool {
+	if len(s.RetryStatusCodes) > 0 {
+		return slices.Contains(s.RetryStatusCodes, statusCode)
+	}
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// GetModelPriceOverride returns the per-call price configured on the channel for modelName.
+func (s *ChannelOtherSettings) GetModelPriceOverride(modelName string) (float64, bool) {
+	if s == nil || s.ModelPriceOverrides == nil {
+		return 0, false
+	}
+	price, ok := s.ModelPriceOverrides[modelName]
+	if !ok || price < 0 {
+		return 0, false
+	}
+	return price, true
+}
+
+// GetModelRatioOverride returns the model ratio configured on the channel for modelName.
+func (s *ChannelOtherSettings) GetModelRatioOverride(modelName string) (float64, bool) {
+	if s == nil || s.ModelRatioOverrides == nil {
+		return 0, false
+	}
+	ratio, ok := s.ModelRatioOverrides[modelName]
+	if !ok || ratio < 0 {
+		return 0, false
+	}
+	return ratio, true
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
@@ -446,6 +446,16 @@ type GeminiChatResponse struct {
 	Candidates     []GeminiChatCandidate     `json:"candidates"`
 	PromptFeedback *GeminiChatPromptFeedback `json:"promptFeedback,omitempty"`
 	UsageMetadata  GeminiUsageMetadata       `json:"usageMetadata"`
+	ModelVersion   string                    `json:"modelVersion,omitempty"`
+	ResponseId     string                    `json:"responseId,omitempty"`
+	// Error 流式响应中途上游出错时只返回错误对象
+	Error *GeminiChatError `json:"error,omitempty"`
+}
+
+type GeminiChatError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
 }
 
 type GeminiUsageMetadata struct {
@@ -5,6 +5,14 @@ type Notify struct {
 	Title   string        `json:"title"`
 	Content string        `json:"content"`
 	Values  []interface{} `json:"values"`
+	// Attachments 邮件中作为附件发送，webhook 中以 base64 编码附带，其他通知方式忽略
+	Attachments []NotifyAttachment `json:"attachments,omitempty"`
+}
+
+type NotifyAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
 }
 
 const ContentValueParam = "{{value}}"
@@ -13,6 +21,11 @@ const (
 	NotifyTypeQuotaExceed   = "quota_exceed"
 	NotifyTypeChannelUpdate = "channel_update"
 	NotifyTypeChannelTest   = "channel_test"
+	NotifyTypeSLOBurn       = "slo_burn"
+	NotifyTypeReportDigest  = "report_digest"
+	NotifyTypeAdminMessage  = "admin_message"
+	NotifyTypeDormancy      = "dormancy"
+	NotifyTypeUsageReport   = "usage_report"
 )
 
 func NewNotify(t string, title string, content string, values []interface{}) Notify {
@@ -42,6 +42,7 @@ type GeneralOpenAIRequest struct {
 	TopK                int               `json:"top_k,omitempty"`
 	Stop                any               `json:"stop,omitempty"`
 	N                   int               `json:"n,omitempty"`
+	BestOf              int               `json:"best_of,omitempty"` // completions
 	Input               any               `json:"input,omitempty"`
 	Instruction         string            `json:"instruction,omitempty"`
 	Size                string            `json:"size,omitempty"`
@@ -37,13 +37,22 @@ type OpenAITextResponseChoice struct {
 }
 
 type OpenAITextResponse struct {
-	Id      string                     `json:"id"`
-	Model   string                     `json:"model"`
-	Object  string                     `json:"object"`
-	Created any                        `json:"created"`
-	Choices []OpenAITextResponseChoice `json:"choices"`
-	Error   any                        `json:"error,omitempty"`
-	Usage   `json:"usage"`
+	Id                string                     `json:"id"`
+	Model             string                     `json:"model"`
+	Object            string                     `json:"object"`
+	Created           any                        `json:"created"`
+	SystemFingerprint *string                    `json:"system_fingerprint,omitempty"`
+	Provider          string                     `json:"provider,omitempty"` // 聚合平台（如 OpenRouter）实际使用的提供商
+	Choices           []OpenAITextResponseChoice `json:"choices"`
+	Error             any                        `json:"error,omitempty"`
+	Usage             `json:"usage"`
+}
+
+func (o *OpenAITextResponse) GetSystemFingerprint() string {
+	if o.SystemFingerprint == nil {
+		return ""
+	}
+	return *o.SystemFingerprint
 }
 
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
@@ -144,6 +153,7 @@ type ChatCompletionsStreamResponse struct {
 	Created           int64                                 `json:"created"`
 	Model             string                                `json:"model"`
 	SystemFingerprint *string                               `json:"system_fingerprint"`
+	Provider          string                                `json:"provider,omitempty"`
 	Choices           []ChatCompletionsStreamResponseChoice `json:"choices"`
 	Usage             *Usage                                `json:"usage"`
 }
@@ -191,6 +201,7 @@ func (c *ChatCompletionsStreamResponse) Copy() *ChatCompletionsStreamResponse {
 		Created:           c.Created,
 		Model:             c.Model,
 		SystemFingerprint: c.SystemFingerprint,
+		Provider:          c.Provider,
 		Choices:           choices,
 		Usage:             c.Usage,
 	}
@@ -219,6 +230,23 @@ type CompletionsStreamResponse struct {
 	} `json:"choices"`
 }
 
+// CompletionsResponse 旧版 /v1/completions 的响应，流式响应的每个分块使用相同结构
+type CompletionsResponse struct {
+	Id      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []CompletionsChoice `json:"choices"`
+	Usage   *Usage              `json:"usage,omitempty"`
+}
+
+type CompletionsChoice struct {
+	Text         string  `json:"text"`
+	Index        int     `json:"index"`
+	Logprobs     any     `json:"logprobs"`
+	FinishReason *string `json:"finish_reason"`
+}
+
 type Usage struct {
 	PromptTokens         int `json:"prompt_tokens"`
 	CompletionTokens     int `json:"completion_tokens"`
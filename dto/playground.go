@@ -3,4 +3,6 @@ package dto
 type PlayGroundRequest struct {
 	Model string `json:"model,omitempty"`
 	Group string `json:"group,omitempty"`
+	// TokenId 不为空时按该令牌的分组、模型限制和额度执行并计费
+	TokenId int `json:"token_id,omitempty"`
 }
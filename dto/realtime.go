@@ -43,6 +43,8 @@ type RealtimeUsage struct {
 	OutputTokens       int                `json:"output_tokens"`
 	InputTokenDetails  InputTokenDetails  `json:"input_token_details"`
 	OutputTokenDetails OutputTokenDetails `json:"output_token_details"`
+	// InputAudioSeconds 客户端追加到输入缓冲区的音频时长，用于按秒计费
+	InputAudioSeconds float64 `json:"input_audio_seconds,omitempty"`
 }
 
 type RealtimeSession struct {
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 日志模块，管理员可以为单个模块开启 debug 日志，而不影响其他模块
+const (
+	ModuleRelay       = "relay"
+	ModuleBilling     = "billing"
+	ModuleChannelTest = "channel-test"
+	ModuleCleanup     = "cleanup"
+)
+
+var Modules = []string{ModuleRelay, ModuleBilling, ModuleChannelTest, ModuleCleanup}
+
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levelPriority = map[string]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	LevelError: 3,
+}
+
+var loggerLevels = map[string]string{
+	loggerDebug: LevelDebug,
+	loggerINFO:  LevelInfo,
+	loggerWarn:  LevelWarn,
+	loggerError: LevelError,
+}
+
+func IsValidLevel(level string) bool {
+	_, ok := levelPriority[level]
+	return ok
+}
+
+func IsValidModule(module string) bool {
+	return slices.Contains(Modules, module)
+}
+
+// GetLevel returns the effective level of the module, an empty module means the global level.
+func GetLevel(module string) string {
+	setting := operation_setting.GetLogLevelSetting()
+	if level := setting.Modules[module]; module != "" && IsValidLevel(level) {
+		return level
+	}
+	if common.DebugEnabled {
+		return LevelDebug
+	}
+	if IsValidLevel(setting.Level) {
+		return setting.Level
+	}
+	return LevelInfo
+}
+
+// LevelEnabled reports whether messages of the level are written for the module.
+func LevelEnabled(module string, level string) bool {
+	return levelPriority[level] >= levelPriority[GetLevel(module)]
+}
+
+func LogModuleDebug(ctx context.Context, module string, msg string, args ...any) {
+	logModule(ctx, module, loggerDebug, msg, args...)
+}
+
+func LogModuleInfo(ctx context.Context, module string, msg string, args ...any) {
+	logModule(ctx, module, loggerINFO, msg, args...)
+}
+
+func LogModuleWarn(ctx context.Context, module string, msg string, args ...any) {
+	logModule(ctx, module, loggerWarn, msg, args...)
+}
+
+func LogModuleError(ctx context.Context, module string, msg string, args ...any) {
+	logModule(ctx, module, loggerError, msg, args...)
+}
+
+func logModule(ctx context.Context, module string, level string, msg string, args ...any) {
+	if !LevelEnabled(module, loggerLevels[level]) {
+		return
+	}
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	logHelper(ctx, level, "["+module+"] "+msg)
+}
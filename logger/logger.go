@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -55,11 +57,15 @@ func SetupLogger() {
 }
 
 func LogInfo(ctx context.Context, msg string) {
-	logHelper(ctx, loggerINFO, msg)
+	if LevelEnabled("", LevelInfo) {
+		logHelper(ctx, loggerINFO, msg)
+	}
 }
 
 func LogWarn(ctx context.Context, msg string) {
-	logHelper(ctx, loggerWarn, msg)
+	if LevelEnabled("", LevelWarn) {
+		logHelper(ctx, loggerWarn, msg)
+	}
 }
 
 func LogError(ctx context.Context, msg string) {
@@ -67,7 +73,7 @@ func LogError(ctx context.Context, msg string) {
 }
 
 func LogDebug(ctx context.Context, msg string, args ...any) {
-	if common.DebugEnabled {
+	if LevelEnabled("", LevelDebug) {
 		if len(args) > 0 {
 			msg = fmt.Sprintf(msg, args...)
 		}
@@ -75,17 +81,28 @@ func LogDebug(ctx context.Context, msg string, args ...any) {
 	}
 }
 
+var jsonLogLevels = map[string]slog.Level{
+	loggerINFO:  slog.LevelInfo,
+	loggerWarn:  slog.LevelWarn,
+	loggerError: slog.LevelError,
+	loggerDebug: slog.LevelDebug,
+}
+
 func logHelper(ctx context.Context, level string, msg string) {
-	writer := gin.DefaultErrorWriter
-	if level == loggerINFO {
-		writer = gin.DefaultWriter
-	}
-	id := ctx.Value(common.RequestIdKey)
-	if id == nil {
-		id = "SYSTEM"
+	if common.LogFormatJSON {
+		common.LogJSON(jsonLogLevels[level], msg, requestLogAttrs(ctx)...)
+	} else {
+		writer := gin.DefaultErrorWriter
+		if level == loggerINFO {
+			writer = gin.DefaultWriter
+		}
+		id := ctx.Value(common.RequestIdKey)
+		if id == nil {
+			id = "SYSTEM"
+		}
+		now := time.Now()
+		_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
 	}
-	now := time.Now()
-	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
 	logCount++ // we don't need accurate count, so no lock here
 	if logCount > maxLogCount && !setupLogWorking {
 		logCount = 0
@@ -96,6 +113,25 @@ func logHelper(ctx context.Context, level string, msg string) {
 	}
 }
 
+// requestLogAttrs returns the request ID of the context and, for a request context, the user, the channel and the
+// model handling it, so a JSON log line can be matched with the log records of the request.
+func requestLogAttrs(ctx context.Context) []slog.Attr {
+	attrs := make([]slog.Attr, 0, 4)
+	if id, ok := ctx.Value(common.RequestIdKey).(string); ok && id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if userId, ok := ctx.Value(string(constant.ContextKeyUserId)).(int); ok && userId != 0 {
+		attrs = append(attrs, slog.Int("user_id", userId))
+	}
+	if channelId, ok := ctx.Value(string(constant.ContextKeyChannelId)).(int); ok && channelId != 0 {
+		attrs = append(attrs, slog.Int("channel_id", channelId))
+	}
+	if modelName, ok := ctx.Value(string(constant.ContextKeyOriginalModel)).(string); ok && modelName != "" {
+		attrs = append(attrs, slog.String("model", modelName))
+	}
+	return attrs
+}
+
 func LogQuota(quota int) string {
 	// 新逻辑：根据额度展示类型输出
 	q := float64(quota)
@@ -89,7 +89,14 @@ func main() {
 
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
+
+	// Propagate channel, option and cooldown changes to the other nodes through Redis
+	model.StartCoordination()
 	model.StartLogDetailRetentionCleaner()
+	model.StartQuotaLedgerReconcileTask()
+
+	// Checkpoint the SQLite WAL periodically on single-node installs
+	model.StartSQLiteCheckpointTask()
 
 	// 数据看板
 	go model.UpdateQuotaData()
@@ -104,12 +111,63 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
+	// Probe channel health and disable or re-enable channels by the results
+	controller.StartChannelHealthProber()
+
 	// Codex credential auto-refresh check every 10 minutes, refresh when expires within 1 day
 	service.StartCodexCredentialAutoRefreshTask()
 
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Push autoscaling signals when model demand crosses the configured thresholds
+	service.StartAutoscalingSignalTask()
+
+	// Sync the remote disposable email domain list used by registration
+	service.StartDisposableDomainSyncTask()
+
+	// Delete accounts whose self-service deletion request has passed the cooldown
+	service.StartAccountDeletionTask()
+
+	// Remove re-hosted images after the retention period
+	service.StartImageRehostCleanupTask()
+
+	// Execute queued /v1/batches jobs on the master node
+	controller.StartBatchWorker()
+
+	// Fail background responses interrupted by a restart and delete the expired ones
+	controller.StartBackgroundResponseTask()
+
+	// Delete uploaded and generated files once they expire
+	service.StartFileCleanupTask()
+
+	// Notify admins when a model burns its error budget too fast
+	service.StartSLOAlertTask()
+
+	// Report anonymized, aggregated usage to the operator's endpoint when usage sharing is enabled
+	service.StartUsageSharingTask()
+
+	// Flush token usage sessions and suspend leaked tokens
+	service.StartTokenSessionTask()
+
+	// Send the scheduled report digest to admins
+	service.StartReportDigestTask()
+
+	// Retry failed quota and channel alert deliveries
+	service.StartAlertDeliveryTask()
+
+	// Aggregate logs into the hourly and daily usage rollups used by the analytics API
+	service.StartUsageRollupTask()
+
+	// Adjust channel weights from the recent cost, error rate and latency when the optimizer is enabled
+	service.StartChannelRebalanceTask()
+
+	// Disable stale tokens and flag or disable dormant users after notifying them, when the cleanup is enabled
+	service.StartDormancyTask()
+
+	// Send the scheduled usage reports with CSV and PDF invoices, when enabled
+	service.StartUsageReportTask()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -258,6 +316,12 @@ func InitResources() error {
 	// Initialize options, should after model.InitDB()
 	model.InitOptionMap()
 
+	// 首次启动时按 BOOTSTRAP_FILE / BOOTSTRAP_ROOT_* 初始化实例，跳过初始化向导
+	if err = service.RunBootstrap(); err != nil {
+		common.FatalLog("failed to bootstrap instance: " + err.Error())
+		return err
+	}
+
 	// 清理旧的磁盘缓存文件
 	common.CleanupOldCacheFiles()
 
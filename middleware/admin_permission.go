@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminRouteResources 按路由前缀确定管理接口所属的资源，更具体的前缀放在前面，未列出的接口归为 system
+var adminRouteResources = []struct {
+	prefix   string
+	resource string
+}{
+	{"/api/log/detail", system_setting.AdminResourcePayload},
+	{"/api/log/:id/replay", system_setting.AdminResourcePayload},
+	{"/api/log/redaction", system_setting.AdminResourcePayload},
+	{"/api/user/topup", system_setting.AdminResourceBilling},
+	{"/api/user/:id/quota", system_setting.AdminResourceBilling},
+	{"/api/redemption", system_setting.AdminResourceBilling},
+	{"/api/subscription/admin", system_setting.AdminResourceBilling},
+	{"/api/user", system_setting.AdminResourceUser},
+	{"/api/token", system_setting.AdminResourceUser},
+	{"/api/log", system_setting.AdminResourceLog},
+	{"/api/data", system_setting.AdminResourceLog},
+	{"/api/analytics", system_setting.AdminResourceLog},
+	{"/api/mj", system_setting.AdminResourceLog},
+	{"/api/task", system_setting.AdminResourceLog},
+	{"/api/inflight", system_setting.AdminResourceLog},
+	{"/api/channel", system_setting.AdminResourceChannel},
+	{"/api/status/test", system_setting.AdminResourceChannel},
+	{"/api/models", system_setting.AdminResourceModel},
+	{"/api/vendors", system_setting.AdminResourceModel},
+	{"/api/group", system_setting.AdminResourceModel},
+	{"/api/prefill_group", system_setting.AdminResourceModel},
+	{"/api/deployments", system_setting.AdminResourceModel},
+	{"/api/autoscaling", system_setting.AdminResourceModel},
+}
+
+func adminRoutePermission(method string, path string) (resource string, action string) {
+	resource = system_setting.AdminResourceSystem
+	for _, route := range adminRouteResources {
+		if strings.HasPrefix(path, route.prefix) {
+			resource = route.resource
+			break
+		}
+	}
+	action = system_setting.AdminActionWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		action = system_setting.AdminActionRead
+	}
+	return resource, action
+}
+
+// checkAdminPermission enforces the admin role of the user on the matched route, root users are never restricted.
+func checkAdminPermission(c *gin.Context, userId int, role int) bool {
+	resource, action := adminRoutePermission(c.Request.Method, c.FullPath())
+	if service.AdminAllows(userId, role, resource, action) {
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": "无权进行此操作，管理角色缺少 " + resource + "." + action + " 权限",
+	})
+	c.Abort()
+	return false
+}
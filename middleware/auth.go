@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -13,6 +14,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-contrib/sessions"
@@ -30,6 +32,30 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
+// checkSessionRevoked rejects sessions issued before the user revoked all sessions. Impersonation sessions
+// carry the admin's login time and are bound by their own time limit, so they are not checked here.
+func checkSessionRevoked(c *gin.Context, session sessions.Session, userId int) bool {
+	if _, ok := session.Get(common.SessionKeyImpersonatorId).(int); ok {
+		return true
+	}
+	userCache, err := model.GetUserCache(userId)
+	if err != nil || userCache.SessionsRevokedAt == 0 {
+		return true
+	}
+	loginAt, _ := session.Get(common.SessionKeyLoginAt).(int64)
+	if loginAt >= userCache.SessionsRevokedAt {
+		return true
+	}
+	session.Clear()
+	_ = session.Save()
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"success": false,
+		"message": "登录状态已失效，请重新登录",
+	})
+	c.Abort()
+	return false
+}
+
 func authHelper(c *gin.Context, minRole int) {
 	session := sessions.Default(c)
 	username := session.Get("username")
@@ -125,6 +151,15 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if !useAccessToken && !checkImpersonation(c, session, apiUserId) {
+		return
+	}
+	if !useAccessToken && !checkSessionRevoked(c, session, apiUserId) {
+		return
+	}
+	if minRole >= common.RoleAdminUser && !checkAdminPermission(c, apiUserId, role.(int)) {
+		return
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
@@ -166,13 +201,25 @@ func UserAuth() func(c *gin.Context) {
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		authHelper(c, common.RoleAdminUser)
+		auditAdminRequest(c)
 	}
 }
 
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		authHelper(c, common.RoleRootUser)
+		auditAdminRequest(c)
+	}
+}
+
+// auditAdminRequest runs after the handler of an admin route and records its mutating requests in the audit log,
+// unless the handler recorded a more detailed entry itself.
+func auditAdminRequest(c *gin.Context) {
+	if c.IsAborted() || c.GetInt("role") < common.RoleAdminUser {
+		// 鉴权失败，请求未被处理
+		return
 	}
+	service.RecordAuditRequest(c)
 }
 
 func WssAuth(c *gin.Context) {
@@ -263,6 +310,18 @@ func TokenAuth() func(c *gin.Context) {
 			logger.LogDebug(c, "Client IP %s passed the token IP restrictions check", clientIp)
 		}
 
+		if allowEndpoints := token.GetAllowEndpoints(); len(allowEndpoints) > 0 {
+			endpoint := model.TokenEndpointOf(c.Request.Method, c.Request.URL.Path)
+			if endpoint != "" && !common.StringsContains(allowEndpoints, endpoint) {
+				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌无权访问 %s 类接口，允许的接口类型：%s", endpoint, strings.Join(allowEndpoints, ", ")), types.ErrorCodeAccessDenied)
+				return
+			}
+		}
+		if err = token.CheckAccessTime(time.Now()); err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error(), types.ErrorCodeAccessDenied)
+			return
+		}
+
 		userCache, err := model.GetUserCache(token.UserId)
 		if err != nil {
 			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
@@ -276,22 +335,10 @@ func TokenAuth() func(c *gin.Context) {
 
 		userCache.WriteContext(c)
 
-		userGroup := userCache.Group
-		tokenGroup := token.Group
-		if tokenGroup != "" {
-			// check common.UserUsableGroups[userGroup]
-			if _, ok := service.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("无权访问 %s 分组", tokenGroup))
-				return
-			}
-			// check group in common.GroupRatio
-			if !ratio_setting.ContainsGroupRatio(tokenGroup) {
-				if tokenGroup != "auto" {
-					abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
-					return
-				}
-			}
-			userGroup = tokenGroup
+		userGroup, err := tokenUsingGroup(userCache.Group, token.Group)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
+			return
 		}
 		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
 
@@ -299,10 +346,28 @@ func TokenAuth() func(c *gin.Context) {
 		if err != nil {
 			return
 		}
+		service.RecordTokenSession(c, token.Id, token.UserId)
 		c.Next()
 	}
 }
 
+// tokenUsingGroup returns the group requests of the token use, the group of the token when set, otherwise the
+// group of the user.
+func tokenUsingGroup(userGroup string, tokenGroup string) (string, error) {
+	if tokenGroup == "" {
+		return userGroup, nil
+	}
+	// check common.UserUsableGroups[userGroup]
+	if _, ok := service.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
+		return "", fmt.Errorf("无权访问 %s 分组", tokenGroup)
+	}
+	// check group in common.GroupRatio
+	if !ratio_setting.ContainsGroupRatio(tokenGroup) && tokenGroup != "auto" {
+		return "", fmt.Errorf("分组 %s 已被弃用", tokenGroup)
+	}
+	return tokenGroup, nil
+}
+
 func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) error {
 	if token == nil {
 		return fmt.Errorf("token is nil")
@@ -318,13 +383,21 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	if token.ModelLimitsEnabled {
 		c.Set("token_model_limit_enabled", true)
 		c.Set("token_model_limit", token.GetModelLimitsMap())
+		common.SetContextKey(c, constant.ContextKeyTokenModelClasses, token.GetModelClasses())
 	} else {
 		c.Set("token_model_limit_enabled", false)
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenComplianceTags, token.GetComplianceTags())
+	common.SetContextKey(c, constant.ContextKeyTokenBillingPreference, token.BillingPreference)
+	common.SetContextKey(c, constant.ContextKeyTokenResponseCache, token.ResponseCache)
+	common.SetContextKey(c, constant.ContextKeyTokenContentFallback, token.ContentFallback)
+	common.SetContextKey(c, constant.ContextKeyTokenFetchUrlTool, token.FetchUrlTool)
+	common.SetContextKey(c, constant.ContextKeyTokenNativePassthrough, token.NativePassthrough)
 	if len(parts) > 1 {
-		if model.IsAdmin(token.UserId) {
+		// 指定渠道需要管理员角色拥有渠道权限
+		if service.AdminAllows(token.UserId, model.GetUserRole(token.UserId), system_setting.AdminResourceChannel, system_setting.AdminActionRead) {
 			c.Set("specific_channel_id", parts[1])
 		} else {
 			abortWithOpenAiMessage(c, http.StatusForbidden, "普通用户不支持指定渠道")
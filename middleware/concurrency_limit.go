@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserConcurrencyLimit limits the requests a user has in progress on this node. Requests over the limit
+// wait in the request queue for a free slot when it is enabled, otherwise they are rejected with 429.
+func UserConcurrencyLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
+		if group == "" {
+			group = common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+		}
+		limit := operation_setting.GetRequestQueueSetting().UserConcurrencyLimit(group)
+		userId := c.GetInt("id")
+		if limit <= 0 || userId == 0 {
+			c.Next()
+			return
+		}
+		release, err := service.AcquireConcurrencySlot(c, "user:"+strconv.Itoa(userId), limit)
+		if err != nil {
+			message := fmt.Sprintf("您的并发请求数已达上限：最多同时处理 %d 个请求", limit)
+			if errors.Is(err, service.ErrRequestQueueTimeout) {
+				message += "，排队等待超时"
+			}
+			abortWithRateLimit(c, message, limit, 1)
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
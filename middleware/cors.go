@@ -1,18 +1,103 @@
 package middleware
 
 import (
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/QuantumNous/new-api/common"
-	"github.com/gin-contrib/cors"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 	"github.com/gin-gonic/gin"
 )
 
+var corsAllowMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+
+// publicAPIPaths 不需要登录的公开接口，使用公开接口的跨域策略，以 / 结尾的按前缀匹配
+var publicAPIPaths = []string{
+	"/api/status",
+	"/api/notice",
+	"/api/about",
+	"/api/home_page_content",
+	"/api/user-agreement",
+	"/api/privacy-policy",
+	"/api/pricing",
+	"/api/catalog",
+	"/api/uptime/status",
+	"/api/openapi.json",
+	"/api/log/token",
+	"/api/images/",
+}
+
+// corsPolicyForPath returns the policy of the route group the path belongs to:
+// /api 下的公开接口、其余管理 API，以及中转 API（包括 /v1、/mj 等其他所有路径）。
+func corsPolicyForPath(path string) *system_setting.CORSPolicy {
+	setting := system_setting.GetCORSSetting()
+	if path == "/metrics" {
+		return &setting.Management
+	}
+	if path != "/api" && !strings.HasPrefix(path, "/api/") {
+		return &setting.Relay
+	}
+	for _, public := range publicAPIPaths {
+		if path == public || (strings.HasSuffix(public, "/") && strings.HasPrefix(path, public)) {
+			return &setting.Public
+		}
+	}
+	return &setting.Management
+}
+
+// CORS applies the CORS policy of the route group, the policies are read on every request so changes take effect immediately.
+// 需要注册在 engine 上，未匹配到路由的预检请求也要经过这里
 func CORS() gin.HandlerFunc {
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowCredentials = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"*"}
-	return cors.New(config)
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		policy := corsPolicyForPath(c.Request.URL.Path)
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !policy.Enabled || !policy.AllowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		if policy.AllowsAllOrigins() {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+		}
+		if policy.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if len(policy.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposeHeaders, ", "))
+		}
+		if !preflight {
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", corsAllowMethods)
+		allowHeaders := strings.Join(policy.AllowHeaders, ", ")
+		if allowHeaders == "*" {
+			// 带凭据的请求不支持通配符，直接回显预检请求声明的请求头
+			allowHeaders = c.GetHeader("Access-Control-Request-Headers")
+		}
+		if allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowHeaders)
+		}
+		if policy.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
 }
 
 func PoweredBy() gin.HandlerFunc {
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type demoRequest struct {
+	Model               string `json:"model"`
+	MaxTokens           int    `json:"max_tokens"`
+	MaxCompletionTokens int    `json:"max_completion_tokens"`
+}
+
+// DemoAuth 公开演示接口鉴权：无需令牌，按 IP 严格限流并校验 Turnstile，
+// 仅允许配置的模型，所有请求使用沙盒令牌计费，与正常流量隔离。
+func DemoAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetDemoSetting()
+		if !setting.Enabled || setting.TokenId == 0 {
+			abortWithOpenAiMessage(c, http.StatusNotFound, "演示接口未开启")
+			return
+		}
+
+		rateLimited := setting.RateLimitNum > 0 && setting.RateLimitDuration > 0
+		// 要求 Turnstile 但系统未开启时不放行，只有配置了 IP 限流才退化为仅限流保护
+		if setting.RequireTurnstile && !common.TurnstileCheckEnabled && !rateLimited {
+			common.SysLog("demo endpoint requires Turnstile but Turnstile is disabled and no rate limit is set, rejecting")
+			abortWithOpenAiMessage(c, http.StatusServiceUnavailable, "演示接口暂不可用")
+			return
+		}
+
+		if rateLimited {
+			if common.RedisEnabled {
+				redisRateLimiter(c, setting.RateLimitNum, setting.RateLimitDuration, "DEMO")
+			} else {
+				inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+				memoryRateLimiter(c, setting.RateLimitNum, setting.RateLimitDuration, "DEMO")
+			}
+			if c.IsAborted() {
+				if c.Writer.Status() == http.StatusTooManyRequests {
+					abortWithOpenAiMessage(c, http.StatusTooManyRequests, "演示接口请求过于频繁，请稍后再试")
+				}
+				return
+			}
+		}
+
+		if setting.RequireTurnstile && common.TurnstileCheckEnabled {
+			response := c.GetHeader("X-Turnstile-Token")
+			if response == "" {
+				response = c.Query("turnstile")
+			}
+			if response == "" {
+				abortWithOpenAiMessage(c, http.StatusForbidden, "Turnstile token 为空")
+				return
+			}
+			success, err := verifyTurnstile(response, c.ClientIP())
+			if err != nil {
+				common.SysLog("demo turnstile verification failed: " + err.Error())
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, "Turnstile 校验失败，请稍后重试")
+				return
+			}
+			if !success {
+				abortWithOpenAiMessage(c, http.StatusForbidden, "Turnstile 校验失败，请刷新重试！")
+				return
+			}
+		}
+
+		var req demoRequest
+		if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的请求")
+			return
+		}
+		if !operation_setting.IsDemoModelAllowed(req.Model) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("演示接口不支持模型 %s", req.Model), types.ErrorCodeModelNotFound)
+			return
+		}
+		if setting.MaxTokens > 0 {
+			maxTokens := req.MaxTokens
+			if req.MaxCompletionTokens > maxTokens {
+				maxTokens = req.MaxCompletionTokens
+			}
+			if maxTokens <= 0 || maxTokens > setting.MaxTokens {
+				abortWithOpenAiMessage(c, http.StatusBadRequest, fmt.Sprintf("演示接口要求 max_tokens 不超过 %d", setting.MaxTokens))
+				return
+			}
+		}
+
+		token, err := model.GetTokenById(setting.TokenId)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("demo sandbox token %d not found: %s", setting.TokenId, err.Error()))
+			abortWithOpenAiMessage(c, http.StatusServiceUnavailable, "演示接口暂不可用")
+			return
+		}
+		// 复用令牌校验，沙盒令牌被禁用、过期或额度耗尽时演示接口随之不可用
+		token, err = model.ValidateUserToken(token.Key)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusServiceUnavailable, "演示额度已用尽或暂不可用，请稍后再试")
+			return
+		}
+		userCache, err := model.GetUserCache(token.UserId)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if userCache.Status != common.UserStatusEnabled {
+			abortWithOpenAiMessage(c, http.StatusServiceUnavailable, "演示接口暂不可用")
+			return
+		}
+		userCache.WriteContext(c)
+		userGroup := userCache.Group
+		if token.Group != "" {
+			userGroup = token.Group
+		}
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
+		common.SetContextKey(c, constant.ContextKeyDemoRequest, true)
+
+		if err = SetupContextForToken(c, token); err != nil {
+			return
+		}
+		c.Next()
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -28,10 +29,17 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		routingStart := time.Now()
+		service.MarkLatencyRoutingStart(c)
 		var channel *model.Channel
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
+			if common.IsRequestMemoryError(err) {
+				c.Header("Retry-After", "1")
+				abortWithOpenAiMessage(c, http.StatusServiceUnavailable, err.Error())
+				return
+			}
 			abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
 			return
 		}
@@ -50,6 +58,11 @@ func Distribute() func(c *gin.Context) {
 				abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
 				return
 			}
+			usingGroup := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+			if required := service.GetRequiredComplianceTags(c, usingGroup); !channel.HasComplianceTags(required) {
+				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("该渠道不满足合规要求 [%s]", strings.Join(required, ", ")))
+				return
+			}
 		} else {
 			// Select a channel for the user
 			// check token model mapping
@@ -67,7 +80,7 @@ func Distribute() func(c *gin.Context) {
 					tokenModelLimit = map[string]bool{}
 				}
 				matchName := ratio_setting.FormatMatchingModelName(modelRequest.Model) // match gpts & thinking-*
-				if _, ok := tokenModelLimit[matchName]; !ok {
+				if _, ok := tokenModelLimit[matchName]; !ok && !service.TokenAllowsModelClass(c, modelRequest.Model) {
 					abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问模型 "+modelRequest.Model)
 					return
 				}
@@ -80,8 +93,8 @@ func Distribute() func(c *gin.Context) {
 				}
 				var selectGroup string
 				usingGroup := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
-				// check path is /pg/chat/completions
-				if strings.HasPrefix(c.Request.URL.Path, "/pg/chat/completions") {
+				// check path is /pg/chat/completions，选择了令牌时使用令牌的分组
+				if strings.HasPrefix(c.Request.URL.Path, "/pg/chat/completions") && common.GetContextKeyInt(c, constant.ContextKeyTokenId) == 0 {
 					playgroundRequest := &dto.PlayGroundRequest{}
 					err = common.UnmarshalBodyReusable(c, playgroundRequest)
 					if err != nil {
@@ -98,36 +111,67 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
-					preferred, err := model.CacheGetChannel(preferredChannelID)
-					if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled {
-						if usingGroup == "auto" {
-							userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
-							autoGroups := service.GetUserAutoGroup(userGroup)
-							for _, g := range autoGroups {
-								if model.IsChannelEnabledForGroupModel(g, modelRequest.Model, preferred.Id) {
-									selectGroup = g
-									common.SetContextKey(c, constant.ContextKeyAutoGroup, g)
-									channel = preferred
-									service.MarkChannelAffinityUsed(c, g, preferred.Id)
-									break
+				// 按模型改写规则和分组可见性解析模型名，别名在下面选择渠道时解析为目标模型
+				resolvedModel, alias, err := service.ResolveRequestModel(c, usingGroup, modelRequest.Model)
+				if err != nil {
+					abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 无权使用模型 %s", usingGroup, modelRequest.Model), types.ErrorCodeModelNotFound)
+					return
+				}
+				modelRequest.Model = resolvedModel
+
+				// 用户登记了可用的自有渠道时优先使用，不参与平台渠道的路由
+				if alias == nil && operation_setting.GetByokSetting().Enabled {
+					channel, err = model.GetUserChannelForModel(c.GetInt("id"), modelRequest.Model)
+					if err != nil {
+						abortWithOpenAiMessage(c, http.StatusInternalServerError, "获取自有渠道失败: "+err.Error())
+						return
+					}
+				}
+
+				// A/B 分流规则优先于会话亲和
+				if channel == nil && alias == nil {
+					channel, selectGroup = service.SelectTrafficSplitChannel(c, usingGroup, modelRequest.Model)
+				}
+
+				if channel == nil && alias == nil {
+					if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+						preferred, err := model.CacheGetChannel(preferredChannelID)
+						if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled &&
+							service.ChannelSatisfiesCapabilities(c, preferred, modelRequest.Model) {
+							if usingGroup == "auto" {
+								userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+								autoGroups := service.GetUserAutoGroup(userGroup)
+								for _, g := range autoGroups {
+									if model.IsChannelEnabledForGroupModel(g, modelRequest.Model, preferred.Id) && service.ChannelSatisfiesCompliance(c, preferred, g) {
+										selectGroup = g
+										common.SetContextKey(c, constant.ContextKeyAutoGroup, g)
+										channel = preferred
+										service.MarkChannelAffinityUsed(c, g, preferred.Id)
+										break
+									}
 								}
+							} else if model.IsChannelEnabledForGroupModel(usingGroup, modelRequest.Model, preferred.Id) && service.ChannelSatisfiesCompliance(c, preferred, usingGroup) {
+								channel = preferred
+								selectGroup = usingGroup
+								service.MarkChannelAffinityUsed(c, usingGroup, preferred.Id)
 							}
-						} else if model.IsChannelEnabledForGroupModel(usingGroup, modelRequest.Model, preferred.Id) {
-							channel = preferred
-							selectGroup = usingGroup
-							service.MarkChannelAffinityUsed(c, usingGroup, preferred.Id)
 						}
 					}
 				}
 
 				if channel == nil {
-					channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+					retryParam := &service.RetryParam{
 						Ctx:        c,
 						ModelName:  modelRequest.Model,
 						TokenGroup: usingGroup,
 						Retry:      common.GetPointer(0),
-					})
+					}
+					if alias != nil {
+						channel, selectGroup, err = service.SelectModelAliasChannel(retryParam, alias)
+						modelRequest.Model = retryParam.ModelName
+					} else {
+						channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(retryParam)
+					}
 					if err != nil {
 						showGroup := usingGroup
 						if usingGroup == "auto" {
@@ -139,6 +183,14 @@ func Distribute() func(c *gin.Context) {
 						//	common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
 						//	message = "数据库一致性已被破坏，请联系管理员"
 						//}
+						if errors.Is(err, service.ErrNoCompliantChannel) {
+							abortWithOpenAiMessage(c, http.StatusForbidden, message)
+							return
+						}
+						if errors.Is(err, service.ErrNoCapableChannel) {
+							abortWithOpenAiMessage(c, http.StatusBadRequest, message)
+							return
+						}
 						abortWithOpenAiMessage(c, http.StatusServiceUnavailable, message, types.ErrorCodeModelNotFound)
 						return
 					}
@@ -149,7 +201,12 @@ func Distribute() func(c *gin.Context) {
 				}
 			}
 		}
+		service.AddLatencyRouting(c, time.Since(routingStart))
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
+		if channel != nil {
+			release := service.TrackInFlightRequest(c, modelRequest.Model)
+			defer release()
+		}
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
 		c.Next()
 		if channel != nil && c.Writer != nil && c.Writer.Status() < http.StatusBadRequest {
@@ -326,8 +383,10 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 			return nil, false, err
 		}
 		modelRequest.Model = req.Model
-		modelRequest.Group = req.Group
-		common.SetContextKey(c, constant.ContextKeyTokenGroup, modelRequest.Group)
+		if common.GetContextKeyInt(c, constant.ContextKeyTokenId) == 0 {
+			modelRequest.Group = req.Group
+			common.SetContextKey(c, constant.ContextKeyTokenGroup, modelRequest.Group)
+		}
 	}
 
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/responses/compact") && modelRequest.Model != "" {
@@ -343,10 +402,13 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	common.SetContextKey(c, constant.ContextKeyChannelId, channel.Id)
 	common.SetContextKey(c, constant.ContextKeyChannelName, channel.Name)
+	service.UpdateInFlightChannel(c, channel)
 	common.SetContextKey(c, constant.ContextKeyChannelType, channel.Type)
 	common.SetContextKey(c, constant.ContextKeyChannelCreateTime, channel.CreatedTime)
 	common.SetContextKey(c, constant.ContextKeyChannelSetting, channel.GetSetting())
-	common.SetContextKey(c, constant.ContextKeyChannelOtherSetting, channel.GetOtherSettings())
+	otherSettings := channel.GetOtherSettings()
+	common.SetContextKey(c, constant.ContextKeyChannelOtherSetting, otherSettings)
+	common.SetContextKey(c, constant.ContextKeyChannelLogPayloadMaxRunes, otherSettings.LogPayloadMaxRunes)
 	common.SetContextKey(c, constant.ContextKeyChannelParamOverride, channel.GetParamOverride())
 	common.SetContextKey(c, constant.ContextKeyChannelHeaderOverride, channel.GetHeaderOverride())
 	if nil != channel.OpenAIOrganization && *channel.OpenAIOrganization != "" {
@@ -355,6 +417,9 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelAutoBan, channel.GetAutoBan())
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
+	common.SetContextKey(c, constant.ContextKeyChannelRegion, channel.GetRegion())
+	common.SetContextKey(c, constant.ContextKeyChannelOwnerUserId, channel.OwnerUserId)
+	common.SetContextKey(c, constant.ContextKeyChannelTag, channel.GetTag())
 
 	key, index, newAPIError := channel.GetNextEnabledKey()
 	if newAPIError != nil {
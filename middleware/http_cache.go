@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 热点只读接口（模型列表、定价）的响应缓存，支持 ETag / Last-Modified 条件请求。
+// 渠道或配置变化时 model.InvalidateCatalogCache 递增版本号，旧缓存随之失效；
+// 定价数据本身有分钟级的延迟刷新，因此缓存额外设置了较短的过期时间。
+
+const (
+	httpCacheTTL        = time.Minute
+	httpCacheMaxEntries = 10000
+)
+
+type httpCacheEntry struct {
+	version      int64
+	createdAt    time.Time
+	lastModified time.Time
+	etag         string
+	contentType  string
+	body         []byte
+}
+
+var (
+	httpCacheLock    sync.RWMutex
+	httpCacheEntries = make(map[string]*httpCacheEntry)
+)
+
+// httpCacheWriter buffers the response so the ETag can be computed before anything is sent.
+type httpCacheWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *httpCacheWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *httpCacheWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func httpCacheNotModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if since := c.GetHeader("If-Modified-Since"); since != "" {
+		if t, err := http.ParseTime(since); err == nil && !lastModified.Truncate(time.Second).After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeHttpCacheEntry(c *gin.Context, entry *httpCacheEntry) {
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("ETag", entry.etag)
+	c.Header("Last-Modified", entry.lastModified.UTC().Format(http.TimeFormat))
+	if httpCacheNotModified(c, entry.etag, entry.lastModified) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Data(http.StatusOK, entry.contentType, entry.body)
+}
+
+// HTTPCache caches successful GET responses per path, query and the variant returned by variantKey
+// (the token or user the response depends on), and answers conditional requests with 304.
+func HTTPCache(variantKey func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		version := model.GetCatalogVersion()
+		key := c.Request.URL.Path + "?" + c.Request.URL.RawQuery + "|" + variantKey(c)
+
+		httpCacheLock.RLock()
+		entry, ok := httpCacheEntries[key]
+		httpCacheLock.RUnlock()
+		if ok && entry.version == version && time.Since(entry.createdAt) < httpCacheTTL {
+			writeHttpCacheEntry(c, entry)
+			c.Abort()
+			return
+		}
+
+		originWriter := c.Writer
+		writer := &httpCacheWriter{ResponseWriter: originWriter}
+		c.Writer = writer
+		c.Next()
+		c.Writer = originWriter
+
+		body := writer.body.Bytes()
+		// 只缓存成功的响应，部分接口出错时也返回 200 和 success: false
+		if writer.Status() != http.StatusOK || bytes.Contains(body, []byte(`"success":false`)) {
+			_, _ = originWriter.Write(body)
+			return
+		}
+		sum := sha1.Sum(body)
+		newEntry := &httpCacheEntry{
+			version:      version,
+			createdAt:    time.Now(),
+			lastModified: time.Now(),
+			etag:         `W/"` + hex.EncodeToString(sum[:10]) + `"`,
+			contentType:  writer.Header().Get("Content-Type"),
+			body:         body,
+		}
+		// 内容未变化时保留原来的 Last-Modified
+		if ok && entry.etag == newEntry.etag {
+			newEntry.lastModified = entry.lastModified
+		}
+		httpCacheLock.Lock()
+		if len(httpCacheEntries) >= httpCacheMaxEntries {
+			httpCacheEntries = make(map[string]*httpCacheEntry)
+		}
+		httpCacheEntries[key] = newEntry
+		httpCacheLock.Unlock()
+		writeHttpCacheEntry(c, newEntry)
+	}
+}
+
+// TokenCacheVariant keys cached responses by token and by the API format picked from the request headers.
+func TokenCacheVariant(c *gin.Context) string {
+	format := "openai"
+	switch {
+	case c.GetHeader("x-api-key") != "" && c.GetHeader("anthropic-version") != "":
+		format = "anthropic"
+	case c.GetHeader("x-goog-api-key") != "" || c.Query("key") != "":
+		format = "gemini"
+	}
+	return strconv.Itoa(c.GetInt("token_id")) + "|" + format
+}
+
+// UserCacheVariant keys cached responses by the logged in user, 0 for anonymous visitors.
+func UserCacheVariant(c *gin.Context) string {
+	return strconv.Itoa(c.GetInt("id"))
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// 模拟登录期间禁止的操作，避免管理员修改被模拟用户的登录凭据或查看其令牌密钥。
+// prefix 按请求路径前缀匹配，route 按 gin 注册的路由完全匹配
+var impersonationBlockedRoutes = []struct {
+	method string
+	prefix string
+	route  string
+}{
+	{method: http.MethodPut, prefix: "/api/user/self"},
+	{method: http.MethodDelete, prefix: "/api/user/self"},
+	{method: http.MethodPost, prefix: "/api/user/self/revoke_all"},
+	{method: http.MethodGet, prefix: "/api/user/token"},
+	{prefix: "/api/user/passkey"},
+	{prefix: "/api/user/2fa"},
+	// 令牌列表、搜索与详情会返回完整的令牌密钥
+	{method: http.MethodGet, route: "/api/token/"},
+	{method: http.MethodGet, route: "/api/token/search"},
+	{method: http.MethodGet, route: "/api/token/:id"},
+}
+
+func isImpersonationBlocked(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	for _, route := range impersonationBlockedRoutes {
+		if route.method != "" && route.method != c.Request.Method {
+			continue
+		}
+		if route.route != "" {
+			if c.FullPath() == route.route {
+				return true
+			}
+			continue
+		}
+		if strings.HasPrefix(path, route.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImpersonation enforces the time limit and restrictions of an impersonation session and records
+// every impersonated request, reads included, in the audit log. It returns false when the request has been aborted.
+func checkImpersonation(c *gin.Context, session sessions.Session, userId int) bool {
+	impersonatorId, ok := session.Get(common.SessionKeyImpersonatorId).(int)
+	if !ok {
+		return true
+	}
+	impersonatorUsername, _ := session.Get(common.SessionKeyImpersonatorUsername).(string)
+	expiresAt, _ := session.Get(common.SessionKeyImpersonationExpiresAt).(int64)
+	if common.GetTimestamp() >= expiresAt {
+		if _, err := EndImpersonation(c); err != nil {
+			common.SysError(fmt.Sprintf("failed to end expired impersonation of user %d: %s", userId, err.Error()))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "模拟登录已超过时限，已恢复为管理员身份，请刷新页面",
+		})
+		c.Abort()
+		return false
+	}
+	if isImpersonationBlocked(c) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "模拟登录期间不允许此操作",
+		})
+		c.Abort()
+		return false
+	}
+
+	c.Set("impersonator_id", impersonatorId)
+	model.RecordLog(userId, model.LogTypeManage, fmt.Sprintf("[模拟登录] 管理员 %s(#%d) 执行操作 %s %s",
+		impersonatorUsername, impersonatorId, c.Request.Method, c.Request.URL.Path))
+	return true
+}
+
+// StartImpersonation switches the session to the target user, remembering the admin to restore later.
+func StartImpersonation(c *gin.Context, admin *model.User, target *model.User, expiresAt int64) error {
+	session := sessions.Default(c)
+	session.Set(common.SessionKeyImpersonatorId, admin.Id)
+	session.Set(common.SessionKeyImpersonatorUsername, admin.Username)
+	session.Set(common.SessionKeyImpersonationExpiresAt, expiresAt)
+	session.Set("id", target.Id)
+	session.Set("username", target.Username)
+	session.Set("role", target.Role)
+	session.Set("status", target.Status)
+	session.Set("group", target.Group)
+	if err := session.Save(); err != nil {
+		return err
+	}
+	model.RecordLog(target.Id, model.LogTypeManage, fmt.Sprintf("[模拟登录] 管理员 %s(#%d) 开始模拟登录该账户", admin.Username, admin.Id))
+	model.RecordLog(admin.Id, model.LogTypeManage, fmt.Sprintf("开始模拟登录用户 %s(#%d)", target.Username, target.Id))
+	return nil
+}
+
+// EndImpersonation restores the admin session saved by StartImpersonation and returns the admin.
+func EndImpersonation(c *gin.Context) (*model.User, error) {
+	session := sessions.Default(c)
+	impersonatorId, ok := session.Get(common.SessionKeyImpersonatorId).(int)
+	if !ok {
+		return nil, errors.New("当前未处于模拟登录状态")
+	}
+	targetId, _ := session.Get("id").(int)
+	admin, err := model.GetUserById(impersonatorId, false)
+	if err != nil {
+		session.Clear()
+		_ = session.Save()
+		return nil, err
+	}
+	session.Delete(common.SessionKeyImpersonatorId)
+	session.Delete(common.SessionKeyImpersonatorUsername)
+	session.Delete(common.SessionKeyImpersonationExpiresAt)
+	session.Set("id", admin.Id)
+	session.Set("username", admin.Username)
+	session.Set("role", admin.Role)
+	session.Set("status", admin.Status)
+	session.Set("group", admin.Group)
+	if err = session.Save(); err != nil {
+		return nil, err
+	}
+	model.RecordLog(targetId, model.LogTypeManage, fmt.Sprintf("[模拟登录] 管理员 %s(#%d) 结束模拟登录该账户", admin.Username, admin.Id))
+	model.RecordLog(admin.Id, model.LogTypeManage, fmt.Sprintf("结束模拟登录用户 #%d", targetId))
+	return admin, nil
+}
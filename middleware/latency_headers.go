@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"sync"
+
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LatencyHeaders returns the latency breakdown of relay requests in the Server-Timing header when enabled,
+// the header carries the timings known when the response starts.
+func LatencyHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		breakdown := service.StartLatencyBreakdown(c)
+		if breakdown == nil {
+			c.Next()
+			return
+		}
+		c.Writer = &latencyHeaderWriter{ResponseWriter: c.Writer, breakdown: breakdown}
+		c.Next()
+	}
+}
+
+type latencyHeaderWriter struct {
+	gin.ResponseWriter
+	breakdown *service.LatencyBreakdown
+	once      sync.Once
+}
+
+func (w *latencyHeaderWriter) setServerTiming() {
+	w.once.Do(func() {
+		if !w.ResponseWriter.Written() {
+			w.ResponseWriter.Header().Set("Server-Timing", w.breakdown.ServerTiming())
+		}
+	})
+}
+
+func (w *latencyHeaderWriter) WriteHeaderNow() {
+	w.setServerTiming()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *latencyHeaderWriter) Write(data []byte) (int, error) {
+	w.setServerTiming()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *latencyHeaderWriter) WriteString(s string) (int, error) {
+	w.setServerTiming()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *latencyHeaderWriter) Flush() {
+	w.setServerTiming()
+	w.ResponseWriter.Flush()
+}
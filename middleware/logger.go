@@ -2,16 +2,46 @@ package middleware
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/gin-gonic/gin"
 )
 
+// accessLogEntry 访问日志的 JSON 格式，字段与系统日志一致
+type accessLogEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Msg       string `json:"msg"`
+	RequestId string `json:"request_id,omitempty"`
+	Status    int    `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	ClientIp  string `json:"client_ip"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+}
+
 func SetUpLogger(server *gin.Engine) {
 	server.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 		var requestID string
 		if param.Keys != nil {
-			requestID = param.Keys[common.RequestIdKey].(string)
+			requestID, _ = param.Keys[common.RequestIdKey].(string)
+		}
+		if common.LogFormatJSON {
+			line, err := common.Marshal(accessLogEntry{
+				Time:      param.TimeStamp.Format(time.RFC3339Nano),
+				Level:     "INFO",
+				Msg:       "access",
+				RequestId: requestID,
+				Status:    param.StatusCode,
+				LatencyMs: param.Latency.Milliseconds(),
+				ClientIp:  param.ClientIP,
+				Method:    param.Method,
+				Path:      param.Path,
+			})
+			if err == nil {
+				return string(line) + "\n"
+			}
 		}
 		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %7s %s\n",
 			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/common/limiter"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 
 	"github.com/gin-gonic/gin"
@@ -21,48 +22,48 @@ const (
 	ModelRequestRateLimitSuccessCountMark = "MRRLS"
 )
 
-// 检查Redis中的请求限制
-func checkRedisRateLimit(ctx context.Context, rdb *redis.Client, key string, maxCount int, duration int64) (bool, error) {
+// 检查Redis中的请求限制，拒绝时同时返回窗口内最早的请求过期还需等待的秒数
+func checkRedisRateLimit(ctx context.Context, rdb redis.UniversalClient, key string, maxCount int, duration int64) (bool, int64, error) {
 	// 如果maxCount为0，表示不限制
 	if maxCount == 0 {
-		return true, nil
+		return true, 0, nil
 	}
 
 	// 获取当前计数
 	length, err := rdb.LLen(ctx, key).Result()
 	if err != nil {
-		return false, err
+		return false, 0, err
 	}
 
 	// 如果未达到限制，允许请求
 	if length < int64(maxCount) {
-		return true, nil
+		return true, 0, nil
 	}
 
 	// 检查时间窗口
 	oldTimeStr, _ := rdb.LIndex(ctx, key, -1).Result()
 	oldTime, err := time.Parse(timeFormat, oldTimeStr)
 	if err != nil {
-		return false, err
+		return false, 0, err
 	}
 
 	nowTimeStr := time.Now().Format(timeFormat)
 	nowTime, err := time.Parse(timeFormat, nowTimeStr)
 	if err != nil {
-		return false, err
+		return false, 0, err
 	}
 	// 如果在时间窗口内已达到限制，拒绝请求
 	subTime := nowTime.Sub(oldTime).Seconds()
 	if int64(subTime) < duration {
 		rdb.Expire(ctx, key, time.Duration(setting.ModelRequestRateLimitDurationMinutes)*time.Minute)
-		return false, nil
+		return false, duration - int64(subTime), nil
 	}
 
-	return true, nil
+	return true, 0, nil
 }
 
 // 记录Redis请求
-func recordRedisRequest(ctx context.Context, rdb *redis.Client, key string, maxCount int) {
+func recordRedisRequest(ctx context.Context, rdb redis.UniversalClient, key string, maxCount int) {
 	// 如果maxCount为0，不记录请求
 	if maxCount == 0 {
 		return
@@ -74,48 +75,83 @@ func recordRedisRequest(ctx context.Context, rdb *redis.Client, key string, maxC
 	rdb.Expire(ctx, key, time.Duration(setting.ModelRequestRateLimitDurationMinutes)*time.Minute)
 }
 
+// rateLimitRejection 被限流时返回给客户端的信息
+type rateLimitRejection struct {
+	message    string
+	limit      int
+	retryAfter int64
+}
+
+// admitWithQueue runs admit and, when the request is rate limited, waits for admission in the request queue.
+// It returns false after aborting the request.
+func admitWithQueue(c *gin.Context, key string, admit func() (*rateLimitRejection, error)) bool {
+	rejection, err := admit()
+	if err != nil {
+		fmt.Println("检查请求数限制失败:", err.Error())
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+		return false
+	}
+	if rejection == nil {
+		return true
+	}
+	err = service.WaitForRateLimit(c, key, func() (bool, int64) {
+		rejection, err = admit()
+		if err != nil {
+			return false, 0
+		}
+		if rejection == nil {
+			return true, 0
+		}
+		return false, rejection.retryAfter
+	})
+	if err == nil {
+		return true
+	}
+	abortWithRateLimit(c, rejection.message, rejection.limit, rejection.retryAfter)
+	return false
+}
+
 // Redis限流处理器
 func redisRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userId := strconv.Itoa(c.GetInt("id"))
 		ctx := context.Background()
 		rdb := common.RDB
-
-		// 1. 检查成功请求数限制
 		successKey := fmt.Sprintf("rateLimit:%s:%s", ModelRequestRateLimitSuccessCountMark, userId)
-		allowed, err := checkRedisRateLimit(ctx, rdb, successKey, successMaxCount, duration)
-		if err != nil {
-			fmt.Println("检查成功请求数限制失败:", err.Error())
-			abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
-			return
-		}
-		if !allowed {
-			abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到请求数限制：%d分钟内最多请求%d次", setting.ModelRequestRateLimitDurationMinutes, successMaxCount))
-			return
-		}
-
-		//2.检查总请求数限制并记录总请求（当totalMaxCount为0时会自动跳过，使用令牌桶限流器
-		if totalMaxCount > 0 {
-			totalKey := fmt.Sprintf("rateLimit:%s", userId)
-			// 初始化
-			tb := limiter.New(ctx, rdb)
-			allowed, err = tb.Allow(
-				ctx,
-				totalKey,
-				limiter.WithCapacity(int64(totalMaxCount)*duration),
-				limiter.WithRate(int64(totalMaxCount)),
-				limiter.WithRequested(duration),
-			)
 
+		admitted := admitWithQueue(c, userId, func() (*rateLimitRejection, error) {
+			// 1. 检查成功请求数限制
+			allowed, retryAfter, err := checkRedisRateLimit(ctx, rdb, successKey, successMaxCount, duration)
 			if err != nil {
-				fmt.Println("检查总请求数限制失败:", err.Error())
-				abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
-				return
+				return nil, err
 			}
-
 			if !allowed {
-				abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", setting.ModelRequestRateLimitDurationMinutes, totalMaxCount))
+				return &rateLimitRejection{fmt.Sprintf("您已达到请求数限制：%d分钟内最多请求%d次", setting.ModelRequestRateLimitDurationMinutes, successMaxCount), successMaxCount, retryAfter}, nil
 			}
+
+			//2.检查总请求数限制并记录总请求（当totalMaxCount为0时会自动跳过，使用令牌桶限流器
+			if totalMaxCount > 0 {
+				totalKey := fmt.Sprintf("rateLimit:%s", userId)
+				// 初始化
+				tb := limiter.New(ctx, rdb)
+				allowed, retryAfter, err = tb.AllowWithWait(
+					ctx,
+					totalKey,
+					limiter.WithCapacity(int64(totalMaxCount)*duration),
+					limiter.WithRate(int64(totalMaxCount)),
+					limiter.WithRequested(duration),
+				)
+				if err != nil {
+					return nil, err
+				}
+				if !allowed {
+					return &rateLimitRejection{fmt.Sprintf("您已达到总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", setting.ModelRequestRateLimitDurationMinutes, totalMaxCount), totalMaxCount, retryAfter}, nil
+				}
+			}
+			return nil, nil
+		})
+		if !admitted {
+			return
 		}
 
 		// 4. 处理请求
@@ -128,6 +164,46 @@ func redisRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) g
 	}
 }
 
+// Redis严格模式限流处理器，总请求数和成功请求数在一个 Lua 脚本中原子地检查并记录，成功请求数包括处理中的请求，
+// 多实例共享计数，不会像默认模式一样在并发时超出限制
+func strictRedisRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := strconv.Itoa(c.GetInt("id"))
+		ctx := context.Background()
+		// 使用相同的 hash tag，保证 Redis Cluster 中两个 key 位于同一个 slot
+		totalKey := fmt.Sprintf("rateLimit:strict:{%s}:total", userId)
+		successKey := fmt.Sprintf("rateLimit:strict:{%s}:success", userId)
+		member := common.GetUUID()
+		tb := limiter.New(ctx, common.RDB)
+
+		admitted := admitWithQueue(c, userId, func() (*rateLimitRejection, error) {
+			allowed, retryAfter, reached, err := tb.ReserveStrict(ctx, totalKey, successKey, member, duration, totalMaxCount, successMaxCount)
+			if err != nil {
+				return nil, err
+			}
+			if allowed {
+				return nil, nil
+			}
+			if reached == limiter.StrictLimitTotal {
+				return &rateLimitRejection{fmt.Sprintf("您已达到总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", setting.ModelRequestRateLimitDurationMinutes, totalMaxCount), totalMaxCount, retryAfter}, nil
+			}
+			return &rateLimitRejection{fmt.Sprintf("您已达到请求数限制：%d分钟内最多请求%d次", setting.ModelRequestRateLimitDurationMinutes, successMaxCount), successMaxCount, retryAfter}, nil
+		})
+		if !admitted {
+			return
+		}
+
+		c.Next()
+
+		// 失败的请求不计入成功请求数，释放预留的名额
+		if c.Writer.Status() >= 400 && successMaxCount > 0 {
+			if err := tb.ReleaseStrict(ctx, successKey, member); err != nil {
+				common.SysError("failed to release strict rate limit reservation: " + err.Error())
+			}
+		}
+	}
+}
+
 // 内存限流处理器
 func memoryRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) gin.HandlerFunc {
 	inMemoryRateLimiter.Init(time.Duration(setting.ModelRequestRateLimitDurationMinutes) * time.Minute)
@@ -137,19 +213,23 @@ func memoryRateLimitHandler(duration int64, totalMaxCount, successMaxCount int)
 		totalKey := ModelRequestRateLimitCountMark + userId
 		successKey := ModelRequestRateLimitSuccessCountMark + userId
 
-		// 1. 检查总请求数限制（当totalMaxCount为0时跳过）
-		if totalMaxCount > 0 && !inMemoryRateLimiter.Request(totalKey, totalMaxCount, duration) {
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
-			return
-		}
+		admitted := admitWithQueue(c, userId, func() (*rateLimitRejection, error) {
+			// 1. 检查总请求数限制（当totalMaxCount为0时跳过）
+			if totalMaxCount > 0 && !inMemoryRateLimiter.Request(totalKey, totalMaxCount, duration) {
+				return &rateLimitRejection{fmt.Sprintf("您已达到总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", setting.ModelRequestRateLimitDurationMinutes, totalMaxCount),
+					totalMaxCount, inMemoryRateLimiter.RetryAfter(totalKey, totalMaxCount, duration)}, nil
+			}
 
-		// 2. 检查成功请求数限制
-		// 使用一个临时key来检查限制，这样可以避免实际记录
-		checkKey := successKey + "_check"
-		if !inMemoryRateLimiter.Request(checkKey, successMaxCount, duration) {
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
+			// 2. 检查成功请求数限制
+			// 使用一个临时key来检查限制，这样可以避免实际记录
+			checkKey := successKey + "_check"
+			if !inMemoryRateLimiter.Request(checkKey, successMaxCount, duration) {
+				return &rateLimitRejection{fmt.Sprintf("您已达到请求数限制：%d分钟内最多请求%d次", setting.ModelRequestRateLimitDurationMinutes, successMaxCount),
+					successMaxCount, inMemoryRateLimiter.RetryAfter(checkKey, successMaxCount, duration)}, nil
+			}
+			return nil, nil
+		})
+		if !admitted {
 			return
 		}
 
@@ -190,8 +270,10 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 			successMaxCount = groupSuccessCount
 		}
 
-		// 根据存储类型选择并执行限流处理器
-		if common.RedisEnabled {
+		// 根据存储类型选择并执行限流处理器，未启用 Redis 时只有单个实例，使用内存限流
+		if common.RedisEnabled && setting.IsGroupRateLimitStrict(group) {
+			strictRedisRateLimitHandler(duration, totalMaxCount, successMaxCount)(c)
+		} else if common.RedisEnabled {
 			redisRateLimitHandler(duration, totalMaxCount, successMaxCount)(c)
 		} else {
 			memoryRateLimitHandler(duration, totalMaxCount, successMaxCount)(c)
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OtelTracing starts the OpenTelemetry span of the request when tracing is enabled in the options.
+func OtelTracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !service.StartOtelServerSpan(c) {
+			c.Next()
+			return
+		}
+		defer service.FinishOtelServerSpan(c)
+		c.Next()
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaygroundToken runs a playground request with the token selected in the console, the request then uses the
+// group, the model limits and the quota of the token and is billed to it like a request made with its key.
+func PlaygroundToken() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		playgroundRequest := &dto.PlayGroundRequest{}
+		if err := common.UnmarshalBodyReusable(c, playgroundRequest); err != nil || playgroundRequest.TokenId == 0 {
+			c.Next()
+			return
+		}
+		if c.GetBool("use_access_token") {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "暂不支持使用 access token", types.ErrorCodeAccessDenied)
+			return
+		}
+		token, err := model.GetTokenByIds(playgroundRequest.TokenId, c.GetInt("id"))
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusNotFound, "令牌不存在")
+			return
+		}
+		// 与使用令牌密钥请求时一样检查令牌状态、过期时间和额度
+		token, err = model.ValidateUserToken(token.Key)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
+			return
+		}
+		if err = token.CheckAccessTime(time.Now()); err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error(), types.ErrorCodeAccessDenied)
+			return
+		}
+		userCache, err := model.GetUserCache(token.UserId)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		userGroup, err := tokenUsingGroup(userCache.Group, token.Group)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
+			return
+		}
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
+		if err = SetupContextForToken(c, token); err != nil {
+			return
+		}
+		c.Next()
+	}
+}
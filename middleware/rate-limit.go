@@ -115,3 +115,7 @@ func DownloadRateLimit() func(c *gin.Context) {
 func UploadRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(common.UploadRateLimitNum, common.UploadRateLimitDuration, "UP")
 }
+
+func NotifySandboxRateLimit() func(c *gin.Context) {
+	return rateLimitFactory(common.NotifySandboxRateLimitNum, common.NotifySandboxRateLimitDuration, "NS")
+}
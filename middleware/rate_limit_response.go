@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// abortWithRateLimit rejects the request with headers computed from the limiter state, so that client
+// SDKs back off exactly until the limit frees up. The body follows the configured template of the token.
+func abortWithRateLimit(c *gin.Context, message string, limit int, retryAfter int64) {
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	c.Header("x-ratelimit-limit-requests", strconv.Itoa(limit))
+	c.Header("x-ratelimit-remaining-requests", "0")
+	c.Header("x-ratelimit-reset-requests", fmt.Sprintf("%ds", retryAfter))
+
+	template := operation_setting.GetRateLimitResponseSetting().GetErrorTemplate(c.GetInt("token_id"))
+	if template == "" {
+		abortWithOpenAiMessage(c, http.StatusTooManyRequests, message)
+		return
+	}
+	requestId := c.GetString(common.RequestIdKey)
+	body := strings.NewReplacer(
+		"{{message}}", jsonEscape(message),
+		"{{retry_after}}", strconv.FormatInt(retryAfter, 10),
+		"{{limit}}", strconv.Itoa(limit),
+		"{{request_id}}", jsonEscape(requestId),
+	).Replace(template)
+	var payload any
+	if err := common.UnmarshalJsonStr(body, &payload); err != nil {
+		logger.LogWarn(c.Request.Context(), fmt.Sprintf("invalid rate limit error template: %s", err.Error()))
+		abortWithOpenAiMessage(c, http.StatusTooManyRequests, message)
+		return
+	}
+	c.Data(http.StatusTooManyRequests, "application/json", []byte(body))
+	c.Abort()
+	logger.LogError(c.Request.Context(), fmt.Sprintf("user %d | %s", c.GetInt("id"), message))
+}
+
+// jsonEscape returns s escaped for use inside a JSON string literal.
+func jsonEscape(s string) string {
+	escaped, err := common.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	return string(escaped[1 : len(escaped)-1])
+}
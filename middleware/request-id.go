@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/gin-gonic/gin"
@@ -9,11 +10,16 @@ import (
 
 func RequestId() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		id := common.GetTimeString() + common.GetRandomString(8)
+		// 客户端传入 X-Request-Id 时沿用，便于与客户端日志对应
+		id := strings.TrimSpace(c.GetHeader(common.RequestIdHeader))
+		if !common.ValidInboundRequestId(id) {
+			id = common.GenerateRequestId()
+		}
 		c.Set(common.RequestIdKey, id)
 		ctx := context.WithValue(c.Request.Context(), common.RequestIdKey, id)
 		c.Request = c.Request.WithContext(ctx)
 		c.Header(common.RequestIdKey, id)
+		c.Header(common.RequestIdHeader, id)
 		c.Next()
 	}
 }
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DedupRequestIdHeader is set on responses replayed from an identical earlier request.
+const DedupRequestIdHeader = "X-New-Api-Deduplicated-From"
+
+// RequestDedup detects identical requests sent by the same token within the dedup window. Duplicates are
+// rejected or wait for the first request and receive a copy of its response without being billed again.
+func RequestDedup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetRequestDedupSetting()
+		tokenId := c.GetInt("token_id")
+		if !setting.Enabled || setting.WindowSeconds <= 0 || c.Request.Method != http.MethodPost || tokenId == 0 {
+			c.Next()
+			return
+		}
+		body, err := common.GetRequestBody(c)
+		if err != nil || len(body) == 0 {
+			c.Next()
+			return
+		}
+		key := service.RequestDedupKey(tokenId, c.Request.URL.Path, body)
+		entry, leader := service.AcquireRequestDedup(key, c.GetString(common.RequestIdKey))
+		if leader {
+			recorder := service.StartDedupRecording(c, key, entry)
+			defer recorder.Finish(c)
+			c.Next()
+			return
+		}
+
+		logger.LogWarn(c, "duplicate request of "+entry.LeaderRequestId())
+		if setting.Mode == operation_setting.RequestDedupModeReject {
+			abortWithOpenAiMessage(c, http.StatusConflict, "identical request is already being processed: "+entry.LeaderRequestId(), types.ErrorCodeDuplicateRequest)
+			return
+		}
+		result, ok := entry.Wait(c.Request.Context())
+		if !ok {
+			c.Next()
+			return
+		}
+		for name, values := range result.Header {
+			for _, value := range values {
+				c.Writer.Header().Add(name, value)
+			}
+		}
+		c.Writer.Header().Set(DedupRequestIdHeader, result.RequestId)
+		c.Status(result.Status)
+		_, _ = c.Writer.Write(result.Body)
+		c.Abort()
+
+		model.RecordConsumeLog(c, c.GetInt("id"), model.RecordConsumeLogParams{
+			ModelName: result.ModelName,
+			TokenName: c.GetString("token_name"),
+			TokenId:   tokenId,
+			Group:     result.Group,
+			Content:   "重复请求，复用请求 " + result.RequestId + " 的响应，不计费",
+			Other: map[string]interface{}{
+				"deduplicated":     true,
+				"dedup_request_id": result.RequestId,
+			},
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseCompression compresses large non-streaming JSON responses with br or gzip when the client accepts
+// it. The response is buffered until the handler returns; event streams and other responses flushed while
+// they are written are sent through unchanged.
+func ResponseCompression() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetResponseCompressionSetting()
+		if !setting.Enabled || c.GetHeader("Accept-Encoding") == "" || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		originWriter := c.Writer
+		writer := &compressionWriter{ResponseWriter: originWriter}
+		c.Writer = writer
+		c.Next()
+		c.Writer = originWriter
+		writer.finish(c, setting)
+	}
+}
+
+type compressionWriter struct {
+	gin.ResponseWriter
+	body            bytes.Buffer
+	passthrough     bool
+	headerRequested bool
+}
+
+// buffering 事件流或已经编码的响应直接透传
+func (w *compressionWriter) buffering() bool {
+	if w.passthrough {
+		return false
+	}
+	header := w.Header()
+	if strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") || header.Get("Content-Encoding") != "" {
+		w.startPassthrough()
+		return false
+	}
+	return true
+}
+
+func (w *compressionWriter) startPassthrough() {
+	w.passthrough = true
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	} else if w.headerRequested {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressionWriter) Write(data []byte) (int, error) {
+	if w.buffering() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressionWriter) WriteString(s string) (int, error) {
+	if w.buffering() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *compressionWriter) WriteHeaderNow() {
+	if w.buffering() {
+		w.headerRequested = true
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush 完整写出的 JSON 响应也会 Flush，此时继续缓冲；其他类型的响应在 Flush 后按流式透传
+func (w *compressionWriter) Flush() {
+	if w.buffering() && isCompressibleContentType(w.Header().Get("Content-Type")) {
+		return
+	}
+	w.startPassthrough()
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressionWriter) Written() bool {
+	return w.body.Len() > 0 || w.headerRequested || w.ResponseWriter.Written()
+}
+
+func (w *compressionWriter) Size() int {
+	if !w.passthrough && w.body.Len() > 0 {
+		return w.body.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+func (w *compressionWriter) finish(c *gin.Context, setting *operation_setting.ResponseCompressionSetting) {
+	if w.passthrough {
+		return
+	}
+	body := w.body.Bytes()
+	if len(body) == 0 {
+		if w.headerRequested {
+			w.ResponseWriter.WriteHeaderNow()
+		}
+		return
+	}
+	header := w.ResponseWriter.Header()
+	if len(body) >= setting.MinBytes && isCompressibleContentType(header.Get("Content-Type")) {
+		header.Add("Vary", "Accept-Encoding")
+		if encoding := negotiateResponseEncoding(c.GetHeader("Accept-Encoding"), setting.Brotli); encoding != "" {
+			if compressed, err := compressResponseBody(encoding, body); err == nil && len(compressed) < len(body) {
+				header.Set("Content-Encoding", encoding)
+				header.Set("Content-Length", strconv.Itoa(len(compressed)))
+				body = compressed
+			}
+		}
+	}
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+func isCompressibleContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// negotiateResponseEncoding 按 Accept-Encoding 选择 br 或 gzip，q=0 表示不接受
+func negotiateResponseEncoding(acceptEncoding string, allowBrotli bool) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case allowBrotli && accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+func compressResponseBody(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch encoding {
+	case "br":
+		writer := brotli.NewWriter(&buf)
+		if _, err = writer.Write(body); err == nil {
+			err = writer.Close()
+		}
+	default:
+		writer := gzip.NewWriter(&buf)
+		if _, err = writer.Write(body); err == nil {
+			err = writer.Close()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 将标准的 SSE 流式响应转为 WebSocket 消息，供 SSE 支持较差的客户端（部分移动端框架）使用。
+// 客户端建立连接后发送一条与 /v1/chat/completions 相同的请求体，服务端强制开启 stream，
+// 之后每个 SSE data 作为一条文本消息下发（包括最后的 [DONE]），请求结束后正常关闭连接。
+
+var streamWebSocketUpgrader = websocket.Upgrader{
+	Subprotocols: []string{"realtime"},
+	CheckOrigin:  checkStreamWebSocketOrigin,
+}
+
+const (
+	streamWebSocketReadTimeout = 30 * time.Second
+	// 请求体之后客户端发送的消息都会被忽略，只需读出控制帧
+	streamWebSocketIdleReadLimit = 4 * 1024
+)
+
+// checkStreamWebSocketOrigin 浏览器发起的跨域连接按中转 API 的跨域策略校验，非浏览器客户端不带 Origin，直接放行
+func checkStreamWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	policy := corsPolicyForPath(r.URL.Path)
+	return policy.Enabled && policy.AllowsOrigin(origin)
+}
+
+// wsStreamWriter replaces the gin writer of a bridged request, so the relay keeps writing SSE
+// while every complete event is forwarded to the websocket connection.
+type wsStreamWriter struct {
+	gin.ResponseWriter
+	conn   *websocket.Conn
+	header http.Header
+	status int
+	size   int
+	buf    bytes.Buffer
+	mu     sync.Mutex
+}
+
+func (w *wsStreamWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *wsStreamWriter) WriteHeader(code int) {
+	if code > 0 && w.size == 0 {
+		w.status = code
+	}
+}
+
+func (w *wsStreamWriter) WriteHeaderNow() {}
+
+func (w *wsStreamWriter) Status() int {
+	return w.status
+}
+
+func (w *wsStreamWriter) Size() int {
+	return w.size
+}
+
+func (w *wsStreamWriter) Written() bool {
+	return w.size > 0
+}
+
+func (w *wsStreamWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.size += len(data)
+	w.buf.Write(data)
+	return len(data), w.forwardEvents()
+}
+
+func (w *wsStreamWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *wsStreamWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.forwardEvents()
+}
+
+// forwardEvents sends every complete SSE event in the buffer, the caller must hold the lock.
+func (w *wsStreamWriter) forwardEvents() error {
+	if !strings.HasPrefix(w.header.Get("Content-Type"), "text/event-stream") {
+		return nil
+	}
+	for {
+		data := w.buf.Bytes()
+		idx := bytes.Index(data, []byte("\n\n"))
+		if idx < 0 {
+			return nil
+		}
+		event := string(data[:idx])
+		w.buf.Next(idx + 2)
+		for _, line := range strings.Split(event, "\n") {
+			payload, ok := strings.CutPrefix(line, "data:")
+			if !ok {
+				continue // 忽略 event、注释和心跳
+			}
+			if err := w.conn.WriteMessage(websocket.TextMessage, []byte(strings.TrimSpace(payload))); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// finish sends what is left in the buffer, e.g. a non-stream JSON error, and closes the connection.
+func (w *wsStreamWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.forwardEvents()
+	if rest := bytes.TrimSpace(w.buf.Bytes()); len(rest) > 0 {
+		_ = w.conn.WriteMessage(websocket.TextMessage, rest)
+	}
+	closeCode := websocket.CloseNormalClosure
+	if w.status >= http.StatusBadRequest {
+		closeCode = websocket.CloseInternalServerErr
+		if w.status < http.StatusInternalServerError {
+			closeCode = websocket.ClosePolicyViolation
+		}
+	}
+	_ = w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, strconv.Itoa(w.status)), time.Now().Add(time.Second))
+}
+
+// StreamWebSocketBridge upgrades the connection, reads the chat request from the first message and
+// lets the following handlers relay it as a normal streaming request.
+func StreamWebSocketBridge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conn, err := streamWebSocketUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			logger.LogError(c, "failed to upgrade stream websocket: "+err.Error())
+			c.Abort()
+			return
+		}
+		defer conn.Close()
+
+		conn.SetReadLimit(int64(constant.MaxRequestBodyMB) << 20)
+		_ = conn.SetReadDeadline(time.Now().Add(streamWebSocketReadTimeout))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			c.Abort()
+			return
+		}
+		_ = conn.SetReadDeadline(time.Time{})
+		conn.SetReadLimit(streamWebSocketIdleReadLimit)
+
+		var body map[string]any
+		if err = common.Unmarshal(message, &body); err != nil {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"error":{"message":"invalid request body","type":"invalid_request_error"}}`))
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseUnsupportedData, ""), time.Now().Add(time.Second))
+			c.Abort()
+			return
+		}
+		body["stream"] = true
+		requestBody, err := common.Marshal(body)
+		if err != nil {
+			c.Abort()
+			return
+		}
+
+		// 客户端断开时取消请求，与 SSE 连接断开的行为一致
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					cancel()
+					return
+				}
+			}
+		}()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Request.Method = http.MethodPost
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+		c.Request.ContentLength = int64(len(requestBody))
+
+		writer := &wsStreamWriter{
+			ResponseWriter: c.Writer,
+			conn:           conn,
+			header:         make(http.Header),
+			status:         http.StatusOK,
+		}
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+	}
+}
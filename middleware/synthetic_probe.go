@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// SyntheticProbeHeader marks responses served to configured synthetic monitoring probes.
+const SyntheticProbeHeader = "X-New-Api-Synthetic"
+
+// SyntheticProbe answers chat completions that match a configured monitoring fingerprint with a canned
+// response before a channel is selected, so uptime checks are not relayed, billed, captured or logged.
+func SyntheticProbe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetSyntheticProbeSetting()
+		if !setting.Enabled || c.Request.Method != http.MethodPost || c.Request.URL.Path != "/v1/chat/completions" {
+			c.Next()
+			return
+		}
+		body, err := common.GetRequestBody(c)
+		if err != nil || len(body) == 0 || !gjson.ValidBytes(body) {
+			c.Next()
+			return
+		}
+		request := gjson.ParseBytes(body)
+		modelName := request.Get("model").String()
+		prompt, ok := soleUserPrompt(request)
+		if !ok {
+			c.Next()
+			return
+		}
+		fingerprint := setting.MatchSyntheticProbe(c.GetInt("token_id"), modelName, prompt)
+		if fingerprint == nil {
+			c.Next()
+			return
+		}
+		c.Header(SyntheticProbeHeader, "true")
+		id := "chatcmpl-" + common.GetUUID()
+		created := common.GetTimestamp()
+		if request.Get("stream").Bool() {
+			writeSyntheticProbeStream(c, id, created, modelName, fingerprint.Response)
+		} else {
+			c.JSON(http.StatusOK, gin.H{
+				"id":      id,
+				"object":  "chat.completion",
+				"created": created,
+				"model":   modelName,
+				"choices": []gin.H{{
+					"index":         0,
+					"message":       gin.H{"role": "assistant", "content": fingerprint.Response},
+					"finish_reason": "stop",
+				}},
+				"usage": gin.H{"prompt_tokens": 0, "completion_tokens": 0, "total_tokens": 0},
+			})
+		}
+		c.Abort()
+	}
+}
+
+// soleUserPrompt returns the text of the request when the whole message list is a single text-only user
+// message. Conversations with history, system prompts or other content are never treated as probes.
+func soleUserPrompt(request gjson.Result) (string, bool) {
+	messages := request.Get("messages").Array()
+	if len(messages) != 1 || messages[0].Get("role").String() != "user" {
+		return "", false
+	}
+	content := messages[0].Get("content")
+	if content.Type == gjson.String {
+		return content.String(), true
+	}
+	if !content.IsArray() {
+		return "", false
+	}
+	text := ""
+	for _, part := range content.Array() {
+		if part.Get("type").String() != "text" {
+			return "", false
+		}
+		text += part.Get("text").String()
+	}
+	return text, true
+}
+
+func writeSyntheticProbeStream(c *gin.Context, id string, created int64, modelName string, response string) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	chunk := func(delta gin.H, finishReason any) {
+		data, _ := common.Marshal(gin.H{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   modelName,
+			"choices": []gin.H{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+		})
+		_, _ = fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	}
+	chunk(gin.H{"role": "assistant", "content": response}, nil)
+	chunk(gin.H{}, "stop")
+	_, _ = fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
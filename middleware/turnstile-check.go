@@ -14,6 +14,23 @@ type turnstileCheckResponse struct {
 	Success bool `json:"success"`
 }
 
+func verifyTurnstile(response string, remoteIp string) (bool, error) {
+	rawRes, err := http.PostForm("https://challenges.cloudflare.com/turnstile/v0/siteverify", url.Values{
+		"secret":   {common.TurnstileSecretKey},
+		"response": {response},
+		"remoteip": {remoteIp},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer rawRes.Body.Close()
+	var res turnstileCheckResponse
+	if err = json.NewDecoder(rawRes.Body).Decode(&res); err != nil {
+		return false, err
+	}
+	return res.Success, nil
+}
+
 func TurnstileCheck() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if common.TurnstileCheckEnabled {
@@ -32,23 +49,7 @@ func TurnstileCheck() gin.HandlerFunc {
 				c.Abort()
 				return
 			}
-			rawRes, err := http.PostForm("https://challenges.cloudflare.com/turnstile/v0/siteverify", url.Values{
-				"secret":   {common.TurnstileSecretKey},
-				"response": {response},
-				"remoteip": {c.ClientIP()},
-			})
-			if err != nil {
-				common.SysLog(err.Error())
-				c.JSON(http.StatusOK, gin.H{
-					"success": false,
-					"message": err.Error(),
-				})
-				c.Abort()
-				return
-			}
-			defer rawRes.Body.Close()
-			var res turnstileCheckResponse
-			err = json.NewDecoder(rawRes.Body).Decode(&res)
+			success, err := verifyTurnstile(response, c.ClientIP())
 			if err != nil {
 				common.SysLog(err.Error())
 				c.JSON(http.StatusOK, gin.H{
@@ -58,7 +59,7 @@ func TurnstileCheck() gin.HandlerFunc {
 				c.Abort()
 				return
 			}
-			if !res.Success {
+			if !success {
 				c.JSON(http.StatusOK, gin.H{
 					"success": false,
 					"message": "Turnstile 校验失败，请刷新重试！",
@@ -143,7 +143,45 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	return &channel, err
 }
 
+// getFilteredChannel is the database counterpart of the filtered memory cache lookup,
+// it loads every enabled channel of the group/model and lets filter drop the unwanted ones.
+func getFilteredChannel(group string, model string, retry int, filter ChannelFilter) (*Channel, error) {
+	candidates, err := getAbilityChannels(group, model, filter)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	return selectChannelByPriority(candidates, retry)
+}
+
+func getAbilityChannels(group string, model string, filter ChannelFilter) ([]*Channel, error) {
+	var channelIds []int
+	err := DB.Model(&Ability{}).
+		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).
+		Pluck("channel_id", &channelIds).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(channelIds) == 0 {
+		return nil, nil
+	}
+	channels, err := GetChannelsByIds(channelIds)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if filter == nil || filter(channel) {
+			candidates = append(candidates, channel)
+		}
+	}
+	return candidates, nil
+}
+
 func (channel *Channel) AddAbilities(tx *gorm.DB) error {
+	// 用户自有渠道不参与全局路由
+	if channel.IsPrivate() {
+		return nil
+	}
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
 	abilitySet := make(map[string]struct{})
@@ -240,7 +278,8 @@ func (channel *Channel) UpdateAbilities(tx *gorm.DB) error {
 		}
 	}
 
-	if len(abilities) > 0 {
+	// 用户自有渠道不参与全局路由，只清理旧的 ability
+	if len(abilities) > 0 && !channel.IsPrivate() {
 		for _, chunk := range lo.Chunk(abilities, 50) {
 			err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&chunk).Error
 			if err != nil {
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// LogRetentionTaskAudit 审计日志的清理任务名
+const LogRetentionTaskAudit = "audit_log"
+
+// AuditLog 管理员的一次修改操作。Before 与 After 为目标修改前后的状态，更新时只包含变化的字段，
+// 创建时 Before 为空，删除时 After 为空；没有明确记录目标的操作只记录请求本身
+type AuditLog struct {
+	Id         int64  `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64)"`
+	Ip         string `json:"ip" gorm:"type:varchar(64)"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	Method     string `json:"method" gorm:"type:varchar(8)"`
+	Path       string `json:"path" gorm:"type:varchar(255)"`
+	Status     int    `json:"status"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target,priority:1"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(64);index:idx_audit_target,priority:2"`
+	Before     string `json:"before" gorm:"type:text"`
+	After      string `json:"after" gorm:"type:text"`
+}
+
+func RecordAuditLog(entry *AuditLog) {
+	entry.CreatedAt = common.GetTimestamp()
+	if runes := []rune(entry.Path); len(runes) > 255 {
+		entry.Path = string(runes[:255])
+	}
+	if err := LOG_DB.Create(entry).Error; err != nil {
+		common.SysError("failed to record audit log: " + err.Error())
+	}
+}
+
+type AuditLogQuery struct {
+	ActorId        int
+	Action         string
+	TargetType     string
+	TargetId       string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+// GetAuditLogs lists the audit logs matching the query, newest first.
+func GetAuditLogs(query AuditLogQuery, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	tx := LOG_DB.Model(&AuditLog{})
+	if query.ActorId != 0 {
+		tx = tx.Where("actor_id = ?", query.ActorId)
+	}
+	if query.Action != "" {
+		tx = tx.Where("action = ?", query.Action)
+	}
+	if query.TargetType != "" {
+		tx = tx.Where("target_type = ?", query.TargetType)
+	}
+	if query.TargetId != "" {
+		tx = tx.Where("target_id = ?", query.TargetId)
+	}
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+func pruneExpiredAuditLogs(ctx context.Context, days int, archive bool) {
+	if days <= 0 {
+		return
+	}
+	cutoff := retentionCutoff(days)
+	batchSize := operation_setting.GetLogRetentionSetting().GetBatchSize()
+	batchDelay := operation_setting.GetLogRetentionSetting().BatchDelay()
+	var totalDeleted int64
+
+	for ctx.Err() == nil {
+		var batch []AuditLog
+		query := LOG_DB.Where("created_at < ?", cutoff).Order("created_at ASC").Limit(batchSize)
+		if !archive {
+			query = query.Select("id")
+		}
+		if err := query.Find(&batch).Error; err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to query expired audit logs: %s", err.Error()))
+			break
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if archive {
+			if err := archiveLogRows(ctx, LogRetentionTaskAudit, batch); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to archive expired audit logs: %s", err.Error()))
+				break
+			}
+		}
+		ids := make([]int64, 0, len(batch))
+		for _, entry := range batch {
+			ids = append(ids, entry.Id)
+		}
+		result := LOG_DB.Where("id IN ?", ids).Delete(&AuditLog{})
+		if result.Error != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to prune audit logs: %s", result.Error.Error()))
+			break
+		}
+		totalDeleted += result.RowsAffected
+		reportRetentionProgress(LogRetentionTaskAudit, result.RowsAffected)
+		if len(batch) < batchSize {
+			break
+		}
+		time.Sleep(batchDelay)
+	}
+
+	if totalDeleted > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("pruned %d audit logs older than %d days", totalDeleted, days))
+		RecordRetentionCleanup(LogRetentionTaskAudit, totalDeleted)
+	}
+}
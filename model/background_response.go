@@ -0,0 +1,147 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	BackgroundResponseQueued     = "queued"
+	BackgroundResponseInProgress = "in_progress"
+	BackgroundResponseCompleted  = "completed"
+	BackgroundResponseIncomplete = "incomplete"
+	BackgroundResponseFailed     = "failed"
+	BackgroundResponseCancelled  = "cancelled"
+)
+
+// BackgroundResponseIdPrefix 后台请求的响应 ID 前缀，用于区分上游返回的响应 ID
+const BackgroundResponseIdPrefix = "resp_bg_"
+
+var backgroundResponseActiveStatuses = []string{BackgroundResponseQueued, BackgroundResponseInProgress}
+
+// BackgroundResponse Responses 接口的后台请求，由接收请求的节点异步执行。执行期间定时更新 HeartbeatAt，
+// 节点重启等原因中断的请求在心跳超时后标记为失败
+type BackgroundResponse struct {
+	Id         int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	ResponseId string `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId     int    `json:"-" gorm:"index"`
+	TokenId    int    `json:"-"`
+	ChannelId  int    `json:"-"`
+	ModelName  string `json:"model" gorm:"type:varchar(128)"`
+	Status     string `json:"status" gorm:"type:varchar(16);index"`
+	RequestId  string `json:"-" gorm:"type:varchar(64)"`
+	// Request 去掉 background 字段后的请求体
+	Request string `json:"-" gorm:"type:text"`
+	// Response 上游返回的完整响应，id 已替换为 ResponseId
+	Response           string `json:"-" gorm:"type:text"`
+	UpstreamResponseId string `json:"-" gorm:"type:varchar(128)"`
+	// Error 失败时的 OpenAI 错误对象
+	Error       string `json:"-" gorm:"type:text"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	StartedAt   int64  `json:"-" gorm:"bigint"`
+	HeartbeatAt int64  `json:"-" gorm:"bigint"`
+	CompletedAt int64  `json:"-" gorm:"bigint"`
+}
+
+// IsActive reports whether the response is still queued or running.
+func (response *BackgroundResponse) IsActive() bool {
+	return common.StringsContains(backgroundResponseActiveStatuses, response.Status)
+}
+
+func (response *BackgroundResponse) Insert() error {
+	return DB.Create(response).Error
+}
+
+func GetUserBackgroundResponse(userId int, responseId string) (*BackgroundResponse, error) {
+	var response BackgroundResponse
+	err := DB.Where("response_id = ? AND user_id = ?", responseId, userId).First(&response).Error
+	return &response, err
+}
+
+// CountActiveBackgroundResponses counts the queued and running background responses of the user.
+func CountActiveBackgroundResponses(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&BackgroundResponse{}).Where("user_id = ? AND status IN ?", userId, backgroundResponseActiveStatuses).
+		Count(&count).Error
+	return count, err
+}
+
+// StartBackgroundResponse moves the queued response to in progress, it returns false when it was cancelled meanwhile.
+func StartBackgroundResponse(response *BackgroundResponse) (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&BackgroundResponse{}).Where("id = ? AND status = ?", response.Id, BackgroundResponseQueued).
+		Updates(map[string]any{"status": BackgroundResponseInProgress, "started_at": now, "heartbeat_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	response.Status = BackgroundResponseInProgress
+	response.StartedAt = now
+	response.HeartbeatAt = now
+	return true, nil
+}
+
+// HeartbeatBackgroundResponse records that the response is still running and returns its current status, which
+// the runner checks for cancellation.
+func HeartbeatBackgroundResponse(id int) (string, error) {
+	err := DB.Model(&BackgroundResponse{}).Where("id = ? AND status = ?", id, BackgroundResponseInProgress).
+		Update("heartbeat_at", common.GetTimestamp()).Error
+	if err != nil {
+		return "", err
+	}
+	var status string
+	err = DB.Model(&BackgroundResponse{}).Select("status").Where("id = ?", id).Row().Scan(&status)
+	return status, err
+}
+
+// FinishBackgroundResponse saves the outcome of a running response, it returns false when the response was
+// cancelled or marked failed meanwhile and keeps that status.
+func FinishBackgroundResponse(response *BackgroundResponse) (bool, error) {
+	response.CompletedAt = common.GetTimestamp()
+	result := DB.Model(&BackgroundResponse{}).Where("id = ? AND status IN ?", response.Id, backgroundResponseActiveStatuses).
+		Updates(map[string]any{
+			"status":               response.Status,
+			"response":             response.Response,
+			"upstream_response_id": response.UpstreamResponseId,
+			"error":                response.Error,
+			"completed_at":         response.CompletedAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CancelBackgroundResponse cancels the queued or running response, it returns false when it already finished.
+func CancelBackgroundResponse(response *BackgroundResponse) (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&BackgroundResponse{}).Where("id = ? AND status IN ?", response.Id, backgroundResponseActiveStatuses).
+		Updates(map[string]any{"status": BackgroundResponseCancelled, "completed_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	response.Status = BackgroundResponseCancelled
+	response.CompletedAt = now
+	return true, nil
+}
+
+// FailStaleBackgroundResponses marks the running responses without a heartbeat since before as failed, and the
+// queued ones created before it, their node stopped before finishing them.
+func FailStaleBackgroundResponses(before int64, errorJson string) (int64, error) {
+	result := DB.Model(&BackgroundResponse{}).
+		Where("(status = ? AND heartbeat_at < ?) OR (status = ? AND created_at < ?)",
+			BackgroundResponseInProgress, before, BackgroundResponseQueued, before).
+		Updates(map[string]any{"status": BackgroundResponseFailed, "error": errorJson, "completed_at": common.GetTimestamp()})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteFinishedBackgroundResponses deletes the responses finished before the given time.
+func DeleteFinishedBackgroundResponses(before int64) (int64, error) {
+	result := DB.Where("status NOT IN ? AND completed_at < ?", backgroundResponseActiveStatuses, before).
+		Delete(&BackgroundResponse{})
+	return result.RowsAffected, result.Error
+}
+
+// GetBackgroundResponseUpstreamId returns the id the upstream gave to the background response of the user, so
+// that it can be referenced as previous_response_id.
+func GetBackgroundResponseUpstreamId(userId int, responseId string) (string, error) {
+	var upstreamId string
+	err := DB.Model(&BackgroundResponse{}).Select("upstream_response_id").
+		Where("response_id = ? AND user_id = ?", responseId, userId).Row().Scan(&upstreamId)
+	return upstreamId, err
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusFailed     = "failed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch 兼容 OpenAI 的批量任务，请求逐行读取自 InputFileId，由主节点的后台任务执行。
+// ProcessedRequests 记录已执行的请求行数，结果按分片写入对象存储，重启后从该行继续执行。
+type Batch struct {
+	Id                int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	BatchId           string `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId            int    `json:"-" gorm:"index"`
+	TokenId           int    `json:"-"`
+	Endpoint          string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId       string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId      string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId       string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow  string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status            string `json:"status" gorm:"type:varchar(16);index"`
+	TotalRequests     int    `json:"total_requests"`
+	CompletedRequests int    `json:"completed_requests"`
+	FailedRequests    int    `json:"failed_requests"`
+	ProcessedRequests int    `json:"-"`
+	Parts             int    `json:"-"` // 已写入的结果分片数
+	Error             string `json:"error" gorm:"type:text"`
+	Metadata          string `json:"metadata" gorm:"type:text"`
+	CreatedAt         int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt      int64  `json:"in_progress_at" gorm:"bigint"`
+	FinalizingAt      int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt       int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt          int64  `json:"failed_at" gorm:"bigint"`
+	ExpiresAt         int64  `json:"expires_at" gorm:"bigint"`
+	ExpiredAt         int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt      int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt       int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+// IsFinished reports whether the batch reached a final status.
+func (batch *Batch) IsFinished() bool {
+	switch batch.Status {
+	case BatchStatusCompleted, BatchStatusFailed, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+// UpdateProgress saves the request counters of the batch without touching its status, which may be cancelled meanwhile.
+func (batch *Batch) UpdateProgress() error {
+	return DB.Model(batch).Select("completed_requests", "failed_requests", "processed_requests", "parts").Updates(batch).Error
+}
+
+// Update saves the status, the result files and the timestamps of the batch along with its progress.
+func (batch *Batch) Update() error {
+	return DB.Model(batch).Select("output_file_id", "error_file_id", "status", "completed_requests", "failed_requests",
+		"processed_requests", "parts", "error", "in_progress_at", "finalizing_at", "completed_at", "failed_at", "expired_at",
+		"cancelled_at").Updates(batch).Error
+}
+
+func GetUserBatch(userId int, batchId string) (*Batch, error) {
+	var batch Batch
+	err := DB.Where("batch_id = ? AND user_id = ?", batchId, userId).First(&batch).Error
+	return &batch, err
+}
+
+func GetBatchById(id int) (*Batch, error) {
+	var batch Batch
+	err := DB.First(&batch, id).Error
+	return &batch, err
+}
+
+// GetUserBatches lists the batches of the user, the latest first, starting after the batch with the given id.
+func GetUserBatches(userId int, after string, limit int) (batches []*Batch, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if after != "" {
+		tx = tx.Where("id < (?)", DB.Model(&Batch{}).Select("id").Where("batch_id = ? AND user_id = ?", after, userId))
+	}
+	err = tx.Order("id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetUnfinishedBatches returns the batches waiting for the worker, the oldest first.
+func GetUnfinishedBatches(limit int) (batches []*Batch, err error) {
+	err = DB.Where("status IN ?", []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Order("id asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// CancelBatch asks the worker to stop the batch, it returns false when the batch is already finishing.
+func CancelBatch(batch *Batch) (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).
+		Where("id = ? AND status IN ?", batch.Id, []string{BatchStatusValidating, BatchStatusInProgress}).
+		Updates(map[string]any{"status": BatchStatusCancelling, "cancelling_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	batch.Status = BatchStatusCancelling
+	batch.CancellingAt = now
+	return true, nil
+}
+
+// GetBatchStatus returns the current status of the batch, the worker checks it for cancellation.
+func GetBatchStatus(id int) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Select("status").Where("id = ?", id).Row().Scan(&status)
+	return status, err
+}
@@ -0,0 +1,16 @@
+package model
+
+import "sync/atomic"
+
+// 模型列表、定价等只读数据的版本号。渠道或配置发生变化时递增，
+// 用于使这些接口的 HTTP 缓存失效。多节点部署时各节点在同步渠道和配置时自行递增。
+var catalogVersion atomic.Int64
+
+// InvalidateCatalogCache marks the cached models and pricing responses as stale.
+func InvalidateCatalogCache() {
+	catalogVersion.Add(1)
+}
+
+func GetCatalogVersion() int64 {
+	return catalogVersion.Load()
+}
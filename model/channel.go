@@ -48,6 +48,9 @@ type Channel struct {
 	ParamOverride     *string `json:"param_override" gorm:"type:text"`
 	HeaderOverride    *string `json:"header_override" gorm:"type:text"`
 	Remark            *string `json:"remark" gorm:"type:varchar(255)" validate:"max=255"`
+	Region            *string `json:"region" gorm:"type:varchar(64);default:''"`           // 渠道所在区域，用于就近路由
+	ComplianceTags    *string `json:"compliance_tags" gorm:"type:varchar(255);default:''"` // 合规属性，逗号分隔，如 eu-only,no-training,hipaa
+	OwnerUserId       int     `json:"owner_user_id" gorm:"index;default:0"`                // 用户自有渠道（BYOK）的所属用户，0 表示平台渠道
 	// add after v0.8.5
 	ChannelInfo ChannelInfo `json:"channel_info" gorm:"type:json"`
 
@@ -144,6 +147,26 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	if len(enabledIdx) == 0 {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	// 跳过限流冷却中的密钥，全部冷却时仍从启用的密钥中选择
+	usable := func(idx int) bool {
+		return getStatus(idx) == common.ChannelStatusEnabled
+	}
+	readyIdx := make([]int, 0, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		if _, cooling := GetChannelKeyCooldown(channel.Id, idx); !cooling {
+			readyIdx = append(readyIdx, idx)
+		}
+	}
+	if len(readyIdx) > 0 && len(readyIdx) < len(enabledIdx) {
+		ready := make(map[int]bool, len(readyIdx))
+		for _, idx := range readyIdx {
+			ready[idx] = true
+		}
+		enabledIdx = readyIdx
+		usable = func(idx int) bool {
+			return ready[idx]
+		}
+	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
@@ -175,7 +198,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if usable(idx) {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -242,6 +265,61 @@ func (channel *Channel) SetTag(tag string) {
 	channel.Tag = &tag
 }
 
+func (channel *Channel) GetRegion() string {
+	if channel.Region == nil {
+		return ""
+	}
+	return strings.TrimSpace(*channel.Region)
+}
+
+func (channel *Channel) GetComplianceTags() []string {
+	if channel.ComplianceTags == nil {
+		return []string{}
+	}
+	return ParseComplianceTags(*channel.ComplianceTags)
+}
+
+// HasComplianceTags reports whether the channel carries every required compliance tag.
+func (channel *Channel) HasComplianceTags(required []string) bool {
+	if len(required) == 0 {
+		return true
+	}
+	tags := channel.GetComplianceTags()
+	for _, r := range required {
+		found := false
+		for _, tag := range tags {
+			if tag == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseComplianceTags splits a comma separated tag list, normalizing case and dropping duplicates.
+func ParseComplianceTags(raw string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// IsPrivate reports whether the channel is a user's own channel (BYOK), which is only used by the owner's tokens.
+func (channel *Channel) IsPrivate() bool {
+	return channel.OwnerUserId != 0
+}
+
 func (channel *Channel) GetAutoBan() bool {
 	if channel.AutoBan == nil {
 		return false
@@ -369,12 +447,14 @@ func BatchInsertChannels(channels []Channel) error {
 		}
 	}()
 
-	for _, chunk := range lo.Chunk(channels, 50) {
+	for i, chunk := range lo.Chunk(channels, 50) {
 		if err := tx.Create(&chunk).Error; err != nil {
 			tx.Rollback()
 			return err
 		}
-		for _, channel_ := range chunk {
+		for j, channel_ := range chunk {
+			// lo.Chunk 会复制元素，把新渠道的 ID 写回调用方的切片
+			channels[i*50+j].Id = channel_.Id
 			if err := channel_.AddAbilities(tx); err != nil {
 				tx.Rollback()
 				return err
@@ -426,7 +506,7 @@ func (channel *Channel) GetBaseURL() string {
 	}
 	url := *channel.BaseURL
 	if url == "" {
-		url = constant.ChannelBaseURLs[channel.Type]
+		url = constant.GetChannelBaseURL(channel.Type)
 	}
 	return url
 }
@@ -636,6 +716,7 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 	}
 
 	shouldUpdateAbilities := false
+	saved := false
 	defer func() {
 		if shouldUpdateAbilities {
 			err := UpdateAbilityStatus(channelId, status == common.ChannelStatusEnabled)
@@ -643,6 +724,9 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 				common.SysLog(fmt.Sprintf("failed to update ability status: channel_id=%d, error=%v", channelId, err))
 			}
 		}
+		if saved {
+			common.PublishCoordinationEvent(common.CoordinationEventChannelStatus, channelStatusEvent{ChannelId: channelId, Status: status})
+		}
 	}()
 	channel, err := GetChannelById(channelId, true)
 	if err != nil {
@@ -675,10 +759,23 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			common.SysLog(fmt.Sprintf("failed to update channel status: channel_id=%d, status=%d, error=%v", channel.Id, status, err))
 			return false
 		}
+		saved = true
 	}
 	return true
 }
 
+// UpdateChannelWarmUpInfo records the result of the latest warm-up into the channel's other info.
+func UpdateChannelWarmUpInfo(channelId int, warmUp map[string]interface{}) error {
+	channel, err := GetChannelById(channelId, false)
+	if err != nil {
+		return err
+	}
+	info := channel.GetOtherInfo()
+	info["warm_up"] = warmUp
+	channel.SetOtherInfo(info)
+	return DB.Model(&Channel{}).Where("id = ?", channelId).Update("other_info", channel.OtherInfo).Error
+}
+
 func EnableChannelByTag(tag string) error {
 	err := DB.Model(&Channel{}).Where("tag = ?", tag).Update("status", common.ChannelStatusEnabled).Error
 	if err != nil {
@@ -971,6 +1068,13 @@ func CountAllTags() (int64, error) {
 	return total, err
 }
 
+// GetChannelTypes returns the distinct types of the configured channels
+func GetChannelTypes() ([]int, error) {
+	var types []int
+	err := DB.Model(&Channel{}).Distinct("type").Order("type").Pluck("type", &types).Error
+	return types, err
+}
+
 // Get channels of specified type with pagination
 func GetChannelsByType(startIdx int, num int, idSort bool, channelType int) ([]*Channel, error) {
 	var channels []*Channel
@@ -1006,3 +1110,10 @@ func CountChannelsGroupByType() (map[int64]int64, error) {
 	}
 	return counts, nil
 }
+
+// GetChannelsByName returns the channels with exactly the given name, used by the idempotent upsert API.
+func GetChannelsByName(name string) ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Where("name = ?", name).Order("id asc").Find(&channels).Error
+	return channels, err
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// 用户自有渠道（BYOK）：用户登记自己的上游密钥作为私有渠道，只供本人的令牌使用，不生成 ability，不进入全局路由。
+
+// GetUserChannels returns the private channels of the user without keys.
+func GetUserChannels(userId int) ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Omit("key").Where("owner_user_id = ?", userId).Order("id desc").Find(&channels).Error
+	return channels, err
+}
+
+// GetUserChannelById returns the private channel only when it belongs to the user.
+func GetUserChannelById(id int, userId int, selectAll bool) (*Channel, error) {
+	channel := &Channel{}
+	query := DB.Where("id = ? AND owner_user_id = ?", id, userId)
+	if !selectAll {
+		query = query.Omit("key")
+	}
+	err := query.First(channel).Error
+	if err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+func CountUserChannels(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&Channel{}).Where("owner_user_id = ?", userId).Count(&count).Error
+	return count, err
+}
+
+// GetUserChannelForModel returns an enabled private channel of the user serving the model, nil when there is none.
+// 多个渠道可用时与平台渠道一样按优先级和权重选择
+func GetUserChannelForModel(userId int, modelName string) (*Channel, error) {
+	if userId == 0 {
+		return nil, nil
+	}
+	var channels []*Channel
+	if common.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		for _, id := range owner2channels[userId] {
+			if channel, ok := channelsIDM[id]; ok {
+				channels = append(channels, channel)
+			}
+		}
+		channelSyncLock.RUnlock()
+	} else {
+		err := DB.Where("owner_user_id = ? AND status = ?", userId, common.ChannelStatusEnabled).Find(&channels).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	normalizedModel := ratio_setting.FormatMatchingModelName(modelName)
+	candidates := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		models := channel.GetModels()
+		if slices.Contains(models, modelName) || slices.Contains(models, normalizedModel) {
+			candidates = append(candidates, channel)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	return selectChannelByPriority(candidates, 0)
+}
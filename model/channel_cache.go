@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -16,12 +17,19 @@ import (
 
 var group2model2channels map[string]map[string][]int // enabled channel
 var channelsIDM map[int]*Channel                     // all channels include disabled
+var owner2channels map[int][]int                     // enabled private channels by owner user id
 var channelSyncLock sync.RWMutex
 
+// InitChannelCache reloads the channel cache from the database and tells the other nodes to reload theirs.
 func InitChannelCache() {
 	if !common.MemoryCacheEnabled {
 		return
 	}
+	loadChannelCache()
+	common.PublishCoordinationEvent(common.CoordinationEventChannelsChange, nil)
+}
+
+func loadChannelCache() {
 	newChannelId2channel := make(map[int]*Channel)
 	var channels []*Channel
 	DB.Find(&channels)
@@ -35,6 +43,7 @@ func InitChannelCache() {
 		groups[ability.Group] = true
 	}
 	newGroup2model2channels := make(map[string]map[string][]int)
+	newOwner2channels := make(map[int][]int)
 	for group := range groups {
 		newGroup2model2channels[group] = make(map[string][]int)
 	}
@@ -42,6 +51,11 @@ func InitChannelCache() {
 		if channel.Status != common.ChannelStatusEnabled {
 			continue // skip disabled channels
 		}
+		if channel.IsPrivate() {
+			// 用户自有渠道不参与全局路由
+			newOwner2channels[channel.OwnerUserId] = append(newOwner2channels[channel.OwnerUserId], channel.Id)
+			continue
+		}
 		groups := strings.Split(channel.Group, ",")
 		for _, group := range groups {
 			models := strings.Split(channel.Models, ",")
@@ -65,7 +79,11 @@ func InitChannelCache() {
 	}
 
 	channelSyncLock.Lock()
+	if !reflect.DeepEqual(group2model2channels, newGroup2model2channels) {
+		InvalidateCatalogCache()
+	}
 	group2model2channels = newGroup2model2channels
+	owner2channels = newOwner2channels
 	//channelsIDM = newChannelId2channel
 	for i, channel := range newChannelId2channel {
 		if channel.ChannelInfo.IsMultiKey {
@@ -89,19 +107,56 @@ func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
 		common.SysLog("syncing channels from database")
-		InitChannelCache()
+		loadChannelCache()
 	}
 }
 
+// ChannelFilter reports whether a channel may be selected for the current request.
+// A nil filter accepts every channel.
+type ChannelFilter func(channel *Channel) bool
+
 func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+	return GetRandomSatisfiedChannelWithFilter(group, model, retry, nil)
+}
+
+// GetRandomSatisfiedChannelWithFilter works like GetRandomSatisfiedChannel, but only channels
+// accepted by filter take part in the priority and weight calculation.
+func GetRandomSatisfiedChannelWithFilter(group string, model string, retry int, filter ChannelFilter) (*Channel, error) {
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
+		if filter != nil {
+			return getFilteredChannel(group, model, retry, filter)
+		}
 		return GetChannel(group, model, retry)
 	}
 
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
 
+	candidates, err := getCachedChannels(group, model, filter)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	channel, err := selectChannelByPriority(candidates, retry)
+	if err != nil {
+		return nil, fmt.Errorf("%w, group: %s, model: %s", err, group, model)
+	}
+	return channel, nil
+}
+
+// GetSatisfiedChannels returns all enabled channels of the group serving the model and accepted by filter,
+// for routing strategies that rank the candidates themselves instead of using priority and weight.
+func GetSatisfiedChannels(group string, model string, filter ChannelFilter) ([]*Channel, error) {
+	if !common.MemoryCacheEnabled {
+		return getAbilityChannels(group, model, filter)
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	return getCachedChannels(group, model, filter)
+}
+
+// getCachedChannels must be called with channelSyncLock held.
+func getCachedChannels(group string, model string, filter ChannelFilter) ([]*Channel, error) {
 	// First, try to find channels with the exact model name.
 	channels := group2model2channels[group][model]
 
@@ -111,24 +166,30 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		channels = group2model2channels[group][normalizedModel]
 	}
 
-	if len(channels) == 0 {
-		return nil, nil
+	candidates := make([]*Channel, 0, len(channels))
+	for _, channelId := range channels {
+		channel, ok := channelsIDM[channelId]
+		if !ok {
+			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+		}
+		if filter != nil && !filter(channel) {
+			continue
+		}
+		candidates = append(candidates, channel)
 	}
+	return candidates, nil
+}
 
+// selectChannelByPriority picks the priority level matching retry and then
+// chooses a channel in that level randomly according to its weight.
+func selectChannelByPriority(channels []*Channel, retry int) (*Channel, error) {
 	if len(channels) == 1 {
-		if channel, ok := channelsIDM[channels[0]]; ok {
-			return channel, nil
-		}
-		return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channels[0])
+		return channels[0], nil
 	}
 
 	uniquePriorities := make(map[int]bool)
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			uniquePriorities[int(channel.GetPriority())] = true
-		} else {
-			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
-		}
+	for _, channel := range channels {
+		uniquePriorities[int(channel.GetPriority())] = true
 	}
 	var sortedUniquePriorities []int
 	for priority := range uniquePriorities {
@@ -144,19 +205,15 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	// get the priority for the given retry number
 	var sumWeight = 0
 	var targetChannels []*Channel
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
-				targetChannels = append(targetChannels, channel)
-			}
-		} else {
-			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+	for _, channel := range channels {
+		if channel.GetPriority() == targetPriority {
+			sumWeight += channel.GetWeight()
+			targetChannels = append(targetChannels, channel)
 		}
 	}
 
 	if len(targetChannels) == 0 {
-		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
+		return nil, errors.New(fmt.Sprintf("no channel found, priority: %d", targetPriority))
 	}
 
 	// smoothing factor and adjustment
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 渠道/密钥的限流冷却：上游返回 429 并给出额度重置时间时，在重置前不再向该密钥发送请求。冷却状态按节点保存，
+// 启用 Redis 时通过多节点协调同步到其他节点。
+
+type channelKeyCooldown struct {
+	channelId int
+	keyIndex  int
+}
+
+var (
+	channelCooldownLock sync.Mutex
+	// channelKeyCooldowns 密钥冷却结束时间
+	channelKeyCooldowns = make(map[channelKeyCooldown]time.Time)
+	// channelCooldowns 整个渠道（单密钥渠道，或多密钥渠道的所有密钥）冷却结束时间
+	channelCooldowns = make(map[int]time.Time)
+)
+
+// SetChannelKeyCooldown keeps the key of the channel out of rotation until the given time. The whole channel cools
+// down when it has a single key, or when every enabled key of a multi-key channel is cooling down.
+func SetChannelKeyCooldown(channel *Channel, keyIndex int, until time.Time) {
+	if !until.After(time.Now()) {
+		return
+	}
+	setChannelKeyCooldown(channel, keyIndex, until)
+	common.PublishCoordinationEvent(common.CoordinationEventChannelCooling, channelCooldownEvent{
+		ChannelId: channel.Id,
+		KeyIndex:  keyIndex,
+		Until:     until.Unix(),
+	})
+}
+
+func setChannelKeyCooldown(channel *Channel, keyIndex int, until time.Time) {
+	now := time.Now()
+	if !until.After(now) {
+		return
+	}
+	channelCooldownLock.Lock()
+	defer channelCooldownLock.Unlock()
+	if !channel.ChannelInfo.IsMultiKey {
+		channelCooldowns[channel.Id] = maxTime(channelCooldowns[channel.Id], until)
+		return
+	}
+	key := channelKeyCooldown{channelId: channel.Id, keyIndex: keyIndex}
+	channelKeyCooldowns[key] = maxTime(channelKeyCooldowns[key], until)
+
+	// 所有启用的密钥都在冷却时，整个渠道冷却到最早恢复的密钥
+	var earliest time.Time
+	for i := range channel.GetKeys() {
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[i]; ok && status != common.ChannelStatusEnabled {
+			continue
+		}
+		keyUntil := channelKeyCooldowns[channelKeyCooldown{channelId: channel.Id, keyIndex: i}]
+		if !keyUntil.After(now) {
+			return
+		}
+		if earliest.IsZero() || keyUntil.Before(earliest) {
+			earliest = keyUntil
+		}
+	}
+	if !earliest.IsZero() {
+		channelCooldowns[channel.Id] = earliest
+	}
+}
+
+// GetChannelKeyCooldown returns when the key of the channel can be used again, false when it is not cooling down.
+func GetChannelKeyCooldown(channelId int, keyIndex int) (time.Time, bool) {
+	now := time.Now()
+	channelCooldownLock.Lock()
+	defer channelCooldownLock.Unlock()
+	if until, ok := channelCooldowns[channelId]; ok {
+		if until.After(now) {
+			return until, true
+		}
+		delete(channelCooldowns, channelId)
+	}
+	key := channelKeyCooldown{channelId: channelId, keyIndex: keyIndex}
+	if until, ok := channelKeyCooldowns[key]; ok {
+		if until.After(now) {
+			return until, true
+		}
+		delete(channelKeyCooldowns, key)
+	}
+	return time.Time{}, false
+}
+
+// GetCoolingDownChannels returns the channels whose keys are all cooling down, avoided when selecting channels.
+func GetCoolingDownChannels() map[int]bool {
+	now := time.Now()
+	channelCooldownLock.Lock()
+	defer channelCooldownLock.Unlock()
+	var cooling map[int]bool
+	for channelId, until := range channelCooldowns {
+		if !until.After(now) {
+			delete(channelCooldowns, channelId)
+			continue
+		}
+		if cooling == nil {
+			cooling = make(map[int]bool)
+		}
+		cooling[channelId] = true
+	}
+	return cooling
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
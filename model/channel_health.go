@@ -0,0 +1,46 @@
+package model
+
+// ChannelHealth 渠道健康检查的最近结果，每个渠道一行
+type ChannelHealth struct {
+	ChannelId int `json:"channel_id" gorm:"primaryKey;autoIncrement:false"`
+	// Unhealthy 使用零值表示健康，新渠道没有记录时视为健康
+	Unhealthy            bool   `json:"unhealthy" gorm:"index"`
+	ConsecutiveFailures  int    `json:"consecutive_failures"`
+	ConsecutiveSuccesses int    `json:"consecutive_successes"`
+	LastSuccess          bool   `json:"last_success"`
+	LastLatencyMs        int64  `json:"last_latency_ms" gorm:"bigint"`
+	LastError            string `json:"last_error" gorm:"type:text"`
+	LastCheckedAt        int64  `json:"last_checked_at" gorm:"bigint"`
+	TotalChecks          int64  `json:"total_checks" gorm:"bigint;default:0"`
+	TotalFailures        int64  `json:"total_failures" gorm:"bigint;default:0"`
+}
+
+// GetChannelHealth returns the health record of the channel, a healthy empty record when it was never checked.
+func GetChannelHealth(channelId int) (*ChannelHealth, error) {
+	var health ChannelHealth
+	err := DB.Where("channel_id = ?", channelId).Limit(1).Find(&health).Error
+	if err != nil {
+		return nil, err
+	}
+	health.ChannelId = channelId
+	return &health, nil
+}
+
+func GetAllChannelHealth() (healths []*ChannelHealth, err error) {
+	err = DB.Order("channel_id asc").Find(&healths).Error
+	return healths, err
+}
+
+func SaveChannelHealth(health *ChannelHealth) error {
+	return DB.Save(health).Error
+}
+
+// GetUnhealthyChannelIds returns the channels currently marked unhealthy.
+func GetUnhealthyChannelIds() (channelIds []int, err error) {
+	err = DB.Model(&ChannelHealth{}).Where("unhealthy = ?", true).Pluck("channel_id", &channelIds).Error
+	return channelIds, err
+}
+
+func DeleteChannelHealth(channelId int) error {
+	return DB.Where("channel_id = ?", channelId).Delete(&ChannelHealth{}).Error
+}
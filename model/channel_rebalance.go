@@ -0,0 +1,133 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ChannelRebalanceStatusPending  = "pending"
+	ChannelRebalanceStatusApplied  = "applied"
+	ChannelRebalanceStatusRejected = "rejected"
+	// ChannelRebalanceStatusSuperseded 未审批的建议被下一次调整替代
+	ChannelRebalanceStatusSuperseded = "superseded"
+)
+
+// ChannelRebalanceAdjustment 自动调整渠道权重的记录，保存调整依据的统计数据。
+// 人工审批模式下先以 pending 状态保存，审批通过后才修改渠道权重。
+type ChannelRebalanceAdjustment struct {
+	Id           int     `json:"id"`
+	ChannelId    int     `json:"channel_id" gorm:"index"`
+	ChannelName  string  `json:"channel_name" gorm:"size:128"`
+	OldWeight    int     `json:"old_weight"`
+	NewWeight    int     `json:"new_weight"`
+	RequestCount int64   `json:"request_count" gorm:"bigint"`
+	ErrorRate    float64 `json:"error_rate"`
+	// AvgLatency 平均耗时，单位秒
+	AvgLatency float64 `json:"avg_latency"`
+	CostRatio  float64 `json:"cost_ratio"`
+	// Score 相对于参与调整的渠道平均水平的评分，越低越好，1 表示平均水平
+	Score       float64 `json:"score"`
+	Status      string  `json:"status" gorm:"size:16;index"`
+	CreatedTime int64   `json:"created_time" gorm:"bigint;index"`
+	DecidedTime int64   `json:"decided_time" gorm:"bigint"`
+	// DecidedBy 审批的管理员，自动生效时为 0
+	DecidedBy int `json:"decided_by"`
+}
+
+// SaveChannelRebalanceAdjustments records the adjustments of a run. The pending adjustments left from earlier runs
+// for the same channels are superseded, and when apply is set the new weights take effect at once.
+func SaveChannelRebalanceAdjustments(adjustments []*ChannelRebalanceAdjustment, apply bool) error {
+	if len(adjustments) == 0 {
+		return nil
+	}
+	now := common.GetTimestamp()
+	channelIds := make([]int, 0, len(adjustments))
+	for _, adjustment := range adjustments {
+		channelIds = append(channelIds, adjustment.ChannelId)
+		adjustment.CreatedTime = now
+		adjustment.Status = ChannelRebalanceStatusPending
+		if apply {
+			adjustment.Status = ChannelRebalanceStatusApplied
+			adjustment.DecidedTime = now
+		}
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&ChannelRebalanceAdjustment{}).
+			Where("channel_id IN ? AND status = ?", channelIds, ChannelRebalanceStatusPending).
+			Updates(map[string]interface{}{"status": ChannelRebalanceStatusSuperseded, "decided_time": now}).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Create(&adjustments).Error; err != nil {
+			return err
+		}
+		if !apply {
+			return nil
+		}
+		for _, adjustment := range adjustments {
+			if err = updateChannelWeight(tx, adjustment.ChannelId, adjustment.NewWeight); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// updateChannelWeight sets the weight of the channel and of its abilities, which are used to select channels.
+func updateChannelWeight(tx *gorm.DB, channelId int, weight int) error {
+	if err := tx.Model(&Channel{}).Where("id = ?", channelId).Update("weight", weight).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Ability{}).Where("channel_id = ?", channelId).Update("weight", weight).Error
+}
+
+func GetChannelRebalanceAdjustments(status string, startIdx int, num int) (adjustments []*ChannelRebalanceAdjustment, total int64, err error) {
+	query := DB.Model(&ChannelRebalanceAdjustment{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&adjustments).Error
+	return adjustments, total, err
+}
+
+// DecideChannelRebalanceAdjustment approves or rejects a pending adjustment. An approved adjustment is refused
+// when the weight of the channel was changed after it was proposed.
+func DecideChannelRebalanceAdjustment(id int, approve bool, userId int) (*ChannelRebalanceAdjustment, error) {
+	var adjustment ChannelRebalanceAdjustment
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&adjustment, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if adjustment.Status != ChannelRebalanceStatusPending {
+			return errors.New("该调整已处理")
+		}
+		adjustment.Status = ChannelRebalanceStatusRejected
+		if approve {
+			var channel Channel
+			if err := tx.Select("id", "weight").First(&channel, "id = ?", adjustment.ChannelId).Error; err != nil {
+				return err
+			}
+			if channel.GetWeight() != adjustment.OldWeight {
+				return errors.New("渠道权重已被修改，请等待下一次调整")
+			}
+			if err := updateChannelWeight(tx, adjustment.ChannelId, adjustment.NewWeight); err != nil {
+				return err
+			}
+			adjustment.Status = ChannelRebalanceStatusApplied
+		}
+		adjustment.DecidedTime = common.GetTimestamp()
+		adjustment.DecidedBy = userId
+		return tx.Model(&adjustment).Select("status", "decided_time", "decided_by").Updates(&adjustment).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &adjustment, nil
+}
@@ -0,0 +1,27 @@
+package model
+
+import "gorm.io/gorm"
+
+// ForEachChannelConsumeLog walks the consume logs of the period in batches, channelId 0 means all channels.
+// Only the columns needed by channel statements are loaded.
+func ForEachChannelConsumeLog(startTimestamp int64, endTimestamp int64, channelId int, fn func(logs []*Log) error) error {
+	tx := LOG_DB.Table("logs").
+		Select("id, channel_id, model_name, quota, prompt_tokens, completion_tokens, other").
+		Where("type = ? AND channel_id <> 0", LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if channelId != 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if demoUserId := GetDemoSandboxUserId(); demoUserId != 0 {
+		tx = tx.Where("user_id <> ?", demoUserId)
+	}
+	var batch []*Log
+	return tx.FindInBatches(&batch, 1000, func(_ *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
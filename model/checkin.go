@@ -105,8 +105,7 @@ func userCheckinWithTransaction(checkin *Checkin, userId int, quotaAwarded int)
 			Update("quota", gorm.Expr("quota + ?", quotaAwarded)).Error; err != nil {
 			return errors.New("签到失败：更新额度出错")
 		}
-
-		return nil
+		return insertQuotaLedger(tx, userQuotaLedger(userId, QuotaLedgerKindGrant, quotaAwarded, "签到奖励"))
 	})
 
 	if err != nil {
@@ -131,7 +130,7 @@ func userCheckinWithoutTransaction(checkin *Checkin, userId int, quotaAwarded in
 
 	// 步骤2: 增加用户额度
 	// 使用 db=true 强制直接写入数据库，不使用批量更新
-	if err := IncreaseUserQuota(userId, quotaAwarded, true); err != nil {
+	if err := GrantUserQuota(userId, quotaAwarded, QuotaLedgerKindGrant, "签到奖励"); err != nil {
 		// 如果增加额度失败，需要回滚签到记录
 		DB.Delete(checkin)
 		return nil, errors.New("签到失败：更新额度出错")
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+type channelStatusEvent struct {
+	ChannelId int `json:"channel_id"`
+	Status    int `json:"status"`
+}
+
+type channelCooldownEvent struct {
+	ChannelId int   `json:"channel_id"`
+	KeyIndex  int   `json:"key_index"`
+	Until     int64 `json:"until"`
+}
+
+// channelCacheReloadPending 合并短时间内的多次渠道变更，只重新加载一次
+var channelCacheReloadPending atomic.Bool
+
+// StartCoordination applies the channel and option changes published by the other nodes to the local caches,
+// so that a cluster sharing a Redis behaves like a single instance without waiting for the periodic sync.
+// Rate limit and quota counters already live in Redis and need no coordination.
+func StartCoordination() {
+	if !common.RedisEnabled {
+		return
+	}
+	common.RegisterCoordinationHandler(common.CoordinationEventOptionChanged, func(payload []byte) {
+		var key string
+		if err := common.Unmarshal(payload, &key); err != nil || key == "" {
+			return
+		}
+		option := Option{}
+		if err := DB.Where(commonKeyCol+" = ?", key).First(&option).Error; err != nil {
+			return
+		}
+		if err := updateOptionMap(option.Key, option.Value); err != nil {
+			common.SysLog("failed to update option map: " + err.Error())
+		}
+	})
+	common.RegisterCoordinationHandler(common.CoordinationEventChannelsChange, func(payload []byte) {
+		scheduleChannelCacheReload()
+	})
+	common.RegisterCoordinationHandler(common.CoordinationEventChannelStatus, func(payload []byte) {
+		var event channelStatusEvent
+		if err := common.Unmarshal(payload, &event); err != nil {
+			return
+		}
+		channel, err := CacheGetChannel(event.ChannelId)
+		if err != nil || channel.ChannelInfo.IsMultiKey {
+			// 多密钥渠道的密钥状态保存在渠道信息中，重新加载整个渠道
+			scheduleChannelCacheReload()
+			return
+		}
+		CacheUpdateChannelStatus(event.ChannelId, event.Status)
+	})
+	common.RegisterCoordinationHandler(common.CoordinationEventChannelCooling, func(payload []byte) {
+		var event channelCooldownEvent
+		if err := common.Unmarshal(payload, &event); err != nil {
+			return
+		}
+		channel, err := CacheGetChannel(event.ChannelId)
+		if err != nil {
+			return
+		}
+		setChannelKeyCooldown(channel, event.KeyIndex, time.Unix(event.Until, 0))
+	})
+	common.StartCoordinationSubscriber()
+}
+
+func scheduleChannelCacheReload() {
+	if !common.MemoryCacheEnabled || !channelCacheReloadPending.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		time.Sleep(time.Second)
+		channelCacheReloadPending.Store(false)
+		loadChannelCache()
+	}()
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DormancySubjectToken = "token"
+	DormancySubjectUser  = "user"
+)
+
+// DormancyNotice 已提醒即将因长期未使用被处理的令牌或用户。ActiveAt 为提醒时的最近使用时间，
+// 之后再次使用时提醒作废，再次进入提醒期时重新提醒
+type DormancyNotice struct {
+	Subject    string `json:"subject" gorm:"primaryKey;type:varchar(64)"`
+	ActiveAt   int64  `json:"active_at" gorm:"bigint"`
+	NotifiedAt int64  `json:"notified_at" gorm:"bigint"`
+}
+
+func DormancySubject(kind string, id int) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// GetDormancyNotices returns the notices of the subjects keyed by subject.
+func GetDormancyNotices(subjects []string) (map[string]*DormancyNotice, error) {
+	notices := make(map[string]*DormancyNotice, len(subjects))
+	if len(subjects) == 0 {
+		return notices, nil
+	}
+	var rows []*DormancyNotice
+	if err := DB.Where("subject IN ?", subjects).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		notices[row.Subject] = row
+	}
+	return notices, nil
+}
+
+func SaveDormancyNotice(notice *DormancyNotice) error {
+	return DB.Save(notice).Error
+}
+
+func DeleteDormancyNotice(subject string) error {
+	return DB.Where("subject = ?", subject).Delete(&DormancyNotice{}).Error
+}
+
+// GetInactiveTokens lists the enabled tokens neither used nor created since before, in id order after afterId.
+func GetInactiveTokens(before int64, afterId int, limit int) (tokens []*Token, err error) {
+	err = DB.Where("id > ? AND status = ? AND accessed_time < ? AND created_time < ?",
+		afterId, common.TokenStatusEnabled, before, before).
+		Order("id asc").Limit(limit).Find(&tokens).Error
+	return tokens, err
+}
+
+// DisableInactiveToken disables the token unless it was used after it was loaded, it returns whether it was disabled.
+func DisableInactiveToken(token *Token) (bool, error) {
+	result := DB.Model(&Token{}).
+		Where("id = ? AND status = ? AND accessed_time = ?", token.Id, common.TokenStatusEnabled, token.AccessedTime).
+		Update("status", common.TokenStatusDisabled)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	if common.RedisEnabled {
+		_ = cacheDeleteToken(token.Key)
+	}
+	return true, nil
+}
+
+// GetInactiveUsers lists the enabled common users whose recorded activity is before before, in id order after afterId.
+func GetInactiveUsers(before int64, afterId int, limit int) (users []*User, err error) {
+	err = DB.Omit("password").
+		Where("id > ? AND status = ? AND role < ? AND last_active_at < ?",
+			afterId, common.UserStatusEnabled, common.RoleAdminUser, before).
+		Order("id asc").Limit(limit).Find(&users).Error
+	return users, err
+}
+
+// GetUserLatestActivity returns the latest time the user called the API or topped up, 0 when never.
+func GetUserLatestActivity(userId int) (int64, error) {
+	var tokenAccessedAt, loggedAt int64
+	err := DB.Model(&Token{}).Where("user_id = ?", userId).
+		Select("COALESCE(MAX(accessed_time), 0)").Scan(&tokenAccessedAt).Error
+	if err != nil {
+		return 0, err
+	}
+	err = LOG_DB.Model(&Log{}).Where("user_id = ? AND type IN ?", userId, []int{LogTypeConsume, LogTypeTopup}).
+		Select("COALESCE(MAX(created_at), 0)").Scan(&loggedAt).Error
+	if err != nil {
+		return 0, err
+	}
+	return max(tokenAccessedAt, loggedAt), nil
+}
+
+// TouchUserActivity moves the last activity of the user forward to activeAt, activity after the user was flagged
+// as dormant clears the flag.
+func TouchUserActivity(userId int, activeAt int64) error {
+	return DB.Model(&User{}).Where("id = ? AND last_active_at < ?", userId, activeAt).Updates(map[string]interface{}{
+		"last_active_at": activeAt,
+		"dormant_at":     gorm.Expr("CASE WHEN dormant_at < ? THEN 0 ELSE dormant_at END", activeAt),
+	}).Error
+}
+
+// MarkUserDormant flags the user as dormant, or disables the user as well when disable is set. Nothing changes
+// when the user became active after lastActiveAt was read, it returns whether the user was changed.
+func MarkUserDormant(userId int, lastActiveAt int64, disable bool) (bool, error) {
+	updates := map[string]interface{}{
+		"dormant_at": common.GetTimestamp(),
+	}
+	if disable {
+		updates["status"] = common.UserStatusDisabled
+	}
+	result := DB.Model(&User{}).
+		Where("id = ? AND status = ? AND last_active_at = ?", userId, common.UserStatusEnabled, lastActiveAt).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	if disable {
+		_ = updateUserStatusCache(userId, false)
+	}
+	return true, nil
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+// File 通过 /v1/files 上传或由批量任务生成的文件，内容保存在对象存储的 StorageKey 中。
+// ExpiresAt 为 0 表示一直保存，过期的文件不再可见，由清理任务删除。
+type File struct {
+	Id         int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	FileId     string `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId     int    `json:"-" gorm:"index"`
+	Purpose    string `json:"purpose" gorm:"type:varchar(32)"`
+	Filename   string `json:"filename" gorm:"type:varchar(255)"`
+	Bytes      int64  `json:"bytes" gorm:"bigint"`
+	StorageKey string `json:"-" gorm:"type:varchar(255)"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt  int64  `json:"expires_at" gorm:"bigint;index;default:0"`
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+// notExpired keeps the files that never expire or have not expired yet.
+func notExpired(tx *gorm.DB) *gorm.DB {
+	return tx.Where("expires_at = 0 OR expires_at > ?", common.GetTimestamp())
+}
+
+// GetUserFile returns the file of the user, gorm.ErrRecordNotFound is returned when it does not belong to the user
+// or has expired.
+func GetUserFile(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var file File
+	err := notExpired(DB.Where("file_id = ? AND user_id = ?", fileId, userId)).First(&file).Error
+	return &file, err
+}
+
+// GetUserFiles lists the files of the user starting after the file with the given id, filtered by purpose when it
+// is not empty. ascending orders them by creation time, the latest come first otherwise.
+func GetUserFiles(userId int, purpose string, after string, ascending bool, limit int) (files []*File, err error) {
+	tx := notExpired(DB.Where("user_id = ?", userId))
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	order := "id desc"
+	if ascending {
+		order = "id asc"
+	}
+	if after != "" {
+		cursor := DB.Model(&File{}).Select("id").Where("file_id = ? AND user_id = ?", after, userId)
+		if ascending {
+			tx = tx.Where("id > (?)", cursor)
+		} else {
+			tx = tx.Where("id < (?)", cursor)
+		}
+	}
+	err = tx.Order(order).Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// GetUserFileBytes returns the total size of the files the user keeps, expired files not cleaned up yet included.
+func GetUserFileBytes(userId int) (int64, error) {
+	var total int64
+	err := DB.Model(&File{}).Where("user_id = ?", userId).Select("COALESCE(SUM(bytes), 0)").Row().Scan(&total)
+	return total, err
+}
+
+// GetExpiredFiles returns the files past their expiry, the cleanup task deletes them.
+func GetExpiredFiles(limit int) (files []*File, err error) {
+	err = DB.Where("expires_at <> 0 AND expires_at <= ?", common.GetTimestamp()).Order("id asc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func DeleteFileById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	return DB.Delete(&File{}, id).Error
+}
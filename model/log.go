@@ -48,6 +48,8 @@ type Log struct {
 	Quota            int        `json:"quota" gorm:"default:0"`
 	PromptTokens     int        `json:"prompt_tokens" gorm:"default:0"`
 	CompletionTokens int        `json:"completion_tokens" gorm:"default:0"`
+	CacheTokens      int        `json:"cache_tokens" gorm:"default:0"`       // 命中提示缓存的输入 token
+	CacheWriteTokens int        `json:"cache_write_tokens" gorm:"default:0"` // 写入提示缓存的输入 token
 	UseTime          int        `json:"use_time" gorm:"default:0"`
 	IsStream         bool       `json:"is_stream"`
 	ChannelId        int        `json:"channel" gorm:"index"`
@@ -56,6 +58,10 @@ type Log struct {
 	Group            string     `json:"group" gorm:"index"`
 	Ip               string     `json:"ip" gorm:"index;default:''"`
 	Other            string     `json:"other"`
+	SessionId        string     `json:"session_id" gorm:"type:varchar(128);index;default:''"` // 客户端传递的会话 ID
+	RequestId        string     `json:"request_id" gorm:"type:varchar(64);index;default:''"`
+	PrevHash         string     `json:"prev_hash,omitempty" gorm:"type:varchar(64);default:''"`
+	Hash             string     `json:"hash,omitempty" gorm:"type:varchar(64);default:''"`
 	Detail           *LogDetail `json:"detail,omitempty" gorm:"-"`
 }
 
@@ -63,6 +69,10 @@ type LogDetail struct {
 	LogId        int       `json:"log_id" gorm:"primaryKey"`
 	RequestBody  LargeText `json:"request_body"`
 	ResponseBody LargeText `json:"response_body"`
+	Redacted     bool      `json:"redacted" gorm:"default:false"`                             // 内容经过脱敏
+	StorageKey   string    `json:"storage_key,omitempty" gorm:"type:varchar(255);default:''"` // 完整内容在对象存储中的键，为空表示只保存在数据库
+	Attempts     string    `json:"attempts,omitempty" gorm:"type:text"`                       // 上游尝试记录（RelayAttempt 的 JSON 数组）
+	Moderation   string    `json:"moderation,omitempty" gorm:"type:text"`                     // 内容审核结论（ModerationVerdict 的 JSON）
 	CreatedAt    int64     `json:"created_at" gorm:"bigint;index;autoCreateTime"`
 }
 
@@ -70,6 +80,27 @@ func (LogDetail) TableName() string {
 	return "log_details"
 }
 
+// ModerationVerdict 转发前内容审核的结论
+type ModerationVerdict struct {
+	Backend    string   `json:"backend"`
+	Flagged    bool     `json:"flagged"`
+	Blocked    bool     `json:"blocked"`
+	Categories []string `json:"categories,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+// RelayAttempt 一次上游尝试，Retry 为在同一渠道上的重试序号
+type RelayAttempt struct {
+	ChannelId  int    `json:"channel_id"`
+	Retry      int    `json:"retry,omitempty"`
+	StartedAt  int64  `json:"started_at"`
+	DurationMs int64  `json:"duration_ms"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
 // don't use iota, avoid change log type value
 const (
 	LogTypeUnknown = 0
@@ -79,6 +110,8 @@ const (
 	LogTypeSystem  = 4
 	LogTypeError   = 5
 	LogTypeRefund  = 6
+	// LogTypeAdjustment 管理员手动调整额度
+	LogTypeAdjustment = 7
 )
 
 func formatUserLogs(logs []*Log) {
@@ -157,20 +190,25 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 			}
 			return c.ClientIP()
 		}(),
-		Other: otherStr,
+		Other:     otherStr,
+		SessionId: common.GetContextKeyString(c, constant.ContextKeySessionId),
+		RequestId: c.GetString(common.RequestIdKey),
 	}
 	err := LOG_DB.Create(log).Error
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
 	}
+	appendRecordedLogId(c, log.Id)
 	reqPreview, respPreview := resolveLogPayloads(c, "", "")
-	persistLogDetail(c, log.Id, reqPreview, respPreview)
+	persistLogDetail(c, log.Id, reqPreview, respPreview, true)
 }
 
 type RecordConsumeLogParams struct {
 	ChannelId           int                    `json:"channel_id"`
 	PromptTokens        int                    `json:"prompt_tokens"`
 	CompletionTokens    int                    `json:"completion_tokens"`
+	CacheTokens         int                    `json:"cache_tokens"`
+	CacheWriteTokens    int                    `json:"cache_write_tokens"`
 	ModelName           string                 `json:"model_name"`
 	TokenName           string                 `json:"token_name"`
 	Quota               int                    `json:"quota"`
@@ -190,6 +228,39 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 	}
 	logger.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, params=%s", userId, common.GetJsonString(params)))
 	username := c.GetString("username")
+	isDemo := c != nil && common.GetContextKeyBool(c, constant.ContextKeyDemoRequest)
+	if isDemo {
+		if params.Other == nil {
+			params.Other = make(map[string]interface{})
+		}
+		params.Other["demo"] = true
+	}
+	// 重放请求的日志记录原日志 ID 和本应扣除的额度，额度记为 0，不计入账单和数据看板
+	replayOf := 0
+	if c != nil {
+		replayOf = common.GetContextKeyInt(c, constant.ContextKeyReplayOf)
+	}
+	if replayOf != 0 {
+		if params.Other == nil {
+			params.Other = make(map[string]interface{})
+		}
+		params.Other["replay_of"] = replayOf
+		params.Other["replay_quota"] = params.Quota
+		params.Quota = 0
+	}
+	// 影子请求同样记录原请求日志 ID 和本应扣除的额度
+	mirrorOf := 0
+	if c != nil {
+		mirrorOf = common.GetContextKeyInt(c, constant.ContextKeyMirrorOf)
+	}
+	if mirrorOf != 0 {
+		if params.Other == nil {
+			params.Other = make(map[string]interface{})
+		}
+		params.Other["mirror_of"] = mirrorOf
+		params.Other["mirror_quota"] = params.Quota
+		params.Quota = 0
+	}
 	otherStr := common.MapToJsonStr(params.Other)
 	log := &Log{
 		UserId:           userId,
@@ -199,6 +270,8 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		Content:          params.Content,
 		PromptTokens:     params.PromptTokens,
 		CompletionTokens: params.CompletionTokens,
+		CacheTokens:      params.CacheTokens,
+		CacheWriteTokens: params.CacheWriteTokens,
 		TokenName:        params.TokenName,
 		ModelName:        params.ModelName,
 		Quota:            params.Quota,
@@ -213,15 +286,24 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 			}
 			return c.ClientIP()
 		}(),
-		Other: otherStr,
+		Other:     otherStr,
+		SessionId: common.GetContextKeyString(c, constant.ContextKeySessionId),
+		RequestId: c.GetString(common.RequestIdKey),
+	}
+	var err error
+	if common.LogHashChainEnabled {
+		err = createChainedLog(log)
+	} else {
+		err = LOG_DB.Create(log).Error
 	}
-	err := LOG_DB.Create(log).Error
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
 	}
+	appendRecordedLogId(c, log.Id)
 	requestPreview, responsePreview := resolveLogPayloads(c, params.RequestBodyPreview, params.ResponseBodyPreview)
-	persistLogDetail(c, log.Id, requestPreview, responsePreview)
-	if common.DataExportEnabled {
+	persistLogDetail(c, log.Id, requestPreview, responsePreview, false)
+	// 演示、重放和影子请求不计入数据看板
+	if common.DataExportEnabled && !isDemo && replayOf == 0 && mirrorOf == 0 {
 		gopool.Go(func() {
 			LogQuotaData(userId, username, params.ModelName, params.Quota, common.GetTimestamp(), params.PromptTokens+params.CompletionTokens)
 		})
@@ -266,7 +348,7 @@ func resolveLogPayloads(c *gin.Context, requestPreview string, responsePreview s
 	if request == "" {
 		full := common.GetFullPayloadString(c, constant.ContextKeyLoggedRequestBodyFull)
 		if full != "" {
-			request = full
+			request = common.ApplyLogPayloadLimit(c, full)
 		} else {
 			request = common.GetContextKeyString(c, constant.ContextKeyLoggedRequestBody)
 		}
@@ -274,7 +356,7 @@ func resolveLogPayloads(c *gin.Context, requestPreview string, responsePreview s
 	if response == "" {
 		full := common.GetFullPayloadString(c, constant.ContextKeyLoggedResponseBodyFull)
 		if full != "" {
-			response = full
+			response = common.ApplyLogPayloadLimit(c, full)
 		} else {
 			response = common.GetContextKeyString(c, constant.ContextKeyLoggedResponseBody)
 		}
@@ -282,17 +364,43 @@ func resolveLogPayloads(c *gin.Context, requestPreview string, responsePreview s
 	return request, response
 }
 
-func persistLogDetail(c *gin.Context, logId int, request string, response string) {
+func persistLogDetail(c *gin.Context, logId int, request string, response string, failed bool) {
 	if logId == 0 {
 		return
 	}
-	if request == "" && response == "" {
+	moderation := ""
+	if c != nil {
+		if verdict, ok := common.GetContextKeyType[*ModerationVerdict](c, constant.ContextKeyModerationVerdict); ok && verdict != nil {
+			moderation = common.GetJsonString(verdict)
+		}
+	}
+	attempts := ""
+	if c != nil && !common.PayloadSampled(c, failed) {
+		// 审核结论不受采样影响，未采样时只保存审核结论
+		if moderation == "" {
+			return
+		}
+		request, response = "", ""
+	} else if c != nil {
+		if list, ok := common.GetContextKeyType[[]RelayAttempt](c, constant.ContextKeyRelayAttempts); ok && len(list) > 0 {
+			attempts = common.GetJsonString(list)
+		}
+	}
+	if request == "" && response == "" && attempts == "" && moderation == "" {
 		return
 	}
 	detail := &LogDetail{
 		LogId:        logId,
 		RequestBody:  LargeText(request),
 		ResponseBody: LargeText(response),
+		Attempts:     attempts,
+		Moderation:   moderation,
+	}
+	if c != nil {
+		detail.Redacted = common.GetContextKeyBool(c, constant.ContextKeyLoggedPayloadRedacted)
+	}
+	if common.LogPayloadStorageEnabled && (request != "" || response != "") {
+		storeLogPayload(c, detail)
 	}
 	if err := LOG_DB.Create(detail).Error; err != nil {
 		ctx := context.Background()
@@ -303,7 +411,30 @@ func persistLogDetail(c *gin.Context, logId int, request string, response string
 	}
 }
 
-func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, group string) (logs []*Log, total int64, err error) {
+// storeLogPayload writes the full content to the object storage, the database keeps the truncated preview.
+// 写入失败时保留原有的数据库存储方式
+func storeLogPayload(c *gin.Context, detail *LogDetail) {
+	ctx := context.Background()
+	request := string(detail.RequestBody)
+	response := string(detail.ResponseBody)
+	if c != nil {
+		ctx = c
+		if full := common.GetFullPayloadString(c, constant.ContextKeyLoggedRequestBodyFull); full != "" {
+			request = full
+		}
+		if full := common.GetFullPayloadString(c, constant.ContextKeyLoggedResponseBodyFull); full != "" {
+			response = full
+		}
+	}
+	key, err := putLogPayload(ctx, detail.LogId, request, response)
+	if err != nil {
+		logger.LogError(ctx, "failed to store log payload: "+err.Error())
+		return
+	}
+	detail.StorageKey = key
+}
+
+func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, group string, sessionId string) (logs []*Log, total int64, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB
@@ -332,6 +463,9 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 	if group != "" {
 		tx = tx.Where("logs."+logGroupCol+" = ?", group)
 	}
+	if sessionId != "" {
+		tx = tx.Where("logs.session_id = ?", sessionId)
+	}
 	err = tx.Model(&Log{}).Count(&total).Error
 	if err != nil {
 		return nil, 0, err
@@ -369,7 +503,7 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 	return logs, total, err
 }
 
-func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, group string) (logs []*Log, total int64, err error) {
+func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, group string, sessionId string) (logs []*Log, total int64, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB.Where("logs.user_id = ?", userId)
@@ -392,6 +526,9 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	if group != "" {
 		tx = tx.Where("logs."+logGroupCol+" = ?", group)
 	}
+	if sessionId != "" {
+		tx = tx.Where("logs.session_id = ?", sessionId)
+	}
 	err = tx.Model(&Log{}).Count(&total).Error
 	if err != nil {
 		return nil, 0, err
@@ -406,6 +543,35 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	return logs, total, err
 }
 
+func GetLogById(id int) (*Log, error) {
+	log := &Log{}
+	if err := LOG_DB.Where("id = ?", id).First(log).Error; err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// GetLogsByRequestId returns the logs recorded for a request, limited to the user when userId is not 0.
+// 一个请求可能在重试时记录多条错误日志
+func GetLogsByRequestId(requestId string, userId int) (logs []*Log, err error) {
+	if requestId == "" {
+		return []*Log{}, nil
+	}
+	tx := LOG_DB.Where("logs.request_id = ?", requestId)
+	if userId != 0 {
+		tx = tx.Where("logs.user_id = ?", userId)
+	}
+	err = tx.Order("logs.id asc").Limit(common.MaxRecentItems).Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	attachLogDetails(logs)
+	if userId != 0 {
+		formatUserLogs(logs)
+	}
+	return logs, nil
+}
+
 func SearchAllLogs(keyword string) (logs []*Log, err error) {
 	err = LOG_DB.Where("type = ? or content LIKE ?", keyword, keyword+"%").Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
 	return logs, err
@@ -447,6 +613,10 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	if username != "" {
 		tx = tx.Where("username = ?", username)
 		rpmTpmQuery = rpmTpmQuery.Where("username = ?", username)
+	} else if demoUserId := GetDemoSandboxUserId(); demoUserId != 0 {
+		// 未指定用户时排除演示沙盒用户，避免演示流量影响整体统计
+		tx = tx.Where("user_id <> ?", demoUserId)
+		rpmTpmQuery = rpmTpmQuery.Where("user_id <> ?", demoUserId)
 	}
 	if tokenName != "" {
 		tx = tx.Where("token_name = ?", tokenName)
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 消费日志哈希链：每条日志保存自身内容的 HMAC 以及同一用户上一条日志的哈希，
+// 修改或删除中间的日志都会导致校验失败，用于计费争议时证明记录未被篡改。
+// 多节点部署时各节点可能基于同一条日志继续写入，形成分叉，校验时只要求上一条哈希存在即可。
+
+var (
+	logChainLocks      sync.Map // user id -> *sync.Mutex
+	logChainLastHashes sync.Map // user id -> string
+)
+
+// hashedLogFields 参与哈希计算的字段，覆盖 Log 所有持久化的内容（自增 ID 与链接字段除外），
+// Log 新增持久化字段时需同时加入此处
+type hashedLogFields struct {
+	UserId           int    `json:"user_id"`
+	CreatedAt        int64  `json:"created_at"`
+	Type             int    `json:"type"`
+	Content          string `json:"content"`
+	Username         string `json:"username"`
+	TokenName        string `json:"token_name"`
+	ModelName        string `json:"model_name"`
+	Quota            int    `json:"quota"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	CacheTokens      int    `json:"cache_tokens"`
+	CacheWriteTokens int    `json:"cache_write_tokens"`
+	UseTime          int    `json:"use_time"`
+	IsStream         bool   `json:"is_stream"`
+	ChannelId        int    `json:"channel_id"`
+	TokenId          int    `json:"token_id"`
+	Group            string `json:"group"`
+	Ip               string `json:"ip"`
+	Other            string `json:"other"`
+	SessionId        string `json:"session_id"`
+	RequestId        string `json:"request_id"`
+}
+
+func computeLogHash(log *Log) (string, error) {
+	data, err := common.Marshal(hashedLogFields{
+		UserId:           log.UserId,
+		CreatedAt:        log.CreatedAt,
+		Type:             log.Type,
+		Content:          log.Content,
+		Username:         log.Username,
+		TokenName:        log.TokenName,
+		ModelName:        log.ModelName,
+		Quota:            log.Quota,
+		PromptTokens:     log.PromptTokens,
+		CompletionTokens: log.CompletionTokens,
+		CacheTokens:      log.CacheTokens,
+		CacheWriteTokens: log.CacheWriteTokens,
+		UseTime:          log.UseTime,
+		IsStream:         log.IsStream,
+		ChannelId:        log.ChannelId,
+		TokenId:          log.TokenId,
+		Group:            log.Group,
+		Ip:               log.Ip,
+		Other:            log.Other,
+		SessionId:        log.SessionId,
+		RequestId:        log.RequestId,
+	})
+	if err != nil {
+		return "", err
+	}
+	return common.GenerateHMAC(log.PrevHash + "\n" + string(data)), nil
+}
+
+func getLastLogHash(userId int) (string, error) {
+	if hash, ok := logChainLastHashes.Load(userId); ok {
+		return hash.(string), nil
+	}
+	var last Log
+	err := LOG_DB.Select("hash").
+		Where("user_id = ? AND type = ? AND hash <> ''", userId, LogTypeConsume).
+		Order("id desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return "", err
+	}
+	return last.Hash, nil
+}
+
+// createChainedLog links the log to the previous one of the same user and inserts it.
+func createChainedLog(log *Log) error {
+	lock, _ := logChainLocks.LoadOrStore(log.UserId, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	prevHash, err := getLastLogHash(log.UserId)
+	if err != nil {
+		return err
+	}
+	log.PrevHash = prevHash
+	if log.Hash, err = computeLogHash(log); err != nil {
+		return err
+	}
+	if err = LOG_DB.Create(log).Error; err != nil {
+		return err
+	}
+	logChainLastHashes.Store(log.UserId, log.Hash)
+	return nil
+}
+
+type LogChainVerification struct {
+	Valid          bool   `json:"valid"`
+	Checked        int    `json:"checked"`
+	FirstLogId     int    `json:"first_log_id"`
+	LastLogId      int    `json:"last_log_id"`
+	LastHash       string `json:"last_hash"`
+	InvalidLogId   int    `json:"invalid_log_id,omitempty"`
+	InvalidReason  string `json:"invalid_reason,omitempty"`
+	UnchainedCount int64  `json:"unchained_count"` // 未开启哈希链时写入的日志数
+}
+
+// VerifyLogChain recomputes the hash of every chained consume log of the user and checks the links.
+// The earliest remaining log anchors the chain, so logs removed by history cleanup do not fail the check. Any
+// later log must link to a log already checked, a log without a previous hash breaks the chain.
+func VerifyLogChain(userId int) (*LogChainVerification, error) {
+	result := &LogChainVerification{Valid: true}
+	if err := LOG_DB.Model(&Log{}).
+		Where("user_id = ? AND type = ? AND (hash = '' OR hash IS NULL)", userId, LogTypeConsume).
+		Count(&result.UnchainedCount).Error; err != nil {
+		return nil, err
+	}
+
+	const batchSize = 1000
+	seen := make(map[string]struct{})
+	lastId := 0
+	for {
+		var logs []*Log
+		err := LOG_DB.Where("user_id = ? AND type = ? AND hash <> '' AND id > ?", userId, LogTypeConsume, lastId).
+			Order("id asc").Limit(batchSize).Find(&logs).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			if result.Checked == 0 {
+				result.FirstLogId = log.Id
+			} else if _, ok := seen[log.PrevHash]; !ok {
+				result.Valid = false
+				result.InvalidLogId = log.Id
+				result.InvalidReason = "previous log is missing or has been modified"
+				return result, nil
+			}
+			hash, err := computeLogHash(log)
+			if err != nil {
+				return nil, err
+			}
+			if hash != log.Hash {
+				result.Valid = false
+				result.InvalidLogId = log.Id
+				result.InvalidReason = fmt.Sprintf("content hash mismatch, expected %s", hash)
+				return result, nil
+			}
+			seen[log.Hash] = struct{}{}
+			result.Checked++
+			result.LastLogId = log.Id
+			result.LastHash = log.Hash
+			lastId = log.Id
+		}
+		if len(logs) < batchSize {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupLogChainDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Log{}); err != nil {
+		t.Fatal(err)
+	}
+	oldLogDB := LOG_DB
+	LOG_DB = db
+	t.Cleanup(func() {
+		LOG_DB = oldLogDB
+		logChainLastHashes.Clear()
+	})
+	logChainLastHashes.Clear()
+}
+
+func insertChainedLogs(t *testing.T, userId int, count int) []*Log {
+	t.Helper()
+	logs := make([]*Log, 0, count)
+	for i := 0; i < count; i++ {
+		log := &Log{UserId: userId, CreatedAt: 1700000000 + int64(i), Username: "alice", Type: LogTypeConsume, Quota: 100 + i, CacheTokens: i, RequestId: fmt.Sprintf("req-%d", i)}
+		if err := createChainedLog(log); err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+func TestVerifyLogChain_DetectsTampering(t *testing.T) {
+	setupLogChainDB(t)
+	logs := insertChainedLogs(t, 1, 3)
+	result, err := VerifyLogChain(1)
+	if err != nil || !result.Valid || result.Checked != 3 {
+		t.Fatalf("untouched chain should verify, got %+v %v", result, err)
+	}
+
+	cases := []struct {
+		column   string
+		tampered any
+		original any
+	}{
+		{"username", "mallory", logs[1].Username},
+		{"cache_tokens", 7, logs[1].CacheTokens},
+		{"request_id", "req-x", logs[1].RequestId},
+	}
+	for _, tc := range cases {
+		LOG_DB.Model(&Log{}).Where("id = ?", logs[1].Id).Update(tc.column, tc.tampered)
+		result, err = VerifyLogChain(1)
+		if err != nil || result.Valid || result.InvalidLogId != logs[1].Id {
+			t.Fatalf("changing %s was not detected: %+v %v", tc.column, result, err)
+		}
+		LOG_DB.Model(&Log{}).Where("id = ?", logs[1].Id).Update(tc.column, tc.original)
+	}
+}
+
+func TestVerifyLogChain_UnlinkedLogBreaksChain(t *testing.T) {
+	setupLogChainDB(t)
+	logs := insertChainedLogs(t, 1, 3)
+
+	// 中间的日志被改写为链首并重新计算哈希
+	LOG_DB.Model(&Log{}).Where("id = ?", logs[2].Id).Update("prev_hash", "")
+	logs[2].PrevHash = ""
+	hash, err := computeLogHash(logs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	LOG_DB.Model(&Log{}).Where("id = ?", logs[2].Id).Update("hash", hash)
+
+	result, err := VerifyLogChain(1)
+	if err != nil || result.Valid || result.InvalidLogId != logs[2].Id {
+		t.Fatalf("log without a previous hash after the first was accepted: %+v %v", result, err)
+	}
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/storage"
+)
+
+// 日志详情的完整内容写入对象存储：数据库中只保留截断后的预览和对象键，查看单条日志详情时再从对象存储读取。
+
+const (
+	logPayloadStoragePrefix  = "log_payloads/"
+	logPayloadStorageTimeout = 10 * time.Second
+)
+
+// LogPayloadStorage returns the object storage used for log payloads, it is set by the service package
+// because the storage client is built from the options there.
+var LogPayloadStorage func() (storage.Storage, error)
+
+type logPayloadObject struct {
+	Request  string `json:"request"`
+	Response string `json:"response"`
+}
+
+func getLogPayloadStorage() (storage.Storage, error) {
+	if LogPayloadStorage == nil {
+		return nil, errors.New("log payload storage is not initialized")
+	}
+	return LogPayloadStorage()
+}
+
+func logPayloadStorageKey(logId int, createdAt int64) string {
+	return fmt.Sprintf("%s%s/%d.json.gz", logPayloadStoragePrefix, time.Unix(createdAt, 0).Format("2006/01/02"), logId)
+}
+
+// putLogPayload compresses the full request and response and writes them to the object storage, returning the object key.
+func putLogPayload(ctx context.Context, logId int, request string, response string) (string, error) {
+	s, err := getLogPayloadStorage()
+	if err != nil {
+		return "", err
+	}
+	data, err := common.Marshal(logPayloadObject{Request: request, Response: response})
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err = zw.Write(data); err != nil {
+		return "", err
+	}
+	if err = zw.Close(); err != nil {
+		return "", err
+	}
+	key := logPayloadStorageKey(logId, time.Now().Unix())
+	ctx, cancel := context.WithTimeout(ctx, logPayloadStorageTimeout)
+	defer cancel()
+	if err = s.Put(ctx, key, buf.Bytes(), "application/gzip"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func getLogPayload(ctx context.Context, key string) (*logPayloadObject, error) {
+	s, err := getLogPayloadStorage()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, logPayloadStorageTimeout)
+	defer cancel()
+	reader, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	zr, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	payload := &logPayloadObject{}
+	if err = common.Unmarshal(data, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// deleteLogPayloads removes the objects of expired log details, missing objects are ignored.
+func deleteLogPayloads(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	s, err := getLogPayloadStorage()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = s.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLogDetail returns the detail of a log with the full content loaded from the object storage,
+// userId limits the lookup to the logs of that user when it is not 0.
+func GetLogDetail(ctx context.Context, logId int, userId int) (*LogDetail, error) {
+	if userId != 0 {
+		var count int64
+		if err := LOG_DB.Model(&Log{}).Where("id = ? AND user_id = ?", logId, userId).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, errors.New("日志不存在")
+		}
+	}
+	detail := &LogDetail{}
+	if err := LOG_DB.Where("log_id = ?", logId).First(detail).Error; err != nil {
+		return nil, err
+	}
+	if detail.StorageKey == "" {
+		return detail, nil
+	}
+	payload, err := getLogPayload(ctx, detail.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load log payload: %w", err)
+	}
+	detail.RequestBody = LargeText(payload.Request)
+	detail.ResponseBody = LargeText(payload.Response)
+	return detail, nil
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"sync"
@@ -8,14 +10,77 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	logRetentionCheckInterval = time.Minute
+	logArchiveStoragePrefix   = "log_archive/"
 )
 
+// 清理的触发方式
 const (
-	logDetailCleanupInterval  = 6 * time.Hour
-	logDetailCleanupBatchSize = 5000
+	LogRetentionTriggerSchedule = "schedule"
+	LogRetentionTriggerManual   = "manual"
 )
 
-var logDetailCleanupOnce sync.Once
+// 日志保留任务名称，同时用作清理记录的任务名和归档文件的目录
+const (
+	LogRetentionTaskConsume = "consume_log"
+	LogRetentionTaskError   = "error_log"
+	LogRetentionTaskDetail  = "log_detail"
+)
+
+// LogRetentionPolicy 各类日志的保留天数，0 表示不清理该类日志
+type LogRetentionPolicy struct {
+	ConsumeLogDays int  `json:"consume_log_days"`
+	ErrorLogDays   int  `json:"error_log_days"`
+	DetailLogDays  int  `json:"detail_log_days"`
+	AuditLogDays   int  `json:"audit_log_days"`
+	Archive        bool `json:"archive"`
+}
+
+// GetLogRetentionPolicy returns the retention policy of the current options.
+func GetLogRetentionPolicy() LogRetentionPolicy {
+	setting := operation_setting.GetLogRetentionSetting()
+	return LogRetentionPolicy{
+		ConsumeLogDays: setting.ConsumeLogDays,
+		ErrorLogDays:   setting.ErrorLogDays,
+		DetailLogDays:  common.DetailedLogRetentionDays,
+		AuditLogDays:   setting.AuditLogDays,
+		Archive:        setting.Archive,
+	}
+}
+
+// LogRetentionPreview 一类日志在当前策略下将被清理的记录数
+type LogRetentionPreview struct {
+	Task    string `json:"task"`
+	Days    int    `json:"days"`
+	Cutoff  int64  `json:"cutoff"`
+	Count   int64  `json:"count"`
+	Archive bool   `json:"archive"`
+}
+
+// LogRetentionProgress 最近一次清理的进度，清理进行中时 Task 为正在执行的任务
+type LogRetentionProgress struct {
+	Running    bool             `json:"running"`
+	Trigger    string           `json:"trigger"`
+	Task       string           `json:"task"`
+	Deleted    map[string]int64 `json:"deleted"`
+	StartedAt  int64            `json:"started_at"`
+	FinishedAt int64            `json:"finished_at"`
+	NextRunAt  int64            `json:"next_run_at"`
+}
+
+var (
+	logDetailCleanupOnce sync.Once
+	// logRetentionRunMu 保证同一时间只有一次清理在执行
+	logRetentionRunMu      sync.Mutex
+	logRetentionProgressMu sync.RWMutex
+	logRetentionProgress   = LogRetentionProgress{Deleted: map[string]int64{}}
+)
 
 func StartLogDetailRetentionCleaner() {
 	logDetailCleanupOnce.Do(func() {
@@ -23,23 +88,220 @@ func StartLogDetailRetentionCleaner() {
 	})
 }
 
+// runLogDetailCleanupLoop checks the schedule every minute so a changed interval applies without a restart,
+// the next run is counted from the end of the previous one, manual runs included.
 func runLogDetailCleanupLoop() {
 	ctx := context.Background()
-	pruneExpiredLogDetails(ctx)
-	ticker := time.NewTicker(logDetailCleanupInterval)
+	ticker := time.NewTicker(logRetentionCheckInterval)
 	defer ticker.Stop()
-	for range ticker.C {
-		pruneExpiredLogDetails(ctx)
+	for {
+		progress := GetLogRetentionProgress()
+		next := time.Unix(progress.FinishedAt, 0).Add(operation_setting.GetLogRetentionSetting().Interval())
+		if progress.FinishedAt == 0 || !time.Now().Before(next) {
+			if logRetentionRunMu.TryLock() {
+				beginLogRetentionProgress(LogRetentionTriggerSchedule)
+				runLogRetention(ctx)
+				logRetentionRunMu.Unlock()
+				next = time.Now().Add(operation_setting.GetLogRetentionSetting().Interval())
+			}
+		}
+		logRetentionProgressMu.Lock()
+		logRetentionProgress.NextRunAt = next.Unix()
+		logRetentionProgressMu.Unlock()
+		<-ticker.C
+	}
+}
+
+// StartLogRetentionRun starts a cleanup pass in the background, false when a pass is already running.
+func StartLogRetentionRun(trigger string) bool {
+	if !logRetentionRunMu.TryLock() {
+		return false
+	}
+	// 在返回前标记为运行中，调用方随后读取的进度不会是上一次的结果
+	beginLogRetentionProgress(trigger)
+	go func() {
+		defer logRetentionRunMu.Unlock()
+		runLogRetention(context.Background())
+	}()
+	return true
+}
+
+// GetLogRetentionProgress returns a copy of the progress of the running or the last cleanup pass.
+func GetLogRetentionProgress() LogRetentionProgress {
+	logRetentionProgressMu.RLock()
+	defer logRetentionProgressMu.RUnlock()
+	progress := logRetentionProgress
+	progress.Deleted = make(map[string]int64, len(logRetentionProgress.Deleted))
+	for task, deleted := range logRetentionProgress.Deleted {
+		progress.Deleted[task] = deleted
+	}
+	return progress
+}
+
+func beginLogRetentionProgress(trigger string) {
+	logRetentionProgressMu.Lock()
+	logRetentionProgress.Running = true
+	logRetentionProgress.Trigger = trigger
+	logRetentionProgress.Task = ""
+	logRetentionProgress.Deleted = map[string]int64{}
+	logRetentionProgress.StartedAt = common.GetTimestamp()
+	logRetentionProgressMu.Unlock()
+}
+
+func runLogRetention(ctx context.Context) {
+	pruneExpiredLogs(ctx)
+	pruneExpiredRequestTraces(ctx)
+
+	logRetentionProgressMu.Lock()
+	logRetentionProgress.Running = false
+	logRetentionProgress.Task = ""
+	logRetentionProgress.FinishedAt = common.GetTimestamp()
+	logRetentionProgressMu.Unlock()
+}
+
+// reportRetentionProgress records the records a task has removed so far.
+func reportRetentionProgress(task string, deleted int64) {
+	logRetentionProgressMu.Lock()
+	logRetentionProgress.Task = task
+	logRetentionProgress.Deleted[task] += deleted
+	logRetentionProgressMu.Unlock()
+}
+
+func pruneExpiredLogs(ctx context.Context) {
+	policy := GetLogRetentionPolicy()
+	pruneExpiredLogsOfType(ctx, LogRetentionTaskConsume, LogTypeConsume, policy.ConsumeLogDays, policy.Archive)
+	pruneExpiredLogsOfType(ctx, LogRetentionTaskError, LogTypeError, policy.ErrorLogDays, policy.Archive)
+	pruneExpiredLogDetails(ctx, policy.DetailLogDays, policy.Archive)
+	pruneExpiredAuditLogs(ctx, policy.AuditLogDays, policy.Archive)
+}
+
+func retentionCutoff(days int) int64 {
+	return time.Now().AddDate(0, 0, -days).Unix()
+}
+
+// PreviewLogRetention counts the records each task of the policy would remove without deleting anything.
+func PreviewLogRetention(policy LogRetentionPolicy) ([]LogRetentionPreview, error) {
+	previews := []LogRetentionPreview{
+		{Task: LogRetentionTaskConsume, Days: policy.ConsumeLogDays},
+		{Task: LogRetentionTaskError, Days: policy.ErrorLogDays},
+		{Task: LogRetentionTaskDetail, Days: policy.DetailLogDays},
+		{Task: LogRetentionTaskAudit, Days: policy.AuditLogDays},
+	}
+	for i := range previews {
+		preview := &previews[i]
+		preview.Archive = policy.Archive
+		if preview.Days <= 0 {
+			continue
+		}
+		preview.Cutoff = retentionCutoff(preview.Days)
+		var query *gorm.DB
+		switch preview.Task {
+		case LogRetentionTaskConsume:
+			query = LOG_DB.Model(&Log{}).Where("created_at < ? AND type = ?", preview.Cutoff, LogTypeConsume)
+		case LogRetentionTaskError:
+			query = LOG_DB.Model(&Log{}).Where("created_at < ? AND type = ?", preview.Cutoff, LogTypeError)
+		case LogRetentionTaskAudit:
+			query = LOG_DB.Model(&AuditLog{}).Where("created_at < ?", preview.Cutoff)
+		default:
+			query = LOG_DB.Model(&LogDetail{}).Where("created_at < ?", preview.Cutoff)
+		}
+		if err := query.Count(&preview.Count).Error; err != nil {
+			return nil, err
+		}
+	}
+	return previews, nil
+}
+
+// archiveLogRows writes the rows as gzip-compressed NDJSON to the storage before they are deleted.
+func archiveLogRows[T any](ctx context.Context, task string, rows []T) error {
+	s, err := getLogPayloadStorage()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for _, row := range rows {
+		data, err := common.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if _, err = zw.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	now := time.Now()
+	key := fmt.Sprintf("%s%s/%s/%d.ndjson.gz", logArchiveStoragePrefix, task, now.Format("2006/01/02"), now.UnixNano())
+	ctx, cancel := context.WithTimeout(ctx, logPayloadStorageTimeout)
+	defer cancel()
+	return s.Put(ctx, key, buf.Bytes(), "application/gzip")
+}
+
+func pruneExpiredLogsOfType(ctx context.Context, task string, logType int, days int, archive bool) {
+	if days <= 0 {
+		return
+	}
+
+	cutoff := retentionCutoff(days)
+	batchSize := operation_setting.GetLogRetentionSetting().GetBatchSize()
+	batchDelay := operation_setting.GetLogRetentionSetting().BatchDelay()
+	var totalDeleted int64
+
+	for ctx.Err() == nil {
+		// idx_created_at_type 覆盖 created_at 与 type 条件
+		var batch []Log
+		query := LOG_DB.Where("created_at < ? AND type = ?", cutoff, logType).
+			Order("created_at ASC").
+			Limit(batchSize)
+		if !archive {
+			query = query.Select("id")
+		}
+		if err := query.Find(&batch).Error; err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to query expired %s records: %s", task, err.Error()))
+			break
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if archive {
+			if err := archiveLogRows(ctx, task, batch); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to archive expired %s records: %s", task, err.Error()))
+				break
+			}
+		}
+		ids := make([]int, 0, len(batch))
+		for _, log := range batch {
+			ids = append(ids, log.Id)
+		}
+		result := LOG_DB.Where("id IN ?", ids).Delete(&Log{})
+		if result.Error != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to prune %s records: %s", task, result.Error.Error()))
+			break
+		}
+		totalDeleted += result.RowsAffected
+		reportRetentionProgress(task, result.RowsAffected)
+		if len(batch) < batchSize {
+			break
+		}
+		time.Sleep(batchDelay)
+	}
+
+	if totalDeleted > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("pruned %d %s records older than %d days", totalDeleted, task, days))
+		RecordRetentionCleanup(task, totalDeleted)
 	}
 }
 
-func pruneExpiredLogDetails(ctx context.Context) {
-	days := common.DetailedLogRetentionDays
+func pruneExpiredLogDetails(ctx context.Context, days int, archive bool) {
 	if days <= 0 {
 		return
 	}
 
-	cutoff := time.Now().AddDate(0, 0, -days).Unix()
+	cutoff := retentionCutoff(days)
+	batchSize := operation_setting.GetLogRetentionSetting().GetBatchSize()
+	batchDelay := operation_setting.GetLogRetentionSetting().BatchDelay()
 	var totalDeleted int64
 
 	for {
@@ -52,10 +314,40 @@ func pruneExpiredLogDetails(ctx context.Context) {
 		// Use indexed ORDER BY to ensure efficient query execution
 		// The index on created_at enables the database to efficiently
 		// identify and delete the oldest records in each batch
-		result := LOG_DB.Where("created_at < ?", cutoff).
+		var batch []LogDetail
+		query := LOG_DB.Where("created_at < ?", cutoff).
 			Order("created_at ASC").
-			Limit(logDetailCleanupBatchSize).
-			Delete(&LogDetail{})
+			Limit(batchSize)
+		if !archive {
+			query = query.Select("log_id", "storage_key")
+		}
+		if err := query.Find(&batch).Error; err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to query expired log detail records: %s", err.Error()))
+			break
+		}
+		if len(batch) == 0 {
+			break
+		}
+		ids := make([]int, 0, len(batch))
+		keys := make([]string, 0)
+		for _, detail := range batch {
+			ids = append(ids, detail.LogId)
+			if detail.StorageKey != "" {
+				keys = append(keys, detail.StorageKey)
+			}
+		}
+		if archive {
+			// 归档记录引用对象存储中的完整内容，归档时保留这些对象
+			if err := archiveLogRows(ctx, LogRetentionTaskDetail, batch); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to archive expired log detail records: %s", err.Error()))
+				break
+			}
+		} else if err := deleteLogPayloads(ctx, keys); err != nil {
+			// 先删除对象存储中的内容，失败时保留数据库记录以便下次重试
+			logger.LogError(ctx, fmt.Sprintf("failed to delete expired log payloads: %s", err.Error()))
+			break
+		}
+		result := LOG_DB.Where("log_id IN ?", ids).Delete(&LogDetail{})
 
 		if result.Error != nil {
 			logger.LogError(ctx, fmt.Sprintf("failed to prune log detail records: %s", result.Error.Error()))
@@ -65,15 +357,17 @@ func pruneExpiredLogDetails(ctx context.Context) {
 			break
 		}
 		totalDeleted += result.RowsAffected
-		if result.RowsAffected < logDetailCleanupBatchSize {
+		reportRetentionProgress(LogRetentionTaskDetail, result.RowsAffected)
+		if result.RowsAffected < int64(batchSize) {
 			break
 		}
 
 		// Add a small delay between batches to reduce database load
-		time.Sleep(100 * time.Millisecond)
+		time.Sleep(batchDelay)
 	}
 
 	if totalDeleted > 0 {
 		logger.LogInfo(ctx, fmt.Sprintf("pruned %d log detail records older than %d days", totalDeleted, days))
+		RecordRetentionCleanup(LogRetentionTaskDetail, totalDeleted)
 	}
 }
@@ -0,0 +1,85 @@
+package model
+
+import "gorm.io/gorm"
+
+// SessionSummary 按会话汇总的消费，会话 ID 由客户端在请求中传递
+type SessionSummary struct {
+	SessionId        string `json:"session_id"`
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	Requests         int64  `json:"requests"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	CacheTokens      int64  `json:"cache_tokens"`
+	Models           int64  `json:"models"`
+	StartedAt        int64  `json:"started_at"`
+	LastActiveAt     int64  `json:"last_active_at"`
+}
+
+// SessionSummaryQuery 会话汇总的筛选条件，UserId 为 0 表示所有用户
+type SessionSummaryQuery struct {
+	UserId         int
+	Username       string
+	TokenName      string
+	ModelName      string
+	SessionId      string
+	StartTimestamp int64
+	EndTimestamp   int64
+	// OrderBy quota（默认）、tokens、requests 或 last_active
+	OrderBy string
+}
+
+var sessionSummaryOrders = map[string]string{
+	"quota":       "quota desc",
+	"tokens":      "(sum(prompt_tokens) + sum(completion_tokens)) desc",
+	"requests":    "requests desc",
+	"last_active": "last_active_at desc",
+}
+
+// GetSessionSummaries aggregates the consume logs per conversation, the most expensive first by default.
+func GetSessionSummaries(query SessionSummaryQuery, startIdx int, num int) (summaries []*SessionSummary, total int64, err error) {
+	tx := LOG_DB.Model(&Log{}).Where("type = ? and session_id <> ''", LogTypeConsume)
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.Username != "" {
+		tx = tx.Where("username = ?", query.Username)
+	}
+	if query.TokenName != "" {
+		tx = tx.Where("token_name = ?", query.TokenName)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name like ?", query.ModelName)
+	}
+	if query.SessionId != "" {
+		tx = tx.Where("session_id = ?", query.SessionId)
+	}
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	// 同一会话 ID 可能被不同用户使用，按用户区分
+	tx = tx.Group("user_id, session_id")
+
+	err = LOG_DB.Table("(?) as sessions", tx.Session(&gorm.Session{}).Select("user_id, session_id")).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order, ok := sessionSummaryOrders[query.OrderBy]
+	if !ok {
+		order = sessionSummaryOrders["quota"]
+	}
+	err = tx.Select("session_id, user_id, max(username) as username, count(*) as requests, " +
+		"sum(quota) as quota, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, " +
+		"sum(cache_tokens) as cache_tokens, count(distinct model_name) as models, " +
+		"min(created_at) as started_at, max(created_at) as last_active_at").
+		Order(order).
+		Limit(num).
+		Offset(startIdx).
+		Scan(&summaries).Error
+	return summaries, total, err
+}
@@ -83,7 +83,7 @@ func createRootAccountIfNeed() error {
 			AccessToken: nil,
 			Quota:       100000000,
 		}
-		DB.Create(&rootUser)
+		_ = rootUser.InsertRoot()
 	}
 	return nil
 }
@@ -143,7 +143,7 @@ func chooseDB(envName string, isLog bool) (*gorm.DB, error) {
 			} else {
 				common.LogSqlType = common.DatabaseTypeSQLite
 			}
-			return gorm.Open(sqlite.Open(common.SQLitePath), &gorm.Config{
+			return gorm.Open(sqlite.Open(sqliteDSN(common.SQLitePath)), &gorm.Config{
 				PrepareStmt: true, // precompile SQL
 			})
 		}
@@ -169,7 +169,7 @@ func chooseDB(envName string, isLog bool) (*gorm.DB, error) {
 	// Use SQLite
 	common.SysLog("SQL_DSN not set, using SQLite as database")
 	common.UsingSQLite = true
-	return gorm.Open(sqlite.Open(common.SQLitePath), &gorm.Config{
+	return gorm.Open(sqlite.Open(sqliteDSN(common.SQLitePath)), &gorm.Config{
 		PrepareStmt: true, // precompile SQL
 	})
 }
@@ -261,11 +261,14 @@ func migrateDB() error {
 		&Token{},
 		&User{},
 		&PasskeyCredential{},
+		&UserIdentity{},
+		&PlaygroundPreset{},
 		&Option{},
 		&Redemption{},
 		&Ability{},
 		&Log{},
 		&LogDetail{},
+		&RequestTrace{},
 		&Midjourney{},
 		&TopUp{},
 		&QuotaData{},
@@ -280,6 +283,18 @@ func migrateDB() error {
 		&SubscriptionOrder{},
 		&UserSubscription{},
 		&SubscriptionPreConsumeRecord{},
+		&ModelClassUsage{},
+		&TokenSession{},
+		&RetentionCleanupRun{},
+		&ChannelHealth{},
+		&ChannelRebalanceAdjustment{},
+		&DormancyNotice{},
+		&File{},
+		&Batch{},
+		&BackgroundResponse{},
+		&QuotaLedger{},
+		&NotificationDelivery{},
+		&AlertState{},
 	)
 	if err != nil {
 		return err
@@ -293,7 +308,7 @@ func migrateDB() error {
 			return err
 		}
 	}
-	return nil
+	return openQuotaLedger()
 }
 
 func migrateDBFast() error {
@@ -308,11 +323,14 @@ func migrateDBFast() error {
 		{&Token{}, "Token"},
 		{&User{}, "User"},
 		{&PasskeyCredential{}, "PasskeyCredential"},
+		{&UserIdentity{}, "UserIdentity"},
+		{&PlaygroundPreset{}, "PlaygroundPreset"},
 		{&Option{}, "Option"},
 		{&Redemption{}, "Redemption"},
 		{&Ability{}, "Ability"},
 		{&Log{}, "Log"},
 		{&LogDetail{}, "LogDetail"},
+		{&RequestTrace{}, "RequestTrace"},
 		{&Midjourney{}, "Midjourney"},
 		{&TopUp{}, "TopUp"},
 		{&QuotaData{}, "QuotaData"},
@@ -327,6 +345,18 @@ func migrateDBFast() error {
 		{&SubscriptionOrder{}, "SubscriptionOrder"},
 		{&UserSubscription{}, "UserSubscription"},
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
+		{&ModelClassUsage{}, "ModelClassUsage"},
+		{&TokenSession{}, "TokenSession"},
+		{&RetentionCleanupRun{}, "RetentionCleanupRun"},
+		{&ChannelHealth{}, "ChannelHealth"},
+		{&ChannelRebalanceAdjustment{}, "ChannelRebalanceAdjustment"},
+		{&DormancyNotice{}, "DormancyNotice"},
+		{&File{}, "File"},
+		{&Batch{}, "Batch"},
+		{&BackgroundResponse{}, "BackgroundResponse"},
+		{&QuotaLedger{}, "QuotaLedger"},
+		{&NotificationDelivery{}, "NotificationDelivery"},
+		{&AlertState{}, "AlertState"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -360,13 +390,16 @@ func migrateDBFast() error {
 			return err
 		}
 	}
+	if err := openQuotaLedger(); err != nil {
+		return err
+	}
 	common.SysLog("database migrated")
 	return nil
 }
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}, &LogDetail{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &LogDetail{}, &RequestTrace{}, &AuditLog{}, &UsageRollup{}, &UsageRollupCursor{}, &UsageReportRollup{}); err != nil {
 		return err
 	}
 	return nil
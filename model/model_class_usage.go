@@ -0,0 +1,51 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ModelClassUsage 用户在一个周期内对某个模型类别的 token 用量
+type ModelClassUsage struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId     int    `json:"user_id" gorm:"not null;uniqueIndex:idx_user_model_class_period"`
+	ModelClass string `json:"model_class" gorm:"type:varchar(64);not null;uniqueIndex:idx_user_model_class_period"`
+	Period     string `json:"period" gorm:"type:varchar(16);not null;uniqueIndex:idx_user_model_class_period"` // 格式: YYYY-MM 或 YYYY-MM-DD
+	UsedTokens int64  `json:"used_tokens" gorm:"bigint;not null;default:0"`
+	UpdatedAt  int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func (ModelClassUsage) TableName() string {
+	return "model_class_usages"
+}
+
+// GetModelClassUsedTokens returns the tokens the user has used for the class in the period.
+func GetModelClassUsedTokens(userId int, modelClass string, period string) (int64, error) {
+	var usage ModelClassUsage
+	err := DB.Where("user_id = ? AND model_class = ? AND period = ?", userId, modelClass, period).
+		Limit(1).Find(&usage).Error
+	return usage.UsedTokens, err
+}
+
+// IncreaseModelClassUsage atomically adds tokens to the user's usage of the class in the period.
+func IncreaseModelClassUsage(userId int, modelClass string, period string, tokens int64) error {
+	if tokens <= 0 {
+		return nil
+	}
+	now := common.GetTimestamp()
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "model_class"}, {Name: "period"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"used_tokens": gorm.Expr("used_tokens + ?", tokens),
+			"updated_at":  now,
+		}),
+	}).Create(&ModelClassUsage{
+		UserId:     userId,
+		ModelClass: modelClass,
+		Period:     period,
+		UsedTokens: tokens,
+		UpdatedAt:  now,
+	}).Error
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	NotificationDeliveryPending  = "pending"
+	NotificationDeliverySuccess  = "success"
+	NotificationDeliveryRetrying = "retrying"
+	NotificationDeliveryFailed   = "failed"
+)
+
+// NotificationDelivery 告警的一次投递，每个接收端一条。Target 为 webhook 名称或邮箱，
+// 地址与密钥在发送时从告警设置中读取，不写入记录
+type NotificationDelivery struct {
+	Id          int64  `json:"id"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	Event       string `json:"event" gorm:"type:varchar(32);index"`
+	Title       string `json:"title" gorm:"type:varchar(255)"`
+	Target      string `json:"target" gorm:"type:varchar(255)"`
+	Format      string `json:"format" gorm:"type:varchar(16)"`
+	Payload     string `json:"payload" gorm:"type:text"`
+	Status      string `json:"status" gorm:"type:varchar(16);index:idx_notification_delivery_retry,priority:1"`
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"last_error" gorm:"type:text"`
+	NextRetryAt int64  `json:"next_retry_at" gorm:"bigint;index:idx_notification_delivery_retry,priority:2"`
+	UpdatedAt   int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// AlertState 每个用户或令牌已告警的最高额度阈值，多节点共享，保证每个阈值只告警一次
+type AlertState struct {
+	Subject   string `json:"subject" gorm:"primaryKey;type:varchar(64)"`
+	Level     int    `json:"level"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func CreateNotificationDelivery(delivery *NotificationDelivery) error {
+	now := common.GetTimestamp()
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	return DB.Create(delivery).Error
+}
+
+func SaveNotificationDelivery(delivery *NotificationDelivery) error {
+	delivery.UpdatedAt = common.GetTimestamp()
+	return DB.Save(delivery).Error
+}
+
+func GetNotificationDeliveryById(id int64) (*NotificationDelivery, error) {
+	var delivery NotificationDelivery
+	err := DB.First(&delivery, "id = ?", id).Error
+	return &delivery, err
+}
+
+// GetNotificationDeliveries lists the deliveries, newest first, optionally filtered by status and event.
+func GetNotificationDeliveries(status string, event string, startIdx int, num int) (deliveries []*NotificationDelivery, total int64, err error) {
+	tx := DB.Model(&NotificationDelivery{})
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if event != "" {
+		tx = tx.Where("event = ?", event)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// GetDueNotificationDeliveries returns the deliveries waiting for a retry whose retry time has come.
+func GetDueNotificationDeliveries(now int64, limit int) (deliveries []*NotificationDelivery, err error) {
+	err = DB.Where("status = ? AND next_retry_at <= ?", NotificationDeliveryRetrying, now).
+		Order("next_retry_at asc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// RaiseAlertLevel records level as the highest threshold the subject has reached, and reports whether it is
+// higher than the recorded one, i.e. whether the alert should fire. A lower level is recorded without firing,
+// so that thresholds fire again after a top-up.
+func RaiseAlertLevel(subject string, level int) (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&AlertState{}).Where("subject = ? AND level < ?", subject, level).
+		Updates(map[string]any{"level": level, "updated_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	var count int64
+	if err := DB.Model(&AlertState{}).Where("subject = ?", subject).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		if level == 0 {
+			return false, nil
+		}
+		// 其他节点同时插入时主键冲突，由插入成功的一方告警
+		if err := DB.Create(&AlertState{Subject: subject, Level: level, UpdatedAt: now}).Error; err != nil {
+			return false, nil
+		}
+		return true, nil
+	}
+	err := DB.Model(&AlertState{}).Where("subject = ? AND level > ?", subject, level).
+		Updates(map[string]any{"level": level, "updated_at": now}).Error
+	return false, err
+}
@@ -49,6 +49,13 @@ func InitOptionMap() {
 	common.OptionMap["AutomaticEnableChannelEnabled"] = strconv.FormatBool(common.AutomaticEnableChannelEnabled)
 	common.OptionMap["LogConsumeEnabled"] = strconv.FormatBool(common.LogConsumeEnabled)
 	common.OptionMap["DetailedLogRetentionDays"] = strconv.Itoa(common.DetailedLogRetentionDays)
+	common.OptionMap["LogPayloadMaxRunes"] = strconv.Itoa(common.LogPayloadMaxRunes)
+	common.OptionMap["LogPayloadRouteLimits"] = common.LogPayloadRouteLimits2JSONString()
+	common.OptionMap["LogPayloadSuccessSampleRate"] = strconv.Itoa(common.LogPayloadSuccessSampleRate)
+	common.OptionMap["LogPayloadErrorSampleRate"] = strconv.Itoa(common.LogPayloadErrorSampleRate)
+	common.OptionMap["LogRedactionEnabled"] = strconv.FormatBool(common.LogRedactionEnabled)
+	common.OptionMap["LogRedactionRules"] = common.LogRedactionRules2JSONString()
+	common.OptionMap["LogPayloadStorageEnabled"] = strconv.FormatBool(common.LogPayloadStorageEnabled)
 	common.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(common.DisplayInCurrencyEnabled)
 	common.OptionMap["DisplayTokenStatEnabled"] = strconv.FormatBool(common.DisplayTokenStatEnabled)
 	common.OptionMap["DrawingEnabled"] = strconv.FormatBool(common.DrawingEnabled)
@@ -114,9 +121,11 @@ func InitOptionMap() {
 	common.OptionMap["ModelRequestRateLimitDurationMinutes"] = strconv.Itoa(setting.ModelRequestRateLimitDurationMinutes)
 	common.OptionMap["ModelRequestRateLimitSuccessCount"] = strconv.Itoa(setting.ModelRequestRateLimitSuccessCount)
 	common.OptionMap["ModelRequestRateLimitGroup"] = setting.ModelRequestRateLimitGroup2JSONString()
+	common.OptionMap["ModelRequestRateLimitStrictGroups"] = setting.ModelRequestRateLimitStrictGroups2JSONString()
 	common.OptionMap["ModelRatio"] = ratio_setting.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = ratio_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = ratio_setting.CacheRatio2JSONString()
+	common.OptionMap["CreateCacheRatio"] = ratio_setting.CreateCacheRatio2JSONString()
 	common.OptionMap["GroupRatio"] = ratio_setting.GroupRatio2JSONString()
 	common.OptionMap["GroupGroupRatio"] = ratio_setting.GroupGroupRatio2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
@@ -124,6 +133,10 @@ func InitOptionMap() {
 	common.OptionMap["ImageRatio"] = ratio_setting.ImageRatio2JSONString()
 	common.OptionMap["AudioRatio"] = ratio_setting.AudioRatio2JSONString()
 	common.OptionMap["AudioCompletionRatio"] = ratio_setting.AudioCompletionRatio2JSONString()
+	common.OptionMap["AudioInputSecondPrice"] = ratio_setting.AudioInputSecondPrice2JSONString()
+	common.OptionMap["AudioOutputTokenPrice"] = ratio_setting.AudioOutputTokenPrice2JSONString()
+	common.OptionMap["AudioCharacterPrice"] = ratio_setting.AudioCharacterPrice2JSONString()
+	common.OptionMap["ImageGenerationPrice"] = ratio_setting.ImageGenerationPrice2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	//common.OptionMap["ChatLink"] = common.ChatLink
 	//common.OptionMap["ChatLink2"] = common.ChatLink2
@@ -140,6 +153,7 @@ func InitOptionMap() {
 	common.OptionMap["CheckSensitiveEnabled"] = strconv.FormatBool(setting.CheckSensitiveEnabled)
 	common.OptionMap["DemoSiteEnabled"] = strconv.FormatBool(operation_setting.DemoSiteEnabled)
 	common.OptionMap["SelfUseModeEnabled"] = strconv.FormatBool(operation_setting.SelfUseModeEnabled)
+	common.OptionMap["LatencyHeadersEnabled"] = strconv.FormatBool(operation_setting.LatencyHeadersEnabled)
 	common.OptionMap["ModelRequestRateLimitEnabled"] = strconv.FormatBool(setting.ModelRequestRateLimitEnabled)
 	common.OptionMap["CheckSensitiveOnPromptEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnPromptEnabled)
 	common.OptionMap["StopOnSensitiveEnabled"] = strconv.FormatBool(setting.StopOnSensitiveEnabled)
@@ -191,12 +205,19 @@ func UpdateOption(key string, value string) error {
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
 	// Update OptionMap
-	return updateOptionMap(key, value)
+	err := updateOptionMap(key, value)
+	if err == nil {
+		common.PublishCoordinationEvent(common.CoordinationEventOptionChanged, key)
+	}
+	return err
 }
 
 func updateOptionMap(key string, value string) (err error) {
 	common.OptionMapRWMutex.Lock()
 	defer common.OptionMapRWMutex.Unlock()
+	if oldValue, ok := common.OptionMap[key]; !ok || oldValue != value {
+		InvalidateCatalogCache()
+	}
 	common.OptionMap[key] = value
 
 	// 检查是否是模型配置 - 使用更规范的方式处理
@@ -249,6 +270,10 @@ func updateOptionMap(key string, value string) (err error) {
 			common.AutomaticEnableChannelEnabled = boolValue
 		case "LogConsumeEnabled":
 			common.LogConsumeEnabled = boolValue
+		case "LogRedactionEnabled":
+			common.LogRedactionEnabled = boolValue
+		case "LogPayloadStorageEnabled":
+			common.LogPayloadStorageEnabled = boolValue
 		case "DisplayInCurrencyEnabled":
 			// 兼容旧字段：同步到新配置 general_setting.quota_display_type（运行时生效）
 			// true -> USD, false -> TOKENS
@@ -285,6 +310,8 @@ func updateOptionMap(key string, value string) (err error) {
 			operation_setting.DemoSiteEnabled = boolValue
 		case "SelfUseModeEnabled":
 			operation_setting.SelfUseModeEnabled = boolValue
+		case "LatencyHeadersEnabled":
+			operation_setting.LatencyHeadersEnabled = boolValue
 		case "CheckSensitiveOnPromptEnabled":
 			setting.CheckSensitiveOnPromptEnabled = boolValue
 		case "ModelRequestRateLimitEnabled":
@@ -364,6 +391,27 @@ func updateOptionMap(key string, value string) (err error) {
 			days = 0
 		}
 		common.DetailedLogRetentionDays = days
+	case "LogPayloadMaxRunes":
+		limit, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return fmt.Errorf("invalid LogPayloadMaxRunes: %w", convErr)
+		}
+		common.LogPayloadMaxRunes = max(limit, 0)
+	case "LogPayloadSuccessSampleRate", "LogPayloadErrorSampleRate":
+		rate, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return fmt.Errorf("invalid %s: %w", key, convErr)
+		}
+		rate = min(max(rate, 0), 100)
+		if key == "LogPayloadSuccessSampleRate" {
+			common.LogPayloadSuccessSampleRate = rate
+		} else {
+			common.LogPayloadErrorSampleRate = rate
+		}
+	case "LogPayloadRouteLimits":
+		err = common.UpdateLogPayloadRouteLimitsByJSONString(value)
+	case "LogRedactionRules":
+		err = common.UpdateLogRedactionRulesByJSONString(value)
 	case "CreemApiKey":
 		setting.CreemApiKey = value
 	case "CreemProducts":
@@ -422,6 +470,8 @@ func updateOptionMap(key string, value string) (err error) {
 		setting.ModelRequestRateLimitSuccessCount, _ = strconv.Atoi(value)
 	case "ModelRequestRateLimitGroup":
 		err = setting.UpdateModelRequestRateLimitGroupByJSONString(value)
+	case "ModelRequestRateLimitStrictGroups":
+		err = setting.UpdateModelRequestRateLimitStrictGroupsByJSONString(value)
 	case "RetryTimes":
 		common.RetryTimes, _ = strconv.Atoi(value)
 	case "DataExportInterval":
@@ -442,12 +492,22 @@ func updateOptionMap(key string, value string) (err error) {
 		err = ratio_setting.UpdateModelPriceByJSONString(value)
 	case "CacheRatio":
 		err = ratio_setting.UpdateCacheRatioByJSONString(value)
+	case "CreateCacheRatio":
+		err = ratio_setting.UpdateCreateCacheRatioByJSONString(value)
 	case "ImageRatio":
 		err = ratio_setting.UpdateImageRatioByJSONString(value)
 	case "AudioRatio":
 		err = ratio_setting.UpdateAudioRatioByJSONString(value)
 	case "AudioCompletionRatio":
 		err = ratio_setting.UpdateAudioCompletionRatioByJSONString(value)
+	case "AudioInputSecondPrice":
+		err = ratio_setting.UpdateAudioInputSecondPriceByJSONString(value)
+	case "AudioOutputTokenPrice":
+		err = ratio_setting.UpdateAudioOutputTokenPriceByJSONString(value)
+	case "AudioCharacterPrice":
+		err = ratio_setting.UpdateAudioCharacterPriceByJSONString(value)
+	case "ImageGenerationPrice":
+		err = ratio_setting.UpdateImageGenerationPriceByJSONString(value)
 	case "TopUpLink":
 		common.TopUpLink = value
 	//case "ChatLink":
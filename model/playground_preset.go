@@ -0,0 +1,83 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// MaxPlaygroundPresetsPerUser 每个用户最多保存的 playground 预设数量
+const MaxPlaygroundPresetsPerUser = 100
+
+// PlaygroundPreset 用户在控制台 playground 中保存的提示词预设，按名称覆盖保存。
+// Content 保存系统提示词、消息和参数等内容，格式由前端定义。
+type PlaygroundPreset struct {
+	Id          int       `json:"id"`
+	UserId      int       `json:"user_id" gorm:"not null;uniqueIndex:uk_playground_preset_user_name"`
+	Name        string    `json:"name" gorm:"size:64;not null;uniqueIndex:uk_playground_preset_user_name"`
+	Content     JSONValue `json:"content" gorm:"type:json"`
+	CreatedTime int64     `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64     `json:"updated_time" gorm:"bigint"`
+}
+
+// GetPlaygroundPresets lists the presets of the user without their content, most recently saved first.
+func GetPlaygroundPresets(userId int) ([]*PlaygroundPreset, error) {
+	var presets []*PlaygroundPreset
+	err := DB.Select("id", "user_id", "name", "created_time", "updated_time").
+		Where("user_id = ?", userId).Order("updated_time desc").Find(&presets).Error
+	return presets, err
+}
+
+func GetPlaygroundPreset(id int, userId int) (*PlaygroundPreset, error) {
+	var preset PlaygroundPreset
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&preset).Error
+	if err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// SavePlaygroundPreset creates the preset or overwrites the preset of the user with the same name.
+func SavePlaygroundPreset(preset *PlaygroundPreset) error {
+	now := common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var existing PlaygroundPreset
+		err := tx.Where("user_id = ? AND name = ?", preset.UserId, preset.Name).First(&existing).Error
+		if err == nil {
+			preset.Id = existing.Id
+			preset.CreatedTime = existing.CreatedTime
+			preset.UpdatedTime = now
+			return tx.Model(&existing).Updates(map[string]interface{}{
+				"content":      preset.Content,
+				"updated_time": now,
+			}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var count int64
+		if err = tx.Model(&PlaygroundPreset{}).Where("user_id = ?", preset.UserId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxPlaygroundPresetsPerUser {
+			return errors.New("预设数量已达上限，请先删除不再使用的预设")
+		}
+		preset.Id = 0
+		preset.CreatedTime = now
+		preset.UpdatedTime = now
+		return tx.Create(preset).Error
+	})
+}
+
+func DeletePlaygroundPreset(id int, userId int) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&PlaygroundPreset{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
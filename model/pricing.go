@@ -25,6 +25,10 @@ type Pricing struct {
 	ModelPrice             float64                 `json:"model_price"`
 	OwnerBy                string                  `json:"owner_by"`
 	CompletionRatio        float64                 `json:"completion_ratio"`
+	AudioInputSecondPrice  float64                 `json:"audio_input_second_price,omitempty"`
+	AudioOutputTokenPrice  float64                 `json:"audio_output_token_price,omitempty"`
+	AudioCharacterPrice    float64                 `json:"audio_character_price,omitempty"`
+	ImageGenerationPrice   map[string]float64      `json:"image_generation_price,omitempty"`
 	EnableGroup            []string                `json:"enable_groups"`
 	SupportedEndpointTypes []constant.EndpointType `json:"supported_endpoint_types"`
 }
@@ -282,6 +286,8 @@ func updatePricing() {
 			pricing.VendorID = meta.VendorID
 		}
 		modelPrice, findPrice := ratio_setting.GetModelPrice(model, false)
+		// 图片接口按尺寸和品质按张计费
+		pricing.ImageGenerationPrice = ratio_setting.GetImageGenerationPrices(model)
 		if findPrice {
 			pricing.ModelPrice = modelPrice
 			pricing.QuotaType = 1
@@ -290,6 +296,16 @@ func updatePricing() {
 			pricing.ModelRatio = modelRatio
 			pricing.CompletionRatio = ratio_setting.GetCompletionRatio(model)
 			pricing.QuotaType = 0
+			// 实时/语音模型单独定价的音频计费维度
+			if price, ok := ratio_setting.GetAudioInputSecondPrice(model); ok {
+				pricing.AudioInputSecondPrice = price
+			}
+			if price, ok := ratio_setting.GetAudioOutputTokenPrice(model); ok {
+				pricing.AudioOutputTokenPrice = price
+			}
+			if price, ok := ratio_setting.GetAudioCharacterPrice(model); ok {
+				pricing.AudioCharacterPrice = price
+			}
 		}
 		pricingMap = append(pricingMap, pricing)
 	}
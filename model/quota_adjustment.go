@@ -0,0 +1,110 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	QuotaAdjustmentCategoryRefund     = "refund"
+	QuotaAdjustmentCategoryGoodwill   = "goodwill"
+	QuotaAdjustmentCategoryCorrection = "correction"
+)
+
+var quotaAdjustmentCategoryNames = map[string]string{
+	QuotaAdjustmentCategoryRefund:     "退款",
+	QuotaAdjustmentCategoryGoodwill:   "补偿",
+	QuotaAdjustmentCategoryCorrection: "更正",
+}
+
+func IsValidQuotaAdjustmentCategory(category string) bool {
+	_, ok := quotaAdjustmentCategoryNames[category]
+	return ok
+}
+
+// QuotaAdjustment 管理员手动增加（Delta > 0）或扣减（Delta < 0）用户额度
+type QuotaAdjustment struct {
+	UserId        int
+	Delta         int
+	Category      string
+	Reason        string
+	AdminId       int
+	AdminUsername string
+}
+
+// AdjustUserQuota applies a manual quota adjustment and records it as an adjustment log of the user.
+// A deduction fails when the user does not have enough quota left.
+func AdjustUserQuota(adjustment QuotaAdjustment) error {
+	if adjustment.Delta == 0 {
+		return errors.New("调整额度不能为 0")
+	}
+	if !IsValidQuotaAdjustmentCategory(adjustment.Category) {
+		return fmt.Errorf("未知的调整类型: %s", adjustment.Category)
+	}
+	if adjustment.Delta > 0 {
+		if err := GrantUserQuota(adjustment.UserId, adjustment.Delta, QuotaLedgerKindAdjustment, adjustment.Reason); err != nil {
+			return err
+		}
+	} else {
+		amount := -adjustment.Delta
+		err := applyQuotaChange(func(tx *gorm.DB) error {
+			result := tx.Model(&User{}).Where("id = ? AND quota >= ?", adjustment.UserId, amount).
+				Update("quota", gorm.Expr("quota - ?", amount))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("用户剩余额度不足，无法扣减")
+			}
+			return nil
+		}, userQuotaLedger(adjustment.UserId, QuotaLedgerKindAdjustment, adjustment.Delta, adjustment.Reason))
+		if err != nil {
+			return err
+		}
+		gopool.Go(func() {
+			if err := cacheDecrUserQuota(adjustment.UserId, int64(amount)); err != nil {
+				common.SysLog("failed to decrease user quota: " + err.Error())
+			}
+		})
+	}
+	recordQuotaAdjustmentLog(adjustment)
+	return nil
+}
+
+func recordQuotaAdjustmentLog(adjustment QuotaAdjustment) {
+	action := "增加"
+	quota := adjustment.Delta
+	if quota < 0 {
+		action = "扣减"
+		quota = -quota
+	}
+	username, _ := GetUsernameById(adjustment.UserId, false)
+	other := map[string]interface{}{
+		"adjustment_category": adjustment.Category,
+		"adjustment_reason":   adjustment.Reason,
+		"quota_delta":         adjustment.Delta,
+		"admin_info": map[string]interface{}{
+			"admin_id":       adjustment.AdminId,
+			"admin_username": adjustment.AdminUsername,
+		},
+	}
+	log := &Log{
+		UserId:    adjustment.UserId,
+		Username:  username,
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeAdjustment,
+		Content: fmt.Sprintf("额度调整（%s）：%s %s，原因：%s", quotaAdjustmentCategoryNames[adjustment.Category],
+			action, logger.LogQuota(quota), adjustment.Reason),
+		Quota: quota,
+		Other: common.MapToJsonStr(other),
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.SysLog("failed to record quota adjustment log: " + err.Error())
+	}
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupQuotaEditDB replaces DB with an in-memory SQLite database holding the tables the quota edits touch.
+func setupQuotaEditDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite 只允许一个写连接，并发的编辑在连接上排队
+	sqlDB.SetMaxOpenConns(1)
+	if err = db.AutoMigrate(&User{}, &Token{}, &QuotaLedger{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldBatch, oldRedis := DB, common.BatchUpdateEnabled, common.RedisEnabled
+	DB, common.BatchUpdateEnabled, common.RedisEnabled = db, false, false
+	initCol()
+	t.Cleanup(func() {
+		DB, common.BatchUpdateEnabled, common.RedisEnabled = oldDB, oldBatch, oldRedis
+		_ = sqlDB.Close()
+	})
+}
+
+func tokenLedgerBalance(t *testing.T, tokenId int) int {
+	t.Helper()
+	var balance int
+	if err := DB.Model(&QuotaLedger{}).Where("token_id = ?", tokenId).Select("COALESCE(SUM(delta), 0)").Scan(&balance).Error; err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+func TestTokenUpdateFrom_ConcurrentEdits(t *testing.T) {
+	setupQuotaEditDB(t)
+	token := &Token{UserId: 1, Key: "concurrent", Name: "t", Status: common.TokenStatusEnabled, RemainQuota: 1000}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	const editors = 8
+	var wg sync.WaitGroup
+	results := make([]error, editors)
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			edit := &Token{Id: token.Id, UserId: 1, Key: token.Key, Name: fmt.Sprintf("edit-%d", i), Status: common.TokenStatusEnabled, RemainQuota: 2000 + i}
+			results[i] = edit.UpdateFrom(1000)
+		}(i)
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range results {
+		switch {
+		case err == nil:
+			if winner != -1 {
+				t.Fatalf("edits %d and %d both succeeded from the same expected quota", winner, i)
+			}
+			winner = i
+		case !errors.Is(err, ErrQuotaConflict):
+			t.Fatalf("edit %d: unexpected error %v", i, err)
+		}
+	}
+	if winner == -1 {
+		t.Fatal("no edit succeeded")
+	}
+
+	var saved Token
+	if err := DB.First(&saved, token.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.RemainQuota != 2000+winner || saved.Name != fmt.Sprintf("edit-%d", winner) {
+		t.Fatalf("saved %d %q, want the edit %d", saved.RemainQuota, saved.Name, winner)
+	}
+	if balance := tokenLedgerBalance(t, token.Id); balance != saved.RemainQuota {
+		t.Fatalf("ledger balance %d, remain quota %d", balance, saved.RemainQuota)
+	}
+}
+
+func TestTokenUpdateFrom_ConsumptionAfterRead(t *testing.T) {
+	setupQuotaEditDB(t)
+	token := &Token{UserId: 1, Key: "consumed", Name: "t", Status: common.TokenStatusEnabled, RemainQuota: 1000}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecreaseTokenQuota(token.Id, token.Key, 300); err != nil {
+		t.Fatal(err)
+	}
+
+	// 编辑基于读取时的 1000，期间的扣费不能被覆盖
+	edit := &Token{Id: token.Id, UserId: 1, Key: token.Key, Name: "renamed", Status: common.TokenStatusEnabled, RemainQuota: 5000}
+	if err := edit.UpdateFrom(1000); !errors.Is(err, ErrQuotaConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	var saved Token
+	if err := DB.First(&saved, token.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.RemainQuota != 700 || saved.Name != "t" {
+		t.Fatalf("conflicting edit was saved: %d %q", saved.RemainQuota, saved.Name)
+	}
+
+	// 不修改额度时其他字段照常保存
+	edit.RemainQuota = 1000
+	if err := edit.UpdateFrom(1000); err != nil {
+		t.Fatal(err)
+	}
+	if edit.RemainQuota != 700 {
+		t.Fatalf("remain quota %d, want 700", edit.RemainQuota)
+	}
+	if balance := tokenLedgerBalance(t, token.Id); balance != 700 {
+		t.Fatalf("ledger balance %d, want 700", balance)
+	}
+}
+
+func TestUserEdit_ConcurrentEdits(t *testing.T) {
+	setupQuotaEditDB(t)
+	user := &User{Username: "edited", Password: "12345678", DisplayName: "u", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, Quota: 1000}
+	if err := user.InsertRoot(); err != nil {
+		t.Fatal(err)
+	}
+
+	const editors = 8
+	var wg sync.WaitGroup
+	results := make([]error, editors)
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			edit := &User{Id: user.Id, Username: "edited", DisplayName: fmt.Sprintf("edit-%d", i), Quota: 2000 + i}
+			results[i] = edit.Edit(false, 1000)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for i, err := range results {
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, ErrQuotaConflict) {
+			t.Fatalf("edit %d: unexpected error %v", i, err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d edits succeeded from the same expected quota, want 1", succeeded)
+	}
+
+	var quota, ledger int
+	DB.Model(&User{}).Where("id = ?", user.Id).Select("quota").Scan(&quota)
+	DB.Model(&QuotaLedger{}).Where("token_id = 0 AND user_id = ?", user.Id).Select("COALESCE(SUM(delta), 0)").Scan(&ledger)
+	if quota < 2000 || quota != ledger {
+		t.Fatalf("quota %d, ledger balance %d", quota, ledger)
+	}
+}
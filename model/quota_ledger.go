@@ -0,0 +1,323 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 额度流水
+//
+// users.quota 与 tokens.remain_quota 是由流水物化的余额，只能通过增量表达式修改，每次变动在同一事务中追加一条流水，
+// 流水只追加不修改，主节点定期按流水校正余额。启用流水时为已有用户和令牌写入一条 opening 记录（当时的余额），
+// 之后任意时刻的余额即为该时刻及之前所有流水之和。令牌流水的 user_id 为 0，通过 token_id 区分。
+
+const (
+	QuotaLedgerKindOpening    = "opening"    // 启用流水时的余额
+	QuotaLedgerKindGrant      = "grant"      // 注册赠送、邀请奖励、签到
+	QuotaLedgerKindTopUp      = "topup"      // 在线充值、兑换码
+	QuotaLedgerKindConsume    = "consume"    // 请求预扣费与结算补扣
+	QuotaLedgerKindRefund     = "refund"     // 预扣费退还、任务失败退款
+	QuotaLedgerKindAdjustment = "adjustment" // 管理员调整、编辑、批量调整
+)
+
+type QuotaLedger struct {
+	Id        int64  `json:"id"`
+	UserId    int    `json:"user_id" gorm:"index:idx_quota_ledger_user_time,priority:1"`
+	TokenId   int    `json:"token_id" gorm:"index:idx_quota_ledger_token_time,priority:1"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index:idx_quota_ledger_user_time,priority:2;index:idx_quota_ledger_token_time,priority:2"`
+	Kind      string `json:"kind" gorm:"type:varchar(16)"`
+	Delta     int    `json:"delta"`
+	Remark    string `json:"remark" gorm:"type:varchar(255)"`
+}
+
+// quotaColumns 用户表中只能通过增量表达式修改的额度字段
+var quotaColumns = []string{"quota", "used_quota", "request_count", "aff_count", "aff_quota", "aff_history"}
+
+const quotaLedgerReconcileInterval = time.Hour
+
+var quotaLedgerReconcileOnce sync.Once
+
+func newQuotaLedger(userId int, tokenId int, kind string, delta int, remark string) *QuotaLedger {
+	if runes := []rune(remark); len(runes) > 255 {
+		remark = string(runes[:255])
+	}
+	return &QuotaLedger{UserId: userId, TokenId: tokenId, CreatedAt: common.GetTimestamp(), Kind: kind, Delta: delta, Remark: remark}
+}
+
+// userQuotaLedger builds the ledger entry of a quota change of the user.
+func userQuotaLedger(userId int, kind string, delta int, remark string) *QuotaLedger {
+	return newQuotaLedger(userId, 0, kind, delta, remark)
+}
+
+// tokenQuotaLedger builds the ledger entry of a remain quota change of the token.
+func tokenQuotaLedger(tokenId int, kind string, delta int, remark string) *QuotaLedger {
+	return newQuotaLedger(0, tokenId, kind, delta, remark)
+}
+
+// insertQuotaLedger writes the entries within tx, which must be the transaction that applies the change, so the
+// ledger and the materialized balance are committed or rolled back together.
+func insertQuotaLedger(tx *gorm.DB, entries ...*QuotaLedger) error {
+	rows := make([]*QuotaLedger, 0, len(entries))
+	for _, entry := range entries {
+		if entry != nil && entry.Delta != 0 {
+			rows = append(rows, entry)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Create(&rows).Error
+}
+
+// applyQuotaChange runs update and writes the ledger entries of the change in one transaction.
+func applyQuotaChange(update func(tx *gorm.DB) error, entries ...*QuotaLedger) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := update(tx); err != nil {
+			return err
+		}
+		return insertQuotaLedger(tx, entries...)
+	})
+}
+
+// openQuotaLedger writes the opening balance of the users and tokens that have no ledger entry yet.
+func openQuotaLedger() error {
+	now := common.GetTimestamp()
+	err := DB.Exec("INSERT INTO quota_ledgers (user_id, token_id, created_at, kind, delta, remark) "+
+		"SELECT id, 0, ?, ?, quota, '' FROM users WHERE NOT EXISTS "+
+		"(SELECT 1 FROM quota_ledgers WHERE quota_ledgers.token_id = 0 AND quota_ledgers.user_id = users.id)",
+		now, QuotaLedgerKindOpening).Error
+	if err != nil {
+		return err
+	}
+	return DB.Exec("INSERT INTO quota_ledgers (user_id, token_id, created_at, kind, delta, remark) "+
+		"SELECT 0, id, ?, ?, remain_quota, '' FROM tokens WHERE NOT EXISTS "+
+		"(SELECT 1 FROM quota_ledgers WHERE quota_ledgers.token_id = tokens.id)",
+		now, QuotaLedgerKindOpening).Error
+}
+
+// StartQuotaLedgerReconcileTask periodically resets the balances that drifted from their ledger on the master node.
+func StartQuotaLedgerReconcileTask() {
+	quotaLedgerReconcileOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				time.Sleep(quotaLedgerReconcileInterval)
+				users, tokens, err := ReconcileQuotaLedger()
+				if err != nil {
+					common.SysError("failed to reconcile quota ledger: " + err.Error())
+					continue
+				}
+				if users > 0 || tokens > 0 {
+					common.SysLog(fmt.Sprintf("quota ledger reconciled, %d users and %d tokens corrected", users, tokens))
+				}
+			}
+		})
+	})
+}
+
+// ReconcileQuotaLedger resets the balance of every user and token that differs from the sum of its ledger, the
+// ledger is the source of truth. It returns how many users and tokens were corrected.
+func ReconcileQuotaLedger() (users int, tokens int, err error) {
+	var userIds []int
+	err = DB.Model(&User{}).Where("quota <> (SELECT COALESCE(SUM(delta), 0) FROM quota_ledgers "+
+		"WHERE quota_ledgers.token_id = 0 AND quota_ledgers.user_id = users.id)").Pluck("id", &userIds).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, id := range userIds {
+		corrected, err := reconcileUserQuota(id)
+		if err != nil {
+			return users, tokens, err
+		}
+		if corrected {
+			users++
+		}
+	}
+	var tokenIds []int
+	err = DB.Model(&Token{}).Where("remain_quota <> (SELECT COALESCE(SUM(delta), 0) FROM quota_ledgers "+
+		"WHERE quota_ledgers.token_id = tokens.id)").Pluck("id", &tokenIds).Error
+	if err != nil {
+		return users, 0, err
+	}
+	for _, id := range tokenIds {
+		corrected, err := reconcileTokenQuota(id)
+		if err != nil {
+			return users, tokens, err
+		}
+		if corrected {
+			tokens++
+		}
+	}
+	return users, tokens, nil
+}
+
+// reconcileUserQuota locks the user row before summing the ledger, every change updates that row and writes its
+// ledger entry in one transaction, so no change can be half visible.
+func reconcileUserQuota(userId int) (bool, error) {
+	var current, ledger int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userId).
+			Select("quota").Scan(&current).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&QuotaLedger{}).Where("token_id = 0 AND user_id = ?", userId).
+			Select("COALESCE(SUM(delta), 0)").Scan(&ledger).Error; err != nil {
+			return err
+		}
+		if current == ledger {
+			return nil
+		}
+		return tx.Model(&User{}).Where("id = ?", userId).Update("quota", ledger).Error
+	})
+	if err != nil || current == ledger {
+		return false, err
+	}
+	common.SysLog(fmt.Sprintf("quota of user %d reset from %d to its ledger balance %d", userId, current, ledger))
+	if err := invalidateUserCache(userId); err != nil {
+		common.SysLog("failed to invalidate user cache: " + err.Error())
+	}
+	return true, nil
+}
+
+func reconcileTokenQuota(tokenId int) (bool, error) {
+	var token Token
+	var ledger int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", commonKeyCol, "remain_quota").
+			First(&token, tokenId).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&QuotaLedger{}).Where("token_id = ?", tokenId).
+			Select("COALESCE(SUM(delta), 0)").Scan(&ledger).Error; err != nil {
+			return err
+		}
+		if token.RemainQuota == ledger {
+			return nil
+		}
+		return tx.Model(&Token{}).Where("id = ?", tokenId).Update("remain_quota", ledger).Error
+	})
+	if err != nil || token.RemainQuota == ledger {
+		return false, err
+	}
+	common.SysLog(fmt.Sprintf("remain quota of token %d reset from %d to its ledger balance %d", tokenId, token.RemainQuota, ledger))
+	if common.RedisEnabled {
+		if err := cacheDeleteToken(token.Key); err != nil {
+			common.SysLog("failed to delete token cache: " + err.Error())
+		}
+	}
+	return true, nil
+}
+
+type QuotaSnapshot struct {
+	UserId    int   `json:"user_id,omitempty"`
+	TokenId   int   `json:"token_id,omitempty"`
+	Timestamp int64 `json:"timestamp"`
+	Balance   int   `json:"balance"`
+	// LedgerSince 该用户流水的起点，早于它的时刻无法还原
+	LedgerSince int64 `json:"ledger_since"`
+	Complete    bool  `json:"complete"`
+	// CurrentBalance 与 LedgerBalance 的差额来自尚未校正的、绕过流水的改动
+	CurrentBalance int `json:"current_balance"`
+	LedgerBalance  int `json:"ledger_balance"`
+	// 时间点之后到现在的流水，按类型汇总
+	ChangesSince map[string]int `json:"changes_since"`
+}
+
+// GetQuotaSnapshot reconstructs the balance of the user at timestamp from the ledger.
+func GetQuotaSnapshot(userId int, timestamp int64) (*QuotaSnapshot, error) {
+	snapshot, err := getLedgerSnapshot("token_id = 0 AND user_id = ?", userId, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.UserId = userId
+	if err = DB.Model(&User{}).Where("id = ?", userId).Select("quota").Find(&snapshot.CurrentBalance).Error; err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetTokenQuotaSnapshot reconstructs the remain quota of the token at timestamp from the ledger.
+func GetTokenQuotaSnapshot(tokenId int, timestamp int64) (*QuotaSnapshot, error) {
+	snapshot, err := getLedgerSnapshot("token_id = ?", tokenId, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.TokenId = tokenId
+	if err = DB.Model(&Token{}).Where("id = ?", tokenId).Select("remain_quota").Find(&snapshot.CurrentBalance).Error; err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func getLedgerSnapshot(owner string, ownerId int, timestamp int64) (*QuotaSnapshot, error) {
+	snapshot := &QuotaSnapshot{Timestamp: timestamp, ChangesSince: map[string]int{}}
+	var before struct {
+		Total    int
+		MinStart int64
+	}
+	err := DB.Model(&QuotaLedger{}).
+		Select("COALESCE(SUM(delta), 0) AS total, COALESCE(MIN(created_at), 0) AS min_start").
+		Where(owner+" AND created_at <= ?", ownerId, timestamp).
+		Scan(&before).Error
+	if err != nil {
+		return nil, err
+	}
+	var after []struct {
+		Kind     string
+		Total    int
+		MinStart int64
+	}
+	err = DB.Model(&QuotaLedger{}).
+		Select("kind, SUM(delta) AS total, MIN(created_at) AS min_start").
+		Where(owner+" AND created_at > ?", ownerId, timestamp).
+		Group("kind").
+		Scan(&after).Error
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Balance = before.Total
+	snapshot.LedgerBalance = before.Total
+	snapshot.LedgerSince = before.MinStart
+	for _, row := range after {
+		snapshot.LedgerBalance += row.Total
+		snapshot.ChangesSince[row.Kind] += row.Total
+		if snapshot.LedgerSince == 0 || row.MinStart < snapshot.LedgerSince {
+			snapshot.LedgerSince = row.MinStart
+		}
+	}
+	snapshot.Complete = snapshot.LedgerSince != 0 && timestamp >= snapshot.LedgerSince
+	return snapshot, nil
+}
+
+// GetQuotaLedger lists the ledger entries of the user between start and end (0 for unbounded), newest first.
+func GetQuotaLedger(userId int, start int64, end int64, startIdx int, num int) (entries []*QuotaLedger, total int64, err error) {
+	return getQuotaLedger(DB.Model(&QuotaLedger{}).Where("token_id = 0 AND user_id = ?", userId), start, end, startIdx, num)
+}
+
+// GetTokenQuotaLedger lists the ledger entries of the token between start and end (0 for unbounded), newest first.
+func GetTokenQuotaLedger(tokenId int, start int64, end int64, startIdx int, num int) (entries []*QuotaLedger, total int64, err error) {
+	return getQuotaLedger(DB.Model(&QuotaLedger{}).Where("token_id = ?", tokenId), start, end, startIdx, num)
+}
+
+func getQuotaLedger(tx *gorm.DB, start int64, end int64, startIdx int, num int) (entries []*QuotaLedger, total int64, err error) {
+	if start != 0 {
+		tx = tx.Where("created_at >= ?", start)
+	}
+	if end != 0 {
+		tx = tx.Where("created_at <= ?", end)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&entries).Error
+	return entries, total, err
+}
@@ -144,8 +144,10 @@ func Redeem(key string, userId int) (quota int, err error) {
 		redemption.RedeemedTime = common.GetTimestamp()
 		redemption.Status = common.RedemptionCodeStatusUsed
 		redemption.UsedUserId = userId
-		err = tx.Save(redemption).Error
-		return err
+		if err = tx.Save(redemption).Error; err != nil {
+			return err
+		}
+		return insertQuotaLedger(tx, userQuotaLedger(userId, QuotaLedgerKindTopUp, redemption.Quota, fmt.Sprintf("兑换码ID %d", redemption.Id)))
 	})
 	if err != nil {
 		return 0, errors.New("兑换失败，" + err.Error())
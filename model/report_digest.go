@@ -0,0 +1,147 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// RetentionCleanupRun 记录一次过期数据清理删除的条数，供管理员报告汇总
+type RetentionCleanupRun struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Task      string `json:"task" gorm:"type:varchar(64);index"`
+	Deleted   int64  `json:"deleted" gorm:"bigint"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// RecordRetentionCleanup stores the result of a cleanup run, runs that deleted nothing are not recorded.
+func RecordRetentionCleanup(task string, deleted int64) {
+	if deleted <= 0 {
+		return
+	}
+	err := DB.Create(&RetentionCleanupRun{
+		Task:      task,
+		Deleted:   deleted,
+		CreatedAt: common.GetTimestamp(),
+	}).Error
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to record retention cleanup of %s: %s", task, err.Error()))
+	}
+}
+
+// DigestRank 报告中按消耗或次数排名的一项
+type DigestRank struct {
+	Id    int    `json:"id"`
+	Name  string `json:"name"`
+	Quota int64  `json:"quota"`
+	Count int64  `json:"count"`
+}
+
+// DigestUsageTotals 数据看板汇总的消耗
+type DigestUsageTotals struct {
+	Quota     int64 `json:"quota"`
+	Count     int64 `json:"count"`
+	TokenUsed int64 `json:"token_used"`
+}
+
+// GetUsageTotals sums the dashboard rollups in [startTime, endTime).
+func GetUsageTotals(startTime int64, endTime int64) (DigestUsageTotals, error) {
+	var totals DigestUsageTotals
+	err := DB.Table("quota_data").
+		Select("COALESCE(sum(quota), 0) as quota, COALESCE(sum(count), 0) as count, COALESCE(sum(token_used), 0) as token_used").
+		Where("created_at >= ? and created_at < ?", startTime, endTime).
+		Scan(&totals).Error
+	return totals, err
+}
+
+// GetTopUsersByUsage returns the users with the highest spend in [startTime, endTime).
+func GetTopUsersByUsage(startTime int64, endTime int64, limit int) ([]DigestRank, error) {
+	var ranks []DigestRank
+	err := DB.Table("quota_data").
+		Select("user_id as id, username as name, sum(quota) as quota, sum(count) as count").
+		Where("created_at >= ? and created_at < ?", startTime, endTime).
+		Group("user_id, username").
+		Order("quota desc").
+		Limit(limit).
+		Scan(&ranks).Error
+	return ranks, err
+}
+
+// GetTopModelsByUsage returns the models with the highest spend in [startTime, endTime).
+func GetTopModelsByUsage(startTime int64, endTime int64, limit int) ([]DigestRank, error) {
+	var ranks []DigestRank
+	err := DB.Table("quota_data").
+		Select("model_name as name, sum(quota) as quota, sum(count) as count").
+		Where("created_at >= ? and created_at < ?", startTime, endTime).
+		Group("model_name").
+		Order("quota desc").
+		Limit(limit).
+		Scan(&ranks).Error
+	return ranks, err
+}
+
+func CountErrorLogs(startTime int64, endTime int64) (int64, error) {
+	var count int64
+	err := LOG_DB.Model(&Log{}).Where("type = ? and created_at >= ? and created_at < ?", LogTypeError, startTime, endTime).Count(&count).Error
+	return count, err
+}
+
+// GetTopErrorChannels returns the channels with the most error logs in [startTime, endTime).
+func GetTopErrorChannels(startTime int64, endTime int64, limit int) ([]DigestRank, error) {
+	var ranks []DigestRank
+	err := LOG_DB.Model(&Log{}).
+		Select("channel_id as id, count(*) as count").
+		Where("type = ? and created_at >= ? and created_at < ?", LogTypeError, startTime, endTime).
+		Group("channel_id").
+		Order("count desc").
+		Limit(limit).
+		Scan(&ranks).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range ranks {
+		if channel, err := CacheGetChannel(ranks[i].Id); err == nil {
+			ranks[i].Name = channel.Name
+		}
+	}
+	return ranks, nil
+}
+
+// GetChannelsDisabledBetween returns the disabled channels whose status changed in [startTime, endTime).
+func GetChannelsDisabledBetween(startTime int64, endTime int64) ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Omit("key").Where("status <> ?", common.ChannelStatusEnabled).Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Channel, 0)
+	for _, channel := range channels {
+		statusTime, ok := channel.GetOtherInfo()["status_time"].(float64)
+		if !ok || int64(statusTime) < startTime || int64(statusTime) >= endTime {
+			continue
+		}
+		result = append(result, channel)
+	}
+	return result, nil
+}
+
+// GetRetentionCleanupTotals sums the rows deleted by each cleanup task in [startTime, endTime).
+func GetRetentionCleanupTotals(startTime int64, endTime int64) (map[string]int64, error) {
+	var rows []struct {
+		Task    string
+		Deleted int64
+	}
+	err := DB.Model(&RetentionCleanupRun{}).
+		Select("task, sum(deleted) as deleted").
+		Where("created_at >= ? and created_at < ?", startTime, endTime).
+		Group("task").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		totals[row.Task] = row.Deleted
+	}
+	return totals, nil
+}
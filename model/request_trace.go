@@ -0,0 +1,91 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTrace 中转请求的时间线，Events 和 LogIds 为 JSON
+type RequestTrace struct {
+	Id        int       `json:"id"`
+	RequestId string    `json:"request_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId    int       `json:"user_id" gorm:"index"`
+	ModelName string    `json:"model_name" gorm:"default:''"`
+	CreatedAt int64     `json:"created_at" gorm:"bigint;index"`
+	UseTimeMs int64     `json:"use_time_ms" gorm:"bigint;default:0"`
+	Events    LargeText `json:"-"`
+	LogIds    string    `json:"-" gorm:"type:varchar(1024);default:''"`
+}
+
+func (trace *RequestTrace) Insert() error {
+	return LOG_DB.Create(trace).Error
+}
+
+func GetRequestTraceByRequestId(requestId string) (*RequestTrace, error) {
+	var trace RequestTrace
+	err := LOG_DB.Where("request_id = ?", requestId).First(&trace).Error
+	if err != nil {
+		return nil, err
+	}
+	return &trace, nil
+}
+
+// GetLogsByIds returns the logs with their captured payloads attached, in id order.
+func GetLogsByIds(ids []int) (logs []*Log, err error) {
+	if len(ids) == 0 {
+		return []*Log{}, nil
+	}
+	err = LOG_DB.Where("id IN ?", ids).Order("id asc").Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	attachLogDetails(logs)
+	return logs, nil
+}
+
+// appendRecordedLogId remembers the logs written for the request so its trace can link to them.
+func appendRecordedLogId(c *gin.Context, logId int) {
+	if c == nil || logId == 0 {
+		return
+	}
+	ids, _ := common.GetContextKeyType[[]int](c, constant.ContextKeyRecordedLogIds)
+	common.SetContextKey(c, constant.ContextKeyRecordedLogIds, append(ids, logId))
+}
+
+func pruneExpiredRequestTraces(ctx context.Context) {
+	days := operation_setting.GetRequestTraceSetting().RetentionDays
+	if days <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -days).Unix()
+	batchSize := operation_setting.GetLogRetentionSetting().GetBatchSize()
+	var totalDeleted int64
+	for ctx.Err() == nil {
+		result := LOG_DB.Where("created_at < ?", cutoff).
+			Order("created_at ASC").
+			Limit(batchSize).
+			Delete(&RequestTrace{})
+		if result.Error != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to prune request traces: %s", result.Error.Error()))
+			break
+		}
+		totalDeleted += result.RowsAffected
+		reportRetentionProgress("request_trace", result.RowsAffected)
+		if result.RowsAffected < int64(batchSize) {
+			break
+		}
+		time.Sleep(operation_setting.GetLogRetentionSetting().BatchDelay())
+	}
+	if totalDeleted > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("pruned %d request traces older than %d days", totalDeleted, days))
+		RecordRetentionCleanup("request_trace", totalDeleted)
+	}
+}
@@ -0,0 +1,178 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+var sqliteCheckpointModes = map[string]bool{
+	"PASSIVE":  true,
+	"FULL":     true,
+	"RESTART":  true,
+	"TRUNCATE": true,
+}
+
+// sqliteDSN appends the tuning pragmas to the sqlite path unless the path already sets them.
+func sqliteDSN(path string) string {
+	pragmas := make([]string, 0, 3)
+	if common.SQLiteBusyTimeout > 0 && !strings.Contains(path, "_pragma=busy_timeout") {
+		pragmas = append(pragmas, fmt.Sprintf("busy_timeout(%d)", common.SQLiteBusyTimeout))
+	}
+	if common.SQLiteJournalMode != "" && !strings.Contains(path, "_pragma=journal_mode") {
+		pragmas = append(pragmas, fmt.Sprintf("journal_mode(%s)", common.SQLiteJournalMode))
+	}
+	if common.SQLiteSynchronous != "" && !strings.Contains(path, "_pragma=synchronous") {
+		pragmas = append(pragmas, fmt.Sprintf("synchronous(%s)", common.SQLiteSynchronous))
+	}
+	for _, pragma := range pragmas {
+		if strings.Contains(path, "?") {
+			path += "&_pragma=" + pragma
+		} else {
+			path += "?_pragma=" + pragma
+		}
+	}
+	return path
+}
+
+// sqliteFilePath returns the database file of the sqlite path without the query parameters.
+func sqliteFilePath() string {
+	path, _, _ := strings.Cut(common.SQLitePath, "?")
+	return strings.TrimPrefix(path, "file:")
+}
+
+// sqliteDB returns the connection of the sqlite database, nil when neither database uses sqlite.
+// 日志库单独使用 local 时与主库是同一个文件，只需处理一个
+func sqliteDB() *gorm.DB {
+	if common.UsingSQLite {
+		return DB
+	}
+	if os.Getenv("LOG_SQL_DSN") != "" && common.LogSqlType == common.DatabaseTypeSQLite {
+		return LOG_DB
+	}
+	return nil
+}
+
+type SQLiteCheckpointResult struct {
+	Mode               string `json:"mode"`
+	Busy               int    `json:"busy"`
+	LogFrames          int    `json:"log_frames"`
+	CheckpointedFrames int    `json:"checkpointed_frames"`
+	Error              string `json:"error,omitempty"`
+	At                 int64  `json:"at"`
+}
+
+type SQLiteStatus struct {
+	Enabled            bool                    `json:"enabled"`
+	Path               string                  `json:"path,omitempty"`
+	JournalMode        string                  `json:"journal_mode,omitempty"`
+	Synchronous        int                     `json:"synchronous"`
+	BusyTimeout        int                     `json:"busy_timeout"`
+	DBSize             int64                   `json:"db_size"`
+	WALSize            int64                   `json:"wal_size"`
+	CheckpointInterval int                     `json:"checkpoint_interval"`
+	CheckpointMode     string                  `json:"checkpoint_mode"`
+	LastCheckpoint     *SQLiteCheckpointResult `json:"last_checkpoint,omitempty"`
+}
+
+var (
+	sqliteCheckpointMu   sync.Mutex
+	lastSQLiteCheckpoint *SQLiteCheckpointResult
+	sqliteCheckpointOnce sync.Once
+)
+
+// CheckpointSQLite copies the WAL back into the database file, mode is one of PASSIVE, FULL, RESTART and TRUNCATE.
+func CheckpointSQLite(mode string) (*SQLiteCheckpointResult, error) {
+	db := sqliteDB()
+	if db == nil {
+		return nil, fmt.Errorf("database is not sqlite")
+	}
+	mode = strings.ToUpper(mode)
+	if !sqliteCheckpointModes[mode] {
+		return nil, fmt.Errorf("invalid checkpoint mode: %s", mode)
+	}
+	sqliteCheckpointMu.Lock()
+	defer sqliteCheckpointMu.Unlock()
+	result := &SQLiteCheckpointResult{Mode: mode, At: common.GetTimestamp()}
+	err := db.Raw(fmt.Sprintf("PRAGMA wal_checkpoint(%s)", mode)).Row().Scan(&result.Busy, &result.LogFrames, &result.CheckpointedFrames)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	lastSQLiteCheckpoint = result
+	return result, err
+}
+
+// StartSQLiteCheckpointTask checkpoints the WAL periodically so it does not grow between the automatic checkpoints,
+// which are skipped while readers keep the WAL busy.
+func StartSQLiteCheckpointTask() {
+	if !common.IsMasterNode || common.SQLiteCheckpointInterval <= 0 || sqliteDB() == nil {
+		return
+	}
+	if !sqliteCheckpointModes[common.SQLiteCheckpointMode] {
+		common.SysError("invalid SQLITE_CHECKPOINT_MODE, sqlite checkpoint task disabled: " + common.SQLiteCheckpointMode)
+		return
+	}
+	sqliteCheckpointOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Duration(common.SQLiteCheckpointInterval) * time.Second)
+			defer ticker.Stop()
+			for range ticker.C {
+				result, err := CheckpointSQLite(common.SQLiteCheckpointMode)
+				if err != nil {
+					common.SysError("sqlite checkpoint failed: " + err.Error())
+					continue
+				}
+				if result.Busy != 0 {
+					common.SysLog(fmt.Sprintf("sqlite checkpoint incomplete: %d of %d frames", result.CheckpointedFrames, result.LogFrames))
+				}
+			}
+		}()
+	})
+}
+
+func GetSQLiteStatus() (*SQLiteStatus, error) {
+	db := sqliteDB()
+	if db == nil {
+		return &SQLiteStatus{Enabled: false}, nil
+	}
+	status := &SQLiteStatus{
+		Enabled:            true,
+		Path:               sqliteFilePath(),
+		CheckpointInterval: common.SQLiteCheckpointInterval,
+		CheckpointMode:     common.SQLiteCheckpointMode,
+	}
+	if err := db.Raw("PRAGMA journal_mode").Row().Scan(&status.JournalMode); err != nil {
+		return nil, err
+	}
+	if err := db.Raw("PRAGMA synchronous").Row().Scan(&status.Synchronous); err != nil {
+		return nil, err
+	}
+	if err := db.Raw("PRAGMA busy_timeout").Row().Scan(&status.BusyTimeout); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(status.Path); err == nil {
+		status.DBSize = info.Size()
+	}
+	if info, err := os.Stat(status.Path + "-wal"); err == nil {
+		status.WALSize = info.Size()
+	}
+	sqliteCheckpointMu.Lock()
+	status.LastCheckpoint = lastSQLiteCheckpoint
+	sqliteCheckpointMu.Unlock()
+	return status, nil
+}
+
+// BackupSQLite writes a consistent copy of the database to dst while it stays online, dst must not exist or be empty.
+func BackupSQLite(dst string) error {
+	db := sqliteDB()
+	if db == nil {
+		return fmt.Errorf("database is not sqlite")
+	}
+	return db.Exec("VACUUM INTO ?", dst).Error
+}
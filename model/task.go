@@ -247,6 +247,13 @@ func GetAllUnFinishSyncTasks(limit int) []*Task {
 	return tasks
 }
 
+// CountUnfinishedTasksByChannel counts the async tasks of the channel that are still being polled.
+func CountUnfinishedTasksByChannel(channelId int) (int64, error) {
+	var count int64
+	err := DB.Model(&Task{}).Where("channel_id = ?", channelId).Where("progress != ?", "100%").Where("status != ?", TaskStatusFailure).Where("status != ?", TaskStatusSuccess).Count(&count).Error
+	return count, err
+}
+
 func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
 )
@@ -26,7 +27,17 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`                                     // 跨分组重试，仅auto分组有效
+	ComplianceTags     string         `json:"compliance_tags" gorm:"type:varchar(255);default:''"`   // 要求渠道必须具备的合规属性，逗号分隔
+	BillingPreference  string         `json:"billing_preference" gorm:"type:varchar(32);default:''"` // 令牌的扣费策略（订阅/钱包），为空时使用用户设置
+	ResponseCache      bool           `json:"response_cache"`                                        // 相同的非流式请求返回缓存的响应
+	ContentFallback    bool           `json:"content_fallback"`                                      // 上游因内容过滤拒绝时按兜底规则切换渠道或模型
+	FetchUrlTool       bool           `json:"fetch_url_tool"`                                        // 由网关执行模型发起的 fetch_url 工具调用
+	NativePassthrough  bool           `json:"native_passthrough"`                                    // 请求协议与渠道原生协议一致时原样转发请求和响应
+	ModelClasses       string         `json:"model_classes" gorm:"type:varchar(255);default:''"`     // 开启模型限制时额外允许的模型类别，逗号分隔
+	AllowEndpoints     string         `json:"allow_endpoints" gorm:"type:varchar(255);default:''"`   // 允许访问的接口类型，逗号分隔，为空时不限制
+	ActiveFrom         int64          `json:"active_from" gorm:"bigint;default:0"`                   // 生效时间，0 表示创建后立即生效
+	AccessWindows      string         `json:"access_windows" gorm:"type:varchar(512);default:''"`    // 每周的可用时段，例如 mon-fri 09:00-18:00
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -56,6 +67,10 @@ func (token *Token) GetIpLimits() []string {
 	return ipLimits
 }
 
+func (token *Token) GetComplianceTags() []string {
+	return ParseComplianceTags(token.ComplianceTags)
+}
+
 func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
 	var tokens []*Token
 	var err error
@@ -172,12 +187,16 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 }
 
 func (token *Token) Insert() error {
-	var err error
-	err = DB.Create(token).Error
-	return err
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(token).Error; err != nil {
+			return err
+		}
+		return insertQuotaLedger(tx, tokenQuotaLedger(token.Id, QuotaLedgerKindOpening, token.RemainQuota, "创建令牌"))
+	})
 }
 
 // Update Make sure your token's fields is completed, because this will update non-zero values
+// remain_quota is not written here, use UpdateFrom to change it.
 func (token *Token) Update() (err error) {
 	defer func() {
 		if shouldUpdateRedis(true, err) {
@@ -189,11 +208,52 @@ func (token *Token) Update() (err error) {
 			})
 		}
 	}()
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+	err = DB.Model(token).Select(tokenEditableColumns).Updates(token).Error
 	return err
 }
 
+// tokenEditableColumns 编辑令牌时写入的字段，剩余额度单独处理
+var tokenEditableColumns = []string{"name", "status", "expired_time", "unlimited_quota",
+	"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "compliance_tags", "billing_preference", "response_cache", "content_fallback",
+	"fetch_url_tool", "native_passthrough", "model_classes", "allow_endpoints", "active_from", "access_windows"}
+
+// ErrQuotaConflict 额度在客户端读取之后已被修改（请求扣费或其他编辑），需要重新读取后再提交
+var ErrQuotaConflict = errors.New("额度在读取之后已发生变化，请刷新后重试")
+
+// UpdateFrom updates the token like Update and sets remain_quota when it differs from expectedRemainQuota, the value
+// the client read before the edit. The new value is only written while the stored one still equals
+// expectedRemainQuota, otherwise nothing is saved and ErrQuotaConflict is returned.
+func (token *Token) UpdateFrom(expectedRemainQuota int) (err error) {
+	defer func() {
+		if shouldUpdateRedis(true, err) {
+			gopool.Go(func() {
+				err := cacheSetToken(*token)
+				if err != nil {
+					common.SysLog("failed to update token cache: " + err.Error())
+				}
+			})
+		}
+	}()
+	delta := token.RemainQuota - expectedRemainQuota
+	err = applyQuotaChange(func(tx *gorm.DB) error {
+		if delta != 0 {
+			result := tx.Model(&Token{}).Where("id = ? AND remain_quota = ?", token.Id, expectedRemainQuota).
+				Update("remain_quota", token.RemainQuota)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrQuotaConflict
+			}
+		}
+		return tx.Model(token).Select(tokenEditableColumns).Updates(token).Error
+	}, tokenQuotaLedger(token.Id, QuotaLedgerKindAdjustment, delta, "编辑令牌"))
+	if err != nil {
+		return err
+	}
+	return DB.Model(&Token{}).Where("id = ?", token.Id).Select("remain_quota").Find(&token.RemainQuota).Error
+}
+
 func (token *Token) SelectUpdate() (err error) {
 	defer func() {
 		if shouldUpdateRedis(true, err) {
@@ -279,15 +339,18 @@ func IncreaseTokenQuota(id int, key string, quota int) (err error) {
 			}
 		})
 	}
+	entry := tokenQuotaLedger(id, QuotaLedgerKindRefund, quota, "")
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, quota)
+		addNewQuotaRecord(BatchUpdateTypeTokenQuota, id, quota, entry)
 		return nil
 	}
-	return increaseTokenQuota(id, quota)
+	return applyQuotaChange(func(tx *gorm.DB) error {
+		return increaseTokenQuota(tx, id, quota)
+	}, entry)
 }
 
-func increaseTokenQuota(id int, quota int) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
+func increaseTokenQuota(tx *gorm.DB, id int, quota int) (err error) {
+	err = tx.Model(&Token{}).Where("id = ?", id).Updates(
 		map[string]interface{}{
 			"remain_quota":  gorm.Expr("remain_quota + ?", quota),
 			"used_quota":    gorm.Expr("used_quota - ?", quota),
@@ -309,15 +372,18 @@ func DecreaseTokenQuota(id int, key string, quota int) (err error) {
 			}
 		})
 	}
+	entry := tokenQuotaLedger(id, QuotaLedgerKindConsume, -quota, "")
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, -quota)
+		addNewQuotaRecord(BatchUpdateTypeTokenQuota, id, -quota, entry)
 		return nil
 	}
-	return decreaseTokenQuota(id, quota)
+	return applyQuotaChange(func(tx *gorm.DB) error {
+		return decreaseTokenQuota(tx, id, quota)
+	}, entry)
 }
 
-func decreaseTokenQuota(id int, quota int) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
+func decreaseTokenQuota(tx *gorm.DB, id int, quota int) (err error) {
+	err = tx.Model(&Token{}).Where("id = ?", id).Updates(
 		map[string]interface{}{
 			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
 			"used_quota":    gorm.Expr("used_quota + ?", quota),
@@ -367,3 +433,23 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 
 	return len(tokens), nil
 }
+
+// GetDemoSandboxUserId returns the owner of the demo sandbox token, 0 when no sandbox token is configured.
+func GetDemoSandboxUserId() int {
+	tokenId := operation_setting.GetDemoSetting().TokenId
+	if tokenId == 0 {
+		return 0
+	}
+	var userId int
+	if err := DB.Model(&Token{}).Select("user_id").Where("id = ?", tokenId).Scan(&userId).Error; err != nil {
+		return 0
+	}
+	return userId
+}
+
+// GetUserTokensByName returns the tokens of the user with exactly the given name.
+func GetUserTokensByName(userId int, name string) ([]*Token, error) {
+	var tokens []*Token
+	err := DB.Where("user_id = ? AND name = ?", userId, name).Order("id asc").Find(&tokens).Error
+	return tokens, err
+}
@@ -0,0 +1,277 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// 令牌访问范围
+//
+// 除模型白名单与 IP 白名单外，令牌还可以限制可访问的模型类别、接口类型，以及生效时间和每周的可用时段。
+// 模型类别与模型白名单一样只在开启模型限制时生效，两者取并集。可用时段按服务器本地时间计算。
+
+const (
+	TokenEndpointChat        = "chat"        // /v1/chat/completions、/v1/completions
+	TokenEndpointResponses   = "responses"   // /v1/responses
+	TokenEndpointMessages    = "messages"    // Claude /v1/messages
+	TokenEndpointGemini      = "gemini"      // Gemini generateContent 等原生接口
+	TokenEndpointEmbeddings  = "embeddings"  // 嵌入
+	TokenEndpointImages      = "images"      // 图像生成与编辑
+	TokenEndpointAudio       = "audio"       // 语音合成、转写与翻译
+	TokenEndpointRerank      = "rerank"      // 重排序
+	TokenEndpointModerations = "moderations" // 内容审核
+	TokenEndpointRealtime    = "realtime"    // 实时语音
+	TokenEndpointVideo       = "video"       // 视频生成
+	TokenEndpointTasks       = "tasks"       // Midjourney、Suno 等异步任务
+	TokenEndpointOther       = "other"       // 其他接口
+)
+
+var TokenEndpoints = []string{
+	TokenEndpointChat, TokenEndpointResponses, TokenEndpointMessages, TokenEndpointGemini, TokenEndpointEmbeddings,
+	TokenEndpointImages, TokenEndpointAudio, TokenEndpointRerank, TokenEndpointModerations, TokenEndpointRealtime,
+	TokenEndpointVideo, TokenEndpointTasks, TokenEndpointOther,
+}
+
+// tokenEndpointPrefixes 按顺序匹配，较长的前缀在前
+var tokenEndpointPrefixes = []struct {
+	prefix   string
+	endpoint string
+}{
+	{"/v1/chat/completions", TokenEndpointChat},
+	{"/v1/completions", TokenEndpointChat},
+	{"/v1/responses", TokenEndpointResponses},
+	{"/v1/messages", TokenEndpointMessages},
+	{"/v1/embeddings", TokenEndpointEmbeddings},
+	{"/v1/engines/", TokenEndpointEmbeddings},
+	{"/v1/images/", TokenEndpointImages},
+	{"/v1/edits", TokenEndpointImages},
+	{"/v1/audio/", TokenEndpointAudio},
+	{"/v1/rerank", TokenEndpointRerank},
+	{"/v1/moderations", TokenEndpointModerations},
+	{"/v1/realtime", TokenEndpointRealtime},
+	{"/v1/video", TokenEndpointVideo},
+	{"/kling/", TokenEndpointVideo},
+	{"/jimeng/", TokenEndpointVideo},
+	{"/mj/", TokenEndpointTasks},
+	{"/suno/", TokenEndpointTasks},
+}
+
+// TokenEndpointOf returns the endpoint type of the request, empty for requests every token may send such as
+// listing models or querying the billing dashboard.
+func TokenEndpointOf(method string, path string) string {
+	if method == "GET" && (strings.HasPrefix(path, "/v1/models") || strings.HasPrefix(path, "/v1beta/models") ||
+		strings.HasPrefix(path, "/v1beta/openai/models")) {
+		return ""
+	}
+	if strings.HasPrefix(path, "/dashboard/") || strings.HasPrefix(path, "/v1/dashboard/") || strings.HasPrefix(path, "/api/usage/") {
+		return ""
+	}
+	if strings.HasPrefix(path, "/v1beta/models/") || strings.HasPrefix(path, "/v1/models/") {
+		if strings.Contains(path, "embedContent") || strings.Contains(path, "batchEmbedContents") {
+			return TokenEndpointEmbeddings
+		}
+		return TokenEndpointGemini
+	}
+	for _, p := range tokenEndpointPrefixes {
+		if strings.HasPrefix(path, p.prefix) {
+			return p.endpoint
+		}
+	}
+	// /mj-fast/mj 等带模式前缀的 Midjourney 接口
+	if strings.Contains(path, "/mj/") {
+		return TokenEndpointTasks
+	}
+	return TokenEndpointOther
+}
+
+func splitTokenList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (token *Token) GetAllowEndpoints() []string {
+	return splitTokenList(token.AllowEndpoints)
+}
+
+func (token *Token) GetModelClasses() []string {
+	return splitTokenList(token.ModelClasses)
+}
+
+// AllowsModel reports whether the model limits of the token allow the model, by name or by model class.
+func (token *Token) AllowsModel(modelName string) bool {
+	if !token.ModelLimitsEnabled {
+		return true
+	}
+	if token.GetModelLimitsMap()[ratio_setting.FormatMatchingModelName(modelName)] {
+		return true
+	}
+	class := operation_setting.GetModelClass(modelName)
+	return class != "" && slices.Contains(token.GetModelClasses(), class)
+}
+
+// TokenAccessWindow 每周的一个可用时段，End 小于 Start 时跨越午夜，归属于开始的那一天
+type TokenAccessWindow struct {
+	Days  [7]bool // 以 time.Weekday 为下标
+	Start int     // 从零点开始的分钟数
+	End   int
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseTokenAccessWindows parses windows like "mon-fri 09:00-18:00; sat 10:00-12:00", separated by ";" or
+// new lines. Without days a window applies to every day.
+func ParseTokenAccessWindows(s string) ([]TokenAccessWindow, error) {
+	windows := make([]TokenAccessWindow, 0)
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Fields(strings.ToLower(entry))
+		var window TokenAccessWindow
+		timeRange := fields[len(fields)-1]
+		switch len(fields) {
+		case 1:
+			for i := range window.Days {
+				window.Days[i] = true
+			}
+		case 2:
+			if err := parseWindowDays(fields[0], &window.Days); err != nil {
+				return nil, fmt.Errorf("可用时段 %q 格式错误：%s", entry, err.Error())
+			}
+		default:
+			return nil, fmt.Errorf("可用时段 %q 格式错误，应为 \"mon-fri 09:00-18:00\"", entry)
+		}
+		start, end, ok := strings.Cut(timeRange, "-")
+		if !ok {
+			return nil, fmt.Errorf("可用时段 %q 缺少结束时间", entry)
+		}
+		var err error
+		if window.Start, err = parseWindowMinute(start); err != nil {
+			return nil, fmt.Errorf("可用时段 %q 格式错误：%s", entry, err.Error())
+		}
+		if window.End, err = parseWindowMinute(end); err != nil {
+			return nil, fmt.Errorf("可用时段 %q 格式错误：%s", entry, err.Error())
+		}
+		if window.Start == window.End {
+			return nil, fmt.Errorf("可用时段 %q 的开始与结束时间相同", entry)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func parseWindowDays(s string, days *[7]bool) error {
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, ok := weekdayNames[from]
+		if !ok {
+			return fmt.Errorf("未知的星期 %s", from)
+		}
+		end := start
+		if isRange {
+			if end, ok = weekdayNames[to]; !ok {
+				return fmt.Errorf("未知的星期 %s", to)
+			}
+		}
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseWindowMinute(s string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(s, "%d:%d", &hour, &minute); err != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("无效的时间 %s", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// Contains reports whether t falls into the window.
+func (w TokenAccessWindow) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.Start < w.End {
+		return w.Days[t.Weekday()] && minute >= w.Start && minute < w.End
+	}
+	// 跨越午夜：当天开始之后，或前一天开始的时段尚未结束
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.Days[t.Weekday()] && minute >= w.Start) || (w.Days[yesterday] && minute < w.End)
+}
+
+// CheckAccessTime returns an error when the token can not be used at t.
+func (token *Token) CheckAccessTime(t time.Time) error {
+	if token.ActiveFrom > 0 && t.Unix() < token.ActiveFrom {
+		return fmt.Errorf("该令牌尚未生效，生效时间为 %s", time.Unix(token.ActiveFrom, 0).Format("2006-01-02 15:04:05"))
+	}
+	if strings.TrimSpace(token.AccessWindows) == "" {
+		return nil
+	}
+	windows, err := ParseTokenAccessWindows(token.AccessWindows)
+	if err != nil || len(windows) == 0 {
+		return nil
+	}
+	for _, window := range windows {
+		if window.Contains(t) {
+			return nil
+		}
+	}
+	return fmt.Errorf("当前不在该令牌的可用时段内（%s）", token.AccessWindows)
+}
+
+// ValidateTokenScopes checks the access restrictions of a token before it is saved.
+func ValidateTokenScopes(token *Token) error {
+	for _, endpoint := range token.GetAllowEndpoints() {
+		found := false
+		for _, known := range TokenEndpoints {
+			if endpoint == known {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("未知的接口类型 %s，可选值：%s", endpoint, strings.Join(TokenEndpoints, ", "))
+		}
+	}
+	classes := operation_setting.GetModelClassSetting().Classes
+	for _, class := range token.GetModelClasses() {
+		if _, ok := classes[class]; !ok {
+			return fmt.Errorf("模型类别 %s 不存在", class)
+		}
+	}
+	for _, ip := range token.GetIpLimits() {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return fmt.Errorf("无效的 IP 或 CIDR：%s", ip)
+			}
+		}
+	}
+	if _, err := ParseTokenAccessWindows(token.AccessWindows); err != nil {
+		return err
+	}
+	if token.ActiveFrom < 0 {
+		return fmt.Errorf("无效的生效时间")
+	}
+	if token.ActiveFrom > 0 && token.ExpiredTime != -1 && token.ExpiredTime <= token.ActiveFrom {
+		return fmt.Errorf("过期时间必须晚于生效时间")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TokenSession 令牌按客户端特征（IP 段、UA 类型、国家）聚合的使用记录，用于发现泄露的令牌
+type TokenSession struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	TokenId   int    `json:"token_id" gorm:"not null;uniqueIndex:idx_token_session_client"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	IpPrefix  string `json:"ip_prefix" gorm:"type:varchar(64);not null;uniqueIndex:idx_token_session_client"`
+	UaFamily  string `json:"ua_family" gorm:"type:varchar(32);not null;uniqueIndex:idx_token_session_client"`
+	Country   string `json:"country" gorm:"type:varchar(8);not null;uniqueIndex:idx_token_session_client"`
+	FirstSeen int64  `json:"first_seen" gorm:"bigint"`
+	LastSeen  int64  `json:"last_seen" gorm:"bigint;index"`
+	Requests  int64  `json:"requests" gorm:"bigint;default:0"`
+}
+
+// UpsertTokenSession adds the requests of a client to its record, creating it on first sight.
+func UpsertTokenSession(session *TokenSession) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "token_id"}, {Name: "ip_prefix"}, {Name: "ua_family"}, {Name: "country"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"requests":  gorm.Expr("requests + ?", session.Requests),
+			"last_seen": session.LastSeen,
+		}),
+	}).Create(session).Error
+}
+
+// GetTokenSessions returns the client records of the token seen since the given time, the latest first.
+func GetTokenSessions(tokenId int, since int64) (sessions []*TokenSession, err error) {
+	err = DB.Where("token_id = ? AND last_seen >= ?", tokenId, since).Order("last_seen desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// GetActiveSessionTokenIds returns the tokens used since the given time, limited to the user when userId is not 0.
+func GetActiveSessionTokenIds(userId int, since int64) (tokenIds []int, err error) {
+	tx := DB.Model(&TokenSession{}).Where("last_seen >= ?", since)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err = tx.Distinct().Pluck("token_id", &tokenIds).Error
+	return tokenIds, err
+}
+
+// GetTokenSessionsByTokenIds returns every client record of the tokens.
+func GetTokenSessionsByTokenIds(tokenIds []int) (sessions []*TokenSession, err error) {
+	if len(tokenIds) == 0 {
+		return []*TokenSession{}, nil
+	}
+	err = DB.Where("token_id IN ?", tokenIds).Find(&sessions).Error
+	return sessions, err
+}
+
+// DeleteTokenSessionsBefore removes the client records not seen since the cutoff.
+func DeleteTokenSessionsBefore(cutoff int64) (int64, error) {
+	result := DB.Where("last_seen < ?", cutoff).Delete(&TokenSession{})
+	return result.RowsAffected, result.Error
+}
+
+// DisableTokenById disables the token, used when it is suspended automatically.
+func DisableTokenById(id int) error {
+	token, err := GetTokenById(id)
+	if err != nil {
+		return err
+	}
+	token.Status = common.TokenStatusDisabled
+	return token.SelectUpdate()
+}
@@ -91,7 +91,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 			return err
 		}
 
-		return nil
+		return insertQuotaLedger(tx, userQuotaLedger(topUp.UserId, QuotaLedgerKindTopUp, int(quota), "订单 "+topUp.TradeNo))
 	})
 
 	if err != nil {
@@ -291,6 +291,9 @@ func ManualCompleteTopUp(tradeNo string) error {
 		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
 			return err
 		}
+		if err := insertQuotaLedger(tx, userQuotaLedger(topUp.UserId, QuotaLedgerKindTopUp, quotaToAdd, "管理员补单 "+tradeNo)); err != nil {
+			return err
+		}
 
 		userId = topUp.UserId
 		payMoney = topUp.Money
@@ -363,7 +366,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return err
 		}
 
-		return nil
+		return insertQuotaLedger(tx, userQuotaLedger(topUp.UserId, QuotaLedgerKindTopUp, int(quota), "订单 "+topUp.TradeNo))
 	})
 
 	if err != nil {
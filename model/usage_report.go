@@ -0,0 +1,159 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageReportRollup 按天（服务器时区）汇总的消费，比用量汇总多出令牌和分组维度，供用量报告和账单导出使用。
+// 与用量汇总在同一个事务中从日志增量聚合，只统计消费日志，启用之前的日志不会补算
+type UsageReportRollup struct {
+	Id               int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	BucketStart      int64  `json:"bucket_start" gorm:"bigint;not null;uniqueIndex:idx_usage_report_rollup_key,priority:1"`
+	UserId           int    `json:"user_id" gorm:"not null;uniqueIndex:idx_usage_report_rollup_key,priority:2"`
+	TokenId          int    `json:"token_id" gorm:"not null;uniqueIndex:idx_usage_report_rollup_key,priority:3"`
+	UsingGroup       string `json:"group" gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_usage_report_rollup_key,priority:4"`
+	ModelName        string `json:"model_name" gorm:"type:varchar(128);not null;default:'';uniqueIndex:idx_usage_report_rollup_key,priority:5"`
+	Username         string `json:"username" gorm:"type:varchar(64);default:''"`
+	TokenName        string `json:"token_name" gorm:"type:varchar(128);default:''"`
+	RequestCount     int64  `json:"request_count" gorm:"bigint;default:0"`
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"bigint;default:0"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"bigint;default:0"`
+	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
+}
+
+func (UsageReportRollup) TableName() string {
+	return "usage_report_rollups"
+}
+
+func upsertUsageReportRollups(tx *gorm.DB, logs []usageRollupLog) error {
+	rollups := make(map[string]*UsageReportRollup)
+	for _, log := range logs {
+		if log.Type != LogTypeConsume {
+			continue
+		}
+		t := time.Unix(log.CreatedAt, 0)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Unix()
+		key := fmt.Sprintf("%d-%d-%d-%s-%s", day, log.UserId, log.TokenId, log.UsingGroup, log.ModelName)
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = &UsageReportRollup{
+				BucketStart: day,
+				UserId:      log.UserId,
+				TokenId:     log.TokenId,
+				UsingGroup:  log.UsingGroup,
+				ModelName:   log.ModelName,
+				Username:    log.Username,
+				TokenName:   log.TokenName,
+			}
+			rollups[key] = rollup
+		}
+		rollup.RequestCount++
+		rollup.PromptTokens += int64(log.PromptTokens)
+		rollup.CompletionTokens += int64(log.CompletionTokens)
+		rollup.Quota += int64(log.Quota)
+	}
+	for _, rollup := range rollups {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "bucket_start"}, {Name: "user_id"}, {Name: "token_id"}, {Name: "using_group"}, {Name: "model_name"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"username":          rollup.Username,
+				"token_name":        rollup.TokenName,
+				"request_count":     gorm.Expr("request_count + ?", rollup.RequestCount),
+				"prompt_tokens":     gorm.Expr("prompt_tokens + ?", rollup.PromptTokens),
+				"completion_tokens": gorm.Expr("completion_tokens + ?", rollup.CompletionTokens),
+				"quota":             gorm.Expr("quota + ?", rollup.Quota),
+			}),
+		}).Create(rollup).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usageReportDimensions 用量报告可以分组的维度
+var usageReportDimensions = map[string]usageRollupDimension{
+	"user":  {group: "user_id", selects: []string{"user_id", "MAX(username) AS username"}},
+	"token": {group: "token_id", selects: []string{"token_id", "MAX(token_name) AS token_name"}},
+	"group": {group: "using_group", selects: []string{"using_group"}},
+	"model": {group: "model_name", selects: []string{"model_name"}},
+}
+
+type UsageReportQuery struct {
+	StartTime int64
+	EndTime   int64
+	GroupBy   []string
+	UserId    int
+	TokenId   int
+	Group     string
+}
+
+type UsageReportRow struct {
+	UserId           int    `json:"user_id,omitempty"`
+	Username         string `json:"username,omitempty"`
+	TokenId          int    `json:"token_id,omitempty"`
+	TokenName        string `json:"token_name,omitempty"`
+	UsingGroup       string `json:"group,omitempty"`
+	ModelName        string `json:"model_name,omitempty"`
+	RequestCount     int64  `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+}
+
+// QueryUsageReportRollups sums the daily report rollups of the days starting in [StartTime, EndTime) grouped
+// by the requested dimensions, in the order of the dimensions.
+func QueryUsageReportRollups(query UsageReportQuery) ([]*UsageReportRow, error) {
+	var columns []string
+	var selects []string
+	for _, name := range query.GroupBy {
+		dimension, ok := usageReportDimensions[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported group by dimension %q", name)
+		}
+		if common.StringsContains(columns, dimension.group) {
+			continue
+		}
+		columns = append(columns, dimension.group)
+		selects = append(selects, dimension.selects...)
+	}
+	selects = append(selects,
+		"SUM(request_count) AS request_count",
+		"SUM(prompt_tokens) AS prompt_tokens",
+		"SUM(completion_tokens) AS completion_tokens",
+		"SUM(quota) AS quota",
+	)
+
+	tx := LOG_DB.Model(&UsageReportRollup{}).Select(strings.Join(selects, ", ")).
+		Where("bucket_start >= ? AND bucket_start < ?", query.StartTime, query.EndTime)
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.TokenId != 0 {
+		tx = tx.Where("token_id = ?", query.TokenId)
+	}
+	if query.Group != "" {
+		tx = tx.Where("using_group = ?", query.Group)
+	}
+	if len(columns) > 0 {
+		tx = tx.Group(strings.Join(columns, ", ")).Order(strings.Join(columns, ", "))
+	}
+	var rows []*UsageReportRow
+	err := tx.Scan(&rows).Error
+	return rows, err
+}
+
+// GetUsageReportUserIds lists the users that consumed in the days starting in [startTime, endTime).
+func GetUsageReportUserIds(startTime int64, endTime int64) (userIds []int, err error) {
+	err = LOG_DB.Model(&UsageReportRollup{}).
+		Where("bucket_start >= ? AND bucket_start < ?", startTime, endTime).
+		Distinct("user_id").Order("user_id").Pluck("user_id", &userIds).Error
+	return userIds, err
+}
@@ -0,0 +1,252 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	UsageRollupHour = "hour"
+	UsageRollupDay  = "day"
+)
+
+// usageRollupCursorName 聚合进度游标的名称
+const usageRollupCursorName = "usage_rollup"
+
+// UsageRollup 按小时和按天（服务器时区）汇总的用量，由后台任务从日志增量聚合，数据看板直接查询汇总表而不扫描日志
+type UsageRollup struct {
+	Id               int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Granularity      string `json:"granularity" gorm:"type:varchar(8);not null;uniqueIndex:idx_usage_rollup_key,priority:1;index:idx_usage_rollup_bucket,priority:1"`
+	BucketStart      int64  `json:"bucket_start" gorm:"bigint;not null;uniqueIndex:idx_usage_rollup_key,priority:2;index:idx_usage_rollup_bucket,priority:2"`
+	UserId           int    `json:"user_id" gorm:"not null;uniqueIndex:idx_usage_rollup_key,priority:3"`
+	ChannelId        int    `json:"channel_id" gorm:"not null;uniqueIndex:idx_usage_rollup_key,priority:4"`
+	ModelName        string `json:"model_name" gorm:"type:varchar(128);not null;default:'';uniqueIndex:idx_usage_rollup_key,priority:5"`
+	Username         string `json:"username" gorm:"type:varchar(64);default:''"`
+	RequestCount     int64  `json:"request_count" gorm:"bigint;default:0"`
+	ErrorCount       int64  `json:"error_count" gorm:"bigint;default:0"`
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"bigint;default:0"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"bigint;default:0"`
+	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
+	UseTime          int64  `json:"use_time" gorm:"bigint;default:0"` // 请求耗时之和（秒），用于计算平均耗时
+}
+
+func (UsageRollup) TableName() string {
+	return "usage_rollups"
+}
+
+// UsageRollupCursor 已聚合到的最大日志 ID
+type UsageRollupCursor struct {
+	Name      string `json:"name" gorm:"type:varchar(32);primaryKey"`
+	LastLogId int    `json:"last_log_id"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func (UsageRollupCursor) TableName() string {
+	return "usage_rollup_cursors"
+}
+
+type usageRollupLog struct {
+	Id               int
+	UserId           int
+	Username         string
+	ChannelId        int
+	ModelName        string
+	CreatedAt        int64
+	Type             int
+	Quota            int
+	PromptTokens     int
+	CompletionTokens int
+	UseTime          int
+	TokenId          int
+	TokenName        string
+	UsingGroup       string
+}
+
+// AggregateUsageRollups folds the next batch of consume and error logs into the hourly and daily rollups and
+// advances the cursor in the same transaction. Logs newer than settleSeconds are left for a later run, so rows
+// committed slightly out of id order are not skipped. It returns the number of logs aggregated.
+func AggregateUsageRollups(batchSize int, settleSeconds int64) (int, error) {
+	var cursor UsageRollupCursor
+	if err := LOG_DB.Where("name = ?", usageRollupCursorName).Limit(1).Find(&cursor).Error; err != nil {
+		return 0, err
+	}
+	var logs []usageRollupLog
+	err := LOG_DB.Model(&Log{}).
+		Select("id, user_id, username, channel_id, model_name, created_at, type, quota, prompt_tokens, completion_tokens, use_time, "+
+			"token_id, token_name, "+logGroupCol+" AS using_group").
+		Where("id > ? AND created_at <= ? AND type IN ?", cursor.LastLogId, common.GetTimestamp()-settleSeconds, []int{LogTypeConsume, LogTypeError}).
+		Order("id asc").Limit(batchSize).Find(&logs).Error
+	if err != nil || len(logs) == 0 {
+		return 0, err
+	}
+
+	rollups := make(map[string]*UsageRollup)
+	for _, log := range logs {
+		hour := log.CreatedAt - log.CreatedAt%3600
+		t := time.Unix(log.CreatedAt, 0)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Unix()
+		for _, bucket := range []struct {
+			granularity string
+			start       int64
+		}{{UsageRollupHour, hour}, {UsageRollupDay, day}} {
+			key := fmt.Sprintf("%s-%d-%d-%d-%s", bucket.granularity, bucket.start, log.UserId, log.ChannelId, log.ModelName)
+			rollup, ok := rollups[key]
+			if !ok {
+				rollup = &UsageRollup{
+					Granularity: bucket.granularity,
+					BucketStart: bucket.start,
+					UserId:      log.UserId,
+					ChannelId:   log.ChannelId,
+					ModelName:   log.ModelName,
+					Username:    log.Username,
+				}
+				rollups[key] = rollup
+			}
+			rollup.RequestCount++
+			if log.Type == LogTypeError {
+				rollup.ErrorCount++
+			}
+			rollup.PromptTokens += int64(log.PromptTokens)
+			rollup.CompletionTokens += int64(log.CompletionTokens)
+			rollup.Quota += int64(log.Quota)
+			rollup.UseTime += int64(log.UseTime)
+		}
+	}
+
+	err = LOG_DB.Transaction(func(tx *gorm.DB) error {
+		for _, rollup := range rollups {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "granularity"}, {Name: "bucket_start"}, {Name: "user_id"}, {Name: "channel_id"}, {Name: "model_name"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"username":          rollup.Username,
+					"request_count":     gorm.Expr("request_count + ?", rollup.RequestCount),
+					"error_count":       gorm.Expr("error_count + ?", rollup.ErrorCount),
+					"prompt_tokens":     gorm.Expr("prompt_tokens + ?", rollup.PromptTokens),
+					"completion_tokens": gorm.Expr("completion_tokens + ?", rollup.CompletionTokens),
+					"quota":             gorm.Expr("quota + ?", rollup.Quota),
+					"use_time":          gorm.Expr("use_time + ?", rollup.UseTime),
+				}),
+			}).Create(rollup).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := upsertUsageReportRollups(tx, logs); err != nil {
+			return err
+		}
+		cursor.Name = usageRollupCursorName
+		cursor.LastLogId = logs[len(logs)-1].Id
+		cursor.UpdatedAt = common.GetTimestamp()
+		return tx.Save(&cursor).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(logs), nil
+}
+
+// DeleteUsageRollupsBefore 删除早于 before 的小时汇总，按天的汇总一直保留
+func DeleteUsageRollupsBefore(before int64) (int64, error) {
+	result := LOG_DB.Where("granularity = ? AND bucket_start < ?", UsageRollupHour, before).Delete(&UsageRollup{})
+	return result.RowsAffected, result.Error
+}
+
+type usageRollupDimension struct {
+	group   string
+	selects []string
+}
+
+// usageRollupDimensions 可以分组的维度，用户名只用于展示，同一用户改名后取其中一个
+var usageRollupDimensions = map[string]usageRollupDimension{
+	"time":    {group: "bucket_start", selects: []string{"bucket_start"}},
+	"user":    {group: "user_id", selects: []string{"user_id", "MAX(username) AS username"}},
+	"channel": {group: "channel_id", selects: []string{"channel_id"}},
+	"model":   {group: "model_name", selects: []string{"model_name"}},
+}
+
+type UsageRollupQuery struct {
+	Granularity string
+	StartTime   int64
+	EndTime     int64
+	GroupBy     []string
+	UserId      int
+	ChannelId   int
+	ModelName   string
+}
+
+type UsageRollupRow struct {
+	BucketStart      int64   `json:"bucket_start,omitempty"`
+	UserId           int     `json:"user_id,omitempty"`
+	Username         string  `json:"username,omitempty"`
+	ChannelId        int     `json:"channel_id,omitempty"`
+	ModelName        string  `json:"model_name,omitempty"`
+	RequestCount     int64   `json:"request_count"`
+	ErrorCount       int64   `json:"error_count"`
+	ErrorRate        float64 `json:"error_rate" gorm:"-"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Quota            int64   `json:"quota"`
+	UseTime          int64   `json:"use_time"`
+}
+
+// QueryUsageRollups sums the rollups of the time range [StartTime, EndTime) grouped by the requested
+// dimensions, rows are ordered by time when grouped by it and by quota otherwise.
+func QueryUsageRollups(query UsageRollupQuery) ([]*UsageRollupRow, error) {
+	var columns []string
+	var selects []string
+	for _, name := range query.GroupBy {
+		dimension, ok := usageRollupDimensions[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported group by dimension %q", name)
+		}
+		if common.StringsContains(columns, dimension.group) {
+			continue
+		}
+		columns = append(columns, dimension.group)
+		selects = append(selects, dimension.selects...)
+	}
+	selects = append(selects,
+		"SUM(request_count) AS request_count",
+		"SUM(error_count) AS error_count",
+		"SUM(prompt_tokens) AS prompt_tokens",
+		"SUM(completion_tokens) AS completion_tokens",
+		"SUM(quota) AS quota",
+		"SUM(use_time) AS use_time",
+	)
+
+	tx := LOG_DB.Model(&UsageRollup{}).Select(strings.Join(selects, ", ")).
+		Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", query.Granularity, query.StartTime, query.EndTime)
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", query.ChannelId)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name = ?", query.ModelName)
+	}
+	if len(columns) > 0 {
+		tx = tx.Group(strings.Join(columns, ", "))
+	}
+	if common.StringsContains(columns, "bucket_start") {
+		tx = tx.Order("bucket_start asc")
+	} else {
+		tx = tx.Order("quota desc")
+	}
+	var rows []*UsageRollupRow
+	if err := tx.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.RequestCount > 0 {
+			row.ErrorRate = float64(row.ErrorCount) / float64(row.RequestCount)
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,33 @@
+package model
+
+// ModelLogCount 按模型统计的日志条数
+type ModelLogCount struct {
+	ModelName string `json:"model_name"`
+	Count     int64  `json:"count"`
+}
+
+// ChannelLogCount 按渠道统计的日志条数
+type ChannelLogCount struct {
+	ChannelId int   `json:"channel_id"`
+	Count     int64 `json:"count"`
+}
+
+// CountLogsByModel counts the logs of logType created in [start, end) per model.
+func CountLogsByModel(logType int, start int64, end int64) (counts []ModelLogCount, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("model_name, count(*) as count").
+		Where("type = ? AND created_at >= ? AND created_at < ?", logType, start, end).
+		Group("model_name").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// CountLogsByChannel counts the logs of logType created in [start, end) per channel.
+func CountLogsByChannel(logType int, start int64, end int64) (counts []ChannelLogCount, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("channel_id, count(*) as count").
+		Where("type = ? AND created_at >= ? AND created_at < ?", logType, start, end).
+		Group("channel_id").
+		Scan(&counts).Error
+	return counts, err
+}
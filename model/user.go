@@ -10,6 +10,8 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
@@ -47,6 +49,14 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	// SessionsRevokedAt 之前登录的会话全部失效，DeletionRequestedAt 为用户申请注销账户的时间，0 表示未申请
+	SessionsRevokedAt   int64 `json:"-" gorm:"bigint;default:0"`
+	DeletionRequestedAt int64 `json:"deletion_requested_at" gorm:"bigint;default:0;index"`
+	// AdminRole 管理员的权限角色，为空时拥有全部管理权限
+	AdminRole string `json:"admin_role" gorm:"type:varchar(64);default:''"`
+	// LastActiveAt 最近一次登录或调用的时间，DormantAt 为被标记为不活跃用户的时间，0 表示未标记
+	LastActiveAt int64 `json:"last_active_at" gorm:"bigint;default:0;index"`
+	DormantAt    int64 `json:"dormant_at" gorm:"bigint;default:0"`
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -58,6 +68,9 @@ func (user *User) ToBaseUser() *UserBase {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+
+		SessionsRevokedAt: user.SessionsRevokedAt,
+		AdminRole:         user.AdminRole,
 	}
 	return cache
 }
@@ -220,6 +233,12 @@ func GetAllUsers(pageInfo *common.PageInfo) (users []*User, total int64, err err
 }
 
 func SearchUsers(keyword string, group string, startIdx int, num int) ([]*User, int64, error) {
+	return SearchUsersBelowRole(keyword, group, 0, startIdx, num)
+}
+
+// SearchUsersBelowRole searches the users like SearchUsers, only those with a role lower than maxRole when it is
+// not 0, so that admins do not see users of the same or a higher role.
+func SearchUsersBelowRole(keyword string, group string, maxRole int, startIdx int, num int) ([]*User, int64, error) {
 	var users []*User
 	var total int64
 	var err error
@@ -237,6 +256,9 @@ func SearchUsers(keyword string, group string, startIdx int, num int) ([]*User,
 
 	// 构建基础查询
 	query := tx.Unscoped().Model(&User{})
+	if maxRole != 0 {
+		query = query.Where("role < ?", maxRole)
+	}
 
 	// 构建搜索条件
 	likeCondition := "username LIKE ? OR email LIKE ? OR display_name LIKE ?"
@@ -326,14 +348,12 @@ func HardDeleteUserById(id int) error {
 }
 
 func inviteUser(inviterId int) (err error) {
-	user, err := GetUserById(inviterId, true)
-	if err != nil {
-		return err
-	}
-	user.AffCount++
-	user.AffQuota += common.QuotaForInviter
-	user.AffHistoryQuota += common.QuotaForInviter
-	return DB.Save(user).Error
+	// 只增量更新邀请字段，整行保存会覆盖期间发生的额度变动
+	return DB.Model(&User{}).Where("id = ?", inviterId).Updates(map[string]interface{}{
+		"aff_count":   gorm.Expr("aff_count + 1"),
+		"aff_quota":   gorm.Expr("aff_quota + ?", common.QuotaForInviter),
+		"aff_history": gorm.Expr("aff_history + ?", common.QuotaForInviter),
+	}).Error
 }
 
 func (user *User) TransferAffQuotaToQuota(quota int) error {
@@ -360,19 +380,34 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 		return errors.New("邀请额度不足！")
 	}
 
-	// 更新用户额度
-	user.AffQuota -= quota
-	user.Quota += quota
-
-	// 保存用户状态
-	if err := tx.Save(user).Error; err != nil {
+	// 更新用户额度，按增量写入，避免覆盖并发的扣费
+	err = tx.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+		"aff_quota": gorm.Expr("aff_quota - ?", quota),
+		"quota":     gorm.Expr("quota + ?", quota),
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err = insertQuotaLedger(tx, userQuotaLedger(user.Id, QuotaLedgerKindGrant, quota, "邀请额度转入")); err != nil {
 		return err
 	}
+	user.AffQuota -= quota
+	user.Quota += quota
 
 	// 提交事务
 	return tx.Commit().Error
 }
 
+// InsertRoot creates the root user of a new installation, its quota is recorded as the opening balance.
+func (user *User) InsertRoot() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return insertQuotaLedger(tx, userQuotaLedger(user.Id, QuotaLedgerKindOpening, user.Quota, ""))
+	})
+}
+
 func (user *User) Insert(inviterId int) error {
 	var err error
 	if user.Password != "" {
@@ -382,8 +417,15 @@ func (user *User) Insert(inviterId int) error {
 		}
 	}
 	user.Quota = common.QuotaForNewUser
+	// 未指定分组时按邮箱域名分配默认分组
+	if user.Group == "" && user.Email != "" {
+		if group := system_setting.GetEmailDomainGroup(user.Email); group != "" && ratio_setting.ContainsGroupRatio(group) {
+			user.Group = group
+		}
+	}
 	//user.SetAccessToken(common.GetUUID())
 	user.AffCode = common.GetRandomString(4)
+	user.LastActiveAt = common.GetTimestamp()
 
 	// 初始化用户设置，包括默认的边栏配置
 	if user.Setting == "" {
@@ -392,9 +434,14 @@ func (user *User) Insert(inviterId int) error {
 		user.SetSetting(defaultSetting)
 	}
 
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return insertQuotaLedger(tx, userQuotaLedger(user.Id, QuotaLedgerKindGrant, user.Quota, "新用户注册赠送"))
+	})
+	if err != nil {
+		return err
 	}
 
 	// 用户创建成功后，根据角色初始化边栏配置
@@ -417,7 +464,7 @@ func (user *User) Insert(inviterId int) error {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = GrantUserQuota(user.Id, common.QuotaForInvitee, QuotaLedgerKindGrant, "使用邀请码赠送")
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -439,7 +486,8 @@ func (user *User) Update(updatePassword bool) error {
 	}
 	newUser := *user
 	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(newUser).Error; err != nil {
+	// 额度相关字段只通过增量更新和流水修改，这里整行写入会覆盖期间发生的变动
+	if err = DB.Model(user).Omit(quotaColumns...).Updates(newUser).Error; err != nil {
 		return err
 	}
 
@@ -447,7 +495,9 @@ func (user *User) Update(updatePassword bool) error {
 	return updateUserCache(*user)
 }
 
-func (user *User) Edit(updatePassword bool) error {
+// Edit saves the fields an admin can edit. The quota is set like Token.UpdateFrom: only while the stored quota
+// still equals expectedQuota, the value the admin read, otherwise ErrQuotaConflict is returned.
+func (user *User) Edit(updatePassword bool, expectedQuota int) error {
 	var err error
 	if updatePassword {
 		user.Password, err = common.Password2Hash(user.Password)
@@ -461,7 +511,6 @@ func (user *User) Edit(updatePassword bool) error {
 		"username":     newUser.Username,
 		"display_name": newUser.DisplayName,
 		"group":        newUser.Group,
-		"quota":        newUser.Quota,
 		"remark":       newUser.Remark,
 	}
 	if updatePassword {
@@ -469,9 +518,28 @@ func (user *User) Edit(updatePassword bool) error {
 	}
 
 	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(updates).Error; err != nil {
+	delta := newUser.Quota - expectedQuota
+	err = applyQuotaChange(func(tx *gorm.DB) error {
+		// 额度只在未被读取之后的扣费或其他编辑修改时写入
+		if delta != 0 {
+			result := tx.Model(&User{}).Where("id = ? AND quota = ?", user.Id, expectedQuota).Update("quota", newUser.Quota)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrQuotaConflict
+			}
+		}
+		return tx.Model(user).Updates(updates).Error
+	}, userQuotaLedger(user.Id, QuotaLedgerKindAdjustment, delta, "管理员编辑用户"))
+	if err != nil {
 		return err
 	}
+	if delta != 0 {
+		if err = DB.Model(&User{}).Where("id = ?", user.Id).Select("quota").Find(&user.Quota).Error; err != nil {
+			return err
+		}
+	}
 
 	// Update cache
 	return updateUserCache(*user)
@@ -612,16 +680,21 @@ func ResetUserPasswordByEmail(email string, password string) error {
 }
 
 func IsAdmin(userId int) bool {
+	return GetUserRole(userId) >= common.RoleAdminUser
+}
+
+// GetUserRole returns the role of the user, 0 when the user does not exist.
+func GetUserRole(userId int) int {
 	if userId == 0 {
-		return false
+		return 0
 	}
 	var user User
 	err := DB.Where("id = ?", userId).Select("role").Find(&user).Error
 	if err != nil {
 		common.SysLog("no such user " + err.Error())
-		return false
+		return 0
 	}
-	return user.Role >= common.RoleAdminUser
+	return user.Role
 }
 
 //// IsUserEnabled checks user status from Redis first, falls back to DB if needed
@@ -763,7 +836,17 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 	return userBase.GetSetting(), nil
 }
 
+// IncreaseUserQuota gives quota back to the user, recorded as a refund in the ledger.
 func IncreaseUserQuota(id int, quota int, db bool) (err error) {
+	return increaseUserQuotaWithLedger(id, quota, db, QuotaLedgerKindRefund, "")
+}
+
+// GrantUserQuota adds quota to the user right away and records it in the ledger under kind.
+func GrantUserQuota(id int, quota int, kind string, remark string) error {
+	return increaseUserQuotaWithLedger(id, quota, true, kind, remark)
+}
+
+func increaseUserQuotaWithLedger(id int, quota int, db bool, kind string, remark string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -773,15 +856,18 @@ func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 			common.SysLog("failed to increase user quota: " + err.Error())
 		}
 	})
+	entry := userQuotaLedger(id, kind, quota, remark)
 	if !db && common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
+		addNewQuotaRecord(BatchUpdateTypeUserQuota, id, quota, entry)
 		return nil
 	}
-	return increaseUserQuota(id, quota)
+	return applyQuotaChange(func(tx *gorm.DB) error {
+		return increaseUserQuota(tx, id, quota)
+	}, entry)
 }
 
-func increaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+func increaseUserQuota(tx *gorm.DB, id int, quota int) (err error) {
+	err = tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
 	if err != nil {
 		return err
 	}
@@ -798,15 +884,18 @@ func DecreaseUserQuota(id int, quota int) (err error) {
 			common.SysLog("failed to decrease user quota: " + err.Error())
 		}
 	})
+	entry := userQuotaLedger(id, QuotaLedgerKindConsume, -quota, "")
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
+		addNewQuotaRecord(BatchUpdateTypeUserQuota, id, -quota, entry)
 		return nil
 	}
-	return decreaseUserQuota(id, quota)
+	return applyQuotaChange(func(tx *gorm.DB) error {
+		return decreaseUserQuota(tx, id, quota)
+	}, entry)
 }
 
-func decreaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
+func decreaseUserQuota(tx *gorm.DB, id int, quota int) (err error) {
+	err = tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
 	if err != nil {
 		return err
 	}
@@ -929,3 +1018,14 @@ func RootUserExists() bool {
 	}
 	return true
 }
+
+// SetUserAdminRole assigns the admin role of the user, an empty role restores the full admin access.
+func SetUserAdminRole(userId int, adminRole string) error {
+	if userId == 0 {
+		return errors.New("id 为空！")
+	}
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("admin_role", adminRole).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
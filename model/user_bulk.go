@@ -0,0 +1,100 @@
+package model
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserBulkFilter 批量操作的用户筛选条件，多个条件同时生效
+type UserBulkFilter struct {
+	Ids    []int  `json:"ids,omitempty"`
+	Group  string `json:"group,omitempty"`
+	Status int    `json:"status,omitempty"`
+	// DormantDays 最近 N 天没有消费日志的用户，0 表示不限
+	DormantDays int `json:"dormant_days,omitempty"`
+}
+
+// FindUsersForBulk returns the users matching the filter whose role is lower than maxRole, ordered by id.
+func FindUsersForBulk(filter UserBulkFilter, maxRole int) ([]*User, error) {
+	tx := DB.Model(&User{}).Where("role < ?", maxRole)
+	if len(filter.Ids) > 0 {
+		tx = tx.Where("id IN ?", filter.Ids)
+	}
+	if filter.Group != "" {
+		tx = tx.Where(commonGroupCol+" = ?", filter.Group)
+	}
+	if filter.Status != 0 {
+		tx = tx.Where("status = ?", filter.Status)
+	}
+	if filter.DormantDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -filter.DormantDays).Unix()
+		var activeIds []int
+		if err := LOG_DB.Model(&Log{}).
+			Where("type = ? AND created_at >= ?", LogTypeConsume, cutoff).
+			Distinct().Pluck("user_id", &activeIds).Error; err != nil {
+			return nil, err
+		}
+		if len(activeIds) > 0 {
+			tx = tx.Where("id NOT IN ?", activeIds)
+		}
+	}
+	var users []*User
+	err := tx.Select("id", "username", "display_name", "role", "status", "email", "quota", commonGroupCol, "setting").
+		Order("id").Find(&users).Error
+	return users, err
+}
+
+// BulkAdjustUserQuota adds delta to the quota of the users, the quota does not drop below 0.
+func BulkAdjustUserQuota(ids []int, delta int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 扣减时余额会被截断到 0，锁定并取出余额以便流水记录实际变动
+		var users []User
+		if err := tx.Model(&User{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).
+			Select("id", "quota").Find(&users).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&User{}).Where("id IN ?", ids).
+			Update("quota", gorm.Expr("CASE WHEN quota + ? < 0 THEN 0 ELSE quota + ? END", delta, delta)).Error
+		if err != nil {
+			return err
+		}
+		entries := make([]*QuotaLedger, 0, len(users))
+		for _, user := range users {
+			entries = append(entries, userQuotaLedger(user.Id, QuotaLedgerKindAdjustment, max(delta, -user.Quota), "批量调整"))
+		}
+		return insertQuotaLedger(tx, entries...)
+	})
+	if err != nil {
+		return err
+	}
+	invalidateUsersCache(ids)
+	return nil
+}
+
+func BulkUpdateUserGroup(ids []int, group string) error {
+	if err := DB.Model(&User{}).Where("id IN ?", ids).Update("group", group).Error; err != nil {
+		return err
+	}
+	invalidateUsersCache(ids)
+	return nil
+}
+
+func BulkUpdateUserStatus(ids []int, status int) error {
+	if err := DB.Model(&User{}).Where("id IN ?", ids).Update("status", status).Error; err != nil {
+		return err
+	}
+	invalidateUsersCache(ids)
+	return nil
+}
+
+func invalidateUsersCache(ids []int) {
+	for _, id := range ids {
+		if err := invalidateUserCache(id); err != nil {
+			common.SysLog("failed to invalidate user cache: " + err.Error())
+		}
+	}
+}
@@ -22,6 +22,9 @@ type UserBase struct {
 	Status   int    `json:"status"`
 	Username string `json:"username"`
 	Setting  string `json:"setting"`
+
+	SessionsRevokedAt int64  `json:"sessions_revoked_at"`
+	AdminRole         string `json:"admin_role"`
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
@@ -107,6 +110,9 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+
+		SessionsRevokedAt: user.SessionsRevokedAt,
+		AdminRole:         user.AdminRole,
 	}
 
 	return userCache, nil
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// RevokeUserTokens disables every enabled token of the user and returns how many were disabled.
+func RevokeUserTokens(userId int) (int, error) {
+	if userId == 0 {
+		return 0, errors.New("id 为空！")
+	}
+	var tokens []Token
+	if err := DB.Where("user_id = ? AND status = ?", userId, common.TokenStatusEnabled).Find(&tokens).Error; err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+	err := DB.Model(&Token{}).
+		Where("user_id = ? AND status = ?", userId, common.TokenStatusEnabled).
+		Update("status", common.TokenStatusDisabled).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			for _, t := range tokens {
+				_ = cacheDeleteToken(t.Key)
+			}
+		})
+	}
+	return len(tokens), nil
+}
+
+// RevokeUserSessions invalidates every login session issued before now and clears the system access token.
+func RevokeUserSessions(userId int) error {
+	if userId == 0 {
+		return errors.New("id 为空！")
+	}
+	err := DB.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+		"sessions_revoked_at": common.GetTimestamp(),
+		"access_token":        nil,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+// SetUserDeletionRequestedAt records when the user asked for the account to be deleted, 0 cancels the request.
+func SetUserDeletionRequestedAt(userId int, requestedAt int64) error {
+	if userId == 0 {
+		return errors.New("id 为空！")
+	}
+	return DB.Model(&User{}).Where("id = ?", userId).Update("deletion_requested_at", requestedAt).Error
+}
+
+// GetUsersPendingDeletion returns the users whose deletion was requested at or before the given time.
+func GetUsersPendingDeletion(requestedBefore int64, limit int) ([]*User, error) {
+	var users []*User
+	err := DB.Omit("password").
+		Where("deletion_requested_at > 0 AND deletion_requested_at <= ?", requestedBefore).
+		Order("deletion_requested_at asc").Limit(limit).Find(&users).Error
+	return users, err
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity 用户在 SSO 提供商处的身份，同一用户可以绑定多个提供商
+type UserIdentity struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id" gorm:"index;not null"`
+	Provider  string    `json:"provider" gorm:"type:varchar(64);uniqueIndex:idx_user_identity_subject;not null"`
+	Subject   string    `json:"subject" gorm:"type:varchar(255);uniqueIndex:idx_user_identity_subject;not null"`
+	Email     string    `json:"email" gorm:"type:varchar(255)"`
+	CreatedAt time.Time `json:"created_at"`
+	LastLogin time.Time `json:"last_login"`
+}
+
+// GetUserIdentity returns nil without error when the identity is not bound to any user.
+func GetUserIdentity(provider string, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	err := DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func CreateUserIdentity(identity *UserIdentity) error {
+	identity.LastLogin = time.Now()
+	return DB.Create(identity).Error
+}
+
+func TouchUserIdentity(id int) error {
+	return DB.Model(&UserIdentity{}).Where("id = ?", id).Update("last_login", time.Now()).Error
+}
+
+// UpdateUserGroupBySSO updates the group of the user mapped from the groups of the SSO provider.
+func UpdateUserGroupBySSO(userId int, group string) error {
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("group", group).Error; err != nil {
+		return err
+	}
+	return UpdateUserGroupCache(userId, group)
+}
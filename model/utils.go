@@ -23,10 +23,14 @@ const (
 var batchUpdateStores []map[int]int
 var batchUpdateLocks []sync.Mutex
 
+// batchUpdateLedgers 额度变动的流水与变动一起暂存，刷新时在同一事务中写入
+var batchUpdateLedgers []map[int][]*QuotaLedger
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int))
 		batchUpdateLocks = append(batchUpdateLocks, sync.Mutex{})
+		batchUpdateLedgers = append(batchUpdateLedgers, make(map[int][]*QuotaLedger))
 	}
 }
 
@@ -49,6 +53,14 @@ func addNewRecord(type_ int, id int, value int) {
 	}
 }
 
+// addNewQuotaRecord queues a quota change like addNewRecord together with its ledger entry.
+func addNewQuotaRecord(type_ int, id int, value int, entry *QuotaLedger) {
+	batchUpdateLocks[type_].Lock()
+	defer batchUpdateLocks[type_].Unlock()
+	batchUpdateStores[type_][id] += value
+	batchUpdateLedgers[type_][id] = append(batchUpdateLedgers[type_][id], entry)
+}
+
 func batchUpdate() {
 	// check if there's any data to update
 	hasData := false
@@ -70,18 +82,24 @@ func batchUpdate() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateLocks[i].Lock()
 		store := batchUpdateStores[i]
+		ledgers := batchUpdateLedgers[i]
 		batchUpdateStores[i] = make(map[int]int)
+		batchUpdateLedgers[i] = make(map[int][]*QuotaLedger)
 		batchUpdateLocks[i].Unlock()
 		// TODO: maybe we can combine updates with same key?
 		for key, value := range store {
 			switch i {
 			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
+				err := applyQuotaChange(func(tx *gorm.DB) error {
+					return increaseUserQuota(tx, key, value)
+				}, ledgers[key]...)
 				if err != nil {
 					common.SysLog("failed to batch update user quota: " + err.Error())
 				}
 			case BatchUpdateTypeTokenQuota:
-				err := increaseTokenQuota(key, value)
+				err := applyQuotaChange(func(tx *gorm.DB) error {
+					return increaseTokenQuota(tx, key, value)
+				}, ledgers[key]...)
 				if err != nil {
 					common.SysLog("failed to batch update token quota: " + err.Error())
 				}
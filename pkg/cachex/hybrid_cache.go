@@ -21,7 +21,7 @@ type HybridCacheConfig[V any] struct {
 	Namespace Namespace
 
 	// Redis is used when RedisEnabled returns true (or RedisEnabled is nil) and Redis is not nil.
-	Redis        *redis.Client
+	Redis        redis.UniversalClient
 	RedisCodec   ValueCodec[V]
 	RedisEnabled func() bool
 
@@ -33,7 +33,7 @@ type HybridCacheConfig[V any] struct {
 type HybridCache[V any] struct {
 	ns Namespace
 
-	redis        *redis.Client
+	redis        redis.UniversalClient
 	redisCodec   ValueCodec[V]
 	redisEnabled func() bool
 
@@ -140,10 +140,27 @@ func (c *HybridCache[V]) scanKeys(match string) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultRedisScanTimeout)
 	defer cancel()
 
+	// Cluster 模式下 SCAN 只遍历一个节点，需要逐个扫描所有主节点
+	if cluster, ok := c.redis.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		keys := make([]string, 0, 1024)
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			nodeKeys, err := scanRedisKeys(ctx, node, match)
+			mu.Lock()
+			keys = append(keys, nodeKeys...)
+			mu.Unlock()
+			return err
+		})
+		return keys, err
+	}
+	return scanRedisKeys(ctx, c.redis, match)
+}
+
+func scanRedisKeys(ctx context.Context, client redis.Cmdable, match string) ([]string, error) {
 	var cursor uint64
 	keys := make([]string, 0, 1024)
 	for {
-		k, next, err := c.redis.Scan(ctx, cursor, match, 1000).Result()
+		k, next, err := client.Scan(ctx, cursor, match, 1000).Result()
 		if err != nil {
 			return keys, err
 		}
@@ -0,0 +1,408 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Object is an object type of the schema. Fields without a Type are scalars and resolve to JSON values.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+type Field struct {
+	// Type 字段的对象类型，为空时为标量
+	Type *Object
+	// Args 接受的参数名，传入其他参数时报错
+	Args []string
+	// Authorize 在解析前调用，返回错误时该字段为 null 并报告错误
+	Authorize func(p ResolveParams) error
+	// Resolve 返回字段的值，对象类型可以返回结构体、指针或它们的切片
+	Resolve func(p ResolveParams) (any, error)
+}
+
+type ResolveParams struct {
+	Context context.Context
+	Source  any
+	Args    map[string]any
+}
+
+// Error is a GraphQL error, Path is the response path of the field that failed.
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+type Result struct {
+	Data   any      `json:"data"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+type Params struct {
+	Context       context.Context
+	Schema        *Object
+	Query         string
+	OperationName string
+	Variables     map[string]any
+	// MaxDepth 限制查询的嵌套层数，0 表示不限制
+	MaxDepth int
+	// MaxComplexity 限制展开片段后查询的字段数，0 表示不限制
+	MaxComplexity int
+}
+
+// Execute parses, validates and executes a query. A document that can not be executed returns a result
+// without data; field errors are reported next to the partial data.
+func Execute(params Params) *Result {
+	if params.Context == nil {
+		params.Context = context.Background()
+	}
+	doc, err := Parse(params.Query)
+	if err != nil {
+		return &Result{Errors: []*Error{{Message: err.Error()}}}
+	}
+	op, err := selectOperation(doc, params.OperationName)
+	if err != nil {
+		return &Result{Errors: []*Error{{Message: err.Error()}}}
+	}
+	if op.Type != "query" {
+		return &Result{Errors: []*Error{{Message: fmt.Sprintf("%s operations are not supported", op.Type)}}}
+	}
+	variables, err := coerceVariables(op, params.Variables)
+	if err != nil {
+		return &Result{Errors: []*Error{{Message: err.Error()}}}
+	}
+	e := &executor{ctx: params.Context, doc: doc, variables: variables, maxDepth: params.MaxDepth}
+	if err = e.validate(op.Selections, params.Schema, 1, map[string]bool{}); err != nil {
+		return &Result{Errors: []*Error{{Message: err.Error()}}}
+	}
+	if params.MaxComplexity > 0 && e.complexity > params.MaxComplexity {
+		return &Result{Errors: []*Error{{Message: fmt.Sprintf("query selects %d fields, more than the limit of %d", e.complexity, params.MaxComplexity)}}}
+	}
+	data := e.executeSelections(op.Selections, params.Schema, nil, nil)
+	return &Result{Data: data, Errors: e.errors}
+}
+
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, fmt.Errorf("operationName is required when the document contains several operations")
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %s", name)
+}
+
+func coerceVariables(op *Operation, values map[string]any) (map[string]any, error) {
+	variables := make(map[string]any, len(op.Variables))
+	for _, def := range op.Variables {
+		value, ok := values[def.Name]
+		if !ok || value == nil {
+			if def.HasDefault {
+				value, ok = def.Default, true
+			}
+		}
+		if (!ok || value == nil) && len(def.Type) > 0 && def.Type[len(def.Type)-1] == '!' {
+			return nil, fmt.Errorf("variable $%s of type %s is required", def.Name, def.Type)
+		}
+		if ok {
+			variables[def.Name] = value
+		}
+	}
+	return variables, nil
+}
+
+type executor struct {
+	ctx       context.Context
+	doc       *Document
+	variables map[string]any
+	maxDepth  int
+	// complexity 校验时统计的字段数
+	complexity int
+	errors     []*Error
+}
+
+// validate checks the selections against the schema before anything is resolved.
+func (e *executor) validate(selections []*Selection, obj *Object, depth int, fragments map[string]bool) error {
+	if e.maxDepth > 0 && depth > e.maxDepth {
+		return fmt.Errorf("query is nested deeper than %d levels", e.maxDepth)
+	}
+	for _, sel := range selections {
+		if sel.FragmentName != "" || sel.Inline {
+			inner := sel.Selections
+			condition := sel.TypeCondition
+			if sel.FragmentName != "" {
+				fragment, ok := e.doc.Fragments[sel.FragmentName]
+				if !ok {
+					return fmt.Errorf("unknown fragment %s", sel.FragmentName)
+				}
+				if fragments[fragment.Name] {
+					return fmt.Errorf("fragment %s spreads itself", fragment.Name)
+				}
+				inner, condition = fragment.Selections, fragment.TypeCondition
+			}
+			if condition != "" && condition != obj.Name {
+				return fmt.Errorf("fragment on %s can not be spread on %s", condition, obj.Name)
+			}
+			if sel.FragmentName != "" {
+				fragments[sel.FragmentName] = true
+			}
+			err := e.validate(inner, obj, depth, fragments)
+			delete(fragments, sel.FragmentName)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if sel.Name == "__typename" {
+			continue
+		}
+		e.complexity++
+		field, ok := obj.Fields[sel.Name]
+		if !ok {
+			return fmt.Errorf("cannot query field %s on type %s", sel.Name, obj.Name)
+		}
+		for name := range sel.Arguments {
+			if !containsString(field.Args, name) {
+				return fmt.Errorf("unknown argument %s on field %s.%s", name, obj.Name, sel.Name)
+			}
+		}
+		if field.Type == nil {
+			if len(sel.Selections) > 0 {
+				return fmt.Errorf("field %s.%s is a scalar and can not have a selection set", obj.Name, sel.Name)
+			}
+			continue
+		}
+		if len(sel.Selections) == 0 {
+			return fmt.Errorf("field %s.%s of type %s must have a selection set", obj.Name, sel.Name, field.Type.Name)
+		}
+		if err := e.validate(sel.Selections, field.Type, depth+1, fragments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type collectedField struct {
+	key        string
+	selections []*Selection
+}
+
+// collectFields flattens fragments and groups the fields by response key, in query order.
+func (e *executor) collectFields(selections []*Selection, fields []*collectedField, index map[string]int) []*collectedField {
+	for _, sel := range selections {
+		if !e.included(sel) {
+			continue
+		}
+		switch {
+		case sel.FragmentName != "":
+			fields = e.collectFields(e.doc.Fragments[sel.FragmentName].Selections, fields, index)
+		case sel.Inline:
+			fields = e.collectFields(sel.Selections, fields, index)
+		default:
+			key := sel.ResponseKey()
+			if i, ok := index[key]; ok {
+				fields[i].selections = append(fields[i].selections, sel)
+				continue
+			}
+			index[key] = len(fields)
+			fields = append(fields, &collectedField{key: key, selections: []*Selection{sel}})
+		}
+	}
+	return fields
+}
+
+func (e *executor) included(sel *Selection) bool {
+	for _, directive := range sel.Directives {
+		value, _ := e.resolveValue(directive.Arguments["if"]).(bool)
+		switch directive.Name {
+		case "skip":
+			if value {
+				return false
+			}
+		case "include":
+			if !value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (e *executor) executeSelections(selections []*Selection, obj *Object, source any, path []any) *OrderedMap {
+	result := &OrderedMap{}
+	for _, field := range e.collectFields(selections, nil, map[string]int{}) {
+		sel := field.selections[0]
+		fieldPath := append(append([]any{}, path...), field.key)
+		if sel.Name == "__typename" {
+			result.Set(field.key, obj.Name)
+			continue
+		}
+		definition := obj.Fields[sel.Name]
+		args := make(map[string]any, len(sel.Arguments))
+		for name, value := range sel.Arguments {
+			args[name] = e.resolveValue(value)
+		}
+		p := ResolveParams{Context: e.ctx, Source: source, Args: args}
+		if definition.Authorize != nil {
+			if err := definition.Authorize(p); err != nil {
+				e.addError(err, fieldPath)
+				result.Set(field.key, nil)
+				continue
+			}
+		}
+		value, err := definition.Resolve(p)
+		if err != nil {
+			e.addError(err, fieldPath)
+			result.Set(field.key, nil)
+			continue
+		}
+		if definition.Type == nil {
+			result.Set(field.key, value)
+			continue
+		}
+		var subSelections []*Selection
+		for _, s := range field.selections {
+			subSelections = append(subSelections, s.Selections...)
+		}
+		result.Set(field.key, e.completeObject(subSelections, definition.Type, value, fieldPath))
+	}
+	return result
+}
+
+// completeObject resolves the sub selections on an object value or on every element of a list value.
+func (e *executor) completeObject(selections []*Selection, obj *Object, value any, path []any) any {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.IsNil()) {
+		if v.Kind() == reflect.Slice {
+			return []any{}
+		}
+		return nil
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = e.completeObject(selections, obj, v.Index(i).Interface(), append(append([]any{}, path...), i))
+		}
+		return list
+	}
+	return e.executeSelections(selections, obj, value, path)
+}
+
+func (e *executor) resolveValue(value any) any {
+	switch v := value.(type) {
+	case Variable:
+		return e.variables[string(v)]
+	case EnumValue:
+		return string(v)
+	case []any:
+		list := make([]any, len(v))
+		for i := range v {
+			list[i] = e.resolveValue(v[i])
+		}
+		return list
+	case map[string]any:
+		object := make(map[string]any, len(v))
+		for key := range v {
+			object[key] = e.resolveValue(v[key])
+		}
+		return object
+	}
+	return value
+}
+
+func (e *executor) addError(err error, path []any) {
+	e.errors = append(e.errors, &Error{Message: err.Error(), Path: path})
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderedMap keeps the response keys in query order when marshalled, as the GraphQL spec requires.
+type OrderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func (m *OrderedMap) Set(key string, value any) {
+	if m.values == nil {
+		m.values = make(map[string]any)
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *OrderedMap) Get(key string) (any, bool) {
+	value, ok := m.values[key]
+	return value, ok
+}
+
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Int returns the integer argument, def when it is missing. Variables decoded from JSON arrive as float64.
+func (p ResolveParams) Int(name string, def int) int {
+	switch v := p.Args[name].(type) {
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+	}
+	return def
+}
+
+// String returns the string argument, empty when it is missing.
+func (p ResolveParams) String(name string) string {
+	s, _ := p.Args[name].(string)
+	return s
+}
+
+// Bool returns the boolean argument, def when it is missing.
+func (p ResolveParams) Bool(name string, def bool) bool {
+	if b, ok := p.Args[name].(bool); ok {
+		return b
+	}
+	return def
+}
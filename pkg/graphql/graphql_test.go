@@ -0,0 +1,289 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testUser struct {
+	Id   int
+	Name string
+}
+
+func testSchema() *Object {
+	user := &Object{Name: "User"}
+	user.Fields = map[string]*Field{
+		"id":   {Resolve: func(p ResolveParams) (any, error) { return p.Source.(*testUser).Id, nil }},
+		"name": {Resolve: func(p ResolveParams) (any, error) { return p.Source.(*testUser).Name, nil }},
+		"secret": {
+			Authorize: func(p ResolveParams) error { return errors.New("forbidden") },
+			Resolve:   func(p ResolveParams) (any, error) { return "s3cret", nil },
+		},
+		"friends": {Type: user, Resolve: func(p ResolveParams) (any, error) {
+			return []*testUser{{Id: p.Source.(*testUser).Id + 1, Name: "friend"}}, nil
+		}},
+	}
+	return &Object{Name: "Query", Fields: map[string]*Field{
+		"user": {Type: user, Args: []string{"id"}, Resolve: func(p ResolveParams) (any, error) {
+			return &testUser{Id: p.Int("id", 0), Name: "alice"}, nil
+		}},
+	}}
+}
+
+func marshal(t *testing.T, result *Result) string {
+	t.Helper()
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExecute(t *testing.T) {
+	result := Execute(Params{
+		Schema: testSchema(),
+		Query: `query Q($id: Int!) {
+			me: user(id: $id) { ...fields friends { id __typename } hidden: name @skip(if: true) }
+		}
+		fragment fields on User { name id }`,
+		Variables: map[string]any{"id": float64(7)},
+	})
+	want := `{"data":{"me":{"name":"alice","id":7,"friends":[{"id":8,"__typename":"User"}]}}}`
+	if got := marshal(t, result); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestExecuteFieldAuthorization(t *testing.T) {
+	result := Execute(Params{Schema: testSchema(), Query: `{ user(id: 1) { id secret } }`})
+	want := `{"data":{"user":{"id":1,"secret":null}},"errors":[{"message":"forbidden","path":["user","secret"]}]}`
+	if got := marshal(t, result); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestExecuteValidation(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":    `{ user(id: 1) { email } }`,
+		"unknown argument": `{ user(name: "x") { id } }`,
+		"missing subfield": `{ user(id: 1) }`,
+		"too deep":         `{ user(id: 1) { friends { friends { friends { id } } } } }`,
+		"mutation":         `mutation { user(id: 1) { id } }`,
+		"missing variable": `query ($id: Int!) { user(id: $id) { id } }`,
+		"fragment cycle":   `{ user(id: 1) { ...a } } fragment a on User { friends { ...a } }`,
+		"syntax":           `{ user(id: 1) { id }`,
+	}
+	for name, query := range cases {
+		result := Execute(Params{Schema: testSchema(), Query: query, MaxDepth: 3})
+		if result.Data != nil || len(result.Errors) != 1 {
+			t.Errorf("%s: expected a request error, got %s", name, marshal(t, result))
+		}
+	}
+}
+
+type testPost struct {
+	Id    int
+	Title string
+}
+
+// testBlogSchema users with posts, where post 2 fails to resolve its title and admin_note needs the admin context.
+func testBlogSchema(resolved *[]string) *Object {
+	post := &Object{Name: "Post"}
+	post.Fields = map[string]*Field{
+		"id": {Resolve: func(p ResolveParams) (any, error) { return p.Source.(*testPost).Id, nil }},
+		"title": {Resolve: func(p ResolveParams) (any, error) {
+			if p.Source.(*testPost).Id == 2 {
+				return nil, errors.New("title unavailable")
+			}
+			return p.Source.(*testPost).Title, nil
+		}},
+		"admin_note": {
+			Authorize: func(p ResolveParams) error {
+				if p.Context.Value(testAdminKey{}) == nil {
+					return errors.New("forbidden")
+				}
+				return nil
+			},
+			Resolve: func(p ResolveParams) (any, error) {
+				*resolved = append(*resolved, "admin_note")
+				return "note", nil
+			},
+		},
+	}
+	user := &Object{Name: "User"}
+	user.Fields = map[string]*Field{
+		"id":   {Resolve: func(p ResolveParams) (any, error) { return p.Source.(*testUser).Id, nil }},
+		"name": {Resolve: func(p ResolveParams) (any, error) { return p.Source.(*testUser).Name, nil }},
+		"posts": {Type: post, Args: []string{"first"}, Resolve: func(p ResolveParams) (any, error) {
+			posts := []*testPost{{Id: 1, Title: "a"}, {Id: 2, Title: "b"}, {Id: 3, Title: "c"}}
+			return posts[:p.Int("first", len(posts))], nil
+		}},
+		"manager": {Type: user, Resolve: func(p ResolveParams) (any, error) {
+			return (*testUser)(nil), nil
+		}},
+		"followers": {Type: user, Resolve: func(p ResolveParams) (any, error) {
+			return []*testUser(nil), nil
+		}},
+	}
+	return &Object{Name: "Query", Fields: map[string]*Field{
+		"user": {
+			Type: user,
+			Args: []string{"id", "name", "admin"},
+			Authorize: func(p ResolveParams) error {
+				if p.Bool("admin", false) && p.Context.Value(testAdminKey{}) == nil {
+					return errors.New("admin argument is forbidden")
+				}
+				return nil
+			},
+			Resolve: func(p ResolveParams) (any, error) {
+				*resolved = append(*resolved, "user")
+				name := p.String("name")
+				if name == "" {
+					name = "alice"
+				}
+				return &testUser{Id: p.Int("id", 1), Name: name}, nil
+			},
+		},
+	}}
+}
+
+type testAdminKey struct{}
+
+func execute(t *testing.T, params Params) string {
+	t.Helper()
+	var resolved []string
+	params.Schema = testBlogSchema(&resolved)
+	return marshal(t, Execute(params))
+}
+
+func TestExecuteVariables(t *testing.T) {
+	query := `query ($id: Int = 5, $name: String, $withPosts: Boolean!, $first: Int) {
+		user(id: $id, name: $name) { id name posts(first: $first) @include(if: $withPosts) { id } }
+	}`
+	cases := []struct {
+		name      string
+		variables map[string]any
+		want      string
+	}{
+		{"defaults", map[string]any{"withPosts": false},
+			`{"data":{"user":{"id":5,"name":"alice"}}}`},
+		{"provided", map[string]any{"id": float64(9), "name": "bob", "withPosts": true, "first": float64(1)},
+			`{"data":{"user":{"id":9,"name":"bob","posts":[{"id":1}]}}}`},
+		{"null uses the default", map[string]any{"id": nil, "name": nil, "withPosts": true, "first": float64(2)},
+			`{"data":{"user":{"id":5,"name":"alice","posts":[{"id":1},{"id":2}]}}}`},
+	}
+	for _, tc := range cases {
+		if got := execute(t, Params{Query: query, Variables: tc.variables}); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+	if got := execute(t, Params{Query: query}); got != `{"data":null,"errors":[{"message":"variable $withPosts of type Boolean! is required"}]}` {
+		t.Errorf("missing required variable: got %s", got)
+	}
+}
+
+func TestExecuteOperationName(t *testing.T) {
+	query := `query A { user(id: 1) { id } } query B { user(id: 2) { id } }`
+	if got := execute(t, Params{Query: query, OperationName: "B"}); got != `{"data":{"user":{"id":2}}}` {
+		t.Errorf("named operation: got %s", got)
+	}
+	for _, name := range []string{"", "C"} {
+		result := Execute(Params{Schema: testSchema(), Query: query, OperationName: name})
+		if result.Data != nil || len(result.Errors) != 1 {
+			t.Errorf("operation %q: expected a request error, got %s", name, marshal(t, result))
+		}
+	}
+}
+
+func TestExecuteFieldErrors(t *testing.T) {
+	got := execute(t, Params{Query: `{ user { posts { id title } manager { id } followers { id } } }`})
+	want := `{"data":{"user":{"posts":[{"id":1,"title":"a"},{"id":2,"title":null},{"id":3,"title":"c"}],"manager":null,"followers":[]}},` +
+		`"errors":[{"message":"title unavailable","path":["user","posts",1,"title"]}]}`
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestExecuteMergesFieldsWithTheSameKey(t *testing.T) {
+	got := execute(t, Params{Query: `{ user { id posts(first: 1) { id } ... on User { posts(first: 1) { title } } } }`})
+	if want := `{"data":{"user":{"id":1,"posts":[{"id":1,"title":"a"}]}}}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestExecuteDepthLimit(t *testing.T) {
+	cases := map[string]bool{
+		`{ user { id } }`:                         true,
+		`{ user { manager { id } } }`:             true,
+		`{ user { manager { manager { id } } } }`: false,
+		// 片段不增加层数，其中的字段按展开的位置计算
+		`{ user { ...m } } fragment m on User { manager { id } }`:           true,
+		`{ user { ...m } } fragment m on User { manager { posts { id } } }`: false,
+	}
+	for query, ok := range cases {
+		result := Execute(Params{Schema: testBlogSchema(new([]string)), Query: query, MaxDepth: 3})
+		if (result.Data != nil) != ok {
+			t.Errorf("%s: got %s", query, marshal(t, result))
+		}
+	}
+}
+
+func TestExecuteComplexityLimit(t *testing.T) {
+	cases := map[string]bool{
+		// __typename 不计入字段数
+		`{ user { id name __typename } }`:   true,
+		`{ user { id name posts { id } } }`: false,
+		// 片段每次展开都计数
+		`{ a: user { ...f } b: user { ...f } } fragment f on User { id }`: false,
+		`{ a: user { ...f } } fragment f on User { id name }`:             true,
+	}
+	for query, ok := range cases {
+		result := Execute(Params{Schema: testBlogSchema(new([]string)), Query: query, MaxComplexity: 3})
+		if (result.Data != nil) != ok {
+			t.Errorf("%s: got %s", query, marshal(t, result))
+		}
+	}
+}
+
+func TestExecuteAuthorization(t *testing.T) {
+	var resolved []string
+	schema := testBlogSchema(&resolved)
+
+	result := Execute(Params{Schema: schema, Query: `{ user(admin: true) { id } other: user { posts(first: 1) { admin_note } } }`})
+	want := `{"data":{"user":null,"other":{"posts":[{"admin_note":null}]}},"errors":[` +
+		`{"message":"admin argument is forbidden","path":["user"]},{"message":"forbidden","path":["other","posts",0,"admin_note"]}]}`
+	if got := marshal(t, result); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	// 拒绝访问的字段不会被解析
+	if !reflect.DeepEqual(resolved, []string{"user"}) {
+		t.Fatalf("unexpected resolvers called: %v", resolved)
+	}
+
+	resolved = nil
+	ctx := context.WithValue(context.Background(), testAdminKey{}, true)
+	result = Execute(Params{Context: ctx, Schema: schema, Query: `{ user(admin: true) { posts(first: 1) { admin_note } } }`})
+	if got := marshal(t, result); got != `{"data":{"user":{"posts":[{"admin_note":"note"}]}}}` {
+		t.Fatalf("admin: got %s", got)
+	}
+}
+
+func TestResolveParamsConversions(t *testing.T) {
+	p := ResolveParams{Args: map[string]any{
+		"int64": int64(3), "int": 4, "float": float64(5), "number": json.Number("6"), "string": "s", "bool": false,
+	}}
+	for name, want := range map[string]int{"int64": 3, "int": 4, "float": 5, "number": 6, "string": -1, "missing": -1} {
+		if got := p.Int(name, -1); got != want {
+			t.Errorf("Int(%s) = %d, want %d", name, got, want)
+		}
+	}
+	if p.String("string") != "s" || p.String("int") != "" {
+		t.Error("unexpected String conversion")
+	}
+	if p.Bool("bool", true) || !p.Bool("missing", true) {
+		t.Error("unexpected Bool conversion")
+	}
+}
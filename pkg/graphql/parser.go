@@ -0,0 +1,511 @@
+// Package graphql is a small GraphQL query engine: it parses query documents (operations, variables, aliases,
+// arguments, fragments and the @skip/@include directives) and executes them against a schema of object types
+// with resolver functions. Mutations, subscriptions, interfaces, unions and introspection other than
+// __typename are not supported.
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed query document.
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+type Operation struct {
+	Type       string // query、mutation 或 subscription
+	Name       string
+	Variables  []*VariableDefinition
+	Selections []*Selection
+}
+
+type VariableDefinition struct {
+	Name       string
+	Type       string
+	Default    any
+	HasDefault bool
+}
+
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Selections    []*Selection
+}
+
+// Selection is a field, a fragment spread (FragmentName set) or an inline fragment (Inline set).
+type Selection struct {
+	Alias         string
+	Name          string
+	Arguments     map[string]any
+	Directives    []*Directive
+	Selections    []*Selection
+	FragmentName  string
+	Inline        bool
+	TypeCondition string
+	Pos           int
+}
+
+type Directive struct {
+	Name      string
+	Arguments map[string]any
+}
+
+// Variable is a reference to an operation variable inside an argument value.
+type Variable string
+
+// EnumValue is an enum literal inside an argument value.
+type EnumValue string
+
+// ResponseKey is the key of the field in the result, the alias when there is one.
+func (s *Selection) ResponseKey() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+type parser struct {
+	src   string
+	pos   int
+	token token
+}
+
+// Parse parses a query document.
+func Parse(src string) (doc *Document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if syntaxErr, ok := r.(*SyntaxError); ok {
+				doc, err = nil, syntaxErr
+				return
+			}
+			panic(r)
+		}
+	}()
+	p := &parser{src: src}
+	p.next()
+	doc = &Document{Fragments: make(map[string]*Fragment)}
+	for p.token.kind != tokenEOF {
+		if p.peekPunct("{") {
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: p.parseSelectionSet()})
+			continue
+		}
+		if p.token.kind != tokenName {
+			p.fail("unexpected %q", p.token.value)
+		}
+		switch p.token.value {
+		case "query", "mutation", "subscription":
+			doc.Operations = append(doc.Operations, p.parseOperation())
+		case "fragment":
+			fragment := p.parseFragment()
+			if _, ok := doc.Fragments[fragment.Name]; ok {
+				p.fail("duplicate fragment %s", fragment.Name)
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			p.fail("unexpected %q", p.token.value)
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, &SyntaxError{Message: "document contains no operation"}
+	}
+	return doc, nil
+}
+
+// SyntaxError reports an invalid query document.
+type SyntaxError struct {
+	Message string
+	Pos     int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Pos, e.Message)
+}
+
+func (p *parser) fail(format string, args ...any) {
+	panic(&SyntaxError{Message: fmt.Sprintf(format, args...), Pos: p.token.pos})
+}
+
+func (p *parser) parseOperation() *Operation {
+	op := &Operation{Type: p.token.value}
+	p.next()
+	if p.token.kind == tokenName {
+		op.Name = p.token.value
+		p.next()
+	}
+	if p.skipPunct("(") {
+		for !p.skipPunct(")") {
+			op.Variables = append(op.Variables, p.parseVariableDefinition())
+		}
+	}
+	p.parseDirectives()
+	op.Selections = p.parseSelectionSet()
+	return op
+}
+
+func (p *parser) parseVariableDefinition() *VariableDefinition {
+	p.expectPunct("$")
+	def := &VariableDefinition{Name: p.expectName()}
+	p.expectPunct(":")
+	def.Type = p.parseType()
+	if p.skipPunct("=") {
+		def.Default = p.parseValue(true)
+		def.HasDefault = true
+	}
+	return def
+}
+
+func (p *parser) parseType() string {
+	var typ string
+	if p.skipPunct("[") {
+		typ = "[" + p.parseType() + "]"
+		p.expectPunct("]")
+	} else {
+		typ = p.expectName()
+	}
+	if p.skipPunct("!") {
+		typ += "!"
+	}
+	return typ
+}
+
+func (p *parser) parseFragment() *Fragment {
+	p.next()
+	fragment := &Fragment{Name: p.expectName()}
+	if p.token.kind != tokenName || p.token.value != "on" {
+		p.fail("expected type condition of fragment %s", fragment.Name)
+	}
+	p.next()
+	fragment.TypeCondition = p.expectName()
+	p.parseDirectives()
+	fragment.Selections = p.parseSelectionSet()
+	return fragment
+}
+
+func (p *parser) parseSelectionSet() []*Selection {
+	p.expectPunct("{")
+	selections := make([]*Selection, 0)
+	for !p.skipPunct("}") {
+		selections = append(selections, p.parseSelection())
+	}
+	if len(selections) == 0 {
+		p.fail("empty selection set")
+	}
+	return selections
+}
+
+func (p *parser) parseSelection() *Selection {
+	sel := &Selection{Pos: p.token.pos}
+	if p.skipPunct("...") {
+		if p.token.kind == tokenName && p.token.value != "on" {
+			sel.FragmentName = p.expectName()
+			sel.Directives = p.parseDirectives()
+			return sel
+		}
+		sel.Inline = true
+		if p.token.kind == tokenName && p.token.value == "on" {
+			p.next()
+			sel.TypeCondition = p.expectName()
+		}
+		sel.Directives = p.parseDirectives()
+		sel.Selections = p.parseSelectionSet()
+		return sel
+	}
+	sel.Name = p.expectName()
+	if p.skipPunct(":") {
+		sel.Alias = sel.Name
+		sel.Name = p.expectName()
+	}
+	sel.Arguments = p.parseArguments(false)
+	sel.Directives = p.parseDirectives()
+	if p.peekPunct("{") {
+		sel.Selections = p.parseSelectionSet()
+	}
+	return sel
+}
+
+func (p *parser) parseArguments(constant bool) map[string]any {
+	args := make(map[string]any)
+	if !p.skipPunct("(") {
+		return args
+	}
+	for !p.skipPunct(")") {
+		name := p.expectName()
+		if _, ok := args[name]; ok {
+			p.fail("duplicate argument %s", name)
+		}
+		p.expectPunct(":")
+		args[name] = p.parseValue(constant)
+	}
+	return args
+}
+
+func (p *parser) parseDirectives() []*Directive {
+	var directives []*Directive
+	for p.skipPunct("@") {
+		directives = append(directives, &Directive{Name: p.expectName(), Arguments: p.parseArguments(false)})
+	}
+	return directives
+}
+
+func (p *parser) parseValue(constant bool) any {
+	tok := p.token
+	switch tok.kind {
+	case tokenPunct:
+		switch tok.value {
+		case "$":
+			if constant {
+				p.fail("variables are not allowed here")
+			}
+			p.next()
+			return Variable(p.expectName())
+		case "[":
+			p.next()
+			list := make([]any, 0)
+			for !p.skipPunct("]") {
+				list = append(list, p.parseValue(constant))
+			}
+			return list
+		case "{":
+			p.next()
+			object := make(map[string]any)
+			for !p.skipPunct("}") {
+				name := p.expectName()
+				p.expectPunct(":")
+				object[name] = p.parseValue(constant)
+			}
+			return object
+		}
+	case tokenInt:
+		p.next()
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			p.fail("invalid int %s", tok.value)
+		}
+		return n
+	case tokenFloat:
+		p.next()
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			p.fail("invalid float %s", tok.value)
+		}
+		return f
+	case tokenString:
+		p.next()
+		return tok.value
+	case tokenName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return EnumValue(tok.value)
+	}
+	p.fail("unexpected %q", tok.value)
+	return nil
+}
+
+func (p *parser) peekPunct(value string) bool {
+	return p.token.kind == tokenPunct && p.token.value == value
+}
+
+func (p *parser) skipPunct(value string) bool {
+	if p.peekPunct(value) {
+		p.next()
+		return true
+	}
+	if p.token.kind == tokenEOF {
+		p.fail("unexpected end of document")
+	}
+	return false
+}
+
+func (p *parser) expectPunct(value string) {
+	if !p.peekPunct(value) {
+		p.fail("expected %q, found %q", value, p.token.value)
+	}
+	p.next()
+}
+
+func (p *parser) expectName() string {
+	if p.token.kind != tokenName {
+		p.fail("expected name, found %q", p.token.value)
+	}
+	name := p.token.value
+	p.next()
+	return name
+}
+
+// next reads the next token, skipping white space, commas and comments.
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+			continue
+		}
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		break
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.token = token{kind: tokenEOF, pos: start}
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.token = token{kind: tokenPunct, value: "...", pos: start}
+	case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+		p.pos++
+		p.token = token{kind: tokenPunct, value: string(c), pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.token = token{kind: tokenName, value: p.src[start:p.pos], pos: start}
+	case c == '-' || isDigit(c):
+		p.token = p.readNumber()
+	case c == '"':
+		p.token = p.readString()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.token = token{kind: tokenPunct, value: string(r), pos: start}
+		p.fail("unexpected character %q", r)
+	}
+}
+
+func (p *parser) readNumber() token {
+	start := p.pos
+	kind := tokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		begin := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == begin {
+			p.token = token{kind: tokenPunct, value: p.src[start:p.pos], pos: start}
+			p.fail("invalid number")
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = tokenFloat
+		p.pos++
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = tokenFloat
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	return token{kind: kind, value: p.src[start:p.pos], pos: start}
+}
+
+func (p *parser) readString() token {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			p.token = token{kind: tokenPunct, value: `"""`, pos: start}
+			p.fail("unterminated block string")
+		}
+		value := p.src[p.pos+3 : p.pos+3+end]
+		p.pos += end + 6
+		return token{kind: tokenString, value: strings.TrimSpace(value), pos: start}
+	}
+	p.pos++
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.token = token{kind: tokenPunct, value: `"`, pos: start}
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			return token{kind: tokenString, value: sb.String(), pos: start}
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 >= len(p.src) {
+			p.fail("unterminated string")
+		}
+		escape := p.src[p.pos+1]
+		p.pos += 2
+		switch escape {
+		case '"', '\\', '/':
+			sb.WriteByte(escape)
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'u':
+			if p.pos+4 > len(p.src) {
+				p.fail("invalid unicode escape")
+			}
+			code, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+			if err != nil {
+				p.fail("invalid unicode escape")
+			}
+			sb.WriteRune(rune(code))
+			p.pos += 4
+		default:
+			p.fail("invalid escape \\%c", escape)
+		}
+	}
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,138 @@
+package graphql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseDocument(t *testing.T) {
+	doc, err := Parse(`
+		# 注释和逗号会被忽略
+		query Users($page: Int = 1, $ids: [Int!]!, $flag: Boolean) {
+			list: users(page: $page, ids: $ids, filter: {name: "a\"bé", roles: [1, -2]}, order: DESC) @include(if: $flag) {
+				id,
+				... on User { name }
+				... @skip(if: false) { role }
+				...userFields
+			}
+			stats(ratio: 1.5e2, note: """  block "quoted" text  """, active: true, deleted: false, parent: null)
+		}
+		fragment userFields on User { email }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Operations) != 1 || len(doc.Fragments) != 1 {
+		t.Fatalf("got %d operations and %d fragments", len(doc.Operations), len(doc.Fragments))
+	}
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Users" {
+		t.Fatalf("unexpected operation %s %s", op.Type, op.Name)
+	}
+	wantVariables := []*VariableDefinition{
+		{Name: "page", Type: "Int", Default: int64(1), HasDefault: true},
+		{Name: "ids", Type: "[Int!]!"},
+		{Name: "flag", Type: "Boolean"},
+	}
+	if !reflect.DeepEqual(op.Variables, wantVariables) {
+		t.Fatalf("unexpected variables %+v", op.Variables)
+	}
+
+	list := op.Selections[0]
+	if list.Alias != "list" || list.Name != "users" || list.ResponseKey() != "list" {
+		t.Fatalf("unexpected field %s: %s", list.Alias, list.Name)
+	}
+	wantArgs := map[string]any{
+		"page":   Variable("page"),
+		"ids":    Variable("ids"),
+		"filter": map[string]any{"name": "a\"bé", "roles": []any{int64(1), int64(-2)}},
+		"order":  EnumValue("DESC"),
+	}
+	if !reflect.DeepEqual(list.Arguments, wantArgs) {
+		t.Fatalf("unexpected arguments %#v", list.Arguments)
+	}
+	if len(list.Directives) != 1 || list.Directives[0].Name != "include" || list.Directives[0].Arguments["if"] != Variable("flag") {
+		t.Fatalf("unexpected directives %+v", list.Directives)
+	}
+	if len(list.Selections) != 4 {
+		t.Fatalf("got %d selections", len(list.Selections))
+	}
+	if sel := list.Selections[1]; !sel.Inline || sel.TypeCondition != "User" || sel.Selections[0].Name != "name" {
+		t.Fatalf("unexpected inline fragment %+v", sel)
+	}
+	if sel := list.Selections[2]; !sel.Inline || sel.TypeCondition != "" || sel.Directives[0].Name != "skip" {
+		t.Fatalf("unexpected inline fragment without type condition %+v", sel)
+	}
+	if sel := list.Selections[3]; sel.FragmentName != "userFields" {
+		t.Fatalf("unexpected fragment spread %+v", sel)
+	}
+
+	stats := op.Selections[1]
+	wantArgs = map[string]any{
+		"ratio":   150.0,
+		"note":    `block "quoted" text`,
+		"active":  true,
+		"deleted": false,
+		"parent":  nil,
+	}
+	if !reflect.DeepEqual(stats.Arguments, wantArgs) || stats.Selections != nil {
+		t.Fatalf("unexpected scalar field %#v", stats)
+	}
+
+	fragment := doc.Fragments["userFields"]
+	if fragment.TypeCondition != "User" || fragment.Selections[0].Name != "email" {
+		t.Fatalf("unexpected fragment %+v", fragment)
+	}
+}
+
+func TestParseShorthandAndSeveralOperations(t *testing.T) {
+	doc, err := Parse(`{ a } query B { b } mutation C { c }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, op := range doc.Operations {
+		got = append(got, op.Type+":"+op.Name)
+	}
+	if want := []string{"query:", "query:B", "mutation:C"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"empty document":         ``,
+		"only fragments":         `fragment a on User { id }`,
+		"unterminated selection": `{ user { id }`,
+		"empty selection set":    `{ user { } }`,
+		"unterminated string":    `{ user(name: "abc) { id } }`,
+		"unterminated block":     `{ user(name: """abc) { id } }`,
+		"invalid escape":         `{ user(name: "a\qb") { id } }`,
+		"invalid unicode":        `{ user(name: "\u12G4") { id } }`,
+		"invalid number":         `{ user(id: -) { id } }`,
+		"invalid fraction":       `{ user(id: 1.) { id } }`,
+		"unexpected character":   `{ user(id: 1) { id % } }`,
+		"duplicate argument":     `{ user(id: 1, id: 2) { id } }`,
+		"duplicate fragment":     `{ id } fragment a on User { id } fragment a on User { id }`,
+		"fragment without on":    `{ id } fragment a User { id }`,
+		"variable in default":    `query ($a: Int = $b) { id }`,
+		"missing colon":          `query ($a Int) { id }`,
+		"unknown definition":     `schema { id }`,
+	}
+	for name, query := range cases {
+		doc, err := Parse(query)
+		var syntaxErr *SyntaxError
+		if doc != nil || !errors.As(err, &syntaxErr) {
+			t.Errorf("%s: expected a syntax error, got %v", name, err)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	_, err := Parse(`{ user(id: 1) { id % } }`)
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Pos != 19 {
+		t.Fatalf("expected a syntax error at offset 19, got %v", err)
+	}
+}
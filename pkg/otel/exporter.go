@@ -0,0 +1,228 @@
+package otel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportBatchSize = 512
+	exportQueueSize = 4096
+	exportInterval  = 5 * time.Second
+	exportTimeout   = 10 * time.Second
+)
+
+type Config struct {
+	// Endpoint OTLP/HTTP 地址，例如 http://localhost:4318，会自动补全 /v1/traces
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+}
+
+// Exporter batches ended spans and sends them to the collector in the background.
+// 队列满时直接丢弃，导出失败只通过 OnError 回调报告，不影响请求处理
+type Exporter struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+	queue       chan *Span
+	stop        chan struct{}
+	done        chan struct{}
+	OnError     func(err error)
+}
+
+func NewExporter(config Config) *Exporter {
+	url := strings.TrimRight(config.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = "new-api"
+	}
+	e := &Exporter{
+		url:         url,
+		headers:     config.Headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		queue:       make(chan *Span, exportQueueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Export queues an ended span, unsampled spans are dropped.
+func (e *Exporter) Export(span *Span) {
+	if span == nil || !span.context.Sampled {
+		return
+	}
+	select {
+	case e.queue <- span:
+	default:
+	}
+}
+
+// Shutdown flushes the queued spans and stops the background goroutine.
+func (e *Exporter) Shutdown() {
+	close(e.stop)
+	<-e.done
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, exportBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil && e.OnError != nil {
+			e.OnError(err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *Exporter) send(spans []*Span) error {
+	body, err := json.Marshal(e.buildRequest(spans))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp export failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP JSON 编码，字段名使用 lowerCamelCase，64 位整数编码为字符串，ID 编码为十六进制
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            map[string]any `json:"status,omitempty"`
+}
+
+func (e *Exporter) buildRequest(spans []*Span) map[string]any {
+	items := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		items = append(items, span.toOTLP())
+	}
+	return map[string]any{
+		"resourceSpans": []any{
+			map[string]any{
+				"resource": map[string]any{
+					"attributes": []otlpKeyValue{attribute("service.name", e.serviceName)},
+				},
+				"scopeSpans": []any{
+					map[string]any{
+						"scope": map[string]any{"name": "github.com/QuantumNous/new-api"},
+						"spans": items,
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *Span) toOTLP() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item := otlpSpan{
+		TraceId:           s.context.TraceID.String(),
+		SpanId:            s.context.SpanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parent.IsValid() {
+		item.ParentSpanId = s.parent.String()
+	}
+	for key, value := range s.attributes {
+		item.Attributes = append(item.Attributes, attribute(key, value))
+	}
+	if s.statusCode != 0 {
+		item.Status = map[string]any{"code": s.statusCode}
+		if s.statusMsg != "" {
+			item.Status["message"] = s.statusMsg
+		}
+	}
+	return item
+}
+
+func attribute(key string, value any) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	switch v := value.(type) {
+	case bool:
+		kv.Value = map[string]any{"boolValue": v}
+	case int:
+		kv.Value = map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		kv.Value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		kv.Value = map[string]any{"doubleValue": v}
+	case string:
+		kv.Value = map[string]any{"stringValue": v}
+	default:
+		kv.Value = map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+	return kv
+}
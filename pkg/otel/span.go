@@ -0,0 +1,171 @@
+// Package otel implements the small part of OpenTelemetry tracing the relay needs: W3C trace context
+// propagation and exporting spans to an OTLP/HTTP collector in the JSON encoding.
+package otel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SpanKind int
+
+// 与 OTLP 中 SpanKind 的取值一致
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+const (
+	statusCodeOk    = 1
+	statusCodeError = 2
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// ParseTraceparent parses a W3C traceparent header, only version 00 fields are read.
+func ParseTraceparent(header string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	return sc, true
+}
+
+// Traceparent formats the span context as a W3C traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+type Span struct {
+	mu         sync.Mutex
+	name       string
+	kind       SpanKind
+	context    SpanContext
+	parent     SpanID
+	start      time.Time
+	end        time.Time
+	attributes map[string]any
+	statusCode int
+	statusMsg  string
+	ended      bool
+}
+
+// NewSpan starts a span, it joins the trace of parent when parent is valid and starts a new trace otherwise.
+func NewSpan(name string, kind SpanKind, parent SpanContext, sampled bool) *Span {
+	span := &Span{
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]any),
+	}
+	if parent.IsValid() {
+		span.context.TraceID = parent.TraceID
+		span.parent = parent.SpanID
+	} else {
+		span.context.TraceID = newTraceID()
+	}
+	span.context.SpanID = newSpanID()
+	span.context.Sampled = sampled
+	return span
+}
+
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+// SetAttribute sets a string, bool, integer or float attribute.
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+func (s *Span) SetError(message string) {
+	s.mu.Lock()
+	s.statusCode = statusCodeError
+	s.statusMsg = message
+	s.mu.Unlock()
+}
+
+func (s *Span) SetOk() {
+	s.mu.Lock()
+	if s.statusCode != statusCodeError {
+		s.statusCode = statusCodeOk
+	}
+	s.mu.Unlock()
+}
+
+// End finishes the span and reports whether this call ended it, later calls are ignored.
+func (s *Span) End() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return false
+	}
+	s.ended = true
+	s.end = time.Now()
+	return true
+}
@@ -0,0 +1,44 @@
+package otel
+
+import "testing"
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(header)
+	if !ok {
+		t.Fatalf("expected %q to be parsed", header)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected span context: %+v", sc)
+	}
+	if sc.Traceparent() != header {
+		t.Fatalf("expected %q, got %q", header, sc.Traceparent())
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceparent(invalid); ok {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestNewSpanJoinsParentTrace(t *testing.T) {
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := NewSpan("test", SpanKindServer, parent, true)
+	if span.Context().TraceID != parent.TraceID || span.parent != parent.SpanID {
+		t.Fatalf("span does not join the parent trace")
+	}
+	if span.Context().SpanID == parent.SpanID || !span.Context().SpanID.IsValid() {
+		t.Fatalf("span id should be new")
+	}
+	if !span.End() || span.End() {
+		t.Fatalf("span should only end once")
+	}
+}
@@ -0,0 +1,111 @@
+// Package storage provides a small object storage abstraction with local file system and
+// S3 compatible (AWS S3, MinIO, R2, ...) drivers. Keys use "/" as separator on every driver.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+	DriverMinIO = "minio" // S3 driver with path-style addressing
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the object content, the caller must close it. ErrNotFound is returned for missing keys.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+type Config struct {
+	Driver string
+
+	LocalDir string
+
+	Endpoint        string // 为空时使用 AWS 官方地址
+	Region          string
+	Bucket          string
+	AccessKeyId     string
+	SecretAccessKey string
+	PathStyle       bool
+	// Prefix 所有对象键的公共前缀，便于多个实例共用一个存储桶
+	Prefix string
+}
+
+// New creates the storage described by the config.
+func New(config Config) (Storage, error) {
+	var s Storage
+	var err error
+	switch config.Driver {
+	case "", DriverLocal:
+		s, err = NewLocalStorage(config.LocalDir)
+	case DriverS3, DriverMinIO:
+		s, err = NewS3Storage(config)
+	default:
+		return nil, errors.New("unknown storage driver: " + config.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prefix := strings.Trim(config.Prefix, "/"); prefix != "" {
+		s = &prefixedStorage{Storage: s, prefix: prefix + "/"}
+	}
+	return s, nil
+}
+
+// validKey rejects keys escaping the storage root.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+type prefixedStorage struct {
+	Storage
+	prefix string
+}
+
+func (s *prefixedStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	return s.Storage.Put(ctx, s.prefix+key, data, contentType)
+}
+
+func (s *prefixedStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.Storage.Get(ctx, s.prefix+key)
+}
+
+func (s *prefixedStorage) Delete(ctx context.Context, key string) error {
+	return s.Storage.Delete(ctx, s.prefix+key)
+}
+
+func (s *prefixedStorage) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects, err := s.Storage.List(ctx, s.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		objects[i].Key = strings.TrimPrefix(objects[i].Key, s.prefix)
+	}
+	return objects, nil
+}
@@ -1,17 +1,21 @@
 package channel
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"strings"
 	"sync"
 	"time"
 
 	common2 "github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/otel"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -188,6 +192,49 @@ func applyHeaderOverrideToRequest(req *http.Request, headerOverride map[string]s
 	}
 }
 
+// requestGzipMinBytes 请求体超过该大小才压缩，较小的请求体压缩节省的传输时间抵不上压缩开销
+const requestGzipMinBytes = 16 * 1024
+
+// compressRequestBody gzip-compresses large request bodies for channels that accept compressed requests,
+// the sizes and time spent are recorded in the request trace.
+func compressRequestBody(c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (io.Reader, bool, error) {
+	if !info.ChannelSetting.RequestBodyGzip || requestBody == nil || !service.IsFeatureEnabled(c, operation_setting.FeatureFlagRequestBodyGzip) {
+		return requestBody, false, nil
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(body) < requestGzipMinBytes {
+		return bytes.NewReader(body), false, nil
+	}
+	start := time.Now()
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err = writer.Write(body); err != nil {
+		return nil, false, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, false, err
+	}
+	compressed := buf.Len() < len(body)
+	service.AddTraceEvent(c, service.TraceStageCompress, "request body compressed", map[string]any{
+		"channel_id":       info.ChannelId,
+		"encoding":         "gzip",
+		"original_bytes":   len(body),
+		"compressed_bytes": buf.Len(),
+		"compress_ms":      time.Since(start).Milliseconds(),
+		"applied":          compressed,
+	})
+	if !compressed {
+		return bytes.NewReader(body), false, nil
+	}
+	return &buf, true, nil
+}
+
 func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.GetRequestURL(info)
 	if err != nil {
@@ -196,6 +243,10 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if common2.DebugEnabled {
 		println("fullRequestURL:", fullRequestURL)
 	}
+	requestBody, compressed, err := compressRequestBody(c, info, requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("compress request body failed: %w", err)
+	}
 	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
@@ -206,6 +257,9 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	// 在 SetupRequestHeader 之后应用 Header Override，确保用户设置优先级最高
 	// 这样可以覆盖默认的 Authorization header 设置
 	headerOverride, err := processHeaderOverride(info, c)
@@ -255,6 +309,9 @@ func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBod
 }
 
 func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*websocket.Conn, error) {
+	if info.DryRun != nil {
+		return nil, common.ErrDryRunUnsupported
+	}
 	fullRequestURL, err := a.GetRequestURL(info)
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
@@ -264,6 +321,8 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 		"Sec-WebSocket-Key",
 		"Sec-WebSocket-Version",
 		"Sec-WebSocket-Extensions",
+		// 客户端可能通过子协议携带本站令牌，由 adaptor 使用渠道密钥重新生成
+		"Sec-WebSocket-Protocol",
 	})
 	err = a.SetupRequestHeader(c, &targetHeader, info)
 	if err != nil {
@@ -279,6 +338,9 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 		targetHeader.Set(key, value)
 	}
 	targetHeader.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	if targetHeader.Get(common2.RequestIdHeader) == "" && info.RequestId != "" {
+		targetHeader.Set(common2.RequestIdHeader, info.RequestId)
+	}
 	targetConn, _, err := websocket.DefaultDialer.Dial(fullRequestURL, targetHeader)
 	if err != nil {
 		return nil, fmt.Errorf("dial failed to %s: %w", fullRequestURL, err)
@@ -392,15 +454,16 @@ func DoRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	return doRequest(c, req, info)
 }
 func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http.Response, error) {
-	var client *http.Client
-	var err error
-	if info.ChannelSetting.Proxy != "" {
-		client, err = service.NewProxyHttpClient(info.ChannelSetting.Proxy)
-		if err != nil {
-			return nil, fmt.Errorf("new proxy http client failed: %w", err)
-		}
-	} else {
-		client = service.GetHttpClient()
+	if info.DryRun != nil {
+		return nil, info.DryRun.Record(info, req)
+	}
+	// 把请求 ID 带给上游，便于与上游日志对应，渠道的 Header Override 可以覆盖
+	if req.Header.Get(common2.RequestIdHeader) == "" && info.RequestId != "" {
+		req.Header.Set(common2.RequestIdHeader, info.RequestId)
+	}
+	client, err := service.GetChannelHttpClient(info.ChannelSetting)
+	if err != nil {
+		return nil, fmt.Errorf("new channel http client failed: %w", err)
 	}
 
 	var stopPinger context.CancelFunc
@@ -423,20 +486,95 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	// 管理员取消请求时中断上游调用
+	if ctx := service.GetInFlightContext(c); ctx != nil {
+		req = req.WithContext(ctx)
+	}
+	upstreamSpan := service.StartOtelSpan(c, "upstream request", otel.SpanKindClient)
+	if upstreamSpan != nil {
+		upstreamSpan.SetAttribute("http.request.method", req.Method)
+		upstreamSpan.SetAttribute("server.address", req.URL.Host)
+		upstreamSpan.SetAttribute("channel.id", info.ChannelId)
+		service.InjectOtelTraceparent(upstreamSpan, req.Header)
+	}
+	upstreamStart := time.Now()
+	var gotConn, firstByte time.Time
+	if service.HasLatencyBreakdown(c) {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotConn:              func(httptrace.GotConnInfo) { gotConn = time.Now() },
+			GotFirstResponseByte: func() { firstByte = time.Now() },
+		}))
+	}
+	// 渠道声明上游支持的压缩格式时主动协商，响应在返回前解压
+	if info.ChannelSetting.AcceptEncoding != "" && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", info.ChannelSetting.AcceptEncoding)
+	}
+	// 渠道测试不受熔断影响，也不计入熔断统计
+	if !info.IsChannelTest && !service.AllowChannelRequest(info.ChannelId) {
+		service.EndOtelSpan(upstreamSpan, errors.New("circuit open"))
+		return nil, service.NewCircuitOpenError(info.ChannelId)
+	}
 	resp, err := client.Do(req)
+	info.UpstreamLatency = time.Since(upstreamStart)
+	if !info.IsChannelTest {
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		service.RecordChannelResult(info.ChannelId, statusCode, err)
+	}
+	if !gotConn.IsZero() && !firstByte.IsZero() {
+		service.SetLatencyUpstream(c, gotConn.Sub(upstreamStart), firstByte.Sub(upstreamStart))
+	}
 	if err != nil {
+		service.EndOtelSpan(upstreamSpan, err)
 		logger.LogError(c, "do request failed: "+err.Error())
 		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
 	}
 	if resp == nil {
+		service.EndOtelSpan(upstreamSpan, errors.New("resp is nil"))
 		return nil, errors.New("resp is nil")
 	}
+	if upstreamSpan != nil {
+		upstreamSpan.SetAttribute("http.response.status_code", resp.StatusCode)
+		if resp.StatusCode >= http.StatusBadRequest {
+			upstreamSpan.SetError(resp.Status)
+		}
+		service.EndOtelSpan(upstreamSpan, nil)
+	}
+	if info.IsStream {
+		service.StartOtelStreamSpan(c, info.ChannelId)
+	}
+	if err = decodeUpstreamResponse(resp); err != nil {
+		_ = resp.Body.Close()
+		return nil, types.NewError(fmt.Errorf("decode upstream response failed: %w", err), types.ErrorCodeBadResponseBody)
+	}
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
 	return resp, nil
 }
 
+// decodeUpstreamResponse decodes a compressed upstream body, returned when the Accept-Encoding is set by the channel
+// or passed through from the client, so the handlers and the payload log see the plain body. The client gets the
+// decoded body, which the response compression middleware compresses again when it is enabled.
+func decodeUpstreamResponse(resp *http.Response) error {
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding == "" || strings.EqualFold(encoding, "identity") || !common2.IsSupportedContentEncoding(encoding) {
+		return nil
+	}
+	body, err := common2.NewContentDecoder(resp.Body, encoding)
+	if err != nil {
+		return err
+	}
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
 func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.BuildRequestURL(info)
 	if err != nil {
@@ -147,6 +147,9 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 	if a.ClientMode == ClientModeApiKey {
 		return channel.DoApiRequest(a, c, info, requestBody)
 	} else {
+		if info.DryRun != nil {
+			return nil, relaycommon.ErrDryRunUnsupported
+		}
 		return doAwsClientRequest(c, info, a, requestBody)
 	}
 }
@@ -411,22 +411,61 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 	}
 
 	claudeRequest.Prompt = ""
-	claudeRequest.Messages = claudeMessages
+	claudeRequest.Messages = trimAssistantPrefill(claudeMessages)
 	return &claudeRequest, nil
 }
 
-func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse) *dto.ChatCompletionsStreamResponse {
+// trimAssistantPrefill 末尾的 assistant 消息在 Claude 中作为续写前缀（prefill），
+// Claude 不接受以空白结尾的 prefill，这里去掉末尾空白，去掉后为空则丢弃该消息
+func trimAssistantPrefill(messages []dto.ClaudeMessage) []dto.ClaudeMessage {
+	if len(messages) == 0 {
+		return messages
+	}
+	last := &messages[len(messages)-1]
+	if last.Role != "assistant" {
+		return messages
+	}
+	if last.IsStringContent() {
+		text := strings.TrimRight(last.GetStringContent(), " \t\r\n")
+		if text == "" {
+			return messages[:len(messages)-1]
+		}
+		last.Content = text
+		return messages
+	}
+	contents, ok := last.Content.([]dto.ClaudeMediaMessage)
+	if !ok || len(contents) == 0 {
+		return messages
+	}
+	lastContent := &contents[len(contents)-1]
+	if lastContent.Type != "text" {
+		return messages
+	}
+	text := strings.TrimRight(lastContent.GetText(), " \t\r\n")
+	if text == "" {
+		contents = contents[:len(contents)-1]
+		if len(contents) == 0 {
+			return messages[:len(messages)-1]
+		}
+		last.Content = contents
+		return messages
+	}
+	lastContent.SetText(text)
+	return messages
+}
+
+// StreamResponseClaude2OpenAI converts a Claude stream event to an OpenAI chunk, toolCalls keeps the tool call
+// arguments of the stream so that the OpenAI deltas always concatenate to valid JSON.
+func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse, toolCalls *helper.ToolCallStream) *dto.ChatCompletionsStreamResponse {
 	var response dto.ChatCompletionsStreamResponse
 	response.Object = "chat.completion.chunk"
 	response.Model = claudeResponse.Model
 	response.Choices = make([]dto.ChatCompletionsStreamResponseChoice, 0)
 	tools := make([]dto.ToolCallResponse, 0)
-	fcIdx := 0
+	// content block 的 index 包含文本和思考块，OpenAI 的 index 按工具调用出现顺序从 0 开始
+	blockIdx := 0
 	if claudeResponse.Index != nil {
-		fcIdx = *claudeResponse.Index - 1
-		if fcIdx < 0 {
-			fcIdx = 0
-		}
+		blockIdx = *claudeResponse.Index
 	}
 	var choice dto.ChatCompletionsStreamResponseChoice
 	if reqMode == RequestModeCompletion {
@@ -452,7 +491,7 @@ func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse
 				}
 				if claudeResponse.ContentBlock.Type == "tool_use" {
 					tools = append(tools, dto.ToolCallResponse{
-						Index: common.GetPointer(fcIdx),
+						Index: common.GetPointer(toolCalls.Start(blockIdx)),
 						ID:    claudeResponse.ContentBlock.Id,
 						Type:  "function",
 						Function: dto.FunctionResponse{
@@ -469,11 +508,20 @@ func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse
 				choice.Delta.Content = claudeResponse.Delta.Text
 				switch claudeResponse.Delta.Type {
 				case "input_json_delta":
+					if claudeResponse.Delta.PartialJson == nil {
+						break
+					}
+					arguments := toolCalls.Append(blockIdx, *claudeResponse.Delta.PartialJson)
+					if arguments == "" {
+						// 空片段或只有不完整的转义序列，等待后续片段
+						return nil
+					}
+					fcIdx, _ := toolCalls.Index(blockIdx)
 					tools = append(tools, dto.ToolCallResponse{
 						Type:  "function",
 						Index: common.GetPointer(fcIdx),
 						Function: dto.FunctionResponse{
-							Arguments: *claudeResponse.Delta.PartialJson,
+							Arguments: arguments,
 						},
 					})
 				case "signature_delta":
@@ -492,6 +540,23 @@ func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse
 				}
 			}
 			//claudeUsage = &claudeResponse.Usage
+		} else if claudeResponse.Type == "content_block_stop" {
+			fcIdx, ok := toolCalls.Index(blockIdx)
+			if !ok {
+				return nil
+			}
+			// 补全空参数或被截断的参数
+			arguments := toolCalls.Finish(blockIdx)
+			if arguments == "" {
+				return nil
+			}
+			tools = append(tools, dto.ToolCallResponse{
+				Type:  "function",
+				Index: common.GetPointer(fcIdx),
+				Function: dto.FunctionResponse{
+					Arguments: arguments,
+				},
+			})
 		} else if claudeResponse.Type == "message_stop" {
 			return nil
 		} else {
@@ -588,6 +653,7 @@ type ClaudeResponseInfo struct {
 	ResponseText strings.Builder
 	Usage        *dto.Usage
 	Done         bool
+	ToolCalls    helper.ToolCallStream
 }
 
 func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeResponse, oaiResponse *dto.ChatCompletionsStreamResponse, claudeInfo *ClaudeResponseInfo) bool {
@@ -651,7 +717,7 @@ func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeRespons
 
 			// 判断是否完整
 			claudeInfo.Done = true
-		} else if claudeResponse.Type == "content_block_start" {
+		} else if claudeResponse.Type == "content_block_start" || claudeResponse.Type == "content_block_stop" {
 		} else {
 			return false
 		}
@@ -672,7 +738,7 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		return types.NewError(err, types.ErrorCodeBadResponseBody)
 	}
 	if claudeError := claudeResponse.GetClaudeError(); claudeError != nil && claudeError.Type != "" {
-		return types.WithClaudeError(*claudeError, http.StatusInternalServerError)
+		return types.NewClaudeStreamError(*claudeError)
 	}
 	if claudeResponse.StopReason != "" {
 		maybeMarkClaudeRefusal(c, claudeResponse.StopReason)
@@ -696,9 +762,9 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		}
 		helper.ClaudeChunkData(c, claudeResponse, data)
 	} else if info.RelayFormat == types.RelayFormatOpenAI {
-		response := StreamResponseClaude2OpenAI(requestMode, &claudeResponse)
+		response := StreamResponseClaude2OpenAI(requestMode, &claudeResponse, &claudeInfo.ToolCalls)
 
-		if !FormatClaudeResponseInfo(requestMode, &claudeResponse, response, claudeInfo) {
+		if !FormatClaudeResponseInfo(requestMode, &claudeResponse, response, claudeInfo) || response == nil {
 			return nil
 		}
 
@@ -711,6 +777,7 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 }
 
 func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, requestMode int) {
+	info.RecordUpstreamMetadata("", claudeInfo.Model, "")
 
 	if requestMode == RequestModeCompletion {
 		claudeInfo.Usage = service.ResponseText2Usage(c, claudeInfo.ResponseText.String(), info.UpstreamModelName, info.GetEstimatePromptTokens())
@@ -757,7 +824,10 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 		return true
 	})
 	if err != nil {
-		return nil, err
+		// 已经向客户端发送内容时，错误以事件发送后照常结束流
+		if err = helper.HandleStreamError(c, info, err); err != nil {
+			return nil, err
+		}
 	}
 
 	HandleStreamFinalResponse(c, info, claudeInfo, requestMode)
@@ -774,6 +844,7 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		return types.WithClaudeError(*claudeError, http.StatusInternalServerError)
 	}
 	maybeMarkClaudeRefusal(c, claudeResponse.StopReason)
+	info.RecordUpstreamMetadata("", claudeResponse.Model, "")
 	if requestMode == RequestModeCompletion {
 		claudeInfo.Usage = service.ResponseText2Usage(c, claudeResponse.Completion, info.UpstreamModelName, info.GetEstimatePromptTokens())
 	} else {
@@ -807,6 +878,7 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		c.Set("claude_web_search_requests", claudeResponse.Usage.ServerToolUse.WebSearchRequests)
 	}
 
+	service.SetUpstreamMetadataHeaders(c, info)
 	service.IOCopyBytesGracefully(c, httpResp, responseData)
 	return nil
 }
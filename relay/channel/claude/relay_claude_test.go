@@ -0,0 +1,60 @@
+package claude
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+)
+
+func TestRequestOpenAI2ClaudeMessage_AssistantPrefill(t *testing.T) {
+	cases := []struct {
+		name     string
+		prefill  string
+		count    int
+		lastText string
+	}{
+		{"trailing whitespace is trimmed", "Roses are \n", 4, "Roses are"},
+		{"blank prefill is dropped", " \n", 3, "write a poem "},
+		{"no prefill", "", 3, "write a poem "},
+	}
+	for _, tc := range cases {
+		request := dto.GeneralOpenAIRequest{Model: "m", Messages: []dto.Message{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello \n"},
+			{Role: "user", Content: "write a poem "},
+		}}
+		if tc.prefill != "" {
+			request.Messages = append(request.Messages, dto.Message{Role: "assistant", Content: tc.prefill})
+		}
+		claudeRequest, err := RequestOpenAI2ClaudeMessage(nil, request)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		messages := claudeRequest.Messages
+		if len(messages) != tc.count {
+			t.Fatalf("%s: got %d messages, want %d", tc.name, len(messages), tc.count)
+		}
+		if got := claudeText(messages[len(messages)-1]); got != tc.lastText {
+			t.Fatalf("%s: last message %q, want %q", tc.name, got, tc.lastText)
+		}
+		// 之前的 assistant 轮次不是前缀，保持原样
+		if got := claudeText(messages[1]); messages[1].Role != "assistant" || got != "hello \n" {
+			t.Fatalf("%s: earlier assistant turn changed to %q", tc.name, got)
+		}
+	}
+}
+
+func claudeText(message dto.ClaudeMessage) string {
+	if message.IsStringContent() {
+		return message.GetStringContent()
+	}
+	contents, _ := message.ParseContent()
+	text := ""
+	for _, content := range contents {
+		if text != "" {
+			text += "\n"
+		}
+		text += content.GetText()
+	}
+	return text
+}
@@ -40,6 +40,7 @@ func GeminiTextGenerationHandler(c *gin.Context, info *relaycommon.RelayInfo, re
 	if len(geminiResponse.Candidates) == 0 && geminiResponse.PromptFeedback != nil && geminiResponse.PromptFeedback.BlockReason != nil {
 		common.SetContextKey(c, constant.ContextKeyAdminRejectReason, fmt.Sprintf("gemini_block_reason=%s", *geminiResponse.PromptFeedback.BlockReason))
 	}
+	info.RecordUpstreamMetadata("", geminiResponse.ModelVersion, "")
 
 	// 计算使用量（基于 UsageMetadata）
 	usage := dto.Usage{
@@ -59,6 +60,7 @@ func GeminiTextGenerationHandler(c *gin.Context, info *relaycommon.RelayInfo, re
 		}
 	}
 
+	service.SetUpstreamMetadataHeaders(c, info)
 	service.IOCopyBytesGracefully(c, resp, responseBody)
 
 	return &usage, nil
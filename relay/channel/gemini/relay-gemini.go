@@ -624,6 +624,7 @@ func CovertOpenAI2Gemini(c *gin.Context, textRequest dto.GeneralOpenAIRequest, i
 			geminiRequest.Contents = append(geminiRequest.Contents, content)
 		}
 	}
+	geminiRequest.Contents = trimModelPrefill(geminiRequest.Contents)
 
 	if len(system_content) > 0 {
 		geminiRequest.SystemInstructions = &dto.GeminiChatContent{
@@ -638,6 +639,31 @@ func CovertOpenAI2Gemini(c *gin.Context, textRequest dto.GeneralOpenAIRequest, i
 	return &geminiRequest, nil
 }
 
+// trimModelPrefill 末尾的 model 消息在 Gemini 中作为续写前缀，模型接着其文本生成而不是另起一轮回复，
+// 与 Claude 的 prefill 一样去掉末尾空白，去掉后为空则丢弃该消息
+func trimModelPrefill(contents []dto.GeminiChatContent) []dto.GeminiChatContent {
+	if len(contents) == 0 {
+		return contents
+	}
+	last := &contents[len(contents)-1]
+	if last.Role != "model" || len(last.Parts) == 0 {
+		return contents
+	}
+	lastPart := &last.Parts[len(last.Parts)-1]
+	if lastPart.Text == "" || lastPart.Thought {
+		return contents
+	}
+	lastPart.Text = strings.TrimRight(lastPart.Text, " \t\r\n")
+	if lastPart.Text != "" {
+		return contents
+	}
+	last.Parts = last.Parts[:len(last.Parts)-1]
+	if len(last.Parts) == 0 {
+		return contents[:len(contents)-1]
+	}
+	return contents
+}
+
 // parseStopSequences 解析停止序列，支持字符串或字符串数组
 func parseStopSequences(stop any) []string {
 	if stop == nil {
@@ -995,6 +1021,10 @@ func getResponseToolCall(item *dto.GeminiPart) *dto.ToolCallResponse {
 	if err != nil {
 		return nil
 	}
+	// 无参数的函数调用 args 为空，OpenAI 客户端需要合法的 JSON 对象
+	if item.FunctionCall.Arguments == nil {
+		argsBytes = []byte("{}")
+	}
 	return &dto.ToolCallResponse{
 		ID:   fmt.Sprintf("call_%s", common.GetUUID()),
 		Type: "function",
@@ -1218,6 +1248,7 @@ func geminiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 	var usage = &dto.Usage{}
 	var imageCount int
 	responseText := strings.Builder{}
+	var streamErr *types.NewAPIError
 
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		var geminiResponse dto.GeminiChatResponse
@@ -1226,10 +1257,15 @@ func geminiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 			logger.LogError(c, "error unmarshalling stream response: "+err.Error())
 			return false
 		}
+		if geminiResponse.Error != nil {
+			streamErr = types.NewGeminiStreamError(geminiResponse.Error.Status, geminiResponse.Error.Message)
+			return false
+		}
 
 		if len(geminiResponse.Candidates) == 0 && geminiResponse.PromptFeedback != nil && geminiResponse.PromptFeedback.BlockReason != nil {
 			common.SetContextKey(c, constant.ContextKeyAdminRejectReason, fmt.Sprintf("gemini_block_reason=%s", *geminiResponse.PromptFeedback.BlockReason))
 		}
+		info.RecordUpstreamMetadata("", geminiResponse.ModelVersion, "")
 
 		// 统计图片数量
 		for _, candidate := range geminiResponse.Candidates {
@@ -1262,6 +1298,11 @@ func geminiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 		return callback(data, &geminiResponse)
 	})
 
+	// 已经向客户端发送内容时，错误以事件发送后照常结束流
+	if streamErr = helper.HandleStreamError(c, info, streamErr); streamErr != nil {
+		return nil, streamErr
+	}
+
 	if imageCount != 0 {
 		if usage.CompletionTokens == 0 {
 			usage.CompletionTokens = imageCount * 1400
@@ -1389,6 +1430,7 @@ func GeminiChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 	if err != nil {
 		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
 	}
+	info.RecordUpstreamMetadata("", geminiResponse.ModelVersion, "")
 	if len(geminiResponse.Candidates) == 0 {
 		usage := dto.Usage{
 			PromptTokens: geminiResponse.UsageMetadata.PromptTokenCount,
@@ -1477,6 +1519,7 @@ func GeminiChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 		break
 	}
 
+	service.SetUpstreamMetadataHeaders(c, info)
 	service.IOCopyBytesGracefully(c, resp, responseBody)
 
 	return &usage, nil
@@ -0,0 +1,50 @@
+package gemini
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+func TestCovertOpenAI2Gemini_ModelPrefill(t *testing.T) {
+	cases := []struct {
+		name     string
+		prefill  string
+		count    int
+		lastRole string
+		lastText string
+	}{
+		{"trailing model turn is continued", "Roses are \n", 4, "model", "Roses are"},
+		{"blank prefill is dropped", " \n", 3, "user", "write a poem "},
+		{"no prefill", "", 3, "user", "write a poem "},
+	}
+	for _, tc := range cases {
+		request := dto.GeneralOpenAIRequest{Model: "gemini-2.5-flash", Messages: []dto.Message{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello \n"},
+			{Role: "user", Content: "write a poem "},
+		}}
+		if tc.prefill != "" {
+			request.Messages = append(request.Messages, dto.Message{Role: "assistant", Content: tc.prefill})
+		}
+		info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{ChannelType: constant.ChannelTypeOpenAI, UpstreamModelName: request.Model}}
+		geminiRequest, err := CovertOpenAI2Gemini(nil, request, info)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		contents := geminiRequest.Contents
+		if len(contents) != tc.count {
+			t.Fatalf("%s: got %d contents, want %d", tc.name, len(contents), tc.count)
+		}
+		last := contents[len(contents)-1]
+		if last.Role != tc.lastRole || last.Parts[len(last.Parts)-1].Text != tc.lastText {
+			t.Fatalf("%s: last content %s %q, want %s %q", tc.name, last.Role, last.Parts[len(last.Parts)-1].Text, tc.lastRole, tc.lastText)
+		}
+		// 之前的 model 轮次不是前缀，保持原样
+		if contents[1].Role != "model" || contents[1].Parts[0].Text != "hello \n" {
+			t.Fatalf("%s: earlier model turn changed: %+v", tc.name, contents[1])
+		}
+	}
+}
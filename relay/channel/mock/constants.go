@@ -0,0 +1,10 @@
+package mock
+
+var ModelList = []string{
+	"mock-model", "mock-echo",
+}
+
+var ChannelName = "mock"
+
+// DefaultResponseTemplate is used when the channel does not configure mock_response_template.
+const DefaultResponseTemplate = "This is a mock response from {{model}}. You said: {{last_user_message}}"
@@ -0,0 +1,173 @@
+package mock
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renderResponseText 根据渠道配置的模板生成回复内容，mock-echo 模型直接回显最后一条用户消息
+func renderResponseText(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) string {
+	lastUserMessage := ""
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == "user" {
+			lastUserMessage = request.Messages[i].StringContent()
+			break
+		}
+	}
+	if request.Model == "mock-echo" {
+		return lastUserMessage
+	}
+	template := DefaultResponseTemplate
+	if info.ChannelOtherSettings.MockResponseTemplate != "" {
+		template = info.ChannelOtherSettings.MockResponseTemplate
+	}
+	replacer := strings.NewReplacer(
+		"{{model}}", request.Model,
+		"{{last_user_message}}", lastUserMessage,
+		"{{message_count}}", strconv.Itoa(len(request.Messages)),
+		"{{request_id}}", c.GetString(common.RequestIdKey),
+	)
+	return replacer.Replace(template)
+}
+
+func buildUsage(info *relaycommon.RelayInfo, text string, model string) dto.Usage {
+	promptTokens := info.GetEstimatePromptTokens()
+	completionTokens := service.CountTextToken(text, model)
+	return dto.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
+
+func newResponse(body io.ReadCloser, contentType string) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     header,
+		Body:       body,
+	}
+}
+
+func buildTextResponse(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*http.Response, error) {
+	text := renderResponseText(c, info, request)
+	response := dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Model:   request.Model,
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Choices: []dto.OpenAITextResponseChoice{
+			{
+				Index: 0,
+				Message: dto.Message{
+					Role:    "assistant",
+					Content: text,
+				},
+				FinishReason: constant.FinishReasonStop,
+			},
+		},
+		Usage: buildUsage(info, text, request.Model),
+	}
+	body, err := common.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return newResponse(io.NopCloser(bytes.NewReader(body)), "application/json"), nil
+}
+
+// splitTokens 按单词粗略切分，每个片段近似一个 token，保留原有空白
+func splitTokens(text string) []string {
+	pieces := make([]string, 0)
+	var current strings.Builder
+	for _, r := range text {
+		if unicode.IsSpace(r) && current.Len() > 0 {
+			pieces = append(pieces, current.String())
+			current.Reset()
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		pieces = append(pieces, current.String())
+	}
+	return pieces
+}
+
+// buildStreamResponse 以 SSE 形式输出回复，tokensPerSecond 大于 0 时按该速率限速
+func buildStreamResponse(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*http.Response, error) {
+	text := renderResponseText(c, info, request)
+	id := helper.GetResponseID(c)
+	createAt := common.GetTimestamp()
+	tokensPerSecond := info.ChannelOtherSettings.MockTokensPerSecond
+
+	reader, writer := io.Pipe()
+	ctx := c.Request.Context()
+	writeChunk := func(chunk any) error {
+		data, err := common.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(writer, "data: %s\n\n", data)
+		return err
+	}
+
+	go func() {
+		var err error
+		defer func() {
+			_ = writer.CloseWithError(err)
+		}()
+		if err = writeChunk(helper.GenerateStartEmptyResponse(id, createAt, request.Model, nil)); err != nil {
+			return
+		}
+		var interval time.Duration
+		if tokensPerSecond > 0 {
+			interval = time.Second / time.Duration(tokensPerSecond)
+		}
+		for _, piece := range splitTokens(text) {
+			if interval > 0 {
+				select {
+				case <-time.After(interval):
+				case <-ctx.Done():
+					err = ctx.Err()
+					return
+				}
+			}
+			chunk := dto.ChatCompletionsStreamResponse{
+				Id:      id,
+				Object:  "chat.completion.chunk",
+				Created: createAt,
+				Model:   request.Model,
+				Choices: []dto.ChatCompletionsStreamResponseChoice{{}},
+			}
+			chunk.Choices[0].Delta.SetContentString(piece)
+			if err = writeChunk(chunk); err != nil {
+				return
+			}
+		}
+		if err = writeChunk(helper.GenerateStopResponse(id, createAt, request.Model, constant.FinishReasonStop)); err != nil {
+			return
+		}
+		if err = writeChunk(helper.GenerateFinalUsageResponse(id, createAt, request.Model, buildUsage(info, text, request.Model))); err != nil {
+			return
+		}
+		_, err = io.WriteString(writer, "data: [DONE]\n\n")
+	}()
+
+	return newResponse(reader, "text/event-stream"), nil
+}
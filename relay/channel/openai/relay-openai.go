@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -116,16 +117,19 @@ func OaiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Re
 	var createAt int64 = 0
 	var systemFingerprint string
 	var containStreamUsage bool
-	var responseTextBuilder strings.Builder
 	var toolCount int
 	var usage = &dto.Usage{}
-	var streamItems []string // store stream items
+	// 上游不返回 usage 时按流经的输出文本计数
+	tokenCounter := service.NewStreamTokenCounter(info.UpstreamModelName)
 	var lastStreamData string
 	var secondLastStreamData string // 存储倒数第二个stream data，用于音频模型
 
 	// 检查是否为音频模型
 	isAudioModel := strings.Contains(strings.ToLower(model), "audio")
 
+	info.StreamCompletionTokens = func() int {
+		return tokenCounter.CountedTokens() + toolCount*7
+	}
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		if lastStreamData != "" {
 			err := HandleStreamFormat(c, info, lastStreamData, info.ChannelSetting.ForceFormat, info.ChannelSetting.ThinkingToContent)
@@ -140,7 +144,7 @@ func OaiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Re
 			}
 
 			lastStreamData = data
-			streamItems = append(streamItems, data)
+			countStreamItem(info.RelayMode, data, tokenCounter, &toolCount)
 		}
 		return true
 	})
@@ -176,14 +180,8 @@ func OaiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Re
 		}
 	}
 
-	// 处理token计算
-	if err := processTokens(info.RelayMode, streamItems, &responseTextBuilder, &toolCount); err != nil {
-		logger.LogError(c, "error processing tokens: "+err.Error())
-	}
-
 	if !containStreamUsage {
-		usage = service.ResponseText2Usage(c, responseTextBuilder.String(), info.UpstreamModelName, info.GetEstimatePromptTokens())
-		usage.CompletionTokens += toolCount * 7
+		usage = service.CompletionTokens2Usage(c, tokenCounter.Tokens()+toolCount*7, info.GetEstimatePromptTokens())
 	}
 
 	applyUsagePostProcessing(info, usage, common.StringToByteSlice(lastStreamData))
@@ -228,10 +226,15 @@ func OpenaiHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Respo
 	if oaiError := simpleResponse.GetOpenAIError(); oaiError != nil && oaiError.Type != "" {
 		return nil, types.WithOpenAIError(*oaiError, resp.StatusCode)
 	}
+	info.RecordUpstreamMetadata(simpleResponse.GetSystemFingerprint(), simpleResponse.Model, simpleResponse.Provider)
 
 	for _, choice := range simpleResponse.Choices {
 		if choice.FinishReason == constant.FinishReasonContentFilter {
 			common.SetContextKey(c, constant.ContextKeyAdminRejectReason, "openai_finish_reason=content_filter")
+			// 令牌允许内容过滤兜底时不返回被过滤的响应，由兜底渠道重新生成
+			if service.GetContentFilterFallback(c, info) != nil {
+				return nil, types.NewOpenAIError(fmt.Errorf("the response was blocked by the upstream content filter"), types.ErrorCodeContentFiltered, http.StatusBadRequest)
+			}
 			break
 		}
 	}
@@ -295,6 +298,7 @@ func OpenaiHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Respo
 		responseBody = geminiRespStr
 	}
 
+	service.SetUpstreamMetadataHeaders(c, info)
 	service.IOCopyBytesGracefully(c, resp, responseBody)
 
 	return &simpleResponse.Usage, nil
@@ -351,6 +355,8 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 	usage := &dto.RealtimeUsage{}
 	localUsage := &dto.RealtimeUsage{}
 	sumUsage := &dto.RealtimeUsage{}
+	// 客户端上传的输入音频时长（毫秒），两个读协程共享，随每次计费清零
+	var inputAudioMs atomic.Int64
 
 	gopool.Go(func() {
 		defer func() {
@@ -378,6 +384,7 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 					errChan <- fmt.Errorf("error unmarshalling message: %v", err)
 					return
 				}
+				common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedRequestBody, realtimeFrameForLog(realtimeEvent, message))
 
 				if realtimeEvent.Type == dto.RealtimeEventTypeSessionUpdate {
 					if realtimeEvent.Session != nil {
@@ -397,6 +404,9 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 				localUsage.InputTokens += textToken + audioToken
 				localUsage.InputTokenDetails.TextTokens += textToken
 				localUsage.InputTokenDetails.AudioTokens += audioToken
+				if seconds := service.RealtimeInputAudioSeconds(*realtimeEvent, info.InputAudioFormat); seconds > 0 {
+					inputAudioMs.Add(int64(seconds * 1000))
+				}
 
 				err = helper.WssString(c, targetConn, string(message))
 				if err != nil {
@@ -438,6 +448,7 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 					errChan <- fmt.Errorf("error unmarshalling message: %v", err)
 					return
 				}
+				common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedResponseBody, realtimeFrameForLog(realtimeEvent, message))
 
 				if realtimeEvent.Type == dto.RealtimeEventTypeResponseDone {
 					realtimeUsage := realtimeEvent.Response.Usage
@@ -450,6 +461,7 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 						usage.InputTokenDetails.TextTokens += realtimeUsage.InputTokenDetails.TextTokens
 						usage.OutputTokenDetails.AudioTokens += realtimeUsage.OutputTokenDetails.AudioTokens
 						usage.OutputTokenDetails.TextTokens += realtimeUsage.OutputTokenDetails.TextTokens
+						usage.InputAudioSeconds += float64(inputAudioMs.Swap(0)) / 1000
 						err := preConsumeUsage(c, info, usage, sumUsage)
 						if err != nil {
 							errChan <- fmt.Errorf("error consume usage: %v", err)
@@ -471,6 +483,7 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 						localUsage.InputTokens += textToken + audioToken
 						localUsage.InputTokenDetails.TextTokens += textToken
 						localUsage.InputTokenDetails.AudioTokens += audioToken
+						localUsage.InputAudioSeconds += float64(inputAudioMs.Swap(0)) / 1000
 						err = preConsumeUsage(c, info, localUsage, sumUsage)
 						if err != nil {
 							errChan <- fmt.Errorf("error consume usage: %v", err)
@@ -531,7 +544,8 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 		_ = preConsumeUsage(c, info, usage, sumUsage)
 	}
 
-	if localUsage.TotalTokens != 0 {
+	localUsage.InputAudioSeconds += float64(inputAudioMs.Swap(0)) / 1000
+	if localUsage.TotalTokens != 0 || localUsage.InputAudioSeconds > 0 {
 		_ = preConsumeUsage(c, info, localUsage, sumUsage)
 	}
 
@@ -540,6 +554,28 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.
 	return nil, sumUsage
 }
 
+// realtimeFrameForLog 返回记录到日志中的帧内容，音频帧只保留事件类型与音频长度，避免 base64 音频撑大日志
+func realtimeFrameForLog(event *dto.RealtimeEvent, message []byte) string {
+	var audio string
+	switch event.Type {
+	case dto.RealtimeEventInputAudioBufferAppend:
+		audio = event.Audio
+	case dto.RealtimeEventResponseAudioDelta:
+		audio = event.Delta
+	default:
+		return string(message)
+	}
+	frame, err := common.Marshal(map[string]any{
+		"type":     event.Type,
+		"event_id": event.EventId,
+		"audio":    fmt.Sprintf("[%d bytes base64 audio omitted]", len(audio)),
+	})
+	if err != nil {
+		return ""
+	}
+	return string(frame)
+}
+
 func preConsumeUsage(ctx *gin.Context, info *relaycommon.RelayInfo, usage *dto.RealtimeUsage, totalUsage *dto.RealtimeUsage) error {
 	if usage == nil || totalUsage == nil {
 		return fmt.Errorf("invalid usage pointer")
@@ -553,6 +589,7 @@ func preConsumeUsage(ctx *gin.Context, info *relaycommon.RelayInfo, usage *dto.R
 	totalUsage.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
 	totalUsage.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
 	totalUsage.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
+	totalUsage.InputAudioSeconds += usage.InputAudioSeconds
 	// clear usage
 	err := service.PreWssConsumeQuota(ctx, info, usage)
 	return err
@@ -627,7 +664,49 @@ func applyUsagePostProcessing(info *relaycommon.RelayInfo, usage *dto.Usage, res
 				usage.PromptTokensDetails.CachedTokens = usage.PromptCacheHitTokens
 			}
 		}
+	default:
+		// 部分兼容 OpenAI 的上游（如转发 Claude 的网关）按 Anthropic 的字段报告缓存读写 token
+		if usage.PromptTokensDetails.CachedTokens == 0 && usage.PromptTokensDetails.CachedCreationTokens == 0 {
+			if cacheRead, cacheCreation, ok := extractAnthropicCacheTokensFromBody(responseBody); ok {
+				usage.PromptTokensDetails.CachedTokens = cacheRead
+				usage.PromptTokensDetails.CachedCreationTokens = cacheCreation
+			} else if usage.InputTokensDetails != nil && usage.InputTokensDetails.CachedTokens > 0 {
+				usage.PromptTokensDetails.CachedTokens = usage.InputTokensDetails.CachedTokens
+			} else if usage.PromptCacheHitTokens > 0 {
+				usage.PromptTokensDetails.CachedTokens = usage.PromptCacheHitTokens
+			}
+		}
+	}
+}
+
+// extractAnthropicCacheTokensFromBody 提取 usage 中 Anthropic 格式的缓存字段：
+// {"usage":{"cache_read_input_tokens":100,"cache_creation_input_tokens":20}}
+func extractAnthropicCacheTokensFromBody(body []byte) (int, int, bool) {
+	if len(body) == 0 {
+		return 0, 0, false
+	}
+
+	var payload struct {
+		Usage struct {
+			CacheReadInputTokens     *int `json:"cache_read_input_tokens"`
+			CacheCreationInputTokens *int `json:"cache_creation_input_tokens"`
+		} `json:"usage"`
+	}
+
+	if err := common.Unmarshal(body, &payload); err != nil {
+		return 0, 0, false
+	}
+	if payload.Usage.CacheReadInputTokens == nil && payload.Usage.CacheCreationInputTokens == nil {
+		return 0, 0, false
+	}
+	var cacheRead, cacheCreation int
+	if payload.Usage.CacheReadInputTokens != nil {
+		cacheRead = *payload.Usage.CacheReadInputTokens
+	}
+	if payload.Usage.CacheCreationInputTokens != nil {
+		cacheCreation = *payload.Usage.CacheCreationInputTokens
 	}
+	return cacheRead, cacheCreation, true
 }
 
 func extractCachedTokensFromBody(body []byte) (int, bool) {
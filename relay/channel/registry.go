@@ -0,0 +1,176 @@
+package channel
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	common2 "github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+// 适配器注册表
+//
+// 内置适配器在 relay 包的 init 中注册；第三方适配器在自己包的 init 中调用 RegisterAdaptor，
+// 并通过带 build tag 的文件编译进来，例如 relay/plugin_myadaptor.go：
+//
+//	//go:build myadaptor
+//
+//	package relay
+//
+//	import _ "example.com/new-api-myadaptor"
+//
+// 使用 go build -tags myadaptor 构建即可启用。管理后台通过 /api/channel/adaptors 发现第三方适配器，
+// 并根据 ConfigSchema 渲染渠道配置表单，配置保存在渠道 settings 的 adaptor_config 中。
+
+type AdaptorCapability string
+
+const (
+	AdaptorCapabilityStream    AdaptorCapability = "stream"
+	AdaptorCapabilityTools     AdaptorCapability = "tools"
+	AdaptorCapabilityVision    AdaptorCapability = "vision"
+	AdaptorCapabilityEmbedding AdaptorCapability = "embedding"
+	AdaptorCapabilityImage     AdaptorCapability = "image"
+	AdaptorCapabilityAudio     AdaptorCapability = "audio"
+	AdaptorCapabilityRealtime  AdaptorCapability = "realtime"
+)
+
+const (
+	AdaptorConfigFieldString = "string"
+	AdaptorConfigFieldSecret = "secret"
+	AdaptorConfigFieldNumber = "number"
+	AdaptorConfigFieldBool   = "bool"
+	AdaptorConfigFieldSelect = "select"
+)
+
+// AdaptorConfigField 渠道配置表单中的一项
+type AdaptorConfigField struct {
+	Key         string   `json:"key"`
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Default     any      `json:"default,omitempty"`
+	Options     []string `json:"options,omitempty"` // select 的可选值
+	Description string   `json:"description,omitempty"`
+}
+
+// AdaptorMeta 描述一个适配器，Builtin 为 false 的适配器需要使用插件保留的 API 类型与渠道类型
+type AdaptorMeta struct {
+	APIType      int                     `json:"api_type"`
+	Name         string                  `json:"name"`
+	ChannelTypes []int                   `json:"channel_types,omitempty"`
+	BaseURL      string                  `json:"base_url,omitempty"`
+	Endpoints    []constant.EndpointType `json:"endpoints,omitempty"`
+	Capabilities []AdaptorCapability     `json:"capabilities,omitempty"`
+	ConfigSchema []AdaptorConfigField    `json:"config_schema,omitempty"`
+	Builtin      bool                    `json:"builtin"`
+}
+
+type registeredAdaptor struct {
+	meta    AdaptorMeta
+	factory func() Adaptor
+}
+
+// adaptorRegistry 只在 init 阶段写入，之后只读
+var adaptorRegistry = map[int]registeredAdaptor{}
+
+// RegisterAdaptor registers an adaptor factory under meta.APIType, it panics on invalid or duplicate
+// registrations so a broken plugin fails at startup instead of at request time.
+func RegisterAdaptor(meta AdaptorMeta, factory func() Adaptor) {
+	if factory == nil {
+		panic(fmt.Sprintf("adaptor %d: nil factory", meta.APIType))
+	}
+	if _, exists := adaptorRegistry[meta.APIType]; exists {
+		panic(fmt.Sprintf("adaptor %d: already registered", meta.APIType))
+	}
+	if meta.Name == "" {
+		meta.Name = factory().GetChannelName()
+	}
+	if !meta.Builtin {
+		if meta.APIType < constant.APITypePluginBase {
+			panic(fmt.Sprintf("adaptor %s: api type must be at least %d", meta.Name, constant.APITypePluginBase))
+		}
+		if len(meta.ChannelTypes) == 0 {
+			panic(fmt.Sprintf("adaptor %s: no channel type", meta.Name))
+		}
+		for _, channelType := range meta.ChannelTypes {
+			if channelType < constant.ChannelTypePluginBase {
+				panic(fmt.Sprintf("adaptor %s: channel type must be at least %d", meta.Name, constant.ChannelTypePluginBase))
+			}
+			if apiType, ok := common2.ChannelType2APIType(channelType); ok {
+				panic(fmt.Sprintf("adaptor %s: channel type %d is already served by api type %d", meta.Name, channelType, apiType))
+			}
+			constant.RegisterPluginChannel(channelType, meta.Name, meta.BaseURL)
+			common2.RegisterPluginChannelAPIType(channelType, meta.APIType, meta.Endpoints)
+		}
+	}
+	adaptorRegistry[meta.APIType] = registeredAdaptor{meta: meta, factory: factory}
+}
+
+// NewAdaptor returns a fresh adaptor for the api type, nil if none is registered.
+func NewAdaptor(apiType int) Adaptor {
+	registered, ok := adaptorRegistry[apiType]
+	if !ok {
+		return nil
+	}
+	return registered.factory()
+}
+
+func GetAdaptorMeta(apiType int) (AdaptorMeta, bool) {
+	registered, ok := adaptorRegistry[apiType]
+	return registered.meta, ok
+}
+
+// RegisteredAdaptors lists the metadata of every registered adaptor ordered by api type.
+func RegisteredAdaptors() []AdaptorMeta {
+	metas := make([]AdaptorMeta, 0, len(adaptorRegistry))
+	for _, registered := range adaptorRegistry {
+		metas = append(metas, registered.meta)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].APIType < metas[j].APIType
+	})
+	return metas
+}
+
+// ValidateAdaptorConfig checks the adaptor_config of a channel against the config schema of its adaptor.
+func ValidateAdaptorConfig(channelType int, config map[string]any) error {
+	apiType, ok := common2.ChannelType2APIType(channelType)
+	if !ok {
+		return nil
+	}
+	meta, ok := GetAdaptorMeta(apiType)
+	if !ok {
+		return nil
+	}
+	for _, field := range meta.ConfigSchema {
+		value, exists := config[field.Key]
+		if !exists || value == nil || value == "" {
+			if field.Required {
+				return fmt.Errorf("%s 不能为空", field.Key)
+			}
+			continue
+		}
+		switch field.Type {
+		case AdaptorConfigFieldNumber:
+			if _, ok := value.(float64); !ok {
+				return fmt.Errorf("%s 必须是数字", field.Key)
+			}
+		case AdaptorConfigFieldBool:
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("%s 必须是布尔值", field.Key)
+			}
+		case AdaptorConfigFieldSelect:
+			str, _ := value.(string)
+			if !slices.Contains(field.Options, str) {
+				return fmt.Errorf("%s 必须是 %s 之一", field.Key, strings.Join(field.Options, ", "))
+			}
+		default:
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s 必须是字符串", field.Key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package channel
+
+import (
+	"testing"
+
+	common2 "github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+type stubAdaptor struct {
+	Adaptor
+}
+
+func TestRegisterAdaptor_PluginChannelAndConfigSchema(t *testing.T) {
+	apiType := constant.APITypePluginBase + 99
+	channelType := constant.ChannelTypePluginBase + 99
+	RegisterAdaptor(AdaptorMeta{
+		APIType:      apiType,
+		Name:         "stub",
+		ChannelTypes: []int{channelType},
+		BaseURL:      "https://stub.example.com",
+		ConfigSchema: []AdaptorConfigField{
+			{Key: "region", Type: AdaptorConfigFieldSelect, Required: true, Options: []string{"us", "eu"}},
+			{Key: "timeout", Type: AdaptorConfigFieldNumber},
+		},
+	}, func() Adaptor { return &stubAdaptor{} })
+
+	if got, ok := common2.ChannelType2APIType(channelType); !ok || got != apiType {
+		t.Fatalf("ChannelType2APIType = %d, %v, want %d", got, ok, apiType)
+	}
+	if got := constant.GetChannelBaseURL(channelType); got != "https://stub.example.com" {
+		t.Fatalf("GetChannelBaseURL = %q", got)
+	}
+	if NewAdaptor(apiType) == nil {
+		t.Fatal("NewAdaptor returned nil for registered plugin")
+	}
+
+	if err := ValidateAdaptorConfig(channelType, map[string]any{}); err == nil {
+		t.Fatal("expected error for missing required field")
+	}
+	if err := ValidateAdaptorConfig(channelType, map[string]any{"region": "asia"}); err == nil {
+		t.Fatal("expected error for value outside options")
+	}
+	if err := ValidateAdaptorConfig(channelType, map[string]any{"region": "eu", "timeout": "10"}); err == nil {
+		t.Fatal("expected error for non-number value")
+	}
+	if err := ValidateAdaptorConfig(channelType, map[string]any{"region": "eu", "timeout": float64(10)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for duplicate registration")
+		}
+	}()
+	RegisterAdaptor(AdaptorMeta{APIType: apiType, Name: "stub", ChannelTypes: []int{channelType + 1}}, func() Adaptor { return &stubAdaptor{} })
+}
@@ -0,0 +1,16 @@
+package selfhosted
+
+import "github.com/QuantumNous/new-api/relay/channel/openai"
+
+// Adaptor 自建推理服务（vLLM、TGI、llama.cpp）均提供 OpenAI 兼容接口，请求和响应沿用 OpenAI 的处理流程
+type Adaptor struct {
+	openai.Adaptor
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return channelNames[a.ChannelType]
+}
@@ -0,0 +1,18 @@
+package selfhosted
+
+import "github.com/QuantumNous/new-api/constant"
+
+// 自建推理服务加载的模型由服务端决定，通过 FetchServerInfo 获取
+var ModelList = []string{}
+
+var channelNames = map[int]string{
+	constant.ChannelTypeVLLM:     "vllm",
+	constant.ChannelTypeTGI:      "tgi",
+	constant.ChannelTypeLlamaCpp: "llama.cpp",
+}
+
+// IsSelfHostedChannel reports whether the channel type is a self-hosted inference server.
+func IsSelfHostedChannel(channelType int) bool {
+	_, ok := channelNames[channelType]
+	return ok
+}
@@ -0,0 +1,228 @@
+package selfhosted
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+// ServerInfo 自建推理服务的健康状态、已加载模型及运行指标
+type ServerInfo struct {
+	ServerType       string             `json:"server_type"`
+	Healthy          bool               `json:"healthy"`
+	HealthError      string             `json:"health_error,omitempty"`
+	Models           []string           `json:"models"`
+	MaxContextLength int                `json:"max_context_length"`
+	Metrics          map[string]float64 `json:"metrics,omitempty"`
+}
+
+// 各服务 /metrics 中用于展示负载的指标，同名不同标签的值会被累加
+var trackedMetrics = map[int][]string{
+	constant.ChannelTypeVLLM: {
+		"vllm:num_requests_running",
+		"vllm:num_requests_waiting",
+		"vllm:gpu_cache_usage_perc",
+		"vllm:kv_cache_usage_perc",
+	},
+	constant.ChannelTypeTGI: {
+		"tgi_queue_size",
+		"tgi_batch_current_size",
+		"tgi_batch_current_max_tokens",
+	},
+	constant.ChannelTypeLlamaCpp: {
+		"llamacpp:requests_processing",
+		"llamacpp:requests_deferred",
+		"llamacpp:kv_cache_usage_ratio",
+	},
+}
+
+type openAIModelsResponse struct {
+	Data []struct {
+		Id          string `json:"id"`
+		MaxModelLen int    `json:"max_model_len"` // vLLM
+		Meta        *struct {
+			NCtxTrain int `json:"n_ctx_train"`
+		} `json:"meta,omitempty"` // llama.cpp
+	} `json:"data"`
+}
+
+// tgiInfoResponse TGI /info，旧版本使用 max_input_length
+type tgiInfoResponse struct {
+	ModelId        string `json:"model_id"`
+	MaxInputTokens int    `json:"max_input_tokens"`
+	MaxInputLength int    `json:"max_input_length"`
+	MaxTotalTokens int    `json:"max_total_tokens"`
+}
+
+type llamaCppPropsResponse struct {
+	ModelPath                 string `json:"model_path"`
+	DefaultGenerationSettings struct {
+		NCtx int `json:"n_ctx"`
+	} `json:"default_generation_settings"`
+}
+
+func getServerResource(client *http.Client, baseURL string, key string, path string) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(baseURL, "/")+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	if key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("请求 %s 失败: %v", path, err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 响应失败: %v", path, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("%s 返回状态码 %d: %s", path, response.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+func getServerJSON(client *http.Client, baseURL string, key string, path string, v any) error {
+	body, err := getServerResource(client, baseURL, key, path)
+	if err != nil {
+		return err
+	}
+	if err = common.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("解析 %s 响应失败: %v", path, err)
+	}
+	return nil
+}
+
+// FetchServerInfo queries the health, model and metrics endpoints of a self-hosted inference server.
+// Only a failure to determine the loaded models is returned as an error, health and metrics are best effort.
+func FetchServerInfo(client *http.Client, channelType int, baseURL string, key string) (*ServerInfo, error) {
+	if !IsSelfHostedChannel(channelType) {
+		return nil, fmt.Errorf("channel type %d is not a self-hosted inference server", channelType)
+	}
+	info := &ServerInfo{
+		ServerType: channelNames[channelType],
+		Models:     []string{},
+	}
+
+	if _, err := getServerResource(client, baseURL, key, "/health"); err != nil {
+		info.HealthError = err.Error()
+	} else {
+		info.Healthy = true
+	}
+
+	var err error
+	switch channelType {
+	case constant.ChannelTypeTGI:
+		err = fetchTGIInfo(client, baseURL, key, info)
+	case constant.ChannelTypeLlamaCpp:
+		err = fetchLlamaCppInfo(client, baseURL, key, info)
+	default:
+		err = fetchOpenAIModels(client, baseURL, key, info)
+	}
+	if err != nil {
+		return info, err
+	}
+
+	if body, metricsErr := getServerResource(client, baseURL, key, "/metrics"); metricsErr == nil {
+		info.Metrics = parsePrometheusMetrics(string(body), trackedMetrics[channelType])
+	}
+	return info, nil
+}
+
+// fetchOpenAIModels reads /v1/models, vLLM reports the context length of each model as max_model_len.
+func fetchOpenAIModels(client *http.Client, baseURL string, key string, info *ServerInfo) error {
+	var models openAIModelsResponse
+	if err := getServerJSON(client, baseURL, key, "/v1/models", &models); err != nil {
+		return err
+	}
+	for _, model := range models.Data {
+		info.Models = append(info.Models, model.Id)
+		contextLength := model.MaxModelLen
+		if contextLength == 0 && model.Meta != nil {
+			contextLength = model.Meta.NCtxTrain
+		}
+		if contextLength > info.MaxContextLength {
+			info.MaxContextLength = contextLength
+		}
+	}
+	return nil
+}
+
+func fetchTGIInfo(client *http.Client, baseURL string, key string, info *ServerInfo) error {
+	var tgiInfo tgiInfoResponse
+	if err := getServerJSON(client, baseURL, key, "/info", &tgiInfo); err != nil {
+		return err
+	}
+	if tgiInfo.ModelId != "" {
+		info.Models = append(info.Models, tgiInfo.ModelId)
+	}
+	info.MaxContextLength = tgiInfo.MaxTotalTokens
+	if info.MaxContextLength == 0 {
+		info.MaxContextLength = common.Max(tgiInfo.MaxInputTokens, tgiInfo.MaxInputLength)
+	}
+	return nil
+}
+
+// fetchLlamaCppInfo prefers the context size the server was started with (n_ctx) over the trained one.
+func fetchLlamaCppInfo(client *http.Client, baseURL string, key string, info *ServerInfo) error {
+	modelsErr := fetchOpenAIModels(client, baseURL, key, info)
+	var props llamaCppPropsResponse
+	if err := getServerJSON(client, baseURL, key, "/props", &props); err != nil {
+		if modelsErr != nil {
+			return modelsErr
+		}
+		return nil
+	}
+	if props.DefaultGenerationSettings.NCtx > 0 {
+		info.MaxContextLength = props.DefaultGenerationSettings.NCtx
+	}
+	if len(info.Models) == 0 && props.ModelPath != "" {
+		info.Models = append(info.Models, filepath.Base(props.ModelPath))
+	}
+	return nil
+}
+
+// parsePrometheusMetrics sums the samples of the given metric names in the Prometheus text format.
+func parsePrometheusMetrics(text string, names []string) map[string]float64 {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	metrics := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		nameEnd := strings.IndexAny(line, "{ ")
+		if nameEnd <= 0 || !wanted[line[:nameEnd]] {
+			continue
+		}
+		sample := line
+		if idx := strings.LastIndex(sample, "}"); idx >= 0 {
+			sample = sample[idx+1:]
+		} else {
+			sample = sample[nameEnd:]
+		}
+		fields := strings.Fields(sample)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		metrics[line[:nameEnd]] += value
+	}
+	return metrics
+}
@@ -0,0 +1,34 @@
+package selfhosted
+
+import "testing"
+
+func TestParsePrometheusMetrics_SumsLabelledSamples(t *testing.T) {
+	text := `# HELP vllm:num_requests_waiting Number of requests waiting to be processed.
+# TYPE vllm:num_requests_waiting gauge
+vllm:num_requests_waiting{model_name="llama-3-8b"} 3.0
+vllm:num_requests_waiting{model_name="qwen2-7b"} 2.0
+vllm:num_requests_running{model_name="llama-3-8b"} 1.0
+vllm:num_requests_running_total 100
+vllm:gpu_cache_usage_perc 0.25 1718000000000
+vllm:prompt_tokens_total{model_name="llama-3-8b"} 1234
+`
+	metrics := parsePrometheusMetrics(text, []string{
+		"vllm:num_requests_waiting",
+		"vllm:num_requests_running",
+		"vllm:gpu_cache_usage_perc",
+	})
+
+	expected := map[string]float64{
+		"vllm:num_requests_waiting": 5,
+		"vllm:num_requests_running": 1,
+		"vllm:gpu_cache_usage_perc": 0.25,
+	}
+	if len(metrics) != len(expected) {
+		t.Fatalf("expected %d metrics, got %v", len(expected), metrics)
+	}
+	for name, value := range expected {
+		if metrics[name] != value {
+			t.Fatalf("metric %s: expected %v, got %v", name, value, metrics[name])
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package stability
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Adaptor 对接 Stability AI v2beta 图片接口：生成使用 stable-image/generate，编辑使用 stable-image/edit/inpaint。
+// 上游每次只生成一张图片并返回 base64，客户端要求链接时由图片转存统一转换。
+type Adaptor struct {
+	contentType string
+}
+
+func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
+}
+
+func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	baseURL := info.ChannelBaseUrl
+	if baseURL == "" {
+		baseURL = constant.ChannelBaseURLs[constant.ChannelTypeStability]
+	}
+	switch info.RelayMode {
+	case relayconstant.RelayModeImagesGenerations:
+		return relaycommon.GetFullRequestURL(baseURL, "/v2beta/stable-image/generate/"+generateEndpoint(info.UpstreamModelName), info.ChannelType), nil
+	case relayconstant.RelayModeImagesEdits:
+		return relaycommon.GetFullRequestURL(baseURL, "/v2beta/stable-image/edit/inpaint", info.ChannelType), nil
+	}
+	return "", fmt.Errorf("stability adaptor: unsupported relay mode %d", info.RelayMode)
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *relaycommon.RelayInfo) error {
+	req.Set("Authorization", "Bearer "+info.ApiKey)
+	req.Set("Content-Type", a.contentType)
+	req.Set("Accept", "application/json")
+	return nil
+}
+
+// generateEndpoint returns the generate endpoint of the model, the sd3 models share one endpoint selected by the model field.
+func generateEndpoint(modelName string) string {
+	switch modelName {
+	case ModelStableImageUltra:
+		return "ultra"
+	case ModelStableImageCore:
+		return "core"
+	}
+	return "sd3"
+}
+
+// mapSizeToAspectRatio returns the supported aspect ratio closest to an OpenAI size such as 1792x1024.
+func mapSizeToAspectRatio(size string) (string, bool) {
+	width, height, found := strings.Cut(size, "x")
+	if !found {
+		return "", false
+	}
+	w, err1 := strconv.Atoi(strings.TrimSpace(width))
+	h, err2 := strconv.Atoi(strings.TrimSpace(height))
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return "", false
+	}
+	target := math.Log(float64(w) / float64(h))
+	best, bestDiff := "", math.MaxFloat64
+	for _, ratio := range supportedAspectRatios {
+		rw, rh, _ := strings.Cut(ratio, ":")
+		fw, _ := strconv.ParseFloat(rw, 64)
+		fh, _ := strconv.ParseFloat(rh, 64)
+		if diff := math.Abs(math.Log(fw/fh) - target); diff < bestDiff {
+			best, bestDiff = ratio, diff
+		}
+	}
+	return best, true
+}
+
+func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	if strings.TrimSpace(request.Prompt) == "" {
+		return nil, errors.New("stability adaptor: prompt is required")
+	}
+	if request.N > 1 {
+		return nil, errors.New("stability adaptor: only one image can be generated per request, n must be 1")
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"prompt": request.Prompt,
+	}
+	if len(request.OutputFormat) > 0 {
+		var outputFormat string
+		if err := json.Unmarshal(request.OutputFormat, &outputFormat); err == nil && outputFormat != "" {
+			fields["output_format"] = outputFormat
+		}
+	}
+	// negative_prompt、seed、style_preset 等上游参数直接透传
+	for key, raw := range request.Extra {
+		var value any
+		if err := common.Unmarshal(raw, &value); err != nil {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			fields[key] = v
+		case float64, bool:
+			fields[key] = fmt.Sprint(v)
+		}
+	}
+
+	switch info.RelayMode {
+	case relayconstant.RelayModeImagesGenerations:
+		if ratio, ok := mapSizeToAspectRatio(request.Size); ok {
+			fields["aspect_ratio"] = ratio
+		}
+		if generateEndpoint(info.UpstreamModelName) == "sd3" {
+			fields["model"] = info.UpstreamModelName
+		}
+	case relayconstant.RelayModeImagesEdits:
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, fmt.Errorf("stability adaptor: parse multipart form failed: %w", err)
+		}
+		for _, key := range []string{"negative_prompt", "seed", "grow_mask", "output_format"} {
+			if value := form.Value[key]; len(value) > 0 && value[0] != "" {
+				fields[key] = value[0]
+			}
+		}
+		image := firstFile(form, "image", "image[]")
+		if image == nil {
+			return nil, errors.New("stability adaptor: image is required")
+		}
+		if err = writeFormFile(writer, "image", image); err != nil {
+			return nil, err
+		}
+		if mask := firstFile(form, "mask"); mask != nil {
+			if err = writeFormFile(writer, "mask", mask); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("stability adaptor: unsupported relay mode %d", info.RelayMode)
+	}
+
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	a.contentType = writer.FormDataContentType()
+	return &body, nil
+}
+
+func firstFile(form *multipart.Form, keys ...string) *multipart.FileHeader {
+	for _, key := range keys {
+		if files := form.File[key]; len(files) > 0 {
+			return files[0]
+		}
+	}
+	return nil
+}
+
+func writeFormFile(writer *multipart.Writer, field string, fileHeader *multipart.FileHeader) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return fmt.Errorf("stability adaptor: open %s failed: %w", field, err)
+	}
+	defer file.Close()
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, fileHeader.Filename))
+	contentType := fileHeader.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	return channel.DoFormRequest(a, c, info, requestBody)
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (any, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	var stabilityResponse ImageResponse
+	if err = common.Unmarshal(responseBody, &stabilityResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	if stabilityResponse.FinishReason == finishReasonContentFiltered {
+		return nil, types.NewOpenAIError(errors.New("the image was filtered by the upstream content moderation"), types.ErrorCodeContentFiltered, http.StatusBadRequest)
+	}
+	if stabilityResponse.Image == "" {
+		var errorResponse ErrorResponse
+		_ = common.Unmarshal(responseBody, &errorResponse)
+		return nil, types.NewOpenAIError(fmt.Errorf("stability adaptor: empty image: %s", strings.Join(errorResponse.Errors, "; ")), types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+
+	imageResponse := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+		Data:    []dto.ImageData{{B64Json: stabilityResponse.Image}},
+	}
+	jsonResponse, err := common.Marshal(imageResponse)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.IOCopyBytesGracefully(c, nil, jsonResponse)
+	return &dto.Usage{}, nil
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func (a *Adaptor) ConvertOpenAIRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeneralOpenAIRequest) (any, error) {
+	return nil, errors.New("stability adaptor: ConvertOpenAIRequest is not implemented")
+}
+
+func (a *Adaptor) ConvertRerankRequest(*gin.Context, int, dto.RerankRequest) (any, error) {
+	return nil, errors.New("stability adaptor: ConvertRerankRequest is not implemented")
+}
+
+func (a *Adaptor) ConvertEmbeddingRequest(*gin.Context, *relaycommon.RelayInfo, dto.EmbeddingRequest) (any, error) {
+	return nil, errors.New("stability adaptor: ConvertEmbeddingRequest is not implemented")
+}
+
+func (a *Adaptor) ConvertAudioRequest(*gin.Context, *relaycommon.RelayInfo, dto.AudioRequest) (io.Reader, error) {
+	return nil, errors.New("stability adaptor: ConvertAudioRequest is not implemented")
+}
+
+func (a *Adaptor) ConvertOpenAIResponsesRequest(*gin.Context, *relaycommon.RelayInfo, dto.OpenAIResponsesRequest) (any, error) {
+	return nil, errors.New("stability adaptor: ConvertOpenAIResponsesRequest is not implemented")
+}
+
+func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dto.ClaudeRequest) (any, error) {
+	return nil, errors.New("stability adaptor: ConvertClaudeRequest is not implemented")
+}
+
+func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
+	return nil, errors.New("stability adaptor: ConvertGeminiRequest is not implemented")
+}
@@ -0,0 +1,19 @@
+package stability
+
+const (
+	ChannelName = "stability"
+
+	ModelStableImageUltra = "stable-image-ultra"
+	ModelStableImageCore  = "stable-image-core"
+)
+
+var ModelList = []string{
+	ModelStableImageUltra,
+	ModelStableImageCore,
+	"sd3.5-large",
+	"sd3.5-large-turbo",
+	"sd3.5-medium",
+}
+
+// supportedAspectRatios 生成接口支持的宽高比，OpenAI 的 size 映射到最接近的一个
+var supportedAspectRatios = []string{"21:9", "16:9", "3:2", "5:4", "1:1", "4:5", "2:3", "9:16", "9:21"}
@@ -0,0 +1,16 @@
+package stability
+
+const finishReasonContentFiltered = "CONTENT_FILTERED"
+
+// ImageResponse 请求头 Accept: application/json 时的响应，image 为 base64 编码的图片
+type ImageResponse struct {
+	Image        string `json:"image"`
+	FinishReason string `json:"finish_reason"`
+	Seed         int64  `json:"seed"`
+}
+
+type ErrorResponse struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Errors []string `json:"errors"`
+}
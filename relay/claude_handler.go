@@ -39,6 +39,17 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	// 令牌开启原生透传且协议与渠道一致时，请求和响应原样转发；thinking 后缀模型需要改写请求，不透传
+	if nativePassthroughEnabled(c, info) &&
+		!(model_setting.GetClaudeSettings().ThinkingAdapterEnabled && strings.HasSuffix(request.Model, "-thinking")) {
+		usage, newAPIError := nativePassthroughHelper(c, info)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		service.PostClaudeConsumeQuota(c, info, usage)
+		return nil
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
@@ -154,7 +165,9 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 	}
 
+	normalizeWriter := service.StartResponseNormalize(c, info)
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	normalizeWriter.Finish(c)
 	//log.Printf("usage: %v", usage)
 	if newAPIError != nil {
 		// reset status code 重置状态码
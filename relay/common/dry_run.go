@@ -0,0 +1,140 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrDryRun is returned instead of the upstream response when a dry run request has been recorded.
+var ErrDryRun = errors.New("dry run: the upstream request was not sent")
+
+// ErrDryRunUnsupported is returned by adaptors that do not talk to the upstream over plain http.
+var ErrDryRunUnsupported = errors.New("dry run is not supported by this channel type")
+
+const dryRunMasked = "***"
+
+// dryRunSensitiveHeaders 请求头名包含这些片段时不展示原值
+var dryRunSensitiveHeaders = []string{"authorization", "key", "token", "secret", "cookie", "signature"}
+
+// UpstreamRequestPreview is an upstream request built by the adaptor, with credentials masked.
+type UpstreamRequestPreview struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Header map[string][]string `json:"header"`
+	// Body JSON 请求体原样展示，其他请求体（如 multipart）以字符串展示
+	Body any `json:"body"`
+}
+
+// DryRunRecorder collects the upstream requests of a relay that must not reach the upstream. It is shared by
+// the copies of the relay info, so the requests split out of one relay are all recorded.
+type DryRunRecorder struct {
+	mu       sync.Mutex
+	requests []*UpstreamRequestPreview
+}
+
+func NewDryRunRecorder() *DryRunRecorder {
+	return &DryRunRecorder{}
+}
+
+// Record masks and stores the request, it always returns an error so the relay stops before the response.
+func (r *DryRunRecorder) Record(info *RelayInfo, req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return err
+		}
+		body = data
+	}
+	if strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip") && len(body) > 0 {
+		if reader, err := gzip.NewReader(bytes.NewReader(body)); err == nil {
+			if data, err := io.ReadAll(reader); err == nil {
+				body = data
+			}
+		}
+	}
+	secrets := dryRunSecrets(info)
+	preview := &UpstreamRequestPreview{
+		Method: req.Method,
+		URL:    maskDryRunSecrets(req.URL.String(), secrets),
+		Header: make(map[string][]string, len(req.Header)),
+	}
+	for name, values := range req.Header {
+		masked := make([]string, len(values))
+		for i, value := range values {
+			if isDryRunSensitiveHeader(name) {
+				masked[i] = maskDryRunHeader(value)
+			} else {
+				masked[i] = maskDryRunSecrets(value, secrets)
+			}
+		}
+		preview.Header[name] = masked
+	}
+	if req.Host != "" && req.Host != req.URL.Host {
+		preview.Header["Host"] = []string{req.Host}
+	}
+	rendered := maskDryRunSecrets(string(body), secrets)
+	if len(body) > 0 && json.Valid([]byte(rendered)) {
+		preview.Body = json.RawMessage(rendered)
+	} else if len(body) > 0 {
+		preview.Body = rendered
+	}
+
+	r.mu.Lock()
+	r.requests = append(r.requests, preview)
+	r.mu.Unlock()
+	return ErrDryRun
+}
+
+// Requests returns the recorded requests in the order they were built.
+func (r *DryRunRecorder) Requests() []*UpstreamRequestPreview {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*UpstreamRequestPreview(nil), r.requests...)
+}
+
+// dryRunSecrets 渠道密钥及其组成部分（如 AK|SK|Region），出现在 URL、请求头或请求体中时都要隐藏
+func dryRunSecrets(info *RelayInfo) []string {
+	if info.ChannelMeta == nil || info.ApiKey == "" {
+		return nil
+	}
+	secrets := []string{info.ApiKey}
+	for _, part := range strings.Split(info.ApiKey, "|") {
+		if part != info.ApiKey && len(part) >= 8 {
+			secrets = append(secrets, part)
+		}
+	}
+	return secrets
+}
+
+func maskDryRunSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, dryRunMasked)
+	}
+	return s
+}
+
+func isDryRunSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range dryRunSensitiveHeaders {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskDryRunHeader keeps the auth scheme, e.g. "Bearer ***", so the header format can still be checked.
+func maskDryRunHeader(value string) string {
+	if scheme, _, ok := strings.Cut(value, " "); ok && !strings.ContainsAny(scheme, "=,") {
+		return scheme + " " + dryRunMasked
+	}
+	return dryRunMasked
+}
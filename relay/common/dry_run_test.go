@@ -0,0 +1,54 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDryRunRecorderMasksCredentials(t *testing.T) {
+	t.Parallel()
+
+	key := "AKIAEXAMPLEKEY|secretpart12345|us-east-1"
+	info := &RelayInfo{ChannelMeta: &ChannelMeta{ApiKey: key}}
+	body := `{"model":"gpt-4o","api_key":"secretpart12345"}`
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/v1/chat?key=AKIAEXAMPLEKEY", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("X-Api-Key", key)
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := NewDryRunRecorder()
+	if err = recorder.Record(info, req); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("expected ErrDryRun, got %v", err)
+	}
+	requests := recorder.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	preview := requests[0]
+	if strings.Contains(preview.URL, "AKIAEXAMPLEKEY") {
+		t.Fatalf("key not masked in url: %s", preview.URL)
+	}
+	if got := preview.Header["Authorization"][0]; got != "Bearer ***" {
+		t.Fatalf("unexpected authorization header: %s", got)
+	}
+	if got := preview.Header["X-Api-Key"][0]; got != "***" {
+		t.Fatalf("unexpected api key header: %s", got)
+	}
+	if got := preview.Header["Content-Type"][0]; got != "application/json" {
+		t.Fatalf("unexpected content type: %s", got)
+	}
+	rendered, ok := preview.Body.(interface{ MarshalJSON() ([]byte, error) })
+	if !ok {
+		t.Fatalf("expected a json body, got %T", preview.Body)
+	}
+	data, _ := rendered.MarshalJSON()
+	if strings.Contains(string(data), "secretpart12345") || !strings.Contains(string(data), `"model":"gpt-4o"`) {
+		t.Fatalf("unexpected body: %s", data)
+	}
+}
@@ -0,0 +1,171 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/tidwall/gjson"
+)
+
+// IsNativeRelayFormat reports whether the inbound protocol is the one the upstream of the api type speaks, so the
+// request and the response can be relayed without any conversion.
+func IsNativeRelayFormat(apiType int, format types.RelayFormat) bool {
+	switch apiType {
+	case constant.APITypeOpenAI:
+		return format == types.RelayFormatOpenAI || format == types.RelayFormatOpenAIResponses
+	case constant.APITypeAnthropic:
+		return format == types.RelayFormatClaude
+	case constant.APITypeGemini:
+		return format == types.RelayFormatGemini
+	}
+	return false
+}
+
+// PassthroughUsage reads the usage the upstream reports in its own protocol from a response relayed unchanged,
+// and keeps the completion text to estimate the usage when the upstream reports none.
+type PassthroughUsage struct {
+	format types.RelayFormat
+	usage  dto.Usage
+	seen   bool
+	text   strings.Builder
+}
+
+func NewPassthroughUsage(format types.RelayFormat) *PassthroughUsage {
+	return &PassthroughUsage{format: format}
+}
+
+// Observe reads a non-stream response body or the data of a stream event.
+func (p *PassthroughUsage) Observe(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || !gjson.ValidBytes(data) {
+		return
+	}
+	result := gjson.ParseBytes(data)
+	// Gemini 未使用 SSE 时流式响应是一个 JSON 数组
+	if result.IsArray() {
+		result.ForEach(func(_, item gjson.Result) bool {
+			p.observe(item)
+			return true
+		})
+		return
+	}
+	p.observe(result)
+}
+
+func (p *PassthroughUsage) observe(result gjson.Result) {
+	switch p.format {
+	case types.RelayFormatClaude:
+		p.observeClaude(result)
+	case types.RelayFormatGemini:
+		p.observeGemini(result)
+	case types.RelayFormatOpenAIResponses:
+		p.observeResponses(result)
+	default:
+		p.observeOpenAI(result)
+	}
+}
+
+// setTokens ignores zero counts, e.g. the input_tokens of a Claude message_delta event.
+func setTokens(target *int, value gjson.Result) bool {
+	if value.Int() <= 0 {
+		return false
+	}
+	*target = int(value.Int())
+	return true
+}
+
+func (p *PassthroughUsage) observeOpenAI(result gjson.Result) {
+	if usage := result.Get("usage"); usage.IsObject() {
+		p.seen = setTokens(&p.usage.PromptTokens, usage.Get("prompt_tokens")) || p.seen
+		p.seen = setTokens(&p.usage.CompletionTokens, usage.Get("completion_tokens")) || p.seen
+		setTokens(&p.usage.PromptTokensDetails.CachedTokens, usage.Get("prompt_tokens_details.cached_tokens"))
+		setTokens(&p.usage.CompletionTokenDetails.ReasoningTokens, usage.Get("completion_tokens_details.reasoning_tokens"))
+	}
+	for _, choice := range result.Get("choices").Array() {
+		for _, path := range []string{"delta.content", "message.content", "text"} {
+			if content := choice.Get(path); content.Type == gjson.String {
+				p.text.WriteString(content.String())
+			}
+		}
+	}
+}
+
+func (p *PassthroughUsage) observeResponses(result gjson.Result) {
+	usage := result.Get("usage")
+	if !usage.IsObject() {
+		usage = result.Get("response.usage")
+	}
+	if usage.IsObject() {
+		p.seen = setTokens(&p.usage.PromptTokens, usage.Get("input_tokens")) || p.seen
+		p.seen = setTokens(&p.usage.CompletionTokens, usage.Get("output_tokens")) || p.seen
+		setTokens(&p.usage.PromptTokensDetails.CachedTokens, usage.Get("input_tokens_details.cached_tokens"))
+		setTokens(&p.usage.CompletionTokenDetails.ReasoningTokens, usage.Get("output_tokens_details.reasoning_tokens"))
+	}
+	if result.Get("type").String() == "response.output_text.delta" {
+		p.text.WriteString(result.Get("delta").String())
+	}
+}
+
+func (p *PassthroughUsage) observeClaude(result gjson.Result) {
+	// 流式响应的输入用量在 message_start 中，输出用量在 message_delta 中累计
+	usage := result.Get("usage")
+	if !usage.IsObject() {
+		usage = result.Get("message.usage")
+	}
+	if usage.IsObject() {
+		p.seen = setTokens(&p.usage.PromptTokens, usage.Get("input_tokens")) || p.seen
+		p.seen = setTokens(&p.usage.CompletionTokens, usage.Get("output_tokens")) || p.seen
+		setTokens(&p.usage.PromptTokensDetails.CachedTokens, usage.Get("cache_read_input_tokens"))
+		setTokens(&p.usage.PromptTokensDetails.CachedCreationTokens, usage.Get("cache_creation_input_tokens"))
+	}
+	if text := result.Get("delta.text"); text.Type == gjson.String {
+		p.text.WriteString(text.String())
+	}
+	for _, content := range result.Get("content").Array() {
+		if text := content.Get("text"); text.Type == gjson.String {
+			p.text.WriteString(text.String())
+		}
+	}
+}
+
+func (p *PassthroughUsage) observeGemini(result gjson.Result) {
+	if usage := result.Get("usageMetadata"); usage.IsObject() {
+		p.seen = setTokens(&p.usage.PromptTokens, usage.Get("promptTokenCount")) || p.seen
+		var candidates, thoughts int
+		setTokens(&candidates, usage.Get("candidatesTokenCount"))
+		setTokens(&thoughts, usage.Get("thoughtsTokenCount"))
+		if candidates+thoughts > 0 {
+			p.usage.CompletionTokens = candidates + thoughts
+			p.usage.CompletionTokenDetails.ReasoningTokens = thoughts
+			p.seen = true
+		}
+		setTokens(&p.usage.PromptTokensDetails.CachedTokens, usage.Get("cachedContentTokenCount"))
+	}
+	for _, part := range result.Get("candidates.0.content.parts").Array() {
+		if part.Get("thought").Bool() {
+			continue
+		}
+		if text := part.Get("text"); text.Type == gjson.String {
+			p.text.WriteString(text.String())
+		}
+	}
+}
+
+// Usage returns the usage reported by the upstream, ok is false when the response carried none.
+func (p *PassthroughUsage) Usage() (usage *dto.Usage, ok bool) {
+	if !p.seen {
+		return nil, false
+	}
+	result := p.usage
+	result.TotalTokens = result.PromptTokens + result.CompletionTokens
+	return &result, true
+}
+
+// Text returns the completion text seen in the response.
+func (p *PassthroughUsage) Text() string {
+	return p.text.String()
+}
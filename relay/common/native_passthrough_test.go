@@ -0,0 +1,58 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/types"
+)
+
+func TestIsNativeRelayFormat(t *testing.T) {
+	if !IsNativeRelayFormat(constant.APITypeAnthropic, types.RelayFormatClaude) {
+		t.Fatal("claude requests are native to anthropic channels")
+	}
+	if IsNativeRelayFormat(constant.APITypeAnthropic, types.RelayFormatOpenAI) {
+		t.Fatal("openai requests need conversion for anthropic channels")
+	}
+	if !IsNativeRelayFormat(constant.APITypeOpenAI, types.RelayFormatOpenAIResponses) {
+		t.Fatal("responses requests are native to openai channels")
+	}
+}
+
+func TestPassthroughUsageClaudeStream(t *testing.T) {
+	p := NewPassthroughUsage(types.RelayFormatClaude)
+	p.Observe([]byte(`{"type":"message_start","message":{"usage":{"input_tokens":25,"cache_read_input_tokens":10,"output_tokens":1}}}`))
+	p.Observe([]byte(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`))
+	p.Observe([]byte(`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"input_tokens":0,"output_tokens":12}}`))
+	usage, ok := p.Usage()
+	if !ok || usage.PromptTokens != 25 || usage.CompletionTokens != 12 || usage.TotalTokens != 37 || usage.PromptTokensDetails.CachedTokens != 10 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if p.Text() != "Hello" {
+		t.Fatalf("unexpected text %q", p.Text())
+	}
+}
+
+func TestPassthroughUsageGeminiArray(t *testing.T) {
+	p := NewPassthroughUsage(types.RelayFormatGemini)
+	p.Observe([]byte(`[{"candidates":[{"content":{"parts":[{"text":"Hi"}]}}]},{"candidates":[{"content":{"parts":[{"text":" there"}]}}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":3,"thoughtsTokenCount":5}}]`))
+	usage, ok := p.Usage()
+	if !ok || usage.PromptTokens != 8 || usage.CompletionTokens != 8 || usage.CompletionTokenDetails.ReasoningTokens != 5 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if p.Text() != "Hi there" {
+		t.Fatalf("unexpected text %q", p.Text())
+	}
+}
+
+func TestPassthroughUsageOpenAIWithoutUsage(t *testing.T) {
+	p := NewPassthroughUsage(types.RelayFormatOpenAI)
+	p.Observe([]byte(`{"choices":[{"index":0,"delta":{"content":"abc"}}]}`))
+	p.Observe([]byte(`[DONE]`))
+	if _, ok := p.Usage(); ok {
+		t.Fatal("usage should not be reported")
+	}
+	if p.Text() != "abc" {
+		t.Fatalf("unexpected text %q", p.Text())
+	}
+}
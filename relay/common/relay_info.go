@@ -90,6 +90,9 @@ type RelayInfo struct {
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
+	OnFirstResponse   func() // 收到上游首个响应时回调
+	// UpstreamLatency 最近一次上游请求从发出到收到响应头的耗时，用于指标统计
+	UpstreamLatency time.Duration
 	//SendLastReasoningResponse bool
 	IsStream               bool
 	IsGeminiBatchEmbedding bool
@@ -114,9 +117,15 @@ type RelayInfo struct {
 	RelayFormat            types.RelayFormat
 	SendResponseCount      int
 	FinalPreConsumedQuota  int // 最终预消耗的配额
+	// UsageSettled 请求失败前已按上游实际用量结算，失败时不再返还预扣费
+	UsageSettled bool
 	// BillingSource indicates whether this request is billed from wallet quota or subscription.
 	// "" or "wallet" => wallet; "subscription" => subscription
 	BillingSource string
+	// BillingPreference is the preference used to pick the billing source, BillingPreferenceSource tells where
+	// it comes from: "header", "token" or "user".
+	BillingPreference       string
+	BillingPreferenceSource string
 	// SubscriptionId is the user_subscriptions.id used when BillingSource == "subscription"
 	SubscriptionId int
 	// SubscriptionPreConsumed is the amount pre-consumed on subscription item (quota units or 1)
@@ -133,6 +142,18 @@ type RelayInfo struct {
 	SubscriptionAmountUsedAfterPreConsume int64
 	IsClaudeBetaQuery                     bool // /v1/messages?beta=true
 	IsChannelTest                         bool // channel test request
+	// DryRun 不为空时只构造上游请求并记录，不发送
+	DryRun *DryRunRecorder
+	// ReplayOf 管理员重放的原日志 ID，重放请求不扣费也不计入用量
+	ReplayOf int
+	// MirrorOf 影子请求对应的原请求日志 ID，同样不扣费也不计入用量
+	MirrorOf int
+	// StreamReservedQuota 流式请求未设置 max_tokens 时按默认输出长度预留的额度，已计入预扣费
+	StreamReservedQuota int
+	// StreamCompletionTokens 由流式处理器设置，返回已按分词器计数的输出 token 数，检查点、限额和 TPM 统计按此计数
+	StreamCompletionTokens func() int
+	// AppliedRequestDefaults 按分组补充到请求中的默认参数路径
+	AppliedRequestDefaults []string
 
 	PriceData types.PriceData
 
@@ -142,6 +163,9 @@ type RelayInfo struct {
 	// ["openai", "openai_responses"] or ["openai", "claude"].
 	RequestConversionChain []types.RelayFormat
 
+	// UpstreamMetadata keeps what the upstream reported about how the request was served.
+	UpstreamMetadata UpstreamMetadata
+
 	ThinkingContentInfo
 	TokenCountMeta
 	*ClaudeConvertInfo
@@ -151,6 +175,30 @@ type RelayInfo struct {
 	*TaskRelayInfo
 }
 
+// UpstreamMetadata 上游返回的服务元信息，用于复现排查
+type UpstreamMetadata struct {
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	ServedModel       string `json:"served_model,omitempty"` // 上游实际提供服务的模型版本
+	Provider          string `json:"provider,omitempty"`     // 聚合平台实际路由到的提供商
+}
+
+func (m UpstreamMetadata) IsEmpty() bool {
+	return m.SystemFingerprint == "" && m.ServedModel == "" && m.Provider == ""
+}
+
+// RecordUpstreamMetadata stores the non-empty metadata values reported by the upstream.
+func (info *RelayInfo) RecordUpstreamMetadata(systemFingerprint, servedModel, provider string) {
+	if systemFingerprint != "" {
+		info.UpstreamMetadata.SystemFingerprint = systemFingerprint
+	}
+	if servedModel != "" {
+		info.UpstreamMetadata.ServedModel = servedModel
+	}
+	if provider != "" {
+		info.UpstreamMetadata.Provider = provider
+	}
+}
+
 func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 	channelType := common.GetContextKeyInt(c, constant.ContextKeyChannelType)
 	paramOverride := common.GetContextKeyStringMap(c, constant.ContextKeyChannelParamOverride)
@@ -296,6 +344,9 @@ var streamSupportedChannels = map[int]bool{
 	constant.ChannelTypeAli:        true,
 	constant.ChannelTypeSubmodel:   true,
 	constant.ChannelTypeCodex:      true,
+	constant.ChannelTypeMock:       true,
+	constant.ChannelTypeVLLM:       true,
+	constant.ChannelTypeLlamaCpp:   true,
 }
 
 func GenRelayInfoWs(c *gin.Context, ws *websocket.Conn) *RelayInfo {
@@ -419,7 +470,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 
 	reqId := common.GetContextKeyString(c, common.RequestIdKey)
 	if reqId == "" {
-		reqId = common.GetTimeString() + common.GetRandomString(8)
+		reqId = common.GenerateRequestId()
 	}
 	info := &RelayInfo{
 		Request: request,
@@ -460,7 +511,8 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 	}
 
 	if strings.HasPrefix(c.Request.URL.Path, "/pg") {
-		info.IsPlayground = true
+		// 选择了令牌的 playground 请求和普通请求一样扣除令牌额度
+		info.IsPlayground = info.TokenId == 0
 		info.RequestURLPath = strings.TrimPrefix(info.RequestURLPath, "/pg")
 		info.RequestURLPath = "/v1" + info.RequestURLPath
 	}
@@ -571,6 +623,19 @@ func GenRelayInfoResponsesCompaction(c *gin.Context, request *dto.OpenAIResponse
 //	info.promptTokens = promptTokens
 //}
 
+// StreamQuotaCheckpoint 由 service 包注册，流式响应已输出 completionTokens 个 token 时按此追加预扣费，
+// 额度不足时返回错误，调用方据此中断输出
+var StreamQuotaCheckpoint func(c *gin.Context, info *RelayInfo, completionTokens int) error
+
+// StreamHardCapCheck 由 service 包注册，每个数据块后检查已输出 completionTokens 个 token 的请求是否达到单次请求额度上限
+var StreamHardCapCheck func(info *RelayInfo, completionTokens int) error
+
+// StreamTokensObserver 由 service 包注册，流式响应输出过程中定期报告已输出的 completionTokens 个 token
+var StreamTokensObserver func(c *gin.Context, info *RelayInfo, completionTokens int)
+
+// StreamErrorRewriter 由 service 包注册，按渠道规则改写流中途发送给客户端的上游错误
+var StreamErrorRewriter func(c *gin.Context, err *types.NewAPIError)
+
 func (info *RelayInfo) SetEstimatePromptTokens(promptTokens int) {
 	info.estimatePromptTokens = promptTokens
 }
@@ -583,6 +648,9 @@ func (info *RelayInfo) SetFirstResponseTime() {
 	if info.isFirstResponse {
 		info.FirstResponseTime = time.Now()
 		info.isFirstResponse = false
+		if info.OnFirstResponse != nil {
+			info.OnFirstResponse()
+		}
 	}
 }
 
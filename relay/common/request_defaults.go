@@ -0,0 +1,32 @@
+package common
+
+import (
+	"sort"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// BuildRequestDefaultsPatch returns a json object holding the defaults whose paths are absent in the request,
+// to be unmarshaled over the request, together with the applied paths in sorted order. The patch is nil when
+// the request already sets every path.
+func BuildRequestDefaultsPatch(requestJSON []byte, defaults map[string]any) ([]byte, []string, error) {
+	paths := make([]string, 0, len(defaults))
+	for path := range defaults {
+		if path != "" && !gjson.GetBytes(requestJSON, path).Exists() {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil, nil
+	}
+	sort.Strings(paths)
+	patch := []byte("{}")
+	for _, path := range paths {
+		var err error
+		if patch, err = sjson.SetBytes(patch, path, defaults[path]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return patch, paths, nil
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestBuildRequestDefaultsPatch(t *testing.T) {
+	defaults := map[string]any{
+		"stream_options.include_usage": true,
+		"temperature":                  0.7,
+		"max_tokens":                   1024,
+	}
+	request := []byte(`{"model":"gpt-4o","temperature":0.1,"stream":true}`)
+
+	patch, paths, err := BuildRequestDefaultsPatch(request, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"max_tokens", "stream_options.include_usage"}; !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("paths = %v, expected %v", paths, expected)
+	}
+	if gjson.GetBytes(patch, "temperature").Exists() {
+		t.Fatalf("temperature set by the client must not be patched: %s", patch)
+	}
+	if !gjson.GetBytes(patch, "stream_options.include_usage").Bool() || gjson.GetBytes(patch, "max_tokens").Int() != 1024 {
+		t.Fatalf("unexpected patch: %s", patch)
+	}
+
+	patch, paths, err = BuildRequestDefaultsPatch([]byte(`{"temperature":0,"max_tokens":1,"stream_options":{"include_usage":false}}`), defaults)
+	if err != nil || patch != nil || paths != nil {
+		t.Fatalf("expected no patch, got %s %v %v", patch, paths, err)
+	}
+}
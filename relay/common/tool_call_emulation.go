@@ -0,0 +1,163 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// 工具调用模拟：上游模型不支持 tools 参数时，把工具描述写入系统提示词，要求模型以 JSON 回复工具调用，
+// 再把回复解析为 OpenAI 格式的 tool_calls。
+
+type emulatedToolCall struct {
+	Name      string `json:"name"`
+	Arguments any    `json:"arguments"`
+}
+
+type emulatedToolCalls struct {
+	ToolCalls []emulatedToolCall `json:"tool_calls"`
+}
+
+// ToolChoiceDisablesTools reports whether the tool_choice of the request forbids calling any tool.
+func ToolChoiceDisablesTools(toolChoice any) bool {
+	choice, ok := toolChoice.(string)
+	return ok && choice == "none"
+}
+
+// BuildToolCallEmulationPrompt describes the tools and the JSON format the model must reply with to call them,
+// following the tool_choice of the request.
+func BuildToolCallEmulationPrompt(tools []dto.ToolCallRequest, toolChoice any) string {
+	var b strings.Builder
+	b.WriteString("You can call the following tools to help answer the user.\n\n")
+	b.WriteString("To call one or more tools, reply with only a JSON object and no other text, in this exact format:\n")
+	b.WriteString(`{"tool_calls":[{"name":"<tool name>","arguments":{<arguments matching the tool parameters>}}]}`)
+	b.WriteString("\nTool results will be sent back to you in a following message. ")
+	switch choice := toolChoice.(type) {
+	case string:
+		if choice == "required" {
+			b.WriteString("You must call at least one tool in your reply.")
+		} else {
+			b.WriteString("If no tool is needed, reply to the user normally in plain text.")
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok && function["name"] != nil {
+			b.WriteString(fmt.Sprintf("You must call the tool %v in your reply.", function["name"]))
+		} else {
+			b.WriteString("If no tool is needed, reply to the user normally in plain text.")
+		}
+	default:
+		b.WriteString("If no tool is needed, reply to the user normally in plain text.")
+	}
+	b.WriteString("\n\nAvailable tools:\n")
+	for _, tool := range tools {
+		if tool.Function.Name == "" {
+			continue
+		}
+		b.WriteString("- ")
+		b.WriteString(tool.Function.Name)
+		if tool.Function.Description != "" {
+			b.WriteString(": ")
+			b.WriteString(tool.Function.Description)
+		}
+		b.WriteString("\n")
+		if tool.Function.Parameters != nil {
+			if parameters, err := common.Marshal(tool.Function.Parameters); err == nil {
+				b.WriteString("  parameters (JSON schema): ")
+				b.Write(parameters)
+				b.WriteString("\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// ConvertMessagesForToolCallEmulation rewrites the tool calls of assistant messages into the JSON the model is
+// asked to reply with, and the tool results into user messages naming the call they answer, so the conversation
+// can be sent to a model that knows nothing about tools.
+func ConvertMessagesForToolCallEmulation(messages []dto.Message) []dto.Message {
+	toolNames := make(map[string]string)
+	converted := make([]dto.Message, 0, len(messages))
+	for _, message := range messages {
+		switch {
+		case message.Role == "assistant" && len(message.ToolCalls) > 0:
+			calls := emulatedToolCalls{}
+			for _, toolCall := range message.ParseToolCalls() {
+				toolNames[toolCall.ID] = toolCall.Function.Name
+				var arguments any = toolCall.Function.Arguments
+				var parsed any
+				if common.UnmarshalJsonStr(toolCall.Function.Arguments, &parsed) == nil {
+					arguments = parsed
+				}
+				calls.ToolCalls = append(calls.ToolCalls, emulatedToolCall{Name: toolCall.Function.Name, Arguments: arguments})
+			}
+			data, _ := common.Marshal(calls)
+			content := string(data)
+			if text := message.StringContent(); text != "" {
+				content = text + "\n" + content
+			}
+			converted = append(converted, dto.Message{Role: "assistant", Content: content})
+		case message.Role == "tool":
+			name := toolNames[message.ToolCallId]
+			if name == "" {
+				name = "tool"
+			}
+			converted = append(converted, dto.Message{
+				Role:    "user",
+				Content: fmt.Sprintf("Result of the %s tool call %s:\n%s", name, message.ToolCallId, message.StringContent()),
+			})
+		default:
+			converted = append(converted, message)
+		}
+	}
+	return converted
+}
+
+// ParseEmulatedToolCalls parses the reply of the model into tool calls of the declared tools. It returns nil when
+// the reply is not a tool call JSON object, e.g. a plain text answer, or calls a tool that was not declared.
+func ParseEmulatedToolCalls(content string, tools []dto.ToolCallRequest) []dto.ToolCallResponse {
+	text := strings.TrimSpace(content)
+	// 模型常把 JSON 放在代码块中
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(strings.TrimPrefix(text, "```json"), "```")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start || !strings.Contains(text, `"tool_calls"`) {
+		return nil
+	}
+	var calls emulatedToolCalls
+	if err := common.UnmarshalJsonStr(text[start:end+1], &calls); err != nil || len(calls.ToolCalls) == 0 {
+		return nil
+	}
+	declared := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		declared[tool.Function.Name] = true
+	}
+	toolCalls := make([]dto.ToolCallResponse, 0, len(calls.ToolCalls))
+	for _, call := range calls.ToolCalls {
+		if !declared[call.Name] {
+			return nil
+		}
+		arguments := "{}"
+		switch args := call.Arguments.(type) {
+		case nil:
+		case string:
+			arguments = args
+		default:
+			if data, err := common.Marshal(args); err == nil {
+				arguments = string(data)
+			}
+		}
+		toolCalls = append(toolCalls, dto.ToolCallResponse{
+			ID:   "call_" + common.GetRandomString(24),
+			Type: "function",
+			Function: dto.FunctionResponse{
+				Name:      call.Name,
+				Arguments: arguments,
+			},
+		})
+	}
+	return toolCalls
+}
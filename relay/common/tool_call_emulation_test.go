@@ -0,0 +1,72 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+)
+
+var emulationTestTools = []dto.ToolCallRequest{
+	{
+		Type: "function",
+		Function: dto.FunctionRequest{
+			Name:        "get_weather",
+			Description: "Get the weather of a city",
+			Parameters:  map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+		},
+	},
+}
+
+func TestBuildToolCallEmulationPrompt(t *testing.T) {
+	prompt := BuildToolCallEmulationPrompt(emulationTestTools, "required")
+	for _, expected := range []string{"get_weather: Get the weather of a city", `"city"`, "must call at least one tool"} {
+		if !strings.Contains(prompt, expected) {
+			t.Fatalf("prompt does not contain %q:\n%s", expected, prompt)
+		}
+	}
+	prompt = BuildToolCallEmulationPrompt(emulationTestTools, map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}})
+	if !strings.Contains(prompt, "must call the tool get_weather") {
+		t.Fatalf("prompt does not force the named tool:\n%s", prompt)
+	}
+}
+
+func TestParseEmulatedToolCalls(t *testing.T) {
+	toolCalls := ParseEmulatedToolCalls("```json\n{\"tool_calls\":[{\"name\":\"get_weather\",\"arguments\":{\"city\":\"Paris\"}}]}\n```", emulationTestTools)
+	if len(toolCalls) != 1 || toolCalls[0].Function.Name != "get_weather" || toolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("unexpected tool calls: %+v", toolCalls)
+	}
+	if !strings.HasPrefix(toolCalls[0].ID, "call_") || toolCalls[0].Type != "function" {
+		t.Fatalf("unexpected tool call id or type: %+v", toolCalls[0])
+	}
+
+	for _, content := range []string{
+		"It is sunny in Paris.",
+		`{"tool_calls":[{"name":"delete_everything","arguments":{}}]}`,
+		`{"tool_calls":[]}`,
+	} {
+		if toolCalls = ParseEmulatedToolCalls(content, emulationTestTools); toolCalls != nil {
+			t.Fatalf("%q should not be parsed as tool calls: %+v", content, toolCalls)
+		}
+	}
+}
+
+func TestConvertMessagesForToolCallEmulation(t *testing.T) {
+	assistant := dto.Message{Role: "assistant"}
+	assistant.SetToolCalls([]dto.ToolCallRequest{{ID: "call_1", Type: "function", Function: dto.FunctionRequest{Name: "get_weather", Arguments: `{"city":"Paris"}`}}})
+	messages := ConvertMessagesForToolCallEmulation([]dto.Message{
+		{Role: "user", Content: "Weather in Paris?"},
+		assistant,
+		{Role: "tool", ToolCallId: "call_1", Content: "sunny"},
+	})
+	if len(messages) != 3 {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+	if messages[1].Role != "assistant" || len(messages[1].ToolCalls) != 0 ||
+		messages[1].StringContent() != `{"tool_calls":[{"name":"get_weather","arguments":{"city":"Paris"}}]}` {
+		t.Fatalf("unexpected assistant message: %+v", messages[1])
+	}
+	if messages[2].Role != "user" || !strings.Contains(messages[2].StringContent(), "get_weather tool call call_1:\nsunny") {
+		t.Fatalf("unexpected tool result message: %+v", messages[2])
+	}
+}
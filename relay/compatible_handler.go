@@ -49,6 +49,30 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	// 令牌开启原生透传且协议与渠道一致时，请求和响应原样转发
+	if nativePassthroughEnabled(c, info) {
+		usage, newAPIError := nativePassthroughHelper(c, info)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		postConsumeQuota(c, info, usage, "原生透传")
+		return nil
+	}
+
+	// 上游模型无法返回 logprobs 时按策略拒绝，或在响应中附带能力警告
+	logprobsWarning, newAPIError := service.CheckLogprobsSupport(c, info, request.LogProbs)
+	if newAPIError != nil {
+		return newAPIError
+	}
+	if warningWriter := service.StartCapabilityWarnings(c, info, logprobsWarning); warningWriter != nil {
+		defer warningWriter.Finish(c)
+	}
+
+	// 分组默认参数视为客户端的设置，先于 stream_options 的处理
+	if err := applyRequestDefaults(c, info, request); err != nil {
+		return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
 	includeUsage := true
 	// 判断用户是否需要返回使用情况
 	if request.StreamOptions != nil {
@@ -69,6 +93,12 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 
 	info.ShouldIncludeUsage = includeUsage
 
+	responseCache := service.LookupCompletionCache(c, info, textReq)
+	if usage, hit := responseCache.Serve(c, info); hit {
+		postConsumeQuota(c, info, usage, "响应缓存命中")
+		return nil
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
@@ -81,13 +111,16 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		!info.ChannelSetting.PassThroughBodyEnabled &&
 		service.ShouldChatCompletionsUseResponsesGlobal(info.ChannelId, info.ChannelType, info.OriginModelName) {
 		applySystemPromptIfNeeded(c, info, request)
+		responseCache.Capture(c)
 		usage, newApiErr := chatCompletionsViaResponses(c, info, adaptor, request)
 		if newApiErr != nil {
+			responseCache.Discard(c)
 			return newApiErr
 		}
+		responseCache.Store(c, usage)
 
 		var containAudioTokens = usage.CompletionTokenDetails.AudioTokens > 0 || usage.PromptTokensDetails.AudioTokens > 0
-		var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
+		var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName) || ratio_setting.ContainsAudioPrice(info.OriginModelName)
 
 		if containAudioTokens && containsAudioRatios {
 			service.PostAudioConsumeQuota(c, info, usage, "")
@@ -97,6 +130,69 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		return nil
 	}
 
+	// 旧版 completions 请求发往只支持对话接口的上游时按模板转换为 chat completions
+	if info.RelayMode == relayconstant.RelayModeCompletions &&
+		!passThroughGlobal &&
+		!info.ChannelSetting.PassThroughBodyEnabled &&
+		service.ShouldCompletionsUseChatGlobal(info.ChannelId, info.ChannelType, info.ApiType) &&
+		service.IsFeatureEnabled(c, operation_setting.FeatureFlagCompletionsToChat) {
+		responseCache.Capture(c)
+		usage, newApiErr := completionsViaChat(c, info, adaptor, request)
+		if newApiErr != nil {
+			responseCache.Discard(c)
+			return newApiErr
+		}
+		responseCache.Store(c, usage)
+		postConsumeQuota(c, info, usage)
+		return nil
+	}
+
+	// 上游不支持 n>1 时拆分为多次单次生成的请求，按所有生成的用量之和计费
+	if generations := fanOutGenerations(info, request); generations > 0 && !passThroughGlobal && !info.ChannelSetting.PassThroughBodyEnabled {
+		if request.Stream {
+			responseCache = nil
+		}
+		responseCache.Capture(c)
+		usage, newApiErr := fanOutTextHelper(c, info, request, generations)
+		if newApiErr != nil {
+			responseCache.Discard(c)
+			return newApiErr
+		}
+		responseCache.Store(c, usage)
+		postConsumeQuota(c, info, usage, fmt.Sprintf("拆分为 %d 次上游请求", generations))
+		return nil
+	}
+
+	// 上游模型不支持原生工具调用时用提示词模拟，客户端仍按 tools 接口收到 tool_calls
+	if toolCallEmulationEnabled(info, request) && !passThroughGlobal && !info.ChannelSetting.PassThroughBodyEnabled {
+		usage, newApiErr := toolCallEmulation(c, info, request)
+		if newApiErr != nil {
+			return newApiErr
+		}
+		postConsumeQuota(c, info, usage)
+		return nil
+	}
+
+	// 令牌开启了服务端网页抓取时，由网关执行模型发起的 fetch_url 调用后继续请求
+	if fetchURLToolEnabled(c, info, request) && !passThroughGlobal && !info.ChannelSetting.PassThroughBodyEnabled {
+		usage, hops, newApiErr := fetchURLToolLoop(c, info, request)
+		if newApiErr != nil {
+			// 之前几轮的上游用量已经产生，按实际用量结算后不再重试，避免重复计费
+			if hops > 0 && usage.TotalTokens > 0 {
+				postConsumeQuota(c, info, usage, fmt.Sprintf("服务端执行 fetch_url 工具 %d 轮后上游出错", hops))
+				info.UsageSettled = true
+				types.ErrOptionWithSkipRetry()(newApiErr)
+			}
+			return newApiErr
+		}
+		if hops > 0 {
+			postConsumeQuota(c, info, usage, fmt.Sprintf("服务端执行 fetch_url 工具 %d 轮", hops))
+		} else {
+			postConsumeQuota(c, info, usage)
+		}
+		return nil
+	}
+
 	var requestBody io.Reader
 
 	if passThroughGlobal || info.ChannelSetting.PassThroughBodyEnabled {
@@ -176,7 +272,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 			}
 		}
 
-		logger.LogDebug(c, fmt.Sprintf("text request body: %s", string(jsonData)))
+		logger.LogModuleDebug(c, logger.ModuleRelay, "text request body: %s", string(jsonData))
 
 		requestBody = bytes.NewBuffer(jsonData)
 	}
@@ -200,15 +296,24 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		}
 	}
 
+	// 上游以流式返回时不缓存
+	if info.IsStream {
+		responseCache = nil
+	}
+	responseCache.Capture(c)
+	normalizeWriter := service.StartResponseNormalize(c, info)
 	usage, newApiErr := adaptor.DoResponse(c, httpResp, info)
+	normalizeWriter.Finish(c)
 	if newApiErr != nil {
+		responseCache.Discard(c)
 		// reset status code 重置状态码
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
 		return newApiErr
 	}
+	responseCache.Store(c, usage.(*dto.Usage))
 
 	var containAudioTokens = usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0
-	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
+	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName) || ratio_setting.ContainsAudioPrice(info.OriginModelName)
 
 	if containAudioTokens && containsAudioRatios {
 		service.PostAudioConsumeQuota(c, info, usage.(*dto.Usage), "")
@@ -419,8 +524,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		if !ratio.IsZero() && quota == 0 {
 			quota = 1
 		}
-		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
-		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		if relayInfo.ReplayOf == 0 && relayInfo.MirrorOf == 0 {
+			model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+			model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		}
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -509,10 +616,16 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		other["image_generation_call"] = true
 		other["image_generation_call_price"] = imageGenerationCallPrice
 	}
+	service.RecordModelClassUsage(ctx, relayInfo, promptTokens+completionTokens)
+	service.ObserveModelUsage(ctx, relayInfo, promptTokens, completionTokens)
+	service.DrawTokenBudget(ctx, relayInfo, promptTokens+completionTokens)
+	service.SettleTPMUsage(ctx, relayInfo, promptTokens+completionTokens)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
+		CacheTokens:      cacheTokens,
+		CacheWriteTokens: cachedCreationTokens,
 		ModelName:        logModel,
 		TokenName:        tokenName,
 		Quota:            quota,
@@ -0,0 +1,164 @@
+// Package conformance runs a fixed set of canonical chat requests through the channel adaptors against recorded
+// upstream responses, so changes that break the conversion of an adaptor show up before a release.
+package conformance
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// 上游协议：录制的响应按协议区分，使用同一协议的渠道类型共用一套录制数据
+const (
+	DialectOpenAI = "openai"
+	DialectClaude = "claude"
+	DialectGemini = "gemini"
+)
+
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+var apiTypeDialects = map[int]string{
+	constant.APITypeOpenAI:      DialectOpenAI,
+	constant.APITypeDeepSeek:    DialectOpenAI,
+	constant.APITypeSiliconFlow: DialectOpenAI,
+	constant.APITypeMistral:     DialectOpenAI,
+	constant.APITypeMoonshot:    DialectOpenAI,
+	constant.APITypeOpenRouter:  DialectOpenAI,
+	constant.APITypePerplexity:  DialectOpenAI,
+	constant.APITypeXai:         DialectOpenAI,
+	constant.APITypeAnthropic:   DialectClaude,
+	constant.APITypeGemini:      DialectGemini,
+}
+
+var dialectModels = map[string]string{
+	DialectOpenAI: "gpt-4o-mini",
+	DialectClaude: "claude-3-5-haiku-20241022",
+	DialectGemini: "gemini-2.0-flash",
+}
+
+// DialectOf returns the upstream protocol of the api type, false when there are no recorded fixtures for it.
+func DialectOf(apiType int) (string, bool) {
+	dialect, ok := apiTypeDialects[apiType]
+	return dialect, ok
+}
+
+// DialectModel returns the model name the requests of the dialect are sent with.
+func DialectModel(dialect string) string {
+	return dialectModels[dialect]
+}
+
+// UpstreamRequest 回放服务收到的上游请求
+type UpstreamRequest struct {
+	Path string
+	Body []byte
+}
+
+type Case struct {
+	Name   string
+	Stream bool
+	// request 请求体模板，%s 为模型名称
+	request        string
+	upstreamChecks map[string]func(r UpstreamRequest) error
+	responseCheck  func(body []byte) error
+}
+
+// Request builds the canonical OpenAI chat request of the case for the model.
+func (tc Case) Request(model string) (*dto.GeneralOpenAIRequest, error) {
+	request := &dto.GeneralOpenAIRequest{}
+	if err := common.Unmarshal([]byte(fmt.Sprintf(tc.request, model)), request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// CheckUpstream checks the converted request the adaptor sent upstream, dialects without a check pass.
+func (tc Case) CheckUpstream(dialect string, r UpstreamRequest) error {
+	check, ok := tc.upstreamChecks[dialect]
+	if !ok {
+		return nil
+	}
+	return check(r)
+}
+
+// CheckResponse checks the OpenAI format response returned to the client.
+func (tc Case) CheckResponse(body []byte) error {
+	return tc.responseCheck(body)
+}
+
+// LoadFixture returns the recorded upstream response of the case, streams are stored as SSE and others as JSON.
+func LoadFixture(dialect string, tc Case) ([]byte, error) {
+	ext := ".json"
+	if tc.Stream {
+		ext = ".sse"
+	}
+	return fixtures.ReadFile("fixtures/" + dialect + "/" + tc.Name + ext)
+}
+
+// ReplayServer answers every request with the recorded fixture and keeps the last request for the upstream checks.
+type ReplayServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	request UpstreamRequest
+}
+
+func NewReplayServer(fixture []byte, stream bool) *ReplayServer {
+	s := &ReplayServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.request = UpstreamRequest{Path: r.URL.Path, Body: body}
+		s.mu.Unlock()
+		if stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(fixture)
+	}))
+	return s
+}
+
+func (s *ReplayServer) Request() UpstreamRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.request
+}
+
+type CaseResult struct {
+	Case       string `json:"case"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// MatrixRow 一个渠道类型在所有用例上的结果
+type MatrixRow struct {
+	ChannelType     int          `json:"channel_type"`
+	ChannelTypeName string       `json:"channel_type_name"`
+	Dialect         string       `json:"dialect,omitempty"`
+	Results         []CaseResult `json:"results"`
+}
+
+// CaseNames returns the names of the cases in the order they run.
+func CaseNames() []string {
+	names := make([]string, 0, len(Cases))
+	for _, tc := range Cases {
+		names = append(names, tc.Name)
+	}
+	return names
+}
@@ -0,0 +1,39 @@
+package conformance
+
+import "testing"
+
+func TestFixturesCoverAllCases(t *testing.T) {
+	for dialect, model := range dialectModels {
+		for _, tc := range Cases {
+			if _, err := LoadFixture(dialect, tc); err != nil {
+				t.Fatalf("%s/%s: %v", dialect, tc.Name, err)
+			}
+			if _, err := tc.Request(model); err != nil {
+				t.Fatalf("%s/%s: invalid request: %v", dialect, tc.Name, err)
+			}
+		}
+	}
+}
+
+// OpenAI 协议的录制响应本身就是返回给客户端的格式，可以直接用来校验响应检查
+func TestResponseChecksAcceptOpenAIFixtures(t *testing.T) {
+	for _, tc := range Cases {
+		fixture, err := LoadFixture(DialectOpenAI, tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tc.CheckResponse(fixture); err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+	}
+}
+
+func TestStreamCheckRequiresDone(t *testing.T) {
+	body := "data: {\"object\":\"chat.completion.chunk\",\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n"
+	if err := checkStreamResponse([]byte(body)); err == nil {
+		t.Fatal("stream without [DONE] should fail")
+	}
+	if err := checkStreamResponse([]byte(body + "data: [DONE]\n\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
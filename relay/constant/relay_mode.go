@@ -148,3 +148,8 @@ func Path2RelaySuno(method, path string) int {
 	}
 	return relayMode
 }
+
+// IsAudioRelayMode reports whether the relay mode is one of the /v1/audio endpoints.
+func IsAudioRelayMode(relayMode int) bool {
+	return relayMode == RelayModeAudioSpeech || relayMode == RelayModeAudioTranscription || relayMode == RelayModeAudioTranslation
+}
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -35,31 +39,27 @@ func EmbeddingHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	// 嵌入结果是确定的，命中缓存时直接返回，不请求上游
+	embeddingCache := service.LookupEmbeddingCache(c, info, embeddingReq)
+	if usage, hit := embeddingCache.Serve(c, info); hit {
+		postConsumeQuota(c, info, usage, "嵌入缓存命中")
+		return nil
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
 	}
 	adaptor.Init(info)
 
-	convertedRequest, err := adaptor.ConvertEmbeddingRequest(c, info, *request)
-	if err != nil {
-		return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
-	}
-	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
-	jsonData, err := json.Marshal(convertedRequest)
-	if err != nil {
-		return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	if inputs, ok := coalescibleEmbeddingInputs(info, request); ok {
+		return relayCoalescedEmbedding(c, info, adaptor, request, inputs, embeddingCache)
 	}
 
-	if len(info.ParamOverride) > 0 {
-		jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride, relaycommon.BuildParamOverrideContext(info))
-		if err != nil {
-			return types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
-		}
+	requestBody, newAPIError := buildEmbeddingRequestBody(c, info, adaptor, request)
+	if newAPIError != nil {
+		return newAPIError
 	}
-
-	logger.LogDebug(c, fmt.Sprintf("converted embedding request body: %s", string(jsonData)))
-	requestBody := bytes.NewBuffer(jsonData)
 	statusCodeMappingStr := c.GetString("status_code_mapping")
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
@@ -77,12 +77,102 @@ func EmbeddingHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		}
 	}
 
+	embeddingCache.Capture(c)
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
 	if newAPIError != nil {
+		embeddingCache.Discard(c)
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
 		return newAPIError
 	}
+	embeddingCache.Store(c, usage.(*dto.Usage))
 	postConsumeQuota(c, info, usage.(*dto.Usage))
 	return nil
 }
+
+func buildEmbeddingRequestBody(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.EmbeddingRequest) (io.Reader, *types.NewAPIError) {
+	convertedRequest, err := adaptor.ConvertEmbeddingRequest(c, info, *request)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride, relaycommon.BuildParamOverrideContext(info))
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
+		}
+	}
+
+	logger.LogDebug(c, fmt.Sprintf("converted embedding request body: %s", string(jsonData)))
+	return bytes.NewBuffer(jsonData), nil
+}
+
+// coalescibleEmbeddingInputs returns the text inputs of a request that may be merged with concurrent requests,
+// only OpenAI compatible upstreams are merged since the response has to be split by index.
+func coalescibleEmbeddingInputs(info *relaycommon.RelayInfo, request *dto.EmbeddingRequest) ([]string, bool) {
+	if info.ApiType != constant.APITypeOpenAI || !operation_setting.GetEmbeddingCoalesceSetting().IsEnabledForModel(info.OriginModelName) {
+		return nil, false
+	}
+	switch input := request.Input.(type) {
+	case string:
+		return []string{input}, true
+	case []any:
+		inputs := request.ParseInput()
+		// 包含 token 数组等非文本输入时不合并
+		return inputs, len(inputs) > 0 && len(inputs) == len(input)
+	}
+	return nil, false
+}
+
+// relayCoalescedEmbedding sends the inputs together with concurrent requests of the same channel and model and
+// bills this request by its share of the upstream usage.
+func relayCoalescedEmbedding(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.EmbeddingRequest, inputs []string, embeddingCache *service.ResponseCacheLookup) *types.NewAPIError {
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	send := func(batchInputs []string) (*dto.FlexibleEmbeddingResponse, *types.NewAPIError) {
+		batchRequest := *request
+		batchRequest.Input = batchInputs
+		requestBody, newAPIError := buildEmbeddingRequestBody(c, info, adaptor, &batchRequest)
+		if newAPIError != nil {
+			return nil, newAPIError
+		}
+		resp, err := adaptor.DoRequest(c, info, requestBody)
+		if err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+		}
+		httpResp := resp.(*http.Response)
+		defer service.CloseResponseBodyGracefully(httpResp)
+		if httpResp.StatusCode != http.StatusOK {
+			return nil, service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+		}
+		body, err := io.ReadAll(httpResp.Body)
+		if err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+		}
+		var response dto.FlexibleEmbeddingResponse
+		if err = common.Unmarshal(body, &response); err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		return &response, nil
+	}
+
+	result, newAPIError := service.CoalesceEmbedding(service.EmbeddingCoalesceKey(info.ChannelId, request), inputs, send)
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return newAPIError
+	}
+	embeddingCache.Capture(c)
+	c.JSON(http.StatusOK, result.Response)
+	usage := result.Response.Usage
+	embeddingCache.Store(c, &usage)
+	if result.BatchSize > result.BatchCount {
+		postConsumeQuota(c, info, &usage, fmt.Sprintf("合并请求，上游批次共 %d 条输入", result.BatchSize))
+		return nil
+	}
+	postConsumeQuota(c, info, &usage)
+	return nil
+}
@@ -0,0 +1,505 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单个请求最多拆分的上游请求数
+const maxFanOutGenerations = 16
+
+// fanOutGenerations returns how many upstream calls the request is split into on channels that don't support n>1,
+// 0 when the request is sent as is.
+func fanOutGenerations(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) int {
+	if !info.ChannelOtherSettings.FanOutN || info.RelayFormat != types.RelayFormatOpenAI {
+		return 0
+	}
+	generations := request.N
+	switch info.RelayMode {
+	case relayconstant.RelayModeChatCompletions:
+	case relayconstant.RelayModeCompletions:
+		generations = max(generations, request.BestOf)
+	default:
+		return 0
+	}
+	if generations <= 1 {
+		return 0
+	}
+	return generations
+}
+
+// fanOutCall is one of the single-generation upstream calls, with its own context, relay info and adaptor
+// so the calls can run in parallel.
+type fanOutCall struct {
+	c       *gin.Context
+	info    *relaycommon.RelayInfo
+	adaptor channel.Adaptor
+	writer  *fanOutWriter
+	body    []byte
+	usage   *dto.Usage
+	err     *types.NewAPIError
+}
+
+// fanOutTextHelper sends an n>1 request as parallel single-generation requests and merges the choices into one
+// OpenAI-compatible response, streams are interleaved with the choice indexes renumbered.
+// The returned usage is the sum of all the generations.
+func fanOutTextHelper(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest, generations int) (*dto.Usage, *types.NewAPIError) {
+	n := max(request.N, 1)
+	if request.BestOf > 0 && n > request.BestOf {
+		return nil, types.NewErrorWithStatusCode(errors.New("n must not be greater than best_of"), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if generations > maxFanOutGenerations {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("this channel supports at most %d generations per request", maxFanOutGenerations), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if request.Stream && generations > n {
+		return nil, types.NewErrorWithStatusCode(errors.New("best_of cannot be used with stream"), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	applySystemPromptIfNeeded(c, info, request)
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	merger := &fanOutMerger{c: c, stream: request.Stream}
+	calls := make([]*fanOutCall, generations)
+	for i := range calls {
+		call, newApiErr := newFanOutCall(c, ctx, info, request, merger, i)
+		if newApiErr != nil {
+			return nil, newApiErr
+		}
+		calls[i] = call
+	}
+
+	var wg sync.WaitGroup
+	for _, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					call.err = types.NewError(fmt.Errorf("fan-out request panic: %v", r), types.ErrorCodeBadResponse)
+					cancel()
+				}
+			}()
+			call.usage, call.err = call.do()
+			if call.err != nil {
+				// 任意一次生成失败时整个请求失败，取消其余请求
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	usage := &dto.Usage{}
+	for _, call := range calls {
+		if call.err != nil {
+			return nil, call.err
+		}
+		addFanOutUsage(usage, call.usage)
+	}
+	collectFanOutInfo(info, calls)
+
+	if merger.stream {
+		merger.finishStream(info, usage)
+		return usage, nil
+	}
+	if newApiErr := merger.writeMerged(calls, n, usage); newApiErr != nil {
+		return nil, newApiErr
+	}
+	return usage, nil
+}
+
+func newFanOutCall(c *gin.Context, ctx context.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest, merger *fanOutMerger, offset int) (*fanOutCall, *types.NewAPIError) {
+	subRequest, err := common.DeepCopy(request)
+	if err != nil {
+		return nil, types.NewError(fmt.Errorf("failed to copy request: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+	subRequest.N = 0
+	subRequest.BestOf = 0
+
+	subInfo := *info
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		subInfo.ChannelMeta = &channelMeta
+	}
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		subInfo.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	subInfo.RequestConversionChain = slices.Clone(info.RequestConversionChain)
+
+	call := &fanOutCall{
+		c:       c.Copy(),
+		info:    &subInfo,
+		adaptor: GetAdaptor(info.ApiType),
+		writer: &fanOutWriter{
+			ResponseWriter: c.Writer,
+			merger:         merger,
+			offset:         offset,
+			header:         http.Header{},
+		},
+	}
+	call.c.Request = c.Request.WithContext(ctx)
+	call.c.Writer = call.writer
+	call.adaptor.Init(call.info)
+
+	convertedRequest, err := call.adaptor.ConvertOpenAIRequest(call.c, call.info, subRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	relaycommon.AppendRequestConversionFromRequest(call.info, convertedRequest)
+
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, call.info.ChannelOtherSettings)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	if len(call.info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverride(jsonData, call.info.ParamOverride, relaycommon.BuildParamOverrideContext(call.info))
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
+		}
+	}
+	if offset == 0 {
+		logger.LogModuleDebug(c, logger.ModuleRelay, "fan-out request body: %s", string(jsonData))
+	}
+	call.body = jsonData
+	return call, nil
+}
+
+func (call *fanOutCall) do() (*dto.Usage, *types.NewAPIError) {
+	resp, err := call.adaptor.DoRequest(call.c, call.info, bytes.NewReader(call.body))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	if resp == nil {
+		return nil, types.NewOpenAIError(nil, types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := call.c.GetString("status_code_mapping")
+	httpResp := resp.(*http.Response)
+	call.info.IsStream = call.info.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+	if httpResp.StatusCode != http.StatusOK {
+		newApiErr := service.RelayErrorHandler(call.c.Request.Context(), httpResp, false)
+		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
+		return nil, newApiErr
+	}
+
+	normalizeWriter := service.StartResponseNormalize(call.c, call.info)
+	usage, newApiErr := call.adaptor.DoResponse(call.c, httpResp, call.info)
+	normalizeWriter.Finish(call.c)
+	call.writer.drain()
+	if newApiErr != nil {
+		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
+		return nil, newApiErr
+	}
+	return usage.(*dto.Usage), nil
+}
+
+// collectFanOutInfo copies back to the request what the upstream calls learned about the response.
+func collectFanOutInfo(info *relaycommon.RelayInfo, calls []*fanOutCall) {
+	first := calls[0].info
+	info.IsStream = first.IsStream
+	info.RequestConversionChain = first.RequestConversionChain
+	info.UpstreamMetadata = first.UpstreamMetadata
+	info.UpstreamLatency = first.UpstreamLatency
+	for _, call := range calls {
+		responseTime := call.info.FirstResponseTime
+		if responseTime.After(info.StartTime) && (!info.HasSendResponse() || responseTime.Before(info.FirstResponseTime)) {
+			info.FirstResponseTime = responseTime
+		}
+	}
+}
+
+func addFanOutUsage(total *dto.Usage, usage *dto.Usage) {
+	if usage == nil {
+		return
+	}
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+	total.PromptCacheHitTokens += usage.PromptCacheHitTokens
+	total.PromptTokensDetails.CachedTokens += usage.PromptTokensDetails.CachedTokens
+	total.PromptTokensDetails.CachedCreationTokens += usage.PromptTokensDetails.CachedCreationTokens
+	total.PromptTokensDetails.TextTokens += usage.PromptTokensDetails.TextTokens
+	total.PromptTokensDetails.AudioTokens += usage.PromptTokensDetails.AudioTokens
+	total.PromptTokensDetails.ImageTokens += usage.PromptTokensDetails.ImageTokens
+	total.CompletionTokenDetails.TextTokens += usage.CompletionTokenDetails.TextTokens
+	total.CompletionTokenDetails.AudioTokens += usage.CompletionTokenDetails.AudioTokens
+	total.CompletionTokenDetails.ReasoningTokens += usage.CompletionTokenDetails.ReasoningTokens
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.ClaudeCacheCreation5mTokens += usage.ClaudeCacheCreation5mTokens
+	total.ClaudeCacheCreation1hTokens += usage.ClaudeCacheCreation1hTokens
+}
+
+// fanOutMerger writes the merged response of the upstream calls to the client.
+type fanOutMerger struct {
+	c      *gin.Context
+	stream bool
+
+	mu      sync.Mutex
+	id      string
+	object  string
+	model   string
+	created int64
+}
+
+// forwardLine sends one stream event of an upstream call with its choice indexes shifted by offset.
+// [DONE], pings and usage-only chunks are dropped, the summed usage is sent once all calls are done.
+func (m *fanOutMerger) forwardLine(offset int, line []byte) {
+	payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || payload[0] != '{' {
+		return
+	}
+	var chunk map[string]any
+	if err := common.Unmarshal(payload, &chunk); err != nil {
+		return
+	}
+	choices, _ := chunk["choices"].([]any)
+	if len(choices) == 0 {
+		return
+	}
+	reindexFanOutChoices(choices, offset)
+	delete(chunk, "usage")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.id == "" {
+		m.id, _ = chunk["id"].(string)
+		m.object, _ = chunk["object"].(string)
+		m.model, _ = chunk["model"].(string)
+		created, _ := chunk["created"].(float64)
+		m.created = int64(created)
+	}
+	chunk["id"] = m.id
+	data, err := common.Marshal(chunk)
+	if err != nil {
+		return
+	}
+	helper.SetEventStreamHeaders(m.c)
+	_ = helper.StringData(m.c, string(data))
+}
+
+func (m *fanOutMerger) finishStream(info *relaycommon.RelayInfo, usage *dto.Usage) {
+	helper.SetEventStreamHeaders(m.c)
+	if info.ShouldIncludeUsage {
+		response := helper.GenerateFinalUsageResponse(m.id, m.created, m.model, *usage)
+		if m.object != "" {
+			response.Object = m.object
+		}
+		_ = helper.ObjectData(m.c, response)
+	}
+	helper.Done(m.c)
+}
+
+// writeMerged sends the buffered responses as one response holding the choices of all calls.
+// With best_of the n choices with the highest mean token log probability are kept.
+func (m *fanOutMerger) writeMerged(calls []*fanOutCall, n int, usage *dto.Usage) *types.NewAPIError {
+	var merged map[string]any
+	choices := make([]any, 0, len(calls))
+	for i, call := range calls {
+		var response map[string]any
+		if err := common.Unmarshal(call.writer.pending.Bytes(), &response); err != nil {
+			return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		callChoices, _ := response["choices"].([]any)
+		reindexFanOutChoices(callChoices, i)
+		choices = append(choices, callChoices...)
+		if merged == nil {
+			merged = response
+		}
+	}
+	if len(choices) > n {
+		choices = bestFanOutChoices(choices, n)
+	}
+	for i, choice := range choices {
+		if choice, ok := choice.(map[string]any); ok {
+			choice["index"] = i
+		}
+	}
+	merged["choices"] = choices
+	merged["usage"] = usage
+
+	body, err := common.Marshal(merged)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	for k, v := range calls[0].writer.header {
+		if k == "Content-Length" || len(v) == 0 {
+			continue
+		}
+		m.c.Writer.Header().Set(k, v[0])
+	}
+	service.IOCopyBytesGracefully(m.c, nil, body)
+	return nil
+}
+
+func reindexFanOutChoices(choices []any, offset int) {
+	for _, choice := range choices {
+		choice, ok := choice.(map[string]any)
+		if !ok {
+			continue
+		}
+		index, _ := choice["index"].(float64)
+		choice["index"] = offset + int(index)
+	}
+}
+
+// bestFanOutChoices keeps the n choices with the highest mean token log probability,
+// or the first n when the upstream returned no log probabilities.
+func bestFanOutChoices(choices []any, n int) []any {
+	scores := make([]float64, len(choices))
+	for i, choice := range choices {
+		score, ok := fanOutChoiceScore(choice)
+		if !ok {
+			return choices[:n]
+		}
+		scores[i] = score
+	}
+	order := make([]int, len(choices))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	best := make([]any, 0, n)
+	for _, i := range order[:n] {
+		best = append(best, choices[i])
+	}
+	return best
+}
+
+func fanOutChoiceScore(choice any) (float64, bool) {
+	choiceMap, _ := choice.(map[string]any)
+	logprobs, _ := choiceMap["logprobs"].(map[string]any)
+	if logprobs == nil {
+		return 0, false
+	}
+	var values []float64
+	if tokenLogprobs, ok := logprobs["token_logprobs"].([]any); ok {
+		// completions
+		for _, value := range tokenLogprobs {
+			if value, ok := value.(float64); ok {
+				values = append(values, value)
+			}
+		}
+	} else if content, ok := logprobs["content"].([]any); ok {
+		// chat completions
+		for _, item := range content {
+			if item, ok := item.(map[string]any); ok {
+				if value, ok := item["logprob"].(float64); ok {
+					values = append(values, value)
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values)), true
+}
+
+// fanOutWriter receives what the adaptor writes for one upstream call. Streams are forwarded event by event,
+// other responses are buffered until all calls are done. Headers and status stay on the writer so the calls
+// don't write to the client response concurrently.
+type fanOutWriter struct {
+	gin.ResponseWriter
+	merger  *fanOutMerger
+	offset  int
+	header  http.Header
+	status  int
+	size    int
+	written bool
+	pending bytes.Buffer
+}
+
+func (w *fanOutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *fanOutWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *fanOutWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *fanOutWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *fanOutWriter) Size() int {
+	return w.size
+}
+
+func (w *fanOutWriter) Written() bool {
+	return w.written
+}
+
+func (w *fanOutWriter) Write(data []byte) (int, error) {
+	w.written = true
+	w.size += len(data)
+	w.pending.Write(data)
+	if !w.merger.stream {
+		return len(data), nil
+	}
+	for {
+		idx := bytes.IndexByte(w.pending.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		w.merger.forwardLine(w.offset, w.pending.Next(idx+1))
+	}
+	return len(data), nil
+}
+
+func (w *fanOutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush is a no-op, forwarded stream events are flushed to the client as they are sent.
+func (w *fanOutWriter) Flush() {}
+
+// drain forwards the last stream event when it wasn't terminated by a newline.
+func (w *fanOutWriter) drain() {
+	if w.merger.stream && w.pending.Len() > 0 {
+		w.merger.forwardLine(w.offset, w.pending.Next(w.pending.Len()))
+	}
+}
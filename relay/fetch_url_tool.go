@@ -0,0 +1,185 @@
+package relay
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fetchURLToolDefinition 请求中没有声明 fetch_url 工具时由网关添加
+var fetchURLToolDefinition = dto.ToolCallRequest{
+	Type: "function",
+	Function: dto.FunctionRequest{
+		Name:        operation_setting.FetchURLToolName,
+		Description: "Fetch a web page by its url and return the text content of the page.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"url": map[string]any{
+					"type":        "string",
+					"description": "The http or https url of the page to fetch",
+				},
+			},
+			"required": []string{"url"},
+		},
+	},
+}
+
+// fetchURLToolEnabled reports whether the gateway runs the fetch_url tool calls of the request itself, only
+// non-streaming chat completions of the tokens that enabled it are supported.
+func fetchURLToolEnabled(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) bool {
+	return operation_setting.GetFetchURLToolSetting().Enabled &&
+		common.GetContextKeyBool(c, constant.ContextKeyTokenFetchUrlTool) &&
+		info.RelayFormat == types.RelayFormatOpenAI &&
+		info.RelayMode == relayconstant.RelayModeChatCompletions &&
+		!request.Stream && request.N <= 1
+}
+
+// fetchURLToolLoop sends the request and, as long as the model only calls fetch_url, fetches the pages, appends
+// the results to the conversation and sends it again. The last response is written to the client with the usage
+// of all the upstream calls, which is returned together with the number of hops run. The usage of the hops run
+// so far is returned with the error as well, so a failing later hop is still billed for the earlier ones. When
+// the tool loop caps are reached while the model still calls fetch_url, the loop stops and the last response is
+// returned with the max_turns_exceeded finish reason.
+func fetchURLToolLoop(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*dto.Usage, int, *types.NewAPIError) {
+	loopSetting := operation_setting.GetToolLoopSetting()
+	ensureFetchURLTool(request)
+	applySystemPromptIfNeeded(c, info, request)
+
+	merger := &fanOutMerger{c: c}
+	usage := &dto.Usage{}
+	for hop := 0; ; hop++ {
+		call, newApiErr := newFanOutCall(c, c.Request.Context(), info, request, merger, 0)
+		if newApiErr != nil {
+			return usage, hop, newApiErr
+		}
+		callUsage, newApiErr := call.do()
+		if newApiErr != nil {
+			return usage, hop, newApiErr
+		}
+		addFanOutUsage(usage, callUsage)
+		collectFanOutInfo(info, []*fanOutCall{call})
+
+		body := call.writer.pending.Bytes()
+		message, toolCalls := parseFetchURLToolCalls(body)
+		if len(toolCalls) == 0 {
+			writeFetchURLToolResponse(c, call, body, usage, nil)
+			return usage, hop, nil
+		}
+		if reason := loopSetting.StopReason(hop, usage.TotalTokens); reason != "" {
+			logger.LogWarn(c, fmt.Sprintf("fetch_url tool loop stopped after %d hops and %d tokens: %s", hop, usage.TotalTokens, reason))
+			common.SetContextKey(c, constant.ContextKeyToolLoopStopReason, reason)
+			writeFetchURLToolResponse(c, call, body, usage, map[string]any{
+				"status":       operation_setting.ToolLoopFinishReason,
+				"reason":       reason,
+				"iterations":   hop,
+				"total_tokens": usage.TotalTokens,
+			})
+			return usage, hop, nil
+		}
+		request.Messages = append(request.Messages, message)
+		maxCalls := operation_setting.GetFetchURLToolSetting().MaxCallsPerHop
+		for i, toolCall := range toolCalls {
+			var content string
+			if maxCalls > 0 && i >= maxCalls {
+				content = fmt.Sprintf("error: at most %d pages are fetched per turn, call fetch_url again for the remaining ones", maxCalls)
+			} else {
+				content = runFetchURLTool(c, toolCall)
+			}
+			request.Messages = append(request.Messages, dto.Message{
+				Role:       "tool",
+				ToolCallId: toolCall.ID,
+				Content:    content,
+			})
+		}
+	}
+}
+
+func ensureFetchURLTool(request *dto.GeneralOpenAIRequest) {
+	for _, tool := range request.Tools {
+		if tool.Function.Name == operation_setting.FetchURLToolName {
+			return
+		}
+	}
+	request.Tools = append(request.Tools, fetchURLToolDefinition)
+}
+
+// parseFetchURLToolCalls returns the assistant message and its tool calls when all of them call fetch_url,
+// tool calls of other tools are left to the client.
+func parseFetchURLToolCalls(body []byte) (dto.Message, []dto.ToolCallRequest) {
+	var response struct {
+		Choices []struct {
+			Message dto.Message `json:"message"`
+		} `json:"choices"`
+	}
+	if err := common.Unmarshal(body, &response); err != nil || len(response.Choices) != 1 {
+		return dto.Message{}, nil
+	}
+	message := response.Choices[0].Message
+	var toolCalls []dto.ToolCallRequest
+	if len(message.ToolCalls) == 0 || common.Unmarshal(message.ToolCalls, &toolCalls) != nil {
+		return dto.Message{}, nil
+	}
+	for _, toolCall := range toolCalls {
+		if toolCall.Function.Name != operation_setting.FetchURLToolName {
+			return dto.Message{}, nil
+		}
+	}
+	return message, toolCalls
+}
+
+// runFetchURLTool 抓取失败时把错误作为工具结果返回给模型，由模型决定如何继续
+func runFetchURLTool(c *gin.Context, toolCall dto.ToolCallRequest) string {
+	var args struct {
+		URL string `json:"url"`
+	}
+	if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &args); err != nil || args.URL == "" {
+		return "error: the url argument is required"
+	}
+	text, err := service.FetchURLForTool(c.Request.Context(), args.URL)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("fetch_url tool failed to fetch %s: %s", args.URL, err.Error()))
+		return "error: " + err.Error()
+	}
+	logger.LogInfo(c, fmt.Sprintf("fetch_url tool fetched %s, %d chars", args.URL, len([]rune(text))))
+	return text
+}
+
+// writeFetchURLToolResponse 最后一次响应的 usage 替换为所有上游请求的用量之和，循环超出上限时
+// finish_reason 改为 max_turns_exceeded，并在 tool_loop 字段中说明原因
+func writeFetchURLToolResponse(c *gin.Context, call *fanOutCall, body []byte, usage *dto.Usage, toolLoop map[string]any) {
+	var response map[string]any
+	if err := common.Unmarshal(body, &response); err == nil {
+		response["usage"] = usage
+		if toolLoop != nil {
+			response["tool_loop"] = toolLoop
+			if choices, ok := response["choices"].([]any); ok {
+				for _, choice := range choices {
+					if choice, ok := choice.(map[string]any); ok {
+						choice["finish_reason"] = operation_setting.ToolLoopFinishReason
+					}
+				}
+			}
+		}
+		if data, err := common.Marshal(response); err == nil {
+			body = data
+		}
+	}
+	for k, v := range call.writer.header {
+		if k == "Content-Length" || len(v) == 0 {
+			continue
+		}
+		c.Writer.Header().Set(k, v[0])
+	}
+	service.IOCopyBytesGracefully(c, nil, body)
+}
@@ -71,6 +71,16 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	// 令牌开启原生透传且协议与渠道一致时，请求和响应原样转发
+	if nativePassthroughEnabled(c, info) {
+		usage, newAPIError := nativePassthroughHelper(c, info)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		postConsumeQuota(c, info, usage, "原生透传")
+		return nil
+	}
+
 	if model_setting.GetGeminiSettings().ThinkingAdapterEnabled {
 		if isNoThinkingRequest(request) {
 			// check is thinking
@@ -188,7 +198,9 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 	}
 
+	normalizeWriter := service.StartResponseNormalize(c, info)
 	usage, openaiErr := adaptor.DoResponse(c, resp.(*http.Response), info)
+	normalizeWriter.Finish(c)
 	if openaiErr != nil {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
@@ -287,7 +299,9 @@ func GeminiEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (newAPI
 		}
 	}
 
+	normalizeWriter := service.StartResponseNormalize(c, info)
 	usage, openaiErr := adaptor.DoResponse(c, resp.(*http.Response), info)
+	normalizeWriter.Finish(c)
 	if openaiErr != nil {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
@@ -60,6 +60,9 @@ func ClaudeData(c *gin.Context, resp dto.ClaudeResponse) error {
 	if err != nil {
 		common.SysError("error marshalling stream response: " + err.Error())
 	} else {
+		if resp.Type == "message_stop" {
+			provenanceEvent(c)
+		}
 		common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedResponseBody, string(jsonData))
 		c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
 		c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonData)})
@@ -69,6 +72,9 @@ func ClaudeData(c *gin.Context, resp dto.ClaudeResponse) error {
 }
 
 func ClaudeChunkData(c *gin.Context, resp dto.ClaudeResponse, data string) {
+	if resp.Type == "message_stop" {
+		provenanceEvent(c)
+	}
 	common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedResponseBody, data)
 	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
 	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("data: %s\n", data)})
@@ -76,6 +82,9 @@ func ClaudeChunkData(c *gin.Context, resp dto.ClaudeResponse, data string) {
 }
 
 func ResponseChunkData(c *gin.Context, resp dto.ResponsesStreamResponse, data string) {
+	if resp.Type == "response.completed" {
+		provenanceEvent(c)
+	}
 	common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedResponseBody, data)
 	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
 	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("data: %s", data)})
@@ -91,9 +100,14 @@ func StringData(c *gin.Context, str string) error {
 		return fmt.Errorf("request context done: %w", c.Request.Context().Err())
 	}
 
-	common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedResponseBody, str)
-
-	c.Render(-1, common.CustomEvent{Data: "data: " + str})
+	chunks := transformStreamData(c, str)
+	if len(chunks) == 0 {
+		return nil
+	}
+	for _, chunk := range chunks {
+		common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedResponseBody, chunk)
+		c.Render(-1, common.CustomEvent{Data: "data: " + chunk})
+	}
 	return FlushWriter(c)
 }
 
@@ -124,6 +138,9 @@ func ObjectData(c *gin.Context, object interface{}) error {
 }
 
 func Done(c *gin.Context) {
+	if chunk := openAIProvenanceChunk(c); chunk != "" {
+		_ = StringData(c, chunk)
+	}
 	_ = StringData(c, "[DONE]")
 }
 
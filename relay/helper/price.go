@@ -4,8 +4,11 @@ import (
 	"fmt"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -26,7 +29,7 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 	// check auto group
 	autoGroup, exists := ctx.Get("auto_group")
 	if exists {
-		logger.LogDebug(ctx, fmt.Sprintf("final group: %s", autoGroup))
+		logger.LogModuleDebug(ctx, logger.ModuleBilling, "final group: %s", autoGroup)
 		relayInfo.UsingGroup = autoGroup.(string)
 	}
 
@@ -42,11 +45,81 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// 自有渠道不消耗平台渠道，只按平台费率收费
+	if isPrivateChannel(ctx) {
+		groupRatioInfo.GroupRatio *= operation_setting.GetByokSetting().FeeRatio
+		logger.LogModuleDebug(ctx, logger.ModuleBilling, "byok channel, group ratio: %f", groupRatioInfo.GroupRatio)
+	}
+
+	// 批量任务异步执行，按批量折扣收费
+	if common.GetContextKeyString(ctx, constant.ContextKeyBatchId) != "" {
+		groupRatioInfo.GroupRatio *= operation_setting.GetBatchSetting().DiscountRatio
+		logger.LogModuleDebug(ctx, logger.ModuleBilling, "batch request, group ratio: %f", groupRatioInfo.GroupRatio)
+	}
+
 	return groupRatioInfo
 }
 
+func isPrivateChannel(c *gin.Context) bool {
+	return common.GetContextKeyInt(c, constant.ContextKeyChannelOwnerUserId) != 0
+}
+
+// channelPriceOverride returns the price (usePrice) or model ratio the selected channel overrides for modelName.
+func channelPriceOverride(c *gin.Context, modelName string) (value float64, usePrice bool, ok bool) {
+	channelOtherSettings, exists := common.GetContextKeyType[dto.ChannelOtherSettings](c, constant.ContextKeyChannelOtherSetting)
+	if !exists {
+		return 0, false, false
+	}
+	if price, found := channelOtherSettings.GetModelPriceOverride(modelName); found {
+		return price, true, true
+	}
+	if ratio, found := channelOtherSettings.GetModelRatioOverride(modelName); found {
+		return ratio, false, true
+	}
+	return 0, false, false
+}
+
+// imageGenerationPrice returns the per image price of an image request by its size and quality and the number
+// of images, false when the model has no per image price.
+func imageGenerationPrice(info *relaycommon.RelayInfo) (float64, float64, bool) {
+	if info.RelayMode != relayconstant.RelayModeImagesGenerations && info.RelayMode != relayconstant.RelayModeImagesEdits {
+		return 0, 0, false
+	}
+	request, ok := info.Request.(*dto.ImageRequest)
+	if !ok {
+		return 0, 0, false
+	}
+	price, ok := ratio_setting.GetImageGenerationPrice(info.OriginModelName, request.Size, request.Quality)
+	if !ok {
+		return 0, 0, false
+	}
+	return price, float64(max(request.N, 1)), true
+}
+
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) (types.PriceData, error) {
-	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
+	var modelPrice float64
+	var usePrice bool
+	priceSource := types.PriceSourceGlobal
+	// 渠道覆盖的价格/倍率优先于全局设置
+	overrideValue, overrideUsePrice, overridden := channelPriceOverride(c, info.OriginModelName)
+	if overridden {
+		priceSource = types.PriceSourceChannel
+		usePrice = overrideUsePrice
+		if usePrice {
+			modelPrice = overrideValue
+		}
+	} else {
+		modelPrice, usePrice = ratio_setting.GetModelPrice(info.OriginModelName, false)
+	}
+	imagePriceRatio := meta.ImagePriceRatio
+	if !overridden {
+		if price, count, ok := imageGenerationPrice(info); ok {
+			modelPrice, usePrice, imagePriceRatio = price, true, count
+		}
+	}
+	if isPrivateChannel(c) {
+		priceSource = types.PriceSourceByok
+	}
 
 	groupRatioInfo := HandleGroupRatio(c, info)
 
@@ -68,12 +141,20 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		}
 		var success bool
 		var matchName string
-		modelRatio, success, matchName = ratio_setting.GetModelRatio(info.OriginModelName)
+		if overridden {
+			modelRatio, success, matchName = overrideValue, true, info.OriginModelName
+		} else {
+			modelRatio, success, matchName = ratio_setting.GetModelRatio(info.OriginModelName)
+		}
 		if !success {
 			acceptUnsetRatio := false
 			if info.UserSetting.AcceptUnsetRatioModel {
 				acceptUnsetRatio = true
 			}
+			// 音频接口按秒或字符单独定价的模型不需要倍率
+			if relayconstant.IsAudioRelayMode(info.RelayMode) && ratio_setting.ContainsAudioEndpointPrice(info.OriginModelName) {
+				acceptUnsetRatio = true
+			}
 			if !acceptUnsetRatio {
 				return types.PriceData{}, fmt.Errorf("模型 %s 倍率或价格未配置，请联系管理员设置或开始自用模式；Model %s ratio or price not set, please set or start self-use mode", matchName, matchName)
 			}
@@ -90,8 +171,8 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		ratio := modelRatio * groupRatioInfo.GroupRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
-		if meta.ImagePriceRatio != 0 {
-			modelPrice = modelPrice * meta.ImagePriceRatio
+		if imagePriceRatio != 0 {
+			modelPrice = modelPrice * imagePriceRatio
 		}
 		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	}
@@ -130,6 +211,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheCreation5mRatio: cacheCreationRatio5m,
 		CacheCreation1hRatio: cacheCreationRatio1h,
 		QuotaToPreConsume:    preConsumedQuota,
+		PriceSource:          priceSource,
 	}
 
 	if common.DebugEnabled {
@@ -143,7 +225,15 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.PerCallPriceData {
 	groupRatioInfo := HandleGroupRatio(c, info)
 
+	priceSource := types.PriceSourceGlobal
 	modelPrice, success := ratio_setting.GetModelPrice(info.OriginModelName, true)
+	if price, usePrice, ok := channelPriceOverride(c, info.OriginModelName); ok && usePrice {
+		modelPrice, success = price, true
+		priceSource = types.PriceSourceChannel
+	}
+	if isPrivateChannel(c) {
+		priceSource = types.PriceSourceByok
+	}
 	// 如果没有配置价格，则使用默认价格
 	if !success {
 		defaultPrice, ok := ratio_setting.GetDefaultModelPriceMap()[info.OriginModelName]
@@ -158,6 +248,7 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 		ModelPrice:     modelPrice,
 		Quota:          quota,
 		GroupRatioInfo: groupRatioInfo,
+		PriceSource:    priceSource,
 	}
 	return priceData
 }
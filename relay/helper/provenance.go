@@ -0,0 +1,150 @@
+package helper
+
+import (
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 来源信息
+//
+// 开启 provenance_setting 后，非流式 JSON 响应在顶层扩展字段（默认 x_provenance）中附加来源信息；
+// OpenAI 格式的流在 [DONE] 之前追加一个 choices 为空、只带该字段的块，Claude 和 Responses 格式的流
+// 在结束事件之前追加一个 provenance 事件。
+
+// ProvenanceMetadata returns the attribution metadata of the current request, nil when it is disabled or the
+// group of the request is not listed.
+func ProvenanceMetadata(c *gin.Context) map[string]any {
+	setting := operation_setting.GetProvenanceSetting()
+	if c == nil || !setting.AppliesToGroup(common.GetContextKeyString(c, constant.ContextKeyUsingGroup)) {
+		return nil
+	}
+	metadata := make(map[string]any)
+	if setting.IncludeModel {
+		model := common.GetContextKeyString(c, constant.ContextKeyUpstreamModelName)
+		if model == "" {
+			model = common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+		}
+		if model != "" {
+			metadata["model"] = model
+		}
+	}
+	if setting.IncludeChannel {
+		if tag := common.GetContextKeyString(c, constant.ContextKeyChannelTag); tag != "" {
+			metadata["channel_tag"] = tag
+		}
+	}
+	if setting.IncludeTimestamp {
+		metadata["generated_at"] = time.Now().Unix()
+	}
+	if setting.IncludeRequestId {
+		if requestId := c.GetString(common.RequestIdKey); requestId != "" {
+			metadata["request_id"] = requestId
+		}
+	}
+	if setting.Attribution != "" {
+		metadata["attribution"] = setting.Attribution
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// InjectProvenance adds the metadata to a JSON object response body, other bodies are returned unchanged.
+func InjectProvenance(c *gin.Context, data []byte) []byte {
+	if len(data) == 0 || data[0] != '{' || !gjson.ValidBytes(data) {
+		return data
+	}
+	metadata := ProvenanceMetadata(c)
+	if metadata == nil {
+		return data
+	}
+	injected, err := sjson.SetBytes(data, provenancePath(), metadata)
+	if err != nil {
+		common.SysError("error injecting provenance metadata: " + err.Error())
+		return data
+	}
+	return injected
+}
+
+// provenancePath escapes the characters of the field name that sjson treats as path syntax.
+func provenancePath() string {
+	field := operation_setting.GetProvenanceSetting().FieldName()
+	var builder strings.Builder
+	for _, r := range field {
+		switch r {
+		case '.', '*', '?', '|', '#', '@', '\\':
+			builder.WriteByte('\\')
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// takeStreamProvenance returns the metadata once per stream, later calls return nil.
+func takeStreamProvenance(c *gin.Context) map[string]any {
+	if c.GetBool(string(constant.ContextKeyProvenanceSent)) {
+		return nil
+	}
+	metadata := ProvenanceMetadata(c)
+	if metadata == nil {
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeyProvenanceSent, true)
+	return metadata
+}
+
+// openAIProvenanceChunk builds the trailing chunk of an OpenAI format stream.
+func openAIProvenanceChunk(c *gin.Context) string {
+	metadata := takeStreamProvenance(c)
+	if metadata == nil {
+		return ""
+	}
+	object := "chat.completion.chunk"
+	if c.Request != nil && !strings.Contains(c.Request.URL.Path, "/chat/") && strings.HasSuffix(c.Request.URL.Path, "/completions") {
+		object = "text_completion"
+	}
+	chunk := map[string]any{
+		"id":      GetResponseID(c),
+		"object":  object,
+		"created": time.Now().Unix(),
+		"choices": []any{},
+	}
+	if model := common.GetContextKeyString(c, constant.ContextKeyOriginalModel); model != "" {
+		chunk["model"] = model
+	}
+	chunk[operation_setting.GetProvenanceSetting().FieldName()] = metadata
+	jsonData, err := common.Marshal(chunk)
+	if err != nil {
+		common.SysError("error marshalling provenance chunk: " + err.Error())
+		return ""
+	}
+	return string(jsonData)
+}
+
+// provenanceEvent writes the provenance event of a Claude or Responses format stream.
+func provenanceEvent(c *gin.Context) {
+	metadata := takeStreamProvenance(c)
+	if metadata == nil {
+		return
+	}
+	jsonData, err := common.Marshal(map[string]any{
+		"type": "provenance",
+		operation_setting.GetProvenanceSetting().FieldName(): metadata,
+	})
+	if err != nil {
+		common.SysError("error marshalling provenance event: " + err.Error())
+		return
+	}
+	common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedResponseBody, string(jsonData))
+	c.Render(-1, common.CustomEvent{Data: "event: provenance\n"})
+	c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonData)})
+}
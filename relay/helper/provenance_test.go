@@ -0,0 +1,73 @@
+package helper
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func withProvenanceSetting(t *testing.T, setting operation_setting.ProvenanceSetting) {
+	current := operation_setting.GetProvenanceSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func TestInjectProvenance(t *testing.T) {
+	withProvenanceSetting(t, operation_setting.ProvenanceSetting{
+		Enabled:        true,
+		Field:          "x.provenance",
+		IncludeModel:   true,
+		IncludeChannel: true,
+		Attribution:    "generated by example",
+		Groups:         []string{"default"},
+	})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "alias")
+	common.SetContextKey(c, constant.ContextKeyUpstreamModelName, "upstream-model")
+	common.SetContextKey(c, constant.ContextKeyChannelTag, "tag-a")
+
+	data := InjectProvenance(c, []byte(`{"id":"1","choices":[]}`))
+	metadata := gjson.GetBytes(data, `x\.provenance`)
+	if metadata.Get("model").String() != "upstream-model" || metadata.Get("channel_tag").String() != "tag-a" {
+		t.Fatalf("unexpected metadata: %s", data)
+	}
+	if metadata.Get("attribution").String() != "generated by example" || metadata.Get("generated_at").Exists() {
+		t.Fatalf("unexpected metadata: %s", data)
+	}
+
+	if got := InjectProvenance(c, []byte(`[1,2]`)); string(got) != `[1,2]` {
+		t.Fatalf("non-object body changed: %s", got)
+	}
+
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "vip")
+	if got := InjectProvenance(c, []byte(`{"id":"1"}`)); string(got) != `{"id":"1"}` {
+		t.Fatalf("body of unlisted group changed: %s", got)
+	}
+}
+
+func TestStreamProvenanceOnce(t *testing.T) {
+	withProvenanceSetting(t, operation_setting.ProvenanceSetting{Enabled: true, IncludeModel: true})
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	common.SetContextKey(c, constant.ContextKeyUpstreamModelName, "upstream-model")
+
+	Done(c)
+	Done(c)
+	body := recorder.Body.String()
+	if strings.Count(body, `"x_provenance":{"model":"upstream-model"}`) != 1 {
+		t.Fatalf("provenance chunk should be written once: %s", body)
+	}
+	if strings.Index(body, "x_provenance") > strings.Index(body, "[DONE]") {
+		t.Fatalf("provenance chunk should precede [DONE]: %s", body)
+	}
+}
@@ -0,0 +1,46 @@
+package helper
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleStreamError handles an error the upstream sent in the middle of a stream. While nothing has been written
+// to the client the error is returned, so it is responded with the status code of the upstream error and the
+// request can still be retried. Once the stream has started the status code can no longer be changed, the error
+// is sent as an event in the format of the client, rewritten by the error rewrite rules of the channel, and nil is
+// returned: the caller ends the stream as usual, the content already sent is billed and the normalized error code
+// is recorded in the log.
+func HandleStreamError(c *gin.Context, info *relaycommon.RelayInfo, apiErr *types.NewAPIError) *types.NewAPIError {
+	if apiErr == nil || !c.Writer.Written() {
+		return apiErr
+	}
+	logger.LogWarn(c, fmt.Sprintf("upstream error in the middle of the stream: %s", apiErr.Error()))
+	common.SetContextKey(c, constant.ContextKeyStreamErrorCode, string(apiErr.GetErrorCode()))
+	if relaycommon.StreamErrorRewriter != nil {
+		relaycommon.StreamErrorRewriter(c, apiErr)
+	}
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		_ = ClaudeData(c, dto.ClaudeResponse{Type: "error", Error: apiErr.ToClaudeError()})
+	case types.RelayFormatGemini:
+		openaiError := apiErr.ToOpenAIError()
+		_ = ObjectData(c, gin.H{"error": gin.H{
+			"code":    apiErr.StatusCode,
+			"message": openaiError.Message,
+			"status":  openaiError.Type,
+		}})
+	default:
+		// 与 OpenAI 一致，流中的错误以 {"error": {...}} 的数据块发送
+		_ = ObjectData(c, gin.H{"error": apiErr.ToOpenAIError()})
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleStreamError(t *testing.T) {
+	info := &relaycommon.RelayInfo{RelayFormat: types.RelayFormatOpenAI}
+	apiErr := types.NewClaudeStreamError(types.ClaudeError{Type: "overloaded_error", Message: "Overloaded"})
+	if apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.GetErrorCode() != types.ErrorCodeStreamOverloaded {
+		t.Fatalf("unexpected mapping: %d %s", apiErr.StatusCode, apiErr.GetErrorCode())
+	}
+
+	// 尚未发送内容时返回错误，由调用方按状态码响应
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if got := HandleStreamError(c, info, apiErr); got != apiErr {
+		t.Fatalf("expected the error to be returned before the stream started, got %v", got)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	_ = StringData(c, `{"choices":[]}`)
+	if got := HandleStreamError(c, info, apiErr); got != nil {
+		t.Fatalf("expected nil after the stream started, got %v", got)
+	}
+	if !strings.Contains(w.Body.String(), `data: {"error":{`) || !strings.Contains(w.Body.String(), string(types.ErrorCodeStreamOverloaded)) {
+		t.Fatalf("unexpected stream: %s", w.Body.String())
+	}
+	if code := common.GetContextKeyString(c, constant.ContextKeyStreamErrorCode); code != string(types.ErrorCodeStreamOverloaded) {
+		t.Fatalf("stream error code = %q", code)
+	}
+}
+
+func TestHandleStreamErrorRewritesMessage(t *testing.T) {
+	old := relaycommon.StreamErrorRewriter
+	defer func() { relaycommon.StreamErrorRewriter = old }()
+	relaycommon.StreamErrorRewriter = func(c *gin.Context, err *types.NewAPIError) {
+		err.RewriteMessage("service busy")
+	}
+
+	info := &relaycommon.RelayInfo{RelayFormat: types.RelayFormatClaude}
+	apiErr := types.NewClaudeStreamError(types.ClaudeError{Type: "overloaded_error", Message: "vendor cluster overloaded"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	_ = StringData(c, `{"type":"message_start"}`)
+	if got := HandleStreamError(c, info, apiErr); got != nil {
+		t.Fatalf("expected nil after the stream started, got %v", got)
+	}
+	if strings.Contains(w.Body.String(), "vendor cluster") || !strings.Contains(w.Body.String(), "service busy") {
+		t.Fatalf("stream error was not rewritten: %s", w.Body.String())
+	}
+}
@@ -12,9 +12,11 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
 
@@ -69,6 +71,11 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		pingTicker = time.NewTicker(pingInterval)
 	}
 
+	// 长时间的流式响应定期按已输出的内容追加预扣费，避免额度耗尽后靠一个长连接持续输出
+	checkpointInterval := time.Duration(operation_setting.GetQuotaSetting().StreamCheckpointSeconds) * time.Second
+	checkpointEnabled := checkpointInterval > 0 && relaycommon.StreamQuotaCheckpoint != nil
+	lastObserved := time.Now()
+
 	if common.DebugEnabled {
 		// print timeout and ping interval for debugging
 		println("relay timeout seconds:", common.RelayTimeout)
@@ -190,6 +197,14 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			}
 		}()
 
+		// 已输出的 token 数由处理器的分词计数提供，结束时按实际用量结算
+		lastCheckpoint := time.Now()
+		stopByQuota := func(err error) {
+			logger.LogWarn(c, "stream stopped by quota checkpoint: "+err.Error())
+			writeMutex.Lock()
+			writeStreamErrorEvent(c, info, types.ErrorCodeInsufficientUserQuota, err.Error())
+			writeMutex.Unlock()
+		}
 		for scanner.Scan() {
 			// 检查是否需要停止
 			select {
@@ -233,6 +248,27 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 					if !success {
 						return
 					}
+					if info.StreamCompletionTokens == nil {
+						break
+					}
+					completionTokens := info.StreamCompletionTokens()
+					if relaycommon.StreamTokensObserver != nil && time.Since(lastObserved) >= time.Second {
+						lastObserved = time.Now()
+						relaycommon.StreamTokensObserver(c, info, completionTokens)
+					}
+					if relaycommon.StreamHardCapCheck != nil {
+						if err := relaycommon.StreamHardCapCheck(info, completionTokens); err != nil {
+							stopByQuota(err)
+							return
+						}
+					}
+					if checkpointEnabled && time.Since(lastCheckpoint) >= checkpointInterval {
+						lastCheckpoint = time.Now()
+						if err := relaycommon.StreamQuotaCheckpoint(c, info, completionTokens); err != nil {
+							stopByQuota(err)
+							return
+						}
+					}
 				case <-time.After(10 * time.Second):
 					logger.LogError(c, "data handler timeout")
 					return
@@ -268,5 +304,36 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	case <-c.Request.Context().Done():
 		// 客户端断开连接
 		logger.LogInfo(c, "client disconnected")
+		return
 	}
+
+	// 超过客户端指定的截止时间时上游调用被中断，告知客户端输出已截断，已生成的内容照常计费
+	if deadline, ok := common.GetContextKeyType[time.Time](c, constant.ContextKeyRequestDeadline); ok && !time.Now().Before(deadline) {
+		logger.LogWarn(c, "request deadline exceeded, stream truncated")
+		writeMutex.Lock()
+		writeDeadlineExceededEvent(c, info)
+		writeMutex.Unlock()
+	}
+}
+
+func writeDeadlineExceededEvent(c *gin.Context, info *relaycommon.RelayInfo) {
+	writeStreamErrorEvent(c, info, types.ErrorCodeRequestTimeout, "request deadline exceeded, the output is truncated")
+}
+
+// writeStreamErrorEvent tells the client in the format of the stream why the output stops early.
+func writeStreamErrorEvent(c *gin.Context, info *relaycommon.RelayInfo, code types.ErrorCode, message string) {
+	if info != nil && info.RelayFormat == types.RelayFormatClaude {
+		_ = ClaudeData(c, dto.ClaudeResponse{
+			Type:  "error",
+			Error: types.ClaudeError{Type: string(code), Message: message},
+		})
+		return
+	}
+	_ = ObjectData(c, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    string(types.ErrorTypeNewAPIError),
+			Code:    code,
+		},
+	})
 }
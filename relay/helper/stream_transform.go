@@ -0,0 +1,224 @@
+package helper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 流式输出转换器
+//
+// 渠道在 settings 的 stream_transformers 中按顺序列出转换器名称，StringData 写出每个 SSE data 块之前
+// 依次交给这些转换器处理，例如 ["strip_provider_fields", "normalize_finish_reason", "model_alias"]。
+// 第三方转换器在自己包的 init 中调用 RegisterStreamTransformer 注册。
+
+// StreamTransformer rewrites the SSE data chunks of a stream before they are written to the client.
+type StreamTransformer interface {
+	// Transform returns the chunks to write in place of data, none drops it and more than one splits it.
+	// data is the chunk without the "data: " prefix, the final "[DONE]" passes through as well.
+	Transform(c *gin.Context, data string) []string
+}
+
+type StreamTransformerFunc func(c *gin.Context, data string) []string
+
+func (f StreamTransformerFunc) Transform(c *gin.Context, data string) []string {
+	return f(c, data)
+}
+
+const (
+	StreamTransformerStripProviderFields   = "strip_provider_fields"
+	StreamTransformerModelAlias            = "model_alias"
+	StreamTransformerNormalizeFinishReason = "normalize_finish_reason"
+	StreamTransformerUsageInFinalChunk     = "usage_in_final_chunk"
+)
+
+// streamTransformers 只在 init 阶段写入，之后只读
+var streamTransformers = map[string]StreamTransformer{}
+
+// RegisterStreamTransformer registers a transformer under name, it panics on duplicate registrations.
+func RegisterStreamTransformer(name string, transformer StreamTransformer) {
+	if name == "" || transformer == nil {
+		panic("stream transformer: empty name or nil transformer")
+	}
+	if _, exists := streamTransformers[name]; exists {
+		panic(fmt.Sprintf("stream transformer %s: already registered", name))
+	}
+	streamTransformers[name] = transformer
+}
+
+// StreamTransformerNames lists the registered transformers in name order.
+func StreamTransformerNames() []string {
+	names := make([]string, 0, len(streamTransformers))
+	for name := range streamTransformers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateStreamTransformers checks that every transformer configured on a channel is registered.
+func ValidateStreamTransformers(names []string) error {
+	for _, name := range names {
+		if _, ok := streamTransformers[name]; !ok {
+			return fmt.Errorf("未知的流式转换器 %s，可选值：%s", name, strings.Join(StreamTransformerNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// transformStreamData runs data through the transformers of the current channel in order.
+func transformStreamData(c *gin.Context, data string) []string {
+	settings, ok := common.GetContextKeyType[dto.ChannelOtherSettings](c, constant.ContextKeyChannelOtherSetting)
+	if !ok || len(settings.StreamTransformers) == 0 {
+		return []string{data}
+	}
+	chunks := []string{data}
+	for _, name := range settings.StreamTransformers {
+		transformer, exists := streamTransformers[name]
+		if !exists {
+			continue
+		}
+		next := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			next = append(next, transformer.Transform(c, chunk)...)
+		}
+		chunks = next
+	}
+	return chunks
+}
+
+func init() {
+	RegisterStreamTransformer(StreamTransformerStripProviderFields, StreamTransformerFunc(stripProviderFields))
+	RegisterStreamTransformer(StreamTransformerModelAlias, StreamTransformerFunc(modelAlias))
+	RegisterStreamTransformer(StreamTransformerNormalizeFinishReason, StreamTransformerFunc(normalizeFinishReason))
+	RegisterStreamTransformer(StreamTransformerUsageInFinalChunk, StreamTransformerFunc(usageInFinalChunk))
+}
+
+// 部分上游在 OpenAI 格式的流中附带的私有字段
+var (
+	providerChunkFields  = []string{"provider", "x_groq", "prompt_filter_results", "citations", "search_results"}
+	providerChoiceFields = []string{"native_finish_reason", "content_filter_results", "content_filter_result", "stop_reason"}
+)
+
+func isJSONChunk(data string) bool {
+	return strings.HasPrefix(data, "{") && gjson.Valid(data)
+}
+
+func stripProviderFields(c *gin.Context, data string) []string {
+	if !isJSONChunk(data) {
+		return []string{data}
+	}
+	for _, field := range providerChunkFields {
+		if gjson.Get(data, field).Exists() {
+			data, _ = sjson.Delete(data, field)
+		}
+	}
+	choices := gjson.Get(data, "choices").Array()
+	for i := range choices {
+		for _, field := range providerChoiceFields {
+			path := fmt.Sprintf("choices.%d.%s", i, field)
+			if gjson.Get(data, path).Exists() {
+				data, _ = sjson.Delete(data, path)
+			}
+		}
+	}
+	return []string{data}
+}
+
+// modelAlias 将上游返回的模型名改回用户请求时使用的名称（模型映射前）
+func modelAlias(c *gin.Context, data string) []string {
+	alias := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	if alias == "" || !isJSONChunk(data) {
+		return []string{data}
+	}
+	if model := gjson.Get(data, "model"); model.Exists() && model.String() != alias {
+		data, _ = sjson.Set(data, "model", alias)
+	}
+	return []string{data}
+}
+
+var finishReasonAliases = map[string]string{
+	"end_turn":       "stop",
+	"stop_sequence":  "stop",
+	"eos":            "stop",
+	"eos_token":      "stop",
+	"complete":       "stop",
+	"finish":         "stop",
+	"max_tokens":     "length",
+	"model_length":   "length",
+	"tool_use":       "tool_calls",
+	"tool_call":      "tool_calls",
+	"safety":         "content_filter",
+	"recitation":     "content_filter",
+	"content_filter": "content_filter",
+	"stop":           "stop",
+	"length":         "length",
+	"tool_calls":     "tool_calls",
+	"function_call":  "function_call",
+}
+
+// normalizeFinishReason 将各上游的 finish_reason 统一为 OpenAI 的取值
+func normalizeFinishReason(c *gin.Context, data string) []string {
+	if !isJSONChunk(data) {
+		return []string{data}
+	}
+	choices := gjson.Get(data, "choices").Array()
+	for i, choice := range choices {
+		reason := choice.Get("finish_reason")
+		if reason.Type != gjson.String || reason.String() == "" {
+			continue
+		}
+		normalized, ok := finishReasonAliases[strings.ToLower(reason.String())]
+		if !ok || normalized == reason.String() {
+			continue
+		}
+		data, _ = sjson.Set(data, fmt.Sprintf("choices.%d.finish_reason", i), normalized)
+	}
+	return []string{data}
+}
+
+// usageInFinalChunk 暂存带 finish_reason 的块，等到只含 usage 的末尾块到达后合并为一个块发送，
+// 供只从结束块读取用量的客户端使用；流结束前仍未收到 usage 时原样发送暂存的块
+func usageInFinalChunk(c *gin.Context, data string) []string {
+	pending := common.GetContextKeyString(c, constant.ContextKeyStreamPendingFinishChunk)
+	if data == "[DONE]" {
+		if pending == "" {
+			return []string{data}
+		}
+		common.SetContextKey(c, constant.ContextKeyStreamPendingFinishChunk, "")
+		return []string{pending, data}
+	}
+	if !isJSONChunk(data) {
+		return []string{data}
+	}
+	usage := gjson.Get(data, "usage")
+	hasUsage := usage.Exists() && usage.Type != gjson.Null
+	if pending != "" {
+		common.SetContextKey(c, constant.ContextKeyStreamPendingFinishChunk, "")
+		if hasUsage && len(gjson.Get(data, "choices").Array()) == 0 {
+			merged, err := sjson.SetRaw(pending, "usage", usage.Raw)
+			if err == nil {
+				return []string{merged}
+			}
+		}
+		return []string{pending, data}
+	}
+	if hasUsage {
+		return []string{data}
+	}
+	for _, choice := range gjson.Get(data, "choices").Array() {
+		if reason := choice.Get("finish_reason"); reason.Type == gjson.String && reason.String() != "" {
+			common.SetContextKey(c, constant.ContextKeyStreamPendingFinishChunk, data)
+			return nil
+		}
+	}
+	return []string{data}
+}
@@ -0,0 +1,70 @@
+package helper
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestTransformStreamDataChain(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "my-alias")
+	common.SetContextKey(c, constant.ContextKeyChannelOtherSetting, dto.ChannelOtherSettings{
+		StreamTransformers: []string{
+			StreamTransformerStripProviderFields,
+			StreamTransformerNormalizeFinishReason,
+			StreamTransformerModelAlias,
+			StreamTransformerUsageInFinalChunk,
+		},
+	})
+
+	chunks := transformStreamData(c, `{"model":"upstream","provider":"x","choices":[{"index":0,"delta":{"content":"hi"},"native_finish_reason":null}]}`)
+	if len(chunks) != 1 {
+		t.Fatalf("content chunk: got %d chunks", len(chunks))
+	}
+	if gjson.Get(chunks[0], "provider").Exists() || gjson.Get(chunks[0], "choices.0.native_finish_reason").Exists() {
+		t.Fatalf("provider fields not stripped: %s", chunks[0])
+	}
+	if model := gjson.Get(chunks[0], "model").String(); model != "my-alias" {
+		t.Fatalf("model = %q, want my-alias", model)
+	}
+
+	// 结束块被暂存，与随后的 usage 块合并
+	if chunks = transformStreamData(c, `{"model":"upstream","choices":[{"index":0,"delta":{},"finish_reason":"end_turn"}]}`); len(chunks) != 0 {
+		t.Fatalf("finish chunk should be held back, got %v", chunks)
+	}
+	chunks = transformStreamData(c, `{"model":"upstream","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`)
+	if len(chunks) != 1 {
+		t.Fatalf("usage chunk: got %d chunks", len(chunks))
+	}
+	if reason := gjson.Get(chunks[0], "choices.0.finish_reason").String(); reason != "stop" {
+		t.Fatalf("finish_reason = %q, want stop", reason)
+	}
+	if total := gjson.Get(chunks[0], "usage.total_tokens").Int(); total != 4 {
+		t.Fatalf("usage.total_tokens = %d, want 4", total)
+	}
+	if chunks = transformStreamData(c, "[DONE]"); len(chunks) != 1 || chunks[0] != "[DONE]" {
+		t.Fatalf("done chunk: got %v", chunks)
+	}
+}
+
+func TestTransformStreamDataFlushesPendingOnDone(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(c, constant.ContextKeyChannelOtherSetting, dto.ChannelOtherSettings{
+		StreamTransformers: []string{StreamTransformerUsageInFinalChunk},
+	})
+	finish := `{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`
+	if chunks := transformStreamData(c, finish); len(chunks) != 0 {
+		t.Fatalf("finish chunk should be held back, got %v", chunks)
+	}
+	chunks := transformStreamData(c, "[DONE]")
+	if len(chunks) != 2 || chunks[0] != finish || chunks[1] != "[DONE]" {
+		t.Fatalf("pending finish chunk not flushed before [DONE]: %v", chunks)
+	}
+}
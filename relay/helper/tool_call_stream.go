@@ -0,0 +1,224 @@
+package helper
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ToolCallStream 将上游流式工具调用的参数片段转换为 OpenAI 格式的增量 arguments：
+// 按工具调用首次出现的顺序分配从 0 开始的 index，片段末尾不完整的转义序列留到下一个片段一起下发，
+// 结束时补全被截断的 JSON（例如达到 max_tokens），保证客户端拼接全部片段后得到合法的 JSON。
+// 上游的工具调用用 key 区分，例如 Claude 的 content block index。零值可以直接使用。
+type ToolCallStream struct {
+	calls map[int]*toolCallArgs
+	next  int
+}
+
+type toolCallArgs struct {
+	index    int
+	emitted  strings.Builder
+	pending  string
+	finished bool
+}
+
+// Start registers the upstream tool call and returns its OpenAI index.
+func (s *ToolCallStream) Start(key int) int {
+	if s.calls == nil {
+		s.calls = make(map[int]*toolCallArgs)
+	}
+	if call, ok := s.calls[key]; ok {
+		return call.index
+	}
+	s.calls[key] = &toolCallArgs{index: s.next}
+	s.next++
+	return s.calls[key].index
+}
+
+// Index returns the OpenAI index of the upstream tool call, false when it has not been started.
+func (s *ToolCallStream) Index(key int) (int, bool) {
+	call, ok := s.calls[key]
+	if !ok {
+		return 0, false
+	}
+	return call.index, true
+}
+
+// Append buffers a fragment of the arguments and returns the part that is safe to send now, it may be empty.
+func (s *ToolCallStream) Append(key int, fragment string) string {
+	s.Start(key)
+	call := s.calls[key]
+	if call.finished {
+		return ""
+	}
+	data := call.pending + fragment
+	cut := len(data) - incompleteEscapeLen(data)
+	call.pending = data[cut:]
+	call.emitted.WriteString(data[:cut])
+	return data[:cut]
+}
+
+// Finish flushes the buffered fragment and returns what must still be sent so that the arguments
+// form valid JSON. An empty string means nothing is left to send.
+func (s *ToolCallStream) Finish(key int) string {
+	call, ok := s.calls[key]
+	if !ok || call.finished {
+		return ""
+	}
+	call.finished = true
+	// 未下发的不完整转义序列直接丢弃，由补全的结尾闭合字符串
+	call.pending = ""
+	emitted := call.emitted.String()
+	if strings.TrimSpace(emitted) == "" {
+		return "{}"
+	}
+	if json.Valid([]byte(emitted)) {
+		return ""
+	}
+	return closeTruncatedJSON(emitted)
+}
+
+// incompleteEscapeLen returns the length of the escape sequence cut off at the end of s, 0 when there is none.
+func incompleteEscapeLen(s string) int {
+	// 从末尾向前找到最近的反斜杠，连续反斜杠数量为奇数时它是转义的开始
+	for i := len(s) - 1; i >= 0 && i >= len(s)-6; i-- {
+		if s[i] != '\\' {
+			continue
+		}
+		run := 0
+		for j := i; j >= 0 && s[j] == '\\'; j-- {
+			run++
+		}
+		if run%2 == 0 {
+			return 0
+		}
+		rest := s[i+1:]
+		if rest == "" || (rest[0] == 'u' && len(rest) < 5) {
+			return len(s) - i
+		}
+		return 0
+	}
+	return 0
+}
+
+const (
+	jsonExpectKey = iota
+	jsonExpectColon
+	jsonExpectValue
+	jsonAfterValue
+)
+
+type jsonLevel struct {
+	kind  byte
+	state int
+}
+
+// closeTruncatedJSON returns the suffix that closes the open strings, literals and containers of a truncated JSON text.
+func closeTruncatedJSON(s string) string {
+	stack := []jsonLevel{{kind: 0, state: jsonExpectValue}}
+	inString, escaped := false, false
+	literal := ""
+	valueDone := func() {
+		top := &stack[len(stack)-1]
+		if top.kind == '{' && top.state == jsonExpectKey {
+			top.state = jsonExpectColon
+		} else {
+			top.state = jsonAfterValue
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if inString {
+			if escaped {
+				escaped = false
+			} else if ch == '\\' {
+				escaped = true
+			} else if ch == '"' {
+				inString = false
+				valueDone()
+			}
+			continue
+		}
+		if isJSONLiteralChar(ch) {
+			if literal == "" {
+				valueDone()
+			}
+			literal += string(ch)
+			continue
+		}
+		literal = ""
+		top := &stack[len(stack)-1]
+		switch ch {
+		case '"':
+			inString = true
+		case '{':
+			top.state = jsonAfterValue
+			stack = append(stack, jsonLevel{kind: '{', state: jsonExpectKey})
+		case '[':
+			top.state = jsonAfterValue
+			stack = append(stack, jsonLevel{kind: '[', state: jsonExpectValue})
+		case '}', ']':
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+				stack[len(stack)-1].state = jsonAfterValue
+			}
+		case ':':
+			top.state = jsonExpectValue
+		case ',':
+			if top.kind == '{' {
+				top.state = jsonExpectKey
+			} else {
+				top.state = jsonExpectValue
+			}
+		}
+	}
+
+	var suffix strings.Builder
+	if inString {
+		if escaped {
+			suffix.WriteByte('\\')
+		}
+		suffix.WriteByte('"')
+		valueDone()
+	} else if literal != "" {
+		suffix.WriteString(completeJSONLiteral(literal))
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		level := stack[i]
+		switch level.state {
+		case jsonExpectColon:
+			suffix.WriteString(":null")
+		case jsonExpectValue:
+			if level.kind != '[' || !strings.HasSuffix(strings.TrimSpace(s+suffix.String()), "[") {
+				suffix.WriteString("null")
+			}
+		case jsonExpectKey:
+			if !strings.HasSuffix(strings.TrimSpace(s+suffix.String()), "{") {
+				suffix.WriteString(`"":null`)
+			}
+		}
+		if level.kind == '{' {
+			suffix.WriteByte('}')
+		} else if level.kind == '[' {
+			suffix.WriteByte(']')
+		}
+	}
+	return suffix.String()
+}
+
+func isJSONLiteralChar(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '+' || ch == '.' || ch == 'E'
+}
+
+// completeJSONLiteral completes a truncated true, false, null or number.
+func completeJSONLiteral(literal string) string {
+	for _, word := range []string{"true", "false", "null"} {
+		if strings.HasPrefix(word, literal) {
+			return word[len(literal):]
+		}
+	}
+	switch literal[len(literal)-1] {
+	case '-', '+', '.', 'e', 'E':
+		return "0"
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package helper
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToolCallStreamParallelCalls(t *testing.T) {
+	var stream ToolCallStream
+	args := map[int]string{}
+	send := func(key int, fragment string) {
+		args[key] += stream.Append(key, fragment)
+	}
+
+	// Claude 的 content block 0 为文本，工具调用从 block 1 开始
+	if idx := stream.Start(1); idx != 0 {
+		t.Fatalf("first tool call index = %d, want 0", idx)
+	}
+	if idx := stream.Start(2); idx != 1 {
+		t.Fatalf("second tool call index = %d, want 1", idx)
+	}
+	send(1, "")
+	send(1, `{"city": "Par`)
+	send(2, `{"query": "line\`)
+	if args[2] != `{"query": "line` {
+		t.Fatalf("incomplete escape should be held back, got %q", args[2])
+	}
+	send(1, `is"}`)
+	send(2, `nbreak \u00`)
+	send(2, `e9"}`)
+	args[1] += stream.Finish(1)
+	args[2] += stream.Finish(2)
+
+	want := map[int]string{
+		1: `{"city": "Paris"}`,
+		2: `{"query": "line\nbreak \u00e9"}`,
+	}
+	for key, expected := range want {
+		if args[key] != expected {
+			t.Fatalf("tool %d arguments = %q, want %q", key, args[key], expected)
+		}
+	}
+	if idx, ok := stream.Index(2); !ok || idx != 1 {
+		t.Fatalf("Index(2) = %d, %v", idx, ok)
+	}
+}
+
+func TestToolCallStreamFinishRepairsArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		fragments []string
+		want      string
+	}{
+		{name: "empty arguments", fragments: []string{""}, want: "{}"},
+		{name: "complete arguments", fragments: []string{`{"a":`, `1}`}, want: `{"a":1}`},
+		{name: "truncated string", fragments: []string{`{"a":"hel`}, want: `{"a":"hel"}`},
+		{name: "truncated key", fragments: []string{`{"a":1,"b`}, want: `{"a":1,"b":null}`},
+		{name: "after colon", fragments: []string{`{"a":`}, want: `{"a":null}`},
+		{name: "after comma", fragments: []string{`{"a":[1,`}, want: `{"a":[1,null]}`},
+		{name: "truncated literal", fragments: []string{`{"a":tr`}, want: `{"a":true}`},
+		{name: "truncated number", fragments: []string{`{"a":1.`}, want: `{"a":1.0}`},
+		{name: "nested containers", fragments: []string{`{"a":{"b":[{"c":"d"`}, want: `{"a":{"b":[{"c":"d"}]}}`},
+		{name: "dangling escape", fragments: []string{`{"a":"x\u12`}, want: `{"a":"x"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stream ToolCallStream
+			got := ""
+			for _, fragment := range tt.fragments {
+				got += stream.Append(0, fragment)
+			}
+			got += stream.Finish(0)
+			if got != tt.want {
+				t.Fatalf("arguments = %q, want %q", got, tt.want)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Fatalf("arguments %q are not valid JSON", got)
+			}
+			if rest := stream.Finish(0); rest != "" {
+				t.Fatalf("second Finish returned %q", rest)
+			}
+		})
+	}
+}
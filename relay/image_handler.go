@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -106,7 +107,11 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 		}
 	}
 
+	rehostWriter := service.StartImageRehost(c, info)
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if rehostWriter != nil {
+		rehostWriter.Finish(c)
+	}
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
@@ -121,8 +126,8 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 	}
 
 	quality := "standard"
-	if request.Quality == "hd" {
-		quality = "hd"
+	if request.Quality != "" {
+		quality = request.Quality
 	}
 
 	var logContent []string
@@ -136,6 +141,9 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 	if request.N > 0 {
 		logContent = append(logContent, fmt.Sprintf("生成数量 %d", request.N))
 	}
+	if price, ok := ratio_setting.GetImageGenerationPrice(info.OriginModelName, imageReq.Size, imageReq.Quality); ok && info.PriceData.UsePrice {
+		logContent = append(logContent, fmt.Sprintf("每张价格 %.4f", price))
+	}
 
 	postConsumeQuota(c, info, usage.(*dto.Usage), logContent...)
 	return nil
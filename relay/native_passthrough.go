@@ -0,0 +1,125 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nativePassthroughEnabled reports whether the request is relayed byte for byte: the token asks for it, the inbound
+// protocol is the native protocol of the channel, and neither the channel nor the group rewrites the request with a
+// model mapping, a parameter override, a system prompt or default parameters, which a token must not bypass.
+func nativePassthroughEnabled(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenNativePassthrough) {
+		return false
+	}
+	if info.IsModelMapped || len(info.ParamOverride) > 0 || info.ChannelSetting.SystemPrompt != "" ||
+		len(operation_setting.GetRequestDefaultsSetting().GetDefaults(info.UsingGroup)) > 0 {
+		return false
+	}
+	return relaycommon.IsNativeRelayFormat(info.ApiType, info.RelayFormat)
+}
+
+// nativePassthroughHelper sends the original request body and copies the upstream response to the client
+// unchanged, only reading the usage from it for billing.
+func nativePassthroughHelper(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Usage, *types.NewAPIError) {
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return nil, types.NewError(errors.New("invalid api type"), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
+	}
+	adaptor.Init(info)
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	common.SetContextKey(c, constant.ContextKeyNativePassthrough, true)
+
+	resp, err := adaptor.DoRequest(c, info, bytes.NewReader(body))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	httpResp, ok := resp.(*http.Response)
+	if !ok || httpResp == nil {
+		return nil, types.NewOpenAIError(errors.New("empty upstream response"), types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+	defer httpResp.Body.Close()
+	info.IsStream = info.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+	if httpResp.StatusCode != http.StatusOK {
+		newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+		service.ResetStatusCode(newAPIError, c.GetString("status_code_mapping"))
+		return nil, newAPIError
+	}
+
+	for k, v := range httpResp.Header {
+		switch k {
+		case "Content-Length", "Connection", "Transfer-Encoding":
+			continue
+		}
+		c.Writer.Header()[k] = v
+	}
+	c.Writer.WriteHeader(httpResp.StatusCode)
+
+	usageReader := relaycommon.NewPassthroughUsage(info.RelayFormat)
+	if strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream") {
+		err = copyPassthroughStream(c, info, httpResp.Body, usageReader)
+	} else {
+		var buffer bytes.Buffer
+		_, err = io.Copy(io.MultiWriter(c.Writer, &buffer), httpResp.Body)
+		info.SetFirstResponseTime()
+		usageReader.Observe(buffer.Bytes())
+		common.CapturePayloadForLog(c, constant.ContextKeyLoggedResponseBody, buffer.Bytes())
+	}
+	if err != nil {
+		// 响应头已经发出，只能记录错误并按已收到的内容计费
+		logger.LogError(c, "native passthrough copy failed: "+err.Error())
+	}
+
+	if usage, ok := usageReader.Usage(); ok {
+		return usage, nil
+	}
+	return service.ResponseText2Usage(c, usageReader.Text(), info.UpstreamModelName, info.GetEstimatePromptTokens()), nil
+}
+
+// copyPassthroughStream writes the events line by line, flushing at the end of each event.
+func copyPassthroughStream(c *gin.Context, info *relaycommon.RelayInfo, body io.Reader, usageReader *relaycommon.PassthroughUsage) error {
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			info.SetFirstResponseTime()
+			if _, writeErr := c.Writer.Write(line); writeErr != nil {
+				return writeErr
+			}
+			trimmed := bytes.TrimSpace(line)
+			if data, ok := bytes.CutPrefix(trimmed, []byte("data:")); ok {
+				usageReader.Observe(data)
+				common.AppendPayloadChunkForLog(c, constant.ContextKeyLoggedResponseBody, string(data))
+			}
+			if len(trimmed) == 0 {
+				_ = helper.FlushWriter(c)
+			}
+		}
+		if err != nil {
+			_ = helper.FlushWriter(c)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel/jina"
 	"github.com/QuantumNous/new-api/relay/channel/minimax"
 	"github.com/QuantumNous/new-api/relay/channel/mistral"
+	"github.com/QuantumNous/new-api/relay/channel/mock"
 	"github.com/QuantumNous/new-api/relay/channel/mokaai"
 	"github.com/QuantumNous/new-api/relay/channel/moonshot"
 	"github.com/QuantumNous/new-api/relay/channel/ollama"
@@ -28,7 +29,9 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel/palm"
 	"github.com/QuantumNous/new-api/relay/channel/perplexity"
 	"github.com/QuantumNous/new-api/relay/channel/replicate"
+	"github.com/QuantumNous/new-api/relay/channel/selfhosted"
 	"github.com/QuantumNous/new-api/relay/channel/siliconflow"
+	"github.com/QuantumNous/new-api/relay/channel/stability"
 	"github.com/QuantumNous/new-api/relay/channel/submodel"
 	taskali "github.com/QuantumNous/new-api/relay/channel/task/ali"
 	taskdoubao "github.com/QuantumNous/new-api/relay/channel/task/doubao"
@@ -50,78 +53,53 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+func init() {
+	registerBuiltinAdaptor(constant.APITypeAli, func() channel.Adaptor { return &ali.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeAnthropic, func() channel.Adaptor { return &claude.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeBaidu, func() channel.Adaptor { return &baidu.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeGemini, func() channel.Adaptor { return &gemini.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeOpenAI, func() channel.Adaptor { return &openai.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypePaLM, func() channel.Adaptor { return &palm.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeTencent, func() channel.Adaptor { return &tencent.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeXunfei, func() channel.Adaptor { return &xunfei.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeZhipu, func() channel.Adaptor { return &zhipu.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeZhipuV4, func() channel.Adaptor { return &zhipu_4v.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeOllama, func() channel.Adaptor { return &ollama.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypePerplexity, func() channel.Adaptor { return &perplexity.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeAws, func() channel.Adaptor { return &aws.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeCohere, func() channel.Adaptor { return &cohere.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeDify, func() channel.Adaptor { return &dify.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeJina, func() channel.Adaptor { return &jina.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeCloudflare, func() channel.Adaptor { return &cloudflare.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeSiliconFlow, func() channel.Adaptor { return &siliconflow.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeVertexAi, func() channel.Adaptor { return &vertex.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeMistral, func() channel.Adaptor { return &mistral.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeDeepSeek, func() channel.Adaptor { return &deepseek.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeMokaAI, func() channel.Adaptor { return &mokaai.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeVolcEngine, func() channel.Adaptor { return &volcengine.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeBaiduV2, func() channel.Adaptor { return &baidu_v2.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeOpenRouter, func() channel.Adaptor { return &openai.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeXinference, func() channel.Adaptor { return &openai.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeXai, func() channel.Adaptor { return &xai.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeCoze, func() channel.Adaptor { return &coze.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeJimeng, func() channel.Adaptor { return &jimeng.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeMoonshot, func() channel.Adaptor { return &moonshot.Adaptor{} }) // Moonshot uses Claude API
+	registerBuiltinAdaptor(constant.APITypeSubmodel, func() channel.Adaptor { return &submodel.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeMiniMax, func() channel.Adaptor { return &minimax.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeReplicate, func() channel.Adaptor { return &replicate.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeCodex, func() channel.Adaptor { return &codex.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeMock, func() channel.Adaptor { return &mock.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeSelfHosted, func() channel.Adaptor { return &selfhosted.Adaptor{} })
+	registerBuiltinAdaptor(constant.APITypeStability, func() channel.Adaptor { return &stability.Adaptor{} })
+}
+
+func registerBuiltinAdaptor(apiType int, factory func() channel.Adaptor) {
+	channel.RegisterAdaptor(channel.AdaptorMeta{APIType: apiType, Builtin: true}, factory)
+}
+
+// GetAdaptor returns a new adaptor for the api type, built-in and plugin adaptors alike.
 func GetAdaptor(apiType int) channel.Adaptor {
-	switch apiType {
-	case constant.APITypeAli:
-		return &ali.Adaptor{}
-	case constant.APITypeAnthropic:
-		return &claude.Adaptor{}
-	case constant.APITypeBaidu:
-		return &baidu.Adaptor{}
-	case constant.APITypeGemini:
-		return &gemini.Adaptor{}
-	case constant.APITypeOpenAI:
-		return &openai.Adaptor{}
-	case constant.APITypePaLM:
-		return &palm.Adaptor{}
-	case constant.APITypeTencent:
-		return &tencent.Adaptor{}
-	case constant.APITypeXunfei:
-		return &xunfei.Adaptor{}
-	case constant.APITypeZhipu:
-		return &zhipu.Adaptor{}
-	case constant.APITypeZhipuV4:
-		return &zhipu_4v.Adaptor{}
-	case constant.APITypeOllama:
-		return &ollama.Adaptor{}
-	case constant.APITypePerplexity:
-		return &perplexity.Adaptor{}
-	case constant.APITypeAws:
-		return &aws.Adaptor{}
-	case constant.APITypeCohere:
-		return &cohere.Adaptor{}
-	case constant.APITypeDify:
-		return &dify.Adaptor{}
-	case constant.APITypeJina:
-		return &jina.Adaptor{}
-	case constant.APITypeCloudflare:
-		return &cloudflare.Adaptor{}
-	case constant.APITypeSiliconFlow:
-		return &siliconflow.Adaptor{}
-	case constant.APITypeVertexAi:
-		return &vertex.Adaptor{}
-	case constant.APITypeMistral:
-		return &mistral.Adaptor{}
-	case constant.APITypeDeepSeek:
-		return &deepseek.Adaptor{}
-	case constant.APITypeMokaAI:
-		return &mokaai.Adaptor{}
-	case constant.APITypeVolcEngine:
-		return &volcengine.Adaptor{}
-	case constant.APITypeBaiduV2:
-		return &baidu_v2.Adaptor{}
-	case constant.APITypeOpenRouter:
-		return &openai.Adaptor{}
-	case constant.APITypeXinference:
-		return &openai.Adaptor{}
-	case constant.APITypeXai:
-		return &xai.Adaptor{}
-	case constant.APITypeCoze:
-		return &coze.Adaptor{}
-	case constant.APITypeJimeng:
-		return &jimeng.Adaptor{}
-	case constant.APITypeMoonshot:
-		return &moonshot.Adaptor{} // Moonshot uses Claude API
-	case constant.APITypeSubmodel:
-		return &submodel.Adaptor{}
-	case constant.APITypeMiniMax:
-		return &minimax.Adaptor{}
-	case constant.APITypeReplicate:
-		return &replicate.Adaptor{}
-	case constant.APITypeCodex:
-		return &codex.Adaptor{}
-	}
-	return nil
+	return channel.NewAdaptor(apiType)
 }
 
 func GetTaskPlatform(c *gin.Context) constant.TaskPlatform {
@@ -389,7 +389,7 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 		if channelModel.Type != constant.ChannelTypeVertexAi && channelModel.Type != constant.ChannelTypeGemini {
 			return
 		}
-		baseURL := constant.ChannelBaseURLs[channelModel.Type]
+		baseURL := constant.GetChannelBaseURL(channelModel.Type)
 		if channelModel.GetBaseURL() != "" {
 			baseURL = channelModel.GetBaseURL()
 		}
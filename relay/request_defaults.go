@@ -0,0 +1,51 @@
+package relay
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/tidwall/gjson"
+)
+
+// applyRequestDefaults fills the default parameters of the group the request is relayed in that the client did
+// not set, before the request is converted to the upstream format. Paths that are not fields of the OpenAI
+// request have no effect and are not recorded.
+func applyRequestDefaults(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) error {
+	defaults := operation_setting.GetRequestDefaultsSetting().GetDefaults(info.UsingGroup)
+	if len(defaults) == 0 {
+		return nil
+	}
+	data, err := common.Marshal(request)
+	if err != nil {
+		return err
+	}
+	patch, paths, err := relaycommon.BuildRequestDefaultsPatch(data, defaults)
+	if err != nil || patch == nil {
+		return err
+	}
+	if err = common.Unmarshal(patch, request); err != nil {
+		return err
+	}
+	// 只记录请求结构中存在的参数
+	if data, err = common.Marshal(request); err != nil {
+		return err
+	}
+	paths = lo.Filter(paths, func(path string, _ int) bool {
+		return gjson.GetBytes(data, path).Exists()
+	})
+	if len(paths) == 0 {
+		return nil
+	}
+	info.AppliedRequestDefaults = paths
+	common.SetContextKey(c, constant.ContextKeyRequestDefaults, paths)
+	logger.LogDebug(c, "request defaults of group %s applied: %s", info.UsingGroup, strings.Join(paths, ", "))
+	return nil
+}
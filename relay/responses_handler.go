@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	appconstant "github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -60,11 +61,28 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(fmt.Errorf("failed to copy request to GeneralOpenAIRequest: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	// 后台模式返回的是本站的响应 ID，引用时换成上游的 ID
+	if strings.HasPrefix(request.PreviousResponseID, model.BackgroundResponseIdPrefix) {
+		if upstreamId, err := model.GetBackgroundResponseUpstreamId(info.UserId, request.PreviousResponseID); err == nil && upstreamId != "" {
+			request.PreviousResponseID = upstreamId
+		}
+	}
+
 	err = helper.ModelMappedHelper(c, info, request)
 	if err != nil {
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	// 令牌开启原生透传且协议与渠道一致时，请求和响应原样转发
+	if nativePassthroughEnabled(c, info) {
+		usage, newAPIError := nativePassthroughHelper(c, info)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		postConsumeQuota(c, info, usage, "原生透传")
+		return nil
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
@@ -127,7 +145,9 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		}
 	}
 
+	normalizeWriter := service.StartResponseNormalize(c, info)
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	normalizeWriter.Finish(c)
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
@@ -0,0 +1,146 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// toolCallEmulationEnabled reports whether the tools of the chat completion request are emulated with a prompt
+// because the upstream model has no native tool support.
+func toolCallEmulationEnabled(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) bool {
+	if len(request.Tools) == 0 || info.RelayMode != relayconstant.RelayModeChatCompletions || request.N > 1 {
+		return false
+	}
+	var toolCallSupported *bool
+	if capability, ok := model_setting.GetModelCapability(info.UpstreamModelName); ok {
+		toolCallSupported = capability.ToolCall
+	}
+	return operation_setting.GetToolCallEmulationSetting().ShouldEmulate(info.UpstreamModelName, toolCallSupported)
+}
+
+// toolCallEmulation sends the request without tools, describing them in the system prompt instead, and turns the
+// tool call JSON the model replies with into tool_calls. The upstream call is never streamed, a streaming client
+// receives the rewritten response as a single chunk followed by the finish reason.
+func toolCallEmulation(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*dto.Usage, *types.NewAPIError) {
+	emulated, err := common.DeepCopy(request)
+	if err != nil {
+		return nil, types.NewError(fmt.Errorf("failed to copy request: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+	emulated.Messages = relaycommon.ConvertMessagesForToolCallEmulation(emulated.Messages)
+	if !relaycommon.ToolChoiceDisablesTools(request.ToolChoice) {
+		injectToolCallEmulationPrompt(emulated, relaycommon.BuildToolCallEmulationPrompt(request.Tools, request.ToolChoice))
+	}
+	emulated.Tools = nil
+	emulated.ToolChoice = nil
+	emulated.ParallelTooCalls = nil
+	emulated.Stream = false
+	emulated.StreamOptions = nil
+	applySystemPromptIfNeeded(c, info, emulated)
+	common.SetContextKey(c, constant.ContextKeyToolCallEmulation, true)
+
+	callInfo := *info
+	callInfo.IsStream = false
+	call, newApiErr := newFanOutCall(c, c.Request.Context(), &callInfo, emulated, &fanOutMerger{c: c}, 0)
+	if newApiErr != nil {
+		return nil, newApiErr
+	}
+	usage, newApiErr := call.do()
+	if newApiErr != nil {
+		return nil, newApiErr
+	}
+	collectFanOutInfo(info, []*fanOutCall{call})
+	info.IsStream = request.Stream
+
+	body := call.writer.pending.Bytes()
+	var response dto.OpenAITextResponse
+	if err = common.Unmarshal(body, &response); err != nil || len(response.Choices) == 0 {
+		return nil, types.NewOpenAIError(fmt.Errorf("failed to parse emulated tool call response: %v", err), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	choice := &response.Choices[0]
+	if toolCalls := relaycommon.ParseEmulatedToolCalls(choice.Message.StringContent(), request.Tools); toolCalls != nil {
+		logger.LogDebug(c, "emulated %d tool calls for model %s", len(toolCalls), info.UpstreamModelName)
+		choice.Message.SetNullContent()
+		choice.Message.SetToolCalls(toolCalls)
+		choice.FinishReason = constant.FinishReasonToolCalls
+	}
+	if usage != nil {
+		response.Usage = *usage
+	}
+
+	if request.Stream {
+		writeToolCallEmulationStream(c, info, &response)
+	} else {
+		data, err := common.Marshal(response)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+		}
+		for k, v := range call.writer.header {
+			if k == "Content-Length" || len(v) == 0 {
+				continue
+			}
+			c.Writer.Header().Set(k, v[0])
+		}
+		service.IOCopyBytesGracefully(c, nil, data)
+	}
+	return usage, nil
+}
+
+// injectToolCallEmulationPrompt 追加到第一条字符串形式的系统消息后，没有时新增一条系统消息
+func injectToolCallEmulationPrompt(request *dto.GeneralOpenAIRequest, prompt string) {
+	systemRole := request.GetSystemRoleName()
+	if len(request.Messages) > 0 && request.Messages[0].Role == systemRole && request.Messages[0].IsStringContent() {
+		request.Messages[0].SetStringContent(request.Messages[0].StringContent() + "\n\n" + prompt)
+		return
+	}
+	request.Messages = append([]dto.Message{{Role: systemRole, Content: prompt}}, request.Messages...)
+}
+
+func writeToolCallEmulationStream(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse) {
+	helper.SetEventStreamHeaders(c)
+	created := common.GetTimestamp()
+	if value, ok := response.Created.(float64); ok {
+		created = int64(value)
+	}
+	choice := response.Choices[0]
+	delta := dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"}
+	var responseCalls []dto.ToolCallResponse
+	if len(choice.Message.ToolCalls) > 0 && common.Unmarshal(choice.Message.ToolCalls, &responseCalls) == nil {
+		for i := range responseCalls {
+			responseCalls[i].SetIndex(i)
+		}
+		delta.ToolCalls = responseCalls
+	} else {
+		delta.SetContentString(choice.Message.StringContent())
+	}
+	_ = helper.ObjectData(c, &dto.ChatCompletionsStreamResponse{
+		Id:                response.Id,
+		Object:            "chat.completion.chunk",
+		Created:           created,
+		Model:             response.Model,
+		SystemFingerprint: response.SystemFingerprint,
+		Choices:           []dto.ChatCompletionsStreamResponseChoice{{Delta: delta}},
+	})
+	finishReason := choice.FinishReason
+	if finishReason == "" {
+		finishReason = constant.FinishReasonStop
+	}
+	_ = helper.ObjectData(c, helper.GenerateStopResponse(response.Id, created, response.Model, finishReason))
+	if info.ShouldIncludeUsage {
+		_ = helper.ObjectData(c, helper.GenerateFinalUsageResponse(response.Id, created, response.Model, response.Usage))
+	}
+	helper.Done(c)
+}
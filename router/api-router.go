@@ -9,6 +9,9 @@ import (
 )
 
 func SetApiRouter(router *gin.Engine) {
+	// Prometheus 指标，由 METRICS_TOKEN 鉴权
+	router.GET("/metrics", controller.GetPrometheusMetrics)
+
 	apiRouter := router.Group("/api")
 	apiRouter.Use(gzip.Gzip(gzip.DefaultCompression))
 	apiRouter.Use(middleware.BodyStorageCleanup()) // 清理请求体存储
@@ -17,6 +20,8 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/setup", controller.GetSetup)
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
+		apiRouter.GET("/openapi.json", controller.GetOpenAPISpec(router))
+		apiRouter.GET("/images/:name", controller.GetRehostedImage)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
 		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
@@ -26,13 +31,16 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/about", controller.GetAbout)
 		//apiRouter.GET("/midjourney", controller.GetMidjourney)
 		apiRouter.GET("/home_page_content", controller.GetHomePageContent)
-		apiRouter.GET("/pricing", middleware.TryUserAuth(), controller.GetPricing)
+		apiRouter.GET("/pricing", middleware.TryUserAuth(), middleware.HTTPCache(middleware.UserCacheVariant), controller.GetPricing)
+		apiRouter.GET("/catalog", middleware.TryUserAuth(), middleware.HTTPCache(middleware.UserCacheVariant), controller.GetModelCatalog)
 		apiRouter.GET("/verification", middleware.EmailVerificationRateLimit(), middleware.TurnstileCheck(), controller.SendEmailVerification)
 		apiRouter.GET("/reset_password", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.SendPasswordResetEmail)
 		apiRouter.POST("/user/reset", middleware.CriticalRateLimit(), controller.ResetPassword)
 		apiRouter.GET("/oauth/github", middleware.CriticalRateLimit(), controller.GitHubOAuth)
 		apiRouter.GET("/oauth/discord", middleware.CriticalRateLimit(), controller.DiscordOAuth)
 		apiRouter.GET("/oauth/oidc", middleware.CriticalRateLimit(), controller.OidcAuth)
+		apiRouter.GET("/oauth/sso/:name", middleware.CriticalRateLimit(), controller.SSOAuth)
+		apiRouter.GET("/sso/:name/login", middleware.CriticalRateLimit(), controller.SSOLogin)
 		apiRouter.GET("/oauth/linuxdo", middleware.CriticalRateLimit(), controller.LinuxdoOAuth)
 		apiRouter.GET("/oauth/state", middleware.CriticalRateLimit(), controller.GenerateOAuthCode)
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), controller.WeChatAuth)
@@ -68,8 +76,14 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/self/groups", controller.GetUserGroups)
 				selfRoute.GET("/self", controller.GetSelf)
 				selfRoute.GET("/models", controller.GetUserModels)
+				selfRoute.GET("/self/model_class_quota", controller.GetSelfModelClassQuota)
+				selfRoute.GET("/self/token_budget/:id", controller.GetSelfTokenBudget)
+				selfRoute.GET("/impersonate", controller.GetImpersonationStatus)
+				selfRoute.POST("/impersonate/stop", controller.StopImpersonation)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
+				selfRoute.DELETE("/self/deletion", controller.CancelSelfDeletion)
+				selfRoute.POST("/self/revoke_all", controller.RevokeSelfSessions)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
 				selfRoute.GET("/passkey", controller.PasskeyStatus)
 				selfRoute.POST("/passkey/register/begin", controller.PasskeyRegisterBegin)
@@ -99,6 +113,13 @@ func SetApiRouter(router *gin.Engine) {
 				// Check-in routes
 				selfRoute.GET("/checkin", controller.GetCheckinStatus)
 				selfRoute.POST("/checkin", middleware.TurnstileCheck(), controller.DoCheckin)
+
+				// BYOK: user-owned upstream channels
+				selfRoute.GET("/channels", controller.GetUserChannels)
+				selfRoute.POST("/channels", controller.AddUserChannel)
+				selfRoute.PUT("/channels", controller.UpdateUserChannel)
+				selfRoute.DELETE("/channels/:id", controller.DeleteUserChannel)
+				selfRoute.GET("/channels/:id/test", controller.TestUserChannel)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -111,9 +132,18 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/:id", controller.GetUser)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
+				adminRoute.POST("/bulk/preview", controller.PreviewUserBulk)
+				adminRoute.POST("/bulk/commit", controller.CommitUserBulk)
+				adminRoute.GET("/dormancy/report", controller.GetDormancyReport)
+				adminRoute.POST("/dormancy/run", controller.RunDormancyCleanup)
 				adminRoute.PUT("/", controller.UpdateUser)
+				adminRoute.POST("/:id/quota/adjust", controller.AdjustUserQuota)
+				adminRoute.GET("/:id/quota/snapshot", controller.GetUserQuotaSnapshot)
+				adminRoute.GET("/:id/quota/ledger", controller.GetUserQuotaLedger)
 				adminRoute.DELETE("/:id", controller.DeleteUser)
 				adminRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
+				adminRoute.POST("/:id/impersonate", middleware.RootAuth(), controller.StartImpersonation)
+				adminRoute.PUT("/:id/admin_role", middleware.RootAuth(), controller.SetUserAdminRole)
 
 				// Admin 2FA routes
 				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
@@ -163,13 +193,28 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
+		adminRoleRoute := apiRouter.Group("/admin_role")
+		adminRoleRoute.Use(middleware.RootAuth())
+		{
+			adminRoleRoute.GET("/", controller.GetAdminRoles)
+			adminRoleRoute.PUT("/", controller.UpdateAdminRoles)
+		}
+		apiRouter.GET("/autoscaling/demand", middleware.AdminAuth(), controller.GetModelDemand)
 		performanceRoute := apiRouter.Group("/performance")
 		performanceRoute.Use(middleware.RootAuth())
 		{
 			performanceRoute.GET("/stats", controller.GetPerformanceStats)
 			performanceRoute.DELETE("/disk_cache", controller.ClearDiskCache)
+			performanceRoute.GET("/embedding_cache", controller.GetEmbeddingCacheStats)
+			performanceRoute.DELETE("/embedding_cache", controller.ClearEmbeddingCache)
+			performanceRoute.GET("/completion_cache", controller.GetCompletionCacheStats)
+			performanceRoute.DELETE("/completion_cache", controller.ClearCompletionCache)
+			performanceRoute.GET("/request_queue", controller.GetRequestQueueStats)
 			performanceRoute.POST("/reset_stats", controller.ResetPerformanceStats)
 			performanceRoute.POST("/gc", controller.ForceGC)
+			performanceRoute.GET("/sqlite", controller.GetSQLiteStatus)
+			performanceRoute.POST("/sqlite/checkpoint", controller.CheckpointSQLite)
+			performanceRoute.GET("/sqlite/backup", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.BackupSQLite)
 		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
 		ratioSyncRoute.Use(middleware.RootAuth())
@@ -184,10 +229,24 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/statement", controller.GetChannelStatement)
+			channelRoute.GET("/adaptors", controller.GetChannelAdaptors)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
+			channelRoute.POST("/test/:id", controller.TestChannel)
+			channelRoute.POST("/:id/preview", controller.PreviewChannelRequest)
+			channelRoute.GET("/conformance", controller.GetChannelConformance)
+			channelRoute.GET("/health", controller.GetAllChannelHealth)
+			channelRoute.GET("/routing", controller.GetChannelRouting)
+			channelRoute.PUT("/routing", controller.UpdateChannelRouting)
+			channelRoute.GET("/rebalance", controller.GetChannelRebalanceAdjustments)
+			channelRoute.POST("/rebalance/run", controller.RunChannelRebalance)
+			channelRoute.POST("/rebalance/:id/approve", controller.ApproveChannelRebalanceAdjustment)
+			channelRoute.POST("/rebalance/:id/reject", controller.RejectChannelRebalanceAdjustment)
+			channelRoute.GET("/:id/health", controller.GetChannelHealth)
+			channelRoute.POST("/:id/health/probe", controller.ProbeChannelHealth)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
 			channelRoute.POST("/", controller.AddChannel)
@@ -196,6 +255,8 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
 			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
 			channelRoute.PUT("/tag", controller.EditTagChannels)
+			channelRoute.PUT("/name/:name", controller.UpsertChannelByName)
+			channelRoute.GET("/:id/dependencies", controller.GetChannelDependencies)
 			channelRoute.DELETE("/:id", controller.DeleteChannel)
 			channelRoute.POST("/batch", controller.DeleteChannelBatch)
 			channelRoute.POST("/fix", controller.FixChannelsAbilities)
@@ -211,6 +272,8 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.POST("/ollama/pull/stream", controller.OllamaPullModelStream)
 			channelRoute.DELETE("/ollama/delete", controller.OllamaDeleteModel)
 			channelRoute.GET("/ollama/version/:id", controller.OllamaVersion)
+			channelRoute.GET("/server_info/:id", controller.GetChannelServerInfo)
+			channelRoute.POST("/server_info/:id/sync", controller.SyncChannelServerInfo)
 			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
 			channelRoute.GET("/tag/models", controller.GetTagModels)
 			channelRoute.POST("/copy/:id", controller.CopyChannel)
@@ -221,13 +284,31 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			tokenRoute.GET("/", controller.GetAllTokens)
 			tokenRoute.GET("/search", controller.SearchTokens)
+			tokenRoute.GET("/anomalies", controller.GetTokenAnomalies)
+			tokenRoute.GET("/anomalies/all", middleware.AdminAuth(), controller.GetAllTokenAnomalies)
 			tokenRoute.GET("/:id", controller.GetToken)
+			tokenRoute.POST("/:id/dry_run", controller.DryRunToken)
+			tokenRoute.GET("/:id/sessions", controller.GetTokenSessions)
+			tokenRoute.GET("/:id/quota/ledger", controller.GetTokenQuotaLedger)
+			tokenRoute.GET("/:id/quota/snapshot", controller.GetTokenQuotaSnapshot)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
+			tokenRoute.PUT("/name/:name", controller.UpsertTokenByName)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
 		}
 
+		// 控制台 playground：模型列表和提示词预设，对话请求走 /pg/chat/completions
+		playgroundRoute := apiRouter.Group("/playground")
+		playgroundRoute.Use(middleware.UserAuth())
+		{
+			playgroundRoute.GET("/models", controller.GetPlaygroundModels)
+			playgroundRoute.GET("/presets", controller.GetPlaygroundPresets)
+			playgroundRoute.GET("/presets/:id", controller.GetPlaygroundPreset)
+			playgroundRoute.PUT("/presets", controller.SavePlaygroundPreset)
+			playgroundRoute.DELETE("/presets/:id", controller.DeletePlaygroundPreset)
+		}
+
 		usageRoute := apiRouter.Group("/usage")
 		usageRoute.Use(middleware.CriticalRateLimit())
 		{
@@ -249,28 +330,74 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		analyticsRoute := apiRouter.Group("/analytics")
+		analyticsRoute.GET("/usage", middleware.AdminAuth(), controller.GetUsageAnalytics)
+		analyticsRoute.GET("/self/usage", middleware.UserAuth(), controller.GetSelfUsageAnalytics)
+		analyticsRoute.GET("/report", middleware.AdminAuth(), controller.GetUsageReport)
+		analyticsRoute.GET("/self/report", middleware.UserAuth(), controller.GetSelfUsageReport)
+
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/retention/preview", middleware.AdminAuth(), controller.PreviewLogRetention)
+		logRoute.POST("/retention/run", middleware.AdminAuth(), controller.RunLogRetention)
+		logRoute.GET("/retention/status", middleware.AdminAuth(), controller.GetLogRetentionStatus)
+		logRoute.GET("/audit", middleware.AdminAuth(), controller.GetAuditLogs)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
+		logRoute.GET("/sessions", middleware.AdminAuth(), controller.GetSessionSummaries)
+		logRoute.GET("/self/sessions", middleware.UserAuth(), controller.GetSelfSessionSummaries)
 		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/detail/:id", middleware.AdminAuth(), controller.GetLogDetail)
+		logRoute.POST("/:id/replay", middleware.AdminAuth(), controller.ReplayLog)
+		logRoute.GET("/self/detail/:id", middleware.UserAuth(), controller.GetSelfLogDetail)
+		logRoute.GET("/verify", middleware.AdminAuth(), controller.VerifyLogChain)
+		logRoute.POST("/redaction/preview", middleware.AdminAuth(), controller.PreviewLogRedaction)
+		logRoute.GET("/trace/:request_id", middleware.AdminAuth(), controller.GetRequestTrace)
+		logRoute.GET("/request/:request_id", middleware.AdminAuth(), controller.GetLogsByRequestId)
+		logRoute.GET("/self/request/:request_id", middleware.UserAuth(), controller.GetSelfLogsByRequestId)
+		logRoute.GET("/level", middleware.RootAuth(), controller.GetLogLevel)
+		logRoute.PUT("/level", middleware.RootAuth(), controller.UpdateLogLevel)
+		logRoute.GET("/self/verify", middleware.UserAuth(), controller.VerifySelfLogChain)
 
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
+		dataRoute.GET("/histograms", middleware.AdminAuth(), controller.GetModelHistograms)
+		dataRoute.GET("/slo", middleware.AdminAuth(), controller.GetSLOStatuses)
+		dataRoute.GET("/usage_sharing/preview", middleware.AdminAuth(), controller.PreviewUsageSharingReport)
+		dataRoute.GET("/report_digest/preview", middleware.AdminAuth(), controller.PreviewReportDigest)
+		dataRoute.POST("/report_digest/send", middleware.AdminAuth(), controller.SendReportDigest)
+		dataRoute.GET("/alert/deliveries", middleware.RootAuth(), controller.GetNotificationDeliveries)
+		dataRoute.POST("/alert/deliveries/:id/retry", middleware.RootAuth(), controller.RetryNotificationDelivery)
+		dataRoute.POST("/alert/test", middleware.RootAuth(), controller.FireTestAlert)
+		dataRoute.GET("/notify_sandbox/events", middleware.RootAuth(), controller.GetNotifySandboxEvents)
+		dataRoute.GET("/notify_sandbox/attempts", middleware.RootAuth(), controller.GetNotifySandboxAttempts)
+		dataRoute.POST("/notify_sandbox/send", middleware.RootAuth(), middleware.NotifySandboxRateLimit(), controller.SendNotifySandbox)
 
-		logRoute.Use(middleware.CORS())
+		graphQLRoute := apiRouter.Group("/graphql")
+		graphQLRoute.Use(middleware.UserAuth())
 		{
-			logRoute.GET("/token", controller.GetLogByKey)
+			graphQLRoute.GET("", controller.GraphQL)
+			graphQLRoute.POST("", controller.GraphQL)
 		}
+
+		logRoute.GET("/token", controller.GetLogByKey)
 		groupRoute := apiRouter.Group("/group")
 		groupRoute.Use(middleware.AdminAuth())
 		{
 			groupRoute.GET("/", controller.GetGroups)
+			groupRoute.PUT("/:name", middleware.RootAuth(), controller.UpsertGroup)
+		}
+
+		inFlightRoute := apiRouter.Group("/inflight")
+		inFlightRoute.Use(middleware.AdminAuth())
+		{
+			inFlightRoute.GET("/", controller.GetInFlightRequests)
+			inFlightRoute.POST("/:request_id/cancel", controller.CancelInFlightRequest)
 		}
 
 		prefillGroupRoute := apiRouter.Group("/prefill_group")
@@ -309,6 +436,7 @@ func SetApiRouter(router *gin.Engine) {
 			modelsRoute.GET("/sync_upstream/preview", controller.SyncUpstreamPreview)
 			modelsRoute.POST("/sync_upstream", controller.SyncUpstreamModels)
 			modelsRoute.GET("/missing", controller.GetMissingModels)
+			modelsRoute.GET("/capabilities", controller.GetModelCapabilities)
 			modelsRoute.GET("/", controller.GetAllModelsMeta)
 			modelsRoute.GET("/search", controller.SearchModelsMeta)
 			modelsRoute.GET("/:id", controller.GetModelMeta)
@@ -11,15 +11,17 @@ import (
 )
 
 func SetRelayRouter(router *gin.Engine) {
-	router.Use(middleware.CORS())
+	router.Use(middleware.OtelTracing())
+	router.Use(middleware.LatencyHeaders())
 	router.Use(middleware.DecompressRequestMiddleware())
+	router.Use(middleware.ResponseCompression())
 	router.Use(middleware.BodyStorageCleanup()) // 清理请求体存储
 	router.Use(middleware.StatsMiddleware())
 	// https://platform.openai.com/docs/api-reference/introduction
 	modelsRouter := router.Group("/v1/models")
 	modelsRouter.Use(middleware.TokenAuth())
 	{
-		modelsRouter.GET("", func(c *gin.Context) {
+		modelsRouter.GET("", middleware.HTTPCache(middleware.TokenCacheVariant), func(c *gin.Context) {
 			switch {
 			case c.GetHeader("x-api-key") != "" && c.GetHeader("anthropic-version") != "":
 				controller.ListModels(c, constant.ChannelTypeAnthropic)
@@ -43,7 +45,7 @@ func SetRelayRouter(router *gin.Engine) {
 	geminiRouter := router.Group("/v1beta/models")
 	geminiRouter.Use(middleware.TokenAuth())
 	{
-		geminiRouter.GET("", func(c *gin.Context) {
+		geminiRouter.GET("", middleware.HTTPCache(middleware.TokenCacheVariant), func(c *gin.Context) {
 			controller.ListModels(c, constant.ChannelTypeGemini)
 		})
 	}
@@ -51,19 +53,29 @@ func SetRelayRouter(router *gin.Engine) {
 	geminiCompatibleRouter := router.Group("/v1beta/openai/models")
 	geminiCompatibleRouter.Use(middleware.TokenAuth())
 	{
-		geminiCompatibleRouter.GET("", func(c *gin.Context) {
+		geminiCompatibleRouter.GET("", middleware.HTTPCache(middleware.TokenCacheVariant), func(c *gin.Context) {
 			controller.ListModels(c, constant.ChannelTypeOpenAI)
 		})
 	}
 
 	playgroundRouter := router.Group("/pg")
-	playgroundRouter.Use(middleware.UserAuth(), middleware.Distribute())
+	playgroundRouter.Use(middleware.UserAuth(), middleware.PlaygroundToken(), middleware.Distribute())
 	{
 		playgroundRouter.POST("/chat/completions", controller.Playground)
 	}
+	// 公开演示接口，无需令牌，使用沙盒额度
+	demoRouter := router.Group("/demo/v1")
+	demoRouter.Use(middleware.DemoAuth(), middleware.Distribute())
+	{
+		demoRouter.POST("/chat/completions", func(c *gin.Context) {
+			controller.Relay(c, types.RelayFormatOpenAI)
+		})
+	}
+
 	relayV1Router := router.Group("/v1")
 	relayV1Router.Use(middleware.TokenAuth())
 	relayV1Router.Use(middleware.ModelRequestRateLimit())
+	relayV1Router.Use(middleware.UserConcurrencyLimit())
 	{
 		// WebSocket 路由（统一到 Relay）
 		wsRouter := relayV1Router.Group("")
@@ -71,11 +83,18 @@ func SetRelayRouter(router *gin.Engine) {
 		wsRouter.GET("/realtime", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
+
+		// 以 WebSocket 消息形式下发 chat completions 流式响应
+		wsStreamRouter := relayV1Router.Group("")
+		wsStreamRouter.Use(middleware.StreamWebSocketBridge(), middleware.Distribute())
+		wsStreamRouter.GET("/chat/completions/ws", func(c *gin.Context) {
+			controller.Relay(c, types.RelayFormatOpenAI)
+		})
 	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
-		httpRouter.Use(middleware.Distribute())
+		httpRouter.Use(middleware.SyntheticProbe(), middleware.RequestDedup(), middleware.Distribute())
 
 		// claude related routes
 		httpRouter.POST("/messages", func(c *gin.Context) {
@@ -145,11 +164,6 @@ func SetRelayRouter(router *gin.Engine) {
 
 		// not implemented
 		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -158,6 +172,22 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.DELETE("/models/:model", controller.RelayNotImplemented)
 	}
 
+	{
+		// 文件、批量与后台响应的查询接口不经过渠道分发，批量请求和后台响应异步执行
+		batchRouter := relayV1Router.Group("")
+		batchRouter.GET("/files", controller.ListFiles)
+		batchRouter.POST("/files", controller.UploadFile)
+		batchRouter.GET("/files/:id", controller.RetrieveFile)
+		batchRouter.DELETE("/files/:id", controller.DeleteFile)
+		batchRouter.GET("/files/:id/content", controller.RetrieveFileContent)
+		batchRouter.POST("/batches", controller.CreateBatch)
+		batchRouter.GET("/batches", controller.ListBatches)
+		batchRouter.GET("/batches/:id", controller.RetrieveBatch)
+		batchRouter.POST("/batches/:id/cancel", controller.CancelBatch)
+		batchRouter.GET("/responses/:id", controller.RetrieveBackgroundResponse)
+		batchRouter.POST("/responses/:id/cancel", controller.CancelBackgroundResponse)
+	}
+
 	relayMjRouter := router.Group("/mj")
 	registerMjRouterGroup(relayMjRouter)
 
@@ -176,6 +206,7 @@ func SetRelayRouter(router *gin.Engine) {
 	relayGeminiRouter := router.Group("/v1beta")
 	relayGeminiRouter.Use(middleware.TokenAuth())
 	relayGeminiRouter.Use(middleware.ModelRequestRateLimit())
+	relayGeminiRouter.Use(middleware.RequestDedup())
 	relayGeminiRouter.Use(middleware.Distribute())
 	{
 		// Gemini API 路径格式: /v1beta/models/{model_name}:{action}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+var accountDeletionOnce sync.Once
+
+// DeleteUserAccount disables the user's tokens and sessions, then soft deletes the account.
+func DeleteUserAccount(user *model.User) error {
+	if _, err := model.RevokeUserTokens(user.Id); err != nil {
+		return err
+	}
+	if err := model.RevokeUserSessions(user.Id); err != nil {
+		return err
+	}
+	if err := model.DeleteUserById(user.Id); err != nil {
+		return err
+	}
+	model.RecordLog(user.Id, model.LogTypeManage, fmt.Sprintf("用户 %s 注销账户", user.Username))
+	return nil
+}
+
+// StartAccountDeletionTask deletes the accounts whose self-service deletion request has passed the cooldown.
+func StartAccountDeletionTask() {
+	accountDeletionOnce.Do(func() {
+		if !common.IsMasterNode || common.AccountDeletionCooldownHours <= 0 {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				deadline := common.GetTimestamp() - int64(common.AccountDeletionCooldownHours)*3600
+				users, err := model.GetUsersPendingDeletion(deadline, 100)
+				if err != nil {
+					common.SysError("failed to get users pending deletion: " + err.Error())
+				}
+				for _, user := range users {
+					if user.Role == common.RoleRootUser {
+						continue
+					}
+					if err = DeleteUserAccount(user); err != nil {
+						common.SysError(fmt.Sprintf("failed to delete account of user %d: %s", user.Id, err.Error()))
+						continue
+					}
+					logger.LogModuleInfo(context.Background(), logger.ModuleCleanup, "deleted account of user %d after the deletion cooldown", user.Id)
+				}
+				time.Sleep(10 * time.Minute)
+			}
+		})
+	})
+}
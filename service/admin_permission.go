@@ -0,0 +1,21 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// AdminAllows reports whether the user may perform the action on the admin resource. Root users always may,
+// admins according to the admin role assigned to them, and common users never. Handlers that check the role
+// themselves instead of relying on AdminAuth must use it as well.
+func AdminAllows(userId int, role int, resource string, action string) bool {
+	if role >= common.RoleRootUser {
+		return true
+	}
+	if role < common.RoleAdminUser {
+		return false
+	}
+	userCache, err := model.GetUserCache(userId)
+	return err == nil && system_setting.AdminRoleAllows(userCache.AdminRole, resource, action)
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 告警通知
+//
+// 用户或令牌的已用额度占比越过配置的阈值、渠道被自动禁用时，向告警设置中的 webhook（generic、Slack、Discord、
+// Telegram）和邮箱发送告警。每个接收端的投递单独记录，失败后由主节点按指数退避重试，直到达到最多尝试次数。
+
+const (
+	alertRetryBaseDelay = 30 * time.Second
+	alertRetryMaxDelay  = time.Hour
+)
+
+// Alert 一条告警，Fields 会原样放入 generic 格式的负载
+type Alert struct {
+	Event     string         `json:"event"`
+	Title     string         `json:"title"`
+	Content   string         `json:"content"`
+	Fields    map[string]any `json:"fields,omitempty"`
+	Timestamp int64          `json:"timestamp"`
+}
+
+// alertLevels 本节点上次计算的告警级别，级别不变时跳过数据库
+var alertLevels sync.Map
+
+// FireAlert records a delivery for every webhook subscribed to the event and every email recipient, extra
+// recipients included, and attempts them in the background.
+func FireAlert(alert Alert, extraEmails ...string) []*model.NotificationDelivery {
+	setting := operation_setting.GetAlertSetting()
+	if alert.Timestamp == 0 {
+		alert.Timestamp = time.Now().Unix()
+	}
+	deliveries := make([]*model.NotificationDelivery, 0)
+	for i := range setting.Webhooks {
+		webhook := &setting.Webhooks[i]
+		if !webhook.Subscribes(alert.Event) {
+			continue
+		}
+		payload, err := buildAlertPayload(webhook, alert)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to build alert payload for webhook %s: %s", webhook.Name, err.Error()))
+			continue
+		}
+		deliveries = append(deliveries, &model.NotificationDelivery{
+			Target:  webhook.Name,
+			Format:  webhook.Format,
+			Payload: payload,
+		})
+	}
+	emailPayload, _ := common.Marshal(alert)
+	seen := make(map[string]bool)
+	for _, email := range append(append([]string{}, setting.EmailRecipients...), extraEmails...) {
+		email = strings.TrimSpace(email)
+		if email == "" || seen[email] {
+			continue
+		}
+		seen[email] = true
+		deliveries = append(deliveries, &model.NotificationDelivery{
+			Target:  email,
+			Format:  operation_setting.AlertFormatEmail,
+			Payload: string(emailPayload),
+		})
+	}
+	created := make([]*model.NotificationDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		delivery.Event = alert.Event
+		delivery.Title = alert.Title
+		if runes := []rune(delivery.Title); len(runes) > 255 {
+			delivery.Title = string(runes[:255])
+		}
+		delivery.Status = model.NotificationDeliveryPending
+		if err := model.CreateNotificationDelivery(delivery); err != nil {
+			common.SysError("failed to record notification delivery: " + err.Error())
+			continue
+		}
+		created = append(created, delivery)
+		attempt := *delivery
+		gopool.Go(func() {
+			_ = AttemptNotificationDelivery(&attempt)
+		})
+	}
+	return created
+}
+
+func buildAlertPayload(webhook *operation_setting.AlertWebhook, alert Alert) (string, error) {
+	var payload any
+	switch webhook.Format {
+	case operation_setting.AlertFormatGeneric, "":
+		payload = alert
+	case operation_setting.AlertFormatSlack:
+		payload = map[string]any{"text": fmt.Sprintf("*%s*\n%s", alert.Title, alert.Content)}
+	case operation_setting.AlertFormatDiscord:
+		payload = map[string]any{"content": fmt.Sprintf("**%s**\n%s", alert.Title, alert.Content)}
+	case operation_setting.AlertFormatTelegram:
+		payload = map[string]any{"chat_id": webhook.TelegramChatId, "text": alert.Title + "\n" + alert.Content}
+	default:
+		return "", fmt.Errorf("unknown alert webhook format %s", webhook.Format)
+	}
+	data, err := common.Marshal(payload)
+	return string(data), err
+}
+
+// AttemptNotificationDelivery sends the delivery once and records the outcome, scheduling a retry on failure.
+func AttemptNotificationDelivery(delivery *model.NotificationDelivery) error {
+	err := sendNotificationDelivery(delivery)
+	delivery.Attempts++
+	if err == nil {
+		delivery.Status = model.NotificationDeliverySuccess
+		delivery.LastError = ""
+		delivery.NextRetryAt = 0
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= max(operation_setting.GetAlertSetting().MaxAttempts, 1) {
+			delivery.Status = model.NotificationDeliveryFailed
+			delivery.NextRetryAt = 0
+		} else {
+			delivery.Status = model.NotificationDeliveryRetrying
+			delivery.NextRetryAt = time.Now().Add(alertRetryDelay(delivery.Attempts)).Unix()
+		}
+	}
+	if saveErr := model.SaveNotificationDelivery(delivery); saveErr != nil {
+		common.SysError("failed to save notification delivery: " + saveErr.Error())
+	}
+	return err
+}
+
+// alertRetryDelay doubles the delay after every failed attempt.
+func alertRetryDelay(attempts int) time.Duration {
+	delay := alertRetryBaseDelay
+	for i := 1; i < attempts && delay < alertRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, alertRetryMaxDelay)
+}
+
+func sendNotificationDelivery(delivery *model.NotificationDelivery) error {
+	if delivery.Format == operation_setting.AlertFormatEmail {
+		var alert Alert
+		if err := common.UnmarshalJsonStr(delivery.Payload, &alert); err != nil {
+			return err
+		}
+		return common.SendEmail(alert.Title, delivery.Target, strings.ReplaceAll(alert.Content, "\n", "<br/>"))
+	}
+	webhook := operation_setting.GetAlertSetting().GetWebhook(delivery.Target)
+	if webhook == nil {
+		return fmt.Errorf("webhook %s no longer exists", delivery.Target)
+	}
+	_, err := sendAlertWebhook(webhook, []byte(delivery.Payload))
+	return err
+}
+
+// sendAlertWebhook posts the payload to the webhook, only generic webhooks are signed.
+func sendAlertWebhook(webhook *operation_setting.AlertWebhook, payload []byte) (*webhookResult, error) {
+	switch webhook.Format {
+	case operation_setting.AlertFormatTelegram:
+		if webhook.TelegramBotToken == "" {
+			return nil, errors.New("telegram bot token is empty")
+		}
+		url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", webhook.TelegramBotToken)
+		result, err := sendWebhookRequest(url, "", payload)
+		if err != nil {
+			// 错误信息可能包含请求地址，避免 bot token 写入投递记录
+			return result, errors.New(strings.ReplaceAll(err.Error(), webhook.TelegramBotToken, "***"))
+		}
+		return result, nil
+	case operation_setting.AlertFormatGeneric, "":
+		return sendWebhookRequest(webhook.URL, webhook.Secret, payload)
+	default:
+		return sendWebhookRequest(webhook.URL, "", payload)
+	}
+}
+
+var alertDeliveryOnce sync.Once
+
+// StartAlertDeliveryTask retries the failed alert deliveries on the master node.
+func StartAlertDeliveryTask() {
+	alertDeliveryOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				time.Sleep(30 * time.Second)
+				deliveries, err := model.GetDueNotificationDeliveries(time.Now().Unix(), 100)
+				if err != nil {
+					common.SysError("failed to load notification deliveries: " + err.Error())
+					continue
+				}
+				for _, delivery := range deliveries {
+					_ = AttemptNotificationDelivery(delivery)
+				}
+			}
+		})
+	})
+}
+
+// checkQuotaAlerts fires the threshold alerts of the user and token of the request after it consumed quota.
+func checkQuotaAlerts(relayInfo *relaycommon.RelayInfo) {
+	setting := operation_setting.GetAlertSetting()
+	if !setting.Enabled || len(setting.Thresholds) == 0 {
+		return
+	}
+	userId := relayInfo.UserId
+	tokenId := relayInfo.TokenId
+	checkUser := relayInfo.BillingSource != BillingSourceSubscription
+	checkToken := setting.TokenAlerts && tokenId != 0 && !relayInfo.TokenUnlimited && !relayInfo.IsPlayground
+	gopool.Go(func() {
+		if checkUser {
+			checkUserQuotaAlert(userId)
+		}
+		if checkToken {
+			checkTokenQuotaAlert(tokenId)
+		}
+	})
+}
+
+func checkUserQuotaAlert(userId int) {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return
+	}
+	percent := quotaUsedPercent(user.UsedQuota, user.Quota)
+	level, fire := raiseAlertLevel(fmt.Sprintf("user:%d", userId), percent)
+	if !fire {
+		return
+	}
+	var extra []string
+	if operation_setting.GetAlertSetting().NotifyUsers && user.Email != "" {
+		extra = append(extra, user.Email)
+	}
+	FireAlert(Alert{
+		Event: operation_setting.AlertEventQuotaThreshold,
+		Title: fmt.Sprintf("用户 %s 已用额度达到 %d%%", user.Username, level),
+		Content: fmt.Sprintf("用户 %s（#%d）已用额度 %s，剩余额度 %s，已用占比 %.1f%%，超过 %d%% 阈值",
+			user.Username, user.Id, logger.FormatQuota(user.UsedQuota), logger.FormatQuota(user.Quota), percent, level),
+		Fields: map[string]any{
+			"subject":    "user",
+			"user_id":    user.Id,
+			"username":   user.Username,
+			"threshold":  level,
+			"percent":    percent,
+			"used_quota": user.UsedQuota,
+			"quota":      user.Quota,
+		},
+	}, extra...)
+}
+
+func checkTokenQuotaAlert(tokenId int) {
+	token, err := model.GetTokenById(tokenId)
+	if err != nil || token.UnlimitedQuota {
+		return
+	}
+	percent := quotaUsedPercent(token.UsedQuota, token.RemainQuota)
+	level, fire := raiseAlertLevel(fmt.Sprintf("token:%d", tokenId), percent)
+	if !fire {
+		return
+	}
+	var extra []string
+	if operation_setting.GetAlertSetting().NotifyUsers {
+		if email, err := model.GetUserEmail(token.UserId); err == nil && email != "" {
+			extra = append(extra, email)
+		}
+	}
+	FireAlert(Alert{
+		Event: operation_setting.AlertEventQuotaThreshold,
+		Title: fmt.Sprintf("令牌 %s 已用额度达到 %d%%", token.Name, level),
+		Content: fmt.Sprintf("用户 #%d 的令牌 %s（#%d）已用额度 %s，剩余额度 %s，已用占比 %.1f%%，超过 %d%% 阈值",
+			token.UserId, token.Name, token.Id, logger.FormatQuota(token.UsedQuota), logger.FormatQuota(token.RemainQuota), percent, level),
+		Fields: map[string]any{
+			"subject":      "token",
+			"token_id":     token.Id,
+			"token_name":   token.Name,
+			"user_id":      token.UserId,
+			"threshold":    level,
+			"percent":      percent,
+			"used_quota":   token.UsedQuota,
+			"remain_quota": token.RemainQuota,
+		},
+	}, extra...)
+}
+
+// quotaUsedPercent 已用额度占已用与剩余之和的百分比，充值后占比下降
+func quotaUsedPercent(used int, remaining int) float64 {
+	remaining = max(remaining, 0)
+	if used <= 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(used+remaining)
+}
+
+// raiseAlertLevel returns the threshold the subject reached and whether it was crossed just now.
+func raiseAlertLevel(subject string, percent float64) (int, bool) {
+	level := operation_setting.GetAlertSetting().AlertLevel(percent)
+	if cached, ok := alertLevels.Load(subject); ok && cached.(int) == level {
+		return level, false
+	}
+	fire, err := model.RaiseAlertLevel(subject, level)
+	if err != nil {
+		common.SysError("failed to record alert level: " + err.Error())
+		return level, false
+	}
+	alertLevels.Store(subject, level)
+	return level, fire
+}
+
+// fireChannelDisabledAlert sends the alert of a channel disabled automatically.
+func fireChannelDisabledAlert(channelId int, channelName string, reason string) {
+	if !operation_setting.GetAlertSetting().Enabled {
+		return
+	}
+	FireAlert(Alert{
+		Event:   operation_setting.AlertEventChannelDisabled,
+		Title:   fmt.Sprintf("渠道「%s」（#%d）已被自动禁用", channelName, channelId),
+		Content: fmt.Sprintf("渠道「%s」（#%d）已被自动禁用，原因：%s", channelName, channelId, reason),
+		Fields: map[string]any{
+			"channel_id":   channelId,
+			"channel_name": channelName,
+			"reason":       reason,
+		},
+	})
+}
+
+// FireTestAlert sends a test alert to every configured receiver, or only to the named webhook.
+func FireTestAlert(webhookName string) ([]*model.NotificationDelivery, error) {
+	setting := operation_setting.GetAlertSetting()
+	alert := Alert{
+		Event:     operation_setting.AlertEventTest,
+		Title:     "告警测试",
+		Content:   "这是一条测试告警，收到说明告警通知配置正确。",
+		Timestamp: time.Now().Unix(),
+	}
+	if webhookName == "" {
+		deliveries := FireAlert(alert)
+		if len(deliveries) == 0 {
+			return nil, errors.New("未配置任何告警接收端")
+		}
+		return deliveries, nil
+	}
+	webhook := setting.GetWebhook(webhookName)
+	if webhook == nil {
+		return nil, fmt.Errorf("webhook %s 不存在", webhookName)
+	}
+	payload, err := buildAlertPayload(webhook, alert)
+	if err != nil {
+		return nil, err
+	}
+	delivery := &model.NotificationDelivery{
+		Event:   alert.Event,
+		Title:   alert.Title,
+		Target:  webhook.Name,
+		Format:  webhook.Format,
+		Payload: payload,
+		Status:  model.NotificationDeliveryPending,
+	}
+	if err = model.CreateNotificationDelivery(delivery); err != nil {
+		return nil, err
+	}
+	// 测试单个 webhook 时同步发送，直接返回结果
+	_ = AttemptNotificationDelivery(delivery)
+	return []*model.NotificationDelivery{delivery}, nil
+}
@@ -3,9 +3,39 @@ package service
 import (
 	"encoding/base64"
 	"fmt"
+	"math"
+	"path/filepath"
 	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/gin-gonic/gin"
 )
 
+// AudioRequestSeconds returns the duration of the audio files uploaded to the transcription and translation
+// endpoints, each file is rounded up to a whole second.
+func AudioRequestSeconds(c *gin.Context) (float64, error) {
+	multiForm, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing multipart form: %v", err)
+	}
+	var seconds float64
+	for _, fileHeader := range multiForm.File["file"] {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return 0, fmt.Errorf("error opening audio file: %v", err)
+		}
+		duration, err := common.GetAudioDuration(c.Request.Context(), file, filepath.Ext(fileHeader.Filename))
+		file.Close()
+		if err != nil {
+			return 0, fmt.Errorf("error getting audio duration: %v", err)
+		}
+		seconds += math.Ceil(duration)
+	}
+	return seconds, nil
+}
+
 func parseAudio(audioBase64 string, format string) (duration float64, err error) {
 	audioData, err := base64.StdEncoding.DecodeString(audioBase64)
 	if err != nil {
@@ -31,6 +61,18 @@ func parseAudio(audioBase64 string, format string) (duration float64, err error)
 	return duration, nil
 }
 
+// RealtimeInputAudioSeconds returns the duration of the audio appended to the input buffer by a realtime event, 0 for other events.
+func RealtimeInputAudioSeconds(event dto.RealtimeEvent, format string) float64 {
+	if event.Type != dto.RealtimeEventInputAudioBufferAppend || event.Audio == "" {
+		return 0
+	}
+	duration, err := parseAudio(event.Audio, format)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
 func DecodeBase64AudioData(audioBase64 string) (string, error) {
 	// 检查并移除 data:audio/xxx;base64, 前缀
 	idx := strings.Index(audioBase64, ",")
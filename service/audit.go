@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 管理员审计日志
+//
+// 渠道、设置和用户等修改操作由接口在成功后调用 RecordAudit，记录目标修改前后的状态；
+// 其余经过管理员鉴权的修改请求由中间件在请求结束后调用 RecordAuditRequest，只记录请求本身。
+
+const (
+	AuditTargetChannel = "channel"
+	AuditTargetOption  = "option"
+	AuditTargetToken   = "token"
+	AuditTargetUser    = "user"
+)
+
+const auditRedacted = "***"
+
+// auditSensitiveSuffixes 以这些后缀结尾的字段不记录原值
+var auditSensitiveSuffixes = []string{"key", "secret", "password", "token"}
+
+// RecordAudit records an admin action with the state of its target before and after the change, before is nil
+// for creations and after is nil for deletions. Updates keep only the fields that changed.
+func RecordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	entry := newAuditEntry(c)
+	entry.Action = action
+	entry.TargetType = targetType
+	entry.TargetId = fmt.Sprint(targetId)
+	beforeState, afterState := auditState(before), auditState(after)
+	if beforeState != nil && afterState != nil {
+		beforeState, afterState = auditDiff(beforeState, afterState)
+	}
+	// 先比较原值再脱敏，敏感字段被修改时也能看出变化
+	redactAuditState(beforeState)
+	redactAuditState(afterState)
+	if beforeState != nil {
+		data, _ := common.Marshal(beforeState)
+		entry.Before = string(data)
+	}
+	if afterState != nil {
+		data, _ := common.Marshal(afterState)
+		entry.After = string(data)
+	}
+	common.SetContextKey(c, constant.ContextKeyAuditRecorded, true)
+	gopool.Go(func() {
+		model.RecordAuditLog(entry)
+	})
+}
+
+// RecordSystemAudit records a change made by a background task rather than an admin request.
+func RecordSystemAudit(action string, targetType string, targetId any, before any, after any) {
+	entry := &model.AuditLog{
+		ActorName:  "system",
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+	}
+	if state := auditState(before); state != nil {
+		data, _ := common.Marshal(state)
+		entry.Before = string(data)
+	}
+	if state := auditState(after); state != nil {
+		data, _ := common.Marshal(state)
+		entry.After = string(data)
+	}
+	gopool.Go(func() {
+		model.RecordAuditLog(entry)
+	})
+}
+
+// RecordAuditRequest records a mutating admin request that did not record an audit log of its own.
+func RecordAuditRequest(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+	if common.GetContextKeyBool(c, constant.ContextKeyAuditRecorded) {
+		return
+	}
+	entry := newAuditEntry(c)
+	entry.Action = "request"
+	entry.TargetId = c.Param("id")
+	common.SetContextKey(c, constant.ContextKeyAuditRecorded, true)
+	gopool.Go(func() {
+		model.RecordAuditLog(entry)
+	})
+}
+
+func newAuditEntry(c *gin.Context) *model.AuditLog {
+	return &model.AuditLog{
+		ActorId:   c.GetInt("id"),
+		ActorName: c.GetString("username"),
+		Ip:        c.ClientIP(),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    c.Writer.Status(),
+	}
+}
+
+// auditState converts the target to a map of its JSON fields.
+func auditState(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	data, err := common.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	state := make(map[string]any)
+	if err = common.Unmarshal(data, &state); err != nil {
+		var value any
+		_ = common.Unmarshal(data, &value)
+		state = map[string]any{"value": value}
+	}
+	return state
+}
+
+func redactAuditState(state map[string]any) {
+	for name, value := range state {
+		if value != nil && value != "" && isAuditSensitive(name) {
+			state[name] = auditRedacted
+		}
+	}
+}
+
+func isAuditSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range auditSensitiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditDiff keeps the fields whose values differ between before and after.
+func auditDiff(before map[string]any, after map[string]any) (map[string]any, map[string]any) {
+	changedBefore := make(map[string]any)
+	changedAfter := make(map[string]any)
+	for name, value := range before {
+		if other, ok := after[name]; !ok || !jsonValuesEqual(value, other) {
+			changedBefore[name] = value
+			if ok {
+				changedAfter[name] = other
+			}
+		}
+	}
+	for name, value := range after {
+		if _, ok := before[name]; !ok {
+			changedAfter[name] = value
+		}
+	}
+	return changedBefore, changedAfter
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
@@ -18,14 +19,44 @@ const (
 	BillingSourceSubscription = "subscription"
 )
 
-// PreConsumeBilling decides whether to pre-consume from subscription or wallet based on user preference.
+// HeaderBillingSource 请求级别指定扣费来源，可以是完整的扣费策略，也可以简写为 subscription 或 wallet（只使用该来源）
+const HeaderBillingSource = "X-Billing-Source"
+
+// resolveBillingPreference picks the billing preference of the request: the request header first, then the token,
+// then the user setting. It also returns where the preference comes from for log attribution.
+func resolveBillingPreference(c *gin.Context, relayInfo *relaycommon.RelayInfo) (string, string, error) {
+	if header := strings.ToLower(strings.TrimSpace(c.GetHeader(HeaderBillingSource))); header != "" {
+		switch header {
+		case BillingSourceSubscription:
+			return "subscription_only", "header", nil
+		case BillingSourceWallet:
+			return "wallet_only", "header", nil
+		}
+		if !common.IsValidBillingPreference(header) {
+			return "", "", fmt.Errorf("invalid %s: %s, expect subscription, wallet, subscription_first, wallet_first, subscription_only or wallet_only", HeaderBillingSource, header)
+		}
+		return header, "header", nil
+	}
+	if pref := common.GetContextKeyString(c, constant.ContextKeyTokenBillingPreference); pref != "" {
+		return common.NormalizeBillingPreference(pref), "token", nil
+	}
+	return common.NormalizeBillingPreference(relayInfo.UserSetting.BillingPreference), "user", nil
+}
+
+// PreConsumeBilling decides whether to pre-consume from subscription or wallet based on the billing preference
+// of the request, see resolveBillingPreference.
 // It also always pre-consumes token quota in quota units (same as legacy flow).
 func PreConsumeBilling(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
 	if relayInfo == nil {
 		return types.NewError(fmt.Errorf("relayInfo is nil"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
-	pref := common.NormalizeBillingPreference(relayInfo.UserSetting.BillingPreference)
+	pref, prefSource, err := resolveBillingPreference(c, relayInfo)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+	relayInfo.BillingPreference = pref
+	relayInfo.BillingPreferenceSource = prefSource
 	trySubscription := func() *types.NewAPIError {
 		quotaType := 0
 		// For total quota: consume preConsumedQuota quota units.
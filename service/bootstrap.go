@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// BootstrapSeed 首次启动时用于初始化实例的种子配置，从 BOOTSTRAP_FILE 指定的 JSON 文件读取。
+// 文件中的 ${VAR} 会替换为环境变量，渠道密钥等敏感信息可以只放在环境变量中。
+// 分组和价格合并到默认配置上，Options 按选项键直接写入，与系统设置中保存选项相同。
+type BootstrapSeed struct {
+	Root        BootstrapRoot             `json:"root"`
+	SelfUseMode bool                      `json:"self_use_mode"`
+	Groups      map[string]BootstrapGroup `json:"groups"`
+	Prices      BootstrapPrices           `json:"prices"`
+	Channels    []model.Channel           `json:"channels"`
+	Options     map[string]string         `json:"options"`
+}
+
+type BootstrapRoot struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// AccessToken 管理 API 使用的系统访问令牌，便于部署脚本继续调用管理接口
+	AccessToken string `json:"access_token"`
+	Quota       int    `json:"quota"`
+}
+
+type BootstrapGroup struct {
+	Ratio float64 `json:"ratio"`
+	// Description 不为空时用户可以选择该分组
+	Description string `json:"description"`
+}
+
+type BootstrapPrices struct {
+	ModelRatio      map[string]float64 `json:"model_ratio"`
+	CompletionRatio map[string]float64 `json:"completion_ratio"`
+	ModelPrice      map[string]float64 `json:"model_price"`
+}
+
+// loadBootstrapSeed reads the seed file and lets the BOOTSTRAP_ROOT_* variables override the root account, it
+// returns nil when bootstrap is not configured.
+func loadBootstrapSeed() (*BootstrapSeed, error) {
+	path := os.Getenv("BOOTSTRAP_FILE")
+	username := os.Getenv("BOOTSTRAP_ROOT_USERNAME")
+	password := os.Getenv("BOOTSTRAP_ROOT_PASSWORD")
+	accessToken := os.Getenv("BOOTSTRAP_ROOT_ACCESS_TOKEN")
+	if path == "" && password == "" {
+		return nil, nil
+	}
+	seed := &BootstrapSeed{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bootstrap file: %w", err)
+		}
+		if err = common.UnmarshalJsonStr(os.ExpandEnv(string(data)), seed); err != nil {
+			return nil, fmt.Errorf("failed to parse bootstrap file: %w", err)
+		}
+	}
+	seed.Root.Username = common.GetStringIfEmpty(username, seed.Root.Username)
+	seed.Root.Password = common.GetStringIfEmpty(password, seed.Root.Password)
+	seed.Root.AccessToken = common.GetStringIfEmpty(accessToken, seed.Root.AccessToken)
+	seed.Root.Username = common.GetStringIfEmpty(seed.Root.Username, "root")
+	return seed, nil
+}
+
+func validateBootstrapSeed(seed *BootstrapSeed) error {
+	if len(seed.Root.Username) > 12 {
+		return errors.New("root username must not exceed 12 characters")
+	}
+	if len(seed.Root.Password) < 8 {
+		return errors.New("root password must be at least 8 characters")
+	}
+	if len(seed.Root.AccessToken) > 32 {
+		return errors.New("root access token must not exceed 32 characters")
+	}
+	for name, group := range seed.Groups {
+		if name == "" || group.Ratio < 0 {
+			return fmt.Errorf("invalid group %q", name)
+		}
+	}
+	for i, channel := range seed.Channels {
+		if channel.Name == "" || channel.Key == "" || channel.Models == "" {
+			return fmt.Errorf("channel #%d must have a name, a key and models", i+1)
+		}
+	}
+	return nil
+}
+
+// RunBootstrap seeds a new instance non-interactively: the root account, the default groups and prices, the
+// options and the initial channels, and then marks the setup as completed so the setup wizard is skipped.
+// It only runs on the master node before the instance has been set up, later starts leave the data untouched.
+func RunBootstrap() error {
+	if constant.Setup || !common.IsMasterNode {
+		return nil
+	}
+	seed, err := loadBootstrapSeed()
+	if err != nil || seed == nil {
+		return err
+	}
+	if err = validateBootstrapSeed(seed); err != nil {
+		return fmt.Errorf("invalid bootstrap seed: %w", err)
+	}
+
+	hashedPassword, err := common.Password2Hash(seed.Root.Password)
+	if err != nil {
+		return err
+	}
+	rootUser := model.User{
+		Username:    seed.Root.Username,
+		Password:    hashedPassword,
+		Role:        common.RoleRootUser,
+		Status:      common.UserStatusEnabled,
+		DisplayName: "Root User",
+		Quota:       100000000,
+	}
+	if seed.Root.Quota > 0 {
+		rootUser.Quota = seed.Root.Quota
+	}
+	if seed.Root.AccessToken != "" {
+		rootUser.SetAccessToken(seed.Root.AccessToken)
+	}
+	if err = rootUser.InsertRoot(); err != nil {
+		return fmt.Errorf("failed to create root user: %w", err)
+	}
+
+	options, err := bootstrapOptions(seed)
+	if err != nil {
+		return err
+	}
+	for key, value := range options {
+		if err = model.UpdateOption(key, value); err != nil {
+			return fmt.Errorf("failed to save option %s: %w", key, err)
+		}
+	}
+
+	if len(seed.Channels) > 0 {
+		now := common.GetTimestamp()
+		for i := range seed.Channels {
+			seed.Channels[i].Id = 0
+			seed.Channels[i].CreatedTime = now
+			if seed.Channels[i].Group == "" {
+				seed.Channels[i].Group = "default"
+			}
+			if seed.Channels[i].Status == 0 {
+				seed.Channels[i].Status = common.ChannelStatusEnabled
+			}
+		}
+		if err = model.BatchInsertChannels(seed.Channels); err != nil {
+			return fmt.Errorf("failed to create channels: %w", err)
+		}
+	}
+
+	if err = model.DB.Create(&model.Setup{Version: common.Version, InitializedAt: time.Now().Unix()}).Error; err != nil {
+		return fmt.Errorf("failed to save setup record: %w", err)
+	}
+	constant.Setup = true
+	common.SysLog(fmt.Sprintf("instance bootstrapped: root user %s, %d options, %d channels", rootUser.Username, len(options), len(seed.Channels)))
+	return nil
+}
+
+// bootstrapOptions merges the groups and the prices of the seed into the current settings and returns the options
+// to save, the explicit options of the seed take precedence.
+func bootstrapOptions(seed *BootstrapSeed) (map[string]string, error) {
+	options := map[string]string{
+		"SelfUseModeEnabled": strconv.FormatBool(seed.SelfUseMode),
+	}
+	if len(seed.Groups) > 0 {
+		groupRatio := ratio_setting.GetGroupRatioCopy()
+		usableGroups := setting.GetUserUsableGroupsCopy()
+		for name, group := range seed.Groups {
+			groupRatio[name] = group.Ratio
+			if group.Description != "" {
+				usableGroups[name] = group.Description
+			}
+		}
+		if err := setBootstrapJSONOption(options, "GroupRatio", groupRatio); err != nil {
+			return nil, err
+		}
+		if err := setBootstrapJSONOption(options, "UserUsableGroups", usableGroups); err != nil {
+			return nil, err
+		}
+	}
+	prices := []struct {
+		key     string
+		current map[string]float64
+		seed    map[string]float64
+	}{
+		{"ModelRatio", ratio_setting.GetModelRatioCopy(), seed.Prices.ModelRatio},
+		{"CompletionRatio", ratio_setting.GetCompletionRatioCopy(), seed.Prices.CompletionRatio},
+		{"ModelPrice", ratio_setting.GetModelPriceCopy(), seed.Prices.ModelPrice},
+	}
+	for _, price := range prices {
+		if len(price.seed) == 0 {
+			continue
+		}
+		for name, value := range price.seed {
+			price.current[name] = value
+		}
+		if err := setBootstrapJSONOption(options, price.key, price.current); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range seed.Options {
+		options[key] = value
+	}
+	return options, nil
+}
+
+func setBootstrapJSONOption(options map[string]string, key string, value any) error {
+	data, err := common.Marshal(value)
+	if err != nil {
+		return err
+	}
+	options[key] = string(data)
+	return nil
+}
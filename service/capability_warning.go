@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 上游无法满足请求中的某个参数（例如 logprobs）时，不再静默丢弃：按策略拒绝请求，
+// 或在响应头和非流式响应体的 capability_warnings 字段中说明该参数没有生效。
+
+const CapabilityWarningHeader = "X-New-Api-Capability-Warning"
+
+type CapabilityWarning struct {
+	Capability string `json:"capability"`
+	Message    string `json:"message"`
+}
+
+// logprobsSupported reports whether the channel can return logprobs for the upstream model, the channel's own
+// declaration wins over the capability table. ok is false when it is unknown.
+func logprobsSupported(c *gin.Context, info *relaycommon.RelayInfo) (supported bool, ok bool) {
+	if settings, exists := common.GetContextKeyType[dto.ChannelOtherSettings](c, constant.ContextKeyChannelOtherSetting); exists {
+		if declared, found := settings.Capabilities[ChannelCapabilityLogprobs]; found {
+			return declared, true
+		}
+	}
+	capability, found := model_setting.GetModelCapability(info.UpstreamModelName)
+	if !found || capability.Logprobs == nil {
+		return false, false
+	}
+	return *capability.Logprobs, true
+}
+
+// CheckLogprobsSupport applies the logprobs policy when the request asks for logprobs the upstream can not return,
+// it returns the warning to attach to the response under the warn policy.
+func CheckLogprobsSupport(c *gin.Context, info *relaycommon.RelayInfo, logprobs bool) (*CapabilityWarning, *types.NewAPIError) {
+	if !logprobs {
+		return nil, nil
+	}
+	policy := model_setting.GetModelCapabilitySettings().LogprobsPolicy
+	if policy == model_setting.LogprobsPolicyIgnore {
+		return nil, nil
+	}
+	if supported, ok := logprobsSupported(c, info); !ok || supported {
+		return nil, nil
+	}
+	message := fmt.Sprintf("model %s does not support logprobs, the parameter has no effect", info.OriginModelName)
+	if policy == model_setting.LogprobsPolicyReject {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("model %s does not support logprobs", info.OriginModelName),
+			types.ErrorCodeModelCapabilityExceeded, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	return &CapabilityWarning{Capability: ChannelCapabilityLogprobs, Message: message}, nil
+}
+
+// CapabilityWarningWriter buffers a non-stream response so the warnings can be added to its body.
+type CapabilityWarningWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	warnings []CapabilityWarning
+}
+
+func (w *CapabilityWarningWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *CapabilityWarningWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// StartCapabilityWarnings sets the warning header and starts buffering the response of non-stream requests,
+// it returns nil when there is nothing to buffer.
+func StartCapabilityWarnings(c *gin.Context, info *relaycommon.RelayInfo, warnings ...*CapabilityWarning) *CapabilityWarningWriter {
+	collected := make([]CapabilityWarning, 0, len(warnings))
+	for _, warning := range warnings {
+		if warning == nil {
+			continue
+		}
+		collected = append(collected, *warning)
+		c.Writer.Header().Add(CapabilityWarningHeader, warning.Capability)
+	}
+	if len(collected) == 0 || info.IsStream {
+		return nil
+	}
+	writer := &CapabilityWarningWriter{ResponseWriter: c.Writer, warnings: collected}
+	c.Writer = writer
+	return writer
+}
+
+// Finish restores the original writer and sends the buffered response with the warnings added.
+func (w *CapabilityWarningWriter) Finish(c *gin.Context) {
+	c.Writer = w.ResponseWriter
+	if w.body.Len() == 0 {
+		return
+	}
+	body := w.body.Bytes()
+	if w.Status() == http.StatusOK && gjson.ParseBytes(body).IsObject() {
+		if rewritten, err := sjson.SetBytes(body, "capability_warnings", w.warnings); err == nil {
+			body = rewritten
+		}
+	}
+	if c.Writer.Header().Get("Content-Length") != "" {
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	_, _ = c.Writer.Write(body)
+}
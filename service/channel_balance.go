@@ -0,0 +1,134 @@
+package service
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+var (
+	roundRobinMu sync.Mutex
+	// roundRobinWeights 平滑加权轮询的当前权重，分组:模型 -> 渠道 -> 权重
+	roundRobinWeights = make(map[string]map[int]int)
+)
+
+// getUntriedChannels returns the channels accepted by filter the request has not tried yet,
+// or all of them once every channel has been tried.
+func getUntriedChannels(param *RetryParam, group string, filter model.ChannelFilter) ([]*model.Channel, error) {
+	channels, err := model.GetSatisfiedChannels(group, param.ModelName, filter)
+	if err != nil || len(channels) == 0 {
+		return nil, err
+	}
+	used := getUsedChannelIds(param.Ctx)
+	candidates := make([]*model.Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !used[channel.Id] {
+			candidates = append(candidates, channel)
+		}
+	}
+	if len(candidates) == 0 {
+		return channels, nil
+	}
+	return candidates, nil
+}
+
+// pickLowestScoreChannel returns the candidate with the lowest score, ties are broken randomly.
+func pickLowestScoreChannel(candidates []*model.Channel, score func(channel *model.Channel) float64) *model.Channel {
+	var lowest []*model.Channel
+	var bestScore float64
+	for _, channel := range candidates {
+		s := score(channel)
+		if len(lowest) == 0 || s < bestScore {
+			bestScore = s
+			lowest = []*model.Channel{channel}
+		} else if s == bestScore {
+			lowest = append(lowest, channel)
+		}
+	}
+	return lowest[rand.Intn(len(lowest))]
+}
+
+// getWeightedRoundRobinChannel rotates over the untried channels of the highest priority in proportion to
+// their weights (smooth weighted round-robin), lower priorities are reached as the retries exclude the tried ones.
+// The rotation state is kept per node.
+func getWeightedRoundRobinChannel(param *RetryParam, group string, filter model.ChannelFilter) (*model.Channel, error) {
+	candidates, err := getUntriedChannels(param, group, filter)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	topPriority := candidates[0].GetPriority()
+	for _, channel := range candidates {
+		topPriority = max(topPriority, channel.GetPriority())
+	}
+	tier := make([]*model.Channel, 0, len(candidates))
+	sumWeight := 0
+	for _, channel := range candidates {
+		if channel.GetPriority() == topPriority {
+			tier = append(tier, channel)
+			sumWeight += channel.GetWeight()
+		}
+	}
+	weightOf := func(channel *model.Channel) int {
+		// 权重都为 0 时平均分配
+		if sumWeight == 0 {
+			return 1
+		}
+		return channel.GetWeight()
+	}
+
+	key := group + ":" + param.ModelName
+	roundRobinMu.Lock()
+	defer roundRobinMu.Unlock()
+	current, ok := roundRobinWeights[key]
+	if !ok {
+		current = make(map[int]int)
+		roundRobinWeights[key] = current
+	}
+	total := 0
+	var selected *model.Channel
+	for _, channel := range tier {
+		weight := weightOf(channel)
+		current[channel.Id] += weight
+		total += weight
+		if selected == nil || current[channel.Id] > current[selected.Id] {
+			selected = channel
+		}
+	}
+	current[selected.Id] -= total
+	return selected, nil
+}
+
+// getLeastLatencyChannel returns the untried channel with the lowest recent latency, weighted by its error rate.
+// Channels without statistics in the window are tried first so they get measured.
+func getLeastLatencyChannel(param *RetryParam, group string, filter model.ChannelFilter) (*model.Channel, error) {
+	candidates, err := getUntriedChannels(param, group, filter)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	stats := getChannelWindowStats()
+	return pickLowestScoreChannel(candidates, func(channel *model.Channel) float64 {
+		return channelLatencyScore(stats[channel.Id])
+	}), nil
+}
+
+// channelLatencyScore is the expected latency of a successful request: average latency / success rate.
+func channelLatencyScore(stats *ChannelLoadStats) float64 {
+	if stats == nil || stats.Requests == 0 {
+		return 0
+	}
+	successRate := max(1-stats.ErrorRate(), 0.05)
+	return stats.AvgLatencyMs / successRate
+}
+
+// getLeastInFlightChannel returns the untried channel serving the fewest requests right now.
+func getLeastInFlightChannel(param *RetryParam, group string, filter model.ChannelFilter) (*model.Channel, error) {
+	candidates, err := getUntriedChannels(param, group, filter)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	inFlight := getChannelInFlight()
+	return pickLowestScoreChannel(candidates, func(channel *model.Channel) float64 {
+		return float64(inFlight[channel.Id])
+	}), nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	ChannelCapabilityTools    = "tools"
+	ChannelCapabilityVision   = "vision"
+	ChannelCapabilityJSONMode = "json_mode"
+	ChannelCapabilityLogprobs = "logprobs"
+)
+
+// ErrNoCapableChannel is returned when channels exist for the model but none supports what the request needs.
+var ErrNoCapableChannel = errors.New("no capable channel")
+
+// GetRequiredCapabilities detects the capabilities the request body relies on, the result is cached in the context.
+// Nothing is required when capability routing is disabled.
+func GetRequiredCapabilities(c *gin.Context) []string {
+	if c == nil || !operation_setting.GetRoutingSetting().CapabilityRoutingEnabled {
+		return nil
+	}
+	if v, ok := common.GetContextKeyType[[]string](c, constant.ContextKeyRequiredCapabilities); ok {
+		return v
+	}
+	required := make([]string, 0)
+	if body, err := common.GetRequestBody(c); err == nil && len(body) > 0 && gjson.ValidBytes(body) {
+		required = detectRequiredCapabilities(gjson.ParseBytes(body))
+	}
+	common.SetContextKey(c, constant.ContextKeyRequiredCapabilities, required)
+	return required
+}
+
+// detectRequiredCapabilities covers the OpenAI chat / responses, Claude and Gemini request formats.
+func detectRequiredCapabilities(body gjson.Result) []string {
+	required := make([]string, 0, 4)
+	if len(body.Get("tools").Array()) > 0 || len(body.Get("functions").Array()) > 0 {
+		required = append(required, ChannelCapabilityTools)
+	}
+
+	vision := false
+	isImagePart := func(part gjson.Result) bool {
+		switch part.Get("type").String() {
+		case "image_url", "image", "input_image":
+			return true
+		}
+		for _, key := range []string{"inlineData.mimeType", "inline_data.mime_type", "fileData.mimeType", "file_data.mime_type"} {
+			if strings.HasPrefix(part.Get(key).String(), "image/") {
+				return true
+			}
+		}
+		return false
+	}
+	for _, path := range []string{"messages", "input", "contents"} {
+		body.Get(path).ForEach(func(_, message gjson.Result) bool {
+			parts := message.Get("content")
+			if !parts.IsArray() {
+				parts = message.Get("parts")
+			}
+			parts.ForEach(func(_, part gjson.Result) bool {
+				vision = isImagePart(part)
+				return !vision
+			})
+			return !vision
+		})
+		if vision {
+			required = append(required, ChannelCapabilityVision)
+			break
+		}
+	}
+
+	switch {
+	case body.Get("response_format.type").String() == "json_object",
+		body.Get("response_format.type").String() == "json_schema",
+		body.Get("text.format.type").String() == "json_schema",
+		body.Get("text.format.type").String() == "json_object",
+		body.Get("generationConfig.responseMimeType").String() == "application/json":
+		required = append(required, ChannelCapabilityJSONMode)
+	}
+	if body.Get("logprobs").Bool() {
+		required = append(required, ChannelCapabilityLogprobs)
+	}
+	return required
+}
+
+// ChannelSupportsCapabilities reports whether the channel can serve modelName with all the capabilities.
+// The channel's own declaration wins, then the capability table of the model the channel maps to is used.
+// Unknown capabilities are assumed to be supported.
+func ChannelSupportsCapabilities(channel *model.Channel, modelName string, capabilities []string) bool {
+	if len(capabilities) == 0 {
+		return true
+	}
+	declared := channel.GetOtherSettings().Capabilities
+	upstreamModel := modelName
+	if mapping := channel.GetModelMapping(); mapping != "" && mapping != "{}" {
+		modelMap := make(map[string]string)
+		if err := common.Unmarshal([]byte(mapping), &modelMap); err == nil && modelMap[modelName] != "" {
+			upstreamModel = modelMap[modelName]
+		}
+	}
+	modelCapability, known := model_setting.GetModelCapability(upstreamModel)
+	for _, capability := range capabilities {
+		if supported, ok := declared[capability]; ok {
+			if !supported {
+				return false
+			}
+			continue
+		}
+		if !known {
+			continue
+		}
+		switch capability {
+		case ChannelCapabilityTools:
+			if modelCapability.ToolCall != nil && !*modelCapability.ToolCall {
+				return false
+			}
+		case ChannelCapabilityVision:
+			if !modelCapability.SupportsModality("image") {
+				return false
+			}
+		case ChannelCapabilityJSONMode:
+			if modelCapability.JSONMode != nil && !*modelCapability.JSONMode {
+				return false
+			}
+		case ChannelCapabilityLogprobs:
+			if modelCapability.Logprobs != nil && !*modelCapability.Logprobs {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ChannelSatisfiesCapabilities reports whether the channel supports what the current request needs.
+func ChannelSatisfiesCapabilities(c *gin.Context, channel *model.Channel, modelName string) bool {
+	if channel == nil {
+		return false
+	}
+	return ChannelSupportsCapabilities(channel, modelName, GetRequiredCapabilities(c))
+}
+
+// NewCapabilityError builds a descriptive error explaining which capabilities no channel supports.
+func NewCapabilityError(group string, modelName string, capabilities []string) error {
+	return fmt.Errorf("%w: 分组 %s 下模型 %s 没有支持 [%s] 的渠道", ErrNoCapableChannel, group, modelName, strings.Join(capabilities, ", "))
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrNoCompliantChannel is returned when channels exist for the request but none carries the required compliance tags.
+var ErrNoCompliantChannel = errors.New("no compliant channel")
+
+// GetRequiredComplianceTags merges the compliance tags required by the token and by the group.
+func GetRequiredComplianceTags(c *gin.Context, group string) []string {
+	required := make([]string, 0)
+	if c != nil {
+		if v, ok := common.GetContextKeyType[[]string](c, constant.ContextKeyTokenComplianceTags); ok {
+			required = append(required, v...)
+		}
+	}
+	required = append(required, operation_setting.GetGroupComplianceTags(group)...)
+	if len(required) == 0 {
+		return required
+	}
+	return model.ParseComplianceTags(strings.Join(required, ","))
+}
+
+// ChannelSatisfiesCompliance reports whether the channel may serve the request in the given group.
+func ChannelSatisfiesCompliance(c *gin.Context, channel *model.Channel, group string) bool {
+	if channel == nil {
+		return false
+	}
+	return channel.HasComplianceTags(GetRequiredComplianceTags(c, group))
+}
+
+// NewComplianceError builds a descriptive error explaining which compliance tags could not be met.
+func NewComplianceError(group string, modelName string, required []string) error {
+	return fmt.Errorf("%w: 分组 %s 下模型 %s 没有满足合规要求 [%s] 的渠道", ErrNoCompliantChannel, group, modelName, strings.Join(required, ", "))
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// GetChannelEffectiveCost returns the relative cost of serving modelName through channel in group:
+// model price (or ratio) × channel cost ratio × group ratio. A price or ratio overridden by the
+// channel replaces both the global value and the cost ratio.
+func GetChannelEffectiveCost(channel *model.Channel, modelName string, group string) float64 {
+	otherSettings := channel.GetOtherSettings()
+	groupRatio := ratio_setting.GetGroupRatio(group)
+	if price, ok := otherSettings.GetModelPriceOverride(modelName); ok {
+		return price * groupRatio
+	}
+	if ratio, ok := otherSettings.GetModelRatioOverride(modelName); ok {
+		return ratio * groupRatio
+	}
+	price, _, _ := ratio_setting.GetModelRatioOrPrice(modelName)
+	costRatio := otherSettings.CostRatio
+	if costRatio <= 0 {
+		costRatio = 1
+	}
+	return price * costRatio * groupRatio
+}
+
+// channelCostScore adds the latency penalty to the effective cost, lower is better.
+func channelCostScore(channel *model.Channel, modelName string, group string, latencyPenaltyFactor float64) float64 {
+	score := GetChannelEffectiveCost(channel, modelName, group)
+	if latencyPenaltyFactor > 0 && channel.ResponseTime > 0 {
+		score *= 1 + latencyPenaltyFactor*float64(channel.ResponseTime)/1000
+	}
+	return score
+}
+
+// selectChannelByStrategy picks a channel accepted by filter using the routing strategy of the group.
+func selectChannelByStrategy(param *RetryParam, group string, retry int, filter model.ChannelFilter) (*model.Channel, error) {
+	switch operation_setting.GetRoutingStrategy(group) {
+	case operation_setting.RoutingStrategyCheapestFirst:
+		return getCheapestChannel(param, group, filter)
+	case operation_setting.RoutingStrategyWeightedRoundRobin:
+		return getWeightedRoundRobinChannel(param, group, filter)
+	case operation_setting.RoutingStrategyLeastLatency:
+		return getLeastLatencyChannel(param, group, filter)
+	case operation_setting.RoutingStrategyLeastInFlight:
+		return getLeastInFlightChannel(param, group, filter)
+	}
+	return model.GetRandomSatisfiedChannelWithFilter(group, param.ModelName, retry, filter)
+}
+
+// getCheapestChannel returns the untried channel with the lowest cost score, ties are broken randomly.
+// Once every channel has been tried, the cheapest one is used again.
+func getCheapestChannel(param *RetryParam, group string, filter model.ChannelFilter) (*model.Channel, error) {
+	candidates, err := getUntriedChannels(param, group, filter)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	latencyPenaltyFactor := operation_setting.GetRoutingSetting().LatencyPenaltyFactor
+	return pickLowestScoreChannel(candidates, func(channel *model.Channel) float64 {
+		return channelCostScore(channel, param.ModelName, group, latencyPenaltyFactor)
+	}), nil
+}
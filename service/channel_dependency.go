@@ -0,0 +1,144 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 删除渠道前检查引用了该渠道的配置：默认阻止删除并返回依赖列表，级联删除时从配置中移除对该渠道的引用。
+
+const (
+	ChannelDependencyResponsesPolicy = "chat_completions_to_responses_policy"
+	ChannelDependencyCompletionsChat = "completions_to_chat_policy"
+	ChannelDependencyFaultInjection  = "fault_injection_rule"
+	ChannelDependencyContentFallback = "content_filter_fallback_rule"
+	ChannelDependencyUnfinishedTasks = "unfinished_tasks"
+)
+
+type ChannelDependency struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Detail string `json:"detail"`
+	// Removable 级联删除时是否会移除该引用，不可移除的依赖只用于提示
+	Removable bool `json:"removable"`
+}
+
+// FindChannelDependencies lists the settings and data referencing the channel.
+func FindChannelDependencies(channelId int) ([]ChannelDependency, error) {
+	deps := make([]ChannelDependency, 0)
+	global := model_setting.GetGlobalSettings()
+	if slices.Contains(global.ChatCompletionsToResponsesPolicy.ChannelIDs, channelId) {
+		deps = append(deps, ChannelDependency{
+			Type:      ChannelDependencyResponsesPolicy,
+			Name:      "ChatCompletions→Responses 兼容配置",
+			Detail:    "渠道在 channel_ids 中",
+			Removable: true,
+		})
+	}
+	if slices.Contains(global.CompletionsToChatPolicy.ChannelIDs, channelId) {
+		deps = append(deps, ChannelDependency{
+			Type:      ChannelDependencyCompletionsChat,
+			Name:      "Completions→Chat 转换配置",
+			Detail:    "渠道在 channel_ids 中",
+			Removable: true,
+		})
+	}
+	for i, rule := range operation_setting.GetFaultInjectionSetting().Rules {
+		if rule.ChannelId != channelId {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		deps = append(deps, ChannelDependency{
+			Type:      ChannelDependencyFaultInjection,
+			Name:      name,
+			Detail:    "故障注入规则指定了该渠道，级联删除时删除该规则",
+			Removable: true,
+		})
+	}
+	for _, rule := range operation_setting.GetContentFilterFallbackSetting().Rules {
+		if rule.ChannelId != channelId {
+			continue
+		}
+		deps = append(deps, ChannelDependency{
+			Type:      ChannelDependencyContentFallback,
+			Name:      rule.Model,
+			Detail:    "内容过滤兜底规则指定了该渠道，级联删除时删除该规则",
+			Removable: true,
+		})
+	}
+	count, err := model.CountUnfinishedTasksByChannel(channelId)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		deps = append(deps, ChannelDependency{
+			Type:   ChannelDependencyUnfinishedTasks,
+			Name:   fmt.Sprintf("%d 个未完成的异步任务", count),
+			Detail: "级联删除不会修改任务，删除后任务将无法继续查询进度",
+		})
+	}
+	return deps, nil
+}
+
+// RemoveChannelDependencies removes the references to the channel from the settings and returns the affected dependencies.
+func RemoveChannelDependencies(channelId int) ([]ChannelDependency, error) {
+	deps, err := FindChannelDependencies(channelId)
+	if err != nil {
+		return nil, err
+	}
+	global := model_setting.GetGlobalSettings()
+	for _, dep := range deps {
+		switch dep.Type {
+		case ChannelDependencyResponsesPolicy:
+			policy := global.ChatCompletionsToResponsesPolicy
+			policy.ChannelIDs = removeChannelId(policy.ChannelIDs, channelId)
+			err = saveChannelDependencyOption("global.chat_completions_to_responses_policy", policy)
+		case ChannelDependencyCompletionsChat:
+			policy := global.CompletionsToChatPolicy
+			policy.ChannelIDs = removeChannelId(policy.ChannelIDs, channelId)
+			err = saveChannelDependencyOption("global.completions_to_chat_policy", policy)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if slices.ContainsFunc(deps, func(dep ChannelDependency) bool { return dep.Type == ChannelDependencyFaultInjection }) {
+		rules := slices.DeleteFunc(slices.Clone(operation_setting.GetFaultInjectionSetting().Rules), func(rule operation_setting.FaultInjectionRule) bool {
+			return rule.ChannelId == channelId
+		})
+		if err = saveChannelDependencyOption("fault_injection_setting.rules", rules); err != nil {
+			return nil, err
+		}
+	}
+	if slices.ContainsFunc(deps, func(dep ChannelDependency) bool { return dep.Type == ChannelDependencyContentFallback }) {
+		rules := slices.DeleteFunc(slices.Clone(operation_setting.GetContentFilterFallbackSetting().Rules), func(rule operation_setting.ContentFilterFallbackRule) bool {
+			return rule.ChannelId == channelId
+		})
+		if err = saveChannelDependencyOption("content_filter_fallback_setting.rules", rules); err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
+
+func removeChannelId(ids []int, channelId int) []int {
+	return slices.DeleteFunc(slices.Clone(ids), func(id int) bool {
+		return id == channelId
+	})
+}
+
+func saveChannelDependencyOption(key string, value any) error {
+	data, err := common.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return model.UpdateOption(key, string(data))
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 渠道健康状态：健康检查在 Master 节点运行并写入 ChannelHealth 表，各节点定期从数据库读取不健康的渠道用于选择渠道。
+
+const unhealthyChannelsRefreshInterval = 30 * time.Second
+
+var (
+	unhealthyChannelsLock      sync.RWMutex
+	unhealthyChannels          map[int]bool
+	unhealthyChannelsUpdatedAt time.Time
+	unhealthyChannelsLoading   bool
+)
+
+// ChannelHealthTransition 一次检查后渠道健康状态的变化
+type ChannelHealthTransition int
+
+const (
+	ChannelHealthUnchanged ChannelHealthTransition = iota
+	ChannelHealthBecameUnhealthy
+	ChannelHealthRecovered
+)
+
+// RecordChannelProbe saves the result of a health probe and reports whether the channel crossed the failure
+// or recovery threshold with it.
+func RecordChannelProbe(channelId int, latencyMs int64, probeErr error) (*model.ChannelHealth, ChannelHealthTransition, error) {
+	setting := operation_setting.GetChannelHealthSetting()
+	health, err := model.GetChannelHealth(channelId)
+	if err != nil {
+		return nil, ChannelHealthUnchanged, err
+	}
+	transition := ChannelHealthUnchanged
+	health.TotalChecks++
+	health.LastLatencyMs = latencyMs
+	health.LastCheckedAt = common.GetTimestamp()
+	health.LastSuccess = probeErr == nil
+	if probeErr != nil {
+		health.TotalFailures++
+		health.ConsecutiveFailures++
+		health.ConsecutiveSuccesses = 0
+		health.LastError = probeErr.Error()
+		if !health.Unhealthy && health.ConsecutiveFailures >= setting.GetFailureThreshold() {
+			health.Unhealthy = true
+			transition = ChannelHealthBecameUnhealthy
+		}
+	} else {
+		health.ConsecutiveSuccesses++
+		health.ConsecutiveFailures = 0
+		health.LastError = ""
+		if health.Unhealthy && health.ConsecutiveSuccesses >= setting.GetRecoveryThreshold() {
+			health.Unhealthy = false
+			transition = ChannelHealthRecovered
+		}
+	}
+	if err := model.SaveChannelHealth(health); err != nil {
+		return nil, ChannelHealthUnchanged, err
+	}
+	if transition != ChannelHealthUnchanged {
+		setChannelUnhealthy(channelId, health.Unhealthy)
+	}
+	return health, transition, nil
+}
+
+func setChannelUnhealthy(channelId int, unhealthy bool) {
+	unhealthyChannelsLock.Lock()
+	defer unhealthyChannelsLock.Unlock()
+	if unhealthy {
+		if unhealthyChannels == nil {
+			unhealthyChannels = make(map[int]bool)
+		}
+		unhealthyChannels[channelId] = true
+	} else {
+		delete(unhealthyChannels, channelId)
+	}
+}
+
+// GetUnhealthyChannels returns the channels marked unhealthy by the health checks, routing avoids them while
+// other channels are available. The set is reloaded from the database in the background when it gets stale.
+func GetUnhealthyChannels() map[int]bool {
+	if !operation_setting.GetChannelHealthSetting().AvoidUnhealthy {
+		return nil
+	}
+	unhealthyChannelsLock.Lock()
+	if time.Since(unhealthyChannelsUpdatedAt) > unhealthyChannelsRefreshInterval && !unhealthyChannelsLoading {
+		unhealthyChannelsLoading = true
+		go reloadUnhealthyChannels()
+	}
+	channels := make(map[int]bool, len(unhealthyChannels))
+	for channelId := range unhealthyChannels {
+		channels[channelId] = true
+	}
+	unhealthyChannelsLock.Unlock()
+	return channels
+}
+
+func reloadUnhealthyChannels() {
+	channelIds, err := model.GetUnhealthyChannelIds()
+	unhealthyChannelsLock.Lock()
+	defer unhealthyChannelsLock.Unlock()
+	unhealthyChannelsLoading = false
+	unhealthyChannelsUpdatedAt = time.Now()
+	if err != nil {
+		common.SysError("failed to load unhealthy channels: " + err.Error())
+		return
+	}
+	unhealthyChannels = make(map[int]bool, len(channelIds))
+	for _, channelId := range channelIds {
+		unhealthyChannels[channelId] = true
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"golang.org/x/net/proxy"
+)
+
+// GetChannelHttpClient returns the client used to call the upstream of a channel: the shared client or the proxy
+// client when only a proxy is set, otherwise a client with the proxy, DNS server, TLS certificates and timeouts of
+// the channel. The clients are cached by their settings and dropped together with the proxy clients.
+func GetChannelHttpClient(setting dto.ChannelSettings) (*http.Client, error) {
+	if !setting.HasEgressOptions() {
+		return NewProxyHttpClient(setting.Proxy)
+	}
+	key := channelHttpClientKey(setting)
+	proxyClientLock.Lock()
+	if client, ok := proxyClients[key]; ok {
+		proxyClientLock.Unlock()
+		return client, nil
+	}
+	proxyClientLock.Unlock()
+
+	transport, err := newChannelTransport(setting)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport:     transport,
+		Timeout:       time.Duration(common.RelayTimeout) * time.Second,
+		CheckRedirect: checkRedirect,
+	}
+	proxyClientLock.Lock()
+	proxyClients[key] = client
+	proxyClientLock.Unlock()
+	return client, nil
+}
+
+// ValidateChannelEgress checks the proxy, the DNS server and the certificates of the channel settings.
+func ValidateChannelEgress(setting dto.ChannelSettings) error {
+	if setting.ConnectTimeoutSeconds < 0 || setting.ReadTimeoutSeconds < 0 {
+		return errors.New("超时时间不能为负数")
+	}
+	if setting.Proxy != "" && !setting.HasEgressOptions() {
+		if _, err := parseChannelProxy(setting.Proxy); err != nil {
+			return err
+		}
+		return nil
+	}
+	_, err := newChannelTransport(setting)
+	return err
+}
+
+func channelHttpClientKey(setting dto.ChannelSettings) string {
+	hash := sha256.New()
+	for _, value := range []string{setting.Proxy, setting.DNSServer, setting.TLSCACert, setting.TLSClientCert, setting.TLSClientKey,
+		fmt.Sprint(setting.ConnectTimeoutSeconds), fmt.Sprint(setting.ReadTimeoutSeconds)} {
+		hash.Write([]byte(value))
+		hash.Write([]byte{0})
+	}
+	return "channel:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+func parseChannelProxy(proxyURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	switch parsedURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return parsedURL, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme: %s, must be http, https, socks5 or socks5h", parsedURL.Scheme)
+}
+
+func newChannelTransport(setting dto.ChannelSettings) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(setting.ConnectTimeoutSeconds) * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if setting.DNSServer != "" {
+		dnsServer := setting.DNSServer
+		if _, _, err := net.SplitHostPort(dnsServer); err != nil {
+			dnsServer = net.JoinHostPort(dnsServer, "53")
+		}
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: 5 * time.Second}
+				return d.DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:          common.RelayMaxIdleConns,
+		MaxIdleConnsPerHost:   common.RelayMaxIdleConnsPerHost,
+		ForceAttemptHTTP2:     true,
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Duration(setting.ReadTimeoutSeconds) * time.Second,
+	}
+	if setting.Proxy != "" {
+		proxyURL, err := parseChannelProxy(setting.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL.Scheme == "http" || proxyURL.Scheme == "https" {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		} else {
+			var auth *proxy.Auth
+			if proxyURL.User != nil {
+				auth = &proxy.Auth{User: proxyURL.User.Username()}
+				auth.Password, _ = proxyURL.User.Password()
+			}
+			// 通过 SOCKS5 代理连接时由代理解析域名
+			socksDialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, dialer)
+			if err != nil {
+				return nil, err
+			}
+			contextDialer, ok := socksDialer.(proxy.ContextDialer)
+			if !ok {
+				return nil, errors.New("socks5 dialer does not support context")
+			}
+			transport.Proxy = nil
+			transport.DialContext = contextDialer.DialContext
+		}
+	}
+
+	tlsConfig, err := newChannelTLSConfig(setting)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+func newChannelTLSConfig(setting dto.ChannelSettings) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if common.TLSInsecureSkipVerify {
+		tlsConfig = common.InsecureTLSConfig.Clone()
+	}
+	if setting.TLSCACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(setting.TLSCACert)) {
+			return nil, errors.New("CA 证书格式错误，需要 PEM 格式")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if setting.TLSClientCert != "" || setting.TLSClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(setting.TLSClientCert), []byte(setting.TLSClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("客户端证书或私钥错误: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
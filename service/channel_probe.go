@@ -0,0 +1,247 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/tidwall/gjson"
+)
+
+// ValidateProbeAssertion checks that the assertion can be evaluated, before it is used or saved on a channel.
+func ValidateProbeAssertion(assertion *dto.ChannelProbeAssertion) error {
+	if assertion == nil {
+		return nil
+	}
+	switch assertion.Type {
+	case dto.ProbeAssertionSubstring:
+		if assertion.Value == "" {
+			return errors.New("断言内容不能为空")
+		}
+	case dto.ProbeAssertionRegex:
+		if _, err := regexp.Compile(assertion.Value); err != nil {
+			return fmt.Errorf("无效的正则表达式: %w", err)
+		}
+	case dto.ProbeAssertionJSONSchema:
+		var schema map[string]any
+		if err := common.UnmarshalJsonStr(assertion.Value, &schema); err != nil {
+			return fmt.Errorf("无效的 JSON Schema: %w", err)
+		}
+	default:
+		return fmt.Errorf("未知的断言类型 %s，可选值：substring, regex, json_schema", assertion.Type)
+	}
+	return nil
+}
+
+// ProbeResponseText extracts the text the model replied with from a chat completions or responses body.
+func ProbeResponseText(body []byte) string {
+	if content := gjson.GetBytes(body, "choices.0.message.content"); content.Exists() {
+		return content.String()
+	}
+	if text := gjson.GetBytes(body, "output_text"); text.Exists() {
+		return text.String()
+	}
+	var sb strings.Builder
+	for _, output := range gjson.GetBytes(body, "output").Array() {
+		for _, content := range output.Get("content").Array() {
+			if content.Get("type").String() == "output_text" {
+				sb.WriteString(content.Get("text").String())
+			}
+		}
+	}
+	return sb.String()
+}
+
+// CheckProbeAssertion evaluates the assertion against the reply text, nil means it holds.
+func CheckProbeAssertion(assertion *dto.ChannelProbeAssertion, text string) error {
+	if assertion == nil {
+		return nil
+	}
+	if err := ValidateProbeAssertion(assertion); err != nil {
+		return err
+	}
+	switch assertion.Type {
+	case dto.ProbeAssertionSubstring:
+		if !strings.Contains(text, assertion.Value) {
+			return fmt.Errorf("回复内容不包含 %q", assertion.Value)
+		}
+	case dto.ProbeAssertionRegex:
+		if !regexp.MustCompile(assertion.Value).MatchString(text) {
+			return fmt.Errorf("回复内容不匹配正则 %s", assertion.Value)
+		}
+	case dto.ProbeAssertionJSONSchema:
+		var schema map[string]any
+		_ = common.UnmarshalJsonStr(assertion.Value, &schema)
+		var value any
+		if err := common.UnmarshalJsonStr(stripJSONFence(text), &value); err != nil {
+			return fmt.Errorf("回复内容不是有效的 JSON: %w", err)
+		}
+		if err := validateJSONSchema(schema, value, "$"); err != nil {
+			return fmt.Errorf("回复内容不符合 JSON Schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// stripJSONFence removes the markdown code fence models often wrap JSON replies in.
+func stripJSONFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimPrefix(text, "json")
+	return strings.TrimSpace(strings.TrimSuffix(text, "```"))
+}
+
+// validateJSONSchema supports the subset of JSON Schema useful for probe replies:
+// type, enum, const, required, properties, additionalProperties (false), items, minItems, maxItems,
+// minLength, maxLength, minimum, maximum and pattern.
+func validateJSONSchema(schema map[string]any, value any, path string) error {
+	if t, ok := schema["type"]; ok {
+		types := []string{}
+		switch t := t.(type) {
+		case string:
+			types = append(types, t)
+		case []any:
+			for _, item := range t {
+				if s, ok := item.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		matched := len(types) == 0
+		for _, expected := range types {
+			if jsonSchemaTypeMatches(expected, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: 类型应为 %s", path, strings.Join(types, "|"))
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonValuesEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: 不在枚举值中", path)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !jsonValuesEqual(constant, value) {
+		return fmt.Errorf("%s: 应等于 %v", path, constant)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range schemaStrings(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: 缺少字段 %s", path, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, fieldValue := range v {
+			fieldSchema, ok := properties[name].(map[string]any)
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s: 不允许的字段 %s", path, name)
+				}
+				continue
+			}
+			if err := validateJSONSchema(fieldSchema, fieldValue, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(v)) < minItems {
+			return fmt.Errorf("%s: 至少需要 %v 项", path, minItems)
+		}
+		if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(v)) > maxItems {
+			return fmt.Errorf("%s: 最多允许 %v 项", path, maxItems)
+		}
+		if itemSchema, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateJSONSchema(itemSchema, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+			return fmt.Errorf("%s: 长度至少为 %v", path, minLength)
+		}
+		if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+			return fmt.Errorf("%s: 长度最多为 %v", path, maxLength)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: 无效的 pattern: %w", path, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: 不匹配 %s", path, pattern)
+			}
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && v < minimum {
+			return fmt.Errorf("%s: 不能小于 %v", path, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && v > maximum {
+			return fmt.Errorf("%s: 不能大于 %v", path, maximum)
+		}
+	}
+	return nil
+}
+
+func jsonSchemaTypeMatches(expected string, value any) bool {
+	switch expected {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func jsonValuesEqual(a any, b any) bool {
+	left, err1 := common.Marshal(a)
+	right, err2 := common.Marshal(b)
+	return err1 == nil && err2 == nil && string(left) == string(right)
+}
+
+func schemaStrings(value any) []string {
+	items, _ := value.([]any)
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
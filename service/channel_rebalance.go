@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 计算相对值时加上的平滑量，避免平均值接近 0 时放大微小差异
+const (
+	channelRebalanceErrorRateSmoothing = 0.01
+	channelRebalanceLatencySmoothing   = 0.1
+)
+
+var (
+	channelRebalanceOnce sync.Once
+	channelRebalanceLock sync.Mutex
+)
+
+// StartChannelRebalanceTask periodically rebalances the channel weights on the master node when enabled.
+func StartChannelRebalanceTask() {
+	channelRebalanceOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				setting := operation_setting.GetChannelRebalanceSetting()
+				time.Sleep(time.Duration(max(setting.IntervalMinutes, 5)) * time.Minute)
+				if !setting.Enabled {
+					continue
+				}
+				if _, err := RunChannelRebalance(); err != nil {
+					common.SysError("failed to rebalance channel weights: " + err.Error())
+				}
+			}
+		})
+	})
+}
+
+type channelRebalanceCandidate struct {
+	channel      *model.Channel
+	requestCount int64
+	errorRate    float64
+	avgLatency   float64
+	costRatio    float64
+}
+
+// RunChannelRebalance scores the channels with enough recent requests against their average and moves the
+// weights of the better channels up and of the worse ones down, within the bounds of the setting. The adjustments
+// are recorded and take effect at once, or wait for an admin when manual approval is enabled.
+func RunChannelRebalance() ([]*model.ChannelRebalanceAdjustment, error) {
+	if !channelRebalanceLock.TryLock() {
+		return nil, errors.New("渠道权重调整正在运行中，请稍后再试")
+	}
+	defer channelRebalanceLock.Unlock()
+
+	setting := *operation_setting.GetChannelRebalanceSetting()
+	if err := setting.Validate(); err != nil {
+		return nil, err
+	}
+	if !operation_setting.GetUsageRollupSetting().Enabled {
+		return nil, errors.New("渠道权重调整依赖用量汇总，请先启用用量汇总")
+	}
+	candidates, err := getChannelRebalanceCandidates(&setting)
+	if err != nil {
+		return nil, err
+	}
+	adjustments := computeChannelRebalanceAdjustments(&setting, candidates)
+	if len(adjustments) == 0 {
+		return adjustments, nil
+	}
+	if err = model.SaveChannelRebalanceAdjustments(adjustments, !setting.ManualApproval); err != nil {
+		return nil, err
+	}
+	if !setting.ManualApproval {
+		model.InitChannelCache()
+	}
+	for _, adjustment := range adjustments {
+		common.SysLog(fmt.Sprintf("channel rebalance: channel #%d weight %d -> %d (score %.2f, %s)",
+			adjustment.ChannelId, adjustment.OldWeight, adjustment.NewWeight, adjustment.Score, adjustment.Status))
+	}
+	return adjustments, nil
+}
+
+func getChannelRebalanceCandidates(setting *operation_setting.ChannelRebalanceSetting) ([]*channelRebalanceCandidate, error) {
+	now := time.Now().Unix()
+	rows, err := model.QueryUsageRollups(model.UsageRollupQuery{
+		Granularity: "hour",
+		StartTime:   now - int64(max(setting.WindowHours, 1))*3600,
+		EndTime:     now,
+		GroupBy:     []string{"channel"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	channels, err := model.GetAllChannels(0, 0, true, false)
+	if err != nil {
+		return nil, err
+	}
+	channelsById := make(map[int]*model.Channel, len(channels))
+	for _, channel := range channels {
+		channelsById[channel.Id] = channel
+	}
+	candidates := make([]*channelRebalanceCandidate, 0, len(rows))
+	for _, row := range rows {
+		channel, ok := channelsById[row.ChannelId]
+		if !ok || channel.Status != common.ChannelStatusEnabled || row.RequestCount < max(setting.MinRequests, 1) {
+			continue
+		}
+		if !setting.AppliesToGroups(channel.GetGroups()) {
+			continue
+		}
+		costRatio := channel.GetOtherSettings().CostRatio
+		if costRatio <= 0 {
+			costRatio = 1
+		}
+		candidates = append(candidates, &channelRebalanceCandidate{
+			channel:      channel,
+			requestCount: row.RequestCount,
+			errorRate:    row.ErrorRate,
+			avgLatency:   float64(row.UseTime) / float64(row.RequestCount),
+			costRatio:    costRatio,
+		})
+	}
+	return candidates, nil
+}
+
+// computeChannelRebalanceAdjustments compares each channel with the average of the candidates: the score is the
+// weighted mean of its relative cost, error rate and latency, so 1 is average and lower is better. The target
+// weight is the current weight divided by the score, limited by the step and the bounds of the setting.
+func computeChannelRebalanceAdjustments(setting *operation_setting.ChannelRebalanceSetting, candidates []*channelRebalanceCandidate) []*model.ChannelRebalanceAdjustment {
+	adjustments := make([]*model.ChannelRebalanceAdjustment, 0)
+	// 只有一个渠道时没有可比较的对象
+	if len(candidates) < 2 {
+		return adjustments
+	}
+	var totalCost, totalErrorRate, totalLatency float64
+	for _, candidate := range candidates {
+		totalCost += candidate.costRatio
+		totalErrorRate += candidate.errorRate
+		totalLatency += candidate.avgLatency
+	}
+	n := float64(len(candidates))
+	avgCost, avgErrorRate, avgLatency := totalCost/n, totalErrorRate/n, totalLatency/n
+	totalFactor := setting.CostFactor + setting.ErrorFactor + setting.LatencyFactor
+
+	for _, candidate := range candidates {
+		score := (setting.CostFactor*candidate.costRatio/avgCost +
+			setting.ErrorFactor*(candidate.errorRate+channelRebalanceErrorRateSmoothing)/(avgErrorRate+channelRebalanceErrorRateSmoothing) +
+			setting.LatencyFactor*(candidate.avgLatency+channelRebalanceLatencySmoothing)/(avgLatency+channelRebalanceLatencySmoothing)) / totalFactor
+		current := candidate.channel.GetWeight()
+		base := current
+		// 权重为 0 的渠道从权重范围的中间值开始调整
+		if base <= 0 {
+			base = (setting.MinWeight + setting.MaxWeight) / 2
+		}
+		target := setting.ClampWeight(current, int(math.Round(float64(base)/score)))
+		if target == current {
+			continue
+		}
+		adjustments = append(adjustments, &model.ChannelRebalanceAdjustment{
+			ChannelId:    candidate.channel.Id,
+			ChannelName:  candidate.channel.Name,
+			OldWeight:    current,
+			NewWeight:    target,
+			RequestCount: candidate.requestCount,
+			ErrorRate:    candidate.errorRate,
+			AvgLatency:   candidate.avgLatency,
+			CostRatio:    candidate.costRatio,
+			Score:        score,
+		})
+	}
+	return adjustments
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegionHintHeader lets clients ask for channels in a specific region when client hints are enabled.
+const RegionHintHeader = "New-Api-Region"
+
+// GetPreferredRegion returns the region the router should prefer for this request.
+// The client hint wins over the node region; an empty result means region affinity is off.
+func GetPreferredRegion(c *gin.Context) string {
+	if c == nil {
+		return ""
+	}
+	if v, ok := common.GetContextKey(c, constant.ContextKeyPreferredRegion); ok {
+		if region, ok := v.(string); ok {
+			return region
+		}
+	}
+	region := ""
+	routingSetting := operation_setting.GetRoutingSetting()
+	if routingSetting.RegionAffinityEnabled {
+		region = common.NodeRegion
+		if routingSetting.ClientRegionHintEnabled && c.Request != nil {
+			if hint := strings.TrimSpace(c.Request.Header.Get(RegionHintHeader)); hint != "" {
+				region = hint
+			}
+		}
+	}
+	common.SetContextKey(c, constant.ContextKeyPreferredRegion, region)
+	return region
+}
+
+// getUsedChannelIds returns the channels already tried by this request.
+func getUsedChannelIds(c *gin.Context) map[int]bool {
+	used := make(map[int]bool)
+	if c == nil {
+		return used
+	}
+	for _, idStr := range c.GetStringSlice("use_channel") {
+		if id, err := strconv.Atoi(idStr); err == nil {
+			used[id] = true
+		}
+	}
+	return used
+}
+
+// getRegionAwareChannel prefers untried channels located in the preferred region and
+// only falls back to the regular cross-region selection when none of them is left.
+// Channels missing the compliance tags required by the token or group, or the capabilities the request
+// relies on, are never selected. Channels burning the model's error budget, failing the health checks,
+// with an open circuit breaker or cooling down from an upstream rate limit are only used when nothing else is left.
+func getRegionAwareChannel(param *RetryParam, group string, retry int) (*model.Channel, error) {
+	required := GetRequiredComplianceTags(param.Ctx, group)
+	capabilities := GetRequiredCapabilities(param.Ctx)
+	var complianceFilter model.ChannelFilter
+	if len(required) > 0 || len(capabilities) > 0 {
+		complianceFilter = func(channel *model.Channel) bool {
+			return channel.HasComplianceTags(required) && ChannelSupportsCapabilities(channel, param.ModelName, capabilities)
+		}
+	}
+	avoided := GetBurningChannels(param.ModelName)
+	for _, channels := range []map[int]bool{GetUnhealthyChannels(), GetOpenCircuitChannels(), model.GetCoolingDownChannels()} {
+		for channelId := range channels {
+			if avoided == nil {
+				avoided = make(map[int]bool)
+			}
+			avoided[channelId] = true
+		}
+	}
+	region := GetPreferredRegion(param.Ctx)
+	if region != "" {
+		used := getUsedChannelIds(param.Ctx)
+		channel, err := selectChannelByStrategy(param, group, 0, func(channel *model.Channel) bool {
+			if complianceFilter != nil && !complianceFilter(channel) {
+				return false
+			}
+			return !used[channel.Id] && !avoided[channel.Id] && strings.EqualFold(channel.GetRegion(), region)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if channel != nil {
+			return channel, nil
+		}
+		logger.LogDebug(param.Ctx, "No local channel left in region %s for group %s model %s, falling back to cross-region", region, group, param.ModelName)
+	}
+	if len(avoided) > 0 {
+		channel, err := selectChannelByStrategy(param, group, retry, func(channel *model.Channel) bool {
+			return !avoided[channel.Id] && (complianceFilter == nil || complianceFilter(channel))
+		})
+		if err != nil {
+			return nil, err
+		}
+		if channel != nil {
+			return channel, nil
+		}
+		logger.LogDebug(param.Ctx, "Only channels burning the error budget, failing health checks, with an open circuit or rate limited are left for group %s model %s", group, param.ModelName)
+	}
+	channel, err := selectChannelByStrategy(param, group, retry, complianceFilter)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil && complianceFilter != nil {
+		return nil, unsatisfiedChannelError(param, group, required, capabilities)
+	}
+	return channel, nil
+}
+
+// unsatisfiedChannelError explains why filtering left no channel. It returns nil when the model has no
+// channel in the group at all, so the caller reports it as a regular missing channel.
+func unsatisfiedChannelError(param *RetryParam, group string, required []string, capabilities []string) error {
+	channels, err := model.GetSatisfiedChannels(group, param.ModelName, nil)
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+	if len(capabilities) == 0 {
+		return NewComplianceError(group, param.ModelName, required)
+	}
+	channels, err = model.GetSatisfiedChannels(group, param.ModelName, func(channel *model.Channel) bool {
+		return channel.HasComplianceTags(required)
+	})
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return NewComplianceError(group, param.ModelName, required)
+	}
+	return NewCapabilityError(group, param.ModelName, capabilities)
+}
+
+// AppendRegionInfo records the serving node region and the selected channel region into log info.
+func AppendRegionInfo(ctx *gin.Context, other map[string]interface{}) {
+	if ctx == nil || other == nil {
+		return
+	}
+	channelRegion := common.GetContextKeyString(ctx, constant.ContextKeyChannelRegion)
+	if channelRegion != "" {
+		other["channel_region"] = channelRegion
+	}
+	if common.NodeRegion != "" {
+		other["node_region"] = common.NodeRegion
+	}
+	preferred := common.GetContextKeyString(ctx, constant.ContextKeyPreferredRegion)
+	if preferred != "" {
+		other["preferred_region"] = preferred
+		if !strings.EqualFold(preferred, channelRegion) {
+			other["cross_region"] = true
+		}
+	}
+}
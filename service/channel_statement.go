@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// 渠道对账单：按渠道和模型汇总一段时间内的消耗，对比渠道成本与向用户收取的额度，
+// 供转售场景与上游账单核对。成本按渠道当前的价格覆盖或成本倍率计算，不含分组倍率。
+
+type ChannelStatementItem struct {
+	ChannelId        int     `json:"channel_id"`
+	ChannelName      string  `json:"channel_name"`
+	ModelName        string  `json:"model_name"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	BilledQuota      int64   `json:"billed_quota"` // 向用户收取的额度
+	CostQuota        int64   `json:"cost_quota"`   // 按渠道价格计算的成本额度
+	MarginQuota      int64   `json:"margin_quota"`
+	BilledAmount     float64 `json:"billed_amount"` // 以下金额按 QuotaPerUnit 换算为美元
+	CostAmount       float64 `json:"cost_amount"`
+	MarginAmount     float64 `json:"margin_amount"`
+}
+
+type ChannelStatement struct {
+	StartTimestamp int64                   `json:"start_timestamp"`
+	EndTimestamp   int64                   `json:"end_timestamp"`
+	Items          []*ChannelStatementItem `json:"items"`
+	Total          ChannelStatementItem    `json:"total"`
+}
+
+type statementLogOther struct {
+	GroupRatio      *float64 `json:"group_ratio"`
+	ModelRatio      float64  `json:"model_ratio"`
+	CompletionRatio float64  `json:"completion_ratio"`
+	ModelPrice      float64  `json:"model_price"`
+	PriceSource     string   `json:"price_source"`
+}
+
+// GenerateChannelStatement builds the statement of the period, channelId 0 covers all channels.
+func GenerateChannelStatement(startTimestamp int64, endTimestamp int64, channelId int) (*ChannelStatement, error) {
+	items := make(map[string]*ChannelStatementItem)
+	costRatios := make(map[int]float64)
+	channelNames := make(map[int]string)
+
+	err := model.ForEachChannelConsumeLog(startTimestamp, endTimestamp, channelId, func(logs []*model.Log) error {
+		for _, log := range logs {
+			if _, ok := costRatios[log.ChannelId]; !ok {
+				costRatios[log.ChannelId] = 1
+				if channel, err := model.GetChannelById(log.ChannelId, false); err == nil {
+					channelNames[log.ChannelId] = channel.Name
+					if ratio := channel.GetOtherSettings().CostRatio; ratio > 0 {
+						costRatios[log.ChannelId] = ratio
+					}
+				}
+			}
+			key := fmt.Sprintf("%d:%s", log.ChannelId, log.ModelName)
+			item, ok := items[key]
+			if !ok {
+				item = &ChannelStatementItem{
+					ChannelId:   log.ChannelId,
+					ChannelName: channelNames[log.ChannelId],
+					ModelName:   log.ModelName,
+				}
+				items[key] = item
+			}
+			item.Requests++
+			item.PromptTokens += int64(log.PromptTokens)
+			item.CompletionTokens += int64(log.CompletionTokens)
+			item.BilledQuota += int64(log.Quota)
+			item.CostQuota += statementLogCost(log, costRatios[log.ChannelId])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &ChannelStatement{
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		Items:          make([]*ChannelStatementItem, 0, len(items)),
+	}
+	total := &statement.Total
+	for _, item := range items {
+		fillStatementAmounts(item)
+		statement.Items = append(statement.Items, item)
+		total.Requests += item.Requests
+		total.PromptTokens += item.PromptTokens
+		total.CompletionTokens += item.CompletionTokens
+		total.BilledQuota += item.BilledQuota
+		total.CostQuota += item.CostQuota
+	}
+	fillStatementAmounts(total)
+	sort.Slice(statement.Items, func(i, j int) bool {
+		if statement.Items[i].ChannelId != statement.Items[j].ChannelId {
+			return statement.Items[i].ChannelId < statement.Items[j].ChannelId
+		}
+		return statement.Items[i].ModelName < statement.Items[j].ModelName
+	})
+	return statement, nil
+}
+
+// statementLogCost removes the group ratio from the billed quota and applies the channel cost ratio,
+// a price overridden by the channel already is the channel price. Logs billed with a zero group ratio
+// are recomputed from the recorded model price or ratio.
+func statementLogCost(log *model.Log, costRatio float64) int64 {
+	var other statementLogOther
+	if log.Other != "" {
+		_ = common.UnmarshalJsonStr(log.Other, &other)
+	}
+	if other.PriceSource == types.PriceSourceChannel {
+		costRatio = 1
+	}
+	if other.GroupRatio == nil {
+		return int64(float64(log.Quota) * costRatio)
+	}
+	if *other.GroupRatio > 0 {
+		return int64(float64(log.Quota) / *other.GroupRatio * costRatio)
+	}
+	if other.ModelPrice > 0 {
+		return int64(other.ModelPrice * common.QuotaPerUnit * costRatio)
+	}
+	completionRatio := other.CompletionRatio
+	if completionRatio <= 0 {
+		completionRatio = 1
+	}
+	return int64((float64(log.PromptTokens) + float64(log.CompletionTokens)*completionRatio) * other.ModelRatio * costRatio)
+}
+
+func fillStatementAmounts(item *ChannelStatementItem) {
+	item.MarginQuota = item.BilledQuota - item.CostQuota
+	item.BilledAmount = float64(item.BilledQuota) / common.QuotaPerUnit
+	item.CostAmount = float64(item.CostQuota) / common.QuotaPerUnit
+	item.MarginAmount = float64(item.MarginQuota) / common.QuotaPerUnit
+}
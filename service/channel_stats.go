@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道负载统计：按分钟分桶记录每个渠道的请求数、错误数和延迟，以及正在处理的请求数，供按延迟和按并发选择渠道使用。
+// 开启 Redis 时统计写入 Redis 由所有节点共享，否则只统计当前节点。只有使用这两种策略时才会统计。
+
+const (
+	channelStatsRedisPrefix = "channel_stats:"
+	channelInFlightRedisKey = "channel_stats:in_flight"
+	// 节点异常退出时未结束的请求计数会残留，空闲一段时间后随键过期清除
+	channelInFlightRedisTTL = 10 * time.Minute
+	channelStatsCacheTTL    = 5 * time.Second
+)
+
+type channelWindowCounts struct {
+	requests  int64
+	errors    int64
+	latencyMs int64
+}
+
+var (
+	channelStatsMu       sync.Mutex
+	channelStatsBuckets  = make(map[int64]map[int]*channelWindowCounts) // 分钟 -> 渠道 -> 计数
+	channelInFlight      = make(map[int]int64)
+	channelStatsCache    map[int]*ChannelLoadStats
+	channelStatsCachedAt time.Time
+)
+
+type ChannelLoadStats struct {
+	ChannelId    int     `json:"channel_id"`
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	InFlight     int64   `json:"in_flight"`
+}
+
+func (s *ChannelLoadStats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+// TrackChannelAttempt counts an attempt on the channel as in flight and returns the function recording its
+// outcome when it ends.
+func TrackChannelAttempt(channelId int) func(info *relaycommon.RelayInfo, start time.Time, err *types.NewAPIError) {
+	if channelId == 0 || !operation_setting.GetRoutingSetting().UsesChannelStats() {
+		return func(*relaycommon.RelayInfo, time.Time, *types.NewAPIError) {}
+	}
+	addChannelInFlight(channelId, 1)
+	return func(info *relaycommon.RelayInfo, start time.Time, err *types.NewAPIError) {
+		addChannelInFlight(channelId, -1)
+		counted, failed := sloOutcome(err)
+		if !counted || info == nil {
+			return
+		}
+		recordChannelAttempt(channelId, sloLatency(info, start).Milliseconds(), failed)
+	}
+}
+
+func addChannelInFlight(channelId int, delta int64) {
+	if common.RedisEnabled && common.RDB != nil {
+		ctx := context.Background()
+		pipe := common.RDB.Pipeline()
+		pipe.HIncrBy(ctx, channelInFlightRedisKey, strconv.Itoa(channelId), delta)
+		pipe.Expire(ctx, channelInFlightRedisKey, channelInFlightRedisTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError("failed to update channel in-flight requests: " + err.Error())
+		}
+		return
+	}
+	channelStatsMu.Lock()
+	defer channelStatsMu.Unlock()
+	channelInFlight[channelId] += delta
+	if channelInFlight[channelId] <= 0 {
+		delete(channelInFlight, channelId)
+	}
+}
+
+func recordChannelAttempt(channelId int, latencyMs int64, failed bool) {
+	now := time.Now()
+	minute := now.Unix() / 60
+	window := operation_setting.GetRoutingSetting().StatsWindow()
+	if common.RedisEnabled && common.RDB != nil {
+		ctx := context.Background()
+		key := channelStatsRedisPrefix + strconv.FormatInt(minute, 10)
+		field := strconv.Itoa(channelId)
+		pipe := common.RDB.Pipeline()
+		pipe.HIncrBy(ctx, key, field+":requests", 1)
+		pipe.HIncrBy(ctx, key, field+":latency", latencyMs)
+		if failed {
+			pipe.HIncrBy(ctx, key, field+":errors", 1)
+		}
+		pipe.Expire(ctx, key, window+time.Minute)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError("failed to record channel stats: " + err.Error())
+		}
+		return
+	}
+	channelStatsMu.Lock()
+	defer channelStatsMu.Unlock()
+	bucket, ok := channelStatsBuckets[minute]
+	if !ok {
+		bucket = make(map[int]*channelWindowCounts)
+		channelStatsBuckets[minute] = bucket
+		cutoff := now.Add(-window).Unix() / 60
+		for m := range channelStatsBuckets {
+			if m <= cutoff {
+				delete(channelStatsBuckets, m)
+			}
+		}
+	}
+	counts, ok := bucket[channelId]
+	if !ok {
+		counts = &channelWindowCounts{}
+		bucket[channelId] = counts
+	}
+	counts.requests++
+	counts.latencyMs += latencyMs
+	if failed {
+		counts.errors++
+	}
+}
+
+// getChannelWindowStats returns the request, error and latency statistics of the channels in the window,
+// cached for a few seconds.
+func getChannelWindowStats() map[int]*ChannelLoadStats {
+	channelStatsMu.Lock()
+	if channelStatsCache != nil && time.Since(channelStatsCachedAt) < channelStatsCacheTTL {
+		cached := channelStatsCache
+		channelStatsMu.Unlock()
+		return cached
+	}
+	channelStatsMu.Unlock()
+
+	now := time.Now()
+	window := operation_setting.GetRoutingSetting().StatsWindow()
+	cutoff := now.Add(-window).Unix() / 60
+	totals := make(map[int]*channelWindowCounts)
+	add := func(channelId int) *channelWindowCounts {
+		counts, ok := totals[channelId]
+		if !ok {
+			counts = &channelWindowCounts{}
+			totals[channelId] = counts
+		}
+		return counts
+	}
+	if common.RedisEnabled && common.RDB != nil {
+		ctx := context.Background()
+		pipe := common.RDB.Pipeline()
+		var cmds []*redis.StringStringMapCmd
+		for m := cutoff + 1; m <= now.Unix()/60; m++ {
+			cmds = append(cmds, pipe.HGetAll(ctx, channelStatsRedisPrefix+strconv.FormatInt(m, 10)))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			common.SysError("failed to load channel stats: " + err.Error())
+		}
+		for _, cmd := range cmds {
+			values, err := cmd.Result()
+			if err != nil {
+				continue
+			}
+			for field, value := range values {
+				idStr, name, ok := strings.Cut(field, ":")
+				if !ok {
+					continue
+				}
+				channelId, err := strconv.Atoi(idStr)
+				if err != nil {
+					continue
+				}
+				n, _ := strconv.ParseInt(value, 10, 64)
+				counts := add(channelId)
+				switch name {
+				case "requests":
+					counts.requests += n
+				case "errors":
+					counts.errors += n
+				case "latency":
+					counts.latencyMs += n
+				}
+			}
+		}
+	} else {
+		channelStatsMu.Lock()
+		for m, bucket := range channelStatsBuckets {
+			if m <= cutoff {
+				continue
+			}
+			for channelId, bucketCounts := range bucket {
+				counts := add(channelId)
+				counts.requests += bucketCounts.requests
+				counts.errors += bucketCounts.errors
+				counts.latencyMs += bucketCounts.latencyMs
+			}
+		}
+		channelStatsMu.Unlock()
+	}
+
+	stats := make(map[int]*ChannelLoadStats, len(totals))
+	for channelId, counts := range totals {
+		s := &ChannelLoadStats{ChannelId: channelId, Requests: counts.requests, Errors: counts.errors}
+		if counts.requests > 0 {
+			s.AvgLatencyMs = float64(counts.latencyMs) / float64(counts.requests)
+		}
+		stats[channelId] = s
+	}
+	channelStatsMu.Lock()
+	channelStatsCache = stats
+	channelStatsCachedAt = now
+	channelStatsMu.Unlock()
+	return stats
+}
+
+// getChannelInFlight returns the number of requests each channel is serving right now.
+func getChannelInFlight() map[int]int64 {
+	inFlight := make(map[int]int64)
+	if common.RedisEnabled && common.RDB != nil {
+		values, err := common.RDB.HGetAll(context.Background(), channelInFlightRedisKey).Result()
+		if err != nil {
+			common.SysError("failed to load channel in-flight requests: " + err.Error())
+			return inFlight
+		}
+		for field, value := range values {
+			channelId, err := strconv.Atoi(field)
+			if err != nil {
+				continue
+			}
+			if n, _ := strconv.ParseInt(value, 10, 64); n > 0 {
+				inFlight[channelId] = n
+			}
+		}
+		return inFlight
+	}
+	channelStatsMu.Lock()
+	defer channelStatsMu.Unlock()
+	for channelId, n := range channelInFlight {
+		inFlight[channelId] = n
+	}
+	return inFlight
+}
+
+// GetChannelLoadStats returns the window statistics and in-flight requests of every channel seen, by channel id.
+func GetChannelLoadStats() []*ChannelLoadStats {
+	windowStats := getChannelWindowStats()
+	inFlight := getChannelInFlight()
+	merged := make(map[int]*ChannelLoadStats, len(windowStats))
+	for channelId, s := range windowStats {
+		item := *s
+		merged[channelId] = &item
+	}
+	for channelId, n := range inFlight {
+		if _, ok := merged[channelId]; !ok {
+			merged[channelId] = &ChannelLoadStats{ChannelId: channelId}
+		}
+		merged[channelId].InFlight = n
+	}
+	stats := make([]*ChannelLoadStats, 0, len(merged))
+	for _, s := range merged {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ChannelId < stats[j].ChannelId
+	})
+	return stats
+}
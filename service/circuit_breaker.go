@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+// ChannelCircuitBreaker 渠道熔断器的状态，只统计当前节点发往上游的请求
+type ChannelCircuitBreaker struct {
+	State string `json:"state"`
+	// OpenedAt/OpenUntil 最近一次熔断的时间和冷却结束时间，unix 秒
+	OpenedAt  int64 `json:"opened_at,omitempty"`
+	OpenUntil int64 `json:"open_until,omitempty"`
+	Requests  int   `json:"requests"`
+	Failures  int   `json:"failures"`
+
+	windowStart time.Time
+	// 半开状态下已放行和已成功的探测请求数
+	probes        int
+	probeSuccess  int
+	openUntilTime time.Time
+}
+
+var (
+	circuitBreakersLock sync.Mutex
+	circuitBreakers     = make(map[int]*ChannelCircuitBreaker)
+)
+
+// AllowChannelRequest reports whether a request may be sent to the channel, false while its circuit is open.
+// Once the cooldown is over a limited number of probe requests is let through.
+func AllowChannelRequest(channelId int) bool {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	if !setting.Enabled {
+		return true
+	}
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+	breaker, ok := circuitBreakers[channelId]
+	if !ok {
+		return true
+	}
+	switch breaker.State {
+	case CircuitStateOpen:
+		if time.Now().Before(breaker.openUntilTime) {
+			return false
+		}
+		breaker.State = CircuitStateHalfOpen
+		breaker.probes = 0
+		breaker.probeSuccess = 0
+		common.SysLog(fmt.Sprintf("circuit breaker of channel #%d is half-open, probing", channelId))
+		fallthrough
+	case CircuitStateHalfOpen:
+		if breaker.probes >= setting.GetHalfOpenRequests() {
+			return false
+		}
+		breaker.probes++
+	}
+	return true
+}
+
+// RecordChannelResult feeds the outcome of an upstream request to the circuit breaker of the channel.
+// Transport errors, 429 and 5xx responses count as failures.
+func RecordChannelResult(channelId int, statusCode int, err error) {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	if !setting.Enabled || channelId == 0 {
+		return
+	}
+	failed := err != nil || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+	now := time.Now()
+
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+	breaker, ok := circuitBreakers[channelId]
+	if !ok {
+		breaker = &ChannelCircuitBreaker{State: CircuitStateClosed, windowStart: now}
+		circuitBreakers[channelId] = breaker
+	}
+	switch breaker.State {
+	case CircuitStateOpen:
+		// 熔断前已发出的请求，结果不影响状态
+		return
+	case CircuitStateHalfOpen:
+		if failed {
+			openCircuit(channelId, breaker, now, setting)
+			return
+		}
+		breaker.probeSuccess++
+		if breaker.probeSuccess >= setting.GetHalfOpenRequests() {
+			breaker.State = CircuitStateClosed
+			breaker.windowStart = now
+			breaker.Requests = 0
+			breaker.Failures = 0
+			common.SysLog(fmt.Sprintf("circuit breaker of channel #%d is closed", channelId))
+		}
+		return
+	}
+	if now.Sub(breaker.windowStart) > setting.Window() {
+		breaker.windowStart = now
+		breaker.Requests = 0
+		breaker.Failures = 0
+	}
+	breaker.Requests++
+	if failed {
+		breaker.Failures++
+	}
+	if breaker.Requests >= setting.GetMinRequests() &&
+		float64(breaker.Failures)/float64(breaker.Requests) >= setting.GetErrorRateThreshold() {
+		openCircuit(channelId, breaker, now, setting)
+	}
+}
+
+func openCircuit(channelId int, breaker *ChannelCircuitBreaker, now time.Time, setting *operation_setting.CircuitBreakerSetting) {
+	breaker.State = CircuitStateOpen
+	breaker.openUntilTime = now.Add(setting.Cooldown())
+	breaker.OpenedAt = now.Unix()
+	breaker.OpenUntil = breaker.openUntilTime.Unix()
+	common.SysLog(fmt.Sprintf("circuit breaker of channel #%d is open until %s (%d/%d requests failed)",
+		channelId, breaker.openUntilTime.Format(time.RFC3339), breaker.Failures, breaker.Requests))
+}
+
+// NewCircuitOpenError is returned instead of calling the upstream of a channel whose circuit is open,
+// the request then fails over to another channel.
+func NewCircuitOpenError(channelId int) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(fmt.Errorf("circuit breaker of channel #%d is open", channelId),
+		types.ErrorCodeCircuitOpen, http.StatusServiceUnavailable, types.ErrOptionWithNoRecordErrorLog())
+}
+
+// GetOpenCircuitChannels returns the channels not accepting requests right now, avoided when selecting channels.
+func GetOpenCircuitChannels() map[int]bool {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	if !setting.Enabled {
+		return nil
+	}
+	now := time.Now()
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+	var open map[int]bool
+	for channelId, breaker := range circuitBreakers {
+		blocked := breaker.State == CircuitStateOpen && now.Before(breaker.openUntilTime) ||
+			breaker.State == CircuitStateHalfOpen && breaker.probes >= setting.GetHalfOpenRequests()
+		if blocked {
+			if open == nil {
+				open = make(map[int]bool)
+			}
+			open[channelId] = true
+		}
+	}
+	return open
+}
+
+// GetChannelCircuitBreakers returns the breaker state of the given channels, closed ones without
+// any request in the window are left out.
+func GetChannelCircuitBreakers(channelIds []int) map[int]ChannelCircuitBreaker {
+	states := make(map[int]ChannelCircuitBreaker)
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return states
+	}
+	circuitBreakersLock.Lock()
+	defer circuitBreakersLock.Unlock()
+	for _, channelId := range channelIds {
+		breaker, ok := circuitBreakers[channelId]
+		if !ok || breaker.State == CircuitStateClosed && breaker.Requests == 0 {
+			continue
+		}
+		states[channelId] = *breaker
+	}
+	return states
+}
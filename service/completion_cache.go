@@ -0,0 +1,86 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 对话响应缓存：相同的非流式对话/补全请求直接返回缓存的响应，命中时仍记录日志，按配置的倍率计费。
+var completionCache = newResponseCache("completion", "new-api:completion_cache:v1",
+	func() int {
+		return max(operation_setting.GetResponseCacheSetting().MaxEntries, 1)
+	},
+	func() time.Duration {
+		return operation_setting.GetResponseCacheSetting().TTL()
+	},
+	func(info *relaycommon.RelayInfo, usage *dto.Usage) {
+		if info.PriceData.OtherRatios == nil {
+			info.PriceData.OtherRatios = make(map[string]float64)
+		}
+		// AddOtherRatio 会忽略 0，免费命中时直接写入
+		info.PriceData.OtherRatios["response_cache"] = operation_setting.GetResponseCacheSetting().HitQuotaRatio
+	},
+)
+
+// completionCacheKey hashes the normalized request: the fields that only change how the response is delivered are dropped.
+func completionCacheKey(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest, userId int) (string, error) {
+	normalized := *request
+	normalized.Stream = false
+	normalized.StreamOptions = nil
+	normalized.User = ""
+	body, err := common.Marshal(&normalized)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%d\n%s\n%d\n", info.RelayMode, info.OriginModelName, userId)
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LookupCompletionCache starts the cache handling of a non-streaming chat or completions request,
+// nil when neither the token nor its group opted in.
+func LookupCompletionCache(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) *ResponseCacheLookup {
+	if info.IsStream || request.Stream || info.DryRun != nil {
+		return nil
+	}
+	setting := operation_setting.GetResponseCacheSetting()
+	if !setting.IsEnabledFor(info.UsingGroup, common.GetContextKeyBool(c, constant.ContextKeyTokenResponseCache)) {
+		return nil
+	}
+	userId := info.UserId
+	if setting.ShareAcrossUsers {
+		userId = 0
+	}
+	key, err := completionCacheKey(info, request, userId)
+	if err != nil {
+		return nil
+	}
+	return completionCache.lookup(c, key, info.OriginModelName)
+}
+
+// GetCompletionCacheStats returns the hit rate of the completion cache per model on this node.
+func GetCompletionCacheStats() []ResponseCacheStats {
+	return completionCache.Stats()
+}
+
+// PurgeCompletionCache removes every cached completion response.
+func PurgeCompletionCache() error {
+	return completionCache.Purge()
+}
+
+// WriteCompletionCacheMetrics writes the completion cache lookups in the Prometheus text exposition format.
+func WriteCompletionCacheMetrics(w io.Writer) error {
+	return completionCache.writeMetrics(w)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompletionsResponseWriter converts chat completions responses written by the adaptors back to the legacy
+// completions format, used when a /v1/completions request was sent to a chat-only upstream.
+// Streams are converted line by line, other responses are buffered until Finish.
+type CompletionsResponseWriter struct {
+	gin.ResponseWriter
+	stream  bool
+	pending bytes.Buffer
+}
+
+var sseDataPrefix = []byte("data: ")
+
+func convertCompletionsStreamLine(line []byte) []byte {
+	if !bytes.HasPrefix(line, sseDataPrefix) {
+		return line
+	}
+	payload := bytes.TrimSpace(line[len(sseDataPrefix):])
+	if len(payload) == 0 || payload[0] != '{' {
+		return line
+	}
+	converted, err := ChatStreamChunkToCompletionsChunk(payload)
+	if err != nil {
+		return line
+	}
+	out := make([]byte, 0, len(sseDataPrefix)+len(converted)+1)
+	out = append(out, sseDataPrefix...)
+	out = append(out, converted...)
+	return append(out, '\n')
+}
+
+func (w *CompletionsResponseWriter) Write(data []byte) (int, error) {
+	w.pending.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	for {
+		idx := bytes.IndexByte(w.pending.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		if _, err := w.ResponseWriter.Write(convertCompletionsStreamLine(w.pending.Next(idx + 1))); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *CompletionsResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush only flushes streams, buffered responses are sent with the converted Content-Length in Finish.
+func (w *CompletionsResponseWriter) Flush() {
+	if w.stream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// StartCompletionsResponse wraps the writer so the chat completions response is sent in the completions format.
+func StartCompletionsResponse(c *gin.Context, stream bool) *CompletionsResponseWriter {
+	writer := &CompletionsResponseWriter{ResponseWriter: c.Writer, stream: stream}
+	c.Writer = writer
+	return writer
+}
+
+// Finish restores the original writer and sends what is still buffered.
+func (w *CompletionsResponseWriter) Finish(c *gin.Context) {
+	if w == nil {
+		return
+	}
+	c.Writer = w.ResponseWriter
+	if w.pending.Len() == 0 {
+		return
+	}
+	body := w.pending.Bytes()
+	if w.stream {
+		body = convertCompletionsStreamLine(body)
+	} else if converted, err := ChatResponseToCompletionsResponse(body); err == nil {
+		body = converted
+	}
+	if !w.stream && c.Writer.Header().Get("Content-Length") != "" {
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	_, _ = c.Writer.Write(body)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上游因内容过滤拒绝的错误码：OpenAI/Azure 的 content_filter、content_policy_violation，
+// 以及 Gemini 的 prompt_blocked 和本地识别出的 finish_reason=content_filter
+var contentFilterErrorCodes = map[types.ErrorCode]bool{
+	"content_filter":               true,
+	"content_policy_violation":     true,
+	types.ErrorCodePromptBlocked:   true,
+	types.ErrorCodeContentFiltered: true,
+}
+
+// ContentFilterFallbackDecision 内容过滤兜底的决策，记录在消费日志中
+type ContentFilterFallbackDecision struct {
+	Reason      string `json:"reason"`
+	FromModel   string `json:"from_model"`
+	FromChannel int    `json:"from_channel"`
+	ToModel     string `json:"to_model"`
+	ToChannel   int    `json:"to_channel"`
+}
+
+// IsContentFilterError reports whether the upstream refused the request because of its content filter.
+func IsContentFilterError(err *types.NewAPIError) bool {
+	return err != nil && contentFilterErrorCodes[err.GetErrorCode()]
+}
+
+// GetContentFilterFallback returns the fallback rule of the request, nil when the token does not allow it,
+// no rule matches or the request has already fallen back once.
+func GetContentFilterFallback(c *gin.Context, info *relaycommon.RelayInfo) *operation_setting.ContentFilterFallbackRule {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenContentFallback) {
+		return nil
+	}
+	if _, ok := common.GetContextKey(c, constant.ContextKeyContentFilterFallback); ok {
+		return nil
+	}
+	rule := operation_setting.MatchContentFilterFallbackRule(info.OriginModelName)
+	if rule == nil || (rule.FallbackModel != "" && !tokenAllowsModel(c, rule.FallbackModel)) {
+		return nil
+	}
+	return rule
+}
+
+// tokenAllowsModel applies the model limits of the token to a model the request switches to.
+func tokenAllowsModel(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	limits, _ := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	return limits[ratio_setting.FormatMatchingModelName(modelName)] || TokenAllowsModelClass(c, modelName)
+}
+
+// TokenAllowsModelClass reports whether the model belongs to one of the model classes the token may access.
+func TokenAllowsModelClass(c *gin.Context, modelName string) bool {
+	classes, _ := common.GetContextKeyType[[]string](c, constant.ContextKeyTokenModelClasses)
+	if len(classes) == 0 {
+		return false
+	}
+	class := operation_setting.GetModelClass(modelName)
+	return class != "" && common.StringsContains(classes, class)
+}
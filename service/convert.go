@@ -65,6 +65,9 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		openAITools = append(openAITools, openAITool)
 	}
 	openAIRequest.Tools = openAITools
+	if claudeRequest.ToolChoice != nil && len(openAITools) > 0 {
+		openAIRequest.ToolChoice, openAIRequest.ParallelTooCalls = claudeToolChoiceToOpenAI(claudeRequest.ToolChoice)
+	}
 
 	// Convert messages
 	openAIMessages := make([]dto.Message, 0)
@@ -123,6 +126,7 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 			}
 			contents := content
 			var toolCalls []dto.ToolCallRequest
+			var texts []string
 			mediaMessages := make([]dto.MediaContent, 0, len(contents))
 
 			for _, mediaMsg := range contents {
@@ -134,9 +138,16 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 						CacheControl: mediaMsg.CacheControl,
 					}
 					mediaMessages = append(mediaMessages, message)
+					texts = append(texts, mediaMsg.GetText())
 				case "image":
+					if mediaMsg.Source == nil {
+						continue
+					}
 					// Handle image conversion (base64 to URL or keep as is)
 					imageData := fmt.Sprintf("data:%s;base64,%s", mediaMsg.Source.MediaType, mediaMsg.Source.Data)
+					if mediaMsg.Source.Type == "url" {
+						imageData = mediaMsg.Source.Url
+					}
 					//textContent += fmt.Sprintf("[Image: %s]", imageData)
 					mediaMessage := dto.MediaContent{
 						Type:     "image_url",
@@ -182,6 +193,9 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 
 			if len(mediaMessages) > 0 && len(toolCalls) == 0 {
 				openAIMessage.SetMediaContent(mediaMessages)
+			} else if len(toolCalls) > 0 && len(texts) > 0 {
+				// tool_use 之前的文本随 tool_calls 一起保留
+				openAIMessage.SetStringContent(strings.Join(texts, "\n"))
 			}
 		}
 		if len(openAIMessage.ParseContent()) > 0 || len(openAIMessage.ToolCalls) > 0 {
@@ -189,11 +203,73 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		}
 	}
 
+	markAssistantPrefill(info, openAIMessages)
 	openAIRequest.Messages = openAIMessages
 
 	return &openAIRequest, nil
 }
 
+// claudeToolChoiceToOpenAI maps the Claude tool_choice, disable_parallel_tool_use becomes parallel_tool_calls=false.
+func claudeToolChoiceToOpenAI(toolChoice any) (any, *bool) {
+	claudeToolChoice, err := common.Any2Type[dto.ClaudeToolChoice](toolChoice)
+	if err != nil {
+		return nil, nil
+	}
+	var parallelToolCalls *bool
+	if claudeToolChoice.DisableParallelToolUse {
+		parallelToolCalls = common.GetPointer(false)
+	}
+	switch claudeToolChoice.Type {
+	case "auto":
+		return "auto", parallelToolCalls
+	case "any":
+		return "required", parallelToolCalls
+	case "none":
+		return "none", nil
+	case "tool":
+		return map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name": claudeToolChoice.Name,
+			},
+		}, parallelToolCalls
+	}
+	return nil, parallelToolCalls
+}
+
+// claudeUsageFromOpenAI converts to the Claude usage semantics: prompt_tokens includes the cache reads and
+// writes, while input_tokens only counts the uncached part.
+func claudeUsageFromOpenAI(usage *dto.Usage) *dto.ClaudeUsage {
+	cacheRead := usage.PromptTokensDetails.CachedTokens
+	cacheCreation := usage.PromptTokensDetails.CachedCreationTokens
+	return &dto.ClaudeUsage{
+		InputTokens:              max(usage.PromptTokens-cacheRead-cacheCreation, 0),
+		OutputTokens:             usage.CompletionTokens,
+		CacheCreationInputTokens: cacheCreation,
+		CacheReadInputTokens:     cacheRead,
+	}
+}
+
+// prefixContinuationChannelTypes 支持在末尾 assistant 消息上使用 prefix 续写的 OpenAI 兼容渠道
+var prefixContinuationChannelTypes = map[int]bool{
+	constant.ChannelTypeDeepSeek: true,
+	constant.ChannelTypeMistral:  true,
+}
+
+// markAssistantPrefill keeps Anthropic/Gemini prefill semantics when converting to OpenAI format:
+// a trailing assistant message is a prefix to continue, so it is flagged with prefix=true on
+// channels that support continuation instead of being answered as a finished turn.
+func markAssistantPrefill(info *relaycommon.RelayInfo, messages []dto.Message) {
+	if info == nil || len(messages) == 0 || !prefixContinuationChannelTypes[info.ChannelType] {
+		return
+	}
+	last := &messages[len(messages)-1]
+	if last.Role != "assistant" || len(last.ParseToolCalls()) > 0 {
+		return
+	}
+	last.SetPrefix(true)
+}
+
 func generateStopBlock(index int) *dto.ClaudeResponse {
 	return &dto.ClaudeResponse{
 		Type:  "content_block_stop",
@@ -318,13 +394,8 @@ func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamRespon
 			}
 			if oaiUsage != nil {
 				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
+					Type:  "message_delta",
+					Usage: claudeUsageFromOpenAI(oaiUsage),
 					Delta: &dto.ClaudeMediaMessage{
 						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
 					},
@@ -346,13 +417,8 @@ func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamRespon
 			oaiUsage := info.ClaudeConvertInfo.Usage
 			if oaiUsage != nil {
 				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
+					Type:  "message_delta",
+					Usage: claudeUsageFromOpenAI(oaiUsage),
 					Delta: &dto.ClaudeMediaMessage{
 						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
 					},
@@ -475,13 +541,8 @@ func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamRespon
 			}
 			if oaiUsage != nil {
 				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
+					Type:  "message_delta",
+					Usage: claudeUsageFromOpenAI(oaiUsage),
 					Delta: &dto.ClaudeMediaMessage{
 						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
 					},
@@ -509,8 +570,27 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 	}
 	for _, choice := range openAIResponse.Choices {
 		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
-		if choice.FinishReason == "tool_calls" {
-			for _, toolUse := range choice.Message.ParseToolCalls() {
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:     "thinking",
+				Thinking: common.GetPointer(reasoning),
+			})
+		}
+		toolCalls := choice.Message.ParseToolCalls()
+		if len(toolCalls) > 0 {
+			// 部分上游在返回工具调用时 finish_reason 仍为 stop
+			stopReason = "tool_use"
+			if text := choice.Message.StringContent(); text != "" {
+				claudeContent := dto.ClaudeMediaMessage{}
+				claudeContent.Type = "text"
+				claudeContent.SetText(text)
+				contents = append(contents, claudeContent)
+			}
+			for _, toolUse := range toolCalls {
 				claudeContent := dto.ClaudeMediaMessage{}
 				claudeContent.Type = "tool_use"
 				claudeContent.Id = toolUse.ID
@@ -532,10 +612,7 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 	}
 	claudeResponse.Content = contents
 	claudeResponse.StopReason = stopReason
-	claudeResponse.Usage = &dto.ClaudeUsage{
-		InputTokens:  openAIResponse.PromptTokens,
-		OutputTokens: openAIResponse.CompletionTokens,
-	}
+	claudeResponse.Usage = claudeUsageFromOpenAI(&openAIResponse.Usage)
 
 	return claudeResponse
 }
@@ -560,6 +637,9 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 
 	// 转换 messages
 	var messages []dto.Message
+	// Gemini 的 functionCall 没有 ID，按函数名把 functionResponse 对应到之前生成的调用 ID
+	callSeq := 0
+	pendingCallIds := make(map[string][]string)
 	for _, content := range geminiRequest.Contents {
 		message := dto.Message{
 			Role: convertGeminiRoleToOpenAI(content.Role),
@@ -569,6 +649,10 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		var mediaContents []dto.MediaContent
 		var toolCalls []dto.ToolCallRequest
 		for _, part := range content.Parts {
+			if part.Thought {
+				// 模型的思考摘要不作为上下文
+				continue
+			}
 			if part.Text != "" {
 				mediaContent := dto.MediaContent{
 					Type: "text",
@@ -597,8 +681,11 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 				mediaContents = append(mediaContents, mediaContent)
 			} else if part.FunctionCall != nil {
 				// 处理 Gemini 的工具调用
+				callSeq++
+				callId := fmt.Sprintf("call_%d", callSeq)
+				pendingCallIds[part.FunctionCall.FunctionName] = append(pendingCallIds[part.FunctionCall.FunctionName], callId)
 				toolCall := dto.ToolCallRequest{
-					ID:   fmt.Sprintf("call_%d", len(toolCalls)+1), // 生成唯一ID
+					ID:   callId,
 					Type: "function",
 					Function: dto.FunctionRequest{
 						Name:      part.FunctionCall.FunctionName,
@@ -608,9 +695,16 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 				toolCalls = append(toolCalls, toolCall)
 			} else if part.FunctionResponse != nil {
 				// 处理 Gemini 的工具响应，创建单独的 tool 消息
+				callId := fmt.Sprintf("call_%d", callSeq)
+				if ids := pendingCallIds[part.FunctionResponse.Name]; len(ids) > 0 {
+					callId = ids[0]
+					pendingCallIds[part.FunctionResponse.Name] = ids[1:]
+				}
+				toolName := part.FunctionResponse.Name
 				toolMessage := dto.Message{
 					Role:       "tool",
-					ToolCallId: fmt.Sprintf("call_%d", len(toolCalls)), // 使用对应的调用ID
+					Name:       &toolName,
+					ToolCallId: callId,
 				}
 				toolMessage.SetStringContent(toJSONString(part.FunctionResponse.Response))
 				messages = append(messages, toolMessage)
@@ -619,8 +713,17 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 
 		// 设置消息内容
 		if len(toolCalls) > 0 {
-			// 如果有工具调用，设置工具调用
+			// 如果有工具调用，设置工具调用，文本随之保留
 			message.SetToolCalls(toolCalls)
+			var texts []string
+			for _, mediaContent := range mediaContents {
+				if mediaContent.Type == "text" {
+					texts = append(texts, mediaContent.Text)
+				}
+			}
+			if len(texts) > 0 {
+				message.SetStringContent(strings.Join(texts, "\n"))
+			}
 		} else if len(mediaContents) == 1 && mediaContents[0].Type == "text" {
 			// 如果只有一个文本内容，直接设置字符串
 			message.Content = mediaContents[0].Text
@@ -635,6 +738,7 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		}
 	}
 
+	markAssistantPrefill(info, messages)
 	openaiRequest.Messages = messages
 
 	if geminiRequest.GenerationConfig.Temperature != nil {
@@ -650,12 +754,23 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		openaiRequest.MaxTokens = geminiRequest.GenerationConfig.MaxOutputTokens
 	}
 	// gemini stop sequences 最多 5 个，openai stop 最多 4 个
-	if len(geminiRequest.GenerationConfig.StopSequences) > 0 {
-		openaiRequest.Stop = geminiRequest.GenerationConfig.StopSequences[:4]
+	if stopSequences := geminiRequest.GenerationConfig.StopSequences; len(stopSequences) > 0 {
+		openaiRequest.Stop = stopSequences[:min(len(stopSequences), 4)]
 	}
 	if geminiRequest.GenerationConfig.CandidateCount > 0 {
 		openaiRequest.N = geminiRequest.GenerationConfig.CandidateCount
 	}
+	if geminiRequest.GenerationConfig.PresencePenalty != nil {
+		openaiRequest.PresencePenalty = float64(*geminiRequest.GenerationConfig.PresencePenalty)
+	}
+	if geminiRequest.GenerationConfig.FrequencyPenalty != nil {
+		openaiRequest.FrequencyPenalty = float64(*geminiRequest.GenerationConfig.FrequencyPenalty)
+	}
+	if geminiRequest.GenerationConfig.Seed != 0 {
+		openaiRequest.Seed = float64(geminiRequest.GenerationConfig.Seed)
+	}
+	openaiRequest.ResponseFormat = geminiResponseFormatToOpenAI(geminiRequest.GenerationConfig)
+	// safetySettings 没有对应的 OpenAI 参数，只在 Gemini 渠道上生效
 
 	// 转换工具调用
 	if len(geminiRequest.GetTools()) > 0 {
@@ -682,6 +797,7 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		}
 		if len(tools) > 0 {
 			openaiRequest.Tools = tools
+			openaiRequest.ToolChoice = geminiToolConfigToOpenAI(geminiRequest.ToolConfig)
 		}
 	}
 
@@ -698,6 +814,95 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 	return openaiRequest, nil
 }
 
+// geminiToolConfigToOpenAI maps functionCallingConfig to tool_choice, ANY with a single allowed function forces that function.
+func geminiToolConfigToOpenAI(toolConfig *dto.ToolConfig) any {
+	if toolConfig == nil || toolConfig.FunctionCallingConfig == nil {
+		return nil
+	}
+	config := toolConfig.FunctionCallingConfig
+	switch strings.ToUpper(string(config.Mode)) {
+	case "AUTO":
+		return "auto"
+	case "NONE":
+		return "none"
+	case "ANY", "VALIDATED":
+		if len(config.AllowedFunctionNames) == 1 {
+			return map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": config.AllowedFunctionNames[0],
+				},
+			}
+		}
+		return "required"
+	}
+	return nil
+}
+
+// geminiResponseFormatToOpenAI maps responseMimeType/responseSchema to response_format.
+func geminiResponseFormatToOpenAI(config dto.GeminiChatGenerationConfig) *dto.ResponseFormat {
+	if config.ResponseMimeType != "application/json" {
+		return nil
+	}
+	var schema any
+	if len(config.ResponseJsonSchema) > 0 {
+		schema = config.ResponseJsonSchema
+	} else if config.ResponseSchema != nil {
+		// responseSchema 是 OpenAPI 子集，类型名为大写
+		schema = lowercaseSchemaTypes(config.ResponseSchema)
+	}
+	if schema == nil {
+		return &dto.ResponseFormat{Type: "json_object"}
+	}
+	jsonSchema, err := common.Marshal(dto.FormatJsonSchema{
+		Name:   "response",
+		Schema: schema,
+	})
+	if err != nil {
+		return &dto.ResponseFormat{Type: "json_object"}
+	}
+	return &dto.ResponseFormat{Type: "json_schema", JsonSchema: jsonSchema}
+}
+
+func lowercaseSchemaTypes(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, value := range v {
+			if typeName, ok := value.(string); ok && key == "type" {
+				result[key] = strings.ToLower(typeName)
+				continue
+			}
+			result[key] = lowercaseSchemaTypes(value)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, value := range v {
+			result[i] = lowercaseSchemaTypes(value)
+		}
+		return result
+	}
+	return schema
+}
+
+// geminiUsageFromOpenAI converts to the Gemini usage semantics: completion_tokens includes the reasoning
+// tokens, while candidatesTokenCount does not.
+func geminiUsageFromOpenAI(usage *dto.Usage) dto.GeminiUsageMetadata {
+	thoughts := usage.CompletionTokenDetails.ReasoningTokens
+	totalTokens := usage.TotalTokens
+	if totalTokens == 0 {
+		totalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return dto.GeminiUsageMetadata{
+		PromptTokenCount:        usage.PromptTokens,
+		CandidatesTokenCount:    max(usage.CompletionTokens-thoughts, 0),
+		TotalTokenCount:         totalTokens,
+		ThoughtsTokenCount:      thoughts,
+		CachedContentTokenCount: usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
 func convertGeminiRoleToOpenAI(geminiRole string) string {
 	switch geminiRole {
 	case "user":
@@ -724,12 +929,8 @@ func extractTextFromGeminiParts(parts []dto.GeminiPart) string {
 // ResponseOpenAI2Gemini 将 OpenAI 响应转换为 Gemini 格式
 func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.GeminiChatResponse {
 	geminiResponse := &dto.GeminiChatResponse{
-		Candidates: make([]dto.GeminiChatCandidate, 0, len(openAIResponse.Choices)),
-		UsageMetadata: dto.GeminiUsageMetadata{
-			PromptTokenCount:     openAIResponse.PromptTokens,
-			CandidatesTokenCount: openAIResponse.CompletionTokens,
-			TotalTokenCount:      openAIResponse.PromptTokens + openAIResponse.CompletionTokens,
-		},
+		Candidates:    make([]dto.GeminiChatCandidate, 0, len(openAIResponse.Choices)),
+		UsageMetadata: geminiUsageFromOpenAI(&openAIResponse.Usage),
 	}
 
 	for _, choice := range openAIResponse.Choices {
@@ -760,9 +961,25 @@ func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relayco
 			Parts: make([]dto.GeminiPart, 0),
 		}
 
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			content.Parts = append(content.Parts, dto.GeminiPart{
+				Text:    reasoning,
+				Thought: true,
+			})
+		}
+
 		// 处理工具调用
 		toolCalls := choice.Message.ParseToolCalls()
 		if len(toolCalls) > 0 {
+			if textContent := choice.Message.StringContent(); textContent != "" {
+				content.Parts = append(content.Parts, dto.GeminiPart{
+					Text: textContent,
+				})
+			}
 			for _, toolCall := range toolCalls {
 				// 解析参数
 				var args map[string]interface{}
@@ -829,9 +1046,7 @@ func StreamResponseOpenAI2Gemini(openAIResponse *dto.ChatCompletionsStreamRespon
 	}
 
 	if openAIResponse.Usage != nil {
-		geminiResponse.UsageMetadata.PromptTokenCount = openAIResponse.Usage.PromptTokens
-		geminiResponse.UsageMetadata.CandidatesTokenCount = openAIResponse.Usage.CompletionTokens
-		geminiResponse.UsageMetadata.TotalTokenCount = openAIResponse.Usage.TotalTokens
+		geminiResponse.UsageMetadata = geminiUsageFromOpenAI(openAIResponse.Usage)
 	}
 
 	for _, choice := range openAIResponse.Choices {
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+func TestConvertToOpenAI_AssistantPrefill(t *testing.T) {
+	claudeRequest := func(lastRole string) dto.ClaudeRequest {
+		return dto.ClaudeRequest{Model: "m", Messages: []dto.ClaudeMessage{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello"},
+			{Role: "user", Content: "write a poem"},
+			{Role: lastRole, Content: "Roses are"},
+		}}
+	}
+	geminiRequest := func(lastRole string) *dto.GeminiChatRequest {
+		return &dto.GeminiChatRequest{Contents: []dto.GeminiChatContent{
+			{Role: "user", Parts: []dto.GeminiPart{{Text: "hi"}}},
+			{Role: "model", Parts: []dto.GeminiPart{{Text: "hello"}}},
+			{Role: "user", Parts: []dto.GeminiPart{{Text: "write a poem"}}},
+			{Role: lastRole, Parts: []dto.GeminiPart{{Text: "Roses are"}}},
+		}}
+	}
+	convertClaude := func(lastRole string, info *relaycommon.RelayInfo) ([]dto.Message, error) {
+		request, err := ClaudeToOpenAIRequest(claudeRequest(lastRole), info)
+		if err != nil {
+			return nil, err
+		}
+		return request.Messages, nil
+	}
+	convertGemini := func(lastRole string, info *relaycommon.RelayInfo) ([]dto.Message, error) {
+		request, err := GeminiToOpenAIRequest(geminiRequest(lastRole), info)
+		if err != nil {
+			return nil, err
+		}
+		return request.Messages, nil
+	}
+
+	cases := []struct {
+		name        string
+		convert     func(lastRole string, info *relaycommon.RelayInfo) ([]dto.Message, error)
+		lastRole    string
+		channelType int
+		prefix      bool
+	}{
+		{"claude prefill to deepseek", convertClaude, "assistant", constant.ChannelTypeDeepSeek, true},
+		{"claude prefill to openai", convertClaude, "assistant", constant.ChannelTypeOpenAI, false},
+		{"claude user turn to deepseek", convertClaude, "user", constant.ChannelTypeDeepSeek, false},
+		{"gemini prefill to mistral", convertGemini, "model", constant.ChannelTypeMistral, true},
+		{"gemini prefill to openai", convertGemini, "model", constant.ChannelTypeOpenAI, false},
+		{"gemini user turn to mistral", convertGemini, "user", constant.ChannelTypeMistral, false},
+	}
+	for _, tc := range cases {
+		info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{ChannelType: tc.channelType}}
+		messages, err := tc.convert(tc.lastRole, info)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(messages) != 4 {
+			t.Fatalf("%s: got %d messages, want 4", tc.name, len(messages))
+		}
+		last := messages[len(messages)-1]
+		if got := last.Prefix != nil && *last.Prefix; got != tc.prefix {
+			t.Fatalf("%s: prefix %v, want %v", tc.name, got, tc.prefix)
+		}
+		if last.StringContent() != "Roses are" {
+			t.Fatalf("%s: last message %q", tc.name, last.StringContent())
+		}
+		// 之前的 assistant 轮次是完整的回复，不作为前缀
+		if messages[1].Role != "assistant" || messages[1].Prefix != nil || messages[1].StringContent() != "hello" {
+			t.Fatalf("%s: earlier assistant turn changed: %+v", tc.name, messages[1])
+		}
+	}
+}
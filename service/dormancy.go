@@ -0,0 +1,432 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	dormancyBatchSize = 500
+	// dormancyReportMaxItems 报告中最多保留的明细条数，超出部分只计数
+	dormancyReportMaxItems = 1000
+)
+
+const (
+	DormancyActionNotify  = "notify"
+	DormancyActionDisable = "disable"
+	DormancyActionFlag    = "flag"
+)
+
+var (
+	dormancyOnce       sync.Once
+	dormancyLock       sync.Mutex
+	lastDormancyReport *DormancyReport
+	dormancyReportLock sync.RWMutex
+)
+
+type DormancyReportItem struct {
+	Kind         string `json:"kind"`
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	UserId       int    `json:"user_id"`
+	LastActiveAt int64  `json:"last_active_at"`
+	Action       string `json:"action"`
+	Error        string `json:"error,omitempty"`
+}
+
+// DormancyReport 一次清理的结果，试运行时为将要执行的操作
+type DormancyReport struct {
+	DryRun     bool                 `json:"dry_run"`
+	StartedAt  int64                `json:"started_at"`
+	FinishedAt int64                `json:"finished_at"`
+	Counts     map[string]int       `json:"counts"`
+	Items      []DormancyReportItem `json:"items"`
+}
+
+func (r *DormancyReport) add(item DormancyReportItem) {
+	key := item.Kind + "_" + item.Action
+	if item.Error != "" {
+		key += "_failed"
+	}
+	r.Counts[key]++
+	if len(r.Items) < dormancyReportMaxItems {
+		r.Items = append(r.Items, item)
+	}
+}
+
+// StartDormancyTask periodically cleans up the stale tokens and dormant users on the master node when enabled.
+func StartDormancyTask() {
+	dormancyOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				setting := operation_setting.GetDormancySetting()
+				time.Sleep(time.Duration(max(setting.IntervalHours, 1)) * time.Hour)
+				if !setting.Enabled {
+					continue
+				}
+				report, err := RunDormancyCleanup(setting.DryRun)
+				if err != nil {
+					common.SysError("failed to clean up dormant tokens and users: " + err.Error())
+					continue
+				}
+				common.SysLog(fmt.Sprintf("dormancy cleanup finished, dry run: %t, result: %v", report.DryRun, report.Counts))
+			}
+		})
+	})
+}
+
+// GetLastDormancyReport returns the report of the latest run, nil before the first run.
+func GetLastDormancyReport() *DormancyReport {
+	dormancyReportLock.RLock()
+	defer dormancyReportLock.RUnlock()
+	return lastDormancyReport
+}
+
+// RunDormancyCleanup notifies the owners of the tokens and the users that will be cleaned up soon, then disables
+// the tokens and flags or disables the users that stayed unused for the notice period. A dry run only reports
+// what would be done.
+func RunDormancyCleanup(dryRun bool) (*DormancyReport, error) {
+	if !dormancyLock.TryLock() {
+		return nil, errors.New("不活跃清理正在运行中，请稍后再试")
+	}
+	defer dormancyLock.Unlock()
+
+	setting := *operation_setting.GetDormancySetting()
+	if err := setting.Validate(); err != nil {
+		return nil, err
+	}
+	report := &DormancyReport{
+		DryRun:    dryRun,
+		StartedAt: common.GetTimestamp(),
+		Counts:    make(map[string]int),
+		Items:     make([]DormancyReportItem, 0),
+	}
+	run := &dormancyRun{setting: &setting, report: report, now: report.StartedAt, users: make(map[int]*model.User)}
+	if setting.TokenInactiveDays > 0 {
+		if err := run.cleanupTokens(); err != nil {
+			return nil, err
+		}
+	}
+	if setting.UserInactiveDays > 0 {
+		if err := run.cleanupUsers(); err != nil {
+			return nil, err
+		}
+	}
+	report.FinishedAt = common.GetTimestamp()
+
+	dormancyReportLock.Lock()
+	lastDormancyReport = report
+	dormancyReportLock.Unlock()
+	return report, nil
+}
+
+type dormancyRun struct {
+	setting *operation_setting.DormancySetting
+	report  *DormancyReport
+	now     int64
+	users   map[int]*model.User
+}
+
+// dormancyDecision 对一个令牌或用户的处理：提醒、执行或暂不处理
+type dormancyDecision struct {
+	notify   bool
+	act      bool
+	actionAt int64
+}
+
+// decide checks a subject that was last active at lastActive against its notice. Without notices the subject is
+// handled once it passes the inactive days, otherwise it is notified first and handled after the notice period.
+func (r *dormancyRun) decide(lastActive int64, inactiveDays int, notice *model.DormancyNotice) dormancyDecision {
+	dueAt := lastActive + int64(inactiveDays)*86400
+	if r.setting.NotifyDaysBefore == 0 {
+		return dormancyDecision{act: dueAt <= r.now, actionAt: dueAt}
+	}
+	noticePeriod := int64(r.setting.NotifyDaysBefore) * 86400
+	if notice == nil || notice.ActiveAt != lastActive {
+		return dormancyDecision{notify: true, actionAt: max(dueAt, r.now+noticePeriod)}
+	}
+	actionAt := max(dueAt, notice.NotifiedAt+noticePeriod)
+	return dormancyDecision{act: actionAt <= r.now, actionAt: actionAt}
+}
+
+// noticeWindowStart is the activity time before which subjects enter the notice period.
+func (r *dormancyRun) noticeWindowStart(inactiveDays int) int64 {
+	return r.now - int64(inactiveDays-r.setting.NotifyDaysBefore)*86400
+}
+
+func (r *dormancyRun) getUser(userId int) *model.User {
+	if user, ok := r.users[userId]; ok {
+		return user
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		user = nil
+	}
+	r.users[userId] = user
+	return user
+}
+
+func (r *dormancyRun) cleanupTokens() error {
+	pending := make(map[int][]*model.Token)
+	afterId := 0
+	for {
+		tokens, err := model.GetInactiveTokens(r.noticeWindowStart(r.setting.TokenInactiveDays), afterId, dormancyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			break
+		}
+		afterId = tokens[len(tokens)-1].Id
+		subjects := make([]string, 0, len(tokens))
+		for _, token := range tokens {
+			subjects = append(subjects, model.DormancySubject(model.DormancySubjectToken, token.Id))
+		}
+		notices, err := model.GetDormancyNotices(subjects)
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			user := r.getUser(token.UserId)
+			if user == nil || r.setting.IsExemptGroup(user.Group) {
+				continue
+			}
+			subject := model.DormancySubject(model.DormancySubjectToken, token.Id)
+			lastActive := max(token.AccessedTime, token.CreatedTime)
+			decision := r.decide(lastActive, r.setting.TokenInactiveDays, notices[subject])
+			item := DormancyReportItem{
+				Kind:         model.DormancySubjectToken,
+				Id:           token.Id,
+				Name:         token.Name,
+				UserId:       token.UserId,
+				LastActiveAt: lastActive,
+			}
+			switch {
+			case decision.notify:
+				item.Action = DormancyActionNotify
+				if !r.report.DryRun {
+					pending[token.UserId] = append(pending[token.UserId], token)
+					continue
+				}
+			case decision.act:
+				item.Action = DormancyActionDisable
+				if !r.report.DryRun {
+					item.Error = r.disableToken(token, subject)
+				}
+			default:
+				continue
+			}
+			r.report.add(item)
+		}
+		if len(tokens) < dormancyBatchSize {
+			break
+		}
+	}
+
+	for userId, tokens := range pending {
+		r.notifyTokenOwner(r.getUser(userId), tokens)
+	}
+	return nil
+}
+
+func (r *dormancyRun) disableToken(token *model.Token, subject string) string {
+	disabled, err := model.DisableInactiveToken(token)
+	if err != nil {
+		return err.Error()
+	}
+	if !disabled {
+		return "令牌状态已变化"
+	}
+	_ = model.DeleteDormancyNotice(subject)
+	RecordSystemAudit("token.dormancy_disable", AuditTargetToken, token.Id,
+		map[string]any{"status": common.TokenStatusEnabled}, map[string]any{"status": common.TokenStatusDisabled})
+	model.RecordLog(token.UserId, model.LogTypeManage,
+		fmt.Sprintf("令牌 %s 超过 %d 天未使用，已自动禁用", token.Name, r.setting.TokenInactiveDays))
+	return ""
+}
+
+// notifyTokenOwner sends one notice for all the tokens of the user, the notices are recorded only when it was
+// sent so that a failed notice is retried in the next run.
+func (r *dormancyRun) notifyTokenOwner(user *model.User, tokens []*model.Token) {
+	names := make([]string, 0, len(tokens))
+	actionAt := int64(0)
+	for _, token := range tokens {
+		names = append(names, token.Name)
+		lastActive := max(token.AccessedTime, token.CreatedTime)
+		actionAt = max(actionAt, r.decide(lastActive, r.setting.TokenInactiveDays, nil).actionAt)
+	}
+	content := fmt.Sprintf("您的 %d 个令牌（%s）已超过 %d 天未使用，如果在 %s 前仍未使用将被自动禁用。",
+		len(tokens), strings.Join(names, "、"), r.setting.TokenInactiveDays-r.setting.NotifyDaysBefore, formatDormancyDate(actionAt))
+	notifyErr := r.notify(user, "令牌即将因长期未使用被禁用", content)
+	for _, token := range tokens {
+		lastActive := max(token.AccessedTime, token.CreatedTime)
+		errMsg := notifyErr
+		if errMsg == "" {
+			errMsg = saveDormancyNotice(model.DormancySubject(model.DormancySubjectToken, token.Id), lastActive, r.now)
+		}
+		if errMsg == "" {
+			RecordSystemAudit("token.dormancy_notify", AuditTargetToken, token.Id, nil, map[string]any{"action_at": actionAt})
+		}
+		r.report.add(DormancyReportItem{
+			Kind:         model.DormancySubjectToken,
+			Id:           token.Id,
+			Name:         token.Name,
+			UserId:       token.UserId,
+			LastActiveAt: lastActive,
+			Action:       DormancyActionNotify,
+			Error:        errMsg,
+		})
+	}
+}
+
+func (r *dormancyRun) cleanupUsers() error {
+	afterId := 0
+	for {
+		users, err := model.GetInactiveUsers(r.noticeWindowStart(r.setting.UserInactiveDays), afterId, dormancyBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			break
+		}
+		afterId = users[len(users)-1].Id
+		subjects := make([]string, 0, len(users))
+		for _, user := range users {
+			subjects = append(subjects, model.DormancySubject(model.DormancySubjectUser, user.Id))
+		}
+		notices, err := model.GetDormancyNotices(subjects)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if r.setting.IsExemptGroup(user.Group) {
+				continue
+			}
+			if user.DormantAt > 0 && r.setting.UserAction == operation_setting.DormantUserActionFlag {
+				continue
+			}
+			// 最近使用时间只在登录时记录，调用和充值的时间从令牌和日志中补齐
+			latest, err := model.GetUserLatestActivity(user.Id)
+			if err != nil {
+				return err
+			}
+			if latest > user.LastActiveAt {
+				if !r.report.DryRun {
+					if err = model.TouchUserActivity(user.Id, latest); err != nil {
+						return err
+					}
+				}
+				user.LastActiveAt = latest
+			}
+			if user.LastActiveAt >= r.noticeWindowStart(r.setting.UserInactiveDays) {
+				continue
+			}
+			r.handleUser(user, notices[model.DormancySubject(model.DormancySubjectUser, user.Id)])
+		}
+		if len(users) < dormancyBatchSize {
+			break
+		}
+	}
+	return nil
+}
+
+func (r *dormancyRun) handleUser(user *model.User, notice *model.DormancyNotice) {
+	subject := model.DormancySubject(model.DormancySubjectUser, user.Id)
+	decision := r.decide(user.LastActiveAt, r.setting.UserInactiveDays, notice)
+	disable := r.setting.UserAction == operation_setting.DormantUserActionDisable
+	item := DormancyReportItem{
+		Kind:         model.DormancySubjectUser,
+		Id:           user.Id,
+		Name:         user.Username,
+		UserId:       user.Id,
+		LastActiveAt: user.LastActiveAt,
+	}
+	switch {
+	case decision.notify:
+		item.Action = DormancyActionNotify
+		if r.report.DryRun {
+			break
+		}
+		outcome := "标记为不活跃账户"
+		if disable {
+			outcome = "禁用"
+		}
+		content := fmt.Sprintf("您的账户已超过 %d 天未登录或使用，如果在 %s 前仍未登录或使用将被%s。",
+			r.setting.UserInactiveDays-r.setting.NotifyDaysBefore, formatDormancyDate(decision.actionAt), outcome)
+		item.Error = r.notify(user, "账户即将因长期未使用被处理", content)
+		if item.Error == "" {
+			item.Error = saveDormancyNotice(subject, user.LastActiveAt, r.now)
+		}
+		if item.Error == "" {
+			RecordSystemAudit("user.dormancy_notify", AuditTargetUser, user.Id, nil, map[string]any{"action_at": decision.actionAt})
+		}
+	case decision.act:
+		item.Action = DormancyActionFlag
+		if disable {
+			item.Action = DormancyActionDisable
+		}
+		if r.report.DryRun {
+			break
+		}
+		changed, err := model.MarkUserDormant(user.Id, user.LastActiveAt, disable)
+		if err != nil {
+			item.Error = err.Error()
+			break
+		}
+		if !changed {
+			item.Error = "用户状态已变化"
+			break
+		}
+		_ = model.DeleteDormancyNotice(subject)
+		after := map[string]any{"dormant_at": r.now}
+		if disable {
+			after["status"] = common.UserStatusDisabled
+		}
+		RecordSystemAudit("user.dormancy_"+item.Action, AuditTargetUser, user.Id,
+			map[string]any{"dormant_at": 0, "status": common.UserStatusEnabled}, after)
+		message := fmt.Sprintf("账户超过 %d 天未使用，已标记为不活跃账户", r.setting.UserInactiveDays)
+		if disable {
+			message = fmt.Sprintf("账户超过 %d 天未使用，已自动禁用", r.setting.UserInactiveDays)
+		}
+		model.RecordLog(user.Id, model.LogTypeManage, message)
+	default:
+		return
+	}
+	r.report.add(item)
+}
+
+func (r *dormancyRun) notify(user *model.User, title string, content string) string {
+	if user == nil {
+		return "用户不存在"
+	}
+	data := dto.NewNotify(dto.NotifyTypeDormancy, title, content, nil)
+	if err := NotifyUser(user.Id, user.Email, user.ToBaseUser().GetSetting(), data); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func saveDormancyNotice(subject string, activeAt int64, notifiedAt int64) string {
+	err := model.SaveDormancyNotice(&model.DormancyNotice{Subject: subject, ActiveAt: activeAt, NotifiedAt: notifiedAt})
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func formatDormancyDate(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02")
+}
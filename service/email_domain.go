@@ -0,0 +1,85 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const disposableDomainListMaxBytes = 8 << 20
+
+// CheckRegistrationEmailDomain applies the deny list and the disposable email blocking to a sign-up email.
+// The existing domain whitelist (EmailDomainRestrictionEnabled) is checked separately.
+func CheckRegistrationEmailDomain(email string) error {
+	domain := system_setting.EmailDomain(email)
+	if domain == "" {
+		return errors.New("无效的邮箱地址")
+	}
+	if system_setting.IsEmailDomainDenied(domain) {
+		return errors.New("管理员已禁止使用该邮箱域名注册")
+	}
+	if system_setting.GetEmailDomainSettings().BlockDisposable && system_setting.IsDisposableEmailDomain(domain) {
+		return errors.New("不支持使用一次性邮箱注册")
+	}
+	return nil
+}
+
+var disposableDomainSyncOnce sync.Once
+
+// StartDisposableDomainSyncTask keeps the remote disposable domain list in memory, refreshed daily
+// and whenever the configured URL changes.
+func StartDisposableDomainSyncTask() {
+	disposableDomainSyncOnce.Do(func() {
+		gopool.Go(func() {
+			var lastURL string
+			var lastSync time.Time
+			for {
+				listURL := strings.TrimSpace(system_setting.GetEmailDomainSettings().DisposableListURL)
+				if listURL != lastURL || (listURL != "" && time.Since(lastSync) > 24*time.Hour) {
+					if listURL == "" {
+						system_setting.SetRemoteDisposableDomains(nil)
+					} else if domains, err := fetchDisposableDomainList(listURL); err != nil {
+						common.SysError("failed to sync disposable email domains: " + err.Error())
+					} else {
+						system_setting.SetRemoteDisposableDomains(domains)
+						common.SysLog(fmt.Sprintf("synced %d disposable email domains", len(domains)))
+					}
+					lastURL = listURL
+					lastSync = time.Now()
+				}
+				time.Sleep(time.Minute)
+			}
+		})
+	})
+}
+
+func fetchDisposableDomainList(listURL string) ([]string, error) {
+	resp, err := DoDownloadRequest(listURL, "disposable email domain list")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	domains := make([]string, 0)
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, disposableDomainListMaxBytes))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, scanner.Err()
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 嵌入结果缓存：按（模型，输入）缓存上游的嵌入响应，嵌入结果是确定的，默认保留时间较长。
+// 命中时按缓存的输入 token 计费。
+var embeddingCache = newResponseCache("embedding", "new-api:embedding_cache:v2",
+	func() int {
+		return max(operation_setting.GetEmbeddingCacheSetting().MaxEntries, 1)
+	},
+	func() time.Duration {
+		return operation_setting.GetEmbeddingCacheSetting().TTL()
+	},
+	func(info *relaycommon.RelayInfo, usage *dto.Usage) {
+		info.PriceData.CacheRatio = operation_setting.GetEmbeddingCacheSetting().HitQuotaRatio
+		usage.PromptTokensDetails.CachedTokens = usage.PromptTokens
+	},
+)
+
+// embeddingCacheKey hashes everything that changes the embedding result.
+func embeddingCacheKey(request *dto.EmbeddingRequest) (string, error) {
+	input, err := common.Marshal(request.Input)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\n%s\n%d\n", request.Model, request.EncodingFormat, request.Dimensions)
+	_, _ = h.Write(input)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LookupEmbeddingCache starts the cache handling of an embedding request, nil when the cache is off for its group.
+func LookupEmbeddingCache(c *gin.Context, info *relaycommon.RelayInfo, request *dto.EmbeddingRequest) *ResponseCacheLookup {
+	if info.DryRun != nil || !operation_setting.GetEmbeddingCacheSetting().IsEnabledForGroup(info.UsingGroup) {
+		return nil
+	}
+	key, err := embeddingCacheKey(request)
+	if err != nil {
+		return nil
+	}
+	return embeddingCache.lookup(c, key, info.OriginModelName)
+}
+
+// GetEmbeddingCacheStats returns the hit rate of the embedding cache per model on this node.
+func GetEmbeddingCacheStats() []ResponseCacheStats {
+	return embeddingCache.Stats()
+}
+
+// PurgeEmbeddingCache removes every cached embedding response.
+func PurgeEmbeddingCache() error {
+	return embeddingCache.Purge()
+}
+
+// WriteEmbeddingCacheMetrics writes the embedding cache lookups in the Prometheus text exposition format.
+func WriteEmbeddingCacheMetrics(w io.Writer) error {
+	return embeddingCache.writeMetrics(w)
+}
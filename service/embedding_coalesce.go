@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// 嵌入请求合并：第一个到达的请求作为发起者，等待时间窗口结束或输入条数达到上限后，用自己的上下文发送合并后的请求，
+// 其余请求等待结果，从响应中取回自己的向量并按输入长度比例分摊 token 用量。
+
+// EmbeddingBatchSender sends the inputs of a batch upstream in one request.
+type EmbeddingBatchSender func(inputs []string) (*dto.FlexibleEmbeddingResponse, *types.NewAPIError)
+
+type embeddingBatch struct {
+	inputs   []string
+	full     chan struct{}
+	done     chan struct{}
+	response *dto.FlexibleEmbeddingResponse
+	err      *types.NewAPIError
+}
+
+// EmbeddingCoalesceResult is the part of a coalesced upstream response that belongs to one request.
+type EmbeddingCoalesceResult struct {
+	Response   *dto.FlexibleEmbeddingResponse
+	BatchSize  int
+	BatchCount int
+}
+
+var (
+	embeddingBatchesLock sync.Mutex
+	embeddingBatches     = make(map[string]*embeddingBatch)
+)
+
+// EmbeddingCoalesceKey identifies the requests that can share one upstream request.
+func EmbeddingCoalesceKey(channelId int, request *dto.EmbeddingRequest) string {
+	return fmt.Sprintf("%d:%s:%s:%d", channelId, request.Model, request.EncodingFormat, request.Dimensions)
+}
+
+func joinEmbeddingBatch(key string, inputs []string) (*embeddingBatch, int, bool) {
+	maxInputs := operation_setting.GetEmbeddingCoalesceSetting().MaxBatchInputs
+	embeddingBatchesLock.Lock()
+	defer embeddingBatchesLock.Unlock()
+	batch, ok := embeddingBatches[key]
+	leader := false
+	if !ok || (maxInputs > 0 && len(batch.inputs)+len(inputs) > maxInputs) {
+		// 放不下时另起一批，原批次由它的发起者按时发送
+		batch = &embeddingBatch{full: make(chan struct{}), done: make(chan struct{})}
+		embeddingBatches[key] = batch
+		leader = true
+	}
+	offset := len(batch.inputs)
+	batch.inputs = append(batch.inputs, inputs...)
+	if maxInputs > 0 && len(batch.inputs) >= maxInputs {
+		delete(embeddingBatches, key)
+		close(batch.full)
+	}
+	return batch, offset, leader
+}
+
+// CoalesceEmbedding merges the inputs into the open batch of key and returns the embeddings and the share of the
+// token usage of this request, send is only called when this request starts the batch.
+func CoalesceEmbedding(key string, inputs []string, send EmbeddingBatchSender) (*EmbeddingCoalesceResult, *types.NewAPIError) {
+	batch, offset, leader := joinEmbeddingBatch(key, inputs)
+	if leader {
+		timer := time.NewTimer(operation_setting.GetEmbeddingCoalesceSetting().Window())
+		select {
+		case <-timer.C:
+		case <-batch.full:
+			timer.Stop()
+		}
+		embeddingBatchesLock.Lock()
+		if embeddingBatches[key] == batch {
+			delete(embeddingBatches, key)
+		}
+		embeddingBatchesLock.Unlock()
+		batch.response, batch.err = send(batch.inputs)
+		close(batch.done)
+	} else {
+		<-batch.done
+	}
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	return splitEmbeddingBatch(batch, offset, len(inputs))
+}
+
+func splitEmbeddingBatch(batch *embeddingBatch, offset int, count int) (*EmbeddingCoalesceResult, *types.NewAPIError) {
+	upstream := batch.response
+	if len(upstream.Data) != len(batch.inputs) {
+		return nil, types.NewOpenAIError(fmt.Errorf("coalesced embedding response has %d embeddings for %d inputs", len(upstream.Data), len(batch.inputs)), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	response := &dto.FlexibleEmbeddingResponse{
+		Object: upstream.Object,
+		Model:  upstream.Model,
+		Data:   make([]dto.FlexibleEmbeddingResponseItem, 0, count),
+	}
+	for _, item := range upstream.Data {
+		if item.Index < offset || item.Index >= offset+count {
+			continue
+		}
+		item.Index -= offset
+		response.Data = append(response.Data, item)
+	}
+	if len(response.Data) != count {
+		return nil, types.NewOpenAIError(fmt.Errorf("coalesced embedding response is missing embeddings"), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	// 上游只返回整批的用量，按输入字符数分摊
+	totalChars, ownChars := 0, 0
+	for i, input := range batch.inputs {
+		chars := utf8.RuneCountInString(input)
+		totalChars += chars
+		if i >= offset && i < offset+count {
+			ownChars += chars
+		}
+	}
+	promptTokens := upstream.PromptTokens
+	if totalChars > 0 {
+		promptTokens = int(float64(upstream.PromptTokens) * float64(ownChars) / float64(totalChars))
+	}
+	if promptTokens == 0 && ownChars > 0 && upstream.PromptTokens > 0 {
+		promptTokens = 1
+	}
+	response.Usage = dto.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	return &EmbeddingCoalesceResult{Response: response, BatchSize: len(batch.inputs), BatchCount: count}, nil
+}
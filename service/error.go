@@ -89,6 +89,14 @@ func RelayErrorHandler(ctx context.Context, resp *http.Response, showBodyWhenFai
 		return
 	}
 	CloseResponseBodyGracefully(resp)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// 记录上游限流的重置时间，用于冷却渠道和告知客户端
+		if retryAfter := ParseUpstreamRetryAfter(resp.Header, responseBody); retryAfter > 0 {
+			defer func() {
+				newApiErr.RetryAfter = retryAfter
+			}()
+		}
+	}
 	var errResponse dto.GeneralErrorResponse
 	buildErrWithBody := func(message string) error {
 		if message == "" {
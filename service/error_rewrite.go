@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errorRewriteRegexCache sync.Map // map[string]*regexp.Regexp
+
+// ValidateErrorRewriteRules checks the error rewrite rules of a channel before they are saved.
+func ValidateErrorRewriteRules(rules []dto.ChannelErrorRewriteRule) error {
+	for i, rule := range rules {
+		switch rule.Action {
+		case dto.ErrorRewriteReplace:
+			if rule.Match == "" {
+				return fmt.Errorf("第 %d 条规则：替换时匹配内容不能为空", i+1)
+			}
+		case dto.ErrorRewriteOverride, dto.ErrorRewriteAppend, dto.ErrorRewritePrepend:
+			if rule.Value == "" {
+				return fmt.Errorf("第 %d 条规则：改写内容不能为空", i+1)
+			}
+		default:
+			return fmt.Errorf("第 %d 条规则：未知的改写方式 %s，可选值：replace, override, append, prepend", i+1, rule.Action)
+		}
+		if rule.Regex {
+			if _, err := regexp.Compile(rule.Match); err != nil {
+				return fmt.Errorf("第 %d 条规则：无效的正则表达式: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func errorRewriteRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := errorRewriteRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	errorRewriteRegexCache.Store(pattern, re)
+	return re, nil
+}
+
+// RewriteErrorMessage applies the rules in order to the message of an error with the status code, it reports
+// whether any rule matched.
+func RewriteErrorMessage(rules []dto.ChannelErrorRewriteRule, statusCode int, message string) (string, bool) {
+	rewritten := false
+	for _, rule := range rules {
+		if len(rule.StatusCodes) > 0 && !slices.Contains(rule.StatusCodes, statusCode) {
+			continue
+		}
+		var re *regexp.Regexp
+		if rule.Match != "" {
+			if rule.Regex {
+				var err error
+				// 保存时已校验，无效的正则视为不匹配，避免影响请求
+				if re, err = errorRewriteRegex(rule.Match); err != nil || !re.MatchString(message) {
+					continue
+				}
+			} else if !strings.Contains(message, rule.Match) {
+				continue
+			}
+		}
+		switch rule.Action {
+		case dto.ErrorRewriteReplace:
+			if rule.Match == "" {
+				continue
+			}
+			if re != nil {
+				message = re.ReplaceAllString(message, rule.Value)
+			} else {
+				message = strings.ReplaceAll(message, rule.Match, rule.Value)
+			}
+		case dto.ErrorRewriteOverride:
+			message = rule.Value
+		case dto.ErrorRewriteAppend:
+			message = message + rule.Value
+		case dto.ErrorRewritePrepend:
+			message = rule.Value + message
+		default:
+			continue
+		}
+		rewritten = true
+	}
+	return message, rewritten
+}
+
+func init() {
+	relaycommon.StreamErrorRewriter = RewriteChannelError
+}
+
+// rewriteChannelErrorMessage applies the error rewrite rules of the channel selected for the request.
+func rewriteChannelErrorMessage(c *gin.Context, statusCode int, message string) (string, bool) {
+	settings, ok := common.GetContextKeyType[dto.ChannelOtherSettings](c, constant.ContextKeyChannelOtherSetting)
+	if !ok || len(settings.ErrorRewriteRules) == 0 {
+		return message, false
+	}
+	message, rewritten := RewriteErrorMessage(settings.ErrorRewriteRules, statusCode, message)
+	if rewritten {
+		logger.LogInfo(c, fmt.Sprintf("error message rewritten by rules of channel #%d", common.GetContextKeyInt(c, constant.ContextKeyChannelId)))
+	}
+	return message, rewritten
+}
+
+// RewriteChannelError 按当前渠道的改写规则修改返回给客户端的错误消息，原始消息已由调用方记录在日志中
+func RewriteChannelError(c *gin.Context, err *types.NewAPIError) {
+	if err == nil {
+		return
+	}
+	if message, rewritten := rewriteChannelErrorMessage(c, err.StatusCode, err.Error()); rewritten {
+		err.RewriteMessage(message)
+	}
+}
+
+// RewriteTaskError 异步任务接口的错误同样按渠道规则改写
+func RewriteTaskError(c *gin.Context, err *dto.TaskError) {
+	if err == nil {
+		return
+	}
+	if message, rewritten := rewriteChannelErrorMessage(c, err.StatusCode, err.Message); rewritten {
+		err.Message = message
+	}
+}
+
+// RewriteMidjourneyErrorMessage 按渠道规则改写 Midjourney 接口返回的错误描述
+func RewriteMidjourneyErrorMessage(c *gin.Context, statusCode int, description string) string {
+	description, _ = rewriteChannelErrorMessage(c, statusCode, description)
+	return description
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func errorRewriteContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(c, constant.ContextKeyChannelOtherSetting, dto.ChannelOtherSettings{
+		ErrorRewriteRules: []dto.ChannelErrorRewriteRule{
+			{Match: "upstream-vendor", Action: dto.ErrorRewriteReplace, Value: "provider"},
+			{StatusCodes: []int{http.StatusTooManyRequests}, Action: dto.ErrorRewriteOverride, Value: "busy, retry later"},
+		},
+	})
+	return c
+}
+
+func TestRewriteChannelErrorAtResponsePoints(t *testing.T) {
+	c := errorRewriteContext()
+
+	apiErr := types.NewOpenAIError(errors.New("upstream-vendor rejected the key"), types.ErrorCodeBadResponse, http.StatusUnauthorized)
+	RewriteChannelError(c, apiErr)
+	if apiErr.Error() != "provider rejected the key" {
+		t.Fatalf("relay error = %q", apiErr.Error())
+	}
+	// 流中途的错误经由 relay 注册的改写函数处理
+	streamErr := types.NewOpenAIError(errors.New("upstream-vendor overloaded"), types.ErrorCodeBadResponse, http.StatusServiceUnavailable)
+	relaycommon.StreamErrorRewriter(c, streamErr)
+	if streamErr.ToOpenAIError().Message != "provider overloaded" {
+		t.Fatalf("stream error = %q", streamErr.ToOpenAIError().Message)
+	}
+
+	taskErr := &dto.TaskError{Code: "fail_to_fetch_task", Message: "upstream-vendor task failed", StatusCode: http.StatusBadRequest}
+	RewriteTaskError(c, taskErr)
+	if taskErr.Message != "provider task failed" {
+		t.Fatalf("task error = %q", taskErr.Message)
+	}
+	taskErr = &dto.TaskError{Message: "quota", StatusCode: http.StatusTooManyRequests}
+	RewriteTaskError(c, taskErr)
+	if taskErr.Message != "busy, retry later" {
+		t.Fatalf("task error with status rule = %q", taskErr.Message)
+	}
+
+	if got := RewriteMidjourneyErrorMessage(c, http.StatusBadRequest, "upstream-vendor 提交失败"); got != "provider 提交失败" {
+		t.Fatalf("midjourney error = %q", got)
+	}
+
+	// 没有选中渠道时保持原样
+	plain, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if got := RewriteMidjourneyErrorMessage(plain, http.StatusBadRequest, "upstream-vendor"); got != "upstream-vendor" {
+		t.Fatalf("message rewritten without channel rules: %q", got)
+	}
+}
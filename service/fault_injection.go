@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errFaultInjectedStreamDrop = errors.New("stream dropped by fault injection")
+
+// InjectFault applies the admin configured fault injection rule matching the token/channel.
+// A non-nil error means the request must be answered with it instead of calling the upstream.
+func InjectFault(c *gin.Context, info *relaycommon.RelayInfo, channelId int) *types.NewAPIError {
+	if info == nil {
+		return nil
+	}
+	rule := operation_setting.MatchFaultInjectionRule(info.TokenId, channelId)
+	if rule == nil {
+		return nil
+	}
+
+	if rule.LatencyMs > 0 {
+		logger.LogWarn(c, fmt.Sprintf("fault injection %q: delaying request by %dms", rule.Name, rule.LatencyMs))
+		select {
+		case <-time.After(time.Duration(rule.LatencyMs) * time.Millisecond):
+		case <-c.Request.Context().Done():
+		}
+	}
+
+	if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+		statusCode := rule.ErrorStatusCode
+		if statusCode < http.StatusBadRequest {
+			statusCode = http.StatusInternalServerError
+		}
+		if statusCode == http.StatusTooManyRequests && rule.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(rule.RetryAfter))
+		}
+		logger.LogWarn(c, fmt.Sprintf("fault injection %q: returning status code %d", rule.Name, statusCode))
+		return types.NewErrorWithStatusCode(
+			fmt.Errorf("fault injected: %s", http.StatusText(statusCode)),
+			types.ErrorCodeFaultInjected,
+			statusCode,
+			types.ErrOptionWithSkipRetry(),
+		)
+	}
+
+	if info.IsStream && rule.StreamDropRate > 0 && rand.Float64() < rule.StreamDropRate {
+		if _, ok := c.Writer.(*faultInjectionWriter); !ok {
+			logger.LogWarn(c, fmt.Sprintf("fault injection %q: dropping stream after %d chunks", rule.Name, rule.StreamDropAfterChunks))
+			c.Writer = &faultInjectionWriter{ResponseWriter: c.Writer, dropAfter: rule.StreamDropAfterChunks}
+		}
+	}
+	return nil
+}
+
+// faultInjectionWriter cuts the connection once the given number of chunks has been flushed.
+type faultInjectionWriter struct {
+	gin.ResponseWriter
+	dropAfter int
+	flushed   int
+	dropped   bool
+}
+
+func (w *faultInjectionWriter) Write(data []byte) (int, error) {
+	if w.dropped {
+		return 0, errFaultInjectedStreamDrop
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *faultInjectionWriter) WriteString(s string) (int, error) {
+	if w.dropped {
+		return 0, errFaultInjectedStreamDrop
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *faultInjectionWriter) Flush() {
+	if w.dropped {
+		return
+	}
+	w.ResponseWriter.Flush()
+	w.flushed++
+	if w.flushed > w.dropAfter {
+		w.drop()
+	}
+}
+
+// drop closes the underlying connection so the client sees an abrupt disconnect,
+// falling back to silently discarding the rest of the stream when hijacking is not possible (e.g. HTTP/2).
+func (w *faultInjectionWriter) drop() {
+	w.dropped = true
+	conn, _, err := w.ResponseWriter.Hijack()
+	if err != nil {
+		return
+	}
+	_ = conn.Close()
+}
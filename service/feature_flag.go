@@ -0,0 +1,37 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IsFeatureEnabled evaluates the feature flag for the request, features without a configured flag stay enabled
+// and keep following their own settings.
+func IsFeatureEnabled(c *gin.Context, name string) bool {
+	flag, ok := operation_setting.GetFeatureFlag(name)
+	if !ok {
+		return true
+	}
+	if c == nil {
+		return flag.Evaluate(name, "", "", "")
+	}
+	// 按令牌分桶，令牌不存在时（例如 playground）按用户分桶
+	key := ""
+	if tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId); tokenId != 0 {
+		key = "token:" + strconv.Itoa(tokenId)
+	} else if userId := common.GetContextKeyInt(c, constant.ContextKeyUserId); userId != 0 {
+		key = "user:" + strconv.Itoa(userId)
+	} else {
+		key = c.GetString(common.RequestIdKey)
+	}
+	path := ""
+	if c.Request != nil {
+		path = c.Request.URL.Path
+	}
+	return flag.Evaluate(name, common.GetContextKeyString(c, constant.ContextKeyUsingGroup), path, key)
+}
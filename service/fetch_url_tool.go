@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+var (
+	htmlIgnoredBlockRegex = regexp.MustCompile(`(?is)<(script|style|noscript|svg|head)\b.*?</(script|style|noscript|svg|head)\s*>`)
+	htmlBreakTagRegex     = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6])\b[^>]*>`)
+	htmlTagRegex          = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLinesRegex       = regexp.MustCompile(`\n\s*\n+`)
+	inlineSpacesRegex     = regexp.MustCompile(`[ \t\r\f\v]+`)
+)
+
+// FetchURLForTool downloads the page for the fetch_url tool and returns its text. The fetch setting is applied
+// with SSRF protection always on, and the address actually connected to is checked as well, so a domain that
+// resolves to a private address is refused.
+func FetchURLForTool(ctx context.Context, rawURL string) (string, error) {
+	if err := common.CheckOutboundAllowed("fetch_url tool"); err != nil {
+		return "", err
+	}
+	setting := operation_setting.GetFetchURLToolSetting()
+	if err := validateFetchURL(rawURL); err != nil {
+		return "", err
+	}
+	timeout := time.Duration(max(setting.TimeoutSeconds, 1)) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; new-api fetch_url)")
+	req.Header.Set("Accept", "text/html,text/plain,application/json,application/xml;q=0.9,*/*;q=0.1")
+	resp, err := newFetchURLToolClient(timeout).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "" && !isFetchableMediaType(mediaType) {
+		return "", fmt.Errorf("unsupported content type %s", mediaType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(max(setting.MaxResponseKB, 1))*1024))
+	if err != nil {
+		return "", err
+	}
+	text := string(data)
+	if mediaType == "" || strings.Contains(mediaType, "html") {
+		text = htmlToText(text)
+	}
+	if runes := []rune(text); setting.MaxContentChars > 0 && len(runes) > setting.MaxContentChars {
+		text = string(runes[:setting.MaxContentChars]) + "\n[content truncated]"
+	}
+	return text, nil
+}
+
+func validateFetchURL(rawURL string) error {
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(rawURL, true, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return fmt.Errorf("request reject: %v", err)
+	}
+	return nil
+}
+
+// newFetchURLToolClient 不使用代理，连接前检查解析出的 IP，重定向的地址同样校验
+func newFetchURLToolClient(timeout time.Duration) *http.Client {
+	fetchSetting := system_setting.GetFetchSetting()
+	protection := &common.SSRFProtection{
+		AllowPrivateIp: fetchSetting.AllowPrivateIp,
+		IpFilterMode:   fetchSetting.IpFilterMode,
+		IpList:         fetchSetting.IpList,
+	}
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !protection.IsIPAccessAllowed(ip) {
+				return fmt.Errorf("connection to %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			return validateFetchURL(req.URL.String())
+		},
+	}
+}
+
+func isFetchableMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml")
+}
+
+// htmlToText 去掉脚本、样式和标签，保留段落换行
+func htmlToText(s string) string {
+	s = htmlIgnoredBlockRegex.ReplaceAllString(s, "")
+	s = htmlBreakTagRegex.ReplaceAllString(s, "\n")
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = inlineSpacesRegex.ReplaceAllString(s, " ")
+	s = blankLinesRegex.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/storage"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 通过 /v1/files 上传的文件与批量任务生成的结果文件保存在对象存储中，数据库只记录元信息。
+// 批量任务执行过程中的结果按分片保存，任务结束时合并为结果文件。
+
+const (
+	filePrefix       = "files/"
+	batchPartsPrefix = "batches/"
+)
+
+// SaveFile stores the content with its content type and records the file of the user, expiresAt 0 keeps it until
+// it is deleted.
+func SaveFile(ctx context.Context, userId int, purpose string, filename string, contentType string, data []byte, expiresAt int64) (*model.File, error) {
+	store, err := GetStorage()
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		FileId:    "file-" + common.GetUUID(),
+		UserId:    userId,
+		Purpose:   purpose,
+		Filename:  filename,
+		Bytes:     int64(len(data)),
+		CreatedAt: common.GetTimestamp(),
+		ExpiresAt: expiresAt,
+	}
+	file.StorageKey = filePrefix + file.FileId
+	if err = store.Put(ctx, file.StorageKey, data, contentType); err != nil {
+		return nil, err
+	}
+	if err = file.Insert(); err != nil {
+		_ = store.Delete(ctx, file.StorageKey)
+		return nil, err
+	}
+	return file, nil
+}
+
+// OpenFile returns the content of the file, the caller must close it.
+func OpenFile(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	store, err := GetStorage()
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, file.StorageKey)
+}
+
+func ReadFile(ctx context.Context, file *model.File) ([]byte, error) {
+	reader, err := OpenFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// DeleteFile removes the content and the record of the file.
+func DeleteFile(ctx context.Context, file *model.File) error {
+	store, err := GetStorage()
+	if err != nil {
+		return err
+	}
+	if err = store.Delete(ctx, file.StorageKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return model.DeleteFileById(file.Id)
+}
+
+func batchPartKey(batchId string, kind string, part int) string {
+	return fmt.Sprintf("%s%s/%s-%06d.jsonl", batchPartsPrefix, batchId, kind, part)
+}
+
+// SaveBatchPart stores a chunk of the output ("output") or error ("error") lines of the batch.
+func SaveBatchPart(ctx context.Context, batchId string, kind string, part int, data []byte) error {
+	store, err := GetStorage()
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, batchPartKey(batchId, kind, part), data, "application/jsonl")
+}
+
+// MergeBatchParts joins the stored chunks of the given kind into a result file of the user and removes them,
+// it returns nil when the batch produced no such lines.
+func MergeBatchParts(ctx context.Context, batch *model.Batch, kind string) (*model.File, error) {
+	store, err := GetStorage()
+	if err != nil {
+		return nil, err
+	}
+	var content bytes.Buffer
+	keys := make([]string, 0, batch.Parts)
+	for part := 0; part < batch.Parts; part++ {
+		key := batchPartKey(batch.BatchId, kind, part)
+		reader, err := store.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(&content, reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if content.Len() == 0 {
+		return nil, nil
+	}
+	var expiresAt int64
+	if days := operation_setting.GetFileSetting().OutputTTLDays; days > 0 {
+		expiresAt = time.Now().AddDate(0, 0, days).Unix()
+	}
+	file, err := SaveFile(ctx, batch.UserId, model.FilePurposeBatchOutput, fmt.Sprintf("%s_%s.jsonl", batch.BatchId, kind), "application/jsonl", content.Bytes(), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		_ = store.Delete(ctx, key)
+	}
+	return file, nil
+}
+
+var fileCleanupOnce sync.Once
+
+// StartFileCleanupTask deletes the expired files hourly on the master node.
+func StartFileCleanupTask() {
+	fileCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				time.Sleep(time.Hour)
+				removed, err := cleanupExpiredFiles()
+				if err != nil {
+					logger.LogModuleError(context.Background(), logger.ModuleCleanup, "failed to clean up expired files: %s", err.Error())
+				}
+				if removed > 0 {
+					logger.LogModuleInfo(context.Background(), logger.ModuleCleanup, "removed %d expired files", removed)
+					model.RecordRetentionCleanup("file", int64(removed))
+				}
+			}
+		})
+	})
+}
+
+func cleanupExpiredFiles() (int, error) {
+	ctx := context.Background()
+	removed := 0
+	for {
+		files, err := model.GetExpiredFiles(100)
+		if err != nil {
+			return removed, err
+		}
+		for _, file := range files {
+			if err = DeleteFile(ctx, file); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if len(files) < 100 {
+			return removed, nil
+		}
+	}
+}
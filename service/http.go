@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/helper"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,9 +28,17 @@ func IOCopyBytesGracefully(c *gin.Context, src *http.Response, data []byte) {
 	if c.Writer == nil {
 		return
 	}
+	// 成功的未压缩响应附加来源信息
+	if src == nil || (src.StatusCode < http.StatusBadRequest && src.Header.Get("Content-Encoding") == "") {
+		data = helper.InjectProvenance(c, data)
+	}
 
 	body := io.NopCloser(bytes.NewBuffer(data))
-	common.CapturePayloadForLog(c, constant.ContextKeyLoggedResponseBody, data)
+	if src != nil {
+		common.CaptureEncodedPayloadForLog(c, constant.ContextKeyLoggedResponseBody, data, src.Header.Get("Content-Encoding"))
+	} else {
+		common.CapturePayloadForLog(c, constant.ContextKeyLoggedResponseBody, data)
+	}
 
 	// We shouldn't set the header before we parse the response body, because the parse part may fail.
 	// And then we will have to send an error response, but in this case, the header has already been set.
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 上游图片生成接口返回的链接通常很快过期，开启转存后网关下载图片保存到对象存储，
+// 并把响应中的链接替换为带签名的网关链接，过期的图片由清理任务删除。
+// 客户端指定 response_format 而上游返回了另一种格式时（例如只返回 base64 的后端），
+// 同样在这里把图片转换为客户端要求的链接或 base64。
+
+const rehostedImagePrefix = "images/"
+
+var rehostedImageNamePattern = regexp.MustCompile(`^[0-9a-f]{32}\.(png|jpg|webp|gif)$`)
+
+var rehostedImageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+// ImageRehostWriter buffers the image response so upstream links can be replaced before it is sent.
+type ImageRehostWriter struct {
+	gin.ResponseWriter
+	body           bytes.Buffer
+	responseFormat string
+}
+
+func (w *ImageRehostWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *ImageRehostWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// StartImageRehost starts buffering the response when re-hosting is enabled or the client asked for a
+// response format, it returns nil otherwise. Streaming responses are sent as they are.
+func StartImageRehost(c *gin.Context, info *relaycommon.RelayInfo) *ImageRehostWriter {
+	if info.IsStream {
+		return nil
+	}
+	responseFormat := ""
+	if request, ok := info.Request.(*dto.ImageRequest); ok {
+		responseFormat = request.ResponseFormat
+	}
+	if !operation_setting.GetImageRehostSetting().Enabled && responseFormat == "" {
+		return nil
+	}
+	writer := &ImageRehostWriter{ResponseWriter: c.Writer, responseFormat: responseFormat}
+	c.Writer = writer
+	return writer
+}
+
+// Finish restores the original writer and sends the buffered response with the images re-hosted.
+func (w *ImageRehostWriter) Finish(c *gin.Context) {
+	c.Writer = w.ResponseWriter
+	body := w.body.Bytes()
+	if w.Status() == http.StatusOK {
+		body = rehostImageResponse(c, body, w.responseFormat)
+	}
+	if c.Writer.Header().Get("Content-Length") != "" {
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	_, _ = c.Writer.Write(body)
+}
+
+func rehostImageResponse(c *gin.Context, body []byte, responseFormat string) []byte {
+	var response map[string]any
+	if err := common.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	data, ok := response["data"].([]any)
+	if !ok {
+		return body
+	}
+	rehostEnabled := operation_setting.GetImageRehostSetting().Enabled
+	changed := false
+	for _, item := range data {
+		image, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		url, _ := image["url"].(string)
+		b64, _ := image["b64_json"].(string)
+		isRemote := strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+		switch {
+		case responseFormat == "b64_json" && b64 == "" && isRemote:
+			_, content, err := GetImageFromUrl(url)
+			if err != nil {
+				logger.LogWarn(c, "failed to download image for b64_json, keep the upstream url: "+err.Error())
+				continue
+			}
+			image["b64_json"] = content
+			delete(image, "url")
+			changed = true
+		case responseFormat == "url" && url == "" && b64 != "":
+			content, err := base64.StdEncoding.DecodeString(b64)
+			if err != nil {
+				logger.LogWarn(c, "failed to decode b64_json image: "+err.Error())
+				continue
+			}
+			hostedURL, err := storeRehostedImage(content)
+			if err != nil {
+				logger.LogWarn(c, "failed to host b64_json image, keep the base64 content: "+err.Error())
+				continue
+			}
+			image["url"] = hostedURL
+			delete(image, "b64_json")
+			changed = true
+		case rehostEnabled && isRemote && !isRehostedImageLink(url):
+			hostedURL, err := rehostImage(url)
+			if err != nil {
+				logger.LogWarn(c, "failed to rehost image, keep the upstream url: "+err.Error())
+				continue
+			}
+			image["url"] = hostedURL
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	rewritten, err := common.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+func rehostImage(url string) (string, error) {
+	setting := operation_setting.GetImageRehostSetting()
+	maxBytes := int64(setting.MaxImageSizeMB) << 20
+	resp, err := DoDownloadRequest(url, "image rehost")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download image failed with status %d", resp.StatusCode)
+	}
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return "", fmt.Errorf("image size %d exceeds the limit of %d MB", resp.ContentLength, setting.MaxImageSizeMB)
+	}
+	reader := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		reader = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return storeRehostedImage(data)
+}
+
+// storeRehostedImage saves the image to the object storage and returns a signed gateway link to it.
+func storeRehostedImage(data []byte) (string, error) {
+	setting := operation_setting.GetImageRehostSetting()
+	if maxBytes := int64(setting.MaxImageSizeMB) << 20; maxBytes > 0 && int64(len(data)) > maxBytes {
+		return "", fmt.Errorf("image exceeds the limit of %d MB", setting.MaxImageSizeMB)
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := rehostedImageExtensions[contentType]
+	if !ok {
+		return "", fmt.Errorf("unsupported image type %s", contentType)
+	}
+
+	store, err := GetStorage()
+	if err != nil {
+		return "", err
+	}
+	name := common.GetUUID() + ext
+	if err = store.Put(context.Background(), rehostedImagePrefix+name, data, contentType); err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().AddDate(0, 0, setting.RetentionDays).Unix()
+	return fmt.Sprintf("%s/api/images/%s?expires=%d&signature=%s",
+		strings.TrimRight(system_setting.ServerAddress, "/"), name, expiresAt, signRehostedImage(name, expiresAt)), nil
+}
+
+func isRehostedImageLink(url string) bool {
+	return strings.HasPrefix(url, strings.TrimRight(system_setting.ServerAddress, "/")+"/api/images/")
+}
+
+func signRehostedImage(name string, expiresAt int64) string {
+	return common.GenerateHMAC(fmt.Sprintf("rehosted_image:%s:%d", name, expiresAt))
+}
+
+// VerifyRehostedImageLink checks the signature and expiry of a re-hosted image link.
+func VerifyRehostedImageLink(name string, expiresAt int64, signature string) error {
+	if !rehostedImageNamePattern.MatchString(name) {
+		return errors.New("invalid image name")
+	}
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(signRehostedImage(name, expiresAt))) != 1 {
+		return errors.New("invalid signature")
+	}
+	if time.Now().Unix() > expiresAt {
+		return errors.New("link expired")
+	}
+	return nil
+}
+
+// OpenRehostedImage returns the content and content type of a re-hosted image.
+func OpenRehostedImage(ctx context.Context, name string) (io.ReadCloser, string, error) {
+	store, err := GetStorage()
+	if err != nil {
+		return nil, "", err
+	}
+	reader, err := store.Get(ctx, rehostedImagePrefix+name)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := "application/octet-stream"
+	for mimeType, ext := range rehostedImageExtensions {
+		if strings.HasSuffix(name, ext) {
+			contentType = mimeType
+		}
+	}
+	return reader, contentType, nil
+}
+
+var imageRehostCleanupOnce sync.Once
+
+// StartImageRehostCleanupTask removes re-hosted images older than the retention period on the master node.
+func StartImageRehostCleanupTask() {
+	imageRehostCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				time.Sleep(time.Hour)
+				setting := operation_setting.GetImageRehostSetting()
+				if setting.RetentionDays <= 0 {
+					continue
+				}
+				removed, err := cleanupRehostedImages(time.Now().AddDate(0, 0, -setting.RetentionDays))
+				if err != nil {
+					logger.LogModuleError(context.Background(), logger.ModuleCleanup, "failed to clean up rehosted images: %s", err.Error())
+				}
+				if removed > 0 {
+					logger.LogModuleInfo(context.Background(), logger.ModuleCleanup, "removed %d expired rehosted images", removed)
+					model.RecordRetentionCleanup("rehosted_image", int64(removed))
+				}
+			}
+		})
+	})
+}
+
+func cleanupRehostedImages(before time.Time) (int, error) {
+	store, err := GetStorage()
+	if err != nil {
+		return 0, err
+	}
+	ctx := context.Background()
+	objects, err := store.List(ctx, rehostedImagePrefix)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, object := range objects {
+		if object.ModTime.After(before) {
+			continue
+		}
+		if err = store.Delete(ctx, object.Key); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
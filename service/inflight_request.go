@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 正在处理的中转请求登记表，管理员可以查看并强制取消某个请求的上游调用，
+// 例如失控的长时间流式请求。登记表只保存在当前节点内存中，多节点部署时需要逐个节点查看。
+
+type InFlightRequest struct {
+	RequestId   string `json:"request_id"`
+	UserId      int    `json:"user_id"`
+	Username    string `json:"username"`
+	TokenName   string `json:"token_name"`
+	Group       string `json:"group"`
+	Model       string `json:"model"`
+	ChannelId   int    `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Path        string `json:"path"`
+	Ip          string `json:"ip"`
+	StartTime   int64  `json:"start_time"`
+	ElapsedMs   int64  `json:"elapsed_ms"`
+	Cancelled   bool   `json:"cancelled"`
+
+	startedAt time.Time
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+var (
+	inFlightRequests   = make(map[string]*InFlightRequest)
+	inFlightRequestsMu sync.RWMutex
+)
+
+// TrackInFlightRequest registers the relay request and returns the function to call when it finishes.
+func TrackInFlightRequest(c *gin.Context, modelName string) func() {
+	requestId := c.GetString(common.RequestIdKey)
+	if requestId == "" {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// 客户端指定了超时时间时，上游调用在截止时间被中断
+	if deadline, ok := GetRequestDeadline(c); ok {
+		ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	}
+	now := time.Now()
+	request := &InFlightRequest{
+		RequestId: requestId,
+		UserId:    c.GetInt("id"),
+		Username:  c.GetString("username"),
+		TokenName: c.GetString("token_name"),
+		Group:     common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		Model:     modelName,
+		Path:      c.Request.URL.Path,
+		Ip:        c.ClientIP(),
+		StartTime: now.Unix(),
+		startedAt: now,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	inFlightRequestsMu.Lock()
+	inFlightRequests[requestId] = request
+	inFlightRequestsMu.Unlock()
+	return func() {
+		inFlightRequestsMu.Lock()
+		delete(inFlightRequests, requestId)
+		inFlightRequestsMu.Unlock()
+		cancel()
+	}
+}
+
+// UpdateInFlightChannel records the channel currently serving the request, it changes on retries.
+func UpdateInFlightChannel(c *gin.Context, channel *model.Channel) {
+	inFlightRequestsMu.Lock()
+	defer inFlightRequestsMu.Unlock()
+	if request, ok := inFlightRequests[c.GetString(common.RequestIdKey)]; ok {
+		request.ChannelId = channel.Id
+		request.ChannelName = channel.Name
+	}
+}
+
+// GetInFlightContext returns the context bound to the upstream call of the request, it is cancelled when
+// an admin cancels the request or the client deadline passes. Client disconnects are still handled through
+// the request context.
+func GetInFlightContext(c *gin.Context) context.Context {
+	inFlightRequestsMu.RLock()
+	defer inFlightRequestsMu.RUnlock()
+	if request, ok := inFlightRequests[c.GetString(common.RequestIdKey)]; ok {
+		return request.ctx
+	}
+	return nil
+}
+
+// ListInFlightRequests returns the requests in progress on this node, the longest running first.
+func ListInFlightRequests() []InFlightRequest {
+	inFlightRequestsMu.RLock()
+	result := make([]InFlightRequest, 0, len(inFlightRequests))
+	for _, request := range inFlightRequests {
+		item := *request
+		item.ElapsedMs = time.Since(request.startedAt).Milliseconds()
+		result = append(result, item)
+	}
+	inFlightRequestsMu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ElapsedMs > result[j].ElapsedMs
+	})
+	return result
+}
+
+// CancelInFlightRequest aborts the upstream call of the request, the relay then finishes and bills
+// what has been produced so far. It returns false when the request is not running on this node.
+func CancelInFlightRequest(requestId string) (*InFlightRequest, bool) {
+	inFlightRequestsMu.Lock()
+	defer inFlightRequestsMu.Unlock()
+	request, ok := inFlightRequests[requestId]
+	if !ok {
+		return nil, false
+	}
+	request.Cancelled = true
+	request.cancel()
+	item := *request
+	item.ElapsedMs = time.Since(request.startedAt).Milliseconds()
+	return &item, true
+}
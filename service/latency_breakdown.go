@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 延迟拆分：记录请求到达、开始选择渠道、选定渠道的时间以及上游连接和首字节耗时，
+// 在响应头写出时以 Server-Timing 返回给客户端，便于区分网关开销和上游慢。
+
+type LatencyBreakdown struct {
+	mu           sync.Mutex
+	arrival      time.Time
+	routingStart time.Time
+	routing      time.Duration
+	connect      time.Duration
+	ttfb         time.Duration
+	upstream     bool
+}
+
+// StartLatencyBreakdown starts recording the timings of the request when latency headers are enabled.
+func StartLatencyBreakdown(c *gin.Context) *LatencyBreakdown {
+	if !operation_setting.LatencyHeadersEnabled {
+		return nil
+	}
+	breakdown := &LatencyBreakdown{arrival: time.Now()}
+	common.SetContextKey(c, constant.ContextKeyLatencyBreakdown, breakdown)
+	return breakdown
+}
+
+func getLatencyBreakdown(c *gin.Context) *LatencyBreakdown {
+	if c == nil {
+		return nil
+	}
+	breakdown, _ := common.GetContextKeyType[*LatencyBreakdown](c, constant.ContextKeyLatencyBreakdown)
+	return breakdown
+}
+
+// MarkLatencyRoutingStart marks the end of the queue stage, the time before it is spent in authentication
+// and rate limiting.
+func MarkLatencyRoutingStart(c *gin.Context) {
+	if breakdown := getLatencyBreakdown(c); breakdown != nil {
+		breakdown.mu.Lock()
+		if breakdown.routingStart.IsZero() {
+			breakdown.routingStart = time.Now()
+		}
+		breakdown.mu.Unlock()
+	}
+}
+
+// AddLatencyRouting adds the time spent selecting a channel, retries add up.
+func AddLatencyRouting(c *gin.Context, d time.Duration) {
+	if breakdown := getLatencyBreakdown(c); breakdown != nil {
+		breakdown.mu.Lock()
+		breakdown.routing += d
+		breakdown.mu.Unlock()
+	}
+}
+
+// SetLatencyUpstream records the connect time and time to first byte of the latest upstream attempt.
+func SetLatencyUpstream(c *gin.Context, connect time.Duration, ttfb time.Duration) {
+	if breakdown := getLatencyBreakdown(c); breakdown != nil {
+		breakdown.mu.Lock()
+		breakdown.connect = connect
+		breakdown.ttfb = ttfb
+		breakdown.upstream = true
+		breakdown.mu.Unlock()
+	}
+}
+
+// HasLatencyBreakdown reports whether the timings of the request are being recorded.
+func HasLatencyBreakdown(c *gin.Context) bool {
+	return getLatencyBreakdown(c) != nil
+}
+
+// ServerTiming formats the timings known so far as a Server-Timing header value in milliseconds.
+func (b *LatencyBreakdown) ServerTiming() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	metrics := make([]string, 0, 5)
+	add := func(name string, d time.Duration) {
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%.1f", name, float64(d.Microseconds())/1000))
+	}
+	if !b.routingStart.IsZero() {
+		add("queue", b.routingStart.Sub(b.arrival))
+		add("routing", b.routing)
+	}
+	if b.upstream {
+		add("connect", b.connect)
+		add("ttfb", b.ttfb)
+	}
+	add("total", time.Since(b.arrival))
+	return strings.Join(metrics, ", ")
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -41,6 +42,9 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	other["cache_ratio"] = cacheRatio
 	other["model_price"] = modelPrice
 	other["user_group_ratio"] = userGroupRatio
+	if relayInfo.PriceData.PriceSource != "" {
+		other["price_source"] = relayInfo.PriceData.PriceSource
+	}
 	other["frt"] = float64(relayInfo.FirstResponseTime.UnixMilli() - relayInfo.StartTime.UnixMilli())
 	if relayInfo.ReasoningEffort != "" {
 		other["reasoning_effort"] = relayInfo.ReasoningEffort
@@ -50,6 +54,40 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if batchId := common.GetContextKeyString(ctx, constant.ContextKeyBatchId); batchId != "" {
+		other["batch_id"] = batchId
+	}
+	if responseId := common.GetContextKeyString(ctx, constant.ContextKeyBackgroundResponseId); responseId != "" {
+		other["background_response_id"] = responseId
+	}
+	if decision, ok := common.GetContextKeyType[*ContentFilterFallbackDecision](ctx, constant.ContextKeyContentFilterFallback); ok {
+		other["content_filter_fallback"] = decision
+	}
+	if streamErrorCode := common.GetContextKeyString(ctx, constant.ContextKeyStreamErrorCode); streamErrorCode != "" {
+		other["stream_error_code"] = streamErrorCode
+	}
+	if modelAlias := common.GetContextKeyString(ctx, constant.ContextKeyModelAlias); modelAlias != "" {
+		other["model_alias"] = modelAlias
+	}
+	if arm := common.GetContextKeyString(ctx, constant.ContextKeyTrafficSplitArm); arm != "" {
+		other["traffic_split"] = arm
+	}
+	if mirrorChannelId := common.GetContextKeyInt(ctx, constant.ContextKeyTrafficMirrorChannelId); mirrorChannelId != 0 {
+		other["mirror_channel_id"] = mirrorChannelId
+	}
+	if stopReason := common.GetContextKeyString(ctx, constant.ContextKeyToolLoopStopReason); stopReason != "" {
+		other["tool_loop_stop"] = stopReason
+	}
+	if paths := common.GetContextKeyStringSlice(ctx, constant.ContextKeyRequestDefaults); len(paths) > 0 {
+		other["request_defaults"] = paths
+	}
+	if common.GetContextKeyBool(ctx, constant.ContextKeyToolCallEmulation) {
+		other["tool_call_emulation"] = true
+	}
+	if common.GetContextKeyBool(ctx, constant.ContextKeyNativePassthrough) {
+		other["native_passthrough"] = true
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
@@ -69,9 +107,11 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	}
 
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
+	appendUpstreamMetadata(relayInfo, other, adminInfo)
 
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
+	AppendRegionInfo(ctx, other)
 	appendRequestConversionChain(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
 	return other
@@ -85,7 +125,10 @@ func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interf
 	if relayInfo.BillingSource != "" {
 		other["billing_source"] = relayInfo.BillingSource
 	}
-	if relayInfo.UserSetting.BillingPreference != "" {
+	if relayInfo.BillingPreference != "" {
+		other["billing_preference"] = relayInfo.BillingPreference
+		other["billing_preference_source"] = relayInfo.BillingPreferenceSource
+	} else if relayInfo.UserSetting.BillingPreference != "" {
 		other["billing_preference"] = relayInfo.UserSetting.BillingPreference
 	}
 	if relayInfo.BillingSource == "subscription" {
@@ -168,9 +211,23 @@ func GenerateWssOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 	info["text_output"] = usage.OutputTokenDetails.TextTokens
 	info["audio_ratio"] = audioRatio
 	info["audio_completion_ratio"] = audioCompletionRatio
+	if usage.InputAudioSeconds > 0 {
+		info["audio_input_seconds"] = usage.InputAudioSeconds
+	}
+	appendAudioPriceInfo(info, relayInfo.OriginModelName, usage.InputAudioSeconds)
 	return info
 }
 
+// appendAudioPriceInfo 记录按秒计费的输入音频和单独定价的输出音频，便于日志和统计区分这两个计费维度
+func appendAudioPriceInfo(info map[string]interface{}, modelName string, inputAudioSeconds float64) {
+	if price, ok := ratio_setting.GetAudioInputSecondPrice(modelName); ok && inputAudioSeconds > 0 {
+		info["audio_input_second_price"] = price
+	}
+	if price, ok := ratio_setting.GetAudioOutputTokenPrice(modelName); ok {
+		info["audio_output_token_price"] = price
+	}
+}
+
 func GenerateAudioOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, modelRatio, groupRatio, completionRatio, audioRatio, audioCompletionRatio, modelPrice, userGroupRatio float64) map[string]interface{} {
 	info := GenerateTextOtherInfo(ctx, relayInfo, modelRatio, groupRatio, completionRatio, 0, 0.0, modelPrice, userGroupRatio)
 	info["audio"] = true
@@ -180,6 +237,7 @@ func GenerateAudioOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	info["text_output"] = usage.CompletionTokenDetails.TextTokens
 	info["audio_ratio"] = audioRatio
 	info["audio_completion_ratio"] = audioCompletionRatio
+	appendAudioPriceInfo(info, relayInfo.OriginModelName, 0)
 	return info
 }
 
@@ -211,6 +269,9 @@ func GenerateMjOtherInfo(relayInfo *relaycommon.RelayInfo, priceData types.PerCa
 	if priceData.GroupRatioInfo.HasSpecialRatio {
 		other["user_group_ratio"] = priceData.GroupRatioInfo.GroupSpecialRatio
 	}
+	if priceData.PriceSource != "" {
+		other["price_source"] = priceData.PriceSource
+	}
 	appendRequestPath(nil, relayInfo, other)
 	return other
 }
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ErrModelNotVisible = errors.New("model is not available for the group")
+
+// ModelVisibilityGroup 模型可见性按令牌使用的分组判断，auto 分组按用户分组判断
+func ModelVisibilityGroup(c *gin.Context, usingGroup string) string {
+	if usingGroup == "auto" {
+		return common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	}
+	return usingGroup
+}
+
+// ResolveRequestModel applies the rewrite rules to the requested model and checks that the group may use
+// the result. The resolved name is returned together with the alias it names, if any; the name requested
+// by the client is kept in the context for the log when it differs from the model actually used.
+func ResolveRequestModel(c *gin.Context, usingGroup string, modelName string) (string, *operation_setting.ModelAlias, error) {
+	setting := operation_setting.GetModelAliasSetting()
+	if !setting.Enabled {
+		return modelName, nil, nil
+	}
+	resolved := setting.RewriteModel(modelName)
+	if !setting.IsModelVisible(ModelVisibilityGroup(c, usingGroup), resolved) {
+		return resolved, nil, ErrModelNotVisible
+	}
+	alias := setting.GetAlias(resolved)
+	if resolved != modelName || alias != nil {
+		common.SetContextKey(c, constant.ContextKeyModelAlias, modelName)
+	}
+	if resolved != modelName {
+		logger.LogDebug(c, "model %s rewritten to %s", modelName, resolved)
+	}
+	return resolved, alias, nil
+}
+
+// GetRequestModelAlias returns the alias the request is routed through, so retries keep walking its chain.
+func GetRequestModelAlias(c *gin.Context) *operation_setting.ModelAlias {
+	requested := common.GetContextKeyString(c, constant.ContextKeyModelAlias)
+	setting := operation_setting.GetModelAliasSetting()
+	if requested == "" || !setting.Enabled {
+		return nil
+	}
+	return setting.GetAlias(setting.RewriteModel(requested))
+}
+
+// SelectModelAliasChannel selects a channel for the alias, walking its targets in order from the one the
+// previous attempt used. A target is left for the next one when it has no available channel or, like the
+// groups of the auto group, once its retries are used up; a target pinned to a channel is only tried once.
+// param.ModelName is set to the model of the selected target.
+func SelectModelAliasChannel(param *RetryParam, alias *operation_setting.ModelAlias) (*model.Channel, string, error) {
+	start := common.GetContextKeyInt(param.Ctx, constant.ContextKeyModelAliasTargetIndex)
+	var lastErr error
+	for i := start; i < len(alias.Targets); i++ {
+		target := alias.Targets[i]
+		if i > start {
+			param.SetRetry(0)
+		}
+		param.ModelName = target.Model
+		channel, selectGroup, err := selectModelAliasTarget(param, target)
+		if err != nil {
+			lastErr = err
+		}
+		if channel == nil {
+			logger.LogDebug(param.Ctx, "No available channel for target %s of model alias %s, trying next target", target.Model, alias.Alias)
+			continue
+		}
+		common.SetContextKey(param.Ctx, constant.ContextKeyModelAliasTargetIndex, i)
+		if i+1 < len(alias.Targets) && (target.ChannelId != 0 || param.GetRetry() >= common.RetryTimes) {
+			// 本次仍使用当前目标，下次重试切换到下一个目标
+			common.SetContextKey(param.Ctx, constant.ContextKeyModelAliasTargetIndex, i+1)
+			param.SetRetry(0)
+			param.ResetRetryNextTry()
+		}
+		return channel, selectGroup, nil
+	}
+	if lastErr != nil {
+		return nil, param.TokenGroup, lastErr
+	}
+	return nil, param.TokenGroup, fmt.Errorf("no available channel for any target of model alias %s", alias.Alias)
+}
+
+func selectModelAliasTarget(param *RetryParam, target operation_setting.ModelAliasTarget) (*model.Channel, string, error) {
+	if target.ChannelId == 0 {
+		return CacheGetRandomSatisfiedChannel(param)
+	}
+	channel, selectGroup := GetPinnedChannel(param.Ctx, param.TokenGroup, target.Model, target.ChannelId)
+	return channel, selectGroup, nil
+}
+
+// GetPinnedChannel returns the channel when it is enabled and serves the model in the group, or in one of the
+// groups of the auto group, and satisfies the compliance requirements of that group. Users' own channels (BYOK)
+// are never returned, they are only used through the owner's tokens.
+func GetPinnedChannel(c *gin.Context, tokenGroup string, modelName string, channelId int) (*model.Channel, string) {
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil || channel == nil || channel.Status != common.ChannelStatusEnabled || channel.IsPrivate() {
+		return nil, tokenGroup
+	}
+	groups := []string{tokenGroup}
+	if tokenGroup == "auto" {
+		groups = GetUserAutoGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup))
+	}
+	for _, group := range groups {
+		if model.IsChannelEnabledForGroupModel(group, modelName, channel.Id) && ChannelSatisfiesCompliance(c, channel, group) {
+			if tokenGroup == "auto" {
+				common.SetContextKey(c, constant.ContextKeyAutoGroup, group)
+			}
+			return channel, group
+		}
+	}
+	return nil, tokenGroup
+}
+
+// FilterVisibleModels 去掉分组不可见的模型，并加入至少一个目标在 models 中的别名
+func FilterVisibleModels(visibilityGroup string, models []string) []string {
+	setting := operation_setting.GetModelAliasSetting()
+	if !setting.Enabled {
+		return models
+	}
+	visible := make([]string, 0, len(models))
+	for _, modelName := range models {
+		if setting.IsModelVisible(visibilityGroup, modelName) {
+			visible = append(visible, modelName)
+		}
+	}
+	for _, alias := range setting.Aliases {
+		if common.StringsContains(visible, alias.Alias) || !setting.IsModelVisible(visibilityGroup, alias.Alias) {
+			continue
+		}
+		for _, target := range alias.Targets {
+			if common.StringsContains(models, target.Model) {
+				visible = append(visible, alias.Alias)
+				break
+			}
+		}
+	}
+	return visible
+}
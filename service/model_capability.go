@@ -0,0 +1,52 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// CheckModelCapability rejects requests the model can never serve, e.g. a prompt longer than its context
+// window or an image sent to a text-only model, before any quota is pre-consumed or upstream is called.
+// Input types and tools are only known when token counting builds the full meta.
+func CheckModelCapability(relayInfo *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) *types.NewAPIError {
+	if !model_setting.GetModelCapabilitySettings().Enabled || meta == nil {
+		return nil
+	}
+	modelName := relayInfo.OriginModelName
+	capability, ok := model_setting.GetModelCapability(modelName)
+	if !ok {
+		return nil
+	}
+
+	if capability.MaxOutputTokens > 0 && meta.MaxTokens > capability.MaxOutputTokens {
+		return modelCapabilityError(fmt.Errorf("max_tokens is too large: %d. Model %s supports at most %d completion tokens",
+			meta.MaxTokens, modelName, capability.MaxOutputTokens))
+	}
+	if capability.ContextWindow > 0 && promptTokens+meta.MaxTokens > capability.ContextWindow {
+		if meta.MaxTokens > 0 {
+			return modelCapabilityError(fmt.Errorf("model %s's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion)",
+				modelName, capability.ContextWindow, promptTokens+meta.MaxTokens, promptTokens, meta.MaxTokens))
+		}
+		return modelCapabilityError(fmt.Errorf("model %s's maximum context length is %d tokens. However, your messages resulted in %d tokens",
+			modelName, capability.ContextWindow, promptTokens))
+	}
+	for _, file := range meta.Files {
+		if !capability.SupportsModality(string(file.FileType)) {
+			return modelCapabilityError(fmt.Errorf("model %s does not support %s input", modelName, file.FileType))
+		}
+	}
+	if meta.ToolsCount > 0 && capability.ToolCall != nil && !*capability.ToolCall &&
+		!operation_setting.GetToolCallEmulationSetting().ShouldEmulate(modelName, capability.ToolCall) {
+		return modelCapabilityError(fmt.Errorf("model %s does not support tool calls", modelName))
+	}
+	return nil
+}
+
+func modelCapabilityError(err error) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(err, types.ErrorCodeModelCapabilityExceeded, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// 模型广场：汇总对外开放的模型的描述、能力、上下文长度和各分组的当前价格，支持搜索和分类筛选。
+// 价格按用户可用的分组计算，未登录时只展示公开的可用分组。
+
+// CatalogGroupPrice 模型在某个分组下的价格，按 token 计费时单位为美元/百万 token，按次计费时为美元/次
+type CatalogGroupPrice struct {
+	Group            string  `json:"group"`
+	GroupRatio       float64 `json:"group_ratio"`
+	InputPerMillion  float64 `json:"input_per_million,omitempty"`
+	OutputPerMillion float64 `json:"output_per_million,omitempty"`
+	PerRequest       float64 `json:"per_request,omitempty"`
+}
+
+type CatalogModel struct {
+	ModelName       string                  `json:"model_name"`
+	Description     string                  `json:"description,omitempty"`
+	Icon            string                  `json:"icon,omitempty"`
+	Tags            []string                `json:"tags"`
+	Vendor          string                  `json:"vendor,omitempty"`
+	Category        string                  `json:"category,omitempty"`
+	Endpoints       []constant.EndpointType `json:"endpoints"`
+	ContextWindow   int                     `json:"context_window,omitempty"`
+	MaxOutputTokens int                     `json:"max_output_tokens,omitempty"`
+	Modalities      []string                `json:"modalities,omitempty"`
+	ToolCall        *bool                   `json:"tool_call,omitempty"`
+	JSONMode        *bool                   `json:"json_mode,omitempty"`
+	QuotaType       int                     `json:"quota_type"`
+	Prices          []CatalogGroupPrice     `json:"prices"`
+}
+
+// CatalogFacets 可用于筛选的取值
+type CatalogFacets struct {
+	Vendors    []string `json:"vendors"`
+	Tags       []string `json:"tags"`
+	Categories []string `json:"categories"`
+	Groups     []string `json:"groups"`
+}
+
+// CatalogQuery 模型广场的筛选条件，空值表示不筛选
+type CatalogQuery struct {
+	Keyword  string
+	Vendor   string
+	Tag      string
+	Category string
+	Group    string
+	Modality string
+	Endpoint string
+	ToolCall bool
+}
+
+// catalogGroupRatios returns the groups the user can use with their ratios, the same way the pricing page does.
+func catalogGroupRatios(userGroup string) map[string]float64 {
+	usableGroups := GetUserUsableGroups(userGroup)
+	groupRatios := make(map[string]float64)
+	for group, ratio := range ratio_setting.GetGroupRatioCopy() {
+		if _, ok := usableGroups[group]; !ok {
+			continue
+		}
+		if userGroup != "" {
+			if groupRatio, ok := ratio_setting.GetGroupGroupRatio(userGroup, group); ok {
+				ratio = groupRatio
+			}
+		}
+		groupRatios[group] = ratio
+	}
+	return groupRatios
+}
+
+// GetModelCatalog returns the models matching the query and the facets of all models visible to the user.
+func GetModelCatalog(userGroup string, query CatalogQuery) ([]CatalogModel, CatalogFacets) {
+	groupRatios := catalogGroupRatios(userGroup)
+	vendorNames := make(map[int]string)
+	for _, vendor := range model.GetVendors() {
+		vendorNames[vendor.ID] = vendor.Name
+	}
+
+	vendors := make(map[string]bool)
+	tags := make(map[string]bool)
+	categories := make(map[string]bool)
+	groups := make(map[string]bool)
+	result := make([]CatalogModel, 0)
+	for _, pricing := range model.GetPricing() {
+		item := CatalogModel{
+			ModelName:   pricing.ModelName,
+			Description: pricing.Description,
+			Icon:        pricing.Icon,
+			Tags:        make([]string, 0),
+			Vendor:      vendorNames[pricing.VendorID],
+			Category:    operation_setting.GetModelClass(pricing.ModelName),
+			Endpoints:   pricing.SupportedEndpointTypes,
+			QuotaType:   pricing.QuotaType,
+			Prices:      make([]CatalogGroupPrice, 0),
+		}
+		for _, tag := range strings.Split(pricing.Tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+		if capability, ok := model_setting.GetModelCapability(pricing.ModelName); ok {
+			item.ContextWindow = capability.ContextWindow
+			item.MaxOutputTokens = capability.MaxOutputTokens
+			item.Modalities = capability.Modalities
+			item.ToolCall = capability.ToolCall
+			item.JSONMode = capability.JSONMode
+		}
+		for _, group := range pricing.EnableGroup {
+			ratio, ok := groupRatios[group]
+			if !ok {
+				continue
+			}
+			price := CatalogGroupPrice{Group: group, GroupRatio: ratio}
+			if pricing.QuotaType == 1 {
+				price.PerRequest = pricing.ModelPrice * ratio
+			} else {
+				price.InputPerMillion = pricing.ModelRatio * 1000000 / common.QuotaPerUnit * ratio
+				price.OutputPerMillion = price.InputPerMillion * pricing.CompletionRatio
+			}
+			item.Prices = append(item.Prices, price)
+		}
+		// 用户没有可用分组的模型不展示
+		if len(item.Prices) == 0 {
+			continue
+		}
+		sort.Slice(item.Prices, func(i, j int) bool {
+			return item.Prices[i].Group < item.Prices[j].Group
+		})
+
+		if item.Vendor != "" {
+			vendors[item.Vendor] = true
+		}
+		for _, tag := range item.Tags {
+			tags[tag] = true
+		}
+		if item.Category != "" {
+			categories[item.Category] = true
+		}
+		for _, price := range item.Prices {
+			groups[price.Group] = true
+		}
+		if query.matches(&item) {
+			result = append(result, item)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ModelName < result[j].ModelName
+	})
+	return result, CatalogFacets{
+		Vendors:    sortedKeys(vendors),
+		Tags:       sortedKeys(tags),
+		Categories: sortedKeys(categories),
+		Groups:     sortedKeys(groups),
+	}
+}
+
+func (q CatalogQuery) matches(item *CatalogModel) bool {
+	if keyword := strings.ToLower(strings.TrimSpace(q.Keyword)); keyword != "" {
+		text := strings.ToLower(item.ModelName + " " + item.Description + " " + strings.Join(item.Tags, " ") + " " + item.Vendor)
+		if !strings.Contains(text, keyword) {
+			return false
+		}
+	}
+	if q.Vendor != "" && !strings.EqualFold(item.Vendor, q.Vendor) {
+		return false
+	}
+	if q.Tag != "" && !slices.Contains(item.Tags, q.Tag) {
+		return false
+	}
+	if q.Category != "" && item.Category != q.Category {
+		return false
+	}
+	if q.Group != "" {
+		found := false
+		for _, price := range item.Prices {
+			if price.Group == q.Group {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	// 筛选输入类型时只返回明确配置了该类型的模型
+	if q.Modality != "" && !slices.Contains(item.Modalities, q.Modality) {
+		return false
+	}
+	if q.Endpoint != "" && !slices.Contains(item.Endpoints, constant.EndpointType(q.Endpoint)) {
+		return false
+	}
+	if q.ToolCall && (item.ToolCall == nil || !*item.ToolCall) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelClassQuota 用户在当前周期内某个模型类别的限额和用量
+type ModelClassQuota struct {
+	ModelClass string `json:"model_class"`
+	Period     string `json:"period"`
+	PeriodKey  string `json:"period_key"`
+	Limit      int64  `json:"limit"`
+	UsedTokens int64  `json:"used_tokens"`
+}
+
+// CheckModelClassQuota rejects the request when the user's token quota for the class of the requested model
+// is used up, or would be by the estimated prompt tokens.
+func CheckModelClassQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, promptTokens int) *types.NewAPIError {
+	if !operation_setting.GetModelClassSetting().Enabled {
+		return nil
+	}
+	class := operation_setting.GetModelClass(relayInfo.OriginModelName)
+	if class == "" {
+		return nil
+	}
+	limit, limited := operation_setting.GetModelClassLimit(relayInfo.UserGroup, class)
+	if !limited {
+		return nil
+	}
+	periodKey := operation_setting.ModelClassPeriodKey(limit.Period, time.Now())
+	used, err := model.GetModelClassUsedTokens(relayInfo.UserId, class, periodKey)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if used >= limit.Tokens || used+int64(promptTokens) > limit.Tokens {
+		logger.LogInfo(c, fmt.Sprintf("user %d model class %s quota exceeded: used %d, limit %d", relayInfo.UserId, class, used, limit.Tokens))
+		return types.NewErrorWithStatusCode(
+			fmt.Errorf("模型类别 %s 的 token 额度已用尽（%d/%d），请等待额度重置或使用其他模型", class, used, limit.Tokens),
+			types.ErrorCodeModelClassQuotaExceeded,
+			http.StatusForbidden,
+			types.ErrOptionWithSkipRetry(),
+		)
+	}
+	return nil
+}
+
+// RecordModelClassUsage adds the tokens of a finished request to the user's usage of the model's class.
+func RecordModelClassUsage(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, tokens int) {
+	if tokens <= 0 || !operation_setting.GetModelClassSetting().Enabled {
+		return
+	}
+	class := operation_setting.GetModelClass(relayInfo.OriginModelName)
+	if class == "" {
+		return
+	}
+	limit, _ := operation_setting.GetModelClassLimit(relayInfo.UserGroup, class)
+	periodKey := operation_setting.ModelClassPeriodKey(limit.Period, time.Now())
+	if err := model.IncreaseModelClassUsage(relayInfo.UserId, class, periodKey, int64(tokens)); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to record model class usage: user %d, class %s, error: %s", relayInfo.UserId, class, err.Error()))
+	}
+}
+
+// GetUserModelClassQuotas returns the limit and current usage of every limited class for the user group.
+func GetUserModelClassQuotas(userId int, group string) ([]ModelClassQuota, error) {
+	quotas := make([]ModelClassQuota, 0)
+	if !operation_setting.GetModelClassSetting().Enabled {
+		return quotas, nil
+	}
+	now := time.Now()
+	for class := range operation_setting.GetModelClassSetting().GroupLimits[group] {
+		limit, limited := operation_setting.GetModelClassLimit(group, class)
+		if !limited {
+			continue
+		}
+		periodKey := operation_setting.ModelClassPeriodKey(limit.Period, now)
+		used, err := model.GetModelClassUsedTokens(userId, class, periodKey)
+		if err != nil {
+			return nil, err
+		}
+		period := limit.Period
+		if period == "" {
+			period = operation_setting.ModelClassPeriodMonth
+		}
+		quotas = append(quotas, ModelClassQuota{
+			ModelClass: class,
+			Period:     period,
+			PeriodKey:  periodKey,
+			Limit:      limit.Tokens,
+			UsedTokens: used,
+		})
+	}
+	return quotas, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	AutoscalingEventThresholdExceeded  = "threshold_exceeded"
+	AutoscalingEventThresholdRecovered = "threshold_recovered"
+)
+
+// ModelDemand is this node's view of the demand for a model.
+type ModelDemand struct {
+	Model string `json:"model"`
+	// InFlightRequests 正在处理的请求数
+	InFlightRequests int64 `json:"in_flight_requests"`
+	// QueueDepth 已转发但尚未收到上游首个响应的请求数
+	QueueDepth int64 `json:"queue_depth"`
+	// TokensInFlight 正在处理的请求的预估 token 数（输入 + 最大输出）
+	TokensInFlight int64 `json:"tokens_in_flight"`
+}
+
+type modelDemandCounter struct {
+	inFlight atomic.Int64
+	queued   atomic.Int64
+	tokens   atomic.Int64
+}
+
+var modelDemandCounters sync.Map // model name -> *modelDemandCounter
+
+// DemandTicket tracks a single request in the model demand counters.
+type DemandTicket struct {
+	counter   *modelDemandCounter
+	tokens    int64
+	responded atomic.Bool
+	done      atomic.Bool
+}
+
+// TrackModelDemand registers a request for the model, Done must be called when it finishes.
+func TrackModelDemand(model string, tokens int) *DemandTicket {
+	value, _ := modelDemandCounters.LoadOrStore(model, &modelDemandCounter{})
+	counter := value.(*modelDemandCounter)
+	ticket := &DemandTicket{counter: counter, tokens: int64(tokens)}
+	counter.inFlight.Add(1)
+	counter.queued.Add(1)
+	counter.tokens.Add(ticket.tokens)
+	return ticket
+}
+
+// MarkResponding removes the request from the queue once the upstream started responding.
+func (t *DemandTicket) MarkResponding() {
+	if t == nil || t.done.Load() || !t.responded.CompareAndSwap(false, true) {
+		return
+	}
+	t.counter.queued.Add(-1)
+}
+
+func (t *DemandTicket) Done() {
+	if t == nil || !t.done.CompareAndSwap(false, true) {
+		return
+	}
+	if !t.responded.Load() {
+		t.counter.queued.Add(-1)
+	}
+	t.counter.inFlight.Add(-1)
+	t.counter.tokens.Add(-t.tokens)
+}
+
+// GetModelDemands returns the current demand of every model seen by this node, sorted by model name.
+func GetModelDemands() []ModelDemand {
+	demands := make([]ModelDemand, 0)
+	modelDemandCounters.Range(func(key, value any) bool {
+		counter := value.(*modelDemandCounter)
+		demands = append(demands, ModelDemand{
+			Model:            key.(string),
+			InFlightRequests: counter.inFlight.Load(),
+			QueueDepth:       counter.queued.Load(),
+			TokensInFlight:   counter.tokens.Load(),
+		})
+		return true
+	})
+	sort.Slice(demands, func(i, j int) bool {
+		return demands[i].Model < demands[j].Model
+	})
+	return demands
+}
+
+// AutoscalingSignalPayload webhook 推送的扩缩容信号
+type AutoscalingSignalPayload struct {
+	Type      string                                 `json:"type"`
+	Event     string                                 `json:"event"`
+	Node      string                                 `json:"node"`
+	Region    string                                 `json:"region,omitempty"`
+	Demand    ModelDemand                            `json:"demand"`
+	Threshold operation_setting.AutoscalingThreshold `json:"threshold"`
+	Timestamp int64                                  `json:"timestamp"`
+}
+
+func exceedsAutoscalingThreshold(demand ModelDemand, threshold operation_setting.AutoscalingThreshold) bool {
+	if threshold.QueueDepth > 0 && demand.QueueDepth >= threshold.QueueDepth {
+		return true
+	}
+	if threshold.TokensInFlight > 0 && demand.TokensInFlight >= threshold.TokensInFlight {
+		return true
+	}
+	return false
+}
+
+var autoscalingSignalOnce sync.Once
+
+// StartAutoscalingSignalTask pushes a webhook whenever a model's demand crosses its threshold.
+// Every node tracks its own demand, so the task runs on all nodes.
+func StartAutoscalingSignalTask() {
+	autoscalingSignalOnce.Do(func() {
+		gopool.Go(func() {
+			node, _ := os.Hostname()
+			exceeded := make(map[string]bool)
+			for {
+				setting := operation_setting.GetAutoscalingSetting()
+				interval := setting.CheckIntervalSeconds
+				if interval <= 0 {
+					interval = 10
+				}
+				time.Sleep(time.Duration(interval) * time.Second)
+				if !setting.WebhookEnabled || setting.WebhookURL == "" {
+					continue
+				}
+				for _, demand := range GetModelDemands() {
+					threshold := operation_setting.GetAutoscalingThreshold(demand.Model)
+					above := exceedsAutoscalingThreshold(demand, threshold)
+					if above == exceeded[demand.Model] {
+						continue
+					}
+					exceeded[demand.Model] = above
+					event := AutoscalingEventThresholdRecovered
+					if above {
+						event = AutoscalingEventThresholdExceeded
+					}
+					sendAutoscalingSignal(setting.WebhookURL, setting.WebhookSecret, AutoscalingSignalPayload{
+						Type:      "autoscaling_signal",
+						Event:     event,
+						Node:      node,
+						Region:    common.NodeRegion,
+						Demand:    demand,
+						Threshold: threshold,
+						Timestamp: time.Now().Unix(),
+					})
+				}
+			}
+		})
+	})
+}
+
+func sendAutoscalingSignal(webhookURL string, secret string, payload AutoscalingSignalPayload) {
+	payloadBytes, err := common.Marshal(payload)
+	if err != nil {
+		return
+	}
+	if err = postWebhookPayload(webhookURL, secret, payloadBytes); err != nil {
+		logger.LogError(context.Background(), fmt.Sprintf("failed to send autoscaling signal for model %s: %s", payload.Demand.Model, err.Error()))
+	}
+}
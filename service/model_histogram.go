@@ -0,0 +1,187 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 按模型统计 prompt tokens、completion tokens 和请求体大小的分布，用于容量规划。
+// 桶边界固定，与 Prometheus histogram 一致采用累计计数（le）。
+
+var (
+	tokenHistogramBuckets = []float64{16, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+	sizeHistogramBuckets  = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+)
+
+const (
+	HistogramPromptTokens     = "prompt_tokens"
+	HistogramCompletionTokens = "completion_tokens"
+	HistogramRequestBodyBytes = "request_body_bytes"
+)
+
+type HistogramBucket struct {
+	Le    float64 `json:"le"`
+	Count uint64  `json:"count"` // 小于等于 Le 的累计数量
+}
+
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64 // 非累计，最后一个为 +Inf
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	idx := sort.SearchFloat64s(h.bounds, v)
+	h.counts[idx]++
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{Buckets: make([]HistogramBucket, 0, len(h.bounds)), Count: h.count, Sum: h.sum}
+	var cumulative uint64
+	for i, le := range h.bounds {
+		cumulative += h.counts[i]
+		s.Buckets = append(s.Buckets, HistogramBucket{Le: le, Count: cumulative})
+	}
+	return s
+}
+
+type modelHistograms struct {
+	promptTokens     *histogram
+	completionTokens *histogram
+	requestBodyBytes *histogram
+}
+
+var (
+	modelHistogramsLock sync.Mutex
+	modelHistogramsMap  = make(map[string]*modelHistograms)
+)
+
+// ObserveModelUsage records the prompt/completion tokens and request body size of a finished request.
+func ObserveModelUsage(c *gin.Context, relayInfo *relaycommon.RelayInfo, promptTokens int, completionTokens int) {
+	modelName := relayInfo.OriginModelName
+	if modelName == "" {
+		return
+	}
+	bodySize := requestBodySize(c)
+	observeRelayTokenMetrics(relayInfo, promptTokens, completionTokens)
+
+	modelHistogramsLock.Lock()
+	defer modelHistogramsLock.Unlock()
+	h, ok := modelHistogramsMap[modelName]
+	if !ok {
+		h = &modelHistograms{
+			promptTokens:     newHistogram(tokenHistogramBuckets),
+			completionTokens: newHistogram(tokenHistogramBuckets),
+			requestBodyBytes: newHistogram(sizeHistogramBuckets),
+		}
+		modelHistogramsMap[modelName] = h
+	}
+	h.promptTokens.observe(float64(promptTokens))
+	h.completionTokens.observe(float64(completionTokens))
+	if bodySize >= 0 {
+		h.requestBodyBytes.observe(float64(bodySize))
+	}
+}
+
+func requestBodySize(c *gin.Context) int64 {
+	if c == nil {
+		return -1
+	}
+	if storage, exists := c.Get(common.KeyBodyStorage); exists && storage != nil {
+		if bs, ok := storage.(common.BodyStorage); ok {
+			return bs.Size()
+		}
+	}
+	if cached, exists := c.Get(common.KeyRequestBody); exists && cached != nil {
+		if b, ok := cached.([]byte); ok {
+			return int64(len(b))
+		}
+	}
+	if c.Request != nil && c.Request.ContentLength >= 0 {
+		return c.Request.ContentLength
+	}
+	return -1
+}
+
+// GetModelHistograms returns model -> metric -> histogram snapshot since the process started.
+func GetModelHistograms() map[string]map[string]HistogramSnapshot {
+	modelHistogramsLock.Lock()
+	defer modelHistogramsLock.Unlock()
+	result := make(map[string]map[string]HistogramSnapshot, len(modelHistogramsMap))
+	for modelName, h := range modelHistogramsMap {
+		result[modelName] = map[string]HistogramSnapshot{
+			HistogramPromptTokens:     h.promptTokens.snapshot(),
+			HistogramCompletionTokens: h.completionTokens.snapshot(),
+			HistogramRequestBodyBytes: h.requestBodyBytes.snapshot(),
+		}
+	}
+	return result
+}
+
+// WriteModelHistogramMetrics writes the histograms in the Prometheus text exposition format.
+func WriteModelHistogramMetrics(w io.Writer) error {
+	histograms := GetModelHistograms()
+	models := make([]string, 0, len(histograms))
+	for modelName := range histograms {
+		models = append(models, modelName)
+	}
+	sort.Strings(models)
+
+	metrics := []struct {
+		key  string
+		name string
+		help string
+	}{
+		{HistogramPromptTokens, "newapi_request_prompt_tokens", "Prompt tokens per request."},
+		{HistogramCompletionTokens, "newapi_request_completion_tokens", "Completion tokens per request."},
+		{HistogramRequestBodyBytes, "newapi_request_body_bytes", "Request body size in bytes."},
+	}
+	var sb strings.Builder
+	for _, metric := range metrics {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s histogram\n", metric.name, metric.help, metric.name)
+		for _, modelName := range models {
+			s := histograms[modelName][metric.key]
+			label := escapePrometheusLabel(modelName)
+			for _, bucket := range s.Buckets {
+				fmt.Fprintf(&sb, "%s_bucket{model=\"%s\",le=\"%s\"} %d\n", metric.name, label, formatPrometheusFloat(bucket.Le), bucket.Count)
+			}
+			fmt.Fprintf(&sb, "%s_bucket{model=\"%s\",le=\"+Inf\"} %d\n", metric.name, label, s.Count)
+			fmt.Fprintf(&sb, "%s_sum{model=\"%s\"} %s\n", metric.name, label, formatPrometheusFloat(s.Sum))
+			fmt.Fprintf(&sb, "%s_count{model=\"%s\"} %d\n", metric.name, label, s.Count)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func escapePrometheusLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func formatPrometheusFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moderationPatterns 编译后的审核正则，编译失败的规则缓存为 nil
+var moderationPatterns sync.Map
+
+type moderationResult struct {
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories"`
+	Reason     string   `json:"reason"`
+}
+
+// ModerateRequest runs the request text through the moderation backend when moderation is enabled for the
+// group of the request. The verdict is stored in the context and recorded in the log detail, an error is
+// returned when the request must be blocked.
+func ModerateRequest(c *gin.Context, info *relaycommon.RelayInfo, meta *types.TokenCountMeta) *types.NewAPIError {
+	setting := operation_setting.GetModerationSetting()
+	if !setting.IsEnabledForGroup(info.UserGroup) || meta == nil || strings.TrimSpace(meta.CombineText) == "" {
+		return nil
+	}
+	text := meta.CombineText
+	if setting.MaxTextLength > 0 {
+		if runes := []rune(text); len(runes) > setting.MaxTextLength {
+			text = string(runes[:setting.MaxTextLength])
+		}
+	}
+
+	start := time.Now()
+	result, err := runModeration(c, setting, info, text)
+	verdict := &model.ModerationVerdict{
+		Backend:    setting.Backend,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		logger.LogError(c, "moderation failed: "+err.Error())
+		verdict.Error = err.Error()
+		verdict.Flagged = !setting.FailOpen
+	} else {
+		verdict.Flagged = result.Flagged
+		verdict.Categories = result.Categories
+		verdict.Reason = result.Reason
+	}
+	verdict.Blocked = verdict.Flagged && setting.Action != operation_setting.ModerationActionFlag
+	common.SetContextKey(c, constant.ContextKeyModerationVerdict, verdict)
+	if !verdict.Blocked {
+		if verdict.Flagged {
+			logger.LogWarn(c, fmt.Sprintf("request flagged by moderation: %s", strings.Join(verdict.Categories, ", ")))
+		}
+		return nil
+	}
+
+	message := "request blocked by content moderation"
+	if len(verdict.Categories) > 0 {
+		message += ": " + strings.Join(verdict.Categories, ", ")
+	}
+	apiErr := types.NewErrorWithStatusCode(errors.New(message), types.ErrorCodeModerationBlocked, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	recordModerationBlock(c, info, verdict, apiErr)
+	return apiErr
+}
+
+func runModeration(c *gin.Context, setting *operation_setting.ModerationSetting, info *relaycommon.RelayInfo, text string) (*moderationResult, error) {
+	switch setting.Backend {
+	case operation_setting.ModerationBackendKeyword:
+		return moderateByKeywords(setting, text), nil
+	case operation_setting.ModerationBackendOpenAI, operation_setting.ModerationBackendHTTP:
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(max(setting.TimeoutSeconds, 1))*time.Second)
+		defer cancel()
+		if setting.Backend == operation_setting.ModerationBackendOpenAI {
+			return moderateByOpenAI(ctx, setting, text)
+		}
+		return moderateByHTTP(ctx, setting, info, text)
+	default:
+		return nil, fmt.Errorf("unknown moderation backend %q", setting.Backend)
+	}
+}
+
+func moderateByKeywords(setting *operation_setting.ModerationSetting, text string) *moderationResult {
+	result := &moderationResult{}
+	if ok, words := AcSearch(strings.ToLower(text), setting.Keywords, true); ok {
+		result.Flagged = true
+		result.Categories = append(result.Categories, "keyword")
+		result.Reason = strings.Join(words, ", ")
+		return result
+	}
+	for _, pattern := range setting.Patterns {
+		re := getModerationPattern(pattern)
+		if re != nil && re.MatchString(text) {
+			result.Flagged = true
+			result.Categories = append(result.Categories, "pattern")
+			result.Reason = pattern
+			return result
+		}
+	}
+	return result
+}
+
+func getModerationPattern(pattern string) *regexp.Regexp {
+	if v, ok := moderationPatterns.Load(pattern); ok {
+		return v.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		common.SysError(fmt.Sprintf("invalid moderation pattern %q: %s", pattern, err.Error()))
+		re = nil
+	}
+	moderationPatterns.Store(pattern, re)
+	return re
+}
+
+func moderateByOpenAI(ctx context.Context, setting *operation_setting.ModerationSetting, text string) (*moderationResult, error) {
+	if setting.OpenAIApiKey == "" {
+		return nil, errors.New("openai moderation api key is not configured")
+	}
+	var response struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	url := strings.TrimSuffix(setting.OpenAIBaseURL, "/") + "/v1/moderations"
+	err := postModerationRequest(ctx, url, setting.OpenAIApiKey, map[string]any{
+		"model": setting.OpenAIModel,
+		"input": text,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	result := &moderationResult{}
+	for _, item := range response.Results {
+		if !item.Flagged {
+			continue
+		}
+		result.Flagged = true
+		for category, flagged := range item.Categories {
+			if flagged && !common.StringsContains(result.Categories, category) {
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+	sort.Strings(result.Categories)
+	return result, nil
+}
+
+func moderateByHTTP(ctx context.Context, setting *operation_setting.ModerationSetting, info *relaycommon.RelayInfo, text string) (*moderationResult, error) {
+	if setting.HTTPURL == "" {
+		return nil, errors.New("moderation service url is not configured")
+	}
+	var result moderationResult
+	err := postModerationRequest(ctx, setting.HTTPURL, setting.HTTPSecret, map[string]any{
+		"text":    text,
+		"model":   info.OriginModelName,
+		"user_id": info.UserId,
+		"group":   info.UserGroup,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func postModerationRequest(ctx context.Context, url string, secret string, payload any, out any) error {
+	if err := common.CheckOutboundAllowed("moderation"); err != nil {
+		return err
+	}
+	body, err := common.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("moderation service returned status %d: %s", resp.StatusCode, string(data))
+	}
+	return common.Unmarshal(data, out)
+}
+
+// recordModerationBlock 被拦截的请求不会转发，单独记录一条错误日志，审核结论写入日志详情
+func recordModerationBlock(c *gin.Context, info *relaycommon.RelayInfo, verdict *model.ModerationVerdict, apiErr *types.NewAPIError) {
+	if !constant.ErrorLogEnabled {
+		return
+	}
+	other := map[string]interface{}{
+		"error_type":  apiErr.GetErrorType(),
+		"error_code":  apiErr.GetErrorCode(),
+		"status_code": apiErr.StatusCode,
+		"moderation":  verdict.Categories,
+	}
+	if c.Request != nil && c.Request.URL != nil {
+		other["request_path"] = c.Request.URL.Path
+	}
+	model.RecordErrorLog(c, info.UserId, 0, info.OriginModelName, c.GetString("token_name"), apiErr.Error(), info.TokenId, 0,
+		info.IsStream, info.UsingGroup, other)
+}
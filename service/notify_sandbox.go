@@ -0,0 +1,329 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// 通知测试台
+//
+// 超级管理员用合成数据触发任意用户通知或告警事件，查看实际发送的负载、请求头、签名和响应，用于在真实事件发生前
+// 验证集成。测试发送不计入用户的通知次数限制，也不写入告警投递记录；最近的尝试只保存在处理请求的节点内存中。
+
+const (
+	// NotifySandboxChannelWebhook 以用户通知的 webhook 格式发送到请求中的地址，secret 不为空时签名
+	NotifySandboxChannelWebhook = "webhook"
+	// NotifySandboxChannelAlert 以告警格式发送到告警设置中的 webhook，Target 为 webhook 名称
+	NotifySandboxChannelAlert = "alert"
+	NotifySandboxChannelEmail = "email"
+)
+
+const (
+	NotifySandboxKindNotify = "notify"
+	NotifySandboxKindAlert  = "alert"
+)
+
+const (
+	notifySandboxHistorySize  = 50
+	notifySandboxPayloadLimit = 64 * 1024
+	notifySandboxTitlePrefix  = "[测试] "
+)
+
+// NotifySandboxEvent 可以触发的事件，Kind 为 notify 的事件通过 webhook 或邮件发送，alert 事件通过告警 webhook 或邮件发送
+type NotifySandboxEvent struct {
+	Event    string   `json:"event"`
+	Kind     string   `json:"kind"`
+	Channels []string `json:"channels"`
+}
+
+type NotifySandboxRequest struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	// Target webhook 地址、告警 webhook 名称或邮箱
+	Target string `json:"target"`
+	Secret string `json:"secret"`
+}
+
+// NotifySandboxAttempt 一次测试发送，邮件没有请求头和响应
+type NotifySandboxAttempt struct {
+	Id         int64             `json:"id"`
+	Event      string            `json:"event"`
+	Channel    string            `json:"channel"`
+	Target     string            `json:"target"`
+	OperatorId int               `json:"operator_id"`
+	Payload    string            `json:"payload"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// Signature X-Webhook-Signature 请求头，为 hex(HMAC-SHA256(secret, 请求体))
+	Signature    string `json:"signature,omitempty"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	Success      bool   `json:"success"`
+	Error        string `json:"error,omitempty"`
+	DurationMs   int64  `json:"duration_ms"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// notifySandboxSample 事件的合成数据，notify 与 alert 二选一
+type notifySandboxSample struct {
+	notify func() (dto.Notify, error)
+	alert  func() Alert
+}
+
+var notifySandboxSamples = map[string]notifySandboxSample{
+	dto.NotifyTypeQuotaExceed: {notify: func() (dto.Notify, error) {
+		topUpLink := fmt.Sprintf("%s/console/topup", system_setting.ServerAddress)
+		prompt := "您的额度即将用尽"
+		return dto.NewNotify(dto.NotifyTypeQuotaExceed, prompt,
+			"{{value}}，当前剩余额度为 {{value}}，为了不影响您的使用，请及时充值。<br/>充值链接：<a href='{{value}}'>{{value}}</a>",
+			[]interface{}{prompt, "$0.50", topUpLink, topUpLink}), nil
+	}},
+	dto.NotifyTypeChannelUpdate: {notify: func() (dto.Notify, error) {
+		return dto.NewNotify(dto.NotifyTypeChannelUpdate, "通道「示例渠道」（#1）已被禁用",
+			"通道「示例渠道」（#1）已被禁用，原因：status code 401", nil), nil
+	}},
+	dto.NotifyTypeChannelTest: {notify: func() (dto.Notify, error) {
+		return dto.NewNotify(dto.NotifyTypeChannelTest, "通道测试完成", "所有通道测试已完成", nil), nil
+	}},
+	dto.NotifyTypeSLOBurn: {notify: func() (dto.Notify, error) {
+		return dto.NewNotify(dto.NotifyTypeSLOBurn, "模型 gpt-4o 错误预算消耗过快",
+			"节点 master 最近 60 分钟：请求 1200，成功率 0.9650，P95 延迟 3200ms，消耗速度 3.50 倍，剩余预算 42.00%", nil), nil
+	}},
+	dto.NotifyTypeReportDigest: {notify: func() (dto.Notify, error) {
+		return dto.NewNotify(dto.NotifyTypeReportDigest, "运营日报",
+			"<p>请求次数：12000，消耗额度：$36.00，新增用户：8</p>", nil), nil
+	}},
+	dto.NotifyTypeAdminMessage: {notify: func() (dto.Notify, error) {
+		return dto.NewNotify(dto.NotifyTypeAdminMessage, "系统维护通知", "系统将于今晚 23:00 进行维护，预计持续 30 分钟。", nil), nil
+	}},
+	dto.NotifyTypeDormancy: {notify: func() (dto.Notify, error) {
+		return dto.NewNotify(dto.NotifyTypeDormancy, "令牌即将因长期未使用被禁用",
+			fmt.Sprintf("您的 1 个令牌（示例令牌）已超过 90 天未使用，如果在 %s 前仍未使用将被自动禁用。",
+				time.Now().AddDate(0, 0, 7).Format("2006-01-02")), nil), nil
+	}},
+	dto.NotifyTypeUsageReport: {notify: func() (dto.Notify, error) {
+		return sampleUsageReport().Notify()
+	}},
+	operation_setting.AlertEventQuotaThreshold: {alert: func() Alert {
+		return Alert{
+			Event:   operation_setting.AlertEventQuotaThreshold,
+			Title:   "用户 example 已用额度达到 80%",
+			Content: "用户 example（#1）已用额度 $80.00，剩余额度 $20.00，已用占比 80.0%，超过 80% 阈值",
+			Fields: map[string]any{
+				"subject":    "user",
+				"user_id":    1,
+				"username":   "example",
+				"threshold":  80,
+				"percent":    80.0,
+				"used_quota": 40000000,
+				"quota":      10000000,
+			},
+		}
+	}},
+	operation_setting.AlertEventChannelDisabled: {alert: func() Alert {
+		return Alert{
+			Event:   operation_setting.AlertEventChannelDisabled,
+			Title:   "渠道「示例渠道」（#1）已被自动禁用",
+			Content: "渠道「示例渠道」（#1）已被自动禁用，原因：status code 401",
+			Fields: map[string]any{
+				"channel_id":   1,
+				"channel_name": "示例渠道",
+				"reason":       "status code 401",
+			},
+		}
+	}},
+	operation_setting.AlertEventTest: {alert: func() Alert {
+		return Alert{
+			Event:   operation_setting.AlertEventTest,
+			Title:   "告警测试",
+			Content: "这是一条测试告警，收到说明告警通知配置正确。",
+		}
+	}},
+}
+
+// sampleUsageReport 合成的用户用量报告，货币与定时报告相同
+func sampleUsageReport() *UsageReport {
+	currency, symbol, rate := operation_setting.GetUsageReportSetting().CurrencyInfo()
+	start, end := usageReportPeriod(operation_setting.UsageReportWeekly, time.Now())
+	report := &UsageReport{
+		Scope:          UsageReportScopeUser,
+		Subject:        "example",
+		UserId:         1,
+		StartTime:      start.Unix(),
+		EndTime:        end.Unix(),
+		GeneratedAt:    common.GetTimestamp(),
+		Currency:       currency,
+		CurrencySymbol: symbol,
+		ExchangeRate:   rate,
+	}
+	for _, line := range []UsageReportLine{
+		{TokenId: 1, TokenName: "default", Group: "default", ModelName: "gpt-4o", Requests: 120, PromptTokens: 240000, CompletionTokens: 60000, Quota: 1500000},
+		{TokenId: 2, TokenName: "ci", Group: "default", ModelName: "claude-3-5-sonnet-20241022", Requests: 30, PromptTokens: 90000, CompletionTokens: 15000, Quota: 1000000},
+	} {
+		line.UserId, line.Username = report.UserId, report.Subject
+		line.Amount = float64(line.Quota) / common.QuotaPerUnit * rate
+		fillUsageReportPrice(&line, rate)
+		report.Lines = append(report.Lines, &line)
+		report.Total.Requests += line.Requests
+		report.Total.PromptTokens += line.PromptTokens
+		report.Total.CompletionTokens += line.CompletionTokens
+		report.Total.Quota += line.Quota
+	}
+	report.Total.Amount = float64(report.Total.Quota) / common.QuotaPerUnit * rate
+	return report
+}
+
+// NotifySandboxEvents lists the events that can be triggered with the channels they can be sent through.
+func NotifySandboxEvents() []NotifySandboxEvent {
+	events := make([]NotifySandboxEvent, 0, len(notifySandboxSamples))
+	for event, sample := range notifySandboxSamples {
+		if sample.alert != nil {
+			events = append(events, NotifySandboxEvent{Event: event, Kind: NotifySandboxKindAlert,
+				Channels: []string{NotifySandboxChannelAlert, NotifySandboxChannelEmail}})
+		} else {
+			events = append(events, NotifySandboxEvent{Event: event, Kind: NotifySandboxKindNotify,
+				Channels: []string{NotifySandboxChannelWebhook, NotifySandboxChannelEmail}})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Kind != events[j].Kind {
+			return events[i].Kind > events[j].Kind
+		}
+		return events[i].Event < events[j].Event
+	})
+	return events
+}
+
+var notifySandboxHistory = struct {
+	sync.Mutex
+	nextId   int64
+	attempts []*NotifySandboxAttempt
+}{}
+
+// SendNotifySandbox sends the synthetic event through the channel and records the attempt. The error is only
+// returned for invalid requests, failed deliveries are reported in the attempt.
+func SendNotifySandbox(operatorId int, req NotifySandboxRequest) (*NotifySandboxAttempt, error) {
+	sample, ok := notifySandboxSamples[req.Event]
+	if !ok {
+		return nil, fmt.Errorf("未知的事件类型 %s", req.Event)
+	}
+	req.Target = strings.TrimSpace(req.Target)
+	if req.Target == "" {
+		return nil, errors.New("发送目标不能为空")
+	}
+	attempt := &NotifySandboxAttempt{
+		Event:      req.Event,
+		Channel:    req.Channel,
+		Target:     req.Target,
+		OperatorId: operatorId,
+		CreatedAt:  common.GetTimestamp(),
+	}
+	var send func() (*webhookResult, error)
+	switch {
+	case req.Channel == NotifySandboxChannelWebhook && sample.notify != nil:
+		data, err := sample.notify()
+		if err != nil {
+			return nil, err
+		}
+		data.Title = notifySandboxTitlePrefix + data.Title
+		payload, err := buildWebhookPayload(data)
+		if err != nil {
+			return nil, err
+		}
+		attempt.Payload = string(payload)
+		send = func() (*webhookResult, error) {
+			return sendWebhookRequest(req.Target, req.Secret, payload)
+		}
+	case req.Channel == NotifySandboxChannelAlert && sample.alert != nil:
+		webhook := operation_setting.GetAlertSetting().GetWebhook(req.Target)
+		if webhook == nil {
+			return nil, fmt.Errorf("webhook %s 不存在", req.Target)
+		}
+		alert := sample.alert()
+		alert.Title = notifySandboxTitlePrefix + alert.Title
+		alert.Timestamp = time.Now().Unix()
+		payload, err := buildAlertPayload(webhook, alert)
+		if err != nil {
+			return nil, err
+		}
+		attempt.Payload = payload
+		send = func() (*webhookResult, error) {
+			return sendAlertWebhook(webhook, []byte(payload))
+		}
+	case req.Channel == NotifySandboxChannelEmail && sample.notify != nil:
+		data, err := sample.notify()
+		if err != nil {
+			return nil, err
+		}
+		data.Title = notifySandboxTitlePrefix + data.Title
+		payload, _ := common.Marshal(data)
+		attempt.Payload = string(payload)
+		send = func() (*webhookResult, error) {
+			return nil, sendEmailNotify(req.Target, data)
+		}
+	case req.Channel == NotifySandboxChannelEmail && sample.alert != nil:
+		alert := sample.alert()
+		alert.Title = notifySandboxTitlePrefix + alert.Title
+		alert.Timestamp = time.Now().Unix()
+		payload, _ := common.Marshal(alert)
+		attempt.Payload = string(payload)
+		send = func() (*webhookResult, error) {
+			return nil, common.SendEmail(alert.Title, req.Target, strings.ReplaceAll(alert.Content, "\n", "<br/>"))
+		}
+	default:
+		return nil, fmt.Errorf("事件 %s 不支持通过 %s 发送", req.Event, req.Channel)
+	}
+
+	start := time.Now()
+	result, err := send()
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	attempt.Success = err == nil
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	if result != nil {
+		attempt.Headers = make(map[string]string, len(result.Headers))
+		for key, value := range result.Headers {
+			// worker 模式下 secret 会作为 Bearer token 发送
+			if key == "Authorization" {
+				value = "Bearer ***"
+			}
+			attempt.Headers[key] = value
+		}
+		attempt.Signature = result.Headers["X-Webhook-Signature"]
+		attempt.StatusCode = result.StatusCode
+		attempt.ResponseBody = string(result.Body)
+	}
+	if len(attempt.Payload) > notifySandboxPayloadLimit {
+		attempt.Payload = attempt.Payload[:notifySandboxPayloadLimit] + "...(truncated)"
+	}
+
+	notifySandboxHistory.Lock()
+	notifySandboxHistory.nextId++
+	attempt.Id = notifySandboxHistory.nextId
+	notifySandboxHistory.attempts = append(notifySandboxHistory.attempts, attempt)
+	if len(notifySandboxHistory.attempts) > notifySandboxHistorySize {
+		notifySandboxHistory.attempts = notifySandboxHistory.attempts[1:]
+	}
+	notifySandboxHistory.Unlock()
+	return attempt, nil
+}
+
+// GetNotifySandboxAttempts returns the recent attempts on this node, newest first.
+func GetNotifySandboxAttempts() []*NotifySandboxAttempt {
+	notifySandboxHistory.Lock()
+	defer notifySandboxHistory.Unlock()
+	attempts := make([]*NotifySandboxAttempt, 0, len(notifySandboxHistory.attempts))
+	for i := len(notifySandboxHistory.attempts) - 1; i >= 0; i-- {
+		attempts = append(attempts, notifySandboxHistory.attempts[i])
+	}
+	return attempts
+}
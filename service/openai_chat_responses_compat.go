@@ -3,6 +3,7 @@ package service
 import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/service/openaicompat"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 )
 
 func ChatCompletionsRequestToResponsesRequest(req *dto.GeneralOpenAIRequest) (*dto.OpenAIResponsesRequest, error) {
@@ -16,3 +17,15 @@ func ResponsesResponseToChatCompletionsResponse(resp *dto.OpenAIResponsesRespons
 func ExtractOutputTextFromResponses(resp *dto.OpenAIResponsesResponse) string {
 	return openaicompat.ExtractOutputTextFromResponses(resp)
 }
+
+func CompletionsRequestToChatRequest(req *dto.GeneralOpenAIRequest, policy model_setting.CompletionsToChatPolicy) (*dto.GeneralOpenAIRequest, error) {
+	return openaicompat.CompletionsRequestToChatRequest(req, policy)
+}
+
+func ChatResponseToCompletionsResponse(body []byte) ([]byte, error) {
+	return openaicompat.ChatResponseToCompletionsResponse(body)
+}
+
+func ChatStreamChunkToCompletionsChunk(data []byte) ([]byte, error) {
+	return openaicompat.ChatStreamChunkToCompletionsChunk(data)
+}
@@ -12,3 +12,7 @@ func ShouldChatCompletionsUseResponsesPolicy(policy model_setting.ChatCompletion
 func ShouldChatCompletionsUseResponsesGlobal(channelID int, channelType int, model string) bool {
 	return openaicompat.ShouldChatCompletionsUseResponsesGlobal(channelID, channelType, model)
 }
+
+func ShouldCompletionsUseChatGlobal(channelID int, channelType int, apiType int) bool {
+	return openaicompat.ShouldCompletionsUseChatGlobal(channelID, channelType, apiType)
+}
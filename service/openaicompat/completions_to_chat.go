@@ -0,0 +1,122 @@
+package openaicompat
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+)
+
+func completionsPromptText(prompt any) (string, error) {
+	switch p := prompt.(type) {
+	case string:
+		return p, nil
+	case []any:
+		if len(p) == 1 {
+			if text, ok := p[0].(string); ok {
+				return text, nil
+			}
+		}
+		return "", errors.New("only a single text prompt can be sent to a chat-only upstream")
+	default:
+		return "", errors.New("unsupported prompt type for a chat-only upstream")
+	}
+}
+
+// CompletionsRequestToChatRequest builds a chat completions request from a legacy completions request,
+// the prompt is rendered into a single user message with the template of the policy.
+func CompletionsRequestToChatRequest(req *dto.GeneralOpenAIRequest, policy model_setting.CompletionsToChatPolicy) (*dto.GeneralOpenAIRequest, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	prompt, err := completionsPromptText(req.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	template := policy.PromptTemplate
+	if template == "" {
+		template = "{{prompt}}"
+	}
+	content := strings.NewReplacer(
+		"{{prompt}}", prompt,
+		"{{suffix}}", common.Interface2String(req.Suffix),
+	).Replace(template)
+
+	chatReq := *req
+	chatReq.Prompt = nil
+	chatReq.Suffix = nil
+	chatReq.Messages = nil
+	if policy.SystemPrompt != "" {
+		chatReq.Messages = append(chatReq.Messages, dto.Message{Role: chatReq.GetSystemRoleName(), Content: policy.SystemPrompt})
+	}
+	chatReq.Messages = append(chatReq.Messages, dto.Message{Role: "user", Content: content})
+	return &chatReq, nil
+}
+
+func completionsCreated(created any) int64 {
+	switch v := created.(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	default:
+		return common.GetTimestamp()
+	}
+}
+
+// ChatResponseToCompletionsResponse converts a chat completions response body to the legacy completions format,
+// error responses are returned unchanged.
+func ChatResponseToCompletionsResponse(body []byte) ([]byte, error) {
+	var chatResp dto.OpenAITextResponse
+	if err := common.Unmarshal(body, &chatResp); err != nil {
+		return nil, err
+	}
+	if chatResp.Error != nil {
+		return body, nil
+	}
+	resp := dto.CompletionsResponse{
+		Id:      chatResp.Id,
+		Object:  "text_completion",
+		Created: completionsCreated(chatResp.Created),
+		Model:   chatResp.Model,
+		Choices: make([]dto.CompletionsChoice, 0, len(chatResp.Choices)),
+		Usage:   &chatResp.Usage,
+	}
+	for _, choice := range chatResp.Choices {
+		finishReason := choice.FinishReason
+		resp.Choices = append(resp.Choices, dto.CompletionsChoice{
+			Text:         choice.Message.StringContent(),
+			Index:        choice.Index,
+			FinishReason: &finishReason,
+		})
+	}
+	return common.Marshal(resp)
+}
+
+// ChatStreamChunkToCompletionsChunk converts one chat completions stream chunk to a legacy completions chunk.
+func ChatStreamChunkToCompletionsChunk(data []byte) ([]byte, error) {
+	var chunk dto.ChatCompletionsStreamResponse
+	if err := common.Unmarshal(data, &chunk); err != nil {
+		return nil, err
+	}
+	resp := dto.CompletionsResponse{
+		Id:      chunk.Id,
+		Object:  "text_completion",
+		Created: chunk.Created,
+		Model:   chunk.Model,
+		Choices: make([]dto.CompletionsChoice, 0, len(chunk.Choices)),
+		Usage:   chunk.Usage,
+	}
+	for _, choice := range chunk.Choices {
+		resp.Choices = append(resp.Choices, dto.CompletionsChoice{
+			Text:         choice.Delta.GetContentString(),
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+		})
+	}
+	return common.Marshal(resp)
+}
@@ -1,6 +1,11 @@
 package openaicompat
 
-import "github.com/QuantumNous/new-api/setting/model_setting"
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+)
 
 func ShouldChatCompletionsUseResponsesPolicy(policy model_setting.ChatCompletionsToResponsesPolicy, channelID int, channelType int, model string) bool {
 	if !policy.IsChannelEnabled(channelID, channelType) {
@@ -17,3 +22,34 @@ func ShouldChatCompletionsUseResponsesGlobal(channelID int, channelType int, mod
 		model,
 	)
 }
+
+// nativeCompletionsApiTypes 原生支持 /v1/completions 的上游协议，其余协议的渠道只支持对话接口
+var nativeCompletionsApiTypes = []int{
+	constant.APITypeOpenAI,
+	constant.APITypeOllama,
+	constant.APITypeDeepSeek,
+	constant.APITypeMoonshot,
+	constant.APITypeCloudflare,
+	constant.APITypeAli,
+	constant.APITypeSiliconFlow,
+	constant.APITypeSelfHosted,
+}
+
+func ShouldCompletionsUseChatPolicy(policy model_setting.CompletionsToChatPolicy, channelID int, channelType int, apiType int) bool {
+	if !policy.Enabled {
+		return false
+	}
+	if policy.IsChannelForced(channelID, channelType) {
+		return true
+	}
+	return !slices.Contains(nativeCompletionsApiTypes, apiType)
+}
+
+func ShouldCompletionsUseChatGlobal(channelID int, channelType int, apiType int) bool {
+	return ShouldCompletionsUseChatPolicy(
+		model_setting.GetGlobalSettings().CompletionsToChatPolicy,
+		channelID,
+		channelType,
+		apiType,
+	)
+}
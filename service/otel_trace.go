@@ -0,0 +1,195 @@
+package service
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/otel"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenTelemetry 链路追踪：每个请求一个 server span，中间件、渠道选择、上游请求和流式响应各为一个子 span。
+// span 保存在请求上下文中，未开启或未采样时各函数直接返回。
+
+var (
+	otelMu       sync.Mutex
+	otelKey      string
+	otelExporter *otel.Exporter
+)
+
+// getOtelExporter returns the exporter of the current options, nil when tracing is disabled.
+func getOtelExporter() *otel.Exporter {
+	setting := system_setting.GetOtelSetting()
+	if !setting.Enabled || setting.Endpoint == "" {
+		return nil
+	}
+	headerKeys := make([]string, 0, len(setting.Headers))
+	for k := range setting.Headers {
+		headerKeys = append(headerKeys, k+"="+setting.Headers[k])
+	}
+	sort.Strings(headerKeys)
+	key := setting.Endpoint + "|" + setting.ServiceName + "|" + strings.Join(headerKeys, ",")
+
+	otelMu.Lock()
+	defer otelMu.Unlock()
+	if otelExporter != nil && otelKey == key {
+		return otelExporter
+	}
+	if otelExporter != nil {
+		old := otelExporter
+		go old.Shutdown()
+	}
+	otelExporter = otel.NewExporter(otel.Config{
+		Endpoint:    setting.Endpoint,
+		Headers:     setting.Headers,
+		ServiceName: setting.ServiceName,
+	})
+	otelExporter.OnError = func(err error) {
+		common.SysError("failed to export traces: " + err.Error())
+	}
+	otelKey = key
+	return otelExporter
+}
+
+func getOtelSpan(c *gin.Context, key constant.ContextKey) *otel.Span {
+	if c == nil {
+		return nil
+	}
+	if value, ok := c.Get(string(key)); ok {
+		if span, ok := value.(*otel.Span); ok {
+			return span
+		}
+	}
+	return nil
+}
+
+// StartOtelServerSpan starts the span of the incoming request, joining the caller's trace when a traceparent is sent.
+// 同时开始中间件 span，在进入转发处理时结束
+func StartOtelServerSpan(c *gin.Context) bool {
+	if getOtelExporter() == nil {
+		return false
+	}
+	parent, ok := otel.ParseTraceparent(c.GetHeader("traceparent"))
+	sampled := parent.Sampled
+	if !ok {
+		sampled = rand.Float64() < system_setting.GetOtelSetting().SampleRatio
+	}
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	span := otel.NewSpan(c.Request.Method+" "+route, otel.SpanKindServer, parent, sampled)
+	span.SetAttribute("http.request.method", c.Request.Method)
+	span.SetAttribute("http.route", route)
+	span.SetAttribute("url.path", c.Request.URL.Path)
+	span.SetAttribute("client.address", c.ClientIP())
+	c.Set(string(constant.ContextKeyOtelServerSpan), span)
+
+	middlewareSpan := otel.NewSpan("middleware", otel.SpanKindInternal, span.Context(), sampled)
+	c.Set(string(constant.ContextKeyOtelMiddlewareSpan), middlewareSpan)
+	return true
+}
+
+// FinishOtelServerSpan ends the spans of the request still open and exports them.
+func FinishOtelServerSpan(c *gin.Context) {
+	span := getOtelSpan(c, constant.ContextKeyOtelServerSpan)
+	if span == nil {
+		return
+	}
+	EndOtelMiddlewareSpan(c)
+	EndOtelStreamSpan(c, nil)
+	status := c.Writer.Status()
+	span.SetAttribute("http.response.status_code", status)
+	if requestId := c.GetString(common.RequestIdKey); requestId != "" {
+		span.SetAttribute("request.id", requestId)
+	}
+	if status >= http.StatusInternalServerError {
+		span.SetError(http.StatusText(status))
+	}
+	endOtelSpan(span)
+}
+
+// StartOtelSpan starts a child span of the request span, nil when the request is not traced.
+func StartOtelSpan(c *gin.Context, name string, kind otel.SpanKind) *otel.Span {
+	parent := getOtelSpan(c, constant.ContextKeyOtelServerSpan)
+	if parent == nil {
+		return nil
+	}
+	return otel.NewSpan(name, kind, parent.Context(), parent.Context().Sampled)
+}
+
+// EndOtelSpan ends a span started by StartOtelSpan and records the error when given.
+func EndOtelSpan(span *otel.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.SetError(err.Error())
+	}
+	endOtelSpan(span)
+}
+
+func endOtelSpan(span *otel.Span) {
+	if !span.End() {
+		return
+	}
+	if exporter := getOtelExporter(); exporter != nil {
+		exporter.Export(span)
+	}
+}
+
+// EndOtelMiddlewareSpan ends the middleware span when the request reaches the relay handler.
+func EndOtelMiddlewareSpan(c *gin.Context) {
+	if span := getOtelSpan(c, constant.ContextKeyOtelMiddlewareSpan); span != nil {
+		endOtelSpan(span)
+	}
+}
+
+// StartOtelStreamSpan starts the span covering the consumption of a stream response.
+func StartOtelStreamSpan(c *gin.Context, channelId int) {
+	EndOtelStreamSpan(c, nil)
+	span := StartOtelSpan(c, "stream", otel.SpanKindInternal)
+	if span == nil {
+		return
+	}
+	span.SetAttribute("channel.id", channelId)
+	c.Set(string(constant.ContextKeyOtelStreamSpan), span)
+}
+
+// EndOtelStreamSpan ends the stream span of the attempt, if any.
+func EndOtelStreamSpan(c *gin.Context, apiErr *types.NewAPIError) {
+	span := getOtelSpan(c, constant.ContextKeyOtelStreamSpan)
+	if span == nil {
+		return
+	}
+	if apiErr != nil {
+		span.SetError(apiErr.Error())
+	}
+	endOtelSpan(span)
+}
+
+// InjectOtelTraceparent sets the traceparent of span on the upstream request when propagation is enabled.
+func InjectOtelTraceparent(span *otel.Span, header http.Header) {
+	if span == nil || !system_setting.GetOtelSetting().PropagateToUpstream {
+		return
+	}
+	header.Set("traceparent", span.Context().Traceparent())
+}
+
+// TraceOtelChannel records the selected channel on the channel selection span.
+func TraceOtelChannel(span *otel.Span, channelId int, channelName string, retry int) {
+	if span == nil {
+		return
+	}
+	span.SetAttribute("channel.id", channelId)
+	span.SetAttribute("channel.name", channelName)
+	span.SetAttribute("retry", retry)
+}
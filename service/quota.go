@@ -7,6 +7,7 @@ import (
 	"math"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -14,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	constant2 "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -32,11 +34,13 @@ type TokenDetails struct {
 type QuotaInfo struct {
 	InputDetails  TokenDetails
 	OutputDetails TokenDetails
-	ModelName     string
-	UsePrice      bool
-	ModelPrice    float64
-	ModelRatio    float64
-	GroupRatio    float64
+	// InputAudioSeconds 输入音频时长，模型配置了按秒价格时替代输入音频 token 计费
+	InputAudioSeconds float64
+	ModelName         string
+	UsePrice          bool
+	ModelPrice        float64
+	ModelRatio        float64
+	GroupRatio        float64
 }
 
 func hasCustomModelRatio(modelName string, currentRatio float64) bool {
@@ -70,13 +74,26 @@ func calculateAudioQuota(info QuotaInfo) int {
 	inputAudioTokens := decimal.NewFromInt(int64(info.InputDetails.AudioTokens))
 	outputAudioTokens := decimal.NewFromInt(int64(info.OutputDetails.AudioTokens))
 
+	quotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	// 单独定价的音频部分按美元价格计费，只乘分组倍率
+	priceQuota := decimal.Zero
+
 	quota := decimal.Zero
 	quota = quota.Add(inputTextTokens)
 	quota = quota.Add(outputTextTokens.Mul(completionRatio))
-	quota = quota.Add(inputAudioTokens.Mul(audioRatio))
-	quota = quota.Add(outputAudioTokens.Mul(audioRatio).Mul(audioCompletionRatio))
+	if price, ok := ratio_setting.GetAudioInputSecondPrice(info.ModelName); ok && info.InputAudioSeconds > 0 {
+		priceQuota = priceQuota.Add(decimal.NewFromFloat(info.InputAudioSeconds).Mul(decimal.NewFromFloat(price)).Mul(quotaPerUnit))
+	} else {
+		quota = quota.Add(inputAudioTokens.Mul(audioRatio))
+	}
+	if price, ok := ratio_setting.GetAudioOutputTokenPrice(info.ModelName); ok {
+		priceQuota = priceQuota.Add(outputAudioTokens.Mul(decimal.NewFromFloat(price)).Div(decimal.NewFromInt(1000000)).Mul(quotaPerUnit))
+	} else {
+		quota = quota.Add(outputAudioTokens.Mul(audioRatio).Mul(audioCompletionRatio))
+	}
 
 	quota = quota.Mul(ratio)
+	quota = quota.Add(priceQuota.Mul(groupRatio))
 
 	// If ratio is not zero and quota is less than or equal to zero, set quota to 1
 	if !ratio.IsZero() && quota.LessThanOrEqual(decimal.Zero) {
@@ -130,10 +147,11 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 			TextTokens:  textOutTokens,
 			AudioTokens: audioOutTokens,
 		},
-		ModelName:  modelName,
-		UsePrice:   relayInfo.UsePrice,
-		ModelRatio: modelRatio,
-		GroupRatio: actualGroupRatio,
+		InputAudioSeconds: usage.InputAudioSeconds,
+		ModelName:         modelName,
+		UsePrice:          relayInfo.UsePrice,
+		ModelRatio:        modelRatio,
+		GroupRatio:        actualGroupRatio,
 	}
 
 	quota := calculateAudioQuota(quotaInfo)
@@ -183,10 +201,11 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 			TextTokens:  textOutTokens,
 			AudioTokens: audioOutTokens,
 		},
-		ModelName:  modelName,
-		UsePrice:   usePrice,
-		ModelRatio: modelRatio,
-		GroupRatio: groupRatio,
+		InputAudioSeconds: usage.InputAudioSeconds,
+		ModelName:         modelName,
+		UsePrice:          usePrice,
+		ModelRatio:        modelRatio,
+		GroupRatio:        groupRatio,
 	}
 
 	quota := calculateAudioQuota(quotaInfo)
@@ -200,8 +219,12 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", modelPrice, groupRatio)
 	}
 
+	if usage.InputAudioSeconds > 0 {
+		logContent += fmt.Sprintf("，输入音频 %.2f 秒", usage.InputAudioSeconds)
+	}
+
 	// record all the consume log even if quota is 0
-	if totalTokens == 0 {
+	if totalTokens == 0 && usage.InputAudioSeconds == 0 {
 		// in this case, must be some error happened
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
@@ -219,6 +242,10 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	}
 	other := GenerateWssOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	RecordModelClassUsage(ctx, relayInfo, usage.TotalTokens)
+	ObserveModelUsage(ctx, relayInfo, usage.InputTokens, usage.OutputTokens)
+	DrawTokenBudget(ctx, relayInfo, usage.InputTokens+usage.OutputTokens)
+	SettleTPMUsage(ctx, relayInfo, usage.InputTokens+usage.OutputTokens)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     usage.InputTokens,
@@ -336,10 +363,16 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		cacheCreationTokens5m, cacheCreationRatio5m,
 		cacheCreationTokens1h, cacheCreationRatio1h,
 		modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	RecordModelClassUsage(ctx, relayInfo, promptTokens+completionTokens)
+	ObserveModelUsage(ctx, relayInfo, promptTokens, completionTokens)
+	DrawTokenBudget(ctx, relayInfo, promptTokens+completionTokens)
+	SettleTPMUsage(ctx, relayInfo, promptTokens+completionTokens)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
+		CacheTokens:      cacheTokens,
+		CacheWriteTokens: cacheCreationTokens,
 		ModelName:        modelName,
 		TokenName:        tokenName,
 		Quota:            quota,
@@ -461,10 +494,15 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	}
 	other := GenerateAudioOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	RecordModelClassUsage(ctx, relayInfo, usage.PromptTokens+usage.CompletionTokens)
+	ObserveModelUsage(ctx, relayInfo, usage.PromptTokens, usage.CompletionTokens)
+	DrawTokenBudget(ctx, relayInfo, usage.PromptTokens+usage.CompletionTokens)
+	SettleTPMUsage(ctx, relayInfo, usage.PromptTokens+usage.CompletionTokens)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     usage.PromptTokens,
 		CompletionTokens: usage.CompletionTokens,
+		CacheTokens:      usage.PromptTokensDetails.CachedTokens,
 		ModelName:        logModel,
 		TokenName:        tokenName,
 		Quota:            quota,
@@ -477,6 +515,105 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	})
 }
 
+// AudioEndpointBilling 音频接口按时长或字符数计费的用量与单价（美元）
+type AudioEndpointBilling struct {
+	// Seconds 转录/翻译的输入音频秒数，Price 为每秒价格
+	Seconds float64
+	// Characters 语音合成的输入字符数，Price 为每百万字符价格
+	Characters int
+	Price      float64
+}
+
+// GetAudioEndpointBilling returns the seconds or characters an audio endpoint request is billed by,
+// nil when the model is billed by tokens on this endpoint.
+func GetAudioEndpointBilling(c *gin.Context, relayInfo *relaycommon.RelayInfo, input string) (*AudioEndpointBilling, error) {
+	switch relayInfo.RelayMode {
+	case constant2.RelayModeAudioSpeech:
+		price, ok := ratio_setting.GetAudioCharacterPrice(relayInfo.OriginModelName)
+		if !ok {
+			return nil, nil
+		}
+		return &AudioEndpointBilling{Characters: utf8.RuneCountInString(input), Price: price}, nil
+	case constant2.RelayModeAudioTranscription, constant2.RelayModeAudioTranslation:
+		price, ok := ratio_setting.GetAudioInputSecondPrice(relayInfo.OriginModelName)
+		if !ok {
+			return nil, nil
+		}
+		seconds, err := AudioRequestSeconds(c)
+		if err != nil {
+			return nil, err
+		}
+		return &AudioEndpointBilling{Seconds: seconds, Price: price}, nil
+	}
+	return nil, nil
+}
+
+// PostAudioPriceConsumeQuota settles an audio endpoint request by its audio seconds or characters instead of tokens.
+func PostAudioPriceConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, billing *AudioEndpointBilling) {
+	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
+	tokenName := ctx.GetString("token_name")
+	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
+
+	dPrice := decimal.NewFromFloat(billing.Price)
+	dGroupRatio := decimal.NewFromFloat(groupRatio)
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+
+	var quotaDecimal decimal.Decimal
+	var logContent string
+	other := GenerateTextOtherInfo(ctx, relayInfo, relayInfo.PriceData.ModelRatio, groupRatio, relayInfo.PriceData.CompletionRatio,
+		0, 0, relayInfo.PriceData.ModelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	if relayInfo.RelayMode == constant2.RelayModeAudioSpeech {
+		quotaDecimal = decimal.NewFromInt(int64(billing.Characters)).Mul(dPrice).Div(decimal.NewFromInt(1000000)).Mul(dQuotaPerUnit).Mul(dGroupRatio)
+		logContent = fmt.Sprintf("合成字符 %d，每百万字符价格 %.4f，分组倍率 %.2f", billing.Characters, billing.Price, groupRatio)
+		other["audio_characters"] = billing.Characters
+		other["audio_character_price"] = billing.Price
+	} else {
+		quotaDecimal = decimal.NewFromFloat(billing.Seconds).Mul(dPrice).Mul(dQuotaPerUnit).Mul(dGroupRatio)
+		logContent = fmt.Sprintf("音频时长 %.0f 秒，每秒价格 %.6f，分组倍率 %.2f", billing.Seconds, billing.Price, groupRatio)
+		other["audio_input_seconds"] = billing.Seconds
+		other["audio_input_second_price"] = billing.Price
+	}
+	quota := int(quotaDecimal.Round(0).IntPart())
+	if quota == 0 && quotaDecimal.GreaterThan(decimal.Zero) {
+		quota = 1
+	}
+
+	model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+	model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+
+	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
+	if quotaDelta != 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("音频接口按用量结算：%s（实际消耗：%s，预扣费：%s）",
+			logger.FormatQuota(quotaDelta),
+			logger.FormatQuota(quota),
+			logger.FormatQuota(relayInfo.FinalPreConsumedQuota),
+		))
+		err := PostConsumeQuota(relayInfo, quotaDelta, relayInfo.FinalPreConsumedQuota, true)
+		if err != nil {
+			logger.LogError(ctx, "error consuming token remain quota: "+err.Error())
+		}
+	}
+
+	RecordModelClassUsage(ctx, relayInfo, usage.PromptTokens+usage.CompletionTokens)
+	ObserveModelUsage(ctx, relayInfo, usage.PromptTokens, usage.CompletionTokens)
+	DrawTokenBudget(ctx, relayInfo, usage.PromptTokens+usage.CompletionTokens)
+	SettleTPMUsage(ctx, relayInfo, usage.PromptTokens+usage.CompletionTokens)
+	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+		ChannelId:        relayInfo.ChannelId,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		ModelName:        relayInfo.OriginModelName,
+		TokenName:        tokenName,
+		Quota:            quota,
+		Content:          logContent,
+		TokenId:          relayInfo.TokenId,
+		UseTimeSeconds:   int(useTimeSeconds),
+		IsStream:         relayInfo.IsStream,
+		Group:            relayInfo.UsingGroup,
+		Other:            other,
+	})
+}
+
 func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
@@ -502,6 +639,10 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 }
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
+	// 管理员重放的请求和影子请求不扣费
+	if relayInfo != nil && (relayInfo.ReplayOf != 0 || relayInfo.MirrorOf != 0) {
+		return nil
+	}
 
 	// 1) Consume from wallet quota OR subscription item
 	if relayInfo != nil && relayInfo.BillingSource == BillingSourceSubscription {
@@ -543,6 +684,9 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
 	}
+	if quota > 0 {
+		checkQuotaAlerts(relayInfo)
+	}
 
 	return nil
 }
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// 转发流量的 Prometheus 指标：按渠道和模型统计请求数、错误码、重试、上游延迟、流式首字时间和 token 用量。
+// 按用户统计的指标标签数量随用户数增长，需要通过 METRICS_USER_LABELS_ENABLED 开启，输出时只保留请求数最多的
+// METRICS_LABEL_TOP_N 个用户，其余合并为 other。
+
+var latencyHistogramBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+type relayMetricKey struct {
+	channelId int
+	model     string
+}
+
+type relayRequestKey struct {
+	relayMetricKey
+	status    int
+	errorCode string
+}
+
+type relayMetrics struct {
+	retries          uint64
+	promptTokens     uint64
+	completionTokens uint64
+	upstreamLatency  *histogram
+	firstToken       *histogram
+}
+
+type userMetrics struct {
+	requests         uint64
+	promptTokens     uint64
+	completionTokens uint64
+}
+
+var (
+	relayMetricsLock   sync.Mutex
+	relayMetricsMap    = make(map[relayMetricKey]*relayMetrics)
+	relayRequestCounts = make(map[relayRequestKey]uint64)
+	userMetricsMap     = make(map[int]*userMetrics)
+)
+
+func getRelayMetrics(key relayMetricKey) *relayMetrics {
+	m, ok := relayMetricsMap[key]
+	if !ok {
+		m = &relayMetrics{
+			upstreamLatency: newHistogram(latencyHistogramBuckets),
+			firstToken:      newHistogram(latencyHistogramBuckets),
+		}
+		relayMetricsMap[key] = m
+	}
+	return m
+}
+
+// RecordRelayAttemptMetrics records the outcome of one channel attempt, retry is the index of the attempt.
+func RecordRelayAttemptMetrics(info *relaycommon.RelayInfo, channelId int, retry int, start time.Time, err *types.NewAPIError) {
+	if info == nil || channelId == 0 {
+		return
+	}
+	key := relayMetricKey{channelId: channelId, model: info.OriginModelName}
+	requestKey := relayRequestKey{relayMetricKey: key, status: 200}
+	if err != nil {
+		requestKey.status = err.StatusCode
+		requestKey.errorCode = string(err.GetErrorCode())
+	}
+	upstreamLatency := info.UpstreamLatency
+	info.UpstreamLatency = 0
+
+	relayMetricsLock.Lock()
+	defer relayMetricsLock.Unlock()
+	relayRequestCounts[requestKey]++
+	m := getRelayMetrics(key)
+	if retry > 0 {
+		m.retries++
+	}
+	if upstreamLatency > 0 {
+		m.upstreamLatency.observe(upstreamLatency.Seconds())
+	}
+	if info.IsStream && info.FirstResponseTime.After(start) {
+		m.firstToken.observe(info.FirstResponseTime.Sub(start).Seconds())
+	}
+}
+
+// observeRelayTokenMetrics records the token usage of a billed request per channel, model and user.
+func observeRelayTokenMetrics(relayInfo *relaycommon.RelayInfo, promptTokens int, completionTokens int) {
+	channelId := 0
+	if relayInfo.ChannelMeta != nil {
+		channelId = relayInfo.ChannelId
+	}
+	relayMetricsLock.Lock()
+	defer relayMetricsLock.Unlock()
+	m := getRelayMetrics(relayMetricKey{channelId: channelId, model: relayInfo.OriginModelName})
+	m.promptTokens += uint64(max(promptTokens, 0))
+	m.completionTokens += uint64(max(completionTokens, 0))
+	observeTenantMetrics(relayInfo, promptTokens, completionTokens)
+	if !common.MetricsUserLabelsEnabled || relayInfo.UserId == 0 {
+		return
+	}
+	u, ok := userMetricsMap[relayInfo.UserId]
+	if !ok {
+		u = &userMetrics{}
+		userMetricsMap[relayInfo.UserId] = u
+	}
+	u.requests++
+	u.promptTokens += uint64(max(promptTokens, 0))
+	u.completionTokens += uint64(max(completionTokens, 0))
+}
+
+func relayMetricLabels(key relayMetricKey) string {
+	return fmt.Sprintf("channel=\"%d\",model=\"%s\"", key.channelId, escapePrometheusLabel(key.model))
+}
+
+func writeHistogramMetric(sb *strings.Builder, name string, labels string, s HistogramSnapshot) {
+	for _, bucket := range s.Buckets {
+		fmt.Fprintf(sb, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatPrometheusFloat(bucket.Le), bucket.Count)
+	}
+	fmt.Fprintf(sb, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, s.Count)
+	fmt.Fprintf(sb, "%s_sum{%s} %s\n", name, labels, formatPrometheusFloat(s.Sum))
+	fmt.Fprintf(sb, "%s_count{%s} %d\n", name, labels, s.Count)
+}
+
+// WriteRelayMetrics writes the relay traffic metrics in the Prometheus text exposition format.
+func WriteRelayMetrics(w io.Writer) error {
+	relayMetricsLock.Lock()
+	requestKeys := make([]relayRequestKey, 0, len(relayRequestCounts))
+	for key := range relayRequestCounts {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.channelId != b.channelId {
+			return a.channelId < b.channelId
+		}
+		if a.model != b.model {
+			return a.model < b.model
+		}
+		if a.status != b.status {
+			return a.status < b.status
+		}
+		return a.errorCode < b.errorCode
+	})
+	keys := make([]relayMetricKey, 0, len(relayMetricsMap))
+	for key := range relayMetricsMap {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].channelId != keys[j].channelId {
+			return keys[i].channelId < keys[j].channelId
+		}
+		return keys[i].model < keys[j].model
+	})
+	userLabels, users := collectUserMetrics()
+
+	var sb strings.Builder
+	sb.WriteString("# HELP newapi_relay_requests_total Relay attempts per channel, model, status code and error code.\n# TYPE newapi_relay_requests_total counter\n")
+	for _, key := range requestKeys {
+		fmt.Fprintf(&sb, "newapi_relay_requests_total{%s,status=\"%d\",error_code=\"%s\"} %d\n",
+			relayMetricLabels(key.relayMetricKey), key.status, escapePrometheusLabel(key.errorCode), relayRequestCounts[key])
+	}
+	sb.WriteString("# HELP newapi_relay_retries_total Relay attempts that retried a previous failure.\n# TYPE newapi_relay_retries_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "newapi_relay_retries_total{%s} %d\n", relayMetricLabels(key), relayMetricsMap[key].retries)
+	}
+	sb.WriteString("# HELP newapi_relay_tokens_total Tokens of billed relay requests.\n# TYPE newapi_relay_tokens_total counter\n")
+	for _, key := range keys {
+		m := relayMetricsMap[key]
+		fmt.Fprintf(&sb, "newapi_relay_tokens_total{%s,type=\"prompt\"} %d\n", relayMetricLabels(key), m.promptTokens)
+		fmt.Fprintf(&sb, "newapi_relay_tokens_total{%s,type=\"completion\"} %d\n", relayMetricLabels(key), m.completionTokens)
+	}
+	sb.WriteString("# HELP newapi_relay_upstream_latency_seconds Time from sending the upstream request to receiving the response headers.\n# TYPE newapi_relay_upstream_latency_seconds histogram\n")
+	for _, key := range keys {
+		writeHistogramMetric(&sb, "newapi_relay_upstream_latency_seconds", relayMetricLabels(key), relayMetricsMap[key].upstreamLatency.snapshot())
+	}
+	sb.WriteString("# HELP newapi_relay_first_token_seconds Time to the first response of stream requests.\n# TYPE newapi_relay_first_token_seconds histogram\n")
+	for _, key := range keys {
+		writeHistogramMetric(&sb, "newapi_relay_first_token_seconds", relayMetricLabels(key), relayMetricsMap[key].firstToken.snapshot())
+	}
+	if len(userLabels) > 0 {
+		sb.WriteString("# HELP newapi_user_requests_total Billed relay requests per user.\n# TYPE newapi_user_requests_total counter\n")
+		for _, label := range userLabels {
+			fmt.Fprintf(&sb, "newapi_user_requests_total{user=\"%s\"} %d\n", label, users[label].requests)
+		}
+		sb.WriteString("# HELP newapi_user_tokens_total Tokens of billed relay requests per user.\n# TYPE newapi_user_tokens_total counter\n")
+		for _, label := range userLabels {
+			u := users[label]
+			fmt.Fprintf(&sb, "newapi_user_tokens_total{user=\"%s\",type=\"prompt\"} %d\n", label, u.promptTokens)
+			fmt.Fprintf(&sb, "newapi_user_tokens_total{user=\"%s\",type=\"completion\"} %d\n", label, u.completionTokens)
+		}
+	}
+	writeTenantMetrics(&sb)
+	relayMetricsLock.Unlock()
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
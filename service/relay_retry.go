@@ -0,0 +1,77 @@
+package service
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSameChannelRetryBackoff returns how long to wait before retrying the failed attempt on the same channel,
+// false when the channel does not retry it and the request should fail over to the next channel instead.
+// retried is the number of same-channel retries already made.
+func GetSameChannelRetryBackoff(c *gin.Context, info *relaycommon.RelayInfo, channel *model.Channel, apiErr *types.NewAPIError, retried int) (time.Duration, bool) {
+	if apiErr == nil || channel == nil {
+		return 0, false
+	}
+	settings := channel.GetOtherSettings()
+	if retried >= settings.SameChannelRetryTimes {
+		return 0, false
+	}
+	// 响应已经开始发送给客户端时无法重试
+	if info != nil && info.HasSendResponse() {
+		return 0, false
+	}
+	// 渠道本身的错误（例如密钥失效）或渠道已熔断时重试同一渠道没有意义
+	if types.IsChannelError(apiErr) || types.IsSkipRetryError(apiErr) || apiErr.GetErrorCode() == types.ErrorCodeCircuitOpen {
+		return 0, false
+	}
+	if !settings.IsSameChannelRetryStatus(apiErr.StatusCode) {
+		return 0, false
+	}
+	backoff := settings.SameChannelRetryBackoff(retried)
+	// 上游给出了限流重置时间时至少等到重置，等待时间超过最大退避时切换到其他渠道
+	if apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > settings.RetryMaxBackoff() {
+			return 0, false
+		}
+		backoff = max(backoff, apiErr.RetryAfter)
+	}
+	if deadline, ok := GetRequestDeadline(c); ok && time.Now().Add(backoff).After(deadline) {
+		return 0, false
+	}
+	return backoff, true
+}
+
+// WaitRetryBackoff waits for the backoff, false when the client went away in the meantime.
+func WaitRetryBackoff(c *gin.Context, backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.Request.Context().Done():
+		return false
+	}
+}
+
+// RecordRelayAttempt keeps the outcome of an upstream attempt, the attempts are saved with the log detail.
+func RecordRelayAttempt(c *gin.Context, channelId int, retry int, start time.Time, apiErr *types.NewAPIError) {
+	attempt := model.RelayAttempt{
+		ChannelId:  channelId,
+		Retry:      retry,
+		StartedAt:  start.UnixMilli(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if apiErr != nil {
+		attempt.StatusCode = apiErr.StatusCode
+		attempt.Error = common.ApplyLogPayloadLimit(c, apiErr.Error())
+	}
+	attempts, _ := common.GetContextKeyType[[]model.RelayAttempt](c, constant.ContextKeyRelayAttempts)
+	common.SetContextKey(c, constant.ContextKeyRelayAttempts, append(attempts, attempt))
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 管理员定期报告：从数据看板的汇总数据、错误日志、渠道状态和清理记录生成，通过通知系统发送。
+
+type DigestChannel struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type ReportDigest struct {
+	Frequency        string                  `json:"frequency"`
+	StartTime        int64                   `json:"start_time"`
+	EndTime          int64                   `json:"end_time"`
+	Usage            model.DigestUsageTotals `json:"usage"`
+	PreviousUsage    model.DigestUsageTotals `json:"previous_usage"`
+	TopUsers         []model.DigestRank      `json:"top_users"`
+	TopModels        []model.DigestRank      `json:"top_models"`
+	Errors           int64                   `json:"errors"`
+	PreviousErrors   int64                   `json:"previous_errors"`
+	ErrorSpike       bool                    `json:"error_spike"`
+	TopErrorChannels []model.DigestRank      `json:"top_error_channels"`
+	DisabledChannels []DigestChannel         `json:"disabled_channels"`
+	RetentionCleanup map[string]int64        `json:"retention_cleanup"`
+}
+
+func reportDigestPeriod(frequency string) time.Duration {
+	if frequency == operation_setting.ReportDigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// BuildReportDigest summarizes the period of the given frequency ending at end, compared with the period before it.
+func BuildReportDigest(frequency string, end time.Time) (*ReportDigest, error) {
+	setting := operation_setting.GetReportDigestSetting()
+	topN := setting.TopN
+	if topN <= 0 {
+		topN = 5
+	}
+	period := reportDigestPeriod(frequency)
+	endTime := end.Unix()
+	startTime := end.Add(-period).Unix()
+	previousStart := end.Add(-2 * period).Unix()
+
+	digest := &ReportDigest{
+		Frequency: frequency,
+		StartTime: startTime,
+		EndTime:   endTime,
+	}
+	var err error
+	if digest.Usage, err = model.GetUsageTotals(startTime, endTime); err != nil {
+		return nil, err
+	}
+	if digest.PreviousUsage, err = model.GetUsageTotals(previousStart, startTime); err != nil {
+		return nil, err
+	}
+	if digest.TopUsers, err = model.GetTopUsersByUsage(startTime, endTime, topN); err != nil {
+		return nil, err
+	}
+	if digest.TopModels, err = model.GetTopModelsByUsage(startTime, endTime, topN); err != nil {
+		return nil, err
+	}
+	if digest.Errors, err = model.CountErrorLogs(startTime, endTime); err != nil {
+		return nil, err
+	}
+	if digest.PreviousErrors, err = model.CountErrorLogs(previousStart, startTime); err != nil {
+		return nil, err
+	}
+	if setting.ErrorSpikeRatio > 0 && digest.Errors > 0 {
+		digest.ErrorSpike = float64(digest.Errors) >= float64(max(digest.PreviousErrors, 1))*setting.ErrorSpikeRatio
+	}
+	if digest.TopErrorChannels, err = model.GetTopErrorChannels(startTime, endTime, topN); err != nil {
+		return nil, err
+	}
+	channels, err := model.GetChannelsDisabledBetween(startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	digest.DisabledChannels = make([]DigestChannel, 0, len(channels))
+	for _, channel := range channels {
+		reason, _ := channel.GetOtherInfo()["status_reason"].(string)
+		digest.DisabledChannels = append(digest.DisabledChannels, DigestChannel{
+			Id:     channel.Id,
+			Name:   channel.Name,
+			Status: channel.Status,
+			Reason: reason,
+		})
+	}
+	if digest.RetentionCleanup, err = model.GetRetentionCleanupTotals(startTime, endTime); err != nil {
+		return nil, err
+	}
+	return digest, nil
+}
+
+func formatDigestChange(current int64, previous int64) string {
+	if previous == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", float64(current-previous)/float64(previous)*100)
+}
+
+// Title returns the subject of the digest notification.
+func (d *ReportDigest) Title() string {
+	name := "日报"
+	if d.Frequency == operation_setting.ReportDigestWeekly {
+		name = "周报"
+	}
+	return fmt.Sprintf("%s运营%s（%s）", common.SystemName, name, time.Unix(d.EndTime, 0).Format("2006-01-02"))
+}
+
+// Render returns the digest as HTML for the notification content.
+func (d *ReportDigest) Render() string {
+	var sb strings.Builder
+	writeRanks := func(title string, ranks []model.DigestRank, withQuota bool) {
+		fmt.Fprintf(&sb, "<h3>%s</h3>", title)
+		if len(ranks) == 0 {
+			sb.WriteString("<p>无</p>")
+			return
+		}
+		sb.WriteString("<ol>")
+		for _, rank := range ranks {
+			name := rank.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", rank.Id)
+			}
+			if withQuota {
+				fmt.Fprintf(&sb, "<li>%s：%s，%d 次请求</li>", html.EscapeString(name), logger.FormatQuota(int(rank.Quota)), rank.Count)
+			} else {
+				fmt.Fprintf(&sb, "<li>%s：%d 次</li>", html.EscapeString(name), rank.Count)
+			}
+		}
+		sb.WriteString("</ol>")
+	}
+
+	fmt.Fprintf(&sb, "<p>统计区间：%s ~ %s</p>",
+		time.Unix(d.StartTime, 0).Format("2006-01-02 15:04"), time.Unix(d.EndTime, 0).Format("2006-01-02 15:04"))
+
+	sb.WriteString("<h3>消耗</h3><ul>")
+	fmt.Fprintf(&sb, "<li>消耗额度：%s（环比 %s）</li>", logger.FormatQuota(int(d.Usage.Quota)), formatDigestChange(d.Usage.Quota, d.PreviousUsage.Quota))
+	fmt.Fprintf(&sb, "<li>请求次数：%d（环比 %s）</li>", d.Usage.Count, formatDigestChange(d.Usage.Count, d.PreviousUsage.Count))
+	fmt.Fprintf(&sb, "<li>Token 用量：%d（环比 %s）</li>", d.Usage.TokenUsed, formatDigestChange(d.Usage.TokenUsed, d.PreviousUsage.TokenUsed))
+	sb.WriteString("</ul>")
+
+	writeRanks("消耗最多的用户", d.TopUsers, true)
+	writeRanks("消耗最多的模型", d.TopModels, true)
+
+	sb.WriteString("<h3>错误</h3>")
+	fmt.Fprintf(&sb, "<p>错误日志 %d 条，上一周期 %d 条", d.Errors, d.PreviousErrors)
+	if d.ErrorSpike {
+		sb.WriteString("，<b>错误激增</b>")
+	}
+	sb.WriteString("</p>")
+	writeRanks("错误最多的渠道", d.TopErrorChannels, false)
+
+	sb.WriteString("<h3>被禁用的渠道</h3>")
+	if len(d.DisabledChannels) == 0 {
+		sb.WriteString("<p>无</p>")
+	} else {
+		sb.WriteString("<ul>")
+		for _, channel := range d.DisabledChannels {
+			kind := "手动禁用"
+			if channel.Status == common.ChannelStatusAutoDisabled {
+				kind = "自动禁用"
+			}
+			fmt.Fprintf(&sb, "<li>#%d %s（%s）%s</li>", channel.Id, html.EscapeString(channel.Name), kind, html.EscapeString(channel.Reason))
+		}
+		sb.WriteString("</ul>")
+	}
+
+	sb.WriteString("<h3>过期数据清理</h3>")
+	if len(d.RetentionCleanup) == 0 {
+		sb.WriteString("<p>无</p>")
+	} else {
+		sb.WriteString("<ul>")
+		for _, task := range sortedKeys(d.RetentionCleanup) {
+			fmt.Fprintf(&sb, "<li>%s：删除 %d 条</li>", html.EscapeString(task), d.RetentionCleanup[task])
+		}
+		sb.WriteString("</ul>")
+	}
+	return sb.String()
+}
+
+// SendReportDigest sends the digest to the root user through their notification channel and to the extra recipients by email.
+func SendReportDigest(digest *ReportDigest) error {
+	title := digest.Title()
+	content := digest.Render()
+	NotifyRootUser(dto.NotifyTypeReportDigest, title, content)
+	var errs []string
+	for _, recipient := range operation_setting.GetReportDigestSetting().Recipients {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" {
+			continue
+		}
+		if err := common.SendEmail(title, recipient, content); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", recipient, err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send report digest: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// reportDigestDue reports whether a digest should be sent at now and returns the key of the period to avoid sending it twice.
+func reportDigestDue(setting *operation_setting.ReportDigestSetting, now time.Time) (string, bool) {
+	if now.Hour() != setting.SendHour {
+		return "", false
+	}
+	if setting.Frequency == operation_setting.ReportDigestWeekly && int(now.Weekday()) != setting.Weekday {
+		return "", false
+	}
+	return setting.Frequency + now.Format("2006-01-02"), true
+}
+
+var reportDigestOnce sync.Once
+
+// StartReportDigestTask sends the scheduled report digest on the master node.
+// 发送记录只保存在内存中，发送时刻重启可能会重复发送
+func StartReportDigestTask() {
+	reportDigestOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			lastSent := ""
+			for {
+				time.Sleep(time.Minute)
+				setting := operation_setting.GetReportDigestSetting()
+				if !setting.Enabled {
+					continue
+				}
+				now := time.Now()
+				key, due := reportDigestDue(setting, now)
+				if !due || key == lastSent {
+					continue
+				}
+				lastSent = key
+				end := now.Truncate(time.Hour)
+				digest, err := BuildReportDigest(setting.Frequency, end)
+				if err != nil {
+					common.SysError("failed to build report digest: " + err.Error())
+					continue
+				}
+				if err = SendReportDigest(digest); err != nil {
+					common.SysError(err.Error())
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 客户端可以通过请求头指定整个请求（包括重试）的超时时间，超时后中断上游调用，
+// 已生成的内容照常计费。超时时间不超过 MAX_CLIENT_REQUEST_TIMEOUT 与 RELAY_TIMEOUT。
+
+var requestTimeoutHeaders = []string{"X-Request-Timeout", "Request-Timeout"}
+
+// parseRequestTimeout accepts seconds ("30", "2.5") or a duration ("30s", "1500ms").
+func parseRequestTimeout(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	var timeout time.Duration
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		timeout = time.Duration(seconds * float64(time.Second))
+	} else if d, err := time.ParseDuration(value); err == nil {
+		timeout = d
+	}
+	return timeout, timeout > 0
+}
+
+// GetRequestDeadline returns the deadline requested by the client, measured from the start of the request.
+func GetRequestDeadline(c *gin.Context) (time.Time, bool) {
+	if c == nil || c.Request == nil || common.MaxClientRequestTimeout <= 0 {
+		return time.Time{}, false
+	}
+	if deadline, ok := common.GetContextKeyType[time.Time](c, constant.ContextKeyRequestDeadline); ok {
+		return deadline, true
+	}
+	var timeout time.Duration
+	for _, header := range requestTimeoutHeaders {
+		if d, ok := parseRequestTimeout(c.Request.Header.Get(header)); ok {
+			timeout = d
+			break
+		}
+	}
+	if timeout == 0 {
+		return time.Time{}, false
+	}
+	maxTimeout := time.Duration(common.MaxClientRequestTimeout) * time.Second
+	if common.RelayTimeout > 0 {
+		maxTimeout = min(maxTimeout, time.Duration(common.RelayTimeout)*time.Second)
+	}
+	timeout = min(timeout, maxTimeout)
+	start := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime)
+	if start.IsZero() {
+		start = time.Now()
+	}
+	deadline := start.Add(timeout)
+	common.SetContextKey(c, constant.ContextKeyRequestDeadline, deadline)
+	return deadline, true
+}
+
+// IsRequestDeadlineExceeded reports whether the upstream call was cut by the client deadline.
+func IsRequestDeadlineExceeded(c *gin.Context) bool {
+	deadline, ok := GetRequestDeadline(c)
+	if !ok {
+		return false
+	}
+	if ctx := GetInFlightContext(c); ctx != nil {
+		return errors.Is(ctx.Err(), context.DeadlineExceeded)
+	}
+	return !time.Now().Before(deadline)
+}
+
+// NewRequestTimeoutError builds the error returned when the client deadline is exceeded, it is never retried.
+func NewRequestTimeoutError(c *gin.Context) *types.NewAPIError {
+	timeout := ""
+	if deadline, ok := GetRequestDeadline(c); ok {
+		start := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime)
+		if !start.IsZero() {
+			timeout = fmt.Sprintf(" of %s", deadline.Sub(start).Round(time.Millisecond))
+		}
+	}
+	return types.NewErrorWithStatusCode(fmt.Errorf("request deadline%s exceeded", timeout), types.ErrorCodeRequestTimeout,
+		http.StatusGatewayTimeout, types.ErrOptionWithSkipRetry())
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求去重：同一令牌在窗口内发送的相同请求只转发一次，其余请求等待首个请求完成后复用其响应。
+// 登记表只保存在当前节点内存中。
+
+// DedupResult is the response of the leading request replayed to its duplicates.
+type DedupResult struct {
+	RequestId string
+	Status    int
+	Header    http.Header
+	Body      []byte
+	ModelName string
+	Group     string
+}
+
+// DedupEntry tracks the leading request of identical requests.
+type DedupEntry struct {
+	requestId string
+	startedAt time.Time
+	done      chan struct{}
+	result    *DedupResult // nil when the leading request failed or the response was too large
+}
+
+var (
+	dedupEntries   = make(map[string]*DedupEntry)
+	dedupEntriesMu sync.Mutex
+)
+
+// RequestDedupKey identifies identical requests of a token.
+func RequestDedupKey(tokenId int, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(strconv.Itoa(tokenId) + "\n" + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// AcquireRequestDedup registers the request as the leader of key, or returns the leading request's entry
+// when an identical request started within the window.
+func AcquireRequestDedup(key string, requestId string) (entry *DedupEntry, leader bool) {
+	window := time.Duration(operation_setting.GetRequestDedupSetting().WindowSeconds) * time.Second
+	dedupEntriesMu.Lock()
+	defer dedupEntriesMu.Unlock()
+	if existing, ok := dedupEntries[key]; ok && time.Since(existing.startedAt) < window {
+		return existing, false
+	}
+	entry = &DedupEntry{requestId: requestId, startedAt: time.Now(), done: make(chan struct{})}
+	dedupEntries[key] = entry
+	return entry, true
+}
+
+// LeaderRequestId returns the request id of the leading request.
+func (e *DedupEntry) LeaderRequestId() string {
+	return e.requestId
+}
+
+// Wait blocks until the leading request finished and returns its result, ok is false when there is
+// nothing to replay.
+func (e *DedupEntry) Wait(ctx context.Context) (*DedupResult, bool) {
+	select {
+	case <-e.done:
+		return e.result, e.result != nil
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// DedupRecorder copies the leading request's response while it is sent to the client.
+type DedupRecorder struct {
+	gin.ResponseWriter
+	key      string
+	entry    *DedupEntry
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *DedupRecorder) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *DedupRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *DedupRecorder) record(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+// StartDedupRecording records the response of the leading request.
+func StartDedupRecording(c *gin.Context, key string, entry *DedupEntry) *DedupRecorder {
+	limit := operation_setting.GetRequestDedupSetting().MaxResponseKB << 10
+	recorder := &DedupRecorder{ResponseWriter: c.Writer, key: key, entry: entry, limit: limit}
+	c.Writer = recorder
+	return recorder
+}
+
+// Finish restores the writer and publishes the response to the duplicates. Only successful responses are
+// shared, duplicates of a failed request are processed on their own.
+func (w *DedupRecorder) Finish(c *gin.Context) {
+	c.Writer = w.ResponseWriter
+	if !w.overflow && w.Status() >= http.StatusOK && w.Status() < http.StatusMultipleChoices && w.body.Len() > 0 {
+		w.entry.result = &DedupResult{
+			RequestId: w.entry.requestId,
+			Status:    w.Status(),
+			Header:    w.Header().Clone(),
+			Body:      w.body.Bytes(),
+			ModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+			Group:     common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		}
+	}
+	close(w.entry.done)
+
+	// 窗口结束后移除登记，窗口内到达的重复请求仍可复用结果
+	remaining := time.Duration(operation_setting.GetRequestDedupSetting().WindowSeconds)*time.Second - time.Since(w.entry.startedAt)
+	release := func() {
+		dedupEntriesMu.Lock()
+		if dedupEntries[w.key] == w.entry {
+			delete(dedupEntries, w.key)
+		}
+		dedupEntriesMu.Unlock()
+	}
+	if remaining <= 0 {
+		release()
+		return
+	}
+	time.AfterFunc(remaining, release)
+}
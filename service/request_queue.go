@@ -0,0 +1,278 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 准入排队
+//
+// 每个限流对象（如某个用户的并发名额）对应一条通道，名额用尽后的请求在通道上按到达顺序排队，
+// 前面的请求释放名额时直接交给队首。请求频率限制使用名额为 1 的通道，只有队首轮询限流器，
+// 其余请求在其后等待，保证先到先放行。排队状态只在本节点内存中，不跨节点共享。
+
+// RequestQueueWaitHeader reports how long the request waited for admission, in milliseconds.
+const RequestQueueWaitHeader = "X-Queue-Wait-Ms"
+
+var (
+	ErrRequestQueueFull    = errors.New("request queue is full")
+	ErrRequestQueueTimeout = errors.New("request queue wait timed out")
+)
+
+type queueLane struct {
+	active  int
+	waiters *list.List // of chan struct{}
+}
+
+var (
+	requestQueueMu    sync.Mutex
+	requestQueueLanes = make(map[string]*queueLane)
+	requestQueueDepth atomic.Int64
+)
+
+var requestQueueStats struct {
+	queued   atomic.Int64
+	admitted atomic.Int64
+	timedOut atomic.Int64
+	rejected atomic.Int64
+	// 放行请求的累计与最长等待时间，单位毫秒
+	waitMsSum atomic.Int64
+	waitMsMax atomic.Int64
+}
+
+type RequestQueueStats struct {
+	Depth     int64 `json:"depth"`
+	Queued    int64 `json:"queued"`
+	Admitted  int64 `json:"admitted"`
+	TimedOut  int64 `json:"timed_out"`
+	Rejected  int64 `json:"rejected"`
+	WaitMsSum int64 `json:"wait_ms_sum"`
+	WaitMsMax int64 `json:"wait_ms_max"`
+}
+
+// GetRequestQueueStats returns the queue depth and the counters of this node since start.
+func GetRequestQueueStats() RequestQueueStats {
+	return RequestQueueStats{
+		Depth:     requestQueueDepth.Load(),
+		Queued:    requestQueueStats.queued.Load(),
+		Admitted:  requestQueueStats.admitted.Load(),
+		TimedOut:  requestQueueStats.timedOut.Load(),
+		Rejected:  requestQueueStats.rejected.Load(),
+		WaitMsSum: requestQueueStats.waitMsSum.Load(),
+		WaitMsMax: requestQueueStats.waitMsMax.Load(),
+	}
+}
+
+// WriteRequestQueueMetrics writes the admission queue metrics in the Prometheus text exposition format.
+func WriteRequestQueueMetrics(w io.Writer) error {
+	stats := GetRequestQueueStats()
+	var sb strings.Builder
+	sb.WriteString("# HELP newapi_request_queue_depth Requests currently waiting for admission.\n# TYPE newapi_request_queue_depth gauge\n")
+	fmt.Fprintf(&sb, "newapi_request_queue_depth %d\n", stats.Depth)
+	sb.WriteString("# HELP newapi_request_queue_total Requests that had to wait for admission, by outcome.\n# TYPE newapi_request_queue_total counter\n")
+	fmt.Fprintf(&sb, "newapi_request_queue_total{result=\"admitted\"} %d\n", stats.Admitted)
+	fmt.Fprintf(&sb, "newapi_request_queue_total{result=\"timeout\"} %d\n", stats.TimedOut)
+	fmt.Fprintf(&sb, "newapi_request_queue_total{result=\"rejected\"} %d\n", stats.Rejected)
+	sb.WriteString("# HELP newapi_request_queue_wait_seconds_sum Total wait of the admitted requests.\n# TYPE newapi_request_queue_wait_seconds_sum counter\n")
+	fmt.Fprintf(&sb, "newapi_request_queue_wait_seconds_sum %.3f\n", float64(stats.WaitMsSum)/1000)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// enterRequestQueue reserves a place in the queue of this node, it fails when the queue is disabled or full.
+func enterRequestQueue() bool {
+	setting := operation_setting.GetRequestQueueSetting()
+	if !setting.Enabled || setting.MaxWaitSeconds <= 0 {
+		return false
+	}
+	if requestQueueDepth.Add(1) > int64(setting.MaxQueueSize) {
+		requestQueueDepth.Add(-1)
+		requestQueueStats.rejected.Add(1)
+		return false
+	}
+	requestQueueStats.queued.Add(1)
+	return true
+}
+
+// leaveRequestQueue gives back the place taken by enterRequestQueue and records the outcome.
+func leaveRequestQueue(c *gin.Context, start time.Time, err error) {
+	requestQueueDepth.Add(-1)
+	waited := time.Since(start)
+	addRequestQueueWait(c, waited)
+	if err != nil {
+		requestQueueStats.timedOut.Add(1)
+		return
+	}
+	requestQueueStats.admitted.Add(1)
+	ms := waited.Milliseconds()
+	requestQueueStats.waitMsSum.Add(ms)
+	for {
+		current := requestQueueStats.waitMsMax.Load()
+		if ms <= current || requestQueueStats.waitMsMax.CompareAndSwap(current, ms) {
+			break
+		}
+	}
+}
+
+// addRequestQueueWait accumulates the wait of the request and reports it in RequestQueueWaitHeader.
+func addRequestQueueWait(c *gin.Context, waited time.Duration) {
+	total, _ := common.GetContextKeyType[time.Duration](c, constant.ContextKeyRequestQueueWait)
+	total += waited
+	common.SetContextKey(c, constant.ContextKeyRequestQueueWait, total)
+	c.Header(RequestQueueWaitHeader, strconv.FormatInt(total.Milliseconds(), 10))
+}
+
+func requestQueueMaxWait() time.Duration {
+	return time.Duration(operation_setting.GetRequestQueueSetting().MaxWaitSeconds) * time.Second
+}
+
+// acquireQueueLane takes one of the limit slots of the lane, waiting behind earlier requests until deadline
+// when they are all in use. The caller must hold a place in the queue when the lane may have to wait.
+func acquireQueueLane(ctx context.Context, key string, limit int, deadline time.Time) (func(), error) {
+	requestQueueMu.Lock()
+	lane := takeQueueLaneLocked(key, limit)
+	if lane == nil {
+		requestQueueMu.Unlock()
+		return laneReleaser(key), nil
+	}
+	ready := make(chan struct{})
+	element := lane.waiters.PushBack(ready)
+	requestQueueMu.Unlock()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return laneReleaser(key), nil
+	case <-timer.C:
+		err = ErrRequestQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	requestQueueMu.Lock()
+	defer requestQueueMu.Unlock()
+	select {
+	case <-ready:
+		// 超时的同时轮到了该请求，名额已经交给它
+		return laneReleaser(key), nil
+	default:
+	}
+	lane.waiters.Remove(element)
+	if lane.active <= 0 && lane.waiters.Len() == 0 {
+		delete(requestQueueLanes, key)
+	}
+	return nil, err
+}
+
+// takeQueueLaneLocked takes a free slot of the lane when nobody is waiting for it, otherwise it returns
+// the lane to wait on.
+func takeQueueLaneLocked(key string, limit int) *queueLane {
+	lane := requestQueueLanes[key]
+	if lane == nil {
+		lane = &queueLane{waiters: list.New()}
+		requestQueueLanes[key] = lane
+	}
+	if lane.active < limit && lane.waiters.Len() == 0 {
+		lane.active++
+		return nil
+	}
+	return lane
+}
+
+func laneReleaser(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { releaseQueueLane(key) })
+	}
+}
+
+// releaseQueueLane hands the slot over to the first waiter of the lane, or frees it.
+func releaseQueueLane(key string) {
+	requestQueueMu.Lock()
+	defer requestQueueMu.Unlock()
+	lane := requestQueueLanes[key]
+	if lane == nil {
+		return
+	}
+	if front := lane.waiters.Front(); front != nil {
+		lane.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	lane.active--
+	if lane.active <= 0 {
+		delete(requestQueueLanes, key)
+	}
+}
+
+// AcquireConcurrencySlot takes one of the limit concurrent slots of key, queueing for a free one when the
+// queue is enabled. It returns ErrRequestQueueFull or ErrRequestQueueTimeout when the request must be rejected.
+func AcquireConcurrencySlot(c *gin.Context, key string, limit int) (func(), error) {
+	laneKey := "concurrency:" + key
+	requestQueueMu.Lock()
+	lane := takeQueueLaneLocked(laneKey, limit)
+	requestQueueMu.Unlock()
+	if lane == nil {
+		return laneReleaser(laneKey), nil
+	}
+	if !enterRequestQueue() {
+		return nil, ErrRequestQueueFull
+	}
+	start := time.Now()
+	release, err := acquireQueueLane(c.Request.Context(), laneKey, limit, start.Add(requestQueueMaxWait()))
+	leaveRequestQueue(c, start, err)
+	return release, err
+}
+
+// WaitForRateLimit queues a request rejected by a rate limiter behind the earlier rejected requests of the
+// same key. The head of the queue retries admit after the wait it reports, until admit lets it through or
+// the queue wait runs out.
+func WaitForRateLimit(c *gin.Context, key string, admit func() (bool, int64)) error {
+	if !enterRequestQueue() {
+		return ErrRequestQueueFull
+	}
+	start := time.Now()
+	deadline := start.Add(requestQueueMaxWait())
+	err := waitForRateLimit(c.Request.Context(), "rate:"+key, deadline, admit)
+	leaveRequestQueue(c, start, err)
+	return err
+}
+
+func waitForRateLimit(ctx context.Context, laneKey string, deadline time.Time, admit func() (bool, int64)) error {
+	release, err := acquireQueueLane(ctx, laneKey, 1, deadline)
+	if err != nil {
+		return err
+	}
+	defer release()
+	for {
+		allowed, retryAfter := admit()
+		if allowed {
+			return nil
+		}
+		wait := time.Duration(max(retryAfter, 1)) * time.Second
+		if time.Now().Add(wait).After(deadline) {
+			// 等到限流释放也已超过排队时间，不再占用队列
+			return ErrRequestQueueTimeout
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 请求追踪：开启后在请求上下文中记录鉴权、路由决策（含候选渠道及评分）、每次尝试的上游耗时和错误，
+// 请求结束时连同写入的消费/错误日志 ID 一起保存，按请求 ID 组装成完整时间线用于事后排查。
+
+const (
+	TraceStageAuth     = "auth"
+	TraceStageRouting  = "routing"
+	TraceStageAttempt  = "attempt"
+	TraceStageCompress = "compress"
+	TraceStageResult   = "result"
+)
+
+// maxTraceCandidates 路由事件中最多记录的候选渠道数
+const maxTraceCandidates = 50
+
+type TraceEvent struct {
+	Time    int64          `json:"time"` // 毫秒时间戳
+	Stage   string         `json:"stage"`
+	Message string         `json:"message,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+type requestTraceRecorder struct {
+	events []TraceEvent
+}
+
+// TraceCandidate 路由时的候选渠道，Score 为成本评分（越低越优先）
+type TraceCandidate struct {
+	ChannelId      int     `json:"channel_id"`
+	ChannelName    string  `json:"channel_name"`
+	Priority       int64   `json:"priority"`
+	Weight         int     `json:"weight"`
+	Region         string  `json:"region,omitempty"`
+	ResponseTimeMs int     `json:"response_time_ms"`
+	Score          float64 `json:"score"`
+	Tried          bool    `json:"tried,omitempty"`
+	Burning        bool    `json:"burning,omitempty"`
+	Selected       bool    `json:"selected,omitempty"`
+}
+
+// RequestTraceView 组装好的请求时间线
+type RequestTraceView struct {
+	RequestId string         `json:"request_id"`
+	UserId    int            `json:"user_id"`
+	ModelName string         `json:"model_name"`
+	CreatedAt int64          `json:"created_at"`
+	UseTimeMs int64          `json:"use_time_ms"`
+	Events    []TraceEvent   `json:"events"`
+	Billing   []TraceBilling `json:"billing"`
+	Logs      []*model.Log   `json:"logs"`
+}
+
+// TraceBilling 消费日志中的计费明细
+type TraceBilling struct {
+	LogId            int            `json:"log_id"`
+	Quota            int            `json:"quota"`
+	PromptTokens     int            `json:"prompt_tokens"`
+	CompletionTokens int            `json:"completion_tokens"`
+	Details          map[string]any `json:"details"`
+}
+
+func getRequestTraceRecorder(c *gin.Context) *requestTraceRecorder {
+	if c == nil {
+		return nil
+	}
+	recorder, _ := common.GetContextKeyType[*requestTraceRecorder](c, constant.ContextKeyRequestTrace)
+	return recorder
+}
+
+// StartRequestTrace starts recording the timeline of the relay request when tracing is enabled.
+func StartRequestTrace(c *gin.Context, info *relaycommon.RelayInfo) {
+	if !operation_setting.GetRequestTraceSetting().Enabled || c.GetString(common.RequestIdKey) == "" {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyRequestTrace, &requestTraceRecorder{})
+	AddTraceEvent(c, TraceStageAuth, "authenticated", map[string]any{
+		"user_id":     info.UserId,
+		"username":    c.GetString("username"),
+		"token_id":    info.TokenId,
+		"token_name":  c.GetString("token_name"),
+		"user_group":  info.UserGroup,
+		"token_group": info.TokenGroup,
+		"using_group": info.UsingGroup,
+		"ip":          c.ClientIP(),
+		"path":        c.Request.URL.Path,
+		"model":       info.OriginModelName,
+		"is_stream":   info.IsStream,
+		"started_at":  info.StartTime.UnixMilli(),
+	})
+}
+
+// AddTraceEvent appends an event to the timeline, it does nothing when the request is not traced.
+func AddTraceEvent(c *gin.Context, stage string, message string, data map[string]any) {
+	recorder := getRequestTraceRecorder(c)
+	if recorder == nil {
+		return
+	}
+	recorder.events = append(recorder.events, TraceEvent{
+		Time:    time.Now().UnixMilli(),
+		Stage:   stage,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// TraceRouting records the selected channel together with every candidate of the group and its score.
+func TraceRouting(c *gin.Context, info *relaycommon.RelayInfo, channel *model.Channel, retry int) {
+	if getRequestTraceRecorder(c) == nil || channel == nil {
+		return
+	}
+	group := common.GetContextKeyString(c, constant.ContextKeyAutoGroup)
+	if group == "" {
+		group = info.UsingGroup
+	}
+	routingSetting := operation_setting.GetRoutingSetting()
+	data := map[string]any{
+		"retry":            retry,
+		"group":            group,
+		"strategy":         routingSetting.Strategy,
+		"channel_id":       channel.Id,
+		"channel_name":     channel.Name,
+		"preferred_region": GetPreferredRegion(c),
+	}
+	if capabilities := GetRequiredCapabilities(c); len(capabilities) > 0 {
+		data["required_capabilities"] = capabilities
+	}
+	if tags := GetRequiredComplianceTags(c, group); len(tags) > 0 {
+		data["required_compliance_tags"] = tags
+	}
+	channels, err := model.GetSatisfiedChannels(group, info.OriginModelName, nil)
+	if err == nil {
+		used := getUsedChannelIds(c)
+		burning := GetBurningChannels(info.OriginModelName)
+		candidates := make([]TraceCandidate, 0, len(channels))
+		for _, candidate := range channels {
+			if len(candidates) >= maxTraceCandidates {
+				break
+			}
+			candidates = append(candidates, TraceCandidate{
+				ChannelId:      candidate.Id,
+				ChannelName:    candidate.Name,
+				Priority:       candidate.GetPriority(),
+				Weight:         candidate.GetWeight(),
+				Region:         candidate.GetRegion(),
+				ResponseTimeMs: candidate.ResponseTime,
+				Score:          channelCostScore(candidate, info.OriginModelName, group, routingSetting.LatencyPenaltyFactor),
+				Tried:          used[candidate.Id] && candidate.Id != channel.Id,
+				Burning:        burning[candidate.Id],
+				Selected:       candidate.Id == channel.Id,
+			})
+		}
+		data["candidates"] = candidates
+	}
+	AddTraceEvent(c, TraceStageRouting, fmt.Sprintf("selected channel #%d", channel.Id), data)
+}
+
+// TraceAttempt records the upstream timing and outcome of one attempt.
+func TraceAttempt(c *gin.Context, info *relaycommon.RelayInfo, channelId int, start time.Time, apiErr *types.NewAPIError) {
+	if getRequestTraceRecorder(c) == nil {
+		return
+	}
+	data := map[string]any{
+		"channel_id":  channelId,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if info.ChannelMeta != nil {
+		data["upstream_model"] = info.UpstreamModelName
+	}
+	if info.HasSendResponse() && info.FirstResponseTime.After(start) {
+		data["first_response_ms"] = info.FirstResponseTime.Sub(start).Milliseconds()
+	}
+	message := "succeeded"
+	if apiErr != nil {
+		message = "failed"
+		data["status_code"] = apiErr.StatusCode
+		data["error_code"] = apiErr.GetErrorCode()
+		data["error_type"] = apiErr.GetErrorType()
+		data["error"] = apiErr.Error()
+	}
+	AddTraceEvent(c, TraceStageAttempt, message, data)
+}
+
+// FinishRequestTrace records the final outcome with the pricing used and saves the timeline.
+func FinishRequestTrace(c *gin.Context, info *relaycommon.RelayInfo, apiErr *types.NewAPIError) {
+	recorder := getRequestTraceRecorder(c)
+	if recorder == nil {
+		return
+	}
+	priceData := info.PriceData
+	data := map[string]any{
+		"use_channel": c.GetStringSlice("use_channel"),
+		"pricing": map[string]any{
+			"free_model":           priceData.FreeModel,
+			"use_price":            priceData.UsePrice,
+			"model_price":          priceData.ModelPrice,
+			"model_ratio":          priceData.ModelRatio,
+			"completion_ratio":     priceData.CompletionRatio,
+			"cache_ratio":          priceData.CacheRatio,
+			"group_ratio":          priceData.GroupRatioInfo.GroupRatio,
+			"other_ratios":         priceData.OtherRatios,
+			"price_source":         priceData.PriceSource,
+			"pre_consumed_quota":   info.FinalPreConsumedQuota,
+			"billing_source":       info.BillingSource,
+			"quota_to_pre_consume": priceData.QuotaToPreConsume,
+		},
+	}
+	message := "succeeded"
+	if apiErr != nil {
+		message = "failed"
+		data["status_code"] = apiErr.StatusCode
+		data["error_code"] = apiErr.GetErrorCode()
+		data["error"] = apiErr.Error()
+	}
+	AddTraceEvent(c, TraceStageResult, message, data)
+
+	logIds, _ := common.GetContextKeyType[[]int](c, constant.ContextKeyRecordedLogIds)
+	trace := &model.RequestTrace{
+		RequestId: c.GetString(common.RequestIdKey),
+		UserId:    info.UserId,
+		ModelName: info.OriginModelName,
+		CreatedAt: info.StartTime.Unix(),
+		UseTimeMs: time.Since(info.StartTime).Milliseconds(),
+		Events:    model.LargeText(common.GetJsonString(recorder.events)),
+		LogIds:    common.GetJsonString(logIds),
+	}
+	gopool.Go(func() {
+		if err := trace.Insert(); err != nil {
+			logger.LogError(context.Background(), fmt.Sprintf("failed to save request trace %s: %s", trace.RequestId, err.Error()))
+		}
+	})
+}
+
+// GetRequestTraceView assembles the timeline of the request with its logs, billing details and captured payloads.
+func GetRequestTraceView(requestId string) (*RequestTraceView, error) {
+	trace, err := model.GetRequestTraceByRequestId(strings.TrimSpace(requestId))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("未找到该请求的追踪记录，请确认已开启请求追踪且记录未过期")
+	}
+	if err != nil {
+		return nil, err
+	}
+	view := &RequestTraceView{
+		RequestId: trace.RequestId,
+		UserId:    trace.UserId,
+		ModelName: trace.ModelName,
+		CreatedAt: trace.CreatedAt,
+		UseTimeMs: trace.UseTimeMs,
+		Events:    make([]TraceEvent, 0),
+		Billing:   make([]TraceBilling, 0),
+	}
+	if err = common.Unmarshal([]byte(trace.Events), &view.Events); err != nil {
+		return nil, err
+	}
+	var logIds []int
+	if trace.LogIds != "" {
+		_ = common.Unmarshal([]byte(trace.LogIds), &logIds)
+	}
+	if view.Logs, err = model.GetLogsByIds(logIds); err != nil {
+		return nil, err
+	}
+	for _, log := range view.Logs {
+		if log.Type != model.LogTypeConsume {
+			continue
+		}
+		details := make(map[string]any)
+		if log.Other != "" {
+			_ = common.Unmarshal([]byte(log.Other), &details)
+		}
+		view.Billing = append(view.Billing, TraceBilling{
+			LogId:            log.Id,
+			Quota:            log.Quota,
+			PromptTokens:     log.PromptTokens,
+			CompletionTokens: log.CompletionTokens,
+			Details:          details,
+		})
+	}
+	return view, nil
+}
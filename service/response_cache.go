@@ -0,0 +1,268 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+// 响应缓存：按请求内容缓存上游的完整响应，命中时直接返回，不请求上游。
+// 开启 Redis 时所有节点共享缓存，否则缓存在当前节点内存中；命中率按模型统计，只统计当前节点。
+
+const (
+	// ResponseCacheHeader 响应头，值为 HIT、MISS 或 BYPASS
+	ResponseCacheHeader = "New-Api-Cache"
+	// 超过该大小的响应不缓存
+	responseCacheMaxBodyBytes = 8 << 20
+)
+
+type responseCacheEntry struct {
+	Body  string    `json:"body"`
+	Usage dto.Usage `json:"usage"`
+}
+
+type ResponseCacheStats struct {
+	Model    string  `json:"model"`
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	Bypassed uint64  `json:"bypassed"`
+	Stored   uint64  `json:"stored"`
+	HitRate  float64 `json:"hit_rate"`
+}
+
+type responseCache struct {
+	// name 用于日志和 Prometheus 指标名
+	name      string
+	namespace string
+	capacity  func() int
+	ttl       func() time.Duration
+	// onHit 命中时调整计费，usage 为缓存时上游返回的用量
+	onHit func(info *relaycommon.RelayInfo, usage *dto.Usage)
+
+	once  sync.Once
+	cache *cachex.HybridCache[responseCacheEntry]
+
+	statsLock sync.Mutex
+	stats     map[string]*ResponseCacheStats
+}
+
+func newResponseCache(name string, namespace string, capacity func() int, ttl func() time.Duration,
+	onHit func(info *relaycommon.RelayInfo, usage *dto.Usage)) *responseCache {
+	return &responseCache{
+		name:      name,
+		namespace: namespace,
+		capacity:  capacity,
+		ttl:       ttl,
+		onHit:     onHit,
+		stats:     make(map[string]*ResponseCacheStats),
+	}
+}
+
+func (rc *responseCache) get() *cachex.HybridCache[responseCacheEntry] {
+	rc.once.Do(func() {
+		capacity := rc.capacity()
+		ttl := rc.ttl()
+		rc.cache = cachex.NewHybridCache[responseCacheEntry](cachex.HybridCacheConfig[responseCacheEntry]{
+			Namespace: cachex.Namespace(rc.namespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[responseCacheEntry]{},
+			Memory: func() *hot.HotCache[string, responseCacheEntry] {
+				return hot.NewHotCache[string, responseCacheEntry](hot.LRU, capacity).
+					WithTTL(ttl).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return rc.cache
+}
+
+func (rc *responseCache) record(model string, update func(stats *ResponseCacheStats)) {
+	rc.statsLock.Lock()
+	defer rc.statsLock.Unlock()
+	stats, ok := rc.stats[model]
+	if !ok {
+		stats = &ResponseCacheStats{Model: model}
+		rc.stats[model] = stats
+	}
+	update(stats)
+}
+
+// lookup starts the cache handling of a request, nil when the response is neither read from nor written to the cache.
+// 客户端的 Cache-Control: no-cache 跳过读取缓存，no-store 同时不写入缓存
+func (rc *responseCache) lookup(c *gin.Context, key string, model string) *ResponseCacheLookup {
+	lookup := &ResponseCacheLookup{cache: rc, key: key, model: model, store: true}
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	if strings.Contains(cacheControl, "no-store") {
+		lookup.store = false
+	}
+	if lookup.store && !strings.Contains(cacheControl, "no-cache") {
+		return lookup
+	}
+	c.Header(ResponseCacheHeader, "BYPASS")
+	rc.record(model, func(stats *ResponseCacheStats) { stats.Bypassed++ })
+	if !lookup.store {
+		return nil
+	}
+	lookup.skipRead = true
+	return lookup
+}
+
+// Stats returns the hit rate of the cache per model on this node.
+func (rc *responseCache) Stats() []ResponseCacheStats {
+	rc.statsLock.Lock()
+	stats := make([]ResponseCacheStats, 0, len(rc.stats))
+	for _, s := range rc.stats {
+		item := *s
+		if lookups := item.Hits + item.Misses; lookups > 0 {
+			item.HitRate = float64(item.Hits) / float64(lookups)
+		}
+		stats = append(stats, item)
+	}
+	rc.statsLock.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Model < stats[j].Model
+	})
+	return stats
+}
+
+func (rc *responseCache) Purge() error {
+	return rc.get().Purge()
+}
+
+// writeMetrics writes the cache lookups in the Prometheus text exposition format.
+func (rc *responseCache) writeMetrics(w io.Writer) error {
+	stats := rc.Stats()
+	requestsMetric := fmt.Sprintf("newapi_%s_cache_requests_total", rc.name)
+	storesMetric := fmt.Sprintf("newapi_%s_cache_stores_total", rc.name)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# HELP %s %s cache lookups per model and result.\n# TYPE %s counter\n", requestsMetric, rc.name, requestsMetric)
+	for _, s := range stats {
+		model := escapePrometheusLabel(s.Model)
+		fmt.Fprintf(&sb, "%s{model=\"%s\",result=\"hit\"} %d\n", requestsMetric, model, s.Hits)
+		fmt.Fprintf(&sb, "%s{model=\"%s\",result=\"miss\"} %d\n", requestsMetric, model, s.Misses)
+		fmt.Fprintf(&sb, "%s{model=\"%s\",result=\"bypass\"} %d\n", requestsMetric, model, s.Bypassed)
+	}
+	fmt.Fprintf(&sb, "# HELP %s Responses written to the %s cache.\n# TYPE %s counter\n", storesMetric, rc.name, storesMetric)
+	for _, s := range stats {
+		fmt.Fprintf(&sb, "%s{model=\"%s\"} %d\n", storesMetric, escapePrometheusLabel(s.Model), s.Stored)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// ResponseCacheLookup 一次请求的缓存状态，不使用缓存时为 nil，方法可以在 nil 上调用
+type ResponseCacheLookup struct {
+	cache    *responseCache
+	key      string
+	model    string
+	skipRead bool
+	store    bool
+	writer   *responseCaptureWriter
+}
+
+// Serve writes the cached response when there is one and returns the usage to bill.
+func (l *ResponseCacheLookup) Serve(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Usage, bool) {
+	if l == nil || l.skipRead {
+		return nil, false
+	}
+	entry, found, err := l.cache.get().Get(l.key)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to read %s cache: %s", l.cache.name, err.Error()))
+	}
+	if !found || err != nil {
+		c.Header(ResponseCacheHeader, "MISS")
+		l.cache.record(l.model, func(stats *ResponseCacheStats) { stats.Misses++ })
+		return nil, false
+	}
+	l.cache.record(l.model, func(stats *ResponseCacheStats) { stats.Hits++ })
+	c.Header(ResponseCacheHeader, "HIT")
+	c.Data(http.StatusOK, "application/json", []byte(entry.Body))
+
+	usage := entry.Usage
+	if l.cache.onHit != nil {
+		l.cache.onHit(info, &usage)
+	}
+	return &usage, true
+}
+
+// Capture records the response written by the adaptor so it can be stored after a successful request.
+func (l *ResponseCacheLookup) Capture(c *gin.Context) {
+	if l == nil || !l.store {
+		return
+	}
+	l.writer = &responseCaptureWriter{ResponseWriter: c.Writer}
+	c.Writer = l.writer
+}
+
+// Discard restores the response writer of a failed request without caching the response.
+func (l *ResponseCacheLookup) Discard(c *gin.Context) {
+	if l == nil || l.writer == nil {
+		return
+	}
+	c.Writer = l.writer.ResponseWriter
+	l.writer = nil
+}
+
+// Store caches the captured response of a successful request and restores the response writer.
+func (l *ResponseCacheLookup) Store(c *gin.Context, usage *dto.Usage) {
+	if l == nil || l.writer == nil {
+		return
+	}
+	writer := l.writer
+	l.Discard(c)
+	if writer.overflow || writer.Status() != http.StatusOK || writer.body.Len() == 0 || usage == nil {
+		return
+	}
+	entry := responseCacheEntry{Body: writer.body.String(), Usage: *usage}
+	if err := l.cache.get().SetWithTTL(l.key, entry, l.cache.ttl()); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to write %s cache: %s", l.cache.name, err.Error()))
+		return
+	}
+	l.cache.record(l.model, func(stats *ResponseCacheStats) { stats.Stored++ })
+}
+
+type responseCaptureWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *responseCaptureWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > responseCacheMaxBodyBytes {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+func (w *responseCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
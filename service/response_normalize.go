@@ -0,0 +1,71 @@
+package service
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseNormalizeWriter repairs mojibake and applies NFC to the response of channels with the
+// normalize_response_text setting. Streams are processed line by line so multi-byte characters are never
+// split, other responses are buffered until Finish.
+type ResponseNormalizeWriter struct {
+	gin.ResponseWriter
+	stream  bool
+	pending bytes.Buffer
+}
+
+func (w *ResponseNormalizeWriter) Write(data []byte) (int, error) {
+	w.pending.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	for {
+		idx := bytes.IndexByte(w.pending.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		if _, err := w.ResponseWriter.Write(common.NormalizeText(w.pending.Next(idx + 1))); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *ResponseNormalizeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// StartResponseNormalize wraps the writer when the selected channel enables response normalization,
+// it returns nil otherwise.
+func StartResponseNormalize(c *gin.Context, info *relaycommon.RelayInfo) *ResponseNormalizeWriter {
+	channelSetting, ok := common.GetContextKeyType[dto.ChannelSettings](c, constant.ContextKeyChannelSetting)
+	if !ok || !channelSetting.NormalizeResponseText {
+		return nil
+	}
+	writer := &ResponseNormalizeWriter{ResponseWriter: c.Writer, stream: info.IsStream}
+	c.Writer = writer
+	return writer
+}
+
+// Finish restores the original writer and sends what is still buffered.
+func (w *ResponseNormalizeWriter) Finish(c *gin.Context) {
+	if w == nil {
+		return
+	}
+	c.Writer = w.ResponseWriter
+	if w.pending.Len() == 0 {
+		return
+	}
+	body := common.NormalizeText(w.pending.Bytes())
+	if !w.stream && c.Writer.Header().Get("Content-Length") != "" {
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	_, _ = c.Writer.Write(body)
+}
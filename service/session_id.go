@@ -0,0 +1,60 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 会话 ID 用于按对话汇总消费，客户端可以通过请求头或请求体 metadata 中的 session_id / conversation_id 传递。
+// session_id 请求头与 Codex 等客户端发送的一致。
+var sessionIdHeaders = []string{"X-Session-Id", "X-Conversation-Id", "Session_id"}
+
+const maxSessionIdLength = 128
+
+// RecordSessionId saves the conversation the request belongs to, the consume log records it.
+func RecordSessionId(c *gin.Context, request dto.Request) {
+	sessionId := ""
+	for _, header := range sessionIdHeaders {
+		if sessionId = strings.TrimSpace(c.GetHeader(header)); sessionId != "" {
+			break
+		}
+	}
+	if sessionId == "" {
+		sessionId = sessionIdFromMetadata(request)
+	}
+	if sessionId == "" || len(sessionId) > maxSessionIdLength {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeySessionId, sessionId)
+}
+
+func sessionIdFromMetadata(request dto.Request) string {
+	var metadata json.RawMessage
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		metadata = r.Metadata
+	case *dto.OpenAIResponsesRequest:
+		metadata = r.Metadata
+	case *dto.ClaudeRequest:
+		metadata = r.Metadata
+	}
+	if len(metadata) == 0 {
+		return ""
+	}
+	var fields map[string]any
+	if err := common.Unmarshal(metadata, &fields); err != nil {
+		return ""
+	}
+	for _, key := range []string{"session_id", "conversation_id"} {
+		if value, ok := fields[key].(string); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
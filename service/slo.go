@@ -0,0 +1,377 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 按模型（以及模型下的渠道）统计滚动窗口内的成功率和延迟，计算错误预算的消耗速度（burn rate）：
+// 实际失败比例 / 目标允许的失败比例。客户端错误不计入统计。统计只保存在当前节点内存中，
+// 每个节点根据自己的数据告警和路由。
+
+var sloLatencyBucketsMs = []float64{250, 500, 1000, 2000, 3000, 5000, 7500, 10000, 15000, 20000, 30000, 60000, 120000}
+
+type sloMinute struct {
+	minute  int64
+	total   int64
+	failed  int64
+	slow    int64
+	latency []uint64 // 非累计，最后一个为 +Inf
+}
+
+// sloSeries keeps one bucket per minute of the window in a ring.
+type sloSeries struct {
+	mu      sync.Mutex
+	minutes []sloMinute
+}
+
+type sloCounts struct {
+	total   int64
+	failed  int64
+	slow    int64
+	latency []uint64
+}
+
+func newSLOSeries(windowMinutes int) *sloSeries {
+	return &sloSeries{minutes: make([]sloMinute, windowMinutes)}
+}
+
+func (s *sloSeries) record(now time.Time, failed bool, slow bool, latencyMs float64) {
+	minute := now.Unix() / 60
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := &s.minutes[minute%int64(len(s.minutes))]
+	if bucket.minute != minute || bucket.latency == nil {
+		*bucket = sloMinute{minute: minute, latency: make([]uint64, len(sloLatencyBucketsMs)+1)}
+	}
+	bucket.total++
+	if failed {
+		bucket.failed++
+		return
+	}
+	if slow {
+		bucket.slow++
+	}
+	bucket.latency[sort.SearchFloat64s(sloLatencyBucketsMs, latencyMs)]++
+}
+
+func (s *sloSeries) counts(now time.Time) sloCounts {
+	oldest := now.Unix()/60 - int64(len(s.minutes)) + 1
+	result := sloCounts{latency: make([]uint64, len(sloLatencyBucketsMs)+1)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bucket := range s.minutes {
+		if bucket.minute < oldest || bucket.latency == nil {
+			continue
+		}
+		result.total += bucket.total
+		result.failed += bucket.failed
+		result.slow += bucket.slow
+		for i, count := range bucket.latency {
+			result.latency[i] += count
+		}
+	}
+	return result
+}
+
+type sloChannelKey struct {
+	model     string
+	channelId int
+}
+
+var (
+	sloSeriesLock    sync.Mutex
+	sloModelSeries   = make(map[string]*sloSeries)
+	sloChannelSeries = make(map[sloChannelKey]*sloSeries)
+)
+
+func sloWindowMinutes() int {
+	window := operation_setting.GetSLOSetting().WindowMinutes
+	if window <= 0 {
+		return 60
+	}
+	return min(window, 24*60)
+}
+
+// getSLOSeries returns the series of the model, or of the channel when channelId is set.
+// Series are recreated when the window changes.
+func getSLOSeries(model string, channelId int) *sloSeries {
+	window := sloWindowMinutes()
+	sloSeriesLock.Lock()
+	defer sloSeriesLock.Unlock()
+	if channelId == 0 {
+		series, ok := sloModelSeries[model]
+		if !ok || len(series.minutes) != window {
+			series = newSLOSeries(window)
+			sloModelSeries[model] = series
+		}
+		return series
+	}
+	key := sloChannelKey{model: model, channelId: channelId}
+	series, ok := sloChannelSeries[key]
+	if !ok || len(series.minutes) != window {
+		series = newSLOSeries(window)
+		sloChannelSeries[key] = series
+	}
+	return series
+}
+
+// sloOutcome classifies a relay result. Client errors and client deadlines say nothing about the service
+// and are not counted.
+func sloOutcome(err *types.NewAPIError) (counted bool, failed bool) {
+	if err == nil {
+		return true, false
+	}
+	if err.GetErrorCode() == types.ErrorCodeRequestTimeout {
+		return false, false
+	}
+	if err.StatusCode == 0 || err.StatusCode >= http.StatusInternalServerError || err.StatusCode == http.StatusTooManyRequests {
+		return true, true
+	}
+	return false, false
+}
+
+// sloLatency uses the time to first response for streams and the full duration otherwise.
+func sloLatency(info *relaycommon.RelayInfo, start time.Time) time.Duration {
+	if info.IsStream && info.FirstResponseTime.After(start) {
+		return info.FirstResponseTime.Sub(start)
+	}
+	return time.Since(start)
+}
+
+func recordSLO(model string, channelId int, latency time.Duration, err *types.NewAPIError) {
+	target, ok := operation_setting.GetSLOTarget(model)
+	if !ok {
+		return
+	}
+	counted, failed := sloOutcome(err)
+	if !counted {
+		return
+	}
+	latencyMs := float64(latency.Milliseconds())
+	slow := target.LatencyMs > 0 && latencyMs > float64(target.LatencyMs)
+	getSLOSeries(model, channelId).record(time.Now(), failed, slow, latencyMs)
+}
+
+// RecordSLORequest records the final outcome of a relay request against the model's SLO.
+func RecordSLORequest(info *relaycommon.RelayInfo, err *types.NewAPIError) {
+	if info == nil {
+		return
+	}
+	recordSLO(info.OriginModelName, 0, sloLatency(info, info.StartTime), err)
+}
+
+// RecordSLOAttempt records the outcome of one channel attempt, used to spot channels burning the budget.
+func RecordSLOAttempt(info *relaycommon.RelayInfo, channelId int, start time.Time, err *types.NewAPIError) {
+	if info == nil || channelId == 0 {
+		return
+	}
+	recordSLO(info.OriginModelName, channelId, sloLatency(info, start), err)
+}
+
+type SLOStatus struct {
+	Model         string                      `json:"model"`
+	ChannelId     int                         `json:"channel_id,omitempty"`
+	Target        operation_setting.SLOTarget `json:"target"`
+	WindowMinutes int                         `json:"window_minutes"`
+	Requests      int64                       `json:"requests"`
+	Failed        int64                       `json:"failed"`
+	Slow          int64                       `json:"slow"`
+	SuccessRate   float64                     `json:"success_rate"`
+	// LatencyMs 目标分位的延迟估计值（桶上界），超出最大桶时为 -1
+	LatencyMs       float64 `json:"latency_ms"`
+	ErrorBurnRate   float64 `json:"error_burn_rate"`
+	LatencyBurnRate float64 `json:"latency_burn_rate"`
+	BurnRate        float64 `json:"burn_rate"`
+	// BudgetRemaining 窗口内剩余的错误预算比例，小于 0 表示已耗尽
+	BudgetRemaining float64     `json:"budget_remaining"`
+	Burning         bool        `json:"burning"`
+	Channels        []SLOStatus `json:"channels,omitempty"`
+}
+
+func buildSLOStatus(model string, channelId int, target operation_setting.SLOTarget, counts sloCounts) SLOStatus {
+	setting := operation_setting.GetSLOSetting()
+	status := SLOStatus{
+		Model:         model,
+		ChannelId:     channelId,
+		Target:        target,
+		WindowMinutes: sloWindowMinutes(),
+		Requests:      counts.total,
+		Failed:        counts.failed,
+		Slow:          counts.slow,
+		SuccessRate:   1,
+	}
+	if counts.total == 0 {
+		status.BudgetRemaining = 1
+		return status
+	}
+	status.SuccessRate = 1 - float64(counts.failed)/float64(counts.total)
+	status.LatencyMs = estimateSLOLatency(counts, target.LatencyPercentile)
+	if target.SuccessRate > 0 && target.SuccessRate < 1 {
+		status.ErrorBurnRate = (1 - status.SuccessRate) / (1 - target.SuccessRate)
+	}
+	if succeeded := counts.total - counts.failed; target.LatencyMs > 0 && succeeded > 0 {
+		status.LatencyBurnRate = float64(counts.slow) / float64(succeeded) / (1 - target.LatencyPercentile)
+	}
+	status.BurnRate = max(status.ErrorBurnRate, status.LatencyBurnRate)
+	status.BudgetRemaining = 1 - status.BurnRate
+	status.Burning = counts.total >= setting.MinRequests && setting.AlertBurnRate > 0 && status.BurnRate >= setting.AlertBurnRate
+	return status
+}
+
+func estimateSLOLatency(counts sloCounts, percentile float64) float64 {
+	var succeeded uint64
+	for _, count := range counts.latency {
+		succeeded += count
+	}
+	if succeeded == 0 {
+		return 0
+	}
+	threshold := percentile * float64(succeeded)
+	var cumulative uint64
+	for i, le := range sloLatencyBucketsMs {
+		cumulative += counts.latency[i]
+		if float64(cumulative) >= threshold {
+			return le
+		}
+	}
+	return -1
+}
+
+// GetSLOStatuses returns the error budget of every model with a target, including its channels.
+func GetSLOStatuses() []SLOStatus {
+	now := time.Now()
+	sloSeriesLock.Lock()
+	models := make(map[string]*sloSeries, len(sloModelSeries))
+	for model, series := range sloModelSeries {
+		models[model] = series
+	}
+	channels := make(map[sloChannelKey]*sloSeries, len(sloChannelSeries))
+	for key, series := range sloChannelSeries {
+		channels[key] = series
+	}
+	sloSeriesLock.Unlock()
+
+	statuses := make([]SLOStatus, 0)
+	for model := range operation_setting.GetSLOSetting().Targets {
+		target, ok := operation_setting.GetSLOTarget(model)
+		if !ok {
+			continue
+		}
+		counts := sloCounts{}
+		if series, ok := models[model]; ok {
+			counts = series.counts(now)
+		}
+		status := buildSLOStatus(model, 0, target, counts)
+		for key, series := range channels {
+			if key.model == model {
+				status.Channels = append(status.Channels, buildSLOStatus(model, key.channelId, target, series.counts(now)))
+			}
+		}
+		sort.Slice(status.Channels, func(i, j int) bool {
+			return status.Channels[i].ChannelId < status.Channels[j].ChannelId
+		})
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Model < statuses[j].Model
+	})
+	return statuses
+}
+
+// GetBurningChannels returns the channels of the model burning the error budget faster than the alert rate,
+// routing avoids them while other channels are available.
+func GetBurningChannels(model string) map[int]bool {
+	if !operation_setting.GetSLOSetting().DeprioritizeBurningChannels {
+		return nil
+	}
+	target, ok := operation_setting.GetSLOTarget(model)
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	sloSeriesLock.Lock()
+	channels := make(map[int]*sloSeries)
+	for key, series := range sloChannelSeries {
+		if key.model == model {
+			channels[key.channelId] = series
+		}
+	}
+	sloSeriesLock.Unlock()
+
+	var burning map[int]bool
+	for channelId, series := range channels {
+		if buildSLOStatus(model, channelId, target, series.counts(now)).Burning {
+			if burning == nil {
+				burning = make(map[int]bool)
+			}
+			burning[channelId] = true
+		}
+	}
+	return burning
+}
+
+var sloAlertOnce sync.Once
+
+// StartSLOAlertTask notifies the root user when a model starts or stops burning its error budget too fast.
+// Statistics are per node, so the task runs on all nodes.
+func StartSLOAlertTask() {
+	sloAlertOnce.Do(func() {
+		gopool.Go(func() {
+			node, _ := os.Hostname()
+			burning := make(map[string]bool)
+			for {
+				time.Sleep(time.Minute)
+				if !operation_setting.GetSLOSetting().Enabled {
+					continue
+				}
+				for _, status := range GetSLOStatuses() {
+					if status.Burning == burning[status.Model] {
+						continue
+					}
+					burning[status.Model] = status.Burning
+					subject := fmt.Sprintf("模型 %s 错误预算消耗过快", status.Model)
+					if !status.Burning {
+						subject = fmt.Sprintf("模型 %s 错误预算消耗已恢复正常", status.Model)
+					}
+					content := fmt.Sprintf("节点 %s 最近 %d 分钟：请求 %d，成功率 %.4f，P%.0f 延迟 %.0fms，消耗速度 %.2f 倍，剩余预算 %.2f%%",
+						node, status.WindowMinutes, status.Requests, status.SuccessRate, status.Target.LatencyPercentile*100,
+						status.LatencyMs, status.BurnRate, status.BudgetRemaining*100)
+					NotifyRootUser(dto.NotifyTypeSLOBurn, subject, content)
+				}
+			}
+		})
+	})
+}
+
+// WriteSLOMetrics exposes the burn rate and remaining budget of every model in the Prometheus text format.
+func WriteSLOMetrics(w io.Writer) error {
+	statuses := GetSLOStatuses()
+	if len(statuses) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	sb.WriteString("# HELP newapi_slo_burn_rate Error budget burn rate over the SLO window.\n# TYPE newapi_slo_burn_rate gauge\n")
+	for _, status := range statuses {
+		fmt.Fprintf(&sb, "newapi_slo_burn_rate{model=\"%s\"} %s\n", escapePrometheusLabel(status.Model), formatPrometheusFloat(status.BurnRate))
+	}
+	sb.WriteString("# HELP newapi_slo_budget_remaining Remaining error budget ratio over the SLO window.\n# TYPE newapi_slo_budget_remaining gauge\n")
+	for _, status := range statuses {
+		fmt.Fprintf(&sb, "newapi_slo_budget_remaining{model=\"%s\"} %s\n", escapePrometheusLabel(status.Model), formatPrometheusFloat(status.BudgetRemaining))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
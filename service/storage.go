@@ -0,0 +1,48 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/storage"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+var (
+	storageMu     sync.Mutex
+	storageConfig storage.Config
+	storageClient storage.Storage
+)
+
+func init() {
+	model.LogPayloadStorage = GetStorage
+}
+
+// GetStorage returns the object storage configured in the options, it is rebuilt when the options change.
+func GetStorage() (storage.Storage, error) {
+	setting := system_setting.GetStorageSetting()
+	config := storage.Config{
+		Driver:          setting.Driver,
+		LocalDir:        setting.LocalDir,
+		Endpoint:        setting.S3Endpoint,
+		Region:          setting.S3Region,
+		Bucket:          setting.S3Bucket,
+		AccessKeyId:     setting.S3AccessKeyId,
+		SecretAccessKey: setting.S3Secret,
+		PathStyle:       setting.S3PathStyle,
+		Prefix:          setting.Prefix,
+	}
+
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	if storageClient != nil && config == storageConfig {
+		return storageClient, nil
+	}
+	client, err := storage.New(config)
+	if err != nil {
+		return nil, err
+	}
+	storageConfig = config
+	storageClient = client
+	return client, nil
+}
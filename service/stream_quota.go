@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	relaycommon.StreamQuotaCheckpoint = checkpointStreamQuota
+	relaycommon.StreamHardCapCheck = checkStreamHardCap
+}
+
+// streamQuotaSoFar returns the cost of a running stream that has output completionTokens tokens, false when the
+// request is not billed by tokens from the wallet.
+func streamQuotaSoFar(info *relaycommon.RelayInfo, completionTokens int) (int, bool) {
+	if info.BillingSource == BillingSourceSubscription || info.IsPlayground {
+		return 0, false
+	}
+	priceData := info.PriceData
+	if priceData.UsePrice || priceData.FreeModel {
+		return 0, false
+	}
+	tokens := float64(info.GetEstimatePromptTokens()) + float64(completionTokens)*priceData.CompletionRatio
+	return int(tokens * priceData.ModelRatio * priceData.GroupRatioInfo.GroupRatio), true
+}
+
+// checkStreamHardCap fails once a running stream has cost the configured per request cap.
+func checkStreamHardCap(info *relaycommon.RelayInfo, completionTokens int) error {
+	quotaSetting := operation_setting.GetQuotaSetting()
+	if quotaSetting.StreamHardCapQuota <= 0 {
+		return nil
+	}
+	quota, ok := streamQuotaSoFar(info, completionTokens)
+	if ok && quotaSetting.ExceedsStreamHardCap(quota) {
+		return fmt.Errorf("单次请求额度已达到上限 %s", logger.FormatQuota(quotaSetting.StreamHardCapQuota))
+	}
+	return nil
+}
+
+// checkpointStreamQuota pre-consumes the part of the estimated cost of a running stream that exceeds the
+// quota pre-consumed so far, it fails once the user or the token can not cover it.
+// 最终结算时按实际用量与 FinalPreConsumedQuota 的差额多退少补
+func checkpointStreamQuota(c *gin.Context, info *relaycommon.RelayInfo, completionTokens int) error {
+	quota, ok := streamQuotaSoFar(info, completionTokens)
+	if !ok {
+		return nil
+	}
+	delta := quota - info.FinalPreConsumedQuota
+	if delta <= 0 {
+		return nil
+	}
+	userQuota, err := model.GetUserQuota(info.UserId, false)
+	if err != nil {
+		// 查询失败不中断输出，交给最终结算
+		logger.LogError(c, "stream quota checkpoint: "+err.Error())
+		return nil
+	}
+	if userQuota < delta {
+		return fmt.Errorf("用户额度不足, 剩余额度: %s", logger.FormatQuota(userQuota))
+	}
+	if err = PreConsumeTokenQuota(info, delta); err != nil {
+		return err
+	}
+	if err = model.DecreaseUserQuota(info.UserId, delta); err != nil {
+		// 用户额度未扣减，退回刚预扣的令牌额度，FinalPreConsumedQuota 保持不变
+		if rollbackErr := model.IncreaseTokenQuota(info.TokenId, info.TokenKey, delta); rollbackErr != nil {
+			logger.LogError(c, "stream quota checkpoint rollback: "+rollbackErr.Error())
+		}
+		return err
+	}
+	info.FinalPreConsumedQuota += delta
+	logger.LogInfo(c, fmt.Sprintf("用户 %d 流式输出追加预扣费 %s, 累计预扣费 %s", info.UserId, logger.FormatQuota(delta), logger.FormatQuota(info.FinalPreConsumedQuota)))
+	return nil
+}
+
+// ReserveStreamQuota returns the quota to pre-consume for the request: for a streaming request without max_tokens
+// the completion of the configured default length is reserved on top of the regular pre-consumption, so that the
+// stream starts with a hold close to its real cost. The hold is settled against the actual usage afterwards.
+func ReserveStreamQuota(c *gin.Context, info *relaycommon.RelayInfo, quotaToPreConsume int, meta *types.TokenCountMeta) int {
+	if !info.IsStream || meta == nil || info.PriceData.UsePrice || info.PriceData.FreeModel {
+		return quotaToPreConsume
+	}
+	reserveTokens := operation_setting.GetQuotaSetting().StreamReserveTokens(meta.MaxTokens)
+	if reserveTokens == 0 {
+		return quotaToPreConsume
+	}
+	priceData := info.PriceData
+	reserved := int(float64(reserveTokens) * priceData.CompletionRatio * priceData.ModelRatio * priceData.GroupRatioInfo.GroupRatio)
+	if reserved <= 0 {
+		return quotaToPreConsume
+	}
+	info.StreamReservedQuota = reserved
+	logger.LogInfo(c, fmt.Sprintf("流式请求未设置 max_tokens，按 %d 个输出 token 预留额度 %s", reserveTokens, logger.FormatQuota(reserved)))
+	return quotaToPreConsume + reserved
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// streamTokenSegmentBytes 累积到该长度后计数一段文本
+const streamTokenSegmentBytes = 1024
+
+// StreamTokenCounter counts the output tokens of a streamed response as the chunks pass through, so the text does
+// not have to be kept until the stream ends. The text is counted in segments cut before a space, where the
+// pre-tokenizer splits the text anyway, so the total matches counting the whole text at once.
+type StreamTokenCounter struct {
+	model   string
+	pending strings.Builder
+	tokens  int
+}
+
+func NewStreamTokenCounter(model string) *StreamTokenCounter {
+	return &StreamTokenCounter{model: model}
+}
+
+// WriteString adds the text of a chunk, it implements io.StringWriter.
+func (s *StreamTokenCounter) WriteString(text string) (int, error) {
+	s.pending.WriteString(text)
+	if s.pending.Len() >= streamTokenSegmentBytes {
+		s.flush(false)
+	}
+	return len(text), nil
+}
+
+func (s *StreamTokenCounter) flush(all bool) {
+	buffered := s.pending.String()
+	cut := len(buffered)
+	if !all {
+		cut = strings.LastIndexByte(buffered, ' ')
+		if cut <= 0 {
+			if len(buffered) < 4*streamTokenSegmentBytes {
+				return
+			}
+			// 没有空格的长文本（例如中文）按字符切分，保留最后一个字符
+			_, size := utf8.DecodeLastRuneInString(buffered)
+			cut = len(buffered) - size
+		}
+	}
+	s.tokens += CountTextToken(buffered[:cut], s.model)
+	s.pending.Reset()
+	s.pending.WriteString(buffered[cut:])
+}
+
+// Tokens returns the tokens of all the text added so far.
+func (s *StreamTokenCounter) Tokens() int {
+	if s.pending.Len() > 0 {
+		s.flush(true)
+	}
+	return s.tokens
+}
+
+// CountedTokens returns the tokens of the segments counted so far, the text still pending is left for Tokens, so
+// the running count can be read while the stream goes on without changing the total.
+func (s *StreamTokenCounter) CountedTokens() int {
+	return s.tokens
+}
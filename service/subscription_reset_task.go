@@ -88,6 +88,6 @@ func runSubscriptionQuotaResetOnce() {
 		}
 	}
 	if common.DebugEnabled && (totalReset > 0 || totalExpired > 0) {
-		logger.LogDebug(ctx, "subscription maintenance: reset_count=%d, expired_count=%d", totalReset, totalExpired)
+		logger.LogModuleDebug(ctx, logger.ModuleBilling, "subscription maintenance: reset_count=%d, expired_count=%d", totalReset, totalExpired)
 	}
 }
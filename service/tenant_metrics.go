@@ -0,0 +1,192 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// 按分组（租户）和模型统计的请求数与 token 用量，分别由 METRICS_GROUP_LABELS_ENABLED 与 METRICS_MODEL_LABELS_ENABLED 开启。
+// 输出时每个标签只保留请求数最多的 METRICS_LABEL_TOP_N 个取值，其余合并为 other，避免标签数量随租户和模型增长。
+
+const metricsOtherLabel = "other"
+
+type tenantMetricKey struct {
+	group string
+	model string
+}
+
+type tenantMetrics struct {
+	requests         uint64
+	promptTokens     uint64
+	completionTokens uint64
+}
+
+func (m *tenantMetrics) add(other *tenantMetrics) {
+	m.requests += other.requests
+	m.promptTokens += other.promptTokens
+	m.completionTokens += other.completionTokens
+}
+
+// tenantMetricsMap 与 relayMetricsMap 共用 relayMetricsLock
+var tenantMetricsMap = make(map[tenantMetricKey]*tenantMetrics)
+
+func tenantMetricsEnabled() bool {
+	return common.MetricsGroupLabelsEnabled || common.MetricsModelLabelsEnabled
+}
+
+// observeTenantMetrics must be called with relayMetricsLock held.
+func observeTenantMetrics(relayInfo *relaycommon.RelayInfo, promptTokens int, completionTokens int) {
+	if !tenantMetricsEnabled() {
+		return
+	}
+	key := tenantMetricKey{}
+	if common.MetricsGroupLabelsEnabled {
+		key.group = relayInfo.UsingGroup
+		if key.group == "" {
+			key.group = relayInfo.UserGroup
+		}
+	}
+	if common.MetricsModelLabelsEnabled {
+		key.model = relayInfo.OriginModelName
+	}
+	m, ok := tenantMetricsMap[key]
+	if !ok {
+		m = &tenantMetrics{}
+		tenantMetricsMap[key] = m
+	}
+	m.requests++
+	m.promptTokens += uint64(max(promptTokens, 0))
+	m.completionTokens += uint64(max(completionTokens, 0))
+}
+
+// topLabelValues returns the n label values with the most requests, nil when n is not positive or every value fits.
+func topLabelValues(requests map[string]uint64, n int) map[string]bool {
+	if n <= 0 || len(requests) <= n {
+		return nil
+	}
+	values := make([]string, 0, len(requests))
+	for value := range requests {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if requests[values[i]] != requests[values[j]] {
+			return requests[values[i]] > requests[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	top := make(map[string]bool, n)
+	for _, value := range values[:n] {
+		top[value] = true
+	}
+	return top
+}
+
+func limitLabelValue(value string, top map[string]bool) string {
+	if top == nil || top[value] {
+		return value
+	}
+	return metricsOtherLabel
+}
+
+// collectTenantMetrics folds the label values outside the top N into other, it must be called with relayMetricsLock held.
+func collectTenantMetrics() map[tenantMetricKey]*tenantMetrics {
+	groupRequests := make(map[string]uint64)
+	modelRequests := make(map[string]uint64)
+	for key, m := range tenantMetricsMap {
+		groupRequests[key.group] += m.requests
+		modelRequests[key.model] += m.requests
+	}
+	topGroups := topLabelValues(groupRequests, common.MetricsLabelTopN)
+	topModels := topLabelValues(modelRequests, common.MetricsLabelTopN)
+	collected := make(map[tenantMetricKey]*tenantMetrics, len(tenantMetricsMap))
+	for key, m := range tenantMetricsMap {
+		limited := tenantMetricKey{group: limitLabelValue(key.group, topGroups), model: limitLabelValue(key.model, topModels)}
+		c, ok := collected[limited]
+		if !ok {
+			c = &tenantMetrics{}
+			collected[limited] = c
+		}
+		c.add(m)
+	}
+	return collected
+}
+
+// collectUserMetrics keeps the users with the most requests and folds the rest into other, it must be called
+// with relayMetricsLock held.
+func collectUserMetrics() ([]string, map[string]*userMetrics) {
+	userRequests := make(map[string]uint64, len(userMetricsMap))
+	for userId, u := range userMetricsMap {
+		userRequests[strconv.Itoa(userId)] = u.requests
+	}
+	topUsers := topLabelValues(userRequests, common.MetricsLabelTopN)
+	collected := make(map[string]*userMetrics, len(userMetricsMap))
+	for userId, u := range userMetricsMap {
+		label := limitLabelValue(strconv.Itoa(userId), topUsers)
+		c, ok := collected[label]
+		if !ok {
+			c = &userMetrics{}
+			collected[label] = c
+		}
+		c.requests += u.requests
+		c.promptTokens += u.promptTokens
+		c.completionTokens += u.completionTokens
+	}
+	labels := make([]string, 0, len(collected))
+	for label := range collected {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		// other 排在最后，其余按用户 ID 排序
+		if labels[i] == metricsOtherLabel || labels[j] == metricsOtherLabel {
+			return labels[j] == metricsOtherLabel && labels[i] != metricsOtherLabel
+		}
+		a, _ := strconv.Atoi(labels[i])
+		b, _ := strconv.Atoi(labels[j])
+		return a < b
+	})
+	return labels, collected
+}
+
+func tenantMetricLabels(key tenantMetricKey) string {
+	labels := make([]string, 0, 2)
+	if common.MetricsGroupLabelsEnabled {
+		labels = append(labels, fmt.Sprintf("group=\"%s\"", escapePrometheusLabel(key.group)))
+	}
+	if common.MetricsModelLabelsEnabled {
+		labels = append(labels, fmt.Sprintf("model=\"%s\"", escapePrometheusLabel(key.model)))
+	}
+	return strings.Join(labels, ",")
+}
+
+// writeTenantMetrics must be called with relayMetricsLock held.
+func writeTenantMetrics(sb *strings.Builder) {
+	if !tenantMetricsEnabled() || len(tenantMetricsMap) == 0 {
+		return
+	}
+	collected := collectTenantMetrics()
+	keys := make([]tenantMetricKey, 0, len(collected))
+	for key := range collected {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].model < keys[j].model
+	})
+	sb.WriteString("# HELP newapi_tenant_requests_total Billed relay requests per group and model.\n# TYPE newapi_tenant_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(sb, "newapi_tenant_requests_total{%s} %d\n", tenantMetricLabels(key), collected[key].requests)
+	}
+	sb.WriteString("# HELP newapi_tenant_tokens_total Tokens of billed relay requests per group and model.\n# TYPE newapi_tenant_tokens_total counter\n")
+	for _, key := range keys {
+		m := collected[key]
+		fmt.Fprintf(sb, "newapi_tenant_tokens_total{%s,type=\"prompt\"} %d\n", tenantMetricLabels(key), m.promptTokens)
+		fmt.Fprintf(sb, "newapi_tenant_tokens_total{%s,type=\"completion\"} %d\n", tenantMetricLabels(key), m.completionTokens)
+	}
+}
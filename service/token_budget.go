@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// token 预算信封：agent 的首个请求携带 X-Budget-Id 和 X-Budget-Tokens 声明总预算，
+// 之后携带同一 X-Budget-Id 的请求都从该预算中扣除实际使用的 token，预算用尽后拒绝请求。
+// 预算按用户隔离，开启 Redis 时多节点共享，否则只保存在当前节点内存中。
+
+const (
+	HeaderBudgetId     = "X-Budget-Id"
+	HeaderBudgetTokens = "X-Budget-Tokens"
+)
+
+var tokenBudgetIdPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,64}$`)
+
+// TokenBudget 预算信封的总量和已用量
+type TokenBudget struct {
+	BudgetId    string `json:"budget_id"`
+	TotalTokens int64  `json:"total_tokens"`
+	UsedTokens  int64  `json:"used_tokens"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+// Remaining returns the tokens left in the envelope.
+func (b *TokenBudget) Remaining() int64 {
+	if b.UsedTokens >= b.TotalTokens {
+		return 0
+	}
+	return b.TotalTokens - b.UsedTokens
+}
+
+var (
+	tokenBudgets   = make(map[string]*TokenBudget)
+	tokenBudgetsMu sync.Mutex
+)
+
+func tokenBudgetKey(userId int, budgetId string) string {
+	return fmt.Sprintf("token_budget:%d:%s", userId, budgetId)
+}
+
+func tokenBudgetTTL() time.Duration {
+	minutes := operation_setting.GetTokenBudgetSetting().TTLMinutes
+	if minutes <= 0 {
+		minutes = 1440
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// CheckTokenBudget declares the budget envelope when the request carries a total, and rejects the request
+// when the envelope it draws from is used up, or would be by the estimated prompt tokens.
+func CheckTokenBudget(c *gin.Context, relayInfo *relaycommon.RelayInfo, promptTokens int) *types.NewAPIError {
+	setting := operation_setting.GetTokenBudgetSetting()
+	budgetId := c.GetHeader(HeaderBudgetId)
+	if !setting.Enabled || budgetId == "" {
+		return nil
+	}
+	if !tokenBudgetIdPattern.MatchString(budgetId) {
+		return types.NewErrorWithStatusCode(fmt.Errorf("invalid %s, expect 1-64 letters, digits or _.:-", HeaderBudgetId),
+			types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if totalHeader := c.GetHeader(HeaderBudgetTokens); totalHeader != "" {
+		total, err := strconv.ParseInt(totalHeader, 10, 64)
+		if err != nil || total <= 0 {
+			return types.NewErrorWithStatusCode(fmt.Errorf("invalid %s, expect a positive integer", HeaderBudgetTokens),
+				types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		if setting.MaxBudgetTokens > 0 && total > setting.MaxBudgetTokens {
+			return types.NewErrorWithStatusCode(fmt.Errorf("%s exceeds the limit of %d tokens", HeaderBudgetTokens, setting.MaxBudgetTokens),
+				types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		// 预算已存在时保持原有总量，子请求不能通过重复声明扩大预算
+		if err = declareTokenBudget(relayInfo.UserId, budgetId, total); err != nil {
+			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+		}
+	}
+	budget, err := GetTokenBudget(relayInfo.UserId, budgetId)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if budget == nil {
+		return types.NewErrorWithStatusCode(fmt.Errorf("token budget %s does not exist or has expired, declare it with %s", budgetId, HeaderBudgetTokens),
+			types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if budget.UsedTokens >= budget.TotalTokens || budget.UsedTokens+int64(promptTokens) > budget.TotalTokens {
+		logger.LogInfo(c, fmt.Sprintf("user %d token budget %s exhausted: used %d, total %d", relayInfo.UserId, budgetId, budget.UsedTokens, budget.TotalTokens))
+		return types.NewErrorWithStatusCode(
+			fmt.Errorf("token 预算 %s 已用尽（%d/%d）", budgetId, budget.UsedTokens, budget.TotalTokens),
+			types.ErrorCodeTokenBudgetExhausted,
+			http.StatusTooManyRequests,
+			types.ErrOptionWithSkipRetry(),
+		)
+	}
+	common.SetContextKey(c, constant.ContextKeyTokenBudgetId, budgetId)
+	return nil
+}
+
+// DrawTokenBudget deducts the tokens of a finished request from the budget envelope it was checked against.
+func DrawTokenBudget(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, tokens int) {
+	budgetId := common.GetContextKeyString(ctx, constant.ContextKeyTokenBudgetId)
+	if tokens <= 0 || budgetId == "" {
+		return
+	}
+	var err error
+	if common.RedisEnabled {
+		err = common.RedisHIncrBy(tokenBudgetKey(relayInfo.UserId, budgetId), "used", int64(tokens))
+	} else {
+		tokenBudgetsMu.Lock()
+		if budget, ok := tokenBudgets[tokenBudgetKey(relayInfo.UserId, budgetId)]; ok {
+			budget.UsedTokens += int64(tokens)
+		}
+		tokenBudgetsMu.Unlock()
+	}
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to draw token budget: user %d, budget %s, error: %s", relayInfo.UserId, budgetId, err.Error()))
+	}
+}
+
+func declareTokenBudget(userId int, budgetId string, total int64) error {
+	key := tokenBudgetKey(userId, budgetId)
+	ttl := tokenBudgetTTL()
+	expiresAt := time.Now().Add(ttl).Unix()
+	if common.RedisEnabled {
+		ctx := context.Background()
+		created, err := common.RDB.HSetNX(ctx, key, "total", total).Result()
+		if err != nil || !created {
+			return err
+		}
+		pipe := common.RDB.TxPipeline()
+		pipe.HSet(ctx, key, "used", 0, "expires_at", expiresAt)
+		pipe.Expire(ctx, key, ttl)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+	tokenBudgetsMu.Lock()
+	defer tokenBudgetsMu.Unlock()
+	now := time.Now().Unix()
+	for k, budget := range tokenBudgets {
+		if budget.ExpiresAt <= now {
+			delete(tokenBudgets, k)
+		}
+	}
+	if _, ok := tokenBudgets[key]; !ok {
+		tokenBudgets[key] = &TokenBudget{BudgetId: budgetId, TotalTokens: total, ExpiresAt: expiresAt}
+	}
+	return nil
+}
+
+// GetTokenBudget returns the budget envelope of the user, nil when it does not exist or has expired.
+func GetTokenBudget(userId int, budgetId string) (*TokenBudget, error) {
+	key := tokenBudgetKey(userId, budgetId)
+	if common.RedisEnabled {
+		values, err := common.RDB.HGetAll(context.Background(), key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if values["total"] == "" {
+			return nil, nil
+		}
+		budget := &TokenBudget{BudgetId: budgetId}
+		budget.TotalTokens, _ = strconv.ParseInt(values["total"], 10, 64)
+		budget.UsedTokens, _ = strconv.ParseInt(values["used"], 10, 64)
+		budget.ExpiresAt, _ = strconv.ParseInt(values["expires_at"], 10, 64)
+		return budget, nil
+	}
+	tokenBudgetsMu.Lock()
+	defer tokenBudgetsMu.Unlock()
+	budget, ok := tokenBudgets[key]
+	if !ok || budget.ExpiresAt <= time.Now().Unix() {
+		return nil, nil
+	}
+	item := *budget
+	return &item, nil
+}
@@ -9,7 +9,6 @@ import (
 	_ "image/png"
 	"log"
 	"math"
-	"path/filepath"
 	"strings"
 	"unicode/utf8"
 
@@ -18,6 +17,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	constant2 "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -213,28 +213,12 @@ func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *rela
 		return 0, nil
 	}
 	if info.RelayMode == constant2.RelayModeAudioTranscription || info.RelayMode == constant2.RelayModeAudioTranslation {
-		multiForm, err := common.ParseMultipartFormReusable(c)
+		seconds, err := AudioRequestSeconds(c)
 		if err != nil {
-			return 0, fmt.Errorf("error parsing multipart form: %v", err)
+			return 0, err
 		}
-		fileHeaders := multiForm.File["file"]
-		totalAudioToken := 0
-		for _, fileHeader := range fileHeaders {
-			file, err := fileHeader.Open()
-			if err != nil {
-				return 0, fmt.Errorf("error opening audio file: %v", err)
-			}
-			defer file.Close()
-			// get ext and io.seeker
-			ext := filepath.Ext(fileHeader.Filename)
-			duration, err := common.GetAudioDuration(c.Request.Context(), file, ext)
-			if err != nil {
-				return 0, fmt.Errorf("error getting audio duration: %v", err)
-			}
-			// 一分钟 1000 token，与 $price / minute 对齐
-			totalAudioToken += int(math.Round(math.Ceil(duration) / 60.0 * 1000))
-		}
-		return totalAudioToken, nil
+		// 一分钟 1000 token，与 $price / minute 对齐
+		return int(math.Round(seconds / 60.0 * 1000)), nil
 	}
 
 	model := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
@@ -437,12 +421,12 @@ func CountAudioTokenOutput(audioBase64 string, audioFormat string) (int, error)
 	return int(duration / 60 * 200 / 0.24), nil
 }
 
-// CountTextToken 统计文本的token数量，仅OpenAI模型使用tokenizer，其余模型使用估算
+// CountTextToken 统计文本的token数量，OpenAI模型和配置了词表的模型使用tokenizer，其余模型使用估算
 func CountTextToken(text string, model string) int {
 	if text == "" {
 		return 0
 	}
-	if common.IsOpenAITextModel(model) {
+	if common.IsOpenAITextModel(model) || operation_setting.GetTokenizerSetting().MatchEncoding(model) != nil {
 		tokenEncoder := getTokenEncoder(model)
 		return getTokenNum(tokenEncoder, text)
 	} else {
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+type TokenDryRunCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// TokenDryRunResult 令牌限制检查结果，不会请求上游也不会扣费
+type TokenDryRunResult struct {
+	Allowed bool               `json:"allowed"`
+	Group   string             `json:"group"`
+	Checks  []TokenDryRunCheck `json:"checks"`
+}
+
+func (r *TokenDryRunResult) add(name string, passed bool, message string) {
+	r.Checks = append(r.Checks, TokenDryRunCheck{Name: name, Passed: passed, Message: message})
+	if !passed {
+		r.Allowed = false
+	}
+}
+
+// DryRunToken evaluates the restrictions a relay request with the token would go through, without
+// side effects. clientIp is optional, the IP restriction is only checked when it is given.
+func DryRunToken(token *model.Token, modelName string, clientIp string) (*TokenDryRunResult, error) {
+	result := &TokenDryRunResult{Allowed: true, Checks: make([]TokenDryRunCheck, 0)}
+
+	result.add("status", token.Status == common.TokenStatusEnabled, "")
+	expired := token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp()
+	result.add("expiry", !expired, "")
+	result.add("quota", token.UnlimitedQuota || token.RemainQuota > 0, fmt.Sprintf("remain quota: %d", token.RemainQuota))
+
+	if allowIps := token.GetIpLimits(); len(allowIps) > 0 && clientIp != "" {
+		ip := net.ParseIP(clientIp)
+		result.add("ip", ip != nil && common.IsIpInCIDRList(ip, allowIps), clientIp)
+	}
+
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		return nil, err
+	}
+	result.add("user", userCache.Status == common.UserStatusEnabled, "")
+
+	group := userCache.Group
+	if token.Group != "" {
+		_, usable := GetUserUsableGroups(userCache.Group)[token.Group]
+		deprecated := token.Group != "auto" && !ratio_setting.ContainsGroupRatio(token.Group)
+		result.add("group", usable && !deprecated, token.Group)
+		group = token.Group
+	}
+	result.Group = group
+
+	if modelName == "" {
+		return result, nil
+	}
+	if token.ModelLimitsEnabled {
+		result.add("model_limits", token.GetModelLimitsMap()[modelName], modelName)
+	}
+	if group == "auto" {
+		result.add("model_available", true, "auto group, checked when the request is routed")
+	} else {
+		result.add("model_available", common.StringsContains(model.GetGroupEnabledModels(group), modelName), modelName)
+	}
+	return result, nil
+}
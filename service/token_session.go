@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 令牌使用来源分析：鉴权通过后记录客户端的 IP 段（IPv4 /24，IPv6 /48）、UA 类型和 CDN 提供的国家代码，
+// 先在内存中聚合，每分钟合并写入数据库。令牌在检测窗口内出现历史基线中没有的国家，
+// 或来自过多不同的 IP 段时视为疑似泄露，可配置为自动禁用令牌。
+
+const tokenSessionFlushInterval = time.Minute
+
+// uaFamilies UA 关键字到类型的映射，按顺序匹配，SDK 需要排在浏览器之前
+var uaFamilies = []struct {
+	keyword string
+	family  string
+}{
+	{"openai/python", "openai-python"},
+	{"openai/js", "openai-node"},
+	{"anthropic/python", "anthropic-python"},
+	{"anthropic/js", "anthropic-node"},
+	{"python-httpx", "httpx"},
+	{"python-requests", "python-requests"},
+	{"aiohttp", "aiohttp"},
+	{"go-http-client", "go"},
+	{"okhttp", "okhttp"},
+	{"axios", "axios"},
+	{"node-fetch", "node-fetch"},
+	{"curl", "curl"},
+	{"postman", "postman"},
+	{"edg/", "edge"},
+	{"chrome", "chrome"},
+	{"firefox", "firefox"},
+	{"safari", "safari"},
+}
+
+type tokenSessionKey struct {
+	TokenId  int
+	IpPrefix string
+	UaFamily string
+	Country  string
+}
+
+var (
+	tokenSessionBuffer   = make(map[tokenSessionKey]*model.TokenSession)
+	tokenSessionBufferMu sync.Mutex
+	tokenSessionOnce     sync.Once
+)
+
+// TokenAnomaly 疑似泄露的令牌及原因
+type TokenAnomaly struct {
+	TokenId            int      `json:"token_id"`
+	UserId             int      `json:"user_id"`
+	TokenName          string   `json:"token_name"`
+	Countries          []string `json:"countries"`
+	NewCountries       []string `json:"new_countries"`
+	DistinctIpPrefixes int      `json:"distinct_ip_prefixes"`
+	Reasons            []string `json:"reasons"`
+	Suspended          bool     `json:"suspended"`
+}
+
+// IpPrefix returns the coarse network of the ip: /24 for IPv4 and /48 for IPv6.
+func IpPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "unknown"
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// UaFamily returns the client family of the user agent, e.g. openai-python or chrome.
+func UaFamily(userAgent string) string {
+	if userAgent == "" {
+		return "unknown"
+	}
+	ua := strings.ToLower(userAgent)
+	for _, item := range uaFamilies {
+		if strings.Contains(ua, item.keyword) {
+			return item.family
+		}
+	}
+	return "other"
+}
+
+func getClientCountry(c *gin.Context) string {
+	for _, header := range operation_setting.GetTokenSessionSetting().CountryHeaders {
+		country := strings.ToUpper(strings.TrimSpace(c.GetHeader(header)))
+		// Cloudflare 使用 XX 表示未知，T1 表示 Tor
+		if country != "" && country != "XX" && len(country) <= 8 {
+			return country
+		}
+	}
+	return ""
+}
+
+// RecordTokenSession buffers the client attributes of an authenticated token request.
+func RecordTokenSession(c *gin.Context, tokenId int, userId int) {
+	if !operation_setting.GetTokenSessionSetting().Enabled || tokenId == 0 {
+		return
+	}
+	key := tokenSessionKey{
+		TokenId:  tokenId,
+		IpPrefix: IpPrefix(c.ClientIP()),
+		UaFamily: UaFamily(c.Request.UserAgent()),
+		Country:  getClientCountry(c),
+	}
+	now := common.GetTimestamp()
+	tokenSessionBufferMu.Lock()
+	defer tokenSessionBufferMu.Unlock()
+	session, ok := tokenSessionBuffer[key]
+	if !ok {
+		session = &model.TokenSession{
+			TokenId:   key.TokenId,
+			UserId:    userId,
+			IpPrefix:  key.IpPrefix,
+			UaFamily:  key.UaFamily,
+			Country:   key.Country,
+			FirstSeen: now,
+		}
+		tokenSessionBuffer[key] = session
+	}
+	session.LastSeen = now
+	session.Requests++
+}
+
+// StartTokenSessionTask flushes the buffered client records on every node, and prunes expired records on the master node.
+func StartTokenSessionTask() {
+	tokenSessionOnce.Do(func() {
+		gopool.Go(func() {
+			lastPrune := time.Now()
+			flushStart := common.GetTimestamp()
+			for {
+				time.Sleep(tokenSessionFlushInterval)
+				flushStart = flushTokenSessions(flushStart)
+				if common.IsMasterNode && time.Since(lastPrune) >= time.Hour {
+					lastPrune = time.Now()
+					pruneTokenSessions()
+				}
+			}
+		})
+	})
+}
+
+// flushTokenSessions writes the buffer to the database and returns the start of the next buffering period.
+func flushTokenSessions(flushStart int64) int64 {
+	tokenSessionBufferMu.Lock()
+	buffer := tokenSessionBuffer
+	tokenSessionBuffer = make(map[tokenSessionKey]*model.TokenSession)
+	tokenSessionBufferMu.Unlock()
+	next := common.GetTimestamp()
+	if len(buffer) == 0 {
+		return next
+	}
+	tokenIds := make(map[int]bool)
+	for _, session := range buffer {
+		if err := model.UpsertTokenSession(session); err != nil {
+			logger.LogError(context.Background(), fmt.Sprintf("failed to save token session of token %d: %s", session.TokenId, err.Error()))
+			continue
+		}
+		tokenIds[session.TokenId] = true
+	}
+	if operation_setting.GetTokenSessionSetting().AutoSuspend {
+		ids := make([]int, 0, len(tokenIds))
+		for id := range tokenIds {
+			ids = append(ids, id)
+		}
+		suspendLeakedTokens(ids, flushStart)
+	}
+	return next
+}
+
+func pruneTokenSessions() {
+	days := operation_setting.GetTokenSessionSetting().RetentionDays
+	if days <= 0 {
+		return
+	}
+	deleted, err := model.DeleteTokenSessionsBefore(time.Now().AddDate(0, 0, -days).Unix())
+	if err != nil {
+		logger.LogError(context.Background(), fmt.Sprintf("failed to prune token sessions: %s", err.Error()))
+		return
+	}
+	if deleted > 0 {
+		logger.LogInfo(context.Background(), fmt.Sprintf("pruned %d token sessions older than %d days", deleted, days))
+		model.RecordRetentionCleanup("token_session", deleted)
+	}
+}
+
+// evaluateTokenSessions checks the sessions of one token against the detection rules, only sessions first seen
+// at or after newSince count as evidence, so a token re-enabled by its owner is not suspended again for old clients.
+func evaluateTokenSessions(sessions []*model.TokenSession, windowStart int64, newSince int64) *TokenAnomaly {
+	setting := operation_setting.GetTokenSessionSetting()
+	baselineCountries := make(map[string]bool)
+	hasBaseline := false
+	countries := make(map[string]bool)
+	newCountries := make(map[string]bool)
+	ipPrefixes := make(map[string]bool)
+	hasNewSession := false
+	for _, session := range sessions {
+		if session.FirstSeen < windowStart {
+			hasBaseline = true
+			if session.Country != "" {
+				baselineCountries[session.Country] = true
+			}
+		}
+		if session.LastSeen < windowStart {
+			continue
+		}
+		ipPrefixes[session.IpPrefix] = true
+		if session.Country != "" {
+			countries[session.Country] = true
+		}
+		if session.FirstSeen >= newSince {
+			hasNewSession = true
+		}
+	}
+	if !hasNewSession {
+		return nil
+	}
+	for _, session := range sessions {
+		if session.LastSeen >= windowStart && session.FirstSeen >= newSince && session.Country != "" && !baselineCountries[session.Country] {
+			newCountries[session.Country] = true
+		}
+	}
+	anomaly := &TokenAnomaly{
+		TokenId:            sessions[0].TokenId,
+		UserId:             sessions[0].UserId,
+		Countries:          sortedKeys(countries),
+		NewCountries:       make([]string, 0),
+		DistinctIpPrefixes: len(ipPrefixes),
+		Reasons:            make([]string, 0),
+	}
+	if setting.AlertOnNewCountry && hasBaseline && len(newCountries) > 0 {
+		anomaly.NewCountries = sortedKeys(newCountries)
+		anomaly.Reasons = append(anomaly.Reasons, fmt.Sprintf("used from new countries: %s", strings.Join(anomaly.NewCountries, ", ")))
+	}
+	if setting.MaxDistinctIpPrefixes > 0 && len(ipPrefixes) > setting.MaxDistinctIpPrefixes {
+		anomaly.Reasons = append(anomaly.Reasons, fmt.Sprintf("used from %d distinct networks in %d hours", len(ipPrefixes), setting.WindowHours))
+	}
+	if len(anomaly.Reasons) == 0 {
+		return nil
+	}
+	return anomaly
+}
+
+func sortedKeys[V any](set map[string]V) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func tokenSessionWindowStart() int64 {
+	hours := operation_setting.GetTokenSessionSetting().WindowHours
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Now().Add(-time.Duration(hours) * time.Hour).Unix()
+}
+
+func detectTokenAnomalies(tokenIds []int, newSince int64) ([]*TokenAnomaly, error) {
+	sessions, err := model.GetTokenSessionsByTokenIds(tokenIds)
+	if err != nil {
+		return nil, err
+	}
+	byToken := make(map[int][]*model.TokenSession)
+	for _, session := range sessions {
+		byToken[session.TokenId] = append(byToken[session.TokenId], session)
+	}
+	windowStart := tokenSessionWindowStart()
+	anomalies := make([]*TokenAnomaly, 0)
+	for _, tokenSessions := range byToken {
+		anomaly := evaluateTokenSessions(tokenSessions, windowStart, newSince)
+		if anomaly == nil {
+			continue
+		}
+		if token, err := model.GetTokenById(anomaly.TokenId); err == nil {
+			anomaly.TokenName = token.Name
+			anomaly.Suspended = token.Status == common.TokenStatusDisabled
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].DistinctIpPrefixes > anomalies[j].DistinctIpPrefixes
+	})
+	return anomalies, nil
+}
+
+// DetectTokenAnomalies returns the tokens that look leaked within the detection window, limited to the user
+// when userId is not 0.
+func DetectTokenAnomalies(userId int) ([]*TokenAnomaly, error) {
+	windowStart := tokenSessionWindowStart()
+	tokenIds, err := model.GetActiveSessionTokenIds(userId, windowStart)
+	if err != nil {
+		return nil, err
+	}
+	return detectTokenAnomalies(tokenIds, windowStart)
+}
+
+// GetTokenSessions returns the client records of the token within the retention period.
+func GetTokenSessions(tokenId int) ([]*model.TokenSession, error) {
+	since := int64(0)
+	if days := operation_setting.GetTokenSessionSetting().RetentionDays; days > 0 {
+		since = time.Now().AddDate(0, 0, -days).Unix()
+	}
+	return model.GetTokenSessions(tokenId, since)
+}
+
+func suspendLeakedTokens(tokenIds []int, newSince int64) {
+	anomalies, err := detectTokenAnomalies(tokenIds, newSince)
+	if err != nil {
+		logger.LogError(context.Background(), fmt.Sprintf("failed to detect leaked tokens: %s", err.Error()))
+		return
+	}
+	for _, anomaly := range anomalies {
+		if anomaly.Suspended {
+			continue
+		}
+		if err = model.DisableTokenById(anomaly.TokenId); err != nil {
+			logger.LogError(context.Background(), fmt.Sprintf("failed to suspend token %d: %s", anomaly.TokenId, err.Error()))
+			continue
+		}
+		reason := strings.Join(anomaly.Reasons, "; ")
+		logger.LogWarn(context.Background(), fmt.Sprintf("token %d of user %d suspended as possibly leaked: %s", anomaly.TokenId, anomaly.UserId, reason))
+		model.RecordLog(anomaly.UserId, model.LogTypeSystem, fmt.Sprintf("令牌 %s 疑似泄露已被自动禁用：%s", anomaly.TokenName, reason))
+	}
+}
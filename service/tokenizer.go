@@ -4,15 +4,22 @@ import (
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
 	"github.com/tiktoken-go/tokenizer"
 	"github.com/tiktoken-go/tokenizer/codec"
 )
 
+// tokenCounter is implemented by the bundled codecs and the encoders loaded from tokenizer files
+type tokenCounter interface {
+	Count(text string) (int, error)
+}
+
 // tokenEncoderMap won't grow after initialization
-var defaultTokenEncoder tokenizer.Codec
+var defaultTokenEncoder tokenCounter
 
 // tokenEncoderMap is used to store token encoders for different models
-var tokenEncoderMap = make(map[string]tokenizer.Codec)
+var tokenEncoderMap = make(map[string]tokenCounter)
 
 // tokenEncoderMutex protects tokenEncoderMap for concurrent access
 var tokenEncoderMutex sync.RWMutex
@@ -23,7 +30,15 @@ func InitTokenEncoders() {
 	common.SysLog("token encoders initialized")
 }
 
-func getTokenEncoder(model string) tokenizer.Codec {
+func getTokenEncoder(model string) tokenCounter {
+	if encoding := operation_setting.GetTokenizerSetting().MatchEncoding(model); encoding != nil {
+		if encoder := getFallbackEncoder(*encoding); encoder != nil {
+			return encoder
+		}
+		// 配置的词表尚未加载完成时按默认词表估算
+		return defaultTokenEncoder
+	}
+
 	// First, try to get the encoder from cache with read lock
 	tokenEncoderMutex.RLock()
 	if encoder, exists := tokenEncoderMap[model]; exists {
@@ -54,7 +69,7 @@ func getTokenEncoder(model string) tokenizer.Codec {
 	return modelCodec
 }
 
-func getTokenNum(tokenEncoder tokenizer.Codec, text string) int {
+func getTokenNum(tokenEncoder tokenCounter, text string) int {
 	if text == "" {
 		return 0
 	}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/dlclark/regexp2"
+)
+
+// 内置词表（cl100k_base、o200k_base 等）随程序打包，不需要下载；
+// 设置中配置的额外词表在首次用到时从本地目录加载，目录中没有时在后台下载并校验 SHA-256，
+// 加载完成前相关模型按默认词表估算
+
+// cl100kPattern cl100k_base 的预分词规则
+const cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+
+const (
+	tokenizerDownloadTimeout = 2 * time.Minute
+	tokenizerMaxFileBytes    = 64 << 20
+	// tokenizerRetryInterval 加载失败后再次尝试的间隔
+	tokenizerRetryInterval = 10 * time.Minute
+)
+
+type fallbackEncoderState struct {
+	encoder  *bpeEncoder
+	loading  bool
+	failedAt time.Time
+}
+
+var (
+	fallbackEncoders     = make(map[string]*fallbackEncoderState)
+	fallbackEncodersLock sync.Mutex
+)
+
+// getFallbackEncoder returns the encoder of the configured encoding, nil while it is being loaded or after
+// loading failed.
+func getFallbackEncoder(encoding operation_setting.TokenizerEncoding) tokenCounter {
+	key := encoding.Name + "@" + strings.ToLower(encoding.SHA256) + "@" + encoding.Pattern
+	fallbackEncodersLock.Lock()
+	defer fallbackEncodersLock.Unlock()
+	state, ok := fallbackEncoders[key]
+	if !ok {
+		state = &fallbackEncoderState{}
+		fallbackEncoders[key] = state
+	}
+	if state.encoder != nil {
+		return state.encoder
+	}
+	if state.loading || (!state.failedAt.IsZero() && time.Since(state.failedAt) < tokenizerRetryInterval) {
+		return nil
+	}
+	state.loading = true
+	gopool.Go(func() {
+		encoder, err := loadFallbackEncoder(encoding, operation_setting.GetTokenizerSetting().Dir)
+		fallbackEncodersLock.Lock()
+		defer fallbackEncodersLock.Unlock()
+		state.loading = false
+		if err != nil {
+			state.failedAt = time.Now()
+			common.SysError(fmt.Sprintf("failed to load tokenizer %s: %s", encoding.Name, err.Error()))
+			return
+		}
+		state.encoder = encoder
+		common.SysLog(fmt.Sprintf("tokenizer %s loaded with %d tokens", encoding.Name, len(encoder.ranks)))
+	})
+	return nil
+}
+
+func loadFallbackEncoder(encoding operation_setting.TokenizerEncoding, dir string) (*bpeEncoder, error) {
+	if encoding.Name == "" || strings.ContainsAny(encoding.Name, `/\`) || strings.Contains(encoding.Name, "..") {
+		return nil, fmt.Errorf("invalid tokenizer name %q", encoding.Name)
+	}
+	path := filepath.Join(dir, encoding.Name+".tiktoken")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err = verifyTokenizerChecksum(data, encoding.SHA256); err != nil {
+			common.SysError(fmt.Sprintf("tokenizer file %s is corrupted: %s", path, err.Error()))
+			data = nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if data == nil {
+		if data, err = downloadTokenizer(encoding); err != nil {
+			return nil, err
+		}
+		if err = saveTokenizerFile(path, data); err != nil {
+			// 保存失败不影响使用，下次启动时重新下载
+			common.SysError(fmt.Sprintf("failed to save tokenizer file %s: %s", path, err.Error()))
+		}
+	}
+	ranks, err := parseTiktokenRanks(data)
+	if err != nil {
+		return nil, err
+	}
+	pattern := encoding.Pattern
+	if pattern == "" {
+		pattern = cl100kPattern
+	}
+	splitter, err := regexp2.Compile(pattern, regexp2.None)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tokenizer pattern: %w", err)
+	}
+	return &bpeEncoder{ranks: ranks, splitter: splitter}, nil
+}
+
+func downloadTokenizer(encoding operation_setting.TokenizerEncoding) ([]byte, error) {
+	if err := common.CheckOutboundAllowed("tokenizer download"); err != nil {
+		return nil, err
+	}
+	if encoding.URL == "" {
+		return nil, errors.New("tokenizer file not found and no download url is configured")
+	}
+	// 下载的文件必须能校验，避免使用被篡改或截断的词表
+	if encoding.SHA256 == "" {
+		return nil, errors.New("sha256 is required to download a tokenizer")
+	}
+	client := &http.Client{Timeout: tokenizerDownloadTimeout}
+	if shared := GetHttpClient(); shared != nil {
+		client.Transport = shared.Transport
+	}
+	resp, err := client.Get(encoding.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download tokenizer: unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, tokenizerMaxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > tokenizerMaxFileBytes {
+		return nil, fmt.Errorf("tokenizer file is larger than %d bytes", tokenizerMaxFileBytes)
+	}
+	if err = verifyTokenizerChecksum(data, encoding.SHA256); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func verifyTokenizerChecksum(data []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		return fmt.Errorf("sha256 mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// saveTokenizerFile 先写临时文件再重命名，避免留下不完整的词表
+func saveTokenizerFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// parseTiktokenRanks parses the tiktoken format, one "<base64 token> <rank>" per line.
+func parseTiktokenRanks(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid tokenizer line %d", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token on line %d: %w", line, err)
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(rank))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank on line %d: %w", line, err)
+		}
+		ranks[string(decoded)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, errors.New("tokenizer file is empty")
+	}
+	return ranks, nil
+}
+
+// bpeEncoder counts the tokens of a byte pair encoding loaded from a tiktoken file.
+type bpeEncoder struct {
+	ranks    map[string]int
+	splitter *regexp2.Regexp
+}
+
+func (e *bpeEncoder) Count(text string) (int, error) {
+	count := 0
+	match, err := e.splitter.FindStringMatch(text)
+	for match != nil && err == nil {
+		count += e.countPiece([]byte(match.String()))
+		match, err = e.splitter.FindNextMatch(match)
+	}
+	return count, err
+}
+
+// countPiece merges the adjacent parts with the lowest rank until no pair can be merged, as tiktoken does.
+func (e *bpeEncoder) countPiece(piece []byte) int {
+	if _, ok := e.ranks[string(piece)]; ok {
+		return 1
+	}
+	// bounds 各部分在 piece 中的起始位置，最后一项为 piece 的长度
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := e.ranks[string(piece[bounds[i]:bounds[i+2]])]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
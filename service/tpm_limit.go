@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每分钟 token 数（TPM）限流
+//
+// 每个限流对象（令牌、用户、分组）按自然分钟分桶计数，最近一分钟的用量按滑动窗口估算：
+// 当前分钟的计数加上一分钟计数按剩余比例折算。准入时计入预估的输入 token，流式输出时实时计入已输出的 token，
+// 结算时按实际用量补齐差额，请求失败时退回已计入的部分。
+
+func init() {
+	relaycommon.StreamTokensObserver = observeStreamTPM
+}
+
+type tpmScope struct {
+	key   string
+	label string
+	limit int
+}
+
+type tpmBucket struct {
+	scope  string
+	minute int64
+}
+
+var (
+	tpmBuckets           = make(map[tpmBucket]int64)
+	tpmBucketsMu         sync.Mutex
+	tpmBucketsCleanedFor int64
+)
+
+func tpmBucketKey(scope string, minute int64) string {
+	return fmt.Sprintf("tpm:%s:%d", scope, minute)
+}
+
+func tpmScopes(info *relaycommon.RelayInfo) []tpmScope {
+	setting := operation_setting.GetTPMLimitSetting()
+	scopes := make([]tpmScope, 0, 3)
+	if setting.TokenTPM > 0 && info.TokenId != 0 {
+		scopes = append(scopes, tpmScope{key: fmt.Sprintf("token:%d", info.TokenId), label: "令牌", limit: setting.TokenTPM})
+	}
+	if limit := setting.UserLimit(info.UserId); limit > 0 {
+		scopes = append(scopes, tpmScope{key: fmt.Sprintf("user:%d", info.UserId), label: "用户", limit: limit})
+	}
+	if limit := setting.GroupTPM[info.UsingGroup]; limit > 0 {
+		scopes = append(scopes, tpmScope{key: "group:" + info.UsingGroup, label: "分组", limit: limit})
+	}
+	return scopes
+}
+
+// tpmWindowUsage estimates the tokens of the scope in the last minute.
+func tpmWindowUsage(scope string, now time.Time) (int64, error) {
+	minute := now.Unix() / 60
+	var current, previous int64
+	if common.RedisEnabled {
+		values, err := common.RDB.MGet(context.Background(), tpmBucketKey(scope, minute), tpmBucketKey(scope, minute-1)).Result()
+		if err != nil {
+			return 0, err
+		}
+		if s, ok := values[0].(string); ok {
+			current, _ = strconv.ParseInt(s, 10, 64)
+		}
+		if s, ok := values[1].(string); ok {
+			previous, _ = strconv.ParseInt(s, 10, 64)
+		}
+	} else {
+		tpmBucketsMu.Lock()
+		current = tpmBuckets[tpmBucket{scope: scope, minute: minute}]
+		previous = tpmBuckets[tpmBucket{scope: scope, minute: minute - 1}]
+		tpmBucketsMu.Unlock()
+	}
+	elapsed := float64(now.Unix()%60) / 60
+	// 结算时的修正可能让单个桶为负，估算值不低于 0
+	return max(current+int64(float64(previous)*(1-elapsed)), 0), nil
+}
+
+func addTPMUsage(scopes []tpmScope, tokens int) {
+	if tokens == 0 || len(scopes) == 0 {
+		return
+	}
+	minute := time.Now().Unix() / 60
+	if common.RedisEnabled {
+		ctx := context.Background()
+		pipe := common.RDB.Pipeline()
+		for _, scope := range scopes {
+			key := tpmBucketKey(scope.key, minute)
+			pipe.IncrBy(ctx, key, int64(tokens))
+			pipe.Expire(ctx, key, 3*time.Minute)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError("failed to record tpm usage: " + err.Error())
+		}
+		return
+	}
+	tpmBucketsMu.Lock()
+	defer tpmBucketsMu.Unlock()
+	for _, scope := range scopes {
+		tpmBuckets[tpmBucket{scope: scope.key, minute: minute}] += int64(tokens)
+	}
+	// 每分钟清理一次不再参与计算的桶
+	if tpmBucketsCleanedFor != minute {
+		tpmBucketsCleanedFor = minute
+		for bucket := range tpmBuckets {
+			if bucket.minute < minute-1 {
+				delete(tpmBuckets, bucket)
+			}
+		}
+	}
+}
+
+// CheckTPMLimit admits the request when the estimated prompt tokens fit the tokens per minute limits of its token,
+// user and group, in queue mode it waits for the window to free up before rejecting.
+func CheckTPMLimit(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int) *types.NewAPIError {
+	setting := operation_setting.GetTPMLimitSetting()
+	if !setting.Enabled {
+		return nil
+	}
+	scopes := tpmScopes(info)
+	if len(scopes) == 0 {
+		return nil
+	}
+	start := time.Now()
+	deadline := start
+	queued := false
+	if setting.Mode == operation_setting.TPMLimitModeQueue && setting.MaxQueueSeconds > 0 {
+		deadline = deadline.Add(time.Duration(setting.MaxQueueSeconds) * time.Second)
+	}
+	for {
+		now := time.Now()
+		exceeded, remaining, err := checkTPMScopes(scopes, promptTokens, now)
+		if err != nil {
+			// 计数不可用时放行，避免 Redis 故障导致全部请求失败
+			logger.LogError(c, "tpm limit check failed: "+err.Error())
+			return nil
+		}
+		if exceeded == nil {
+			if queued {
+				addRequestQueueWait(c, now.Sub(start))
+			}
+			c.Header("x-ratelimit-limit-tokens", strconv.Itoa(scopes[0].limit))
+			c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(max(remaining-int64(promptTokens), 0), 10))
+			addTPMUsage(scopes, promptTokens)
+			common.SetContextKey(c, constant.ContextKeyTPMCountedTokens, promptTokens)
+			return nil
+		}
+		if !now.Before(deadline) {
+			retryAfter := 60 - now.Unix()%60
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			c.Header("x-ratelimit-limit-tokens", strconv.Itoa(exceeded.limit))
+			c.Header("x-ratelimit-remaining-tokens", "0")
+			c.Header("x-ratelimit-reset-tokens", fmt.Sprintf("%ds", retryAfter))
+			newAPIError := types.NewErrorWithStatusCode(
+				fmt.Errorf("%s已达到每分钟 token 数限制：每分钟最多 %d 个 token", exceeded.label, exceeded.limit),
+				types.ErrorCodeTPMLimitExceeded,
+				http.StatusTooManyRequests,
+				types.ErrOptionWithSkipRetry(),
+			)
+			newAPIError.RetryAfter = time.Duration(retryAfter) * time.Second
+			return newAPIError
+		}
+		queued = true
+		select {
+		case <-c.Request.Context().Done():
+			return types.NewErrorWithStatusCode(c.Request.Context().Err(), types.ErrorCodeTPMLimitExceeded,
+				http.StatusTooManyRequests, types.ErrOptionWithSkipRetry())
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// checkTPMScopes returns the first scope the prompt tokens do not fit, and the smallest remaining tokens otherwise.
+func checkTPMScopes(scopes []tpmScope, promptTokens int, now time.Time) (*tpmScope, int64, error) {
+	remaining := int64(-1)
+	for i := range scopes {
+		used, err := tpmWindowUsage(scopes[i].key, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		left := int64(scopes[i].limit) - used
+		// 单个请求超过上限时，窗口为空即放行，否则永远无法通过
+		if left < int64(promptTokens) && used > 0 {
+			return &scopes[i], 0, nil
+		}
+		if remaining < 0 || left < remaining {
+			remaining = left
+		}
+	}
+	return nil, remaining, nil
+}
+
+// observeStreamTPM counts the output tokens the stream handler has counted so far, the same count the settlement
+// starts from, so concurrent requests see the output before it is settled.
+func observeStreamTPM(c *gin.Context, info *relaycommon.RelayInfo, completionTokens int) {
+	if !operation_setting.GetTPMLimitSetting().Enabled {
+		return
+	}
+	counted, ok := common.GetContextKeyType[int](c, constant.ContextKeyTPMCountedTokens)
+	if !ok {
+		return
+	}
+	total := info.GetEstimatePromptTokens() + completionTokens
+	if total <= counted {
+		return
+	}
+	addTPMUsage(tpmScopes(info), total-counted)
+	common.SetContextKey(c, constant.ContextKeyTPMCountedTokens, total)
+}
+
+// SettleTPMUsage corrects the counted tokens of an admitted request to its actual usage.
+func SettleTPMUsage(c *gin.Context, info *relaycommon.RelayInfo, tokens int) {
+	counted, ok := common.GetContextKeyType[int](c, constant.ContextKeyTPMCountedTokens)
+	if !ok {
+		return
+	}
+	addTPMUsage(tpmScopes(info), tokens-counted)
+	common.SetContextKey(c, constant.ContextKeyTPMCountedTokens, tokens)
+}
+
+// ReleaseTPMUsage gives back the tokens counted for a request that failed.
+func ReleaseTPMUsage(c *gin.Context, info *relaycommon.RelayInfo) {
+	SettleTPMUsage(c, info, 0)
+}
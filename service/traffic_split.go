@@ -0,0 +1,57 @@
+package service
+
+import (
+	"math/rand"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TrafficSplitArmBaseline  = "baseline"
+	TrafficSplitArmCandidate = "candidate"
+)
+
+// SelectTrafficSplitChannel picks the baseline or the candidate channel of the A/B rule of the model, the
+// candidate receives the configured percentage of the requests. When the chosen channel can't serve the request
+// the other one is used, and nil is returned when neither can so the request is routed as usual.
+//
+// For a rule in shadow mode no channel is picked; the sampled requests are marked to be mirrored to the
+// candidate once they succeed.
+func SelectTrafficSplitChannel(c *gin.Context, usingGroup string, modelName string) (*model.Channel, string) {
+	rule := operation_setting.GetTrafficSplitSetting().GetRule(modelName)
+	if rule == nil {
+		return nil, usingGroup
+	}
+	sampled := rand.Intn(100) < rule.Percent
+	if rule.Shadow {
+		if sampled {
+			common.SetContextKey(c, constant.ContextKeyTrafficMirrorChannelId, rule.CandidateChannelId)
+		}
+		return nil, usingGroup
+	}
+	arms := []string{TrafficSplitArmBaseline, TrafficSplitArmCandidate}
+	if sampled {
+		arms = []string{TrafficSplitArmCandidate, TrafficSplitArmBaseline}
+	}
+	for _, arm := range arms {
+		channelId := rule.ChannelId
+		if arm == TrafficSplitArmCandidate {
+			channelId = rule.CandidateChannelId
+		}
+		if channelId == 0 {
+			continue
+		}
+		if channel, selectGroup := GetPinnedChannel(c, usingGroup, modelName, channelId); channel != nil {
+			common.SetContextKey(c, constant.ContextKeyTrafficSplitArm, arm)
+			return channel, selectGroup
+		}
+		logger.LogDebug(c, "Traffic split %s channel #%d of model %s is not available", arm, channelId, modelName)
+	}
+	return nil, usingGroup
+}
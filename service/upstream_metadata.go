@@ -0,0 +1,43 @@
+package service
+
+import (
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ServedModelHeader       = "X-New-Api-Served-Model"
+	SystemFingerprintHeader = "X-New-Api-System-Fingerprint"
+)
+
+// SetUpstreamMetadataHeaders exposes the upstream metadata as response headers, so clients get it
+// in the same place regardless of the response format. Streaming responses have already sent their
+// headers by the time the metadata is known, so for them it is only recorded in the log.
+func SetUpstreamMetadataHeaders(c *gin.Context, info *relaycommon.RelayInfo) {
+	if c == nil || c.Writer == nil || info == nil || c.Writer.Written() {
+		return
+	}
+	if info.UpstreamMetadata.ServedModel != "" {
+		c.Writer.Header().Set(ServedModelHeader, info.UpstreamMetadata.ServedModel)
+	}
+	if info.UpstreamMetadata.SystemFingerprint != "" {
+		c.Writer.Header().Set(SystemFingerprintHeader, info.UpstreamMetadata.SystemFingerprint)
+	}
+}
+
+// appendUpstreamMetadata records the upstream metadata into log info, the aggregator provider is admin only.
+func appendUpstreamMetadata(relayInfo *relaycommon.RelayInfo, other map[string]interface{}, adminInfo map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.UpstreamMetadata.IsEmpty() {
+		return
+	}
+	if relayInfo.UpstreamMetadata.SystemFingerprint != "" {
+		other["system_fingerprint"] = relayInfo.UpstreamMetadata.SystemFingerprint
+	}
+	if relayInfo.UpstreamMetadata.ServedModel != "" {
+		other["served_model"] = relayInfo.UpstreamMetadata.ServedModel
+	}
+	if relayInfo.UpstreamMetadata.Provider != "" && adminInfo != nil {
+		adminInfo["upstream_provider"] = relayInfo.UpstreamMetadata.Provider
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上游限流的重置时间超过该值时按该值冷却，避免配置错误的上游长期占用渠道
+const maxUpstreamRateLimitCooldown = 24 * time.Hour
+
+var (
+	// OpenAI 错误信息中的等待时间，例如 "Please try again in 1.5s" / "in 120ms" / "in 6m0s"
+	openAITryAgainPattern = regexp.MustCompile(`(?i)try again in ((?:\d+(?:\.\d+)?(?:ms|h|m|s))+)`)
+	// OpenAI 重置时间的简写，例如 "1d2h3m4.5s"，time.ParseDuration 不支持 d
+	openAIResetDayPattern = regexp.MustCompile(`^(\d+)d(.*)$`)
+)
+
+// ParseUpstreamRetryAfter reads how long until the upstream rate limit resets from the headers and error body of a
+// 429 response: the standard Retry-After header, the OpenAI and Anthropic rate limit headers, the Gemini RetryInfo
+// detail and the wait time in the OpenAI error message. It returns 0 when the response does not tell.
+func ParseUpstreamRetryAfter(header http.Header, body []byte) time.Duration {
+	now := time.Now()
+	if d := parseRetryAfterHeader(header, now); d > 0 {
+		return d
+	}
+	if d := parseAnthropicRateLimitReset(header, now); d > 0 {
+		return d
+	}
+	if d := parseOpenAIRateLimitReset(header); d > 0 {
+		return d
+	}
+	if d := parseGeminiRetryDelay(body); d > 0 {
+		return d
+	}
+	if match := openAITryAgainPattern.FindSubmatch(body); match != nil {
+		if d, err := time.ParseDuration(string(match[1])); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func parseRetryAfterHeader(header http.Header, now time.Time) time.Duration {
+	if v := header.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	v := strings.TrimSpace(header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// parseAnthropicRateLimitReset uses the reset time of the exhausted limits, or the latest reset when none is
+// reported as exhausted. Anthropic reports RFC 3339 timestamps.
+func parseAnthropicRateLimitReset(header http.Header, now time.Time) time.Duration {
+	var exhausted, latest time.Duration
+	for _, limit := range []string{"requests", "tokens", "input-tokens", "output-tokens"} {
+		v := header.Get("anthropic-ratelimit-" + limit + "-reset")
+		if v == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			continue
+		}
+		d := at.Sub(now)
+		latest = max(latest, d)
+		if header.Get("anthropic-ratelimit-"+limit+"-remaining") == "0" {
+			exhausted = max(exhausted, d)
+		}
+	}
+	if exhausted > 0 {
+		return exhausted
+	}
+	return latest
+}
+
+// parseOpenAIRateLimitReset uses the reset duration of the exhausted limits, or the latest reset when none is
+// reported as exhausted. OpenAI reports durations like "1s", "6m0s" or "20ms".
+func parseOpenAIRateLimitReset(header http.Header) time.Duration {
+	var exhausted, latest time.Duration
+	for _, limit := range []string{"requests", "tokens"} {
+		v := header.Get("x-ratelimit-reset-" + limit)
+		if v == "" {
+			continue
+		}
+		d := parseOpenAIResetDuration(v)
+		latest = max(latest, d)
+		if header.Get("x-ratelimit-remaining-"+limit) == "0" {
+			exhausted = max(exhausted, d)
+		}
+	}
+	if exhausted > 0 {
+		return exhausted
+	}
+	return latest
+}
+
+func parseOpenAIResetDuration(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	var days time.Duration
+	if match := openAIResetDayPattern.FindStringSubmatch(v); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		days = time.Duration(n) * 24 * time.Hour
+		v = match[2]
+		if v == "" {
+			return days
+		}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		// 部分兼容上游直接返回秒数
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+	return days + d
+}
+
+// parseGeminiRetryDelay reads the google.rpc.RetryInfo detail of a Gemini error, e.g. {"retryDelay": "32s"}.
+func parseGeminiRetryDelay(body []byte) time.Duration {
+	if len(body) == 0 || !strings.Contains(string(body), "RetryInfo") {
+		return 0
+	}
+	var errResponse struct {
+		Error struct {
+			Details []struct {
+				Type       string `json:"@type"`
+				RetryDelay string `json:"retryDelay"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := common.Unmarshal(body, &errResponse); err != nil {
+		return 0
+	}
+	for _, detail := range errResponse.Error.Details {
+		if strings.HasSuffix(detail.Type, "google.rpc.RetryInfo") && detail.RetryDelay != "" {
+			if d, err := time.ParseDuration(detail.RetryDelay); err == nil {
+				return d
+			}
+		}
+	}
+	return 0
+}
+
+// ApplyUpstreamRateLimitCooldown keeps the key of the channel out of rotation until the upstream rate limit resets.
+func ApplyUpstreamRateLimitCooldown(c *gin.Context, channel *model.Channel, keyIndex int, apiErr *types.NewAPIError) {
+	if apiErr == nil || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter <= 0 || channel == nil {
+		return
+	}
+	cooldown := min(apiErr.RetryAfter, maxUpstreamRateLimitCooldown)
+	model.SetChannelKeyCooldown(channel, keyIndex, time.Now().Add(cooldown))
+	logger.LogWarn(c, fmt.Sprintf("channel #%d key #%d is rate limited upstream, cooling down for %s", channel.Id, keyIndex, cooldown))
+}
+
+// NewChannelCooldownError is returned instead of calling the upstream of a key still cooling down,
+// so the request fails over to another channel or tells the client when to retry.
+func NewChannelCooldownError(channelId int, until time.Time) *types.NewAPIError {
+	apiErr := types.NewErrorWithStatusCode(
+		fmt.Errorf("upstream rate limit of channel #%d resets at %s", channelId, until.Format(time.RFC3339)),
+		types.ErrorCodeUpstreamRateLimited, http.StatusTooManyRequests, types.ErrOptionWithNoRecordErrorLog())
+	apiErr.RetryAfter = time.Until(until)
+	return apiErr
+}
+
+// RetryAfterSeconds rounds the wait time up to whole seconds for the Retry-After header.
+func RetryAfterSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
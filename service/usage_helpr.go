@@ -20,10 +20,15 @@ import (
 //}
 
 func ResponseText2Usage(c *gin.Context, responseText string, modeName string, promptTokens int) *dto.Usage {
+	return CompletionTokens2Usage(c, CountTextToken(responseText, modeName), promptTokens)
+}
+
+// CompletionTokens2Usage builds the usage from the completion tokens counted locally when the upstream reports none.
+func CompletionTokens2Usage(c *gin.Context, completionTokens int, promptTokens int) *dto.Usage {
 	common.SetContextKey(c, constant.ContextKeyLocalCountTokens, true)
 	usage := &dto.Usage{}
 	usage.PromptTokens = promptTokens
-	usage.CompletionTokens = EstimateTokenByModel(modeName, responseText)
+	usage.CompletionTokens = completionTokens
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	return usage
 }
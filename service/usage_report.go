@@ -0,0 +1,504 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 用量报告和账单：从按天汇总的消费生成，用户报告按令牌、分组和模型汇总，分组报告按用户和模型汇总，
+// 全站报告按分组和模型汇总。每行附带生成时的价格快照，金额按实际扣除的额度换算为报告货币。
+
+const (
+	UsageReportScopeUser  = "user"
+	UsageReportScopeGroup = "group"
+	UsageReportScopeAll   = "all"
+)
+
+// usageReportEmailMaxLines 邮件正文中最多列出的明细行数，完整明细见附件
+const usageReportEmailMaxLines = 20
+
+type UsageReportLine struct {
+	UserId           int     `json:"user_id,omitempty"`
+	Username         string  `json:"username,omitempty"`
+	TokenId          int     `json:"token_id,omitempty"`
+	TokenName        string  `json:"token_name,omitempty"`
+	Group            string  `json:"group,omitempty"`
+	ModelName        string  `json:"model_name,omitempty"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Quota            int64   `json:"quota"`
+	Amount           float64 `json:"amount"`
+	// 价格快照（报告货币），按次计费的模型为 RequestPrice，其余为每百万输入、输出 token 的价格，已含分组倍率
+	GroupRatio   float64 `json:"group_ratio,omitempty"`
+	InputPrice   float64 `json:"input_price,omitempty"`
+	OutputPrice  float64 `json:"output_price,omitempty"`
+	RequestPrice float64 `json:"request_price,omitempty"`
+}
+
+type UsageReport struct {
+	Scope          string             `json:"scope"`
+	Subject        string             `json:"subject"`
+	UserId         int                `json:"user_id,omitempty"`
+	TokenId        int                `json:"token_id,omitempty"`
+	Group          string             `json:"group,omitempty"`
+	StartTime      int64              `json:"start_time"`
+	EndTime        int64              `json:"end_time"`
+	GeneratedAt    int64              `json:"generated_at"`
+	Currency       string             `json:"currency"`
+	CurrencySymbol string             `json:"currency_symbol"`
+	ExchangeRate   float64            `json:"exchange_rate"`
+	Lines          []*UsageReportLine `json:"lines"`
+	Total          UsageReportLine    `json:"total"`
+}
+
+type UsageReportRequest struct {
+	Scope     string
+	UserId    int
+	TokenId   int
+	Group     string
+	StartTime int64
+	EndTime   int64
+}
+
+// BuildUsageReport summarizes the consumption of the days starting in [StartTime, EndTime) for a user, optionally
+// one token of the user, a group or the whole site.
+func BuildUsageReport(req UsageReportRequest) (*UsageReport, error) {
+	setting := operation_setting.GetUsageReportSetting()
+	currency, symbol, rate := setting.CurrencyInfo()
+	report := &UsageReport{
+		Scope:          req.Scope,
+		UserId:         req.UserId,
+		TokenId:        req.TokenId,
+		Group:          req.Group,
+		StartTime:      req.StartTime,
+		EndTime:        req.EndTime,
+		GeneratedAt:    common.GetTimestamp(),
+		Currency:       currency,
+		CurrencySymbol: symbol,
+		ExchangeRate:   rate,
+		Lines:          make([]*UsageReportLine, 0),
+	}
+	query := model.UsageReportQuery{StartTime: req.StartTime, EndTime: req.EndTime, TokenId: req.TokenId}
+	switch req.Scope {
+	case UsageReportScopeUser:
+		if req.UserId == 0 {
+			return nil, errors.New("用户 ID 为空")
+		}
+		user, err := model.GetUserById(req.UserId, false)
+		if err != nil {
+			return nil, err
+		}
+		report.Subject = user.Username
+		query.UserId = req.UserId
+		query.GroupBy = []string{"token", "group", "model"}
+	case UsageReportScopeGroup:
+		if req.Group == "" {
+			return nil, errors.New("分组为空")
+		}
+		report.Subject = req.Group
+		query.Group = req.Group
+		query.GroupBy = []string{"user", "model"}
+	case UsageReportScopeAll:
+		report.Subject = common.SystemName
+		query.GroupBy = []string{"group", "model"}
+	default:
+		return nil, fmt.Errorf("unsupported report scope %q", req.Scope)
+	}
+	rows, err := model.QueryUsageReportRollups(query)
+	if err != nil {
+		return nil, err
+	}
+
+	total := &report.Total
+	for _, row := range rows {
+		line := &UsageReportLine{
+			UserId:           row.UserId,
+			Username:         row.Username,
+			TokenId:          row.TokenId,
+			TokenName:        row.TokenName,
+			Group:            row.UsingGroup,
+			ModelName:        row.ModelName,
+			Requests:         row.RequestCount,
+			PromptTokens:     row.PromptTokens,
+			CompletionTokens: row.CompletionTokens,
+			Quota:            row.Quota,
+			Amount:           float64(row.Quota) / common.QuotaPerUnit * rate,
+		}
+		if req.Scope == UsageReportScopeUser {
+			line.UserId, line.Username = req.UserId, report.Subject
+		}
+		if line.Group == "" {
+			line.Group = req.Group
+		}
+		fillUsageReportPrice(line, rate)
+		report.Lines = append(report.Lines, line)
+		total.Requests += line.Requests
+		total.PromptTokens += line.PromptTokens
+		total.CompletionTokens += line.CompletionTokens
+		total.Quota += line.Quota
+	}
+	total.Amount = float64(total.Quota) / common.QuotaPerUnit * rate
+	return report, nil
+}
+
+// fillUsageReportPrice records the current price of the model in the group, ratio 1 is $2 per million tokens.
+func fillUsageReportPrice(line *UsageReportLine, rate float64) {
+	groupRatio := 1.0
+	if line.Group != "" {
+		groupRatio = ratio_setting.GetGroupRatio(line.Group)
+	}
+	line.GroupRatio = groupRatio
+	if price, ok := ratio_setting.GetModelPrice(line.ModelName, false); ok {
+		line.RequestPrice = price * groupRatio * rate
+		return
+	}
+	modelRatio, _, _ := ratio_setting.GetModelRatio(line.ModelName)
+	line.InputPrice = modelRatio * 2 * groupRatio * rate
+	line.OutputPrice = line.InputPrice * ratio_setting.GetCompletionRatio(line.ModelName)
+}
+
+func (r *UsageReport) periodText() string {
+	// 结束时间为下一天的零点，展示为最后一天
+	return fmt.Sprintf("%s ~ %s", time.Unix(r.StartTime, 0).Format("2006-01-02"), time.Unix(r.EndTime-1, 0).Format("2006-01-02"))
+}
+
+func (r *UsageReport) Title() string {
+	return fmt.Sprintf("%s 用量报告 %s（%s）", r.Subject, r.periodText(), r.Scope)
+}
+
+// Filename returns the export file name with the extension.
+func (r *UsageReport) Filename(ext string) string {
+	subject := r.Scope
+	switch r.Scope {
+	case UsageReportScopeUser:
+		subject = fmt.Sprintf("user-%d", r.UserId)
+	case UsageReportScopeGroup:
+		subject = "group-" + r.Group
+	}
+	return fmt.Sprintf("usage-%s-%s-%s.%s", subject,
+		time.Unix(r.StartTime, 0).Format("20060102"), time.Unix(r.EndTime-1, 0).Format("20060102"), ext)
+}
+
+func (r *UsageReport) formatAmount(amount float64) string {
+	return r.CurrencySymbol + strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// CSV writes the lines and the total row with the price snapshot.
+func (r *UsageReport) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{"user_id", "username", "token_id", "token_name", "group", "model_name", "requests",
+		"prompt_tokens", "completion_tokens", "quota", "amount", "currency", "group_ratio",
+		"input_price_per_1m", "output_price_per_1m", "request_price"})
+	lines := append(r.Lines, &r.Total)
+	for i, line := range lines {
+		userId := strconv.Itoa(line.UserId)
+		if i == len(lines)-1 {
+			userId = "total"
+		}
+		_ = writer.Write([]string{
+			userId,
+			line.Username,
+			strconv.Itoa(line.TokenId),
+			line.TokenName,
+			line.Group,
+			line.ModelName,
+			strconv.FormatInt(line.Requests, 10),
+			strconv.FormatInt(line.PromptTokens, 10),
+			strconv.FormatInt(line.CompletionTokens, 10),
+			strconv.FormatInt(line.Quota, 10),
+			strconv.FormatFloat(line.Amount, 'f', 6, 64),
+			r.Currency,
+			strconv.FormatFloat(line.GroupRatio, 'f', -1, 64),
+			strconv.FormatFloat(line.InputPrice, 'f', 6, 64),
+			strconv.FormatFloat(line.OutputPrice, 'f', 6, 64),
+			strconv.FormatFloat(line.RequestPrice, 'f', 6, 64),
+		})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// lineLabel is the first column of a line: the token in user reports, the user in group reports and the group
+// in site reports.
+func (r *UsageReport) lineLabel(line *UsageReportLine) string {
+	switch r.Scope {
+	case UsageReportScopeUser:
+		if line.TokenName != "" {
+			return line.TokenName
+		}
+		return fmt.Sprintf("#%d", line.TokenId)
+	case UsageReportScopeGroup:
+		if line.Username != "" {
+			return line.Username
+		}
+		return fmt.Sprintf("#%d", line.UserId)
+	}
+	return line.Group
+}
+
+func (r *UsageReport) unitPrice(line *UsageReportLine) string {
+	if line.RequestPrice > 0 {
+		return r.formatAmount(line.RequestPrice) + " / req"
+	}
+	return fmt.Sprintf("%s / %s per 1M", r.formatAmount(line.InputPrice), r.formatAmount(line.OutputPrice))
+}
+
+// PDF renders a simple invoice with one row per line and the price snapshot.
+func (r *UsageReport) PDF() []byte {
+	doc := newPDFDocument()
+	issuer := operation_setting.GetUsageReportSetting().Issuer
+	if issuer == "" {
+		issuer = common.SystemName
+	}
+	doc.text(pdfMargin, 16, issuer)
+	doc.newLine(22)
+	doc.text(pdfMargin, 12, "Usage Invoice")
+	doc.newLine(18)
+	currency := r.Currency
+	if currency == "" {
+		currency = r.CurrencySymbol
+	}
+	for _, field := range [][2]string{
+		{"Bill to", r.Subject},
+		{"Period", r.periodText()},
+		{"Currency", fmt.Sprintf("%s (1 USD = %s)", currency, strconv.FormatFloat(r.ExchangeRate, 'f', -1, 64))},
+		{"Generated at", time.Unix(r.GeneratedAt, 0).Format("2006-01-02 15:04:05")},
+	} {
+		doc.text(pdfMargin, 9, field[0])
+		doc.text(pdfMargin+80, 9, field[1])
+		doc.newLine(pdfLineHeight)
+	}
+	doc.newLine(pdfLineHeight)
+
+	label := map[string]string{UsageReportScopeUser: "Token", UsageReportScopeGroup: "User"}[r.Scope]
+	if label == "" {
+		label = "Group"
+	}
+	columns := []struct {
+		title string
+		width float64
+	}{{label, 95}, {"Model", 120}, {"Requests", 45}, {"Input tokens", 55}, {"Output tokens", 55}, {"Unit price", 85}, {"Amount", 60}}
+	writeRow := func(values []string) {
+		x := pdfMargin
+		for i, value := range values {
+			doc.text(x, pdfTextFontSize, truncatePDFText(value, columns[i].width-4, pdfTextFontSize))
+			x += columns[i].width
+		}
+		doc.newLine(pdfLineHeight)
+	}
+	header := make([]string, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, column.title)
+	}
+	writeRow(header)
+	doc.line()
+	for _, line := range r.Lines {
+		// 换页后重复表头
+		if doc.y == pdfPageHeight-pdfMargin-pdfLineHeight {
+			writeRow(header)
+		}
+		writeRow([]string{
+			r.lineLabel(line),
+			line.ModelName,
+			strconv.FormatInt(line.Requests, 10),
+			strconv.FormatInt(line.PromptTokens, 10),
+			strconv.FormatInt(line.CompletionTokens, 10),
+			r.unitPrice(line),
+			r.formatAmount(line.Amount),
+		})
+	}
+	doc.line()
+	writeRow([]string{"Total", "", strconv.FormatInt(r.Total.Requests, 10), strconv.FormatInt(r.Total.PromptTokens, 10),
+		strconv.FormatInt(r.Total.CompletionTokens, 10), "", r.formatAmount(r.Total.Amount)})
+	doc.newLine(pdfLineHeight)
+	doc.text(pdfMargin, 7, "Amounts are computed from the quota charged, unit prices are the prices when this invoice was generated.")
+	return doc.bytes()
+}
+
+// HTML renders the summary sent as the notification content, the full lines are in the attachments.
+func (r *UsageReport) HTML() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<h3>%s</h3>", html.EscapeString(r.Title())))
+	sb.WriteString(fmt.Sprintf("<p>请求次数：%d，输入 tokens：%d，输出 tokens：%d，金额：%s</p>",
+		r.Total.Requests, r.Total.PromptTokens, r.Total.CompletionTokens, html.EscapeString(r.formatAmount(r.Total.Amount))))
+	if len(r.Lines) == 0 {
+		sb.WriteString("<p>本周期没有消费。</p>")
+		return sb.String()
+	}
+	sb.WriteString("<table border=\"1\" cellpadding=\"4\" cellspacing=\"0\"><tr><th></th><th>模型</th><th>请求次数</th><th>金额</th></tr>")
+	for i, line := range r.Lines {
+		if i >= usageReportEmailMaxLines {
+			break
+		}
+		sb.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%d</td><td>%s</td></tr>",
+			html.EscapeString(r.lineLabel(line)), html.EscapeString(line.ModelName), line.Requests, html.EscapeString(r.formatAmount(line.Amount))))
+	}
+	sb.WriteString("</table>")
+	if len(r.Lines) > usageReportEmailMaxLines {
+		sb.WriteString(fmt.Sprintf("<p>共 %d 行明细，完整内容见附件。</p>", len(r.Lines)))
+	}
+	return sb.String()
+}
+
+// Notify packs the report into a notification with the CSV and PDF attached.
+func (r *UsageReport) Notify() (dto.Notify, error) {
+	csvData, err := r.CSV()
+	if err != nil {
+		return dto.Notify{}, err
+	}
+	notify := dto.NewNotify(dto.NotifyTypeUsageReport, r.Title(), r.HTML(), nil)
+	notify.Attachments = []dto.NotifyAttachment{
+		{Filename: r.Filename("csv"), ContentType: "text/csv; charset=utf-8", Data: csvData},
+		{Filename: r.Filename("pdf"), ContentType: "application/pdf", Data: r.PDF()},
+	}
+	return notify, nil
+}
+
+// usageReportPeriod returns the full period of the frequency that ends at the start of the day of now.
+func usageReportPeriod(frequency string, now time.Time) (time.Time, time.Time) {
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch frequency {
+	case operation_setting.UsageReportWeekly:
+		return end.AddDate(0, 0, -7), end
+	case operation_setting.UsageReportMonthly:
+		return end.AddDate(0, -1, 0), end
+	}
+	return end.AddDate(0, 0, -1), end
+}
+
+// usageReportDue reports whether the reports should be sent at now and returns the key of the period to avoid
+// sending them twice.
+func usageReportDue(setting *operation_setting.UsageReportSetting, now time.Time) (string, bool) {
+	if now.Hour() != setting.SendHour {
+		return "", false
+	}
+	switch setting.Frequency {
+	case operation_setting.UsageReportWeekly:
+		if int(now.Weekday()) != setting.Weekday {
+			return "", false
+		}
+	case operation_setting.UsageReportMonthly:
+		if now.Day() != setting.MonthDay {
+			return "", false
+		}
+	}
+	return setting.Frequency + now.Format("2006-01-02"), true
+}
+
+// SendUsageReports sends the site report grouped by group to the recipients and the webhook, and every user that
+// consumed in the period their own report when enabled.
+func SendUsageReports(start time.Time, end time.Time) error {
+	setting := operation_setting.GetUsageReportSetting()
+	var errs []string
+	report, err := BuildUsageReport(UsageReportRequest{Scope: UsageReportScopeAll, StartTime: start.Unix(), EndTime: end.Unix()})
+	if err != nil {
+		return err
+	}
+	notify, err := report.Notify()
+	if err != nil {
+		return err
+	}
+	for _, recipient := range setting.Recipients {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" {
+			continue
+		}
+		if err = sendEmailNotify(recipient, notify); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", recipient, err.Error()))
+		}
+	}
+	if setting.WebhookUrl != "" {
+		if err = SendWebhookNotify(setting.WebhookUrl, setting.WebhookSecret, notify); err != nil {
+			errs = append(errs, "webhook: "+err.Error())
+		}
+	}
+
+	if setting.SendToUsers {
+		userIds, err := model.GetUsageReportUserIds(start.Unix(), end.Unix())
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, userId := range userIds {
+			if err = sendUserUsageReport(userId, start, end); err != nil {
+				failed++
+				common.SysLog(fmt.Sprintf("failed to send usage report to user %d: %s", userId, err.Error()))
+			}
+		}
+		if failed > 0 {
+			errs = append(errs, fmt.Sprintf("%d of %d user reports failed", failed, len(userIds)))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send usage reports: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func sendUserUsageReport(userId int, start time.Time, end time.Time) error {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	report, err := BuildUsageReport(UsageReportRequest{Scope: UsageReportScopeUser, UserId: userId, StartTime: start.Unix(), EndTime: end.Unix()})
+	if err != nil {
+		return err
+	}
+	notify, err := report.Notify()
+	if err != nil {
+		return err
+	}
+	return NotifyUser(user.Id, user.Email, user.ToBaseUser().GetSetting(), notify)
+}
+
+var usageReportOnce sync.Once
+
+// StartUsageReportTask sends the scheduled usage reports on the master node.
+// 发送记录只保存在内存中，发送时刻重启可能会重复发送
+func StartUsageReportTask() {
+	usageReportOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			lastSent := ""
+			for {
+				time.Sleep(time.Minute)
+				setting := operation_setting.GetUsageReportSetting()
+				if !setting.Enabled {
+					continue
+				}
+				if err := setting.Validate(); err != nil {
+					continue
+				}
+				now := time.Now()
+				key, due := usageReportDue(setting, now)
+				if !due || key == lastSent {
+					continue
+				}
+				lastSent = key
+				start, end := usageReportPeriod(setting.Frequency, now)
+				if err := SendUsageReports(start, end); err != nil {
+					common.SysError(err.Error())
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// 简单的 PDF 生成：A4 纵向，只输出文本。ASCII 文本使用 Helvetica，包含其他字符的文本使用不嵌入的
+// STSong-Light（Adobe-GB1），阅读器没有该字体时中文可能无法显示
+
+const (
+	pdfPageWidth    = 595.0
+	pdfPageHeight   = 842.0
+	pdfMargin       = 40.0
+	pdfLineHeight   = 12.0
+	pdfTextFontSize = 8.0
+)
+
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func newPDFDocument() *pdfDocument {
+	doc := &pdfDocument{}
+	doc.addPage()
+	return doc
+}
+
+func (d *pdfDocument) addPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// newLine moves to the next line, starting a new page when the current one is full.
+func (d *pdfDocument) newLine(height float64) {
+	d.y -= height
+	if d.y < pdfMargin {
+		d.addPage()
+		d.y -= height
+	}
+}
+
+// text writes s at x on the current line.
+func (d *pdfDocument) text(x float64, size float64, s string) {
+	if s == "" {
+		return
+	}
+	page := d.pages[len(d.pages)-1]
+	if isPDFASCII(s) {
+		fmt.Fprintf(page, "BT /F1 %.1f Tf %.2f %.2f Td (%s) Tj ET\n", size, x, d.y, escapePDFString(s))
+		return
+	}
+	var hex strings.Builder
+	for _, r := range s {
+		if r > 0xffff {
+			r = '?'
+		}
+		fmt.Fprintf(&hex, "%04X", r)
+	}
+	fmt.Fprintf(page, "BT /F2 %.1f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, d.y, hex.String())
+}
+
+// line draws a horizontal rule below the current line.
+func (d *pdfDocument) line() {
+	page := d.pages[len(d.pages)-1]
+	y := d.y - 3
+	fmt.Fprintf(page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", pdfMargin, y, pdfPageWidth-pdfMargin, y)
+}
+
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// 1 目录，2 页面树，3、4、5 字体，之后每页依次为页面和内容流
+	pageCount := len(d.pages)
+	kids := make([]string, 0, pageCount)
+	for i := 0; i < pageCount; i++ {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+i*2))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [5 0 R] >>")
+	object("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> " +
+		"/FontDescriptor << /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >> /DW 1000 /W [1 95 500] >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 7+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+func isPDFASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func escapePDFString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s)
+}
+
+// truncatePDFText shortens s to fit about width points, CJK characters count as two.
+func truncatePDFText(s string, width float64, size float64) string {
+	limit := int(width / (size * 0.5))
+	units := 0
+	for i, r := range s {
+		w := 1
+		if r >= 0x80 {
+			w = 2
+		}
+		if units+w > limit {
+			if i == 0 {
+				return ""
+			}
+			return strings.TrimRightFunc(s[:i], func(r rune) bool { return r == ' ' }) + ".."
+		}
+		units += w
+	}
+	return s
+}
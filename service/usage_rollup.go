@@ -0,0 +1,72 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// usageRollupSettleSeconds 只聚合写入超过该时间的日志，避免并发写入的日志因提交顺序被跳过
+const usageRollupSettleSeconds = 60
+
+// usageRollupMaxBatches 单次运行最多连续聚合的批数，剩余的积压留到下次
+const usageRollupMaxBatches = 100
+
+var usageRollupOnce sync.Once
+
+// StartUsageRollupTask keeps the hourly and daily usage rollups up to date on the master node.
+func StartUsageRollupTask() {
+	usageRollupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			lastPrune := time.Time{}
+			for {
+				setting := operation_setting.GetUsageRollupSetting()
+				time.Sleep(time.Duration(max(setting.IntervalSeconds, 10)) * time.Second)
+				if !setting.Enabled {
+					continue
+				}
+				RunUsageRollup(setting)
+				if setting.HourlyRetentionDays > 0 && time.Since(lastPrune) > time.Hour {
+					lastPrune = time.Now()
+					before := time.Now().AddDate(0, 0, -setting.HourlyRetentionDays).Unix()
+					if _, err := model.DeleteUsageRollupsBefore(before); err != nil {
+						common.SysError("failed to prune hourly usage rollups: " + err.Error())
+					}
+				}
+			}
+		})
+	})
+}
+
+// RunUsageRollup aggregates the pending logs batch by batch until it catches up.
+func RunUsageRollup(setting *operation_setting.UsageRollupSetting) {
+	batchSize := setting.BatchSize
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+	total := 0
+	for i := 0; i < usageRollupMaxBatches; i++ {
+		n, err := model.AggregateUsageRollups(batchSize, usageRollupSettleSeconds)
+		if err != nil {
+			common.SysError("failed to aggregate usage rollups: " + err.Error())
+			return
+		}
+		total += n
+		if n < batchSize {
+			break
+		}
+	}
+	// 只在补齐积压时输出日志
+	if total >= batchSize {
+		common.SysLog(fmt.Sprintf("aggregated %d logs into usage rollups", total))
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 匿名用量共享：只上报聚合后的计数，请求数过少的模型合并到 other，并对计数加拉普拉斯噪声，
+// 报告中不包含用户、令牌、渠道 ID 或名称，实例 ID 为不可逆的哈希。
+
+const usageSharingOtherModel = "other"
+
+type UsageSharingModel struct {
+	Model    string `json:"model"`
+	Requests int64  `json:"requests"`
+}
+
+type UsageSharingProvider struct {
+	Provider  string  `json:"provider"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+type UsageSharingReport struct {
+	InstanceId  string                 `json:"instance_id"`
+	Version     string                 `json:"version"`
+	PeriodStart int64                  `json:"period_start"`
+	PeriodEnd   int64                  `json:"period_end"`
+	Epsilon     float64                `json:"epsilon"`
+	Models      []UsageSharingModel    `json:"models"`
+	Providers   []UsageSharingProvider `json:"providers"`
+}
+
+// laplaceNoise samples from Laplace(0, scale).
+func laplaceNoise(scale float64) float64 {
+	u := rand.Float64() - 0.5
+	if u < 0 {
+		return scale * math.Log(1+2*u)
+	}
+	return -scale * math.Log(1-2*u)
+}
+
+// privatizeCount adds Laplace noise with sensitivity 1 to the count, the result is never negative.
+func privatizeCount(count int64, epsilon float64) int64 {
+	if epsilon <= 0 {
+		return count
+	}
+	noisy := int64(math.Round(float64(count) + laplaceNoise(1/epsilon)))
+	if noisy < 0 {
+		return 0
+	}
+	return noisy
+}
+
+// BuildUsageSharingReport aggregates the usage of [start, end) into an anonymized report.
+func BuildUsageSharingReport(start int64, end int64) (*UsageSharingReport, error) {
+	setting := operation_setting.GetUsageSharingSetting()
+	report := &UsageSharingReport{
+		InstanceId:  common.GenerateHMAC("usage_sharing_instance")[:16],
+		Version:     common.Version,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Epsilon:     setting.Epsilon,
+		Models:      make([]UsageSharingModel, 0),
+		Providers:   make([]UsageSharingProvider, 0),
+	}
+
+	modelCounts, err := model.CountLogsByModel(model.LogTypeConsume, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var other int64
+	for _, count := range modelCounts {
+		if count.ModelName == "" || count.Count < setting.MinCount {
+			other += count.Count
+			continue
+		}
+		report.Models = append(report.Models, UsageSharingModel{Model: count.ModelName, Requests: privatizeCount(count.Count, setting.Epsilon)})
+	}
+	if other > 0 {
+		report.Models = append(report.Models, UsageSharingModel{Model: usageSharingOtherModel, Requests: privatizeCount(other, setting.Epsilon)})
+	}
+	sort.Slice(report.Models, func(i, j int) bool {
+		return report.Models[i].Requests > report.Models[j].Requests
+	})
+
+	// 渠道按类型合并为供应商，渠道本身不出现在报告中
+	providers := make(map[string]*UsageSharingProvider)
+	addProviderCounts := func(counts []model.ChannelLogCount, isError bool) {
+		for _, count := range counts {
+			provider := "unknown"
+			if channel, err := model.CacheGetChannel(count.ChannelId); err == nil {
+				provider = constant.GetChannelTypeName(channel.Type)
+			}
+			item, ok := providers[provider]
+			if !ok {
+				item = &UsageSharingProvider{Provider: provider}
+				providers[provider] = item
+			}
+			if isError {
+				item.Errors += count.Count
+			} else {
+				item.Requests += count.Count
+			}
+		}
+	}
+	consumeCounts, err := model.CountLogsByChannel(model.LogTypeConsume, start, end)
+	if err != nil {
+		return nil, err
+	}
+	errorCounts, err := model.CountLogsByChannel(model.LogTypeError, start, end)
+	if err != nil {
+		return nil, err
+	}
+	addProviderCounts(consumeCounts, false)
+	addProviderCounts(errorCounts, true)
+	for _, item := range providers {
+		// 错误请求不产生消费日志，请求总数为成功数加错误数
+		total := item.Requests + item.Errors
+		if total < setting.MinCount {
+			continue
+		}
+		provider := UsageSharingProvider{
+			Provider: item.Provider,
+			Requests: privatizeCount(total, setting.Epsilon),
+			Errors:   privatizeCount(item.Errors, setting.Epsilon),
+		}
+		if provider.Requests > 0 {
+			provider.ErrorRate = math.Min(1, float64(provider.Errors)/float64(provider.Requests))
+		}
+		report.Providers = append(report.Providers, provider)
+	}
+	sort.Slice(report.Providers, func(i, j int) bool {
+		return report.Providers[i].Requests > report.Providers[j].Requests
+	})
+	return report, nil
+}
+
+var usageSharingOnce sync.Once
+
+// StartUsageSharingTask reports the anonymized usage to the operator's endpoint on the master node.
+func StartUsageSharingTask() {
+	usageSharingOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			for {
+				setting := operation_setting.GetUsageSharingSetting()
+				interval := setting.IntervalMinutes
+				if interval <= 0 {
+					interval = 60
+				}
+				time.Sleep(time.Duration(interval) * time.Minute)
+				if !setting.Enabled || setting.Endpoint == "" {
+					continue
+				}
+				end := time.Now().Unix()
+				if err := sendUsageSharingReport(setting.Endpoint, setting.Secret, end-int64(interval)*60, end); err != nil {
+					logger.LogError(context.Background(), fmt.Sprintf("failed to send usage sharing report: %s", err.Error()))
+				}
+			}
+		})
+	})
+}
+
+func sendUsageSharingReport(endpoint string, secret string, start int64, end int64) error {
+	report, err := BuildUsageSharingReport(start, end)
+	if err != nil {
+		return err
+	}
+	payloadBytes, err := common.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return postWebhookPayload(endpoint, secret, payloadBytes)
+}
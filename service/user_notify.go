@@ -86,6 +86,17 @@ func sendEmailNotify(userEmail string, data dto.Notify) error {
 	for _, value := range data.Values {
 		content = strings.Replace(content, dto.ContentValueParam, fmt.Sprintf("%v", value), 1)
 	}
+	if len(data.Attachments) > 0 {
+		attachments := make([]common.EmailAttachment, 0, len(data.Attachments))
+		for _, attachment := range data.Attachments {
+			attachments = append(attachments, common.EmailAttachment{
+				Filename:    attachment.Filename,
+				ContentType: attachment.ContentType,
+				Data:        attachment.Data,
+			})
+		}
+		return common.SendEmailWithAttachments(data.Title, userEmail, content, attachments)
+	}
 	return common.SendEmail(data.Title, userEmail, content)
 }
 
@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -22,6 +23,8 @@ type WebhookPayload struct {
 	Content   string        `json:"content"`
 	Values    []interface{} `json:"values,omitempty"`
 	Timestamp int64         `json:"timestamp"`
+	// Attachments 附件内容以 base64 编码
+	Attachments []dto.NotifyAttachment `json:"attachments,omitempty"`
 }
 
 // generateSignature 生成 webhook 签名
@@ -33,6 +36,15 @@ func generateSignature(secret string, payload []byte) string {
 
 // SendWebhookNotify 发送 webhook 通知
 func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error {
+	payloadBytes, err := buildWebhookPayload(data)
+	if err != nil {
+		return err
+	}
+	return postWebhookPayload(webhookURL, secret, payloadBytes)
+}
+
+// buildWebhookPayload 构建并序列化通知的 webhook 负载
+func buildWebhookPayload(data dto.Notify) ([]byte, error) {
 	// 处理占位符
 	content := data.Content
 	for _, value := range data.Values {
@@ -46,81 +58,100 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		Content:   content,
 		Values:    data.Values,
 		Timestamp: time.Now().Unix(),
+
+		Attachments: data.Attachments,
 	}
 
 	// 序列化负载
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+		return nil, fmt.Errorf("failed to marshal webhook payload: %v", err)
 	}
+	return payloadBytes, nil
+}
+
+// webhookResult 一次 webhook 请求实际发送的请求头和收到的响应，供通知测试台展示
+type webhookResult struct {
+	Headers    map[string]string
+	StatusCode int
+	Body       []byte
+}
 
+// webhookResponseBodyLimit 记录的响应体最大长度
+const webhookResponseBodyLimit = 4096
+
+// postWebhookPayload 发送已序列化的 webhook 负载，secret 不为空时附带签名
+func postWebhookPayload(webhookURL string, secret string, payloadBytes []byte) error {
+	_, err := sendWebhookRequest(webhookURL, secret, payloadBytes)
+	return err
+}
+
+// sendWebhookRequest 发送 webhook 请求并返回请求头和响应，请求已发出时即使失败也返回结果
+func sendWebhookRequest(webhookURL string, secret string, payloadBytes []byte) (*webhookResult, error) {
 	// 创建 HTTP 请求
+	var err error
 	var req *http.Request
 	var resp *http.Response
+	result := &webhookResult{Headers: map[string]string{
+		"Content-Type": "application/json",
+	}}
 
 	if system_setting.EnableWorker() {
-		// 构建worker请求数据
-		workerReq := &WorkerRequest{
-			URL:    webhookURL,
-			Key:    system_setting.WorkerValidKey,
-			Method: http.MethodPost,
-			Headers: map[string]string{
-				"Content-Type": "application/json",
-			},
-			Body: payloadBytes,
-		}
-
 		// 如果有secret，添加签名到headers
 		if secret != "" {
 			signature := generateSignature(secret, payloadBytes)
-			workerReq.Headers["X-Webhook-Signature"] = signature
-			workerReq.Headers["Authorization"] = "Bearer " + secret
+			result.Headers["X-Webhook-Signature"] = signature
+			result.Headers["Authorization"] = "Bearer " + secret
 		}
 
-		resp, err = DoWorkerRequest(workerReq)
-		if err != nil {
-			return fmt.Errorf("failed to send webhook request through worker: %v", err)
+		// 构建worker请求数据
+		workerReq := &WorkerRequest{
+			URL:     webhookURL,
+			Key:     system_setting.WorkerValidKey,
+			Method:  http.MethodPost,
+			Headers: result.Headers,
+			Body:    payloadBytes,
 		}
-		defer resp.Body.Close()
 
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+		resp, err = DoWorkerRequest(workerReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send webhook request through worker: %v", err)
 		}
 	} else {
 		// SSRF防护：验证Webhook URL（非Worker模式）
 		fetchSetting := system_setting.GetFetchSetting()
 		if err := common.ValidateURLWithFetchSetting(webhookURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
-			return fmt.Errorf("request reject: %v", err)
+			return nil, fmt.Errorf("request reject: %v", err)
 		}
 
 		req, err = http.NewRequest(http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
 		if err != nil {
-			return fmt.Errorf("failed to create webhook request: %v", err)
+			return nil, fmt.Errorf("failed to create webhook request: %v", err)
 		}
 
-		// 设置请求头
-		req.Header.Set("Content-Type", "application/json")
-
 		// 如果有 secret，生成签名
 		if secret != "" {
-			signature := generateSignature(secret, payloadBytes)
-			req.Header.Set("X-Webhook-Signature", signature)
+			result.Headers["X-Webhook-Signature"] = generateSignature(secret, payloadBytes)
+		}
+		// 设置请求头
+		for key, value := range result.Headers {
+			req.Header.Set(key, value)
 		}
 
 		// 发送请求
 		client := GetHttpClient()
 		resp, err = client.Do(req)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request: %v", err)
-		}
-		defer resp.Body.Close()
-
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+			return nil, fmt.Errorf("failed to send webhook request: %v", err)
 		}
 	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.Body, _ = io.ReadAll(io.LimitReader(resp.Body, webhookResponseBodyLimit))
 
-	return nil
+	// 检查响应状态
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+	}
+	return result, nil
 }
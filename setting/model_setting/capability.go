@@ -0,0 +1,132 @@
+package model_setting
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ModelCapability 模型能力，未填写的项不做检查
+type ModelCapability struct {
+	ContextWindow   int `json:"context_window,omitempty"`    // 输入与输出 token 之和的上限
+	MaxOutputTokens int `json:"max_output_tokens,omitempty"` // 单次输出 token 上限
+	// Modalities 支持的输入类型：text / image / audio / video / file，为空表示不限制
+	Modalities []string `json:"modalities,omitempty"`
+	// ToolCall 是否支持工具调用，JSONMode 是否支持 response_format 结构化输出，为空表示未知
+	ToolCall *bool `json:"tool_call,omitempty"`
+	JSONMode *bool `json:"json_mode,omitempty"`
+	// Logprobs 是否能返回 logprobs，为空表示未知
+	Logprobs *bool `json:"logprobs,omitempty"`
+}
+
+func (m ModelCapability) SupportsModality(modality string) bool {
+	return len(m.Modalities) == 0 || slices.Contains(m.Modalities, modality)
+}
+
+type ModelCapabilitySettings struct {
+	// Enabled 开启后预检查会拒绝超出模型能力的请求
+	Enabled bool `json:"enabled"`
+	// Capabilities 管理员配置的模型能力，覆盖内置值；模型名以 * 结尾时按前缀匹配
+	Capabilities map[string]ModelCapability `json:"capabilities"`
+	// LogprobsPolicy 请求 logprobs 而上游模型不支持时的处理：warn 正常返回并在响应中附带能力警告，reject 拒绝请求，
+	// ignore 与以前一样忽略该参数
+	LogprobsPolicy string `json:"logprobs_policy"`
+}
+
+const (
+	LogprobsPolicyWarn   = "warn"
+	LogprobsPolicyReject = "reject"
+	LogprobsPolicyIgnore = "ignore"
+)
+
+var modelCapabilitySettings = ModelCapabilitySettings{
+	Enabled:        false,
+	Capabilities:   map[string]ModelCapability{},
+	LogprobsPolicy: LogprobsPolicyWarn,
+}
+
+var (
+	toolCallSupported   = true
+	logprobsSupported   = true
+	logprobsUnsupported = false
+	textOnlyModalities  = []string{"text"}
+	claudeModalities    = []string{"text", "image", "file"}
+)
+
+// builtinModelCapabilities 常见模型的公开参数，只填写确定的项，避免误拒请求
+var builtinModelCapabilities = map[string]ModelCapability{
+	"gpt-3.5-turbo*":     {ContextWindow: 16385, MaxOutputTokens: 4096, Modalities: textOnlyModalities, ToolCall: &toolCallSupported, Logprobs: &logprobsSupported},
+	"gpt-4-turbo*":       {ContextWindow: 128000, MaxOutputTokens: 4096, ToolCall: &toolCallSupported, Logprobs: &logprobsSupported},
+	"gpt-4o*":            {ContextWindow: 128000, MaxOutputTokens: 16384, ToolCall: &toolCallSupported, Logprobs: &logprobsSupported},
+	"gpt-4.1*":           {ContextWindow: 1047576, MaxOutputTokens: 32768, ToolCall: &toolCallSupported, Logprobs: &logprobsSupported},
+	"gpt-5*":             {ContextWindow: 400000, MaxOutputTokens: 128000, Logprobs: &logprobsUnsupported},
+	"o1*":                {ContextWindow: 200000, MaxOutputTokens: 100000, Logprobs: &logprobsUnsupported},
+	"o3*":                {ContextWindow: 200000, MaxOutputTokens: 100000, Logprobs: &logprobsUnsupported},
+	"o4-mini*":           {ContextWindow: 200000, MaxOutputTokens: 100000, ToolCall: &toolCallSupported, Logprobs: &logprobsUnsupported},
+	"claude-3-5-haiku*":  {ContextWindow: 200000, MaxOutputTokens: 8192, ToolCall: &toolCallSupported, Logprobs: &logprobsUnsupported},
+	"claude-3-5-sonnet*": {ContextWindow: 200000, MaxOutputTokens: 8192, Modalities: claudeModalities, ToolCall: &toolCallSupported, Logprobs: &logprobsUnsupported},
+	"claude-3-7-sonnet*": {ContextWindow: 200000, MaxOutputTokens: 128000, Modalities: claudeModalities, ToolCall: &toolCallSupported, Logprobs: &logprobsUnsupported},
+	"claude-sonnet-4*":   {ContextWindow: 1000000, MaxOutputTokens: 64000, Modalities: claudeModalities, ToolCall: &toolCallSupported, Logprobs: &logprobsUnsupported},
+	"claude-opus-4*":     {ContextWindow: 200000, MaxOutputTokens: 64000, Modalities: claudeModalities, ToolCall: &toolCallSupported, Logprobs: &logprobsUnsupported},
+	"claude-haiku-4*":    {ContextWindow: 200000, MaxOutputTokens: 64000, Modalities: claudeModalities, ToolCall: &toolCallSupported, Logprobs: &logprobsUnsupported},
+	"gemini-1.5-pro*":    {ContextWindow: 2097152, MaxOutputTokens: 8192, ToolCall: &toolCallSupported},
+	"gemini-1.5-flash*":  {ContextWindow: 1048576, MaxOutputTokens: 8192, ToolCall: &toolCallSupported},
+	"gemini-2.0-flash*":  {ContextWindow: 1048576, MaxOutputTokens: 8192, ToolCall: &toolCallSupported},
+	"gemini-2.5-pro*":    {ContextWindow: 1048576, MaxOutputTokens: 65536, ToolCall: &toolCallSupported},
+	"gemini-2.5-flash*":  {ContextWindow: 1048576, MaxOutputTokens: 65536, ToolCall: &toolCallSupported},
+	"deepseek-chat":      {ContextWindow: 128000, MaxOutputTokens: 8192, Modalities: textOnlyModalities, ToolCall: &toolCallSupported, Logprobs: &logprobsSupported},
+	"deepseek-reasoner":  {ContextWindow: 128000, MaxOutputTokens: 65536, Modalities: textOnlyModalities, Logprobs: &logprobsUnsupported},
+}
+
+func init() {
+	config.GlobalConfig.Register("model_capability", &modelCapabilitySettings)
+}
+
+func GetModelCapabilitySettings() *ModelCapabilitySettings {
+	return &modelCapabilitySettings
+}
+
+// GetBuiltinModelCapabilities returns a copy of the built-in capability table.
+func GetBuiltinModelCapabilities() map[string]ModelCapability {
+	result := make(map[string]ModelCapability, len(builtinModelCapabilities))
+	for name, capability := range builtinModelCapabilities {
+		result[name] = capability
+	}
+	return result
+}
+
+// GetModelCapability looks up the model in the admin table first and then in the built-in one,
+// in each table an exact name wins over the longest matching prefix, and a dated snapshot without
+// an entry falls back to its base model.
+func GetModelCapability(modelName string) (ModelCapability, bool) {
+	base, isSnapshot := common.StripModelSnapshot(modelName)
+	for _, capabilities := range []map[string]ModelCapability{modelCapabilitySettings.Capabilities, builtinModelCapabilities} {
+		if capability, ok := matchModelCapability(capabilities, modelName); ok {
+			return capability, true
+		}
+		if isSnapshot {
+			if capability, ok := matchModelCapability(capabilities, base); ok {
+				return capability, true
+			}
+		}
+	}
+	return ModelCapability{}, false
+}
+
+func matchModelCapability(capabilities map[string]ModelCapability, modelName string) (ModelCapability, bool) {
+	if capability, ok := capabilities[modelName]; ok {
+		return capability, true
+	}
+	var matched ModelCapability
+	matchedPrefixLen := -1
+	for pattern, capability := range capabilities {
+		prefix, isPrefix := strings.CutSuffix(pattern, "*")
+		if isPrefix && strings.HasPrefix(modelName, prefix) && len(prefix) > matchedPrefixLen {
+			matched = capability
+			matchedPrefixLen = len(prefix)
+		}
+	}
+	return matched, matchedPrefixLen >= 0
+}
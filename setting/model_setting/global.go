@@ -32,10 +32,29 @@ func (p ChatCompletionsToResponsesPolicy) IsChannelEnabled(channelID int, channe
 	return false
 }
 
+// CompletionsToChatPolicy 旧版 /v1/completions 请求发往只支持对话接口的上游时，按模板转换为 chat completions 请求
+type CompletionsToChatPolicy struct {
+	Enabled bool `json:"enabled"`
+	// 不支持 /v1/completions 的 OpenAI 兼容渠道需要单独指定，其余类型的渠道按上游协议自动判断
+	ChannelIDs   []int  `json:"channel_ids,omitempty"`
+	ChannelTypes []int  `json:"channel_types,omitempty"`
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// PromptTemplate 用户消息模板，{{prompt}} 和 {{suffix}} 会被替换为请求中的对应字段
+	PromptTemplate string `json:"prompt_template"`
+}
+
+func (p CompletionsToChatPolicy) IsChannelForced(channelID int, channelType int) bool {
+	if channelID > 0 && slices.Contains(p.ChannelIDs, channelID) {
+		return true
+	}
+	return channelType > 0 && slices.Contains(p.ChannelTypes, channelType)
+}
+
 type GlobalSettings struct {
 	PassThroughRequestEnabled        bool                             `json:"pass_through_request_enabled"`
 	ThinkingModelBlacklist           []string                         `json:"thinking_model_blacklist"`
 	ChatCompletionsToResponsesPolicy ChatCompletionsToResponsesPolicy `json:"chat_completions_to_responses_policy"`
+	CompletionsToChatPolicy          CompletionsToChatPolicy          `json:"completions_to_chat_policy"`
 }
 
 // 默认配置
@@ -49,6 +68,10 @@ var defaultOpenaiSettings = GlobalSettings{
 		Enabled:     false,
 		AllChannels: true,
 	},
+	CompletionsToChatPolicy: CompletionsToChatPolicy{
+		Enabled:        true,
+		PromptTemplate: "{{prompt}}",
+	},
 }
 
 // 全局实例
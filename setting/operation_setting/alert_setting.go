@@ -0,0 +1,158 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	AlertFormatGeneric  = "generic"
+	AlertFormatSlack    = "slack"
+	AlertFormatDiscord  = "discord"
+	AlertFormatTelegram = "telegram"
+	// AlertFormatEmail 只用于投递记录，邮件接收人在 EmailRecipients 中配置
+	AlertFormatEmail = "email"
+)
+
+const (
+	AlertEventQuotaThreshold  = "quota_threshold"
+	AlertEventChannelDisabled = "channel_disabled"
+	AlertEventTest            = "test"
+)
+
+// AlertWebhook 告警的一个 webhook 接收端
+type AlertWebhook struct {
+	// Name 唯一名称，投递记录按名称引用接收端，地址和密钥不写入记录
+	Name string `json:"name"`
+	// Format generic、slack、discord 或 telegram
+	Format string `json:"format"`
+	// URL generic、slack、discord 的 webhook 地址
+	URL string `json:"url"`
+	// Secret generic 格式的签名密钥，签名放在 X-Webhook-Signature 请求头
+	Secret string `json:"secret"`
+	// TelegramBotToken 与 TelegramChatId 用于 telegram 格式
+	TelegramBotToken string `json:"telegram_bot_token"`
+	TelegramChatId   string `json:"telegram_chat_id"`
+	// Events 订阅的事件，为空时接收全部事件
+	Events []string `json:"events"`
+}
+
+// AlertSetting 额度阈值与渠道自动禁用告警
+type AlertSetting struct {
+	Enabled bool `json:"enabled"`
+	// Thresholds 用户或令牌已用额度占比达到这些百分比时告警，每个阈值在额度回落前只告警一次
+	Thresholds []int `json:"thresholds"`
+	// TokenAlerts 是否对有限额度的令牌告警
+	TokenAlerts bool           `json:"token_alerts"`
+	Webhooks    []AlertWebhook `json:"webhooks"`
+	// EmailRecipients 接收全部告警的邮箱
+	EmailRecipients []string `json:"email_recipients"`
+	// NotifyUsers 额度告警同时发邮件给对应的用户
+	NotifyUsers bool `json:"notify_users"`
+	// MaxAttempts 每条投递的最多尝试次数，失败后按指数退避重试
+	MaxAttempts int `json:"max_attempts"`
+}
+
+var alertSetting = AlertSetting{
+	Enabled:         false,
+	Thresholds:      []int{50, 80, 100},
+	TokenAlerts:     true,
+	Webhooks:        []AlertWebhook{},
+	EmailRecipients: []string{},
+	NotifyUsers:     false,
+	MaxAttempts:     5,
+}
+
+func init() {
+	config.GlobalConfig.Register("alert_setting", &alertSetting)
+}
+
+func GetAlertSetting() *AlertSetting {
+	return &alertSetting
+}
+
+// AlertLevel returns the highest threshold percent has reached, 0 when none.
+func (s *AlertSetting) AlertLevel(percent float64) int {
+	level := 0
+	for _, threshold := range s.Thresholds {
+		if threshold > 0 && percent >= float64(threshold) && threshold > level {
+			level = threshold
+		}
+	}
+	return level
+}
+
+// GetWebhook returns the webhook named name, nil when it does not exist.
+func (s *AlertSetting) GetWebhook(name string) *AlertWebhook {
+	for i := range s.Webhooks {
+		if s.Webhooks[i].Name == name {
+			return &s.Webhooks[i]
+		}
+	}
+	return nil
+}
+
+// Subscribes reports whether the webhook receives event.
+func (w *AlertWebhook) Subscribes(event string) bool {
+	if len(w.Events) == 0 || event == AlertEventTest {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskAlertWebhookSecrets hides the signing secrets and bot tokens of the webhooks option before it is sent to the
+// frontend.
+func MaskAlertWebhookSecrets(value string) string {
+	var webhooks []AlertWebhook
+	if err := common.UnmarshalJsonStr(value, &webhooks); err != nil {
+		return "[]"
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+		webhooks[i].TelegramBotToken = ""
+	}
+	data, _ := common.Marshal(webhooks)
+	return string(data)
+}
+
+// MergeAlertWebhooks keeps the saved secret and bot token of a webhook when the submitted ones are empty, since the
+// frontend never receives them.
+func MergeAlertWebhooks(value string) (string, error) {
+	var webhooks []AlertWebhook
+	if err := common.UnmarshalJsonStr(value, &webhooks); err != nil {
+		return "", fmt.Errorf("告警 webhook 配置格式错误: %w", err)
+	}
+	seen := make(map[string]bool, len(webhooks))
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if webhook.Name == "" {
+			return "", fmt.Errorf("第 %d 个告警 webhook 缺少名称", i+1)
+		}
+		if seen[webhook.Name] {
+			return "", fmt.Errorf("告警 webhook 名称 %s 重复", webhook.Name)
+		}
+		seen[webhook.Name] = true
+		saved := alertSetting.GetWebhook(webhook.Name)
+		if saved == nil {
+			continue
+		}
+		if webhook.Secret == "" {
+			webhook.Secret = saved.Secret
+		}
+		if webhook.TelegramBotToken == "" {
+			webhook.TelegramBotToken = saved.TelegramBotToken
+		}
+	}
+	data, err := common.Marshal(webhooks)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
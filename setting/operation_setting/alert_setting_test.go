@@ -0,0 +1,45 @@
+package operation_setting
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+func TestMergeAlertWebhooks_KeepsSavedSecrets(t *testing.T) {
+	old := alertSetting.Webhooks
+	defer func() { alertSetting.Webhooks = old }()
+	alertSetting.Webhooks = []AlertWebhook{
+		{Name: "ops", Format: AlertFormatGeneric, URL: "https://hooks.example.com", Secret: "saved-secret"},
+		{Name: "tg", Format: AlertFormatTelegram, TelegramBotToken: "saved-token", TelegramChatId: "1"},
+	}
+	data, err := common.Marshal(alertSetting.Webhooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	masked := MaskAlertWebhookSecrets(string(data))
+	if strings.Contains(masked, "saved-secret") || strings.Contains(masked, "saved-token") {
+		t.Fatalf("secrets leaked: %s", masked)
+	}
+
+	merged, err := MergeAlertWebhooks(masked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(merged, `"secret":"saved-secret"`) || !strings.Contains(merged, `"telegram_bot_token":"saved-token"`) {
+		t.Fatalf("saved secrets not kept: %s", merged)
+	}
+
+	merged, err = MergeAlertWebhooks(`[{"name":"ops","secret":"new-secret"}]`)
+	if err != nil || !strings.Contains(merged, `"secret":"new-secret"`) {
+		t.Fatalf("new secret not saved: %s %v", merged, err)
+	}
+
+	for _, value := range []string{`[{"name":""}]`, `[{"name":"a"},{"name":"a"}]`, `{`} {
+		if _, err := MergeAlertWebhooks(value); err == nil {
+			t.Fatalf("%s accepted", value)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AutoscalingThreshold 模型需求阈值，0 表示不检查该项
+type AutoscalingThreshold struct {
+	QueueDepth     int64 `json:"queue_depth"`      // 等待上游响应的请求数
+	TokensInFlight int64 `json:"tokens_in_flight"` // 进行中请求的预估 token 数（输入 + 最大输出）
+}
+
+type AutoscalingSetting struct {
+	// WebhookEnabled 需求越过阈值（上升或回落）时推送 webhook
+	WebhookEnabled bool   `json:"webhook_enabled"`
+	WebhookURL     string `json:"webhook_url"`
+	WebhookSecret  string `json:"webhook_secret"`
+	// CheckIntervalSeconds 阈值检查间隔
+	CheckIntervalSeconds int `json:"check_interval_seconds"`
+	// DefaultThreshold 未单独配置的模型使用的阈值
+	DefaultThreshold AutoscalingThreshold `json:"default_threshold"`
+	// ModelThresholds 按模型配置的阈值，例如 {"llama-3-70b": {"queue_depth": 20}}
+	ModelThresholds map[string]AutoscalingThreshold `json:"model_thresholds"`
+}
+
+var autoscalingSetting = AutoscalingSetting{
+	WebhookEnabled:       false,
+	CheckIntervalSeconds: 10,
+	ModelThresholds:      map[string]AutoscalingThreshold{},
+}
+
+func init() {
+	config.GlobalConfig.Register("autoscaling_setting", &autoscalingSetting)
+}
+
+func GetAutoscalingSetting() *AutoscalingSetting {
+	return &autoscalingSetting
+}
+
+// GetAutoscalingThreshold returns the threshold configured for the model, falling back to the default one.
+func GetAutoscalingThreshold(model string) AutoscalingThreshold {
+	if threshold, ok := autoscalingSetting.ModelThresholds[model]; ok {
+		return threshold
+	}
+	return autoscalingSetting.DefaultThreshold
+}
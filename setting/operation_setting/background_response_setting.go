@@ -0,0 +1,27 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BackgroundResponseSetting Responses 接口的后台模式（background: true）。请求在接收的节点上异步执行，
+// 客户端通过 GET /v1/responses/{id} 查询结果、POST /v1/responses/{id}/cancel 取消。关闭时忽略 background，按普通请求同步返回
+type BackgroundResponseSetting struct {
+	Enabled          bool `json:"enabled"`
+	MaxActivePerUser int  `json:"max_active_per_user"` // 每个用户同时排队和执行的后台请求数，0 为不限制
+	TimeoutMinutes   int  `json:"timeout_minutes"`     // 单个请求的最长执行时间
+	RetentionHours   int  `json:"retention_hours"`     // 结束后保留结果的时间
+}
+
+var backgroundResponseSetting = BackgroundResponseSetting{
+	Enabled:          true,
+	MaxActivePerUser: 10,
+	TimeoutMinutes:   60,
+	RetentionHours:   72,
+}
+
+func init() {
+	config.GlobalConfig.Register("background_response_setting", &backgroundResponseSetting)
+}
+
+func GetBackgroundResponseSetting() *BackgroundResponseSetting {
+	return &backgroundResponseSetting
+}
@@ -0,0 +1,30 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchSetting 兼容 OpenAI 的批量接口（/v1/batches），请求文件通过文件接口上传（见 file_setting）
+type BatchSetting struct {
+	Enabled           bool    `json:"enabled"`
+	DiscountRatio     float64 `json:"discount_ratio"`      // 批量请求在分组倍率的基础上再乘以该比例计费
+	Concurrency       int     `json:"concurrency"`         // 单个批次同时执行的请求数
+	MaxRunningBatches int     `json:"max_running_batches"` // 同时执行的批次数
+	MaxRequests       int     `json:"max_requests"`        // 单个批次的请求数上限
+	MaxRetries        int     `json:"max_retries"`         // 请求被限流时的重试次数
+}
+
+var batchSetting = BatchSetting{
+	Enabled:           false,
+	DiscountRatio:     0.5,
+	Concurrency:       4,
+	MaxRunningBatches: 2,
+	MaxRequests:       50000,
+	MaxRetries:        5,
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
@@ -0,0 +1,41 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ByokSetting 用户自有渠道（BYOK）：普通用户可以登记自己的上游密钥，请求优先走自己的渠道，
+// 不消耗平台渠道，按平台费率收取费用
+type ByokSetting struct {
+	Enabled bool `json:"enabled"`
+	// FeeRatio 使用自有渠道时按正常价格的该比例收取平台费，0 表示不收费
+	FeeRatio float64 `json:"fee_ratio"`
+	// MaxChannelsPerUser 每个用户最多登记的渠道数量，0 表示不限制
+	MaxChannelsPerUser int `json:"max_channels_per_user"`
+	// AllowedChannelTypes 允许用户登记的渠道类型，为空表示不限制
+	AllowedChannelTypes []int `json:"allowed_channel_types"`
+	// ValidateOnSave 保存前用渠道的第一个模型发起一次测试请求，失败时拒绝保存
+	ValidateOnSave bool `json:"validate_on_save"`
+}
+
+var byokSetting = ByokSetting{
+	Enabled:             false,
+	FeeRatio:            0,
+	MaxChannelsPerUser:  5,
+	AllowedChannelTypes: []int{},
+	ValidateOnSave:      true,
+}
+
+func init() {
+	config.GlobalConfig.Register("byok_setting", &byokSetting)
+}
+
+func GetByokSetting() *ByokSetting {
+	return &byokSetting
+}
+
+func (s *ByokSetting) IsChannelTypeAllowed(channelType int) bool {
+	return len(s.AllowedChannelTypes) == 0 || slices.Contains(s.AllowedChannelTypes, channelType)
+}
@@ -0,0 +1,66 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ChannelHealthSetting 渠道健康检查：定时向每个渠道发送轻量测试请求，连续失败后标记为不健康，连续成功后恢复
+type ChannelHealthSetting struct {
+	Enabled bool `json:"enabled"`
+	// IntervalMinutes 两轮检查之间的分钟数
+	IntervalMinutes int `json:"interval_minutes"`
+	// Model 检查使用的模型，为空时使用渠道的测试模型
+	Model string `json:"model"`
+	// Prompt 检查使用的消息，为空时使用默认测试消息
+	Prompt string `json:"prompt"`
+	// FailureThreshold 连续失败多少次后标记为不健康
+	FailureThreshold int `json:"failure_threshold"`
+	// RecoveryThreshold 不健康的渠道连续成功多少次后恢复
+	RecoveryThreshold int `json:"recovery_threshold"`
+	// AutoDisable 标记为不健康时自动禁用渠道，渠道需开启自动禁用
+	AutoDisable bool `json:"auto_disable"`
+	// AutoEnable 恢复健康时重新启用被自动禁用的渠道
+	AutoEnable bool `json:"auto_enable"`
+	// AvoidUnhealthy 选择渠道时避开不健康的渠道，没有其他渠道时仍会使用
+	AvoidUnhealthy bool `json:"avoid_unhealthy"`
+}
+
+var channelHealthSetting = ChannelHealthSetting{
+	IntervalMinutes:   5,
+	FailureThreshold:  3,
+	RecoveryThreshold: 2,
+	AutoDisable:       true,
+	AutoEnable:        true,
+	AvoidUnhealthy:    true,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_health_setting", &channelHealthSetting)
+}
+
+func GetChannelHealthSetting() *ChannelHealthSetting {
+	return &channelHealthSetting
+}
+
+func (s *ChannelHealthSetting) Interval() time.Duration {
+	if s.IntervalMinutes <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(s.IntervalMinutes) * time.Minute
+}
+
+func (s *ChannelHealthSetting) GetFailureThreshold() int {
+	if s.FailureThreshold <= 0 {
+		return 3
+	}
+	return s.FailureThreshold
+}
+
+func (s *ChannelHealthSetting) GetRecoveryThreshold() int {
+	if s.RecoveryThreshold <= 0 {
+		return 2
+	}
+	return s.RecoveryThreshold
+}
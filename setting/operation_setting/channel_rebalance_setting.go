@@ -0,0 +1,93 @@
+package operation_setting
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ChannelRebalanceSetting 定时根据最近的成本、错误率和延迟调整渠道权重，数据来自按小时的用量汇总。
+// 每次调整都会记录下来，开启人工审批时只生成调整建议，由管理员审批后生效。
+type ChannelRebalanceSetting struct {
+	Enabled         bool `json:"enabled"`
+	IntervalMinutes int  `json:"interval_minutes"`
+	// WindowHours 统计最近多少小时的数据
+	WindowHours int `json:"window_hours"`
+	// MinRequests 统计窗口内请求数不足的渠道不参与调整
+	MinRequests int64 `json:"min_requests"`
+	// ManualApproval 只生成调整建议，由管理员审批后生效
+	ManualApproval bool `json:"manual_approval"`
+	// MinWeight、MaxWeight 调整后的权重范围
+	MinWeight int `json:"min_weight"`
+	MaxWeight int `json:"max_weight"`
+	// MaxStep 单次调整的最大幅度，0 表示不限制
+	MaxStep int `json:"max_step"`
+	// CostFactor、ErrorFactor、LatencyFactor 成本、错误率和延迟在评分中的占比
+	CostFactor    float64 `json:"cost_factor"`
+	ErrorFactor   float64 `json:"error_factor"`
+	LatencyFactor float64 `json:"latency_factor"`
+	// Groups 只调整这些分组中的渠道，为空时调整全部启用的渠道
+	Groups []string `json:"groups"`
+}
+
+var channelRebalanceSetting = ChannelRebalanceSetting{
+	Enabled:         false,
+	IntervalMinutes: 60,
+	WindowHours:     24,
+	MinRequests:     100,
+	ManualApproval:  true,
+	MinWeight:       1,
+	MaxWeight:       100,
+	MaxStep:         10,
+	CostFactor:      1,
+	ErrorFactor:     2,
+	LatencyFactor:   1,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_rebalance_setting", &channelRebalanceSetting)
+}
+
+func GetChannelRebalanceSetting() *ChannelRebalanceSetting {
+	return &channelRebalanceSetting
+}
+
+// Validate checks the bounds set by the admin, the optimizer never moves a weight outside of them.
+func (s *ChannelRebalanceSetting) Validate() error {
+	if s.MinWeight < 0 || s.MaxWeight < s.MinWeight {
+		return errors.New("权重范围无效")
+	}
+	if s.MaxStep < 0 {
+		return errors.New("单次调整幅度不能为负数")
+	}
+	if s.CostFactor < 0 || s.ErrorFactor < 0 || s.LatencyFactor < 0 {
+		return errors.New("评分占比不能为负数")
+	}
+	if s.CostFactor+s.ErrorFactor+s.LatencyFactor == 0 {
+		return errors.New("评分占比不能全部为 0")
+	}
+	return nil
+}
+
+// ClampWeight moves the weight towards target by at most MaxStep and keeps it within [MinWeight, MaxWeight].
+func (s *ChannelRebalanceSetting) ClampWeight(current int, target int) int {
+	if s.MaxStep > 0 {
+		target = min(max(target, current-s.MaxStep), current+s.MaxStep)
+	}
+	return min(max(target, s.MinWeight), s.MaxWeight)
+}
+
+// AppliesToGroups reports whether a channel in the groups is rebalanced.
+func (s *ChannelRebalanceSetting) AppliesToGroups(groups []string) bool {
+	if len(s.Groups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		for _, allowed := range s.Groups {
+			if group == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package operation_setting
+
+import "testing"
+
+func TestChannelRebalanceSettingClampWeight(t *testing.T) {
+	setting := ChannelRebalanceSetting{MinWeight: 5, MaxWeight: 50, MaxStep: 10}
+	cases := []struct {
+		current  int
+		target   int
+		expected int
+	}{
+		{20, 25, 25},
+		{20, 80, 30},
+		{20, 1, 10},
+		{48, 60, 50},
+		{0, 3, 5},
+	}
+	for _, tc := range cases {
+		if got := setting.ClampWeight(tc.current, tc.target); got != tc.expected {
+			t.Fatalf("ClampWeight(%d, %d) = %d, expected %d", tc.current, tc.target, got, tc.expected)
+		}
+	}
+
+	setting.MaxStep = 0
+	if got := setting.ClampWeight(20, 45); got != 45 {
+		t.Fatalf("step limit should be disabled, got %d", got)
+	}
+}
+
+func TestChannelRebalanceSettingValidate(t *testing.T) {
+	setting := ChannelRebalanceSetting{MinWeight: 1, MaxWeight: 100, CostFactor: 1}
+	if err := setting.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	setting.MaxWeight = 0
+	if err := setting.Validate(); err == nil {
+		t.Fatal("expected an error for an empty weight range")
+	}
+	setting.MaxWeight = 100
+	setting.CostFactor = 0
+	if err := setting.Validate(); err == nil {
+		t.Fatal("expected an error when every factor is 0")
+	}
+}
@@ -0,0 +1,68 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// CircuitBreakerSetting 渠道熔断：窗口内上游请求的错误率超过阈值时熔断渠道，冷却期内请求直接切换到其他渠道，
+// 冷却结束后放行少量探测请求（半开），探测成功则恢复，失败则重新熔断。熔断状态按节点统计。
+type CircuitBreakerSetting struct {
+	Enabled bool `json:"enabled"`
+	// WindowSeconds 统计错误率的窗口秒数
+	WindowSeconds int `json:"window_seconds"`
+	// MinRequests 窗口内请求数达到该值才会判断是否熔断
+	MinRequests int `json:"min_requests"`
+	// ErrorRateThreshold 触发熔断的错误率，0-1
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	// CooldownSeconds 熔断后的冷却秒数
+	CooldownSeconds int `json:"cooldown_seconds"`
+	// HalfOpenRequests 冷却结束后放行的探测请求数，全部成功后恢复
+	HalfOpenRequests int `json:"half_open_requests"`
+}
+
+var circuitBreakerSetting = CircuitBreakerSetting{
+	WindowSeconds:      60,
+	MinRequests:        10,
+	ErrorRateThreshold: 0.5,
+	CooldownSeconds:    30,
+	HalfOpenRequests:   1,
+}
+
+func init() {
+	config.GlobalConfig.Register("circuit_breaker_setting", &circuitBreakerSetting)
+}
+
+func GetCircuitBreakerSetting() *CircuitBreakerSetting {
+	return &circuitBreakerSetting
+}
+
+func (s *CircuitBreakerSetting) Window() time.Duration {
+	if s.WindowSeconds <= 0 {
+		return time.Minute
+	}
+	return time.Duration(s.WindowSeconds) * time.Second
+}
+
+func (s *CircuitBreakerSetting) Cooldown() time.Duration {
+	if s.CooldownSeconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.CooldownSeconds) * time.Second
+}
+
+func (s *CircuitBreakerSetting) GetMinRequests() int {
+	return max(s.MinRequests, 1)
+}
+
+func (s *CircuitBreakerSetting) GetErrorRateThreshold() float64 {
+	if s.ErrorRateThreshold <= 0 || s.ErrorRateThreshold > 1 {
+		return 0.5
+	}
+	return s.ErrorRateThreshold
+}
+
+func (s *CircuitBreakerSetting) GetHalfOpenRequests() int {
+	return max(s.HalfOpenRequests, 1)
+}
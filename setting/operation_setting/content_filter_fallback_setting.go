@@ -0,0 +1,50 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ContentFilterFallbackRule 上游因内容过滤拒绝请求时的兜底目标，兜底模型和兜底渠道至少需要指定一个
+type ContentFilterFallbackRule struct {
+	Model         string `json:"model"`          // 触发兜底的模型，* 匹配所有模型
+	FallbackModel string `json:"fallback_model"` // 兜底使用的模型，为空时沿用原模型
+	ChannelId     int    `json:"channel_id"`     // 兜底使用的渠道，0 表示在令牌分组内为兜底模型重新选择渠道
+}
+
+// ContentFilterFallbackSetting 只对开启了内容过滤兜底的令牌生效，每个请求最多兜底一次
+type ContentFilterFallbackSetting struct {
+	Enabled bool                        `json:"enabled"`
+	Rules   []ContentFilterFallbackRule `json:"rules"`
+}
+
+var contentFilterFallbackSetting = ContentFilterFallbackSetting{
+	Enabled: false,
+	Rules:   []ContentFilterFallbackRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("content_filter_fallback_setting", &contentFilterFallbackSetting)
+}
+
+func GetContentFilterFallbackSetting() *ContentFilterFallbackSetting {
+	return &contentFilterFallbackSetting
+}
+
+// MatchContentFilterFallbackRule returns the rule of the model, the exact match before the * rule, nil if none.
+func MatchContentFilterFallbackRule(modelName string) *ContentFilterFallbackRule {
+	if !contentFilterFallbackSetting.Enabled {
+		return nil
+	}
+	var wildcard *ContentFilterFallbackRule
+	for i := range contentFilterFallbackSetting.Rules {
+		rule := &contentFilterFallbackSetting.Rules[i]
+		if rule.FallbackModel == "" && rule.ChannelId == 0 {
+			continue
+		}
+		if rule.Model == modelName {
+			return rule
+		}
+		if rule.Model == "*" && wildcard == nil {
+			wildcard = rule
+		}
+	}
+	return wildcard
+}
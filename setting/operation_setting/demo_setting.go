@@ -0,0 +1,44 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// DemoSetting 公开演示接口配置，演示请求无需登录，统一使用沙盒令牌计费
+type DemoSetting struct {
+	Enabled bool `json:"enabled"`
+	// TokenId 沙盒令牌，建议由专用用户创建，令牌的剩余额度即演示额度池
+	TokenId int `json:"token_id"`
+	// Models 允许演示使用的模型，为空时拒绝所有请求
+	Models []string `json:"models"`
+	// MaxTokens 单次请求 max_tokens 的上限，请求必须携带且不超过该值
+	MaxTokens int `json:"max_tokens"`
+	// 按客户端 IP 限流：RateLimitDuration 秒内最多 RateLimitNum 次
+	RateLimitNum      int   `json:"rate_limit_num"`
+	RateLimitDuration int64 `json:"rate_limit_duration"`
+	// RequireTurnstile 是否要求每次请求携带 Turnstile 校验码，需同时开启 Turnstile；
+	// 系统未开启 Turnstile 时仅依靠 IP 限流，未配置限流则拒绝所有演示请求
+	RequireTurnstile bool `json:"require_turnstile"`
+}
+
+var demoSetting = DemoSetting{
+	Enabled:           false,
+	Models:            []string{},
+	MaxTokens:         256,
+	RateLimitNum:      5,
+	RateLimitDuration: 60,
+	RequireTurnstile:  true,
+}
+
+func init() {
+	config.GlobalConfig.Register("demo_setting", &demoSetting)
+}
+
+func GetDemoSetting() *DemoSetting {
+	return &demoSetting
+}
+
+func IsDemoModelAllowed(modelName string) bool {
+	return modelName != "" && common.StringsContains(demoSetting.Models, modelName)
+}
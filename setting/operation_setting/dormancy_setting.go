@@ -0,0 +1,70 @@
+package operation_setting
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	DormantUserActionFlag    = "flag"
+	DormantUserActionDisable = "disable"
+)
+
+// DormancySetting 定期清理长期未使用的令牌和长期不活跃的用户：令牌超过 TokenInactiveDays 天未使用时禁用，
+// 用户超过 UserInactiveDays 天没有登录和调用时标记或禁用。处理前 NotifyDaysBefore 天通过用户的通知方式提醒，
+// 提醒后仍未使用才会处理；每次处理都写入审计日志。
+type DormancySetting struct {
+	Enabled       bool `json:"enabled"`
+	IntervalHours int  `json:"interval_hours"`
+	// DryRun 只生成报告，不发送提醒也不修改令牌和用户
+	DryRun bool `json:"dry_run"`
+	// TokenInactiveDays、UserInactiveDays 为 0 时不处理令牌或用户
+	TokenInactiveDays int `json:"token_inactive_days"`
+	UserInactiveDays  int `json:"user_inactive_days"`
+	// UserAction flag 只标记用户，disable 禁用用户
+	UserAction string `json:"user_action"`
+	// NotifyDaysBefore 处理前提前多少天提醒，0 表示不提醒直接处理
+	NotifyDaysBefore int `json:"notify_days_before"`
+	// ExemptGroups 这些分组的用户及其令牌不会被处理
+	ExemptGroups []string `json:"exempt_groups"`
+}
+
+var dormancySetting = DormancySetting{
+	Enabled:           false,
+	IntervalHours:     24,
+	DryRun:            true,
+	TokenInactiveDays: 90,
+	UserInactiveDays:  180,
+	UserAction:        DormantUserActionFlag,
+	NotifyDaysBefore:  7,
+}
+
+func init() {
+	config.GlobalConfig.Register("dormancy_setting", &dormancySetting)
+}
+
+func GetDormancySetting() *DormancySetting {
+	return &dormancySetting
+}
+
+func (s *DormancySetting) Validate() error {
+	if s.TokenInactiveDays < 0 || s.UserInactiveDays < 0 || s.NotifyDaysBefore < 0 {
+		return errors.New("天数不能为负数")
+	}
+	if s.UserAction != DormantUserActionFlag && s.UserAction != DormantUserActionDisable {
+		return errors.New("不活跃用户的处理方式只能是 flag 或 disable")
+	}
+	// 提醒需要早于处理，否则用户刚开始使用就会收到提醒
+	if s.NotifyDaysBefore > 0 && ((s.TokenInactiveDays > 0 && s.NotifyDaysBefore >= s.TokenInactiveDays) ||
+		(s.UserInactiveDays > 0 && s.NotifyDaysBefore >= s.UserInactiveDays)) {
+		return errors.New("提前提醒的天数需要小于未使用天数")
+	}
+	return nil
+}
+
+// IsExemptGroup reports whether users of group and their tokens are never cleaned up.
+func (s *DormancySetting) IsExemptGroup(group string) bool {
+	return slices.Contains(s.ExemptGroups, group)
+}
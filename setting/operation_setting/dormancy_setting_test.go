@@ -0,0 +1,27 @@
+package operation_setting
+
+import "testing"
+
+func TestDormancySettingValidate(t *testing.T) {
+	setting := DormancySetting{TokenInactiveDays: 90, UserInactiveDays: 180, UserAction: DormantUserActionFlag, NotifyDaysBefore: 7}
+	if err := setting.Validate(); err != nil {
+		t.Fatalf("valid setting rejected: %v", err)
+	}
+
+	setting.UserAction = "delete"
+	if err := setting.Validate(); err == nil {
+		t.Fatal("unknown user action accepted")
+	}
+
+	setting.UserAction = DormantUserActionDisable
+	setting.NotifyDaysBefore = 90
+	if err := setting.Validate(); err == nil {
+		t.Fatal("notice period as long as the inactive days accepted")
+	}
+
+	// 不处理令牌时只需要小于用户的未使用天数
+	setting.TokenInactiveDays = 0
+	if err := setting.Validate(); err != nil {
+		t.Fatalf("valid setting rejected: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package operation_setting
+
+import (
+	"slices"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// EmbeddingCacheSetting 嵌入结果缓存：相同模型和输入的嵌入结果是确定的，命中时直接返回缓存的响应，不请求上游。
+// 客户端可以通过 Cache-Control: no-cache 跳过读取缓存，no-store 同时不写入缓存。
+type EmbeddingCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// TTLHours 缓存保留小时数
+	TTLHours int `json:"ttl_hours"`
+	// MaxEntries 未开启 Redis 时内存中最多缓存的条目数
+	MaxEntries int `json:"max_entries"`
+	// Groups 只对这些分组开启，为空表示所有分组
+	Groups []string `json:"groups,omitempty"`
+	// HitQuotaRatio 命中缓存时按输入 token 计费的倍率，0 表示免费，按次计费的模型仍按次计费
+	HitQuotaRatio float64 `json:"hit_quota_ratio"`
+}
+
+var embeddingCacheSetting = EmbeddingCacheSetting{
+	TTLHours:      7 * 24,
+	MaxEntries:    100_000,
+	HitQuotaRatio: 0,
+}
+
+func init() {
+	config.GlobalConfig.Register("embedding_cache_setting", &embeddingCacheSetting)
+}
+
+func GetEmbeddingCacheSetting() *EmbeddingCacheSetting {
+	return &embeddingCacheSetting
+}
+
+func (s *EmbeddingCacheSetting) IsEnabledForGroup(group string) bool {
+	if !s.Enabled {
+		return false
+	}
+	return len(s.Groups) == 0 || slices.Contains(s.Groups, group)
+}
+
+func (s *EmbeddingCacheSetting) TTL() time.Duration {
+	if s.TTLHours <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(s.TTLHours) * time.Hour
+}
@@ -0,0 +1,48 @@
+package operation_setting
+
+import (
+	"slices"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// EmbeddingCoalesceSetting 嵌入请求合并：同一渠道、同一模型的并发 /v1/embeddings 请求在很短的时间窗口内合并为一次上游请求，
+// 响应中的向量再按顺序拆分给各个请求，上游返回的 token 用量按各请求输入的长度比例分摊计费。
+// 只合并文本输入且上游为 OpenAI 兼容协议的请求。
+type EmbeddingCoalesceSetting struct {
+	Enabled bool `json:"enabled"`
+	// WindowMs 第一个请求到达后等待其他请求加入的毫秒数
+	WindowMs int `json:"window_ms"`
+	// MaxBatchInputs 一次上游请求最多包含的输入条数，达到后立即发送
+	MaxBatchInputs int `json:"max_batch_inputs"`
+	// Models 只合并这些模型的请求，为空表示所有模型
+	Models []string `json:"models,omitempty"`
+}
+
+var embeddingCoalesceSetting = EmbeddingCoalesceSetting{
+	WindowMs:       10,
+	MaxBatchInputs: 64,
+}
+
+func init() {
+	config.GlobalConfig.Register("embedding_coalesce_setting", &embeddingCoalesceSetting)
+}
+
+func GetEmbeddingCoalesceSetting() *EmbeddingCoalesceSetting {
+	return &embeddingCoalesceSetting
+}
+
+func (s *EmbeddingCoalesceSetting) IsEnabledForModel(model string) bool {
+	if !s.Enabled {
+		return false
+	}
+	return len(s.Models) == 0 || slices.Contains(s.Models, model)
+}
+
+func (s *EmbeddingCoalesceSetting) Window() time.Duration {
+	if s.WindowMs <= 0 {
+		return 10 * time.Millisecond
+	}
+	return time.Duration(s.WindowMs) * time.Millisecond
+}
@@ -0,0 +1,58 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// FaultInjectionRule 故障注入规则，至少需要指定令牌或渠道之一，避免影响正常流量
+type FaultInjectionRule struct {
+	Name      string `json:"name"`
+	TokenId   int    `json:"token_id"`   // 0 表示不限令牌
+	ChannelId int    `json:"channel_id"` // 0 表示不限渠道
+
+	LatencyMs int `json:"latency_ms"` // 请求上游前注入的延迟
+
+	ErrorRate       float64 `json:"error_rate"`        // 0-1，直接返回错误而不请求上游的概率
+	ErrorStatusCode int     `json:"error_status_code"` // 注入错误的状态码，默认 500
+	RetryAfter      int     `json:"retry_after"`       // 状态码为 429 时返回的 Retry-After 秒数
+
+	StreamDropRate        float64 `json:"stream_drop_rate"`         // 0-1，流式响应中途断开的概率
+	StreamDropAfterChunks int     `json:"stream_drop_after_chunks"` // 发送多少个数据块后断开
+}
+
+type FaultInjectionSetting struct {
+	Enabled bool                 `json:"enabled"`
+	Rules   []FaultInjectionRule `json:"rules"`
+}
+
+var faultInjectionSetting = FaultInjectionSetting{
+	Enabled: false,
+	Rules:   []FaultInjectionRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("fault_injection_setting", &faultInjectionSetting)
+}
+
+func GetFaultInjectionSetting() *FaultInjectionSetting {
+	return &faultInjectionSetting
+}
+
+// MatchFaultInjectionRule returns the first rule targeting the token or channel, nil if none.
+func MatchFaultInjectionRule(tokenId int, channelId int) *FaultInjectionRule {
+	if !faultInjectionSetting.Enabled {
+		return nil
+	}
+	for i := range faultInjectionSetting.Rules {
+		rule := &faultInjectionSetting.Rules[i]
+		if rule.TokenId == 0 && rule.ChannelId == 0 {
+			continue
+		}
+		if rule.TokenId != 0 && rule.TokenId != tokenId {
+			continue
+		}
+		if rule.ChannelId != 0 && rule.ChannelId != channelId {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
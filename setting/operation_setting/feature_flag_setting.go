@@ -0,0 +1,75 @@
+package operation_setting
+
+import (
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 功能开关：新的转发行为按开关名称查询，可以按比例、分组和接口逐步放量，关闭开关即可立即回滚。
+// 未配置的开关使用各功能原有的设置。
+
+const (
+	FeatureFlagCompletionsToChat = "completions_to_chat" // 旧版 completions 请求转换为 chat completions
+	FeatureFlagRequestBodyGzip   = "request_body_gzip"   // gzip 压缩上游请求体
+)
+
+type FeatureFlag struct {
+	Enabled bool `json:"enabled"`
+	// Percentage 放量比例 0-100，按令牌（没有令牌时按用户）分桶，同一令牌的结果保持稳定
+	Percentage int `json:"percentage"`
+	// Groups 只对这些分组生效，为空表示所有分组
+	Groups []string `json:"groups,omitempty"`
+	// Endpoints 只对这些路径前缀生效，为空表示所有接口
+	Endpoints []string `json:"endpoints,omitempty"`
+}
+
+type FeatureFlagSetting struct {
+	Flags map[string]FeatureFlag `json:"flags"`
+}
+
+var featureFlagSetting = FeatureFlagSetting{
+	Flags: map[string]FeatureFlag{},
+}
+
+func init() {
+	config.GlobalConfig.Register("feature_flag_setting", &featureFlagSetting)
+}
+
+func GetFeatureFlagSetting() *FeatureFlagSetting {
+	return &featureFlagSetting
+}
+
+// GetFeatureFlag returns the flag of the name, false when it is not configured.
+func GetFeatureFlag(name string) (FeatureFlag, bool) {
+	flag, ok := featureFlagSetting.Flags[name]
+	return flag, ok
+}
+
+// Evaluate reports whether the flag named name is on for a request of group to path, bucketed by key.
+func (f FeatureFlag) Evaluate(name string, group string, path string, key string) bool {
+	if !f.Enabled || f.Percentage <= 0 {
+		return false
+	}
+	if len(f.Groups) > 0 && !slices.Contains(f.Groups, group) {
+		return false
+	}
+	if len(f.Endpoints) > 0 && !slices.ContainsFunc(f.Endpoints, func(prefix string) bool {
+		return strings.HasPrefix(path, prefix)
+	}) {
+		return false
+	}
+	if f.Percentage >= 100 {
+		return true
+	}
+	return featureFlagBucket(name, key) < f.Percentage
+}
+
+// featureFlagBucket 开关名称参与哈希，使不同开关的放量人群相互独立
+func featureFlagBucket(name string, key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + ":" + key))
+	return int(h.Sum32() % 100)
+}
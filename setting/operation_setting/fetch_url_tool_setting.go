@@ -0,0 +1,35 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// FetchURLToolName 网关在服务端执行的工具名
+const FetchURLToolName = "fetch_url"
+
+// FetchURLToolSetting 服务端执行 fetch_url 工具：只对开启了该功能的令牌的非流式对话请求生效，
+// 模型调用 fetch_url 时由网关抓取网页并把内容作为工具结果继续请求，轮数和 token 上限见 ToolLoopSetting
+type FetchURLToolSetting struct {
+	Enabled        bool `json:"enabled"`
+	TimeoutSeconds int  `json:"timeout_seconds"`
+	// MaxResponseKB 下载网页的大小上限
+	MaxResponseKB int `json:"max_response_kb"`
+	// MaxContentChars 作为工具结果返回给模型的最大字符数
+	MaxContentChars int `json:"max_content_chars"`
+	// MaxCallsPerHop 每轮最多执行的 fetch_url 调用数，超出的调用直接返回错误给模型
+	MaxCallsPerHop int `json:"max_calls_per_hop"`
+}
+
+var fetchURLToolSetting = FetchURLToolSetting{
+	Enabled:         false,
+	TimeoutSeconds:  10,
+	MaxResponseKB:   2048,
+	MaxContentChars: 20000,
+	MaxCallsPerHop:  5,
+}
+
+func init() {
+	config.GlobalConfig.Register("fetch_url_tool_setting", &fetchURLToolSetting)
+}
+
+func GetFetchURLToolSetting() *FetchURLToolSetting {
+	return &fetchURLToolSetting
+}
@@ -0,0 +1,38 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// FileSetting 兼容 OpenAI 的文件接口（/v1/files），文件保存在 storage_setting 配置的本地磁盘或 S3 中
+type FileSetting struct {
+	Enabled        bool     `json:"enabled"`
+	MaxFileSizeMB  int      `json:"max_file_size_mb"` // 单个文件大小上限
+	UserQuotaMB    int      `json:"user_quota_mb"`    // 每个用户保存的文件总大小上限，0 表示不限制
+	DefaultTTLDays int      `json:"default_ttl_days"` // 上传时未指定 expires_after 的文件保存天数，0 表示一直保存
+	OutputTTLDays  int      `json:"output_ttl_days"`  // 批量任务结果文件的保存天数，0 表示一直保存
+	Purposes       []string `json:"purposes"`         // 允许上传的用途
+}
+
+var fileSetting = FileSetting{
+	Enabled:        false,
+	MaxFileSizeMB:  100,
+	UserQuotaMB:    1024,
+	DefaultTTLDays: 30,
+	OutputTTLDays:  30,
+	Purposes:       []string{"batch", "assistants", "user_data", "vision", "fine-tune", "evals"},
+}
+
+func init() {
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+func GetFileSetting() *FileSetting {
+	return &fileSetting
+}
+
+func (s *FileSetting) IsPurposeAllowed(purpose string) bool {
+	return slices.Contains(s.Purposes, purpose)
+}
@@ -0,0 +1,29 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// GraphQLSetting 管理接口的 GraphQL 查询入口 /api/graphql，只支持查询，按登录用户的角色逐字段鉴权
+type GraphQLSetting struct {
+	Enabled bool `json:"enabled"`
+	// MaxDepth 查询的最大嵌套层数
+	MaxDepth int `json:"max_depth"`
+	// MaxComplexity 查询展开片段后的最大字段数
+	MaxComplexity int `json:"max_complexity"`
+	// MaxPageSize 列表字段单页的最大条数
+	MaxPageSize int `json:"max_page_size"`
+}
+
+var graphQLSetting = GraphQLSetting{
+	Enabled:       false,
+	MaxDepth:      6,
+	MaxComplexity: 200,
+	MaxPageSize:   100,
+}
+
+func init() {
+	config.GlobalConfig.Register("graphql_setting", &graphQLSetting)
+}
+
+func GetGraphQLSetting() *GraphQLSetting {
+	return &graphQLSetting
+}
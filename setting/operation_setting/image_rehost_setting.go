@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ImageRehostSetting 将上游生成图片的临时链接下载后由网关托管，返回带签名的稳定链接，
+// 图片保存在 storage_setting 配置的对象存储中
+type ImageRehostSetting struct {
+	Enabled        bool `json:"enabled"`
+	MaxImageSizeMB int  `json:"max_image_size_mb"` // 单张图片大小上限，超过时保留上游原链接
+	RetentionDays  int  `json:"retention_days"`    // 保存天数，同时也是签名链接的有效期
+}
+
+var imageRehostSetting = ImageRehostSetting{
+	Enabled:        false,
+	MaxImageSizeMB: 20,
+	RetentionDays:  7,
+}
+
+func init() {
+	config.GlobalConfig.Register("image_rehost_setting", &imageRehostSetting)
+}
+
+func GetImageRehostSetting() *ImageRehostSetting {
+	return &imageRehostSetting
+}
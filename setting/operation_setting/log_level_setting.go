@@ -0,0 +1,23 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// LogLevelSetting 运行时日志级别，可按模块单独调整，修改后无需重启
+type LogLevelSetting struct {
+	Level string `json:"level"` // debug / info / warn / error，DEBUG=true 时至少为 debug
+	// Modules 模块日志级别，覆盖全局级别，空值表示沿用全局级别
+	Modules map[string]string `json:"modules"`
+}
+
+var logLevelSetting = LogLevelSetting{
+	Level:   "info",
+	Modules: map[string]string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("log_level_setting", &logLevelSetting)
+}
+
+func GetLogLevelSetting() *LogLevelSetting {
+	return &logLevelSetting
+}
@@ -0,0 +1,60 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// LogRetentionSetting 按日志类型清理过期日志，日志详情沿用 DetailedLogRetentionDays
+type LogRetentionSetting struct {
+	// ConsumeLogDays 消费日志保留天数，0 表示不清理
+	ConsumeLogDays int `json:"consume_log_days"`
+	// ErrorLogDays 错误日志保留天数，0 表示不清理
+	ErrorLogDays int `json:"error_log_days"`
+	// AuditLogDays 管理员审计日志保留天数，0 表示不清理
+	AuditLogDays int `json:"audit_log_days"`
+	// Archive 清理前将记录导出为 gzip 压缩的 NDJSON 文件写入存储（本地目录或对象存储），导出失败时不删除
+	Archive bool `json:"archive"`
+	// IntervalMinutes 自动清理的间隔分钟数
+	IntervalMinutes int `json:"interval_minutes"`
+	// BatchSize 每批删除的记录数
+	BatchSize int `json:"batch_size"`
+	// BatchDelayMs 两批之间的等待毫秒数，用于降低数据库压力
+	BatchDelayMs int `json:"batch_delay_ms"`
+}
+
+var logRetentionSetting = LogRetentionSetting{
+	IntervalMinutes: 360,
+	BatchSize:       5000,
+	BatchDelayMs:    100,
+}
+
+func init() {
+	config.GlobalConfig.Register("log_retention_setting", &logRetentionSetting)
+}
+
+func GetLogRetentionSetting() *LogRetentionSetting {
+	return &logRetentionSetting
+}
+
+func (s *LogRetentionSetting) Interval() time.Duration {
+	if s.IntervalMinutes <= 0 {
+		return 6 * time.Hour
+	}
+	return time.Duration(s.IntervalMinutes) * time.Minute
+}
+
+func (s *LogRetentionSetting) GetBatchSize() int {
+	if s.BatchSize <= 0 {
+		return 5000
+	}
+	return s.BatchSize
+}
+
+func (s *LogRetentionSetting) BatchDelay() time.Duration {
+	if s.BatchDelayMs < 0 {
+		return 0
+	}
+	return time.Duration(s.BatchDelayMs) * time.Millisecond
+}
@@ -0,0 +1,115 @@
+package operation_setting
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ModelAliasTarget 别名指向的一个上游模型
+type ModelAliasTarget struct {
+	Model string `json:"model"`
+	// ChannelId 只使用该渠道，0 表示在分组内按路由策略选择提供该模型的渠道
+	ChannelId int `json:"channel_id,omitempty"`
+}
+
+// ModelAlias 对外暴露的模型别名，Targets 按顺序组成回退链：前一个目标没有可用渠道或请求失败重试时使用下一个
+type ModelAlias struct {
+	Alias   string             `json:"alias"`
+	Targets []ModelAliasTarget `json:"targets"`
+}
+
+// ModelRewrite 按正则改写请求的模型名，Replacement 中可以使用 $1 等分组引用
+type ModelRewrite struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// ModelAliasSetting 模型别名与改写：请求的模型名先按 Rewrites 中第一条匹配的规则改写，再查找别名，
+// 别名在选择渠道时解析为目标模型，计费和日志按实际使用的目标模型记录。
+//
+// GroupVisibility 按分组限制可见的模型，以 * 结尾表示前缀匹配，未配置的分组可以使用所有模型。
+// 不可见的模型既不会出现在 /v1/models 中，也不能被请求。
+type ModelAliasSetting struct {
+	Enabled         bool                `json:"enabled"`
+	Aliases         []ModelAlias        `json:"aliases"`
+	Rewrites        []ModelRewrite      `json:"rewrites"`
+	GroupVisibility map[string][]string `json:"group_visibility"`
+}
+
+var modelAliasSetting = ModelAliasSetting{
+	Enabled:         false,
+	Aliases:         []ModelAlias{},
+	Rewrites:        []ModelRewrite{},
+	GroupVisibility: map[string][]string{},
+}
+
+// modelRewritePatterns 编译后的改写规则，编译失败的规则缓存为 nil
+var modelRewritePatterns sync.Map
+
+func init() {
+	config.GlobalConfig.Register("model_alias_setting", &modelAliasSetting)
+}
+
+func GetModelAliasSetting() *ModelAliasSetting {
+	return &modelAliasSetting
+}
+
+// RewriteModel returns the model name produced by the first rewrite rule matching the whole name, or the
+// name itself when no rule matches.
+func (s *ModelAliasSetting) RewriteModel(modelName string) string {
+	for _, rewrite := range s.Rewrites {
+		re := getModelRewritePattern(rewrite.Pattern)
+		if re == nil {
+			continue
+		}
+		if match := re.FindStringSubmatchIndex(modelName); match != nil {
+			return string(re.ExpandString(nil, rewrite.Replacement, modelName, match))
+		}
+	}
+	return modelName
+}
+
+func (s *ModelAliasSetting) GetAlias(modelName string) *ModelAlias {
+	for i := range s.Aliases {
+		if s.Aliases[i].Alias == modelName && len(s.Aliases[i].Targets) > 0 {
+			return &s.Aliases[i]
+		}
+	}
+	return nil
+}
+
+// IsModelVisible reports whether the group is allowed to see and use the model.
+func (s *ModelAliasSetting) IsModelVisible(group string, modelName string) bool {
+	patterns, ok := s.GroupVisibility[group]
+	if !s.Enabled || !ok {
+		return true
+	}
+	for _, pattern := range patterns {
+		if prefix, found := strings.CutSuffix(pattern, "*"); found {
+			if strings.HasPrefix(modelName, prefix) {
+				return true
+			}
+		} else if pattern == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+func getModelRewritePattern(pattern string) *regexp.Regexp {
+	if v, ok := modelRewritePatterns.Load(pattern); ok {
+		return v.(*regexp.Regexp)
+	}
+	// 规则需要匹配完整的模型名
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		common.SysError("invalid model rewrite pattern " + pattern + ": " + err.Error())
+		re = nil
+	}
+	modelRewritePatterns.Store(pattern, re)
+	return re
+}
@@ -0,0 +1,61 @@
+package operation_setting
+
+import "testing"
+
+func TestModelAliasSettingRewriteModel(t *testing.T) {
+	setting := ModelAliasSetting{
+		Rewrites: []ModelRewrite{
+			{Pattern: "[", Replacement: "broken"},
+			{Pattern: `gpt-4o-mini-\d{4}-\d{2}-\d{2}`, Replacement: "gpt-4o-mini"},
+			{Pattern: `claude-(.+)-latest`, Replacement: "claude-$1"},
+		},
+	}
+	cases := map[string]string{
+		"gpt-4o-mini-2024-07-18":    "gpt-4o-mini",
+		"claude-sonnet-4-latest":    "claude-sonnet-4",
+		"my-gpt-4o-mini-2024-07-18": "my-gpt-4o-mini-2024-07-18",
+		"gpt-4o":                    "gpt-4o",
+	}
+	for input, expected := range cases {
+		if got := setting.RewriteModel(input); got != expected {
+			t.Fatalf("RewriteModel(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestModelAliasSettingIsModelVisible(t *testing.T) {
+	setting := ModelAliasSetting{
+		Enabled: true,
+		GroupVisibility: map[string][]string{
+			"free": {"gpt-4o-mini", "claude-3-5-haiku*"},
+		},
+	}
+	if !setting.IsModelVisible("default", "gpt-4o") {
+		t.Fatal("groups without visibility rules should see every model")
+	}
+	if !setting.IsModelVisible("free", "gpt-4o-mini") || !setting.IsModelVisible("free", "claude-3-5-haiku-20241022") {
+		t.Fatal("listed models should be visible")
+	}
+	if setting.IsModelVisible("free", "gpt-4o") {
+		t.Fatal("unlisted models should be hidden")
+	}
+	setting.Enabled = false
+	if !setting.IsModelVisible("free", "gpt-4o") {
+		t.Fatal("visibility rules should not apply when the setting is disabled")
+	}
+}
+
+func TestModelAliasSettingGetAlias(t *testing.T) {
+	setting := ModelAliasSetting{
+		Aliases: []ModelAlias{
+			{Alias: "empty"},
+			{Alias: "gpt-4o", Targets: []ModelAliasTarget{{Model: "gpt-4o-2024-11-20", ChannelId: 1}, {Model: "azure-gpt4o"}}},
+		},
+	}
+	if alias := setting.GetAlias("gpt-4o"); alias == nil || len(alias.Targets) != 2 {
+		t.Fatalf("expected alias with two targets, got %+v", alias)
+	}
+	if setting.GetAlias("empty") != nil || setting.GetAlias("gpt-4") != nil {
+		t.Fatal("aliases without targets or unknown names should not resolve")
+	}
+}
@@ -0,0 +1,77 @@
+package operation_setting
+
+import (
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	ModelClassPeriodDay   = "day"
+	ModelClassPeriodMonth = "month"
+)
+
+// ModelClassLimit 某个模型类别在一个周期内可用的 token 数
+type ModelClassLimit struct {
+	Tokens int64  `json:"tokens"` // 0 或负数表示不限
+	Period string `json:"period"` // day / month，默认 month
+}
+
+type ModelClassSetting struct {
+	Enabled bool `json:"enabled"`
+	// Classes 类别 -> 模型列表，模型名以 * 结尾时按前缀匹配，例如 {"premium": ["gpt-4o", "claude-opus-*"]}
+	Classes map[string][]string `json:"classes"`
+	// GroupLimits 用户分组 -> 类别 -> 限额，未配置的类别不限额，例如 {"default": {"premium": {"tokens": 1000000}}}
+	GroupLimits map[string]map[string]ModelClassLimit `json:"group_limits"`
+}
+
+var modelClassSetting = ModelClassSetting{
+	Enabled:     false,
+	Classes:     map[string][]string{},
+	GroupLimits: map[string]map[string]ModelClassLimit{},
+}
+
+func init() {
+	config.GlobalConfig.Register("model_class_setting", &modelClassSetting)
+}
+
+func GetModelClassSetting() *ModelClassSetting {
+	return &modelClassSetting
+}
+
+// GetModelClass returns the class the model belongs to, exact names win over the longest matching prefix.
+func GetModelClass(modelName string) string {
+	matchedClass := ""
+	matchedPrefixLen := -1
+	for class, models := range modelClassSetting.Classes {
+		for _, pattern := range models {
+			if pattern == modelName {
+				return class
+			}
+			prefix, isPrefix := strings.CutSuffix(pattern, "*")
+			if isPrefix && strings.HasPrefix(modelName, prefix) && len(prefix) > matchedPrefixLen {
+				matchedClass = class
+				matchedPrefixLen = len(prefix)
+			}
+		}
+	}
+	return matchedClass
+}
+
+// GetModelClassLimit returns the limit of the class for the user group, false when the class is unlimited.
+func GetModelClassLimit(group string, class string) (ModelClassLimit, bool) {
+	limit, ok := modelClassSetting.GroupLimits[group][class]
+	if !ok || limit.Tokens <= 0 {
+		return ModelClassLimit{}, false
+	}
+	return limit, true
+}
+
+// ModelClassPeriodKey returns the key of the quota period containing t, e.g. "2026-10" or "2026-10-16".
+func ModelClassPeriodKey(period string, t time.Time) string {
+	if period == ModelClassPeriodDay {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01")
+}
@@ -0,0 +1,75 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	ModerationBackendOpenAI  = "openai"  // OpenAI /v1/moderations 接口
+	ModerationBackendKeyword = "keyword" // 本地关键词和正则列表
+	ModerationBackendHTTP    = "http"    // 外部 HTTP 审核服务
+)
+
+const (
+	ModerationActionBlock = "block" // 拒绝违规请求
+	ModerationActionFlag  = "flag"  // 只在日志中标记，请求照常转发
+)
+
+// ModerationSetting 转发前对请求文本进行内容审核，审核结论记录在日志详情中。
+//
+// 外部 HTTP 服务收到 {"text","model","user_id","group"}，返回 {"flagged":bool,"categories":[...],"reason":"..."}
+type ModerationSetting struct {
+	Enabled bool `json:"enabled"`
+	// Groups 只审核这些用户分组的请求，为空表示所有分组
+	Groups  []string `json:"groups,omitempty"`
+	Backend string   `json:"backend"`
+	Action  string   `json:"action"`
+	// FailOpen 审核服务出错或超时时放行请求，关闭时按违规处理
+	FailOpen       bool `json:"fail_open"`
+	TimeoutSeconds int  `json:"timeout_seconds"`
+	// MaxTextLength 送审文本的最大字符数，超出部分不审核，0 表示不限制
+	MaxTextLength int `json:"max_text_length"`
+
+	OpenAIBaseURL string `json:"openai_base_url"`
+	OpenAIApiKey  string `json:"openai_api_key"`
+	OpenAIModel   string `json:"openai_model"`
+
+	Keywords []string `json:"keywords"`
+	// Patterns 正则表达式，不区分大小写
+	Patterns []string `json:"patterns"`
+
+	HTTPURL string `json:"http_url"`
+	// HTTPSecret 以 Authorization: Bearer 请求头发送
+	HTTPSecret string `json:"http_secret"`
+}
+
+var moderationSetting = ModerationSetting{
+	Enabled:        false,
+	Groups:         []string{},
+	Backend:        ModerationBackendKeyword,
+	Action:         ModerationActionBlock,
+	FailOpen:       true,
+	TimeoutSeconds: 5,
+	MaxTextLength:  32000,
+	OpenAIBaseURL:  "https://api.openai.com",
+	OpenAIModel:    "omni-moderation-latest",
+	Keywords:       []string{},
+	Patterns:       []string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("moderation_setting", &moderationSetting)
+}
+
+func GetModerationSetting() *ModerationSetting {
+	return &moderationSetting
+}
+
+func (s *ModerationSetting) IsEnabledForGroup(group string) bool {
+	if !s.Enabled {
+		return false
+	}
+	return len(s.Groups) == 0 || slices.Contains(s.Groups, group)
+}
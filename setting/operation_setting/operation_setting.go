@@ -5,6 +5,9 @@ import "strings"
 var DemoSiteEnabled = false
 var SelfUseModeEnabled = false
 
+// LatencyHeadersEnabled 在转发响应中返回 Server-Timing 头，拆分网关排队、路由与上游连接、首字节耗时
+var LatencyHeadersEnabled = false
+
 var AutomaticDisableKeywords = []string{
 	"Your credit balance is too low",
 	"This organization has been disabled.",
@@ -0,0 +1,58 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const defaultProvenanceField = "x_provenance"
+
+// ProvenanceSetting 在响应中附加生成内容的来源信息（实际提供服务的模型、渠道标签、生成时间等），
+// 供需要记录内容来源的下游系统使用。非流式 JSON 响应写入顶层扩展字段，流式响应在结束前追加一个元数据事件。
+type ProvenanceSetting struct {
+	Enabled bool `json:"enabled"`
+	// Field 扩展字段名，也是流式元数据事件中的字段名
+	Field            string `json:"field"`
+	IncludeModel     bool   `json:"include_model"`
+	IncludeChannel   bool   `json:"include_channel_tag"`
+	IncludeTimestamp bool   `json:"include_timestamp"`
+	IncludeRequestId bool   `json:"include_request_id"`
+	// Attribution 固定的署名文本，为空时不附加
+	Attribution string `json:"attribution"`
+	// Groups 只对这些分组的请求附加，为空时对全部分组附加
+	Groups []string `json:"groups"`
+}
+
+var provenanceSetting = ProvenanceSetting{
+	Enabled:          false,
+	Field:            defaultProvenanceField,
+	IncludeModel:     true,
+	IncludeChannel:   true,
+	IncludeTimestamp: true,
+	IncludeRequestId: false,
+}
+
+func init() {
+	config.GlobalConfig.Register("provenance_setting", &provenanceSetting)
+}
+
+func GetProvenanceSetting() *ProvenanceSetting {
+	return &provenanceSetting
+}
+
+// FieldName returns the extension field, falling back to the default when the admin cleared it.
+func (s *ProvenanceSetting) FieldName() string {
+	if s.Field == "" {
+		return defaultProvenanceField
+	}
+	return s.Field
+}
+
+// AppliesToGroup reports whether responses of requests in group carry the metadata.
+func (s *ProvenanceSetting) AppliesToGroup(group string) bool {
+	if !s.Enabled {
+		return false
+	}
+	return len(s.Groups) == 0 || slices.Contains(s.Groups, group)
+}
@@ -4,11 +4,24 @@ import "github.com/QuantumNous/new-api/setting/config"
 
 type QuotaSetting struct {
 	EnableFreeModelPreConsume bool `json:"enable_free_model_pre_consume"` // 是否对免费模型启用预消耗
+	// 流式响应每隔多少秒按已输出的内容追加预扣费，额度不足时中断输出，0 表示关闭
+	StreamCheckpointSeconds int `json:"stream_checkpoint_seconds"`
+	// StreamReservationEnabled 流式请求总是预扣费（不再因额度充足而信任用户），请求未设置 max_tokens 时
+	// 按 StreamReserveCompletionTokens 个输出 token 预留额度，最终按实际用量多退少补
+	StreamReservationEnabled bool `json:"stream_reservation_enabled"`
+	// StreamReserveCompletionTokens 未设置 max_tokens 的流式请求预留的输出 token 数
+	StreamReserveCompletionTokens int `json:"stream_reserve_completion_tokens"`
+	// StreamHardCapQuota 单个流式请求最多消耗的额度，达到后立即中断输出，与检查点间隔无关，0 表示不限制
+	StreamHardCapQuota int `json:"stream_hard_cap_quota"`
 }
 
 // 默认配置
 var quotaSetting = QuotaSetting{
-	EnableFreeModelPreConsume: true,
+	EnableFreeModelPreConsume:     true,
+	StreamCheckpointSeconds:       0,
+	StreamReservationEnabled:      false,
+	StreamReserveCompletionTokens: 4096,
+	StreamHardCapQuota:            0,
 }
 
 func init() {
@@ -19,3 +32,17 @@ func init() {
 func GetQuotaSetting() *QuotaSetting {
 	return &quotaSetting
 }
+
+// StreamReserveTokens returns the completion tokens to reserve for a streaming request on top of the regular
+// pre-consumption, none when the request sets max_tokens since those are already pre-consumed.
+func (s *QuotaSetting) StreamReserveTokens(maxTokens int) int {
+	if !s.StreamReservationEnabled || maxTokens > 0 || s.StreamReserveCompletionTokens < 0 {
+		return 0
+	}
+	return s.StreamReserveCompletionTokens
+}
+
+// ExceedsStreamHardCap reports whether a streaming request that has cost quota so far must be stopped.
+func (s *QuotaSetting) ExceedsStreamHardCap(quota int) bool {
+	return s.StreamHardCapQuota > 0 && quota >= s.StreamHardCapQuota
+}
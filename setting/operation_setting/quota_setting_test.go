@@ -0,0 +1,25 @@
+package operation_setting
+
+import "testing"
+
+func TestQuotaSettingStreamReservation(t *testing.T) {
+	setting := QuotaSetting{StreamReservationEnabled: true, StreamReserveCompletionTokens: 2048, StreamHardCapQuota: 5000}
+	if got := setting.StreamReserveTokens(0); got != 2048 {
+		t.Fatalf("StreamReserveTokens(0) = %d, expected 2048", got)
+	}
+	if got := setting.StreamReserveTokens(512); got != 0 {
+		t.Fatalf("max_tokens is already pre-consumed, got %d", got)
+	}
+	if setting.ExceedsStreamHardCap(4999) || !setting.ExceedsStreamHardCap(5000) {
+		t.Fatal("unexpected hard cap check")
+	}
+
+	setting.StreamReservationEnabled = false
+	setting.StreamHardCapQuota = 0
+	if got := setting.StreamReserveTokens(0); got != 0 {
+		t.Fatalf("reservation is disabled, got %d", got)
+	}
+	if setting.ExceedsStreamHardCap(1 << 30) {
+		t.Fatal("hard cap is disabled")
+	}
+}
@@ -0,0 +1,37 @@
+package operation_setting
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// RateLimitResponseSetting 模型请求限流时返回给客户端的响应体。
+// 模板为 JSON，可使用占位符 {{message}} {{retry_after}} {{limit}} {{request_id}}，
+// 为空或渲染结果不是合法 JSON 时使用默认的 OpenAI 错误格式
+type RateLimitResponseSetting struct {
+	ErrorTemplate string `json:"error_template"`
+	// TokenTemplates 按令牌 ID 单独配置的模板，优先于 ErrorTemplate
+	TokenTemplates map[string]string `json:"token_templates"`
+}
+
+var rateLimitResponseSetting = RateLimitResponseSetting{
+	ErrorTemplate:  "",
+	TokenTemplates: map[string]string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("rate_limit_response_setting", &rateLimitResponseSetting)
+}
+
+func GetRateLimitResponseSetting() *RateLimitResponseSetting {
+	return &rateLimitResponseSetting
+}
+
+// GetErrorTemplate returns the template configured for the token, falling back to the global one.
+func (s *RateLimitResponseSetting) GetErrorTemplate(tokenId int) string {
+	if template, ok := s.TokenTemplates[strconv.Itoa(tokenId)]; ok && template != "" {
+		return template
+	}
+	return s.ErrorTemplate
+}
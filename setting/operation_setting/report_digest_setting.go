@@ -0,0 +1,44 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	ReportDigestDaily  = "daily"
+	ReportDigestWeekly = "weekly"
+)
+
+// ReportDigestSetting 定期给管理员发送运营报告：消耗、用户和模型排行、错误激增、被禁用的渠道和过期数据清理结果。
+// 报告通过 root 用户的通知方式发送，另外可以抄送给其他邮箱
+type ReportDigestSetting struct {
+	Enabled bool `json:"enabled"`
+	// Frequency daily 或 weekly
+	Frequency string `json:"frequency"`
+	// SendHour 发送时间，服务器本地时间的小时
+	SendHour int `json:"send_hour"`
+	// Weekday 每周报告的发送日，0 为周日
+	Weekday int `json:"weekday"`
+	// TopN 用户、模型和错误渠道排行的条数
+	TopN int `json:"top_n"`
+	// ErrorSpikeRatio 错误数达到上一周期的该倍数时标记为错误激增
+	ErrorSpikeRatio float64 `json:"error_spike_ratio"`
+	// Recipients 额外接收报告的邮箱
+	Recipients []string `json:"recipients"`
+}
+
+var reportDigestSetting = ReportDigestSetting{
+	Enabled:         false,
+	Frequency:       ReportDigestDaily,
+	SendHour:        9,
+	Weekday:         1,
+	TopN:            5,
+	ErrorSpikeRatio: 2,
+	Recipients:      []string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("report_digest_setting", &reportDigestSetting)
+}
+
+func GetReportDigestSetting() *ReportDigestSetting {
+	return &reportDigestSetting
+}
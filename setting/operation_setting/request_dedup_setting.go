@@ -0,0 +1,33 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	RequestDedupModeCoalesce = "coalesce" // 重复请求等待首个请求完成，复用其响应，不重复计费
+	RequestDedupModeReject   = "reject"   // 重复请求直接返回 409
+)
+
+// RequestDedupSetting 同一令牌在短时间内发送的完全相同的请求（重复点击、重试风暴）视为重复请求
+type RequestDedupSetting struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode"`
+	// WindowSeconds 从首个请求开始计算的判定窗口，窗口外的相同请求正常处理
+	WindowSeconds int `json:"window_seconds"`
+	// MaxResponseKB 可复用的响应大小上限，超过时重复请求改为正常处理
+	MaxResponseKB int `json:"max_response_kb"`
+}
+
+var requestDedupSetting = RequestDedupSetting{
+	Enabled:       false,
+	Mode:          RequestDedupModeCoalesce,
+	WindowSeconds: 2,
+	MaxResponseKB: 4096,
+}
+
+func init() {
+	config.GlobalConfig.Register("request_dedup_setting", &requestDedupSetting)
+}
+
+func GetRequestDedupSetting() *RequestDedupSetting {
+	return &requestDedupSetting
+}
@@ -0,0 +1,47 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RequestDefaultsAllGroups 对所有分组生效的默认参数
+const RequestDefaultsAllGroups = "*"
+
+// RequestDefaultsSetting 按分组为 OpenAI 格式的请求补充默认参数，参数路径使用 gjson 语法，
+// 例如 stream_options.include_usage、temperature。
+//
+// 优先级：客户端请求中已有的参数 > 分组默认参数 > "*" 默认参数；默认参数在转换为上游格式之前补充，
+// 渠道的参数覆盖在转换之后执行，因此仍然优先于默认参数。
+type RequestDefaultsSetting struct {
+	Enabled bool `json:"enabled"`
+	// Groups 分组 -> 参数路径 -> 默认值
+	Groups map[string]map[string]any `json:"groups"`
+}
+
+var requestDefaultsSetting = RequestDefaultsSetting{
+	Enabled: false,
+	Groups:  map[string]map[string]any{},
+}
+
+func init() {
+	config.GlobalConfig.Register("request_defaults_setting", &requestDefaultsSetting)
+}
+
+func GetRequestDefaultsSetting() *RequestDefaultsSetting {
+	return &requestDefaultsSetting
+}
+
+// GetDefaults returns the defaults of the group merged over the defaults of all groups, nil when there are none.
+func (s *RequestDefaultsSetting) GetDefaults(group string) map[string]any {
+	if !s.Enabled {
+		return nil
+	}
+	var defaults map[string]any
+	for _, name := range []string{RequestDefaultsAllGroups, group} {
+		for path, value := range s.Groups[name] {
+			if defaults == nil {
+				defaults = make(map[string]any)
+			}
+			defaults[path] = value
+		}
+	}
+	return defaults
+}
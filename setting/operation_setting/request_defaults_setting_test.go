@@ -0,0 +1,26 @@
+package operation_setting
+
+import "testing"
+
+func TestRequestDefaultsSettingGetDefaults(t *testing.T) {
+	setting := RequestDefaultsSetting{
+		Enabled: true,
+		Groups: map[string]map[string]any{
+			RequestDefaultsAllGroups: {"stream_options.include_usage": true, "temperature": 0.7},
+			"vip":                    {"temperature": 0.2},
+		},
+	}
+	defaults := setting.GetDefaults("vip")
+	if len(defaults) != 2 || defaults["temperature"] != 0.2 || defaults["stream_options.include_usage"] != true {
+		t.Fatalf("unexpected vip defaults: %v", defaults)
+	}
+	defaults = setting.GetDefaults("default")
+	if len(defaults) != 2 || defaults["temperature"] != 0.7 {
+		t.Fatalf("unexpected default group defaults: %v", defaults)
+	}
+
+	setting.Enabled = false
+	if defaults = setting.GetDefaults("vip"); defaults != nil {
+		t.Fatalf("disabled setting should have no defaults, got %v", defaults)
+	}
+}
@@ -0,0 +1,41 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RequestQueueSetting 用户达到并发或请求频率限制时，请求在本节点按先进先出排队等待，而不是直接返回 429。
+// 关闭时超出限制的请求仍直接返回 429
+type RequestQueueSetting struct {
+	Enabled bool `json:"enabled"`
+	// MaxQueueSize 本节点同时排队的请求数上限，队列已满时直接返回 429
+	MaxQueueSize int `json:"max_queue_size"`
+	// MaxWaitSeconds 单个请求最长排队时间，超时仍未放行时返回 429
+	MaxWaitSeconds int `json:"max_wait_seconds"`
+	// UserMaxConcurrency 每个用户在本节点同时处理的请求数上限，0 表示不限制
+	UserMaxConcurrency int `json:"user_max_concurrency"`
+	// GroupMaxConcurrency 按分组覆盖 UserMaxConcurrency
+	GroupMaxConcurrency map[string]int `json:"group_max_concurrency"`
+}
+
+var requestQueueSetting = RequestQueueSetting{
+	Enabled:             false,
+	MaxQueueSize:        1000,
+	MaxWaitSeconds:      30,
+	UserMaxConcurrency:  0,
+	GroupMaxConcurrency: map[string]int{},
+}
+
+func init() {
+	config.GlobalConfig.Register("request_queue_setting", &requestQueueSetting)
+}
+
+func GetRequestQueueSetting() *RequestQueueSetting {
+	return &requestQueueSetting
+}
+
+// UserConcurrencyLimit returns the concurrency limit of a user in the group, 0 for unlimited.
+func (s *RequestQueueSetting) UserConcurrencyLimit(group string) int {
+	if limit, ok := s.GroupMaxConcurrency[group]; ok {
+		return limit
+	}
+	return s.UserMaxConcurrency
+}
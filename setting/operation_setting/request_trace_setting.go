@@ -0,0 +1,23 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RequestTraceSetting 请求追踪：记录每个中转请求的鉴权、路由、重试、上游耗时等时间线，按请求 ID 查询用于事后排查
+type RequestTraceSetting struct {
+	Enabled bool `json:"enabled"`
+	// RetentionDays 追踪记录保留天数，0 表示不清理
+	RetentionDays int `json:"retention_days"`
+}
+
+var requestTraceSetting = RequestTraceSetting{
+	Enabled:       false,
+	RetentionDays: 7,
+}
+
+func init() {
+	config.GlobalConfig.Register("request_trace_setting", &requestTraceSetting)
+}
+
+func GetRequestTraceSetting() *RequestTraceSetting {
+	return &requestTraceSetting
+}
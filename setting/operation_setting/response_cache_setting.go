@@ -0,0 +1,53 @@
+package operation_setting
+
+import (
+	"slices"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponseCacheSetting 对话响应缓存：相同模型、消息和参数的非流式请求直接返回缓存的响应，不请求上游。
+// 需要令牌开启响应缓存，或令牌所在分组在 Groups 中。客户端可以通过 Cache-Control: no-cache 跳过读取缓存，no-store 同时不写入缓存。
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// TTLMinutes 缓存保留分钟数
+	TTLMinutes int `json:"ttl_minutes"`
+	// MaxEntries 未开启 Redis 时内存中最多缓存的条目数
+	MaxEntries int `json:"max_entries"`
+	// Groups 对这些分组的所有令牌开启
+	Groups []string `json:"groups,omitempty"`
+	// ShareAcrossUsers 不同用户的相同请求共用缓存，关闭时缓存按用户隔离
+	ShareAcrossUsers bool `json:"share_across_users"`
+	// HitQuotaRatio 命中缓存时的计费倍率，0 表示免费
+	HitQuotaRatio float64 `json:"hit_quota_ratio"`
+}
+
+var responseCacheSetting = ResponseCacheSetting{
+	TTLMinutes:    60,
+	MaxEntries:    10_000,
+	HitQuotaRatio: 0,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// IsEnabledFor reports whether responses are cached for the request of a token in the group.
+func (s *ResponseCacheSetting) IsEnabledFor(group string, tokenEnabled bool) bool {
+	if !s.Enabled {
+		return false
+	}
+	return tokenEnabled || slices.Contains(s.Groups, group)
+}
+
+func (s *ResponseCacheSetting) TTL() time.Duration {
+	if s.TTLMinutes <= 0 {
+		return time.Hour
+	}
+	return time.Duration(s.TTLMinutes) * time.Minute
+}
@@ -0,0 +1,27 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ResponseCompressionSetting 客户端在 Accept-Encoding 中声明支持时，压缩较大的非流式 JSON 响应（例如大量向量的
+// embeddings 或很长的补全），流式响应不压缩
+type ResponseCompressionSetting struct {
+	Enabled bool `json:"enabled"`
+	// MinBytes 响应体达到该大小才压缩
+	MinBytes int `json:"min_bytes"`
+	// Brotli 客户端同时支持 br 和 gzip 时优先使用 br
+	Brotli bool `json:"brotli"`
+}
+
+var responseCompressionSetting = ResponseCompressionSetting{
+	Enabled:  false,
+	MinBytes: 8192,
+	Brotli:   true,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_compression_setting", &responseCompressionSetting)
+}
+
+func GetResponseCompressionSetting() *ResponseCompressionSetting {
+	return &responseCompressionSetting
+}
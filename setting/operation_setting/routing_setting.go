@@ -0,0 +1,103 @@
+package operation_setting
+
+import (
+	"slices"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	RoutingStrategyPriority           = "priority"             // 按优先级和权重随机选择（默认）
+	RoutingStrategyCheapestFirst      = "cheapest_first"       // 优先选择有效成本最低的渠道
+	RoutingStrategyWeightedRoundRobin = "weighted_round_robin" // 最高优先级的渠道按权重轮询
+	RoutingStrategyLeastLatency       = "least_latency"        // 优先选择近期延迟最低（按错误率加权）的渠道
+	RoutingStrategyLeastInFlight      = "least_in_flight"      // 优先选择正在处理的请求最少的渠道
+)
+
+var routingStrategies = []string{
+	RoutingStrategyPriority,
+	RoutingStrategyCheapestFirst,
+	RoutingStrategyWeightedRoundRobin,
+	RoutingStrategyLeastLatency,
+	RoutingStrategyLeastInFlight,
+}
+
+type RoutingSetting struct {
+	// Strategy 渠道选择策略，见 RoutingStrategy* 常量
+	Strategy string `json:"strategy"`
+	// GroupStrategies 按分组覆盖渠道选择策略，值为空表示使用 Strategy
+	GroupStrategies map[string]string `json:"group_strategies"`
+	// StatsWindowMinutes 渠道延迟和错误率的统计窗口分钟数
+	StatsWindowMinutes int `json:"stats_window_minutes"`
+	// LatencyPenaltyFactor 最低价优先时的延迟惩罚系数，得分 = 成本 × (1 + 系数 × 响应秒数)，0 表示只比较成本
+	LatencyPenaltyFactor float64 `json:"latency_penalty_factor"`
+	// RegionAffinityEnabled 优先选择与当前实例（或客户端指定）同区域的渠道，本区域渠道全部失败后才跨区域重试
+	RegionAffinityEnabled bool `json:"region_affinity_enabled"`
+	// ClientRegionHintEnabled 是否允许客户端通过 New-Api-Region 请求头指定期望区域
+	ClientRegionHintEnabled bool `json:"client_region_hint_enabled"`
+	// GroupComplianceTags 分组要求的渠道合规属性，例如 {"eu": ["eu-only", "no-training"]}
+	GroupComplianceTags map[string][]string `json:"group_compliance_tags"`
+	// CapabilityRoutingEnabled 请求需要工具调用、图片输入或 JSON 模式时，只选择支持这些能力的渠道
+	CapabilityRoutingEnabled bool `json:"capability_routing_enabled"`
+}
+
+var routingSetting = RoutingSetting{
+	Strategy:                 RoutingStrategyPriority,
+	GroupStrategies:          map[string]string{},
+	StatsWindowMinutes:       5,
+	LatencyPenaltyFactor:     0,
+	RegionAffinityEnabled:    false,
+	ClientRegionHintEnabled:  false,
+	GroupComplianceTags:      map[string][]string{},
+	CapabilityRoutingEnabled: false,
+}
+
+func init() {
+	config.GlobalConfig.Register("routing_setting", &routingSetting)
+}
+
+func GetRoutingSetting() *RoutingSetting {
+	return &routingSetting
+}
+
+// GetGroupComplianceTags returns the compliance tags channels must carry to serve the group.
+func GetGroupComplianceTags(group string) []string {
+	return routingSetting.GroupComplianceTags[group]
+}
+
+func IsValidRoutingStrategy(strategy string) bool {
+	return slices.Contains(routingStrategies, strategy)
+}
+
+// GetRoutingStrategy returns the channel selection strategy of the group.
+func GetRoutingStrategy(group string) string {
+	if strategy := routingSetting.GroupStrategies[group]; strategy != "" {
+		return strategy
+	}
+	return routingSetting.Strategy
+}
+
+// UsesChannelStats reports whether any group routes by the channel latency or in-flight statistics,
+// the statistics are only collected then.
+func (s *RoutingSetting) UsesChannelStats() bool {
+	usesStats := func(strategy string) bool {
+		return strategy == RoutingStrategyLeastLatency || strategy == RoutingStrategyLeastInFlight
+	}
+	if usesStats(s.Strategy) {
+		return true
+	}
+	for _, strategy := range s.GroupStrategies {
+		if usesStats(strategy) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *RoutingSetting) StatsWindow() time.Duration {
+	if s.StatsWindowMinutes <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(s.StatsWindowMinutes) * time.Minute
+}
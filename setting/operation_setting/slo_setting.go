@@ -0,0 +1,55 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// SLOTarget 模型服务目标，0 表示不检查该项
+type SLOTarget struct {
+	SuccessRate       float64 `json:"success_rate"`       // 成功率目标，例如 0.99
+	LatencyMs         int     `json:"latency_ms"`         // 延迟目标，流式请求按首字时间计算
+	LatencyPercentile float64 `json:"latency_percentile"` // 延迟目标的分位，默认 0.95
+}
+
+type SLOSetting struct {
+	Enabled bool `json:"enabled"`
+	// WindowMinutes 错误预算的滚动统计窗口
+	WindowMinutes int `json:"window_minutes"`
+	// AlertBurnRate 预算消耗速度达到该倍数时通知管理员，1 表示恰好在窗口结束时耗尽预算
+	AlertBurnRate float64 `json:"alert_burn_rate"`
+	// MinRequests 窗口内请求数少于该值时不计算消耗速度，避免少量请求误报
+	MinRequests int64 `json:"min_requests"`
+	// DeprioritizeBurningChannels 路由时优先避开消耗速度超过告警倍数的渠道，没有其他渠道时仍会使用
+	DeprioritizeBurningChannels bool `json:"deprioritize_burning_channels"`
+	// Targets 按对外模型名配置的服务目标，例如 {"gpt-4o": {"success_rate": 0.99, "latency_ms": 10000}}
+	Targets map[string]SLOTarget `json:"targets"`
+}
+
+var sloSetting = SLOSetting{
+	Enabled:       false,
+	WindowMinutes: 60,
+	AlertBurnRate: 2,
+	MinRequests:   20,
+	Targets:       map[string]SLOTarget{},
+}
+
+func init() {
+	config.GlobalConfig.Register("slo_setting", &sloSetting)
+}
+
+func GetSLOSetting() *SLOSetting {
+	return &sloSetting
+}
+
+// GetSLOTarget returns the target of the model when SLO tracking is enabled.
+func GetSLOTarget(model string) (SLOTarget, bool) {
+	if !sloSetting.Enabled {
+		return SLOTarget{}, false
+	}
+	target, ok := sloSetting.Targets[model]
+	if !ok || (target.SuccessRate <= 0 && target.LatencyMs <= 0) {
+		return SLOTarget{}, false
+	}
+	if target.LatencyPercentile <= 0 || target.LatencyPercentile >= 1 {
+		target.LatencyPercentile = 0.95
+	}
+	return target, true
+}
@@ -0,0 +1,68 @@
+package operation_setting
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// SyntheticProbeFingerprint 外部拨测使用的固定请求
+type SyntheticProbeFingerprint struct {
+	// Model 为空时匹配所有模型
+	Model string `json:"model"`
+	// Prompt 请求中唯一的一条用户消息，忽略大小写、首尾空白与连续空白后完全相同才匹配
+	Prompt string `json:"prompt"`
+	// Response 返回给拨测方的回复内容
+	Response string `json:"response"`
+}
+
+// SyntheticProbeSetting 拨测请求在分发渠道之前直接返回固定回复，不请求上游、不计费、不记录日志
+type SyntheticProbeSetting struct {
+	Enabled      bool                        `json:"enabled"`
+	Fingerprints []SyntheticProbeFingerprint `json:"fingerprints"`
+	// TokenIds 只对这些拨测专用令牌生效，为空时不拦截任何请求
+	TokenIds []int `json:"token_ids"`
+}
+
+var syntheticProbeSetting = SyntheticProbeSetting{
+	Enabled: false,
+	Fingerprints: []SyntheticProbeFingerprint{
+		{Prompt: "ping", Response: "pong"},
+	},
+	TokenIds: []int{},
+}
+
+func init() {
+	config.GlobalConfig.Register("synthetic_probe_setting", &syntheticProbeSetting)
+}
+
+func GetSyntheticProbeSetting() *SyntheticProbeSetting {
+	return &syntheticProbeSetting
+}
+
+func normalizeProbePrompt(prompt string) string {
+	return strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+}
+
+// MatchSyntheticProbe returns the fingerprint the request of the token matches, nil for regular traffic.
+// Only the listed probe tokens are matched, so a customer sending the same prompt is always relayed.
+func (s *SyntheticProbeSetting) MatchSyntheticProbe(tokenId int, modelName string, prompt string) *SyntheticProbeFingerprint {
+	if !s.Enabled || len(s.Fingerprints) == 0 || !slices.Contains(s.TokenIds, tokenId) {
+		return nil
+	}
+	prompt = normalizeProbePrompt(prompt)
+	if prompt == "" {
+		return nil
+	}
+	for i := range s.Fingerprints {
+		fingerprint := &s.Fingerprints[i]
+		if fingerprint.Model != "" && fingerprint.Model != modelName {
+			continue
+		}
+		if normalizeProbePrompt(fingerprint.Prompt) == prompt {
+			return fingerprint
+		}
+	}
+	return nil
+}
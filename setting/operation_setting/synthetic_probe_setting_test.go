@@ -0,0 +1,38 @@
+package operation_setting
+
+import "testing"
+
+func TestMatchSyntheticProbe(t *testing.T) {
+	setting := SyntheticProbeSetting{
+		Enabled: true,
+		Fingerprints: []SyntheticProbeFingerprint{
+			{Model: "gpt-4o-mini", Prompt: "Health  check", Response: "ok"},
+			{Prompt: "ping", Response: "pong"},
+		},
+		TokenIds: []int{1, 2},
+	}
+	if fp := setting.MatchSyntheticProbe(1, "gpt-4o-mini", "  health check\n"); fp == nil || fp.Response != "ok" {
+		t.Fatalf("normalized prompt should match, got %v", fp)
+	}
+	if fp := setting.MatchSyntheticProbe(1, "gpt-4o", "health check"); fp != nil {
+		t.Fatalf("fingerprint bound to another model matched: %v", fp)
+	}
+	if fp := setting.MatchSyntheticProbe(1, "any-model", "PING"); fp == nil || fp.Response != "pong" {
+		t.Fatalf("model-less fingerprint should match any model, got %v", fp)
+	}
+	if fp := setting.MatchSyntheticProbe(1, "any-model", "ping me later"); fp != nil {
+		t.Fatalf("partial prompt matched: %v", fp)
+	}
+
+	if fp := setting.MatchSyntheticProbe(3, "any-model", "ping"); fp != nil {
+		t.Fatalf("probe matched for a token outside token_ids: %v", fp)
+	}
+	if fp := setting.MatchSyntheticProbe(2, "any-model", "ping"); fp == nil {
+		t.Fatal("probe should match for a listed token")
+	}
+
+	setting.TokenIds = nil
+	if fp := setting.MatchSyntheticProbe(1, "any-model", "ping"); fp != nil {
+		t.Fatalf("probe matched without any probe token configured: %v", fp)
+	}
+}
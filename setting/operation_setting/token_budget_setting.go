@@ -0,0 +1,27 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TokenBudgetSetting token 预算信封：父请求通过 X-Budget-Tokens 声明总预算，
+// 携带相同 X-Budget-Id 的子请求共同消耗该预算，用尽后拒绝后续请求，防止自主 agent 失控
+type TokenBudgetSetting struct {
+	Enabled bool `json:"enabled"`
+	// MaxBudgetTokens 单个预算可声明的 token 上限，0 表示不限制
+	MaxBudgetTokens int64 `json:"max_budget_tokens"`
+	// TTLMinutes 预算从声明开始的有效期，过期后同一 ID 可重新声明
+	TTLMinutes int `json:"ttl_minutes"`
+}
+
+var tokenBudgetSetting = TokenBudgetSetting{
+	Enabled:         false,
+	MaxBudgetTokens: 0,
+	TTLMinutes:      1440,
+}
+
+func init() {
+	config.GlobalConfig.Register("token_budget_setting", &tokenBudgetSetting)
+}
+
+func GetTokenBudgetSetting() *TokenBudgetSetting {
+	return &tokenBudgetSetting
+}
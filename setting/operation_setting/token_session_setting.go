@@ -0,0 +1,39 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TokenSessionSetting 令牌使用来源分析：按 IP 段、UA 类型和国家聚合记录令牌的使用来源，
+// 令牌突然出现在新的国家或短时间内来自大量不同 IP 段时视为疑似泄露
+type TokenSessionSetting struct {
+	Enabled bool `json:"enabled"`
+	// CountryHeaders 读取客户端国家代码的请求头，按顺序取第一个非空值，通常由 CDN 注入
+	CountryHeaders []string `json:"country_headers"`
+	// WindowHours 检测窗口，窗口之前的记录作为令牌的历史基线
+	WindowHours int `json:"window_hours"`
+	// MaxDistinctIpPrefixes 窗口内不同 IP 段数量超过该值视为异常，0 表示不检测
+	MaxDistinctIpPrefixes int `json:"max_distinct_ip_prefixes"`
+	// AlertOnNewCountry 窗口内出现基线中没有的国家时视为异常
+	AlertOnNewCountry bool `json:"alert_on_new_country"`
+	// AutoSuspend 发现异常时自动禁用令牌
+	AutoSuspend bool `json:"auto_suspend"`
+	// RetentionDays 记录保留天数，0 表示不清理
+	RetentionDays int `json:"retention_days"`
+}
+
+var tokenSessionSetting = TokenSessionSetting{
+	Enabled:               false,
+	CountryHeaders:        []string{"CF-IPCountry", "CloudFront-Viewer-Country", "X-Country-Code"},
+	WindowHours:           24,
+	MaxDistinctIpPrefixes: 20,
+	AlertOnNewCountry:     true,
+	AutoSuspend:           false,
+	RetentionDays:         30,
+}
+
+func init() {
+	config.GlobalConfig.Register("token_session_setting", &tokenSessionSetting)
+}
+
+func GetTokenSessionSetting() *TokenSessionSetting {
+	return &tokenSessionSetting
+}
@@ -0,0 +1,53 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// TokenizerEncoding 额外的 tiktoken 格式词表，用于内置词表不覆盖的模型。
+// 词表文件 <Dir>/<Name>.tiktoken 不存在时从 URL 下载，文件内容必须与 SHA256 一致
+type TokenizerEncoding struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// Pattern 预分词的正则表达式，为空时使用 cl100k_base 的规则
+	Pattern string `json:"pattern"`
+	// Models 使用该词表的模型名前缀
+	Models []string `json:"models"`
+}
+
+type TokenizerSetting struct {
+	// Dir 词表文件的存放目录，离线部署时可预先放入词表文件
+	Dir       string              `json:"dir"`
+	Encodings []TokenizerEncoding `json:"encodings"`
+}
+
+var tokenizerSetting = TokenizerSetting{
+	Dir:       "data/tokenizers",
+	Encodings: []TokenizerEncoding{},
+}
+
+func init() {
+	config.GlobalConfig.Register("tokenizer_setting", &tokenizerSetting)
+}
+
+func GetTokenizerSetting() *TokenizerSetting {
+	return &tokenizerSetting
+}
+
+// MatchEncoding returns the encoding with the longest model prefix matching the model, nil when none matches.
+func (s *TokenizerSetting) MatchEncoding(model string) *TokenizerEncoding {
+	var matched *TokenizerEncoding
+	longest := 0
+	for i := range s.Encodings {
+		for _, prefix := range s.Encodings[i].Models {
+			if prefix != "" && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+				matched = &s.Encodings[i]
+				longest = len(prefix)
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,21 @@
+package operation_setting
+
+import "testing"
+
+func TestTokenizerSettingMatchEncodingPrefersLongestPrefix(t *testing.T) {
+	setting := TokenizerSetting{
+		Encodings: []TokenizerEncoding{
+			{Name: "generic", Models: []string{"qwen"}},
+			{Name: "qwen3", Models: []string{"qwen3-", ""}},
+		},
+	}
+	if got := setting.MatchEncoding("qwen3-max"); got == nil || got.Name != "qwen3" {
+		t.Fatalf("expected qwen3, got %+v", got)
+	}
+	if got := setting.MatchEncoding("qwen-plus"); got == nil || got.Name != "generic" {
+		t.Fatalf("expected generic, got %+v", got)
+	}
+	if got := setting.MatchEncoding("gpt-4o"); got != nil {
+		t.Fatalf("expected no match, got %+v", got)
+	}
+}
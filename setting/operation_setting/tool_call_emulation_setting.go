@@ -0,0 +1,52 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ToolCallEmulationSetting 上游模型不支持原生工具调用时，由网关用提示词模拟：把工具描述注入系统提示词，
+// 再把模型输出的 JSON 解析为 tool_calls 返回给客户端，多轮对话中的工具结果转换为普通消息。
+type ToolCallEmulationSetting struct {
+	Enabled bool `json:"enabled"`
+	// Models 总是模拟工具调用的上游模型，以 * 结尾表示前缀匹配
+	Models []string `json:"models"`
+	// EmulateUnsupported 模型能力中标记为不支持工具调用的模型也使用模拟，而不是拒绝请求
+	EmulateUnsupported bool `json:"emulate_unsupported"`
+}
+
+var toolCallEmulationSetting = ToolCallEmulationSetting{
+	Enabled:            false,
+	Models:             []string{},
+	EmulateUnsupported: true,
+}
+
+func init() {
+	config.GlobalConfig.Register("tool_call_emulation_setting", &toolCallEmulationSetting)
+}
+
+func GetToolCallEmulationSetting() *ToolCallEmulationSetting {
+	return &toolCallEmulationSetting
+}
+
+// ShouldEmulate reports whether the tool calls of a request to the upstream model are emulated, toolCallSupported
+// is the tool call capability of the model, nil when unknown.
+func (s *ToolCallEmulationSetting) ShouldEmulate(modelName string, toolCallSupported *bool) bool {
+	if !s.Enabled {
+		return false
+	}
+	if s.EmulateUnsupported && toolCallSupported != nil && !*toolCallSupported {
+		return true
+	}
+	for _, pattern := range s.Models {
+		if prefix, found := strings.CutSuffix(pattern, "*"); found {
+			if strings.HasPrefix(modelName, prefix) {
+				return true
+			}
+		} else if pattern == modelName {
+			return true
+		}
+	}
+	return false
+}
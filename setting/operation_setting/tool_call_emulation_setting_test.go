@@ -0,0 +1,33 @@
+package operation_setting
+
+import "testing"
+
+func TestToolCallEmulationSettingShouldEmulate(t *testing.T) {
+	supported, unsupported := true, false
+	setting := ToolCallEmulationSetting{Enabled: true, Models: []string{"llama-2*", "mistral-7b"}, EmulateUnsupported: true}
+	cases := []struct {
+		model     string
+		supported *bool
+		expected  bool
+	}{
+		{"llama-2-70b", nil, true},
+		{"mistral-7b", &supported, true},
+		{"mistral-7b-instruct", nil, false},
+		{"deepseek-reasoner", &unsupported, true},
+		{"gpt-4o", &supported, false},
+	}
+	for _, tc := range cases {
+		if got := setting.ShouldEmulate(tc.model, tc.supported); got != tc.expected {
+			t.Fatalf("ShouldEmulate(%s) = %v, expected %v", tc.model, got, tc.expected)
+		}
+	}
+
+	setting.EmulateUnsupported = false
+	if setting.ShouldEmulate("deepseek-reasoner", &unsupported) {
+		t.Fatal("unsupported models should not be emulated when EmulateUnsupported is off")
+	}
+	setting.Enabled = false
+	if setting.ShouldEmulate("llama-2-70b", nil) {
+		t.Fatal("disabled setting should not emulate")
+	}
+}
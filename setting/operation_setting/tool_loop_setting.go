@@ -0,0 +1,45 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ToolLoopFinishReason 工具循环超出上限时响应的 finish_reason
+const ToolLoopFinishReason = "max_turns_exceeded"
+
+const (
+	ToolLoopStopMaxIterations  = "max_iterations"
+	ToolLoopStopMaxTotalTokens = "max_total_tokens"
+)
+
+// ToolLoopSetting 网关编排工具调用循环（例如服务端执行的 fetch_url）时每个请求的上限，超出后停止循环，
+// 把最后一次响应以 finish_reason 为 max_turns_exceeded 返回给客户端
+type ToolLoopSetting struct {
+	// MaxIterations 单个请求最多执行工具的轮数
+	MaxIterations int `json:"max_iterations"`
+	// MaxTotalTokens 单个请求所有上游调用累计消耗的 token 上限，0 表示不限制
+	MaxTotalTokens int `json:"max_total_tokens"`
+}
+
+var toolLoopSetting = ToolLoopSetting{
+	MaxIterations:  3,
+	MaxTotalTokens: 0,
+}
+
+func init() {
+	config.GlobalConfig.Register("tool_loop_setting", &toolLoopSetting)
+}
+
+func GetToolLoopSetting() *ToolLoopSetting {
+	return &toolLoopSetting
+}
+
+// StopReason returns why the loop must stop before running another round of tools, after the given number of
+// rounds and tokens spent so far, or an empty string when it may go on.
+func (s *ToolLoopSetting) StopReason(iterations int, totalTokens int) string {
+	if iterations >= s.MaxIterations {
+		return ToolLoopStopMaxIterations
+	}
+	if s.MaxTotalTokens > 0 && totalTokens >= s.MaxTotalTokens {
+		return ToolLoopStopMaxTotalTokens
+	}
+	return ""
+}
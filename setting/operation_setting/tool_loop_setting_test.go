@@ -0,0 +1,27 @@
+package operation_setting
+
+import "testing"
+
+func TestToolLoopSettingStopReason(t *testing.T) {
+	setting := ToolLoopSetting{MaxIterations: 2, MaxTotalTokens: 1000}
+	cases := []struct {
+		iterations  int
+		totalTokens int
+		expected    string
+	}{
+		{0, 0, ""},
+		{1, 999, ""},
+		{2, 10, ToolLoopStopMaxIterations},
+		{1, 1000, ToolLoopStopMaxTotalTokens},
+	}
+	for _, tc := range cases {
+		if got := setting.StopReason(tc.iterations, tc.totalTokens); got != tc.expected {
+			t.Fatalf("StopReason(%d, %d) = %q, expected %q", tc.iterations, tc.totalTokens, got, tc.expected)
+		}
+	}
+
+	setting.MaxTotalTokens = 0
+	if got := setting.StopReason(1, 1<<30); got != "" {
+		t.Fatalf("token cap should be disabled, got %q", got)
+	}
+}
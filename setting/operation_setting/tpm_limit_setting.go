@@ -0,0 +1,47 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	TPMLimitModeReject = "reject" // 超出时直接返回 429
+	TPMLimitModeQueue  = "queue"  // 超出时等待窗口释放，超过 MaxQueueSeconds 仍不足再返回 429
+)
+
+// TPMLimitSetting 按每分钟 token 数限流：准入时计入预估的输入 token，流式输出过程中实时计入已输出的 token，
+// 结算时按实际用量修正。开启 Redis 时多节点共享计数
+type TPMLimitSetting struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode"`
+	// 单个令牌、单个用户每分钟的 token 上限，0 表示不限制
+	TokenTPM int `json:"token_tpm"`
+	UserTPM  int `json:"user_tpm"`
+	// GroupTPM 分组内所有用户合计每分钟的 token 上限，未配置的分组不限制
+	GroupTPM map[string]int `json:"group_tpm"`
+	// UserTPMOverrides 按用户 ID 覆盖 UserTPM
+	UserTPMOverrides map[int]int `json:"user_tpm_overrides"`
+	MaxQueueSeconds  int         `json:"max_queue_seconds"`
+}
+
+var tpmLimitSetting = TPMLimitSetting{
+	Enabled:          false,
+	Mode:             TPMLimitModeReject,
+	GroupTPM:         map[string]int{},
+	UserTPMOverrides: map[int]int{},
+	MaxQueueSeconds:  10,
+}
+
+func init() {
+	config.GlobalConfig.Register("tpm_limit_setting", &tpmLimitSetting)
+}
+
+func GetTPMLimitSetting() *TPMLimitSetting {
+	return &tpmLimitSetting
+}
+
+// UserLimit returns the tokens per minute allowed for the user, 0 for unlimited.
+func (s *TPMLimitSetting) UserLimit(userId int) int {
+	if limit, ok := s.UserTPMOverrides[userId]; ok {
+		return limit
+	}
+	return s.UserTPM
+}
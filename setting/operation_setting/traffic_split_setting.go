@@ -0,0 +1,47 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TrafficSplitRule 某个模型在基准渠道和新渠道之间的流量分配，用于评估新的供应商
+type TrafficSplitRule struct {
+	Model string `json:"model"`
+	// ChannelId 基准渠道，CandidateChannelId 被评估的新渠道
+	ChannelId          int `json:"channel_id"`
+	CandidateChannelId int `json:"candidate_channel_id"`
+	// Percent 分给新渠道的请求百分比（0-100），影子模式下为复制给新渠道的请求百分比
+	Percent int `json:"percent"`
+	// Shadow 影子模式：请求照常路由，抽样的请求在成功后复制一份发给新渠道，新渠道的响应不返回给客户端也不计费，
+	// 两次请求都会记录日志便于对比
+	Shadow bool `json:"shadow"`
+}
+
+type TrafficSplitSetting struct {
+	Enabled bool               `json:"enabled"`
+	Rules   []TrafficSplitRule `json:"rules"`
+}
+
+var trafficSplitSetting = TrafficSplitSetting{
+	Enabled: false,
+	Rules:   []TrafficSplitRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("traffic_split_setting", &trafficSplitSetting)
+}
+
+func GetTrafficSplitSetting() *TrafficSplitSetting {
+	return &trafficSplitSetting
+}
+
+// GetRule returns the first rule of the model, or nil when the setting is disabled.
+func (s *TrafficSplitSetting) GetRule(modelName string) *TrafficSplitRule {
+	if !s.Enabled {
+		return nil
+	}
+	for i := range s.Rules {
+		if s.Rules[i].Model == modelName && s.Rules[i].CandidateChannelId != 0 {
+			return &s.Rules[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package operation_setting
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	UsageReportDaily   = "daily"
+	UsageReportWeekly  = "weekly"
+	UsageReportMonthly = "monthly"
+)
+
+// UsageReportSetting 定期生成用量报告和账单：每个用户收到自己按令牌和模型汇总的报告，管理员收到按分组汇总的报告，
+// 附带 CSV 明细和 PDF 账单。用户报告通过用户的通知方式发送，管理员报告发送到 Recipients 和 WebhookUrl
+type UsageReportSetting struct {
+	Enabled bool `json:"enabled"`
+	// Frequency daily、weekly 或 monthly，报告覆盖发送时刻之前的一个完整周期
+	Frequency string `json:"frequency"`
+	// SendHour 发送时间，服务器本地时间的小时
+	SendHour int `json:"send_hour"`
+	// Weekday 每周报告的发送日，0 为周日；MonthDay 每月报告的发送日
+	Weekday  int `json:"weekday"`
+	MonthDay int `json:"month_day"`
+	// SendToUsers 给有消费的用户发送各自的报告
+	SendToUsers bool `json:"send_to_users"`
+	// Recipients 接收分组汇总报告的邮箱
+	Recipients    []string `json:"recipients"`
+	WebhookUrl    string   `json:"webhook_url"`
+	WebhookSecret string   `json:"webhook_secret"`
+	// Currency 账单的货币代码，为空时使用站点的额度展示货币；ExchangeRate 为 1 美元兑换该货币的数量
+	Currency       string  `json:"currency"`
+	CurrencySymbol string  `json:"currency_symbol"`
+	ExchangeRate   float64 `json:"exchange_rate"`
+	// Issuer 账单抬头
+	Issuer string `json:"issuer"`
+}
+
+var usageReportSetting = UsageReportSetting{
+	Enabled:     false,
+	Frequency:   UsageReportMonthly,
+	SendHour:    8,
+	Weekday:     1,
+	MonthDay:    1,
+	SendToUsers: false,
+	Recipients:  []string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("usage_report_setting", &usageReportSetting)
+}
+
+func GetUsageReportSetting() *UsageReportSetting {
+	return &usageReportSetting
+}
+
+func (s *UsageReportSetting) Validate() error {
+	switch s.Frequency {
+	case UsageReportDaily, UsageReportWeekly, UsageReportMonthly:
+	default:
+		return errors.New("报告周期只能是 daily、weekly 或 monthly")
+	}
+	// 每月 29 日之后的日期不是每个月都有
+	if s.MonthDay < 1 || s.MonthDay > 28 {
+		return errors.New("每月发送日需要在 1 到 28 之间")
+	}
+	if s.Currency != "" && s.ExchangeRate <= 0 {
+		return errors.New("指定货币时汇率需要大于 0")
+	}
+	return nil
+}
+
+// CurrencyInfo returns the currency code, symbol and the amount of it one US dollar is worth.
+func (s *UsageReportSetting) CurrencyInfo() (string, string, float64) {
+	if s.Currency != "" {
+		symbol := s.CurrencySymbol
+		if symbol == "" {
+			symbol = s.Currency
+		}
+		return s.Currency, symbol, s.ExchangeRate
+	}
+	switch GetQuotaDisplayType() {
+	case QuotaDisplayTypeCNY:
+		return "CNY", GetCurrencySymbol(), GetUsdToCurrencyRate(USDExchangeRate)
+	case QuotaDisplayTypeCustom:
+		return "", GetCurrencySymbol(), GetUsdToCurrencyRate(USDExchangeRate)
+	}
+	return "USD", "$", 1
+}
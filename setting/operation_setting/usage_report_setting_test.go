@@ -0,0 +1,27 @@
+package operation_setting
+
+import "testing"
+
+func TestUsageReportSettingValidate(t *testing.T) {
+	setting := UsageReportSetting{Frequency: UsageReportMonthly, MonthDay: 1}
+	if err := setting.Validate(); err != nil {
+		t.Fatalf("valid setting rejected: %v", err)
+	}
+
+	setting.MonthDay = 31
+	if err := setting.Validate(); err == nil {
+		t.Fatal("month day missing in some months accepted")
+	}
+
+	setting.MonthDay = 28
+	setting.Currency = "EUR"
+	if err := setting.Validate(); err == nil {
+		t.Fatal("currency without exchange rate accepted")
+	}
+
+	setting.ExchangeRate = 0.9
+	code, symbol, rate := setting.CurrencyInfo()
+	if code != "EUR" || symbol != "EUR" || rate != 0.9 {
+		t.Fatalf("unexpected currency info %s %s %v", code, symbol, rate)
+	}
+}
@@ -0,0 +1,28 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// UsageRollupSetting 后台任务把日志增量聚合到按小时和按天的汇总表，供 /api/analytics 接口查询
+type UsageRollupSetting struct {
+	Enabled         bool `json:"enabled"`
+	IntervalSeconds int  `json:"interval_seconds"`
+	// BatchSize 每次从日志读取的条数，积压时连续读取直到追上
+	BatchSize int `json:"batch_size"`
+	// HourlyRetentionDays 按小时的汇总保留天数，0 表示一直保留，按天的汇总一直保留
+	HourlyRetentionDays int `json:"hourly_retention_days"`
+}
+
+var usageRollupSetting = UsageRollupSetting{
+	Enabled:             true,
+	IntervalSeconds:     60,
+	BatchSize:           5000,
+	HourlyRetentionDays: 90,
+}
+
+func init() {
+	config.GlobalConfig.Register("usage_rollup_setting", &usageRollupSetting)
+}
+
+func GetUsageRollupSetting() *UsageRollupSetting {
+	return &usageRollupSetting
+}
@@ -0,0 +1,33 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// UsageSharingSetting 匿名用量共享：定期把聚合后的用量统计（模型热度、各供应商错误率）上报到运营方自己的端点，
+// 便于同一组织运行的多个实例汇总分析。不包含用户、令牌、渠道名称等任何可识别信息
+type UsageSharingSetting struct {
+	Enabled  bool   `json:"enabled"`
+	Endpoint string `json:"endpoint"`
+	// Secret 不为空时请求附带 X-Webhook-Signature 签名
+	Secret string `json:"secret"`
+	// IntervalMinutes 上报间隔，同时也是每次统计的时间窗口
+	IntervalMinutes int `json:"interval_minutes"`
+	// MinCount 请求数低于该值的模型合并到 "other"，避免暴露小众用量
+	MinCount int64 `json:"min_count"`
+	// Epsilon 拉普拉斯噪声的隐私预算，越小噪声越大，0 表示不加噪声
+	Epsilon float64 `json:"epsilon"`
+}
+
+var usageSharingSetting = UsageSharingSetting{
+	Enabled:         false,
+	IntervalMinutes: 60,
+	MinCount:        10,
+	Epsilon:         1,
+}
+
+func init() {
+	config.GlobalConfig.Register("usage_sharing_setting", &usageSharingSetting)
+}
+
+func GetUsageSharingSetting() *UsageSharingSetting {
+	return &usageSharingSetting
+}
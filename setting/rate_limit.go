@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
@@ -67,3 +68,59 @@ func CheckModelRequestRateLimitGroup(jsonStr string) error {
 
 	return nil
 }
+
+// ModelRequestRateLimitStrictGroups 使用严格模式限流的分组。启用 Redis 时，这些分组的请求在一个 Lua 脚本中
+// 原子地检查并记录总请求数和成功请求数（包括处理中的请求），多实例共享计数，不会超过设置的限制
+var ModelRequestRateLimitStrictGroups = map[string]bool{}
+
+func ModelRequestRateLimitStrictGroups2JSONString() string {
+	ModelRequestRateLimitMutex.RLock()
+	defer ModelRequestRateLimitMutex.RUnlock()
+
+	groups := make([]string, 0, len(ModelRequestRateLimitStrictGroups))
+	for group := range ModelRequestRateLimitStrictGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	jsonBytes, err := json.Marshal(groups)
+	if err != nil {
+		common.SysLog("error marshalling strict rate limit groups: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelRequestRateLimitStrictGroupsByJSONString(jsonStr string) error {
+	var groups []string
+	if err := json.Unmarshal([]byte(jsonStr), &groups); err != nil {
+		return err
+	}
+	strictGroups := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		strictGroups[group] = true
+	}
+
+	ModelRequestRateLimitMutex.Lock()
+	defer ModelRequestRateLimitMutex.Unlock()
+	ModelRequestRateLimitStrictGroups = strictGroups
+	return nil
+}
+
+func IsGroupRateLimitStrict(group string) bool {
+	ModelRequestRateLimitMutex.RLock()
+	defer ModelRequestRateLimitMutex.RUnlock()
+
+	return ModelRequestRateLimitStrictGroups[group]
+}
+
+func CheckModelRequestRateLimitStrictGroups(jsonStr string) error {
+	var groups []string
+	if err := json.Unmarshal([]byte(jsonStr), &groups); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if group == "" {
+			return fmt.Errorf("group name cannot be empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package ratio_setting
+
+import (
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 实时/语音模型的独立计费维度：输入音频按秒计费，输出音频按 token 计费，价格单位均为美元。
+// 配置后对应部分不再使用音频倍率，未配置的模型保持原有的按倍率计费。
+// 音频接口同样使用这些维度：转录/翻译按输入音频秒数计费，语音合成按输入字符数计费。
+
+var (
+	// audioInputSecondPriceMap 模型 -> 每秒输入音频的价格
+	audioInputSecondPriceMap      = map[string]float64{}
+	audioInputSecondPriceMapMutex sync.RWMutex
+	// audioOutputTokenPriceMap 模型 -> 每百万输出音频 token 的价格
+	audioOutputTokenPriceMap      = map[string]float64{}
+	audioOutputTokenPriceMapMutex sync.RWMutex
+	// audioCharacterPriceMap 模型 -> 语音合成每百万输入字符的价格
+	audioCharacterPriceMap      = map[string]float64{}
+	audioCharacterPriceMapMutex sync.RWMutex
+)
+
+func AudioInputSecondPrice2JSONString() string {
+	audioInputSecondPriceMapMutex.RLock()
+	defer audioInputSecondPriceMapMutex.RUnlock()
+	jsonBytes, err := common.Marshal(audioInputSecondPriceMap)
+	if err != nil {
+		common.SysError("error marshalling audio input second price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateAudioInputSecondPriceByJSONString(jsonStr string) error {
+	tmp := make(map[string]float64)
+	if err := common.Unmarshal([]byte(jsonStr), &tmp); err != nil {
+		return err
+	}
+	audioInputSecondPriceMapMutex.Lock()
+	audioInputSecondPriceMap = tmp
+	audioInputSecondPriceMapMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+// GetAudioInputSecondPrice returns the price of one second of input audio, false when the model is billed by audio ratio.
+func GetAudioInputSecondPrice(name string) (float64, bool) {
+	audioInputSecondPriceMapMutex.RLock()
+	defer audioInputSecondPriceMapMutex.RUnlock()
+	price, ok := audioInputSecondPriceMap[FormatMatchingModelName(name)]
+	return price, ok
+}
+
+func AudioOutputTokenPrice2JSONString() string {
+	audioOutputTokenPriceMapMutex.RLock()
+	defer audioOutputTokenPriceMapMutex.RUnlock()
+	jsonBytes, err := common.Marshal(audioOutputTokenPriceMap)
+	if err != nil {
+		common.SysError("error marshalling audio output token price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateAudioOutputTokenPriceByJSONString(jsonStr string) error {
+	tmp := make(map[string]float64)
+	if err := common.Unmarshal([]byte(jsonStr), &tmp); err != nil {
+		return err
+	}
+	audioOutputTokenPriceMapMutex.Lock()
+	audioOutputTokenPriceMap = tmp
+	audioOutputTokenPriceMapMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+// GetAudioOutputTokenPrice returns the price of one million output audio tokens, false when the model is billed by audio ratio.
+func GetAudioOutputTokenPrice(name string) (float64, bool) {
+	audioOutputTokenPriceMapMutex.RLock()
+	defer audioOutputTokenPriceMapMutex.RUnlock()
+	price, ok := audioOutputTokenPriceMap[FormatMatchingModelName(name)]
+	return price, ok
+}
+
+func AudioCharacterPrice2JSONString() string {
+	audioCharacterPriceMapMutex.RLock()
+	defer audioCharacterPriceMapMutex.RUnlock()
+	jsonBytes, err := common.Marshal(audioCharacterPriceMap)
+	if err != nil {
+		common.SysError("error marshalling audio character price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateAudioCharacterPriceByJSONString(jsonStr string) error {
+	tmp := make(map[string]float64)
+	if err := common.Unmarshal([]byte(jsonStr), &tmp); err != nil {
+		return err
+	}
+	audioCharacterPriceMapMutex.Lock()
+	audioCharacterPriceMap = tmp
+	audioCharacterPriceMapMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+// GetAudioCharacterPrice returns the price of one million characters synthesized by a speech model, false when it is billed by tokens.
+func GetAudioCharacterPrice(name string) (float64, bool) {
+	audioCharacterPriceMapMutex.RLock()
+	defer audioCharacterPriceMapMutex.RUnlock()
+	price, ok := audioCharacterPriceMap[FormatMatchingModelName(name)]
+	return price, ok
+}
+
+// ContainsAudioEndpointPrice reports whether the audio endpoints bill the model by seconds or characters instead of tokens.
+func ContainsAudioEndpointPrice(name string) bool {
+	if _, ok := GetAudioInputSecondPrice(name); ok {
+		return true
+	}
+	_, ok := GetAudioCharacterPrice(name)
+	return ok
+}
+
+// ContainsAudioPrice reports whether the model has a separate price for input or output audio.
+func ContainsAudioPrice(name string) bool {
+	if _, ok := GetAudioInputSecondPrice(name); ok {
+		return true
+	}
+	_, ok := GetAudioOutputTokenPrice(name)
+	return ok
+}
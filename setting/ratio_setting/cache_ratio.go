@@ -89,6 +89,9 @@ var defaultCreateCacheRatio = map[string]float64{
 var cacheRatioMap map[string]float64
 var cacheRatioMapMutex sync.RWMutex
 
+var createCacheRatioMap map[string]float64
+var createCacheRatioMapMutex sync.RWMutex
+
 // GetCacheRatioMap returns the cache ratio map
 func GetCacheRatioMap() map[string]float64 {
 	cacheRatioMapMutex.RLock()
@@ -125,19 +128,55 @@ func GetCacheRatio(name string) (float64, bool) {
 	defer cacheRatioMapMutex.RUnlock()
 	ratio, ok := cacheRatioMap[name]
 	if !ok {
+		if base, isSnapshot := common.StripModelSnapshot(name); isSnapshot {
+			if ratio, ok = cacheRatioMap[base]; ok {
+				return ratio, true
+			}
+		}
 		return 1, false // Default to 1 if not found
 	}
 	return ratio, true
 }
 
+// GetCreateCacheRatio returns the cache creation (write) ratio for a model
 func GetCreateCacheRatio(name string) (float64, bool) {
-	ratio, ok := defaultCreateCacheRatio[name]
+	createCacheRatioMapMutex.RLock()
+	defer createCacheRatioMapMutex.RUnlock()
+	ratio, ok := createCacheRatioMap[name]
 	if !ok {
+		if base, isSnapshot := common.StripModelSnapshot(name); isSnapshot {
+			if ratio, ok = createCacheRatioMap[base]; ok {
+				return ratio, true
+			}
+		}
 		return 1.25, false // Default to 1.25 if not found
 	}
 	return ratio, true
 }
 
+// CreateCacheRatio2JSONString converts the cache creation ratio map to a JSON string
+func CreateCacheRatio2JSONString() string {
+	createCacheRatioMapMutex.RLock()
+	defer createCacheRatioMapMutex.RUnlock()
+	jsonBytes, err := json.Marshal(createCacheRatioMap)
+	if err != nil {
+		common.SysLog("error marshalling create cache ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// UpdateCreateCacheRatioByJSONString updates the cache creation ratio map from a JSON string
+func UpdateCreateCacheRatioByJSONString(jsonStr string) error {
+	createCacheRatioMapMutex.Lock()
+	defer createCacheRatioMapMutex.Unlock()
+	createCacheRatioMap = make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &createCacheRatioMap)
+	if err == nil {
+		InvalidateExposedDataCache()
+	}
+	return err
+}
+
 func GetCacheRatioCopy() map[string]float64 {
 	cacheRatioMapMutex.RLock()
 	defer cacheRatioMapMutex.RUnlock()
@@ -0,0 +1,85 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 图片生成/编辑接口按张计费：键为模型名称，值为 "尺寸:品质" -> 每张图片的美元价格。
+// 尺寸或品质可以写成 *，例如 {"gpt-image-1": {"1024x1024:high": 0.167, "1024x1024": 0.042, "*": 0.042}}，
+// 依次匹配 尺寸:品质、尺寸、*:品质、*。配置后该模型的图片接口不再使用模型价格与图片尺寸倍率。
+
+var (
+	imageGenerationPriceMap      = map[string]map[string]float64{}
+	imageGenerationPriceMapMutex sync.RWMutex
+)
+
+func ImageGenerationPrice2JSONString() string {
+	imageGenerationPriceMapMutex.RLock()
+	defer imageGenerationPriceMapMutex.RUnlock()
+	jsonBytes, err := common.Marshal(imageGenerationPriceMap)
+	if err != nil {
+		common.SysError("error marshalling image generation price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateImageGenerationPriceByJSONString(jsonStr string) error {
+	tmp := make(map[string]map[string]float64)
+	if err := common.Unmarshal([]byte(jsonStr), &tmp); err != nil {
+		return err
+	}
+	for model, prices := range tmp {
+		for key, price := range prices {
+			if price < 0 {
+				return fmt.Errorf("price of %s %s must not be negative", model, key)
+			}
+		}
+	}
+	imageGenerationPriceMapMutex.Lock()
+	imageGenerationPriceMap = tmp
+	imageGenerationPriceMapMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+// GetImageGenerationPrice returns the price of one image of the given size and quality, false when the model
+// is billed by model price and image ratio.
+func GetImageGenerationPrice(name string, size string, quality string) (float64, bool) {
+	imageGenerationPriceMapMutex.RLock()
+	defer imageGenerationPriceMapMutex.RUnlock()
+	prices, ok := imageGenerationPriceMap[FormatMatchingModelName(name)]
+	if !ok {
+		return 0, false
+	}
+	if size == "" {
+		size = "*"
+	}
+	candidates := []string{size, "*"}
+	if quality != "" {
+		candidates = []string{size + ":" + quality, size, "*:" + quality, "*"}
+	}
+	for _, key := range candidates {
+		if price, ok := prices[key]; ok {
+			return price, true
+		}
+	}
+	return 0, false
+}
+
+// GetImageGenerationPrices returns a copy of the per image prices of the model, nil when it has none.
+func GetImageGenerationPrices(name string) map[string]float64 {
+	imageGenerationPriceMapMutex.RLock()
+	defer imageGenerationPriceMapMutex.RUnlock()
+	prices, ok := imageGenerationPriceMap[FormatMatchingModelName(name)]
+	if !ok {
+		return nil
+	}
+	copied := make(map[string]float64, len(prices))
+	for key, price := range prices {
+		copied[key] = price
+	}
+	return copied
+}
@@ -360,6 +360,11 @@ func InitRatioSettings() {
 	cacheRatioMap = defaultCacheRatio
 	cacheRatioMapMutex.Unlock()
 
+	// Initialize createCacheRatioMap
+	createCacheRatioMapMutex.Lock()
+	createCacheRatioMap = defaultCreateCacheRatio
+	createCacheRatioMapMutex.Unlock()
+
 	// initialize imageRatioMap
 	imageRatioMapMutex.Lock()
 	imageRatioMap = defaultImageRatio
@@ -424,6 +429,12 @@ func GetModelPrice(name string, printErr bool) (float64, bool) {
 
 	price, ok := modelPriceMap[name]
 	if !ok {
+		// 带日期的快照版本没有单独定价时使用基础模型的价格
+		if base, isSnapshot := common.StripModelSnapshot(name); isSnapshot {
+			if price, ok = modelPriceMap[base]; ok {
+				return price, true
+			}
+		}
 		if printErr {
 			common.SysError("model price not found: " + name)
 		}
@@ -465,6 +476,11 @@ func GetModelRatio(name string) (float64, bool, string) {
 			}
 			//return 0, true, name
 		}
+		if base, isSnapshot := common.StripModelSnapshot(name); isSnapshot {
+			if baseRatio, ok := modelRatioMap[base]; ok {
+				return baseRatio, true, name
+			}
+		}
 		return 37.5, operation_setting.SelfUseModeEnabled, name
 	}
 	return ratio, true, name
@@ -544,6 +560,11 @@ func GetCompletionRatio(name string) float64 {
 	if ratio, ok := CompletionRatio[name]; ok {
 		return ratio
 	}
+	if base, isSnapshot := common.StripModelSnapshot(name); isSnapshot {
+		if ratio, ok := CompletionRatio[base]; ok {
+			return ratio
+		}
+	}
 	return hardCodedRatio
 }
 
@@ -0,0 +1,169 @@
+package system_setting
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 管理接口按资源划分权限，权限写作 资源.操作，如 channel.read、log.*，* 表示全部权限
+const (
+	AdminResourceChannel = "channel" // 渠道、渠道测试与路由
+	AdminResourceModel   = "model"   // 模型元数据、供应商、分组、部署
+	AdminResourceUser    = "user"    // 用户与令牌管理
+	AdminResourceBilling = "billing" // 用户余额、充值、兑换码、订阅
+	AdminResourceLog     = "log"     // 使用日志与统计
+	AdminResourcePayload = "payload" // 日志中的请求和响应内容
+	AdminResourceSystem  = "system"  // 其他管理接口
+
+	AdminActionRead  = "read"
+	AdminActionWrite = "write"
+
+	AdminPermissionAll = "*"
+
+	AdminRoleSuperAdmin = "super_admin"
+)
+
+var AdminResources = []string{
+	AdminResourceChannel,
+	AdminResourceModel,
+	AdminResourceUser,
+	AdminResourceBilling,
+	AdminResourceLog,
+	AdminResourcePayload,
+	AdminResourceSystem,
+}
+
+// AdminRole 管理员角色，未分配角色的管理员拥有全部管理权限，超级用户不受角色限制
+type AdminRole struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Permissions []string `json:"permissions"`
+}
+
+type AdminRBACSettings struct {
+	Roles []AdminRole `json:"roles"`
+}
+
+var adminRolePattern = ssoProviderNamePattern
+
+var superAdminRole = AdminRole{
+	Name:        AdminRoleSuperAdmin,
+	DisplayName: "超级管理员",
+	Permissions: []string{AdminPermissionAll},
+}
+
+var adminRBACSettings = AdminRBACSettings{
+	Roles: []AdminRole{
+		superAdminRole,
+		{
+			Name:        "billing_viewer",
+			DisplayName: "账单查看",
+			Permissions: []string{"billing.read", "user.read"},
+		},
+		{
+			Name:        "channel_operator",
+			DisplayName: "渠道运维",
+			Permissions: []string{"channel.*", "model.*"},
+		},
+		{
+			Name:        "log_auditor",
+			DisplayName: "日志审计",
+			Permissions: []string{"log.read", "payload.read"},
+		},
+	},
+}
+
+func init() {
+	config.GlobalConfig.Register("admin_rbac", &adminRBACSettings)
+}
+
+func GetAdminRBACSettings() *AdminRBACSettings {
+	return &adminRBACSettings
+}
+
+// GetAdminRole returns the role with the given name, super_admin always exists and can not be narrowed.
+func GetAdminRole(name string) (*AdminRole, bool) {
+	if name == AdminRoleSuperAdmin {
+		return &superAdminRole, true
+	}
+	for i := range adminRBACSettings.Roles {
+		if adminRBACSettings.Roles[i].Name == name {
+			return &adminRBACSettings.Roles[i], true
+		}
+	}
+	return nil, false
+}
+
+// Allows reports whether the role grants the action on the resource, write implies read.
+func (r *AdminRole) Allows(resource string, action string) bool {
+	for _, permission := range r.Permissions {
+		if permission == AdminPermissionAll || permission == resource+".*" || permission == resource+"."+action {
+			return true
+		}
+		if action == AdminActionRead && permission == resource+"."+AdminActionWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminRoleAllows checks the admin role assigned to a user, an empty role keeps the full admin access of the
+// role flag and a role that no longer exists grants nothing.
+func AdminRoleAllows(name string, resource string, action string) bool {
+	if name == "" {
+		return true
+	}
+	role, ok := GetAdminRole(name)
+	return ok && role.Allows(resource, action)
+}
+
+func validAdminPermission(permission string) bool {
+	if permission == AdminPermissionAll {
+		return true
+	}
+	resource, action, ok := strings.Cut(permission, ".")
+	if !ok || !slices.Contains(AdminResources, resource) {
+		return false
+	}
+	return action == "*" || action == AdminActionRead || action == AdminActionWrite
+}
+
+// ValidateAdminRoles validates the roles option and always keeps the built-in super_admin role.
+func ValidateAdminRoles(value string) (string, error) {
+	var roles []AdminRole
+	if err := common.UnmarshalJsonStr(value, &roles); err != nil {
+		return "", fmt.Errorf("管理角色配置格式错误: %w", err)
+	}
+	result := []AdminRole{superAdminRole}
+	seen := map[string]bool{AdminRoleSuperAdmin: true}
+	for _, role := range roles {
+		if role.Name == AdminRoleSuperAdmin {
+			continue
+		}
+		if !adminRolePattern.MatchString(role.Name) {
+			return "", fmt.Errorf("管理角色标识 %q 只能包含字母、数字、下划线和连字符", role.Name)
+		}
+		if seen[role.Name] {
+			return "", fmt.Errorf("管理角色标识 %s 重复", role.Name)
+		}
+		seen[role.Name] = true
+		for _, permission := range role.Permissions {
+			if !validAdminPermission(permission) {
+				return "", fmt.Errorf("管理角色 %s 的权限 %q 无效", role.Name, permission)
+			}
+		}
+		if role.DisplayName == "" {
+			role.DisplayName = role.Name
+		}
+		result = append(result, role)
+	}
+	data, err := common.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,37 @@
+package system_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminRoleAllows(t *testing.T) {
+	require.True(t, AdminRoleAllows("", AdminResourceSystem, AdminActionWrite))
+	require.True(t, AdminRoleAllows(AdminRoleSuperAdmin, AdminResourcePayload, AdminActionRead))
+	require.False(t, AdminRoleAllows("missing", AdminResourceLog, AdminActionRead))
+
+	require.True(t, AdminRoleAllows("channel_operator", AdminResourceChannel, AdminActionWrite))
+	require.False(t, AdminRoleAllows("channel_operator", AdminResourceBilling, AdminActionRead))
+	require.False(t, AdminRoleAllows("channel_operator", AdminResourcePayload, AdminActionRead))
+
+	require.True(t, AdminRoleAllows("log_auditor", AdminResourcePayload, AdminActionRead))
+	require.False(t, AdminRoleAllows("log_auditor", AdminResourceLog, AdminActionWrite))
+
+	role := &AdminRole{Permissions: []string{"user.write"}}
+	require.True(t, role.Allows(AdminResourceUser, AdminActionRead))
+}
+
+func TestValidateAdminRoles(t *testing.T) {
+	value, err := ValidateAdminRoles(`[{"name":"super_admin","permissions":["log.read"]},{"name":"ops","permissions":["channel.*"]}]`)
+	require.NoError(t, err)
+	require.Contains(t, value, `"name":"super_admin","display_name":"超级管理员","permissions":["*"]`)
+	require.Contains(t, value, `"display_name":"ops"`)
+
+	_, err = ValidateAdminRoles(`[{"name":"ops","permissions":["channels.read"]}]`)
+	require.Error(t, err)
+	_, err = ValidateAdminRoles(`[{"name":"ops"},{"name":"ops"}]`)
+	require.Error(t, err)
+	_, err = ValidateAdminRoles(`[{"name":"a b"}]`)
+	require.Error(t, err)
+}
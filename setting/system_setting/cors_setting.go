@@ -0,0 +1,82 @@
+package system_setting
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// CORSPolicy 一组路由的跨域策略
+type CORSPolicy struct {
+	Enabled bool `json:"enabled"` // 关闭后不返回跨域响应头，浏览器无法跨域调用
+	// AllowOrigins 允许的来源，支持 * 和 https://*.example.com 形式的子域名通配
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowHeaders     []string `json:"allow_headers"` // * 表示允许预检请求中声明的所有请求头
+	ExposeHeaders    []string `json:"expose_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           int      `json:"max_age"` // 预检结果缓存秒数，0 表示不设置
+}
+
+// CORSSetting 分别配置中转 API、管理 API 和公开接口的跨域策略，修改后立即生效
+type CORSSetting struct {
+	Relay      CORSPolicy `json:"relay"`
+	Management CORSPolicy `json:"management"`
+	Public     CORSPolicy `json:"public"`
+}
+
+// 默认值与原先的全局行为保持一致：中转 API 和公开接口允许任意来源，管理 API 不允许跨域
+var corsSetting = CORSSetting{
+	Relay: CORSPolicy{
+		Enabled:          true,
+		AllowOrigins:     []string{"*"},
+		AllowHeaders:     []string{"*"},
+		ExposeHeaders:    []string{},
+		AllowCredentials: true,
+	},
+	Management: CORSPolicy{
+		Enabled:          false,
+		AllowOrigins:     []string{},
+		AllowHeaders:     []string{"*"},
+		ExposeHeaders:    []string{},
+		AllowCredentials: true,
+	},
+	Public: CORSPolicy{
+		Enabled:          true,
+		AllowOrigins:     []string{"*"},
+		AllowHeaders:     []string{"*"},
+		ExposeHeaders:    []string{},
+		AllowCredentials: false,
+	},
+}
+
+func init() {
+	config.GlobalConfig.Register("cors_setting", &corsSetting)
+}
+
+func GetCORSSetting() *CORSSetting {
+	return &corsSetting
+}
+
+// AllowsAllOrigins reports whether any origin is allowed.
+func (p *CORSPolicy) AllowsAllOrigins() bool {
+	return slices.Contains(p.AllowOrigins, "*")
+}
+
+// AllowsOrigin reports whether the request origin matches one of the allowed origins.
+func (p *CORSPolicy) AllowsOrigin(origin string) bool {
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	for _, allowed := range p.AllowOrigins {
+		allowed = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(allowed), "/"))
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// https://*.example.com 匹配任意子域名，不匹配 example.com 本身
+		if scheme, host, ok := strings.Cut(allowed, "://*."); ok {
+			if rest, found := strings.CutPrefix(origin, scheme+"://"); found && strings.HasSuffix(rest, "."+host) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package system_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSPolicyAllowsOrigin(t *testing.T) {
+	policy := CORSPolicy{AllowOrigins: []string{"https://app.example.com/", "https://*.example.org"}}
+
+	require.True(t, policy.AllowsOrigin("https://APP.example.com"))
+	require.True(t, policy.AllowsOrigin("https://a.b.example.org"))
+	require.False(t, policy.AllowsOrigin("https://example.org"))
+	require.False(t, policy.AllowsOrigin("http://a.example.org"))
+	require.False(t, policy.AllowsOrigin("https://evil.com"))
+	require.False(t, policy.AllowsAllOrigins())
+
+	policy.AllowOrigins = []string{"*"}
+	require.True(t, policy.AllowsOrigin("https://evil.com"))
+	require.True(t, policy.AllowsAllOrigins())
+}
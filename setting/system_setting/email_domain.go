@@ -0,0 +1,131 @@
+package system_setting
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// EmailDomainSettings 注册邮箱的域名策略，域名同时匹配其子域名
+type EmailDomainSettings struct {
+	// DenyList 禁止注册的域名
+	DenyList []string `json:"deny_list"`
+	// BlockDisposable 是否拦截一次性邮箱，使用内置列表、DisposableDomains 和 DisposableListURL 的合集
+	BlockDisposable   bool     `json:"block_disposable"`
+	DisposableDomains []string `json:"disposable_domains"`
+	// DisposableListURL 远程一次性邮箱域名列表（纯文本，每行一个域名），每天同步一次
+	DisposableListURL string `json:"disposable_list_url"`
+	// DomainGroups 域名 -> 新用户默认分组，例如 {"example.com": "enterprise"}
+	DomainGroups map[string]string `json:"domain_groups"`
+}
+
+var emailDomainSettings = EmailDomainSettings{
+	DenyList:          []string{},
+	DisposableDomains: []string{},
+	DomainGroups:      map[string]string{},
+}
+
+// 常见的一次性邮箱域名，更完整的列表可通过 DisposableListURL 同步
+var builtinDisposableDomains = []string{
+	"10minutemail.com", "guerrillamail.com", "guerrillamail.net", "sharklasers.com", "mailinator.com",
+	"yopmail.com", "temp-mail.org", "tempmail.com", "throwawaymail.com", "trashmail.com",
+	"getnada.com", "dispostable.com", "maildrop.cc", "fakeinbox.com", "mailnesia.com",
+	"mohmal.com", "emailondeck.com", "mintemail.com", "tempr.email", "burnermail.io",
+}
+
+var (
+	remoteDisposableDomains     = map[string]struct{}{}
+	remoteDisposableDomainsLock sync.RWMutex
+)
+
+func init() {
+	config.GlobalConfig.Register("email_domain", &emailDomainSettings)
+}
+
+func GetEmailDomainSettings() *EmailDomainSettings {
+	return &emailDomainSettings
+}
+
+// SetRemoteDisposableDomains replaces the domains synced from DisposableListURL.
+func SetRemoteDisposableDomains(domains []string) {
+	m := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		m[normalizeEmailDomain(domain)] = struct{}{}
+	}
+	remoteDisposableDomainsLock.Lock()
+	remoteDisposableDomains = m
+	remoteDisposableDomainsLock.Unlock()
+}
+
+func normalizeEmailDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+}
+
+// EmailDomain returns the lower-cased domain part of the email address.
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return normalizeEmailDomain(email[at+1:])
+}
+
+// domainMatches reports whether domain is entry itself or one of its subdomains.
+func domainMatches(domain string, entry string) bool {
+	entry = normalizeEmailDomain(entry)
+	return entry != "" && (domain == entry || strings.HasSuffix(domain, "."+entry))
+}
+
+func IsEmailDomainDenied(domain string) bool {
+	for _, entry := range emailDomainSettings.DenyList {
+		if domainMatches(domain, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func IsDisposableEmailDomain(domain string) bool {
+	for _, entry := range builtinDisposableDomains {
+		if domainMatches(domain, entry) {
+			return true
+		}
+	}
+	for _, entry := range emailDomainSettings.DisposableDomains {
+		if domainMatches(domain, entry) {
+			return true
+		}
+	}
+	remoteDisposableDomainsLock.RLock()
+	defer remoteDisposableDomainsLock.RUnlock()
+	// 逐级检查父域名，例如 a.b.example.com -> b.example.com -> example.com
+	for d := domain; d != ""; {
+		if _, ok := remoteDisposableDomains[d]; ok {
+			return true
+		}
+		dot := strings.Index(d, ".")
+		if dot < 0 {
+			break
+		}
+		d = d[dot+1:]
+	}
+	return false
+}
+
+// GetEmailDomainGroup returns the default group configured for the domain of the email, the most specific match wins.
+func GetEmailDomainGroup(email string) string {
+	domain := EmailDomain(email)
+	if domain == "" {
+		return ""
+	}
+	group := ""
+	matchedLen := -1
+	for entry, g := range emailDomainSettings.DomainGroups {
+		if domainMatches(domain, entry) && len(entry) > matchedLen {
+			group = g
+			matchedLen = len(entry)
+		}
+	}
+	return group
+}
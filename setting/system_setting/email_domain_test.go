@@ -0,0 +1,44 @@
+package system_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailDomain(t *testing.T) {
+	require.Equal(t, "example.com", EmailDomain("User@Example.COM"))
+	require.Equal(t, "", EmailDomain("invalid"))
+}
+
+func TestIsEmailDomainDenied_MatchesSubdomains(t *testing.T) {
+	old := emailDomainSettings.DenyList
+	defer func() { emailDomainSettings.DenyList = old }()
+	emailDomainSettings.DenyList = []string{"blocked.com"}
+
+	require.True(t, IsEmailDomainDenied("blocked.com"))
+	require.True(t, IsEmailDomainDenied("mail.blocked.com"))
+	require.False(t, IsEmailDomainDenied("notblocked.com"))
+}
+
+func TestIsDisposableEmailDomain_Remote(t *testing.T) {
+	defer SetRemoteDisposableDomains(nil)
+	SetRemoteDisposableDomains([]string{"Throwaway.example"})
+
+	require.True(t, IsDisposableEmailDomain("mailinator.com"))
+	require.True(t, IsDisposableEmailDomain("a.b.throwaway.example"))
+	require.False(t, IsDisposableEmailDomain("gmail.com"))
+}
+
+func TestGetEmailDomainGroup_MostSpecificWins(t *testing.T) {
+	old := emailDomainSettings.DomainGroups
+	defer func() { emailDomainSettings.DomainGroups = old }()
+	emailDomainSettings.DomainGroups = map[string]string{
+		"corp.com":     "enterprise",
+		"lab.corp.com": "research",
+	}
+
+	require.Equal(t, "enterprise", GetEmailDomainGroup("a@corp.com"))
+	require.Equal(t, "research", GetEmailDomainGroup("a@x.lab.corp.com"))
+	require.Equal(t, "", GetEmailDomainGroup("a@other.com"))
+}
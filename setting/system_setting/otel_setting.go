@@ -0,0 +1,68 @@
+package system_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// OtelSetting OpenTelemetry 链路追踪，通过 OTLP/HTTP（JSON 编码）导出到采集器
+type OtelSetting struct {
+	Enabled     bool              `json:"enabled"`
+	Endpoint    string            `json:"endpoint"` // 例如 http://localhost:4318
+	Headers     map[string]string `json:"headers"`  // 导出时附加的请求头，例如鉴权信息
+	ServiceName string            `json:"service_name"`
+	// SampleRatio 没有上游 traceparent 时新建链路的采样比例，带有 traceparent 时跟随调用方的采样决定
+	SampleRatio float64 `json:"sample_ratio"`
+	// PropagateToUpstream 向上游请求发送 traceparent，使上游的链路与本服务关联
+	PropagateToUpstream bool `json:"propagate_to_upstream"`
+}
+
+var otelSetting = OtelSetting{
+	Enabled:     false,
+	Headers:     map[string]string{},
+	ServiceName: "new-api",
+	SampleRatio: 1,
+}
+
+func init() {
+	config.GlobalConfig.Register("otel_setting", &otelSetting)
+}
+
+func GetOtelSetting() *OtelSetting {
+	return &otelSetting
+}
+
+// MaskOtelHeaders hides the values of the exporter headers option before it is sent to the frontend, they usually
+// carry the credentials of the collector.
+func MaskOtelHeaders(value string) string {
+	var headers map[string]string
+	if err := common.UnmarshalJsonStr(value, &headers); err != nil {
+		return "{}"
+	}
+	for name := range headers {
+		headers[name] = ""
+	}
+	data, _ := common.Marshal(headers)
+	return string(data)
+}
+
+// MergeOtelHeaders keeps the saved value of a header when the submitted one is empty, since the frontend never
+// receives it.
+func MergeOtelHeaders(value string) (string, error) {
+	var headers map[string]string
+	if err := common.UnmarshalJsonStr(value, &headers); err != nil {
+		return "", fmt.Errorf("OpenTelemetry 请求头配置格式错误: %w", err)
+	}
+	for name, headerValue := range headers {
+		if headerValue == "" {
+			headers[name] = otelSetting.Headers[name]
+		}
+	}
+	data, err := common.Marshal(headers)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
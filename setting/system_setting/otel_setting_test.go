@@ -0,0 +1,27 @@
+package system_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeOtelHeaders_KeepsSavedValues(t *testing.T) {
+	old := otelSetting.Headers
+	defer func() { otelSetting.Headers = old }()
+	otelSetting.Headers = map[string]string{"Authorization": "Bearer saved", "X-Scope": "tenant"}
+
+	masked := MaskOtelHeaders(`{"Authorization":"Bearer saved","X-Scope":"tenant"}`)
+	require.JSONEq(t, `{"Authorization":"","X-Scope":""}`, masked)
+
+	merged, err := MergeOtelHeaders(`{"Authorization":"","X-Scope":"other","X-New":"v"}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Authorization":"Bearer saved","X-Scope":"other","X-New":"v"}`, merged)
+
+	merged, err = MergeOtelHeaders(`{}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{}`, merged)
+
+	_, err = MergeOtelHeaders(`[]`)
+	require.Error(t, err)
+}
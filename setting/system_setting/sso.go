@@ -0,0 +1,365 @@
+package system_setting
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	SSOProviderTypeOIDC    = "oidc"
+	SSOProviderTypeGoogle  = "google"
+	SSOProviderTypeAzureAD = "azure_ad"
+)
+
+// SSOGroupRule 把 IdP 的分组或声明值映射为本站分组，按顺序匹配，第一条命中的规则生效
+type SSOGroupRule struct {
+	// IdpGroup IdP 返回的分组名或声明值，* 匹配任意用户
+	IdpGroup string `json:"idp_group"`
+	Group    string `json:"group"`
+	// Quota 自动创建用户时额外赠送的额度
+	Quota int `json:"quota"`
+}
+
+// SSOProvider 一个 OpenID Connect 登录提供商，Google 和 Azure AD 只需填写客户端信息，端点通过 issuer 自动发现
+type SSOProvider struct {
+	// Name 唯一标识，回调地址为 {ServerAddress}/oauth/sso/{name}
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Enabled     bool   `json:"enabled"`
+	// Type oidc / google / azure_ad
+	Type string `json:"type"`
+	// Issuer 通用 OIDC 的 issuer，端点从 {issuer}/.well-known/openid-configuration 获取
+	Issuer string `json:"issuer"`
+	// TenantId Azure AD 的租户 ID 或域名，必填；填写 organizations 等多租户端点时必须限制邮箱域名
+	TenantId     string `json:"tenant_id"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Scopes 为空时使用 openid profile email
+	Scopes string `json:"scopes"`
+	// GroupsClaim 分组所在的声明，支持 realm_access.roles 这样的嵌套路径，Google 可使用 hd（企业域名）
+	GroupsClaim string         `json:"groups_claim"`
+	GroupRules  []SSOGroupRule `json:"group_rules"`
+	// AutoProvision 首次登录时自动创建用户（JIT），关闭新用户注册时不会创建
+	AutoProvision bool `json:"auto_provision"`
+	// SyncGroupOnLogin 每次登录时按分组规则更新用户分组
+	SyncGroupOnLogin bool `json:"sync_group_on_login"`
+	// AllowedDomains 允许登录的邮箱域名，为空时不限制，只认可 IdP 验证过的邮箱
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+type SSOSettings struct {
+	Enabled   bool          `json:"enabled"`
+	Providers []SSOProvider `json:"providers"`
+}
+
+var ssoProviderNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+var ssoSettings = SSOSettings{
+	Providers: []SSOProvider{},
+}
+
+func init() {
+	config.GlobalConfig.Register("sso", &ssoSettings)
+}
+
+func GetSSOSettings() *SSOSettings {
+	return &ssoSettings
+}
+
+// GetSSOProvider returns the enabled provider with the given name.
+func GetSSOProvider(name string) (*SSOProvider, bool) {
+	if !ssoSettings.Enabled || name == "" {
+		return nil, false
+	}
+	for i := range ssoSettings.Providers {
+		provider := &ssoSettings.Providers[i]
+		if provider.Enabled && provider.Name == name {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+// EnabledSSOProviders returns the providers shown on the login page.
+func EnabledSSOProviders() []SSOProvider {
+	if !ssoSettings.Enabled {
+		return nil
+	}
+	providers := make([]SSOProvider, 0, len(ssoSettings.Providers))
+	for _, provider := range ssoSettings.Providers {
+		if provider.Enabled && provider.Name != "" {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// IssuerURL returns the issuer used for the discovery of the endpoints.
+func (p *SSOProvider) IssuerURL() string {
+	switch p.Type {
+	case SSOProviderTypeGoogle:
+		return "https://accounts.google.com"
+	case SSOProviderTypeAzureAD:
+		tenant := strings.TrimSpace(p.TenantId)
+		if tenant == "" {
+			return ""
+		}
+		return fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0", tenant)
+	default:
+		return strings.TrimSuffix(strings.TrimSpace(p.Issuer), "/")
+	}
+}
+
+func (p *SSOProvider) GetScopes() string {
+	if scopes := strings.TrimSpace(p.Scopes); scopes != "" {
+		return scopes
+	}
+	return "openid profile email"
+}
+
+func (p *SSOProvider) GetGroupsClaim() string {
+	if claim := strings.TrimSpace(p.GroupsClaim); claim != "" {
+		return claim
+	}
+	return "groups"
+}
+
+func (p *SSOProvider) EmailAllowed(email string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	domain := EmailDomain(email)
+	if domain == "" {
+		return false
+	}
+	for _, entry := range p.AllowedDomains {
+		if domainMatches(domain, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// ssoTenantPlaceholder Azure AD 多租户端点的发现文档中 issuer 的租户占位符
+const ssoTenantPlaceholder = "{tenantid}"
+
+// ssoClockSkew 校验 ID Token 过期时间时允许的时钟偏差
+const ssoClockSkew = 5 * time.Minute
+
+// IsMultiTenantIssuer reports whether the issuer of the discovery document accepts users of any Azure AD tenant.
+func IsMultiTenantIssuer(issuer string) bool {
+	return strings.Contains(issuer, ssoTenantPlaceholder)
+}
+
+func ssoClaimString(claims map[string]any, key string) string {
+	value, _ := claims[key].(string)
+	return strings.TrimSpace(value)
+}
+
+// ValidateIDTokenClaims checks the iss, aud, exp and nonce claims of the ID token (OpenID Connect Core 3.1.3.7).
+// issuer is the issuer of the discovery document, for the Azure AD multi-tenant endpoints its {tenantid}
+// placeholder must be the tid claim of the token.
+func (p *SSOProvider) ValidateIDTokenClaims(claims map[string]any, issuer string, nonce string, now time.Time) error {
+	expectedIssuer := issuer
+	if IsMultiTenantIssuer(issuer) {
+		tid := ssoClaimString(claims, "tid")
+		if tid == "" {
+			return errors.New("ID Token 缺少 tid")
+		}
+		expectedIssuer = strings.ReplaceAll(issuer, ssoTenantPlaceholder, tid)
+	}
+	if iss := ssoClaimString(claims, "iss"); iss == "" || strings.TrimSuffix(iss, "/") != strings.TrimSuffix(expectedIssuer, "/") {
+		return fmt.Errorf("ID Token 的签发者 %q 与 %q 不一致", iss, expectedIssuer)
+	}
+
+	var audiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []any:
+		for _, item := range aud {
+			if s, ok := item.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	found := false
+	for _, aud := range audiences {
+		if aud == p.ClientId {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.New("ID Token 的受众不包含本站")
+	}
+	if azp := ssoClaimString(claims, "azp"); len(audiences) > 1 && azp != p.ClientId {
+		return errors.New("ID Token 的授权方不是本站")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("ID Token 缺少过期时间")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(ssoClockSkew)) {
+		return errors.New("ID Token 已过期")
+	}
+
+	if nonce == "" || ssoClaimString(claims, "nonce") != nonce {
+		return errors.New("ID Token 的 nonce 不一致")
+	}
+	return nil
+}
+
+// VerifiedEmail returns the email of the user when the IdP vouches for it, which is required for AllowedDomains:
+// the email when email_verified is true, or for an Azure AD provider pinned to one tenant also the email or UPN,
+// which are owned by that tenant. Unverified emails of other providers are ignored, since anyone could claim an
+// address of an allowed domain.
+func (p *SSOProvider) VerifiedEmail(claims map[string]any, multiTenant bool) string {
+	email := ssoClaimString(claims, "email")
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		if verified && email != "" {
+			return email
+		}
+	case string:
+		if strings.EqualFold(verified, "true") && email != "" {
+			return email
+		}
+	}
+	if p.Type != SSOProviderTypeAzureAD || multiTenant {
+		return ""
+	}
+	if email != "" {
+		return email
+	}
+	// Azure AD 不返回 email 时使用 UPN
+	if upn := ssoClaimString(claims, "preferred_username"); strings.Contains(upn, "@") {
+		return upn
+	}
+	return ""
+}
+
+// ClaimValues reads the groups claim from the merged ID token and userinfo claims, the claim may be a string or
+// a list and can be nested, e.g. realm_access.roles.
+func (p *SSOProvider) ClaimValues(claims map[string]any) []string {
+	var value any = claims
+	for _, part := range strings.Split(p.GetGroupsClaim(), ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// MatchGroupRule returns the first rule matching one of the IdP groups of the user.
+func (p *SSOProvider) MatchGroupRule(idpGroups []string) (*SSOGroupRule, bool) {
+	for i := range p.GroupRules {
+		rule := &p.GroupRules[i]
+		if rule.Group == "" {
+			continue
+		}
+		if rule.IdpGroup == "*" {
+			return rule, true
+		}
+		for _, group := range idpGroups {
+			if strings.EqualFold(group, rule.IdpGroup) {
+				return rule, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// MaskSSOProviderSecrets hides the client secrets of the providers option before it is sent to the frontend.
+func MaskSSOProviderSecrets(value string) string {
+	var providers []SSOProvider
+	if err := common.UnmarshalJsonStr(value, &providers); err != nil {
+		return "[]"
+	}
+	for i := range providers {
+		providers[i].ClientSecret = ""
+	}
+	data, _ := common.Marshal(providers)
+	return string(data)
+}
+
+// MergeSSOProviders validates the providers option and keeps the saved client secret of a provider when the
+// submitted one is empty, since the frontend never receives it.
+func MergeSSOProviders(value string) (string, error) {
+	var providers []SSOProvider
+	if err := common.UnmarshalJsonStr(value, &providers); err != nil {
+		return "", fmt.Errorf("SSO 提供商配置格式错误: %w", err)
+	}
+	seen := make(map[string]bool, len(providers))
+	for i := range providers {
+		provider := &providers[i]
+		if !ssoProviderNamePattern.MatchString(provider.Name) {
+			return "", fmt.Errorf("SSO 提供商标识 %q 只能包含字母、数字、下划线和连字符", provider.Name)
+		}
+		if seen[provider.Name] {
+			return "", fmt.Errorf("SSO 提供商标识 %s 重复", provider.Name)
+		}
+		seen[provider.Name] = true
+		switch provider.Type {
+		case SSOProviderTypeGoogle:
+		case SSOProviderTypeAzureAD:
+			// 多租户端点允许任意组织的账户登录
+			switch strings.ToLower(strings.TrimSpace(provider.TenantId)) {
+			case "":
+				return "", fmt.Errorf("SSO 提供商 %s 必须填写 Azure AD 租户", provider.Name)
+			case "organizations", "common", "consumers":
+				if len(provider.AllowedDomains) == 0 {
+					return "", fmt.Errorf("SSO 提供商 %s 使用多租户端点时必须限制允许的邮箱域名", provider.Name)
+				}
+			}
+		case SSOProviderTypeOIDC:
+			if !strings.HasPrefix(provider.Issuer, "https://") && !strings.HasPrefix(provider.Issuer, "http://") {
+				return "", fmt.Errorf("SSO 提供商 %s 的 issuer 必须是 http(s) 地址", provider.Name)
+			}
+		default:
+			return "", fmt.Errorf("SSO 提供商 %s 的类型 %q 不受支持", provider.Name, provider.Type)
+		}
+		if provider.DisplayName == "" {
+			provider.DisplayName = provider.Name
+		}
+		if provider.ClientSecret == "" {
+			for _, saved := range ssoSettings.Providers {
+				if saved.Name == provider.Name {
+					provider.ClientSecret = saved.ClientSecret
+					break
+				}
+			}
+		}
+	}
+	data, err := common.Marshal(providers)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,156 @@
+package system_setting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSOProviderIssuerURL(t *testing.T) {
+	require.Equal(t, "https://accounts.google.com", (&SSOProvider{Type: SSOProviderTypeGoogle}).IssuerURL())
+	require.Equal(t, "", (&SSOProvider{Type: SSOProviderTypeAzureAD}).IssuerURL())
+	require.Equal(t, "https://login.microsoftonline.com/contoso/v2.0", (&SSOProvider{Type: SSOProviderTypeAzureAD, TenantId: "contoso"}).IssuerURL())
+	require.Equal(t, "https://idp.example.com/realms/main", (&SSOProvider{Type: SSOProviderTypeOIDC, Issuer: "https://idp.example.com/realms/main/"}).IssuerURL())
+}
+
+func TestSSOProviderClaimValues(t *testing.T) {
+	claims := map[string]any{
+		"groups":       []any{"admins", "dev"},
+		"hd":           "corp.com",
+		"realm_access": map[string]any{"roles": []any{"vip"}},
+	}
+	require.Equal(t, []string{"admins", "dev"}, (&SSOProvider{}).ClaimValues(claims))
+	require.Equal(t, []string{"corp.com"}, (&SSOProvider{GroupsClaim: "hd"}).ClaimValues(claims))
+	require.Equal(t, []string{"vip"}, (&SSOProvider{GroupsClaim: "realm_access.roles"}).ClaimValues(claims))
+	require.Nil(t, (&SSOProvider{GroupsClaim: "missing.roles"}).ClaimValues(claims))
+}
+
+func TestSSOProviderMatchGroupRule_FirstMatchWins(t *testing.T) {
+	provider := &SSOProvider{GroupRules: []SSOGroupRule{
+		{IdpGroup: "admins", Group: "vip", Quota: 1000},
+		{IdpGroup: "dev", Group: "default"},
+		{IdpGroup: "*", Group: "trial"},
+	}}
+	rule, ok := provider.MatchGroupRule([]string{"dev", "Admins"})
+	require.True(t, ok)
+	require.Equal(t, "vip", rule.Group)
+	require.Equal(t, 1000, rule.Quota)
+
+	rule, ok = provider.MatchGroupRule(nil)
+	require.True(t, ok)
+	require.Equal(t, "trial", rule.Group)
+
+	_, ok = (&SSOProvider{}).MatchGroupRule([]string{"dev"})
+	require.False(t, ok)
+}
+
+func TestSSOProviderEmailAllowed(t *testing.T) {
+	require.True(t, (&SSOProvider{}).EmailAllowed(""))
+	provider := &SSOProvider{AllowedDomains: []string{"corp.com"}}
+	require.True(t, provider.EmailAllowed("a@eu.corp.com"))
+	require.False(t, provider.EmailAllowed("a@gmail.com"))
+	require.False(t, provider.EmailAllowed(""))
+}
+
+func TestSSOProviderValidateIDTokenClaims(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	provider := &SSOProvider{ClientId: "client"}
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss":   "https://idp.example.com/",
+			"aud":   "client",
+			"exp":   float64(now.Add(time.Minute).Unix()),
+			"nonce": "n1",
+			"sub":   "u1",
+		}
+	}
+	require.NoError(t, provider.ValidateIDTokenClaims(valid(), "https://idp.example.com", "n1", now))
+
+	cases := map[string]func(claims map[string]any){
+		"other issuer":       func(claims map[string]any) { claims["iss"] = "https://evil.example.com" },
+		"missing issuer":     func(claims map[string]any) { delete(claims, "iss") },
+		"other audience":     func(claims map[string]any) { claims["aud"] = "other" },
+		"missing azp":        func(claims map[string]any) { claims["aud"] = []any{"other", "client"} },
+		"other azp":          func(claims map[string]any) { claims["aud"] = []any{"other", "client"}; claims["azp"] = "other" },
+		"expired":            func(claims map[string]any) { claims["exp"] = float64(now.Add(-time.Hour).Unix()) },
+		"missing expiration": func(claims map[string]any) { delete(claims, "exp") },
+		"other nonce":        func(claims map[string]any) { claims["nonce"] = "n2" },
+		"missing nonce":      func(claims map[string]any) { delete(claims, "nonce") },
+	}
+	for name, mutate := range cases {
+		claims := valid()
+		mutate(claims)
+		require.Error(t, provider.ValidateIDTokenClaims(claims, "https://idp.example.com", "n1", now), name)
+	}
+
+	claims := valid()
+	claims["aud"] = []any{"other", "client"}
+	claims["azp"] = "client"
+	require.NoError(t, provider.ValidateIDTokenClaims(claims, "https://idp.example.com", "n1", now))
+	require.Error(t, provider.ValidateIDTokenClaims(valid(), "https://idp.example.com", "", now), "login without nonce")
+}
+
+func TestSSOProviderValidateIDTokenClaims_AzureTenant(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	provider := &SSOProvider{Type: SSOProviderTypeAzureAD, ClientId: "client"}
+	issuer := "https://login.microsoftonline.com/{tenantid}/v2.0"
+	claims := map[string]any{
+		"iss":   "https://login.microsoftonline.com/t1/v2.0",
+		"tid":   "t1",
+		"aud":   "client",
+		"exp":   float64(now.Unix()),
+		"nonce": "n1",
+	}
+	require.True(t, IsMultiTenantIssuer(issuer))
+	require.NoError(t, provider.ValidateIDTokenClaims(claims, issuer, "n1", now))
+
+	claims["tid"] = "t2"
+	require.Error(t, provider.ValidateIDTokenClaims(claims, issuer, "n1", now))
+	delete(claims, "tid")
+	require.Error(t, provider.ValidateIDTokenClaims(claims, issuer, "n1", now))
+}
+
+func TestSSOProviderVerifiedEmail(t *testing.T) {
+	oidc := &SSOProvider{Type: SSOProviderTypeOIDC}
+	require.Equal(t, "a@corp.com", oidc.VerifiedEmail(map[string]any{"email": "a@corp.com", "email_verified": true}, false))
+	require.Equal(t, "a@corp.com", oidc.VerifiedEmail(map[string]any{"email": "a@corp.com", "email_verified": "true"}, false))
+	require.Empty(t, oidc.VerifiedEmail(map[string]any{"email": "a@corp.com"}, false))
+	require.Empty(t, oidc.VerifiedEmail(map[string]any{"email": "a@corp.com", "email_verified": false}, false))
+	require.Empty(t, oidc.VerifiedEmail(map[string]any{"preferred_username": "a@corp.com"}, false))
+
+	azure := &SSOProvider{Type: SSOProviderTypeAzureAD}
+	require.Equal(t, "a@corp.com", azure.VerifiedEmail(map[string]any{"email": "a@corp.com"}, false))
+	require.Equal(t, "b@corp.com", azure.VerifiedEmail(map[string]any{"preferred_username": "b@corp.com"}, false))
+	require.Empty(t, azure.VerifiedEmail(map[string]any{"email": "a@corp.com", "preferred_username": "b@corp.com"}, true))
+}
+
+func TestMergeSSOProviders_AzureTenant(t *testing.T) {
+	_, err := MergeSSOProviders(`[{"name":"azure","type":"azure_ad"}]`)
+	require.Error(t, err)
+	_, err = MergeSSOProviders(`[{"name":"azure","type":"azure_ad","tenant_id":"organizations"}]`)
+	require.Error(t, err)
+	_, err = MergeSSOProviders(`[{"name":"azure","type":"azure_ad","tenant_id":"organizations","allowed_domains":["corp.com"]}]`)
+	require.NoError(t, err)
+	_, err = MergeSSOProviders(`[{"name":"azure","type":"azure_ad","tenant_id":"contoso.onmicrosoft.com"}]`)
+	require.NoError(t, err)
+}
+
+func TestMergeSSOProviders_KeepsSavedSecret(t *testing.T) {
+	old := ssoSettings.Providers
+	defer func() { ssoSettings.Providers = old }()
+	ssoSettings.Providers = []SSOProvider{{Name: "google", Type: SSOProviderTypeGoogle, ClientSecret: "saved"}}
+
+	masked := MaskSSOProviderSecrets(`[{"name":"google","type":"google","client_secret":"saved"}]`)
+	require.NotContains(t, masked, "saved")
+
+	merged, err := MergeSSOProviders(`[{"name":"google","type":"google","client_id":"id"}]`)
+	require.NoError(t, err)
+	require.Contains(t, merged, `"client_secret":"saved"`)
+	require.Contains(t, merged, `"display_name":"google"`)
+
+	_, err = MergeSSOProviders(`[{"name":"corp","type":"oidc"}]`)
+	require.Error(t, err)
+	_, err = MergeSSOProviders(`[{"name":"a/b","type":"google"}]`)
+	require.Error(t, err)
+}
@@ -0,0 +1,30 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// StorageSetting 对象存储配置，图片转存等需要保存文件的功能共用同一个存储
+type StorageSetting struct {
+	Driver   string `json:"driver"`    // local / s3 / minio
+	LocalDir string `json:"local_dir"` // local 驱动的保存目录，多节点部署时需使用共享目录或改用 s3
+
+	S3Endpoint    string `json:"s3_endpoint"` // 为空时使用 AWS 官方地址，MinIO / R2 等填写服务地址
+	S3Region      string `json:"s3_region"`
+	S3Bucket      string `json:"s3_bucket"`
+	S3AccessKeyId string `json:"s3_access_key_id"`
+	S3Secret      string `json:"s3_secret"`
+	S3PathStyle   bool   `json:"s3_path_style"`
+	Prefix        string `json:"prefix"` // 对象键的公共前缀
+}
+
+var storageSetting = StorageSetting{
+	Driver:   "local",
+	LocalDir: "data/storage",
+}
+
+func init() {
+	config.GlobalConfig.Register("storage_setting", &storageSetting)
+}
+
+func GetStorageSetting() *StorageSetting {
+	return &storageSetting
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 )
@@ -38,18 +39,25 @@ const (
 type ErrorCode string
 
 const (
-	ErrorCodeInvalidRequest         ErrorCode = "invalid_request"
-	ErrorCodeSensitiveWordsDetected ErrorCode = "sensitive_words_detected"
-	ErrorCodeViolationFeeGrokCSAM   ErrorCode = "violation_fee.grok.csam"
+	ErrorCodeInvalidRequest          ErrorCode = "invalid_request"
+	ErrorCodeSensitiveWordsDetected  ErrorCode = "sensitive_words_detected"
+	ErrorCodeModerationBlocked       ErrorCode = "moderation_blocked"
+	ErrorCodeViolationFeeGrokCSAM    ErrorCode = "violation_fee.grok.csam"
+	ErrorCodeModelCapabilityExceeded ErrorCode = "model_capability_exceeded"
+	ErrorCodeDuplicateRequest        ErrorCode = "duplicate_request"
 
 	// new api error
-	ErrorCodeCountTokenFailed   ErrorCode = "count_token_failed"
-	ErrorCodeModelPriceError    ErrorCode = "model_price_error"
-	ErrorCodeInvalidApiType     ErrorCode = "invalid_api_type"
-	ErrorCodeJsonMarshalFailed  ErrorCode = "json_marshal_failed"
-	ErrorCodeDoRequestFailed    ErrorCode = "do_request_failed"
-	ErrorCodeGetChannelFailed   ErrorCode = "get_channel_failed"
-	ErrorCodeGenRelayInfoFailed ErrorCode = "gen_relay_info_failed"
+	ErrorCodeCountTokenFailed    ErrorCode = "count_token_failed"
+	ErrorCodeModelPriceError     ErrorCode = "model_price_error"
+	ErrorCodeInvalidApiType      ErrorCode = "invalid_api_type"
+	ErrorCodeJsonMarshalFailed   ErrorCode = "json_marshal_failed"
+	ErrorCodeDoRequestFailed     ErrorCode = "do_request_failed"
+	ErrorCodeGetChannelFailed    ErrorCode = "get_channel_failed"
+	ErrorCodeGenRelayInfoFailed  ErrorCode = "gen_relay_info_failed"
+	ErrorCodeFaultInjected       ErrorCode = "fault_injected"
+	ErrorCodeRequestTimeout      ErrorCode = "request_timeout"
+	ErrorCodeCircuitOpen         ErrorCode = "circuit_open"
+	ErrorCodeUpstreamRateLimited ErrorCode = "upstream_rate_limited"
 
 	// channel error
 	ErrorCodeChannelNoAvailableKey        ErrorCode = "channel:no_available_key"
@@ -59,6 +67,7 @@ const (
 	ErrorCodeChannelAwsClientError        ErrorCode = "channel:aws_client_error"
 	ErrorCodeChannelInvalidKey            ErrorCode = "channel:invalid_key"
 	ErrorCodeChannelResponseTimeExceeded  ErrorCode = "channel:response_time_exceeded"
+	ErrorCodeChannelProbeAssertionFailed  ErrorCode = "channel:probe_assertion_failed"
 
 	// client request error
 	ErrorCodeReadRequestBodyFailed ErrorCode = "read_request_body_failed"
@@ -77,6 +86,17 @@ const (
 	ErrorCodeAwsInvokeError         ErrorCode = "aws_invoke_error"
 	ErrorCodeModelNotFound          ErrorCode = "model_not_found"
 	ErrorCodePromptBlocked          ErrorCode = "prompt_blocked"
+	ErrorCodeContentFiltered        ErrorCode = "content_filtered"
+
+	// upstream error event in the middle of a stream, normalized across providers
+	ErrorCodeStreamOverloaded       ErrorCode = "stream_error:overloaded"
+	ErrorCodeStreamRateLimited      ErrorCode = "stream_error:rate_limited"
+	ErrorCodeStreamInvalidRequest   ErrorCode = "stream_error:invalid_request"
+	ErrorCodeStreamAuthentication   ErrorCode = "stream_error:authentication"
+	ErrorCodeStreamPermissionDenied ErrorCode = "stream_error:permission_denied"
+	ErrorCodeStreamNotFound         ErrorCode = "stream_error:not_found"
+	ErrorCodeStreamTimeout          ErrorCode = "stream_error:timeout"
+	ErrorCodeStreamServerError      ErrorCode = "stream_error:server_error"
 
 	// sql error
 	ErrorCodeQueryDataError  ErrorCode = "query_data_error"
@@ -85,6 +105,9 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeModelClassQuotaExceeded    ErrorCode = "model_class_quota_exceeded"
+	ErrorCodeTokenBudgetExhausted       ErrorCode = "token_budget_exhausted"
+	ErrorCodeTPMLimitExceeded           ErrorCode = "tpm_limit_exceeded"
 )
 
 type NewAPIError struct {
@@ -96,6 +119,8 @@ type NewAPIError struct {
 	errorCode      ErrorCode
 	StatusCode     int
 	Metadata       json.RawMessage
+	// RetryAfter 上游限流时距离额度重置的时间，0 表示未知
+	RetryAfter time.Duration
 }
 
 // Unwrap enables errors.Is / errors.As to work with NewAPIError by exposing the underlying error.
@@ -177,6 +202,19 @@ func (e *NewAPIError) SetMessage(message string) {
 	e.Err = errors.New(message)
 }
 
+// RewriteMessage replaces the message returned to clients, including the one kept in the upstream error object.
+func (e *NewAPIError) RewriteMessage(message string) {
+	e.Err = errors.New(message)
+	switch relayError := e.RelayError.(type) {
+	case OpenAIError:
+		relayError.Message = message
+		e.RelayError = relayError
+	case ClaudeError:
+		relayError.Message = message
+		e.RelayError = relayError
+	}
+}
+
 func (e *NewAPIError) ToOpenAIError() OpenAIError {
 	var result OpenAIError
 	switch e.errorType {
@@ -363,6 +401,59 @@ func WithClaudeError(claudeError ClaudeError, statusCode int, ops ...NewAPIError
 	return e
 }
 
+// streamErrorMappings Anthropic 的错误类型与 Gemini 的 status 对应的状态码和归一化的错误码
+var streamErrorMappings = map[string]struct {
+	statusCode int
+	errorCode  ErrorCode
+}{
+	"overloaded_error":      {http.StatusServiceUnavailable, ErrorCodeStreamOverloaded},
+	"unavailable":           {http.StatusServiceUnavailable, ErrorCodeStreamOverloaded},
+	"rate_limit_error":      {http.StatusTooManyRequests, ErrorCodeStreamRateLimited},
+	"resource_exhausted":    {http.StatusTooManyRequests, ErrorCodeStreamRateLimited},
+	"invalid_request_error": {http.StatusBadRequest, ErrorCodeStreamInvalidRequest},
+	"request_too_large":     {http.StatusRequestEntityTooLarge, ErrorCodeStreamInvalidRequest},
+	"invalid_argument":      {http.StatusBadRequest, ErrorCodeStreamInvalidRequest},
+	"failed_precondition":   {http.StatusBadRequest, ErrorCodeStreamInvalidRequest},
+	"authentication_error":  {http.StatusUnauthorized, ErrorCodeStreamAuthentication},
+	"unauthenticated":       {http.StatusUnauthorized, ErrorCodeStreamAuthentication},
+	"permission_error":      {http.StatusForbidden, ErrorCodeStreamPermissionDenied},
+	"permission_denied":     {http.StatusForbidden, ErrorCodeStreamPermissionDenied},
+	"not_found_error":       {http.StatusNotFound, ErrorCodeStreamNotFound},
+	"not_found":             {http.StatusNotFound, ErrorCodeStreamNotFound},
+	"timeout_error":         {http.StatusGatewayTimeout, ErrorCodeStreamTimeout},
+	"deadline_exceeded":     {http.StatusGatewayTimeout, ErrorCodeStreamTimeout},
+}
+
+func mapStreamError(errorType string) (int, ErrorCode) {
+	if mapping, ok := streamErrorMappings[strings.ToLower(errorType)]; ok {
+		return mapping.statusCode, mapping.errorCode
+	}
+	return http.StatusInternalServerError, ErrorCodeStreamServerError
+}
+
+// NewClaudeStreamError builds the error of an Anthropic error event in a stream, with the status code the
+// error type stands for and the normalized error code.
+func NewClaudeStreamError(claudeError ClaudeError) *NewAPIError {
+	statusCode, errorCode := mapStreamError(claudeError.Type)
+	e := WithClaudeError(claudeError, statusCode)
+	e.errorCode = errorCode
+	return e
+}
+
+// NewGeminiStreamError builds the error of a Gemini error object in a stream, status is the rpc status such as
+// RESOURCE_EXHAUSTED.
+func NewGeminiStreamError(status string, message string) *NewAPIError {
+	statusCode, errorCode := mapStreamError(status)
+	if status == "" {
+		status = "upstream_error"
+	}
+	return WithOpenAIError(OpenAIError{
+		Message: message,
+		Type:    status,
+		Code:    string(errorCode),
+	}, statusCode)
+}
+
 func IsChannelError(err *NewAPIError) bool {
 	if err == nil {
 		return false
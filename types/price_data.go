@@ -8,6 +8,12 @@ type GroupRatioInfo struct {
 	HasSpecialRatio   bool
 }
 
+const (
+	PriceSourceGlobal  = "global"  // 全局模型价格/倍率
+	PriceSourceChannel = "channel" // 渠道覆盖的模型价格/倍率
+	PriceSourceByok    = "byok"    // 用户自有渠道，按平台费率收费
+)
+
 type PriceData struct {
 	FreeModel            bool
 	ModelPrice           float64
@@ -24,6 +30,7 @@ type PriceData struct {
 	UsePrice             bool
 	QuotaToPreConsume    int // 预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+	PriceSource          string
 }
 
 func (p *PriceData) AddOtherRatio(key string, ratio float64) {
@@ -40,6 +47,7 @@ type PerCallPriceData struct {
 	ModelPrice     float64
 	Quota          int
 	GroupRatioInfo GroupRatioInfo
+	PriceSource    string
 }
 
 func (p *PriceData) ToSetting() string {
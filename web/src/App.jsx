@@ -226,6 +226,14 @@ function App() {
             </Suspense>
           }
         />
+        <Route
+          path='/oauth/sso/:name'
+          element={
+            <Suspense fallback={<Loading></Loading>} key={location.pathname}>
+              <OAuth2Callback type='sso'></OAuth2Callback>
+            </Suspense>
+          }
+        />
         <Route
           path='/oauth/linuxdo'
           element={
@@ -33,6 +33,7 @@ import {
   onGitHubOAuthClicked,
   onDiscordOAuthClicked,
   onOIDCClicked,
+  onSSOClicked,
   onLinuxDOOAuthClicked,
   prepareCredentialRequestOptions,
   buildAssertionResult,
@@ -358,6 +359,15 @@ const LoginForm = () => {
     }
   };
 
+  // SSO 登录点击处理，跳转到后端生成的授权地址
+  const handleSSOClick = (name) => {
+    if ((hasUserAgreement || hasPrivacyPolicy) && !agreedToTerms) {
+      showInfo(t('请先阅读并同意用户协议和隐私政策'));
+      return;
+    }
+    onSSOClicked(name, { shouldLogout: true });
+  };
+
   // 包装的LinuxDO登录点击处理
   const handleLinuxDOClick = () => {
     if ((hasUserAgreement || hasPrivacyPolicy) && !agreedToTerms) {
@@ -551,6 +561,21 @@ const LoginForm = () => {
                   </Button>
                 )}
 
+                {(status.sso_providers || []).map((provider) => (
+                  <Button
+                    key={provider.name}
+                    theme='outline'
+                    className='w-full h-12 flex items-center justify-center !rounded-full border border-gray-200 hover:bg-gray-50 transition-colors'
+                    type='tertiary'
+                    icon={<OIDCIcon style={{ color: '#1877F2' }} />}
+                    onClick={() => handleSSOClick(provider.name)}
+                  >
+                    <span className='ml-3'>
+                      {t('使用 {{name}} 继续', { name: provider.display_name })}
+                    </span>
+                  </Button>
+                ))}
+
                 {status.linuxdo_oauth && (
                   <Button
                     theme='outline'
@@ -784,6 +809,7 @@ const LoginForm = () => {
               {(status.github_oauth ||
                 status.discord_oauth ||
                 status.oidc_enabled ||
+                status.sso_providers?.length > 0 ||
                 status.wechat_login ||
                 status.linuxdo_oauth ||
                 status.telegram_oauth) && (
@@ -920,6 +946,7 @@ const LoginForm = () => {
           status.github_oauth ||
           status.discord_oauth ||
           status.oidc_enabled ||
+          status.sso_providers?.length > 0 ||
           status.wechat_login ||
           status.linuxdo_oauth ||
           status.telegram_oauth
@@ -18,7 +18,7 @@ For commercial licensing, please contact support@quantumnous.com
 */
 
 import React, { useContext, useEffect } from 'react';
-import { useNavigate, useSearchParams } from 'react-router-dom';
+import { useNavigate, useParams, useSearchParams } from 'react-router-dom';
 import { useTranslation } from 'react-i18next';
 import {
   API,
@@ -33,6 +33,9 @@ import Loading from '../common/ui/Loading';
 const OAuth2Callback = (props) => {
   const { t } = useTranslation();
   const [searchParams] = useSearchParams();
+  // SSO 回调地址为 /oauth/sso/:name
+  const { name } = useParams();
+  const type = name ? `${props.type}/${encodeURIComponent(name)}` : props.type;
   const [, userDispatch] = useContext(UserContext);
   const navigate = useNavigate();
 
@@ -42,7 +45,7 @@ const OAuth2Callback = (props) => {
   const sendCode = async (code, state, retry = 0) => {
     try {
       const { data: resData } = await API.get(
-        `/api/oauth/${props.type}?code=${code}&state=${state}`,
+        `/api/oauth/${type}?code=${code}&state=${state}`,
       );
 
       const { success, message, data } = resData;
@@ -37,6 +37,10 @@ const OperationSetting = () => {
     QuotaForInviter: 0,
     QuotaForInvitee: 0,
     'quota_setting.enable_free_model_pre_consume': true,
+    'quota_setting.stream_checkpoint_seconds': 0,
+    'quota_setting.stream_reservation_enabled': false,
+    'quota_setting.stream_reserve_completion_tokens': 4096,
+    'quota_setting.stream_hard_cap_quota': 0,
 
     /* 通用设置 */
     TopUpLink: '',
@@ -49,6 +53,7 @@ const OperationSetting = () => {
     DefaultCollapseSidebar: false,
     DemoSiteEnabled: false,
     SelfUseModeEnabled: false,
+    LatencyHeadersEnabled: false,
 
     /* 顶栏模块管理 */
     HeaderNavModules: '',
@@ -63,6 +68,13 @@ const OperationSetting = () => {
 
     /* 日志设置 */
     LogConsumeEnabled: false,
+    LogPayloadMaxRunes: 2048,
+    LogPayloadRouteLimits: '',
+    LogPayloadSuccessSampleRate: 100,
+    LogPayloadErrorSampleRate: 100,
+    LogRedactionEnabled: false,
+    LogRedactionRules: '',
+    LogPayloadStorageEnabled: false,
 
     /* 监控设置 */
     ChannelDisableThreshold: 0,
@@ -335,13 +335,15 @@ const OtherSetting = () => {
                       {t('当前版本')}：
                       {statusState?.status?.version || t('未知')}
                     </Text>
-                    <Button
-                      type='primary'
-                      onClick={checkUpdate}
-                      loading={loadingInput['CheckUpdate']}
-                    >
-                      {t('检查更新')}
-                    </Button>
+                    {!statusState?.status?.offline_mode && (
+                      <Button
+                        type='primary'
+                        onClick={checkUpdate}
+                        loading={loadingInput['CheckUpdate']}
+                      >
+                        {t('检查更新')}
+                      </Button>
+                    )}
                   </Space>
                 </Col>
               </Row>
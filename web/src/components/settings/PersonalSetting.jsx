@@ -284,11 +284,21 @@ const PersonalSetting = () => {
       return;
     }
 
-    const res = await API.delete('/api/user/self');
-    const { success, message } = res.data;
+    const res = await API.delete('/api/user/self', {
+      data: { confirm: inputs.self_account_deletion_confirmation },
+    });
+    const { success, message, data } = res.data;
 
     if (success) {
-      showSuccess(t('账户已删除！'));
+      if (data?.delete_at) {
+        showSuccess(
+          t('已提交注销申请，账户将于 {{time}} 删除，在此之前可撤销申请', {
+            time: new Date(data.delete_at * 1000).toLocaleString(),
+          }),
+        );
+      } else {
+        showSuccess(t('账户已删除！'));
+      }
       await API.get('/api/user/logout');
       userDispatch({ type: 'logout' });
       localStorage.removeItem('user');
@@ -36,12 +36,17 @@ const RatioSetting = () => {
     ModelPrice: '',
     ModelRatio: '',
     CacheRatio: '',
+    CreateCacheRatio: '',
     CompletionRatio: '',
     GroupRatio: '',
     GroupGroupRatio: '',
     ImageRatio: '',
     AudioRatio: '',
     AudioCompletionRatio: '',
+    AudioInputSecondPrice: '',
+    AudioOutputTokenPrice: '',
+    AudioCharacterPrice: '',
+    ImageGenerationPrice: '',
     AutoGroups: '',
     DefaultUseAutoGroup: false,
     ExposeRatioEnabled: false,
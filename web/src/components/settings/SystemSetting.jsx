@@ -65,6 +65,8 @@ const SystemSetting = () => {
     'oidc.authorization_endpoint': '',
     'oidc.token_endpoint': '',
     'oidc.user_info_endpoint': '',
+    'sso.enabled': '',
+    'sso.providers': '',
     Notice: '',
     SMTPServer: '',
     SMTPPort: '',
@@ -191,11 +193,23 @@ const SystemSetting = () => {
           case 'LinuxDOOAuthEnabled':
           case 'discord.enabled':
           case 'oidc.enabled':
+          case 'sso.enabled':
           case 'passkey.enabled':
           case 'passkey.allow_insecure_origin':
           case 'WorkerAllowHttpImageRequestEnabled':
             item.value = toBoolean(item.value);
             break;
+          case 'sso.providers':
+            try {
+              item.value = JSON.stringify(
+                JSON.parse(item.value || '[]'),
+                null,
+                2,
+              );
+            } catch (e) {
+              item.value = '[]';
+            }
+            break;
           case 'passkey.origins':
             // origins是逗号分隔的字符串，直接使用
             item.value = item.value || '';
@@ -664,6 +678,23 @@ const SystemSetting = () => {
     }
   };
 
+  const submitSSOSettings = async () => {
+    let providers;
+    try {
+      providers = JSON.parse(inputs['sso.providers'] || '[]');
+    } catch (e) {
+      showError(t('SSO 提供商配置不是合法的 JSON'));
+      return;
+    }
+    if (!Array.isArray(providers)) {
+      showError(t('SSO 提供商配置必须是数组'));
+      return;
+    }
+    await updateOptions([
+      { key: 'sso.providers', value: JSON.stringify(providers) },
+    ]);
+  };
+
   const submitTelegramSettings = async () => {
     const options = [
       { key: 'TelegramBotToken', value: inputs.TelegramBotToken },
@@ -1216,6 +1247,13 @@ const SystemSetting = () => {
                       >
                         {t('允许通过 OIDC 进行登录')}
                       </Form.Checkbox>
+                      <Form.Checkbox
+                        field="['sso.enabled']"
+                        noLabel
+                        onChange={(e) => handleCheckboxChange('sso.enabled', e)}
+                      >
+                        {t('允许通过 SSO 提供商进行登录')}
+                      </Form.Checkbox>
                     </Col>
                   </Row>
                 </Form.Section>
@@ -1545,6 +1583,52 @@ const SystemSetting = () => {
                 </Form.Section>
               </Card>
 
+              <Card>
+                <Form.Section text={t('配置 SSO 登录')}>
+                  <Text>
+                    {t(
+                      '可同时配置多个 OpenID Connect 提供商，类型为 oidc、google 或 azure_ad，端点通过 issuer 自动发现；IdP 的分组按 group_rules 顺序映射为本站分组，auto_provision 开启后首次登录自动创建用户',
+                    )}
+                  </Text>
+                  <Banner
+                    type='info'
+                    description={`${t('重定向 URL 填')} ${inputs.ServerAddress ? inputs.ServerAddress : t('网站地址')}/oauth/sso/{name}，${t('Client Secret 留空时保留已保存的值')}`}
+                    style={{ marginBottom: 20, marginTop: 16 }}
+                  />
+                  <Form.TextArea
+                    field="['sso.providers']"
+                    label={t('SSO 提供商')}
+                    autosize={{ minRows: 8, maxRows: 24 }}
+                    placeholder={JSON.stringify(
+                      [
+                        {
+                          name: 'azure',
+                          display_name: 'Microsoft',
+                          enabled: true,
+                          type: 'azure_ad',
+                          tenant_id: 'contoso.onmicrosoft.com',
+                          client_id: '',
+                          client_secret: '',
+                          groups_claim: 'groups',
+                          group_rules: [
+                            { idp_group: 'ai-admins', group: 'vip', quota: 0 },
+                            { idp_group: '*', group: 'default', quota: 0 },
+                          ],
+                          auto_provision: true,
+                          sync_group_on_login: true,
+                          allowed_domains: ['contoso.com'],
+                        },
+                      ],
+                      null,
+                      2,
+                    )}
+                  />
+                  <Button onClick={submitSSOSettings}>
+                    {t('保存 SSO 设置')}
+                  </Button>
+                </Form.Section>
+              </Card>
+
               <Card>
                 <Form.Section text={t('配置 GitHub OAuth App')}>
                   <Text>{t('用以支持通过 GitHub 进行登录注册')}</Text>
@@ -44,6 +44,7 @@ import TelegramLoginButton from 'react-telegram-login';
 import {
   onGitHubOAuthClicked,
   onOIDCClicked,
+  onSSOClicked,
   onLinuxDOOAuthClicked,
   onDiscordOAuthClicked,
 } from '../../../../helpers';
@@ -332,6 +333,37 @@ const AccountManagement = ({
                 </div>
               </Card>
 
+              {/* SSO 提供商绑定 */}
+              {(status.sso_providers || []).map((provider) => (
+                <Card className='!rounded-xl' key={provider.name}>
+                  <div className='flex items-center justify-between gap-3'>
+                    <div className='flex items-center flex-1 min-w-0'>
+                      <div className='w-10 h-10 rounded-full bg-slate-100 dark:bg-slate-700 flex items-center justify-center mr-3 flex-shrink-0'>
+                        <IconShield
+                          size='default'
+                          className='text-slate-600 dark:text-slate-300'
+                        />
+                      </div>
+                      <div className='flex-1 min-w-0'>
+                        <div className='font-medium text-gray-900'>
+                          {provider.display_name}
+                        </div>
+                      </div>
+                    </div>
+                    <div className='flex-shrink-0'>
+                      <Button
+                        type='primary'
+                        theme='outline'
+                        size='small'
+                        onClick={() => onSSOClicked(provider.name)}
+                      >
+                        {t('绑定')}
+                      </Button>
+                    </div>
+                  </div>
+                </Card>
+              ))}
+
               {/* Telegram绑定 */}
               <Card className='!rounded-xl'>
                 <div className='flex items-center justify-between gap-3'>
@@ -74,7 +74,8 @@ const renderType = (type, record = {}, t) => {
 
   const typeTag = (
     <Tag color={type2label[type]?.color} shape='circle' prefixIcon={icon}>
-      {type2label[type]?.label}
+      {type2label[type]?.label ||
+        (type >= 1000 ? `${t('插件渠道')} #${type}` : t('未知类型'))}
     </Tag>
   );
 
@@ -183,6 +184,24 @@ const renderStatus = (status, channelInfo = undefined, t) => {
   }
 };
 
+const renderCircuitBreaker = (breaker, t) => {
+  const halfOpen = breaker.state === 'half_open';
+  return (
+    <Tooltip
+      content={
+        t('熔断时间：') +
+        timestamp2string(breaker.opened_at) +
+        t('，冷却至：') +
+        timestamp2string(breaker.open_until)
+      }
+    >
+      <Tag color={halfOpen ? 'orange' : 'red'} shape='circle' type='light'>
+        {halfOpen ? t('熔断探测中') : t('已熔断')}
+      </Tag>
+    </Tooltip>
+  );
+};
+
 const renderMultiKeyStatus = (status, keySize, enabledKeySize, t) => {
   switch (status) {
     case 1:
@@ -417,9 +436,19 @@ export const getChannelsColumns = ({
               </Tooltip>
             </div>
           );
-        } else {
-          return renderStatus(text, record.channel_info, t);
         }
+        if (
+          record.circuit_breaker &&
+          record.circuit_breaker.state !== 'closed'
+        ) {
+          return (
+            <Space spacing={4}>
+              {renderStatus(text, record.channel_info, t)}
+              {renderCircuitBreaker(record.circuit_breaker, t)}
+            </Space>
+          );
+        }
+        return renderStatus(text, record.channel_info, t);
       },
     },
     {
@@ -0,0 +1,94 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+import React from 'react';
+import { Form, Input, InputNumber, Select, Switch } from '@douyinfe/semi-ui';
+
+// 根据第三方适配器声明的 config_schema 渲染渠道配置项
+const AdaptorConfigFields = ({ t, schema, value, onChange }) => {
+  const config = value || {};
+
+  const renderControl = (field) => {
+    const current = config[field.key] ?? field.default;
+    switch (field.type) {
+      case 'number':
+        return (
+          <InputNumber
+            value={current}
+            onChange={(v) => onChange(field.key, v === '' ? undefined : v)}
+            style={{ width: '100%' }}
+          />
+        );
+      case 'bool':
+        return (
+          <Switch
+            checked={current === true}
+            onChange={(v) => onChange(field.key, v)}
+          />
+        );
+      case 'select':
+        return (
+          <Select
+            value={current}
+            onChange={(v) => onChange(field.key, v)}
+            optionList={(field.options || []).map((option) => ({
+              label: option,
+              value: option,
+            }))}
+            style={{ width: '100%' }}
+          />
+        );
+      case 'secret':
+        return (
+          <Input
+            mode='password'
+            value={current}
+            onChange={(v) => onChange(field.key, v)}
+          />
+        );
+      default:
+        return (
+          <Input value={current} onChange={(v) => onChange(field.key, v)} />
+        );
+    }
+  };
+
+  return (
+    <>
+      {(schema || []).map((field) => (
+        <Form.Slot
+          key={field.key}
+          label={{
+            text: t(field.label || field.key),
+            required: field.required,
+          }}
+        >
+          {renderControl(field)}
+          {field.description && (
+            <div className='text-xs text-gray-500 mt-1'>
+              {t(field.description)}
+            </div>
+          )}
+        </Form.Slot>
+      ))}
+    </>
+  );
+};
+
+export default AdaptorConfigFields;
@@ -60,6 +60,8 @@ const EditTokenModal = (props) => {
   const [loading, setLoading] = useState(false);
   const isMobile = useIsMobile();
   const formApiRef = useRef(null);
+  // 编辑前读取到的剩余额度，提交时用于检测期间发生的扣费或其他编辑
+  const expectedRemainQuotaRef = useRef(null);
   const [models, setModels] = useState([]);
   const [groups, setGroups] = useState([]);
   const isEdit = props.editingToken.id !== undefined;
@@ -74,6 +76,10 @@ const EditTokenModal = (props) => {
     allow_ips: '',
     group: '',
     cross_group_retry: false,
+    response_cache: false,
+    content_fallback: false,
+    fetch_url_tool: false,
+    native_passthrough: false,
     tokenCount: 1,
   });
 
@@ -162,6 +168,7 @@ const EditTokenModal = (props) => {
       } else {
         data.model_limits = [];
       }
+      expectedRemainQuotaRef.current = data.remain_quota;
       if (formApiRef.current) {
         formApiRef.current.setValues({ ...getInitValues(), ...data });
       }
@@ -221,10 +228,25 @@ const EditTokenModal = (props) => {
       }
       localInputs.model_limits = localInputs.model_limits.join(',');
       localInputs.model_limits_enabled = localInputs.model_limits.length > 0;
-      let res = await API.put(`/api/token/`, {
-        ...localInputs,
-        id: parseInt(props.editingToken.id),
-      });
+      let res;
+      try {
+        res = await API.put(
+          `/api/token/`,
+          {
+            ...localInputs,
+            id: parseInt(props.editingToken.id),
+            expected_remain_quota: expectedRemainQuotaRef.current,
+          },
+          { skipErrorHandler: true },
+        );
+      } catch (error) {
+        res = error.response;
+      }
+      if (!res?.data) {
+        showError(t('令牌更新失败'));
+        setLoading(false);
+        return;
+      }
       const { success, message } = res.data;
       if (success) {
         showSuccess(t('令牌更新成功！'));
@@ -393,6 +415,46 @@ const EditTokenModal = (props) => {
                       )}
                     />
                   </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='response_cache'
+                      label={t('响应缓存')}
+                      size='default'
+                      extraText={t(
+                        '开启后，相同的非流式请求直接返回缓存的响应，需要管理员开启响应缓存',
+                      )}
+                    />
+                  </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='content_fallback'
+                      label={t('内容过滤兜底')}
+                      size='default'
+                      extraText={t(
+                        '开启后，上游因内容过滤拒绝请求时按管理员配置的兜底规则切换渠道或模型重试一次',
+                      )}
+                    />
+                  </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='fetch_url_tool'
+                      label={t('服务端网页抓取')}
+                      size='default'
+                      extraText={t(
+                        '开启后，非流式对话请求中模型调用 fetch_url 工具时由网关抓取网页并继续对话',
+                      )}
+                    />
+                  </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='native_passthrough'
+                      label={t('原生透传')}
+                      size='default'
+                      extraText={t(
+                        '开启后，请求协议与渠道原生协议一致时原样转发请求和响应；渠道配置了模型映射、参数覆盖或系统提示词时不生效',
+                      )}
+                    />
+                  </Col>
                   <Col xs={24} sm={24} md={24} lg={10} xl={10}>
                     <Form.DatePicker
                       field='expired_time'
@@ -52,7 +52,7 @@ import {
   IconChevronUp,
   IconChevronDown,
 } from '@douyinfe/semi-icons';
-import { copy } from '../../../helpers/utils';
+import { API, copy, isAdmin, showError } from '../../../helpers';
 import { useIsMobile } from '../../../hooks/common/useIsMobile';
 import {
   safeParseJson,
@@ -2622,11 +2622,49 @@ const UsageLogDetailDrawer = ({
   t,
 }) => {
   const isMobile = useIsMobile();
+  const [storedDetail, setStoredDetail] = useState(null);
 
-  const requestRaw = log?.detail?.request_body || '';
-  const responseRaw = log?.detail?.response_body || '';
+  // 内容保存在对象存储中时，列表里只有截断后的预览，打开详情时再加载完整内容
+  const storageKey = log?.detail?.storage_key;
+  useEffect(() => {
+    setStoredDetail(null);
+    if (!visible || !storageKey || !log?.id) return;
+    let cancelled = false;
+    const url = isAdmin()
+      ? `/api/log/detail/${log.id}`
+      : `/api/log/self/detail/${log.id}`;
+    API.get(url)
+      .then((res) => {
+        const { success, message, data } = res.data;
+        if (cancelled) return;
+        if (success) {
+          setStoredDetail(data);
+        } else {
+          showError(message);
+        }
+      })
+      .catch(() => {});
+    return () => {
+      cancelled = true;
+    };
+  }, [visible, storageKey, log?.id]);
+
+  const detail = storedDetail || log?.detail;
+  const requestRaw = detail?.request_body || '';
+  const responseRaw = detail?.response_body || '';
 
   const requestJson = useMemo(() => safeParseJson(requestRaw), [requestRaw]);
+  const attempts = useMemo(() => {
+    const raw = detail?.attempts;
+    if (!raw) return [];
+    const parsed = typeof raw === 'string' ? safeParseJson(raw) : raw;
+    return Array.isArray(parsed) ? parsed : [];
+  }, [detail?.attempts]);
+  const moderation = useMemo(() => {
+    const raw = detail?.moderation;
+    if (!raw) return null;
+    return typeof raw === 'string' ? safeParseJson(raw) : raw;
+  }, [detail?.moderation]);
   const responseJson = useMemo(() => safeParseJson(responseRaw), [responseRaw]);
   const isSingleStreamObject = useMemo(
     () => looksLikeStreamObject(responseJson),
@@ -3677,9 +3715,16 @@ const UsageLogDetailDrawer = ({
       maskClosable
       title={
         <div className='w-full flex items-center justify-between'>
-          <Title heading={4} style={{ margin: 0 }}>
-            {t('请求详情')}
-          </Title>
+          <Space>
+            <Title heading={4} style={{ margin: 0 }}>
+              {t('请求详情')}
+            </Title>
+            {log?.detail?.redacted && (
+              <Tag type='ghost' color='orange'>
+                {t('已脱敏')}
+              </Tag>
+            )}
+          </Space>
           <RadioGroup
             type='button'
             buttonSize='small'
@@ -3923,6 +3968,34 @@ const UsageLogDetailDrawer = ({
                           if (log?.ip) {
                             rows.push({ key: t('IP'), value: log.ip });
                           }
+                          if (attempts.length > 1) {
+                            rows.push({
+                              key: t('尝试记录'),
+                              value: attempts
+                                .map((attempt) =>
+                                  attempt.status_code
+                                    ? `#${attempt.channel_id} (${attempt.status_code})`
+                                    : `#${attempt.channel_id}`,
+                                )
+                                .join(' → '),
+                            });
+                          }
+                          if (moderation) {
+                            const verdict = moderation.blocked
+                              ? t('已拦截')
+                              : moderation.flagged
+                                ? t('已标记')
+                                : t('通过');
+                            const categories = (moderation.categories || []).join(
+                              ', ',
+                            );
+                            rows.push({
+                              key: t('内容审核'),
+                              value: categories
+                                ? `${verdict} (${categories})`
+                                : verdict,
+                            });
+                          }
                           if (rows.length === 0) {
                             rows.push({ key: t('状态'), value: t('暂无数据') });
                           }
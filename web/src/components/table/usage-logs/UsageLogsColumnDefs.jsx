@@ -133,6 +133,12 @@ function renderType(type, t) {
           {t('错误')}
         </Tag>
       );
+    case 7:
+      return (
+        <Tag color='amber' shape='circle'>
+          {t('额度调整')}
+        </Tag>
+      );
     default:
       return (
         <Tag color='grey' shape='circle'>
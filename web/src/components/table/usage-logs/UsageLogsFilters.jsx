@@ -93,6 +93,15 @@ const LogsFilters = ({
             size='small'
           />
 
+          <Form.Input
+            field='session_id'
+            prefix={<IconSearch />}
+            placeholder={t('会话 ID')}
+            showClear
+            pure
+            size='small'
+          />
+
           {isAdminUser && (
             <>
               <Form.Input
@@ -139,6 +148,7 @@ const LogsFilters = ({
               <Form.Select.Option value='3'>{t('管理')}</Form.Select.Option>
               <Form.Select.Option value='4'>{t('系统')}</Form.Select.Option>
               <Form.Select.Option value='5'>{t('错误')}</Form.Select.Option>
+              <Form.Select.Option value='7'>{t('额度调整')}</Form.Select.Option>
             </Form.Select>
           </div>
 
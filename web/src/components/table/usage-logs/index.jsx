@@ -26,6 +26,7 @@ import ColumnSelectorModal from './modals/ColumnSelectorModal';
 import UserInfoModal from './modals/UserInfoModal';
 import UsageLogDetailDrawer from './UsageLogDetailDrawer';
 import ChannelAffinityUsageCacheModal from './modals/ChannelAffinityUsageCacheModal';
+import SessionSummaryModal from './modals/SessionSummaryModal';
 import { useLogsData } from '../../../hooks/usage-logs/useUsageLogsData';
 import { useIsMobile } from '../../../hooks/common/useIsMobile';
 import { createCardProPagination } from '../../../helpers/utils';
@@ -48,6 +49,7 @@ const LogsPage = () => {
         t={logsData.t}
       />
       <ChannelAffinityUsageCacheModal {...logsData} />
+      <SessionSummaryModal {...logsData} />
 
       {/* Main Content */}
       <CardPro
@@ -0,0 +1,215 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+
+import React, { useEffect, useRef, useState } from 'react';
+import { Button, Modal, Select, Table, Typography } from '@douyinfe/semi-ui';
+import {
+  API,
+  renderQuota,
+  showError,
+  timestamp2string,
+} from '../../../../helpers';
+
+const { Text } = Typography;
+
+const PAGE_SIZE = 10;
+
+const SessionSummaryModal = ({
+  t,
+  isAdminUser,
+  showSessionSummaryModal,
+  setShowSessionSummaryModal,
+  getFormValues,
+  viewSessionLogs,
+}) => {
+  const [loading, setLoading] = useState(false);
+  const [items, setItems] = useState([]);
+  const [total, setTotal] = useState(0);
+  const [page, setPage] = useState(1);
+  const [order, setOrder] = useState('quota');
+  const requestSeqRef = useRef(0);
+
+  useEffect(() => {
+    if (showSessionSummaryModal) {
+      setPage(1);
+    }
+  }, [showSessionSummaryModal]);
+
+  useEffect(() => {
+    if (!showSessionSummaryModal) {
+      requestSeqRef.current += 1; // invalidate inflight request
+      setLoading(false);
+      setItems([]);
+      setTotal(0);
+      return;
+    }
+
+    const {
+      username,
+      token_name,
+      model_name,
+      start_timestamp,
+      end_timestamp,
+    } = getFormValues();
+    const params = {
+      p: page,
+      page_size: PAGE_SIZE,
+      order,
+      token_name,
+      model_name,
+      start_timestamp: Date.parse(start_timestamp) / 1000 || '',
+      end_timestamp: Date.parse(end_timestamp) / 1000 || '',
+    };
+    if (isAdminUser) {
+      params.username = username;
+    }
+
+    const reqSeq = (requestSeqRef.current += 1);
+    setLoading(true);
+    (async () => {
+      try {
+        const res = await API.get(
+          isAdminUser ? '/api/log/sessions' : '/api/log/self/sessions',
+          { params, disableDuplicate: true },
+        );
+        if (reqSeq !== requestSeqRef.current) return;
+        const { success, message, data } = res.data || {};
+        if (!success) {
+          showError(t(message || '请求失败'));
+          return;
+        }
+        setItems(data?.items || []);
+        setTotal(data?.total || 0);
+      } catch (e) {
+        if (reqSeq !== requestSeqRef.current) return;
+        showError(t('请求失败'));
+      } finally {
+        if (reqSeq !== requestSeqRef.current) return;
+        setLoading(false);
+      }
+    })();
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [showSessionSummaryModal, page, order, isAdminUser]);
+
+  const columns = [
+    {
+      title: t('会话 ID'),
+      dataIndex: 'session_id',
+      render: (text) => (
+        <Text ellipsis={{ showTooltip: true }} style={{ maxWidth: 200 }}>
+          {text}
+        </Text>
+      ),
+    },
+    ...(isAdminUser
+      ? [
+          {
+            title: t('用户'),
+            dataIndex: 'username',
+          },
+        ]
+      : []),
+    {
+      title: t('请求次数'),
+      dataIndex: 'requests',
+    },
+    {
+      title: t('输入'),
+      dataIndex: 'prompt_tokens',
+    },
+    {
+      title: t('输出'),
+      dataIndex: 'completion_tokens',
+    },
+    {
+      title: t('花费'),
+      dataIndex: 'quota',
+      render: (quota) => renderQuota(quota, 6),
+    },
+    {
+      title: t('最后活跃'),
+      dataIndex: 'last_active_at',
+      render: (value) => timestamp2string(value),
+    },
+    {
+      title: '',
+      dataIndex: 'operate',
+      render: (_, record) => (
+        <Button
+          size='small'
+          theme='borderless'
+          onClick={() => viewSessionLogs(record.session_id)}
+        >
+          {t('查看日志')}
+        </Button>
+      ),
+    },
+  ];
+
+  return (
+    <Modal
+      title={t('会话消费')}
+      visible={showSessionSummaryModal}
+      onCancel={() => setShowSessionSummaryModal(false)}
+      footer={null}
+      centered
+      closable
+      maskClosable
+      width={960}
+    >
+      <div className='flex justify-between items-center mb-3 gap-2'>
+        <Text type='tertiary' size='small'>
+          {t(
+            '按客户端传递的会话 ID（X-Session-Id 请求头或 metadata.session_id）汇总当前筛选时间范围内的消费',
+          )}
+        </Text>
+        <Select
+          value={order}
+          onChange={(value) => {
+            setOrder(value);
+            setPage(1);
+          }}
+          size='small'
+          style={{ width: 140 }}
+          optionList={[
+            { label: t('按花费排序'), value: 'quota' },
+            { label: t('按 Token 排序'), value: 'tokens' },
+            { label: t('按请求次数排序'), value: 'requests' },
+            { label: t('按最后活跃排序'), value: 'last_active' },
+          ]}
+        />
+      </div>
+      <Table
+        columns={columns}
+        dataSource={items}
+        rowKey={(record) => `${record.user_id}-${record.session_id}`}
+        loading={loading}
+        size='small'
+        pagination={{
+          currentPage: page,
+          pageSize: PAGE_SIZE,
+          total,
+          onPageChange: setPage,
+        }}
+      />
+    </Modal>
+  );
+};
+
+export default SessionSummaryModal;
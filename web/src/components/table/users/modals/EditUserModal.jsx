@@ -63,6 +63,8 @@ const EditUserModal = (props) => {
   const isMobile = useIsMobile();
   const [groupOptions, setGroupOptions] = useState([]);
   const formApiRef = useRef(null);
+  // 编辑前读取到的额度，提交时用于检测期间发生的扣费或其他编辑
+  const expectedQuotaRef = useRef(null);
 
   const isEdit = Boolean(userId);
 
@@ -99,6 +101,7 @@ const EditUserModal = (props) => {
     const { success, message, data } = res.data;
     if (success) {
       data.password = '';
+      expectedQuotaRef.current = data.quota;
       formApiRef.current?.setValues({ ...getInitValues(), ...data });
     } else {
       showError(message);
@@ -119,9 +122,20 @@ const EditUserModal = (props) => {
       payload.quota = parseInt(payload.quota) || 0;
     if (userId) {
       payload.id = parseInt(userId);
+      payload.expected_quota = expectedQuotaRef.current;
     }
     const url = userId ? `/api/user/` : `/api/user/self`;
-    const res = await API.put(url, payload);
+    let res;
+    try {
+      res = await API.put(url, payload, { skipErrorHandler: true });
+    } catch (error) {
+      res = error.response;
+    }
+    if (!res?.data) {
+      showError(t('用户信息更新失败'));
+      setLoading(false);
+      return;
+    }
     const { success, message } = res.data;
     if (success) {
       showSuccess(t('用户信息更新成功！'));
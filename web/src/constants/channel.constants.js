@@ -189,6 +189,36 @@ export const CHANNEL_OPTIONS = [
     color: 'blue',
     label: 'Codex (OpenAI OAuth)',
   },
+  {
+    value: 58,
+    color: 'grey',
+    label: 'Mock',
+  },
+  {
+    value: 59,
+    color: 'blue',
+    label: 'vLLM',
+  },
+  {
+    value: 60,
+    color: 'orange',
+    label: 'TGI (Text Generation Inference)',
+  },
+  {
+    value: 61,
+    color: 'grey',
+    label: 'llama.cpp',
+  },
+  {
+    value: 62,
+    color: 'orange',
+    label: 'Groq',
+  },
+  {
+    value: 63,
+    color: 'purple',
+    label: 'Stability AI',
+  },
 ];
 
 export const MODEL_TABLE_PAGE_SIZE = 10;
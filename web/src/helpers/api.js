@@ -275,6 +275,12 @@ export async function onOIDCClicked(
   }
 }
 
+export async function onSSOClicked(name, options = {}) {
+  const state = await prepareOAuthState(options);
+  if (!state) return;
+  window.location.href = `/api/sso/${encodeURIComponent(name)}/login?state=${state}`;
+}
+
 export async function onGitHubOAuthClicked(github_client_id, options = {}) {
   const state = await prepareOAuthState(options);
   if (!state) return;
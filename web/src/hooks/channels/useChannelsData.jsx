@@ -38,6 +38,18 @@ import { useTableCompactMode } from '../common/useTableCompactMode';
 import { Modal, Button } from '@douyinfe/semi-ui';
 import { openCodexUsageModal } from '../../components/table/channels/modals/CodexUsageModal';
 
+// 把渠道列表接口返回的熔断器状态挂到对应渠道上
+const attachCircuitBreakers = (items, circuitBreakers) => {
+  if (!items || !circuitBreakers) {
+    return items;
+  }
+  return items.map((item) =>
+    circuitBreakers[item.id]
+      ? { ...item, circuit_breaker: circuitBreakers[item.id] }
+      : item,
+  );
+};
+
 export const useChannelsData = () => {
   const { t } = useTranslation();
   const isMobile = useIsMobile();
@@ -350,7 +362,7 @@ export const useChannelsData = () => {
 
     const { success, message, data } = res.data;
     if (success) {
-      const { items, total, type_counts } = data;
+      const { items, total, type_counts, circuit_breakers } = data;
       if (type_counts) {
         const sumAll = Object.values(type_counts).reduce(
           (acc, v) => acc + v,
@@ -358,7 +370,10 @@ export const useChannelsData = () => {
         );
         setTypeCounts({ ...type_counts, all: sumAll });
       }
-      setChannelFormat(items, enableTagMode);
+      setChannelFormat(
+        attachCircuitBreakers(items, circuit_breakers),
+        enableTagMode,
+      );
       setChannelCount(total);
     } else {
       showError(message);
@@ -397,13 +412,21 @@ export const useChannelsData = () => {
       );
       const { success, message, data } = res.data;
       if (success) {
-        const { items = [], total = 0, type_counts = {} } = data;
+        const {
+          items = [],
+          total = 0,
+          type_counts = {},
+          circuit_breakers,
+        } = data;
         const sumAll = Object.values(type_counts).reduce(
           (acc, v) => acc + v,
           0,
         );
         setTypeCounts({ ...type_counts, all: sumAll });
-        setChannelFormat(items, enableTagMode);
+        setChannelFormat(
+          attachCircuitBreakers(items, circuit_breakers),
+          enableTagMode,
+        );
         setChannelCount(total);
         setActivePage(page);
       } else {
@@ -431,6 +454,40 @@ export const useChannelsData = () => {
     }
   };
 
+  // 渠道被配置或任务引用时，列出依赖并确认后级联删除
+  const confirmCascadeDelete = (id, dependencies) => {
+    Modal.confirm({
+      title: t('渠道存在依赖'),
+      content: (
+        <div>
+          <div style={{ marginBottom: 8 }}>
+            {t('以下配置或任务引用了该渠道，级联删除会从配置中移除对该渠道的引用')}
+          </div>
+          <ul style={{ paddingLeft: 20, margin: 0 }}>
+            {dependencies.map((dep, index) => (
+              <li key={index}>
+                {dep.name}
+                {dep.detail ? `：${dep.detail}` : ''}
+              </li>
+            ))}
+          </ul>
+        </div>
+      ),
+      okText: t('级联删除'),
+      okType: 'danger',
+      onOk: async () => {
+        const res = await API.delete(`/api/channel/${id}/?cascade=true`);
+        const { success, message } = res.data;
+        if (success) {
+          showSuccess(t('操作成功完成！'));
+          await refresh();
+        } else {
+          showError(message);
+        }
+      },
+    });
+  };
+
   // Channel management
   const manageChannel = async (id, action, record, value) => {
     let data = { id };
@@ -465,6 +522,10 @@ export const useChannelsData = () => {
         break;
     }
     const { success, message } = res.data;
+    if (!success && action === 'delete' && Array.isArray(res.data.data)) {
+      confirmCascadeDelete(id, res.data.data);
+      return;
+    }
     if (success) {
       showSuccess(t('操作成功完成！'));
       let channel = res.data.data;
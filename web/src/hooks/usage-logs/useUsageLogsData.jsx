@@ -95,6 +95,7 @@ export const useLogsData = () => {
     model_name: '',
     channel: '',
     group: '',
+    session_id: '',
     dateRange: [
       timestamp2string(getTodayStartTimestamp()),
       timestamp2string(now.getTime() / 1000 + 3600),
@@ -126,6 +127,9 @@ export const useLogsData = () => {
   const [channelAffinityUsageCacheTarget, setChannelAffinityUsageCacheTarget] =
     useState(null);
 
+  // Session spend summary modal state
+  const [showSessionSummaryModal, setShowSessionSummaryModal] = useState(false);
+
   // Load saved column preferences from localStorage
   useEffect(() => {
     const savedColumns = localStorage.getItem(STORAGE_KEY);
@@ -245,6 +249,7 @@ export const useLogsData = () => {
       end_timestamp,
       channel: formValues.channel || '',
       group: formValues.group || '',
+      session_id: (formValues.session_id || '').trim(),
       logType: formValues.logType ? parseInt(formValues.logType) : 0,
     };
   };
@@ -377,6 +382,18 @@ export const useLogsData = () => {
           value: `${logs[i].channel} - ${logs[i].channel_name || '[未知]'}`,
         });
       }
+      if (logs[i].session_id) {
+        expandDataLocal.push({
+          key: t('会话 ID'),
+          value: logs[i].session_id,
+        });
+      }
+      if (logs[i].request_id) {
+        expandDataLocal.push({
+          key: t('请求 ID'),
+          value: logs[i].request_id,
+        });
+      }
       if (other?.ws || other?.audio) {
         expandDataLocal.push({
           key: t('语音输入'),
@@ -455,6 +472,61 @@ export const useLogsData = () => {
             value: other.reject_reason,
           });
         }
+        if (other?.stream_error_code) {
+          expandDataLocal.push({
+            key: t('流式中断错误'),
+            value: other.stream_error_code,
+          });
+        }
+        if (other?.model_alias) {
+          expandDataLocal.push({
+            key: t('请求模型别名'),
+            value: other.model_alias,
+          });
+        }
+        if (other?.traffic_split) {
+          expandDataLocal.push({
+            key: t('A/B 分流'),
+            value:
+              other.traffic_split === 'candidate' ? t('新渠道') : t('基准渠道'),
+          });
+        }
+        if (other?.mirror_channel_id) {
+          expandDataLocal.push({
+            key: t('影子渠道'),
+            value: other.mirror_channel_id,
+          });
+        }
+        if (other?.mirror_of) {
+          expandDataLocal.push({
+            key: t('影子请求的原日志'),
+            value: other.mirror_of,
+          });
+        }
+        if (other?.tool_loop_stop) {
+          expandDataLocal.push({
+            key: t('工具循环超出上限'),
+            value: other.tool_loop_stop,
+          });
+        }
+        if (other?.request_defaults?.length > 0) {
+          expandDataLocal.push({
+            key: t('补充的默认参数'),
+            value: other.request_defaults.join(', '),
+          });
+        }
+        if (other?.tool_call_emulation) {
+          expandDataLocal.push({
+            key: t('工具调用'),
+            value: t('由网关模拟'),
+          });
+        }
+        if (other?.native_passthrough) {
+          expandDataLocal.push({
+            key: t('原生透传'),
+            value: t('请求和响应未经转换'),
+          });
+        }
       }
       if (logs[i].type === 2) {
         let modelMapped =
@@ -656,6 +728,7 @@ export const useLogsData = () => {
       end_timestamp,
       channel,
       group,
+      session_id,
       logType: formLogType,
     } = getFormValues();
 
@@ -669,9 +742,9 @@ export const useLogsData = () => {
     let localStartTimestamp = Date.parse(start_timestamp) / 1000;
     let localEndTimestamp = Date.parse(end_timestamp) / 1000;
     if (isAdminUser) {
-      url = `/api/log/?p=${startIdx}&page_size=${pageSize}&type=${currentLogType}&username=${username}&token_name=${token_name}&model_name=${model_name}&start_timestamp=${localStartTimestamp}&end_timestamp=${localEndTimestamp}&channel=${channel}&group=${group}`;
+      url = `/api/log/?p=${startIdx}&page_size=${pageSize}&type=${currentLogType}&username=${username}&token_name=${token_name}&model_name=${model_name}&start_timestamp=${localStartTimestamp}&end_timestamp=${localEndTimestamp}&channel=${channel}&group=${group}&session_id=${session_id}`;
     } else {
-      url = `/api/log/self/?p=${startIdx}&page_size=${pageSize}&type=${currentLogType}&token_name=${token_name}&model_name=${model_name}&start_timestamp=${localStartTimestamp}&end_timestamp=${localEndTimestamp}&group=${group}`;
+      url = `/api/log/self/?p=${startIdx}&page_size=${pageSize}&type=${currentLogType}&token_name=${token_name}&model_name=${model_name}&start_timestamp=${localStartTimestamp}&end_timestamp=${localEndTimestamp}&group=${group}&session_id=${session_id}`;
     }
     url = encodeURI(url);
     const res = await API.get(url);
@@ -706,6 +779,17 @@ export const useLogsData = () => {
       });
   };
 
+  // 从会话汇总跳转到该会话的日志
+  const viewSessionLogs = (sessionId) => {
+    if (formApi) {
+      formApi.setValue('session_id', sessionId);
+    }
+    setShowSessionSummaryModal(false);
+    setTimeout(() => {
+      refresh();
+    }, 0);
+  };
+
   // Refresh function
   const refresh = async () => {
     setActivePage(1);
@@ -802,6 +886,11 @@ export const useLogsData = () => {
     channelAffinityUsageCacheTarget,
     openChannelAffinityUsageCacheModal,
 
+    // Session spend summary modal
+    showSessionSummaryModal,
+    setShowSessionSummaryModal,
+    viewSessionLogs,
+
     // Functions
     loadLogs,
     handlePageChange,
@@ -66,10 +66,23 @@ const chatCompletionsToResponsesPolicyAllChannelsExample = JSON.stringify(
   2,
 );
 
+const completionsToChatPolicyExample = JSON.stringify(
+  {
+    enabled: true,
+    channel_ids: [1, 2],
+    channel_types: [1],
+    system_prompt: '',
+    prompt_template: '{{prompt}}',
+  },
+  null,
+  2,
+);
+
 const defaultGlobalSettingInputs = {
   'global.pass_through_request_enabled': false,
   'global.thinking_model_blacklist': '[]',
   'global.chat_completions_to_responses_policy': '{}',
+  'global.completions_to_chat_policy': '{}',
   'general_setting.ping_interval_enabled': false,
   'general_setting.ping_interval_seconds': 60,
 };
@@ -99,7 +112,10 @@ export default function SettingGlobalModel(props) {
       const text = typeof value === 'string' ? value.trim() : '';
       return text === '' ? '[]' : value;
     }
-    if (key === 'global.chat_completions_to_responses_policy') {
+    if (
+      key === 'global.chat_completions_to_responses_policy' ||
+      key === 'global.completions_to_chat_policy'
+    ) {
       const text = typeof value === 'string' ? value.trim() : '';
       return text === '' ? '{}' : value;
     }
@@ -156,7 +172,10 @@ export default function SettingGlobalModel(props) {
             value = defaultGlobalSettingInputs[key];
           }
         }
-        if (key === 'global.chat_completions_to_responses_policy') {
+        if (
+          key === 'global.chat_completions_to_responses_policy' ||
+          key === 'global.completions_to_chat_policy'
+        ) {
           try {
             value =
               value && String(value).trim() !== ''
@@ -355,6 +374,43 @@ export default function SettingGlobalModel(props) {
               </Row>
             </Form.Section>
 
+            <Form.Section
+              text={
+                <span style={{ fontSize: 14, fontWeight: 600 }}>
+                  {t('Completions→ChatCompletions 兼容配置')}
+                </span>
+              }
+            >
+              <Row style={{ marginTop: 10 }}>
+                <Col span={24}>
+                  <Form.TextArea
+                    label={t('参数配置')}
+                    field={'global.completions_to_chat_policy'}
+                    placeholder={t('例如：') + '\n' + completionsToChatPolicyExample}
+                    extraText={t(
+                      '旧版 /v1/completions 请求发往只支持对话接口的渠道时，按 prompt_template 转换为对话请求，模板支持 prompt 和 suffix 占位符；不支持 completions 的 OpenAI 兼容渠道需要在 channel_ids 或 channel_types 中指定',
+                    )}
+                    rows={8}
+                    rules={[
+                      {
+                        validator: (rule, value) => {
+                          if (!value || value.trim() === '') return true;
+                          return verifyJSON(value);
+                        },
+                        message: t('不是合法的 JSON 字符串'),
+                      },
+                    ]}
+                    onChange={(value) =>
+                      setInputs((prev) => ({
+                        ...prev,
+                        'global.completions_to_chat_policy': value,
+                      }))
+                    }
+                  />
+                </Col>
+              </Row>
+            </Form.Section>
+
             <Form.Section
               text={
                 <span style={{ fontSize: 14, fontWeight: 600 }}>
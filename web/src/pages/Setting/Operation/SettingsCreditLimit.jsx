@@ -37,6 +37,10 @@ export default function SettingsCreditLimit(props) {
     QuotaForInviter: '',
     QuotaForInvitee: '',
     'quota_setting.enable_free_model_pre_consume': true,
+    'quota_setting.stream_checkpoint_seconds': 0,
+    'quota_setting.stream_reservation_enabled': false,
+    'quota_setting.stream_reserve_completion_tokens': 4096,
+    'quota_setting.stream_hard_cap_quota': 0,
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -166,6 +170,72 @@ export default function SettingsCreditLimit(props) {
                   }
                 />
               </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={6}>
+                <Form.InputNumber
+                  label={t('流式响应追加预扣费间隔')}
+                  field={'quota_setting.stream_checkpoint_seconds'}
+                  step={1}
+                  min={0}
+                  suffix={t('秒')}
+                  extraText={t(
+                    '长时间的流式响应按已输出的内容定期追加预扣费，额度不足时中断输出，0 表示关闭',
+                  )}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'quota_setting.stream_checkpoint_seconds': String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Col xs={24} sm={12} md={8} lg={8} xl={6}>
+                <Form.Switch
+                  label={t('流式请求预留额度')}
+                  field={'quota_setting.stream_reservation_enabled'}
+                  extraText={t(
+                    '开启后流式请求总是预扣费，未设置 max_tokens 时按默认输出长度预留额度，结束后按实际用量多退少补',
+                  )}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'quota_setting.stream_reservation_enabled': value,
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={6}>
+                <Form.InputNumber
+                  label={t('默认预留输出长度')}
+                  field={'quota_setting.stream_reserve_completion_tokens'}
+                  step={256}
+                  min={0}
+                  suffix={'Token'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'quota_setting.stream_reserve_completion_tokens':
+                        String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={6}>
+                <Form.InputNumber
+                  label={t('单个流式请求额度上限')}
+                  field={'quota_setting.stream_hard_cap_quota'}
+                  step={1}
+                  min={0}
+                  extraText={t('达到上限时在追加预扣费时中断输出，0 表示不限制')}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'quota_setting.stream_hard_cap_quota': String(value),
+                    })
+                  }
+                />
+              </Col>
             </Row>
             <Row>
               <Col>
@@ -56,6 +56,7 @@ export default function GeneralSettings(props) {
     DefaultCollapseSidebar: false,
     DemoSiteEnabled: false,
     SelfUseModeEnabled: false,
+    LatencyHeadersEnabled: false,
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -286,6 +287,19 @@ export default function GeneralSettings(props) {
                   onChange={handleFieldChange('SelfUseModeEnabled')}
                 />
               </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'LatencyHeadersEnabled'}
+                  label={t('返回延迟拆分响应头')}
+                  extraText={t(
+                    '在转发响应中返回 Server-Timing 头，包含排队、路由、上游连接、首字节和总耗时',
+                  )}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={handleFieldChange('LatencyHeadersEnabled')}
+                />
+              </Col>
             </Row>
             <Row>
               <Button size='default' onClick={onSubmit}>
@@ -46,6 +46,13 @@ export default function SettingsLog(props) {
   const [loadingCleanHistoryLog, setLoadingCleanHistoryLog] = useState(false);
   const [inputs, setInputs] = useState({
     LogConsumeEnabled: false,
+    LogPayloadMaxRunes: 2048,
+    LogPayloadRouteLimits: '',
+    LogPayloadSuccessSampleRate: 100,
+    LogPayloadErrorSampleRate: 100,
+    LogRedactionEnabled: false,
+    LogRedactionRules: '',
+    LogPayloadStorageEnabled: false,
     historyTimestamp: dayjs().subtract(1, 'month').toDate(),
   });
   const refForm = useRef();
@@ -59,7 +66,10 @@ export default function SettingsLog(props) {
     if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
     const requestQueue = updateArray.map((item) => {
       let value = '';
-      if (typeof inputs[item.key] === 'boolean') {
+      if (
+        typeof inputs[item.key] === 'boolean' ||
+        typeof inputs[item.key] === 'number'
+      ) {
         value = String(inputs[item.key]);
       } else {
         value = inputs[item.key];
@@ -247,6 +257,135 @@ export default function SettingsLog(props) {
                 </Spin>
               </Col>
             </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'LogPayloadMaxRunes'}
+                  label={t('日志内容长度上限')}
+                  extraText={t(
+                    '日志中保留的请求和响应内容的最大字符数，0 表示不截断',
+                  )}
+                  min={0}
+                  step={1024}
+                  suffix={t('字符')}
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      LogPayloadMaxRunes: value,
+                    });
+                  }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={16} lg={16} xl={16}>
+                <Form.TextArea
+                  field={'LogPayloadRouteLimits'}
+                  label={t('按路由设置日志内容长度上限')}
+                  extraText={t(
+                    '路由前缀到最大字符数的 JSON，最长前缀优先，渠道的额外设置 log_payload_max_runes 优先于此设置',
+                  )}
+                  placeholder={'{"/v1/chat/completions": 8192, "/v1/embeddings": 256}'}
+                  autosize={{ minRows: 2, maxRows: 6 }}
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      LogPayloadRouteLimits: value,
+                    });
+                  }}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'LogPayloadSuccessSampleRate'}
+                  label={t('成功请求内容采样比例')}
+                  extraText={t(
+                    '只为该比例的成功请求保存请求和响应内容，用于减少日志详情的增长',
+                  )}
+                  min={0}
+                  max={100}
+                  step={10}
+                  suffix={'%'}
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      LogPayloadSuccessSampleRate: value,
+                    });
+                  }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'LogPayloadErrorSampleRate'}
+                  label={t('失败请求内容采样比例')}
+                  extraText={t('为该比例的失败请求保存请求和响应内容')}
+                  min={0}
+                  max={100}
+                  step={10}
+                  suffix={'%'}
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      LogPayloadErrorSampleRate: value,
+                    });
+                  }}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'LogRedactionEnabled'}
+                  label={t('日志内容脱敏')}
+                  extraText={t('记录请求和响应内容前按脱敏规则替换敏感信息')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      LogRedactionEnabled: value,
+                    });
+                  }}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={16} lg={16} xl={16}>
+                <Form.TextArea
+                  field={'LogRedactionRules'}
+                  label={t('脱敏规则')}
+                  extraText={t(
+                    'type 为 regex 时 pattern 为正则表达式；type 为 key 时 pattern 为 JSON 键名或以 . 分隔的路径，* 匹配任意键或数组下标',
+                  )}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      LogRedactionRules: value,
+                    });
+                  }}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'LogPayloadStorageEnabled'}
+                  label={t('日志内容写入对象存储')}
+                  extraText={t(
+                    '完整的请求和响应内容压缩后写入对象存储，数据库只保留截断后的预览，对象存储在系统设置中配置',
+                  )}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      LogPayloadStorageEnabled: value,
+                    });
+                  }}
+                />
+              </Col>
+            </Row>
 
             <Row>
               <Button size='default' onClick={onSubmit}>
@@ -37,6 +37,7 @@ import {
   showError,
   showSuccess,
   showWarning,
+  timestamp2string,
 } from '../../../helpers';
 import { useTranslation } from 'react-i18next';
 
@@ -60,6 +61,8 @@ export default function SettingsPerformance(props) {
   const [loading, setLoading] = useState(false);
   const [statsLoading, setStatsLoading] = useState(false);
   const [stats, setStats] = useState(null);
+  const [sqliteStatus, setSqliteStatus] = useState(null);
+  const [backupLoading, setBackupLoading] = useState(false);
   const [inputs, setInputs] = useState({
     'performance_setting.disk_cache_enabled': false,
     'performance_setting.disk_cache_threshold_mb': 10,
@@ -125,6 +128,57 @@ export default function SettingsPerformance(props) {
     }
   }
 
+  async function fetchSqliteStatus() {
+    try {
+      const res = await API.get('/api/performance/sqlite');
+      if (res.data.success) {
+        setSqliteStatus(res.data.data);
+      }
+    } catch (error) {
+      console.error('Failed to fetch sqlite status:', error);
+    }
+  }
+
+  async function checkpointSqlite() {
+    try {
+      const res = await API.post('/api/performance/sqlite/checkpoint');
+      if (res.data.success) {
+        showSuccess(t('Checkpoint 已执行'));
+        fetchSqliteStatus();
+      } else {
+        showError(res.data.message || t('Checkpoint 执行失败'));
+      }
+    } catch (error) {
+      showError(t('Checkpoint 执行失败'));
+    }
+  }
+
+  async function downloadSqliteBackup() {
+    setBackupLoading(true);
+    try {
+      const res = await API.get('/api/performance/sqlite/backup', {
+        responseType: 'blob',
+      });
+      if (res.data.type === 'application/json') {
+        const { message } = JSON.parse(await res.data.text());
+        showError(message || t('备份失败'));
+        return;
+      }
+      const disposition = res.headers['content-disposition'] || '';
+      const match = disposition.match(/filename="?([^"]+)"?/);
+      const url = URL.createObjectURL(res.data);
+      const a = document.createElement('a');
+      a.href = url;
+      a.download = match ? match[1] : 'new-api-backup.db';
+      a.click();
+      URL.revokeObjectURL(url);
+    } catch (error) {
+      showError(t('备份失败'));
+    } finally {
+      setBackupLoading(false);
+    }
+  }
+
   async function clearDiskCache() {
     try {
       const res = await API.delete('/api/performance/disk_cache');
@@ -183,6 +237,7 @@ export default function SettingsPerformance(props) {
       refForm.current.setValues({ ...inputs, ...currentInputs });
     }
     fetchStats();
+    fetchSqliteStatus();
   }, [props.options]);
 
   const diskCacheUsagePercent =
@@ -507,6 +562,70 @@ export default function SettingsPerformance(props) {
           )}
         </Form.Section>
       </Spin>
+
+      {/* SQLite 数据库 */}
+      {sqliteStatus?.enabled && (
+        <Form.Section text={t('SQLite 数据库')}>
+          <Row gutter={16} style={{ marginBottom: 16 }}>
+            <Col span={24}>
+              <div style={{ display: 'flex', gap: 8, flexWrap: 'wrap' }}>
+                <Button onClick={fetchSqliteStatus}>{t('刷新')}</Button>
+                <Button onClick={checkpointSqlite}>
+                  {t('立即 Checkpoint')}
+                </Button>
+                <Button
+                  type='primary'
+                  loading={backupLoading}
+                  onClick={downloadSqliteBackup}
+                >
+                  {t('下载在线备份')}
+                </Button>
+              </div>
+            </Col>
+          </Row>
+          {sqliteStatus.journal_mode?.toUpperCase() !== 'WAL' && (
+            <Banner
+              type='warning'
+              description={t(
+                '当前未使用 WAL 模式，读写会相互阻塞，可通过 SQLITE_JOURNAL_MODE 环境变量调整',
+              )}
+              style={{ marginBottom: 16 }}
+            />
+          )}
+          <Descriptions
+            data={[
+              { key: t('数据库文件'), value: sqliteStatus.path },
+              { key: t('日志模式'), value: sqliteStatus.journal_mode },
+              { key: t('同步级别'), value: sqliteStatus.synchronous },
+              {
+                key: t('锁等待超时'),
+                value: `${sqliteStatus.busy_timeout} ms`,
+              },
+              {
+                key: t('数据库大小'),
+                value: formatBytes(sqliteStatus.db_size),
+              },
+              {
+                key: t('WAL 大小'),
+                value: formatBytes(sqliteStatus.wal_size),
+              },
+              {
+                key: t('定期 Checkpoint'),
+                value:
+                  sqliteStatus.checkpoint_interval > 0
+                    ? `${sqliteStatus.checkpoint_mode} / ${sqliteStatus.checkpoint_interval}s`
+                    : t('已关闭'),
+              },
+              {
+                key: t('最近 Checkpoint'),
+                value: sqliteStatus.last_checkpoint
+                  ? `${timestamp2string(sqliteStatus.last_checkpoint.at)} (${sqliteStatus.last_checkpoint.checkpointed_frames}/${sqliteStatus.last_checkpoint.log_frames})`
+                  : '-',
+              },
+            ]}
+          />
+        </Form.Section>
+      )}
     </>
   );
 }
@@ -43,10 +43,15 @@ export default function ModelRatioSettings(props) {
     ModelPrice: '',
     ModelRatio: '',
     CacheRatio: '',
+    CreateCacheRatio: '',
     CompletionRatio: '',
     ImageRatio: '',
     AudioRatio: '',
     AudioCompletionRatio: '',
+    AudioInputSecondPrice: '',
+    AudioOutputTokenPrice: '',
+    AudioCharacterPrice: '',
+    ImageGenerationPrice: '',
     ExposeRatioEnabled: false,
   });
   const refForm = useRef();
@@ -200,6 +205,30 @@ export default function ModelRatioSettings(props) {
             />
           </Col>
         </Row>
+        <Row gutter={16}>
+          <Col xs={24} sm={16}>
+            <Form.TextArea
+              label={t('缓存创建倍率')}
+              extraText={t(
+                '写入提示缓存的输入 token 相对模型倍率的倍率，未设置的模型默认为 1.25',
+              )}
+              placeholder={t('为一个 JSON 文本，键为模型名称，值为倍率')}
+              field={'CreateCacheRatio'}
+              autosize={{ minRows: 6, maxRows: 12 }}
+              trigger='blur'
+              stopValidateWithError
+              rules={[
+                {
+                  validator: (rule, value) => verifyJSON(value),
+                  message: '不是合法的 JSON 字符串',
+                },
+              ]}
+              onChange={(value) =>
+                setInputs({ ...inputs, CreateCacheRatio: value })
+              }
+            />
+          </Col>
+        </Row>
         <Row gutter={16}>
           <Col xs={24} sm={16}>
             <Form.TextArea
@@ -294,6 +323,110 @@ export default function ModelRatioSettings(props) {
             />
           </Col>
         </Row>
+        <Row gutter={16}>
+          <Col xs={24} sm={16}>
+            <Form.TextArea
+              label={t('音频输入按秒价格（仅实时/语音模型）')}
+              extraText={t(
+                '输入音频按时长计费，键为模型名称，值为每秒的美元价格，配置后替代音频倍率',
+              )}
+              placeholder={t(
+                '为一个 JSON 文本，键为模型名称，值为每秒价格，例如：{"gpt-4o-realtime-preview": 0.001}',
+              )}
+              field={'AudioInputSecondPrice'}
+              autosize={{ minRows: 6, maxRows: 12 }}
+              trigger='blur'
+              stopValidateWithError
+              rules={[
+                {
+                  validator: (rule, value) => verifyJSON(value),
+                  message: '不是合法的 JSON 字符串',
+                },
+              ]}
+              onChange={(value) =>
+                setInputs({ ...inputs, AudioInputSecondPrice: value })
+              }
+            />
+          </Col>
+        </Row>
+        <Row gutter={16}>
+          <Col xs={24} sm={16}>
+            <Form.TextArea
+              label={t('音频输出价格（仅实时/语音模型）')}
+              extraText={t(
+                '输出音频 token 单独定价，键为模型名称，值为每百万 token 的美元价格，配置后替代音频补全倍率',
+              )}
+              placeholder={t(
+                '为一个 JSON 文本，键为模型名称，值为每百万 token 价格，例如：{"gpt-4o-realtime-preview": 80}',
+              )}
+              field={'AudioOutputTokenPrice'}
+              autosize={{ minRows: 6, maxRows: 12 }}
+              trigger='blur'
+              stopValidateWithError
+              rules={[
+                {
+                  validator: (rule, value) => verifyJSON(value),
+                  message: '不是合法的 JSON 字符串',
+                },
+              ]}
+              onChange={(value) =>
+                setInputs({ ...inputs, AudioOutputTokenPrice: value })
+              }
+            />
+          </Col>
+        </Row>
+        <Row gutter={16}>
+          <Col xs={24} sm={16}>
+            <Form.TextArea
+              label={t('语音合成按字符价格')}
+              extraText={t(
+                '/v1/audio/speech 按输入字符数计费，键为模型名称，值为每百万字符的美元价格；转录与翻译接口使用音频输入按秒价格',
+              )}
+              placeholder={t(
+                '为一个 JSON 文本，键为模型名称，值为每百万字符价格，例如：{"tts-1": 15}',
+              )}
+              field={'AudioCharacterPrice'}
+              autosize={{ minRows: 6, maxRows: 12 }}
+              trigger='blur'
+              stopValidateWithError
+              rules={[
+                {
+                  validator: (rule, value) => verifyJSON(value),
+                  message: '不是合法的 JSON 字符串',
+                },
+              ]}
+              onChange={(value) =>
+                setInputs({ ...inputs, AudioCharacterPrice: value })
+              }
+            />
+          </Col>
+        </Row>
+        <Row gutter={16}>
+          <Col xs={24} sm={16}>
+            <Form.TextArea
+              label={t('图片按张价格')}
+              extraText={t(
+                '图片生成与编辑接口按张计费，键为模型名称，值为 "尺寸:品质" 到每张图片美元价格的映射，尺寸或品质可写为 *，依次匹配 尺寸:品质、尺寸、*:品质、*',
+              )}
+              placeholder={t(
+                '为一个 JSON 文本，例如：{"gpt-image-1": {"1024x1024:high": 0.167, "1024x1024": 0.042, "*": 0.042}}',
+              )}
+              field={'ImageGenerationPrice'}
+              autosize={{ minRows: 6, maxRows: 12 }}
+              trigger='blur'
+              stopValidateWithError
+              rules={[
+                {
+                  validator: (rule, value) => verifyJSON(value),
+                  message: '不是合法的 JSON 字符串',
+                },
+              ]}
+              onChange={(value) =>
+                setInputs({ ...inputs, ImageGenerationPrice: value })
+              }
+            />
+          </Col>
+        </Row>
         <Row gutter={16}>
           <Col span={16}>
             <Form.Switch